@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	indexerPackage "github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/probe"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+var (
+	backfillBatchSize         int
+	backfillRowsPerSecond     float64
+	backfillMaxReplicationLag time.Duration
+	backfillMaxActiveQueries  int64
+)
+
+func init() {
+	backfillRunCmd.Flags().IntVar(&backfillBatchSize, "batch-size", 1000, "rows loaded and updated per batch")
+	backfillRunCmd.Flags().Float64Var(&backfillRowsPerSecond, "rows-per-second", 0, "maximum rows processed per second, 0 for no limit")
+	backfillRunCmd.Flags().DurationVar(&backfillMaxReplicationLag, "max-replication-lag", 0, "hold batches while any replica lags by more than this, 0 to disable")
+	backfillRunCmd.Flags().Int64Var(&backfillMaxActiveQueries, "max-active-queries", 0, "hold batches while more queries than this are active on the database, 0 to disable")
+	backfillCmd.AddCommand(backfillRunCmd, backfillStatusCmd, backfillPauseCmd, backfillResumeCmd, backfillResetCmd, backfillIBCDenomsCmd)
+	indexCmd.AddCommand(backfillCmd)
+}
+
+var backfillCmd = &cobra.Command{
+	Use:   "backfill",
+	Short: "Runs and manages resumable backfills over the indexed dataset.",
+	Long: `Backfills compute and store values for rows indexed before the value was tracked. They walk their table in batches
+	and store their progress, so a stopped backfill resumes where it left off. Pausing and resuming is picked up by a running
+	backfill before its next batch.`,
+}
+
+var backfillRunCmd = &cobra.Command{
+	Use:   "run [job]",
+	Short: "Runs a backfill until it completes, resuming from its stored progress.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupBackfillCommand(cmd)
+
+		job, ok := findBackfillJob(args[0])
+		if !ok {
+			config.Log.Fatalf("Unknown backfill job %s", args[0])
+		}
+
+		runner := dbTypes.NewBackfillRunner(db, backfillBatchSize, dbTypes.BackfillThrottle{
+			RowsPerSecond:     backfillRowsPerSecond,
+			MaxReplicationLag: backfillMaxReplicationLag,
+			MaxActiveQueries:  backfillMaxActiveQueries,
+		})
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		if err := runner.Run(ctx, job); err != nil {
+			config.Log.Fatal("Backfill stopped", err)
+		}
+	},
+}
+
+var backfillStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Lists the available backfills and their progress.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupBackfillCommand(cmd)
+
+		jobs, err := dbTypes.GetBackfillJobs(cmd.Context(), db)
+		if err != nil {
+			config.Log.Fatal("Failed to get backfill progress", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "JOB\tSTATUS\tCURSOR\tROWS\tUPDATED\tLAST ERROR")
+		for _, job := range allBackfillJobs() {
+			found := false
+			for _, state := range jobs {
+				if state.Name == job.Name() {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\n", state.Name, state.Status, state.Cursor, state.RowsProcessed, state.UpdatedAt.Format("2006-01-02 15:04:05"), state.LastError)
+					found = true
+				}
+			}
+
+			if !found {
+				fmt.Fprintf(w, "%s\tnot started\t\t\t\t\n", job.Name())
+			}
+		}
+		w.Flush()
+	},
+}
+
+var backfillPauseCmd = &cobra.Command{
+	Use:   "pause [job]",
+	Short: "Pauses a backfill, a running backfill waits before its next batch until it is resumed.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupBackfillCommand(cmd)
+
+		if err := dbTypes.PauseBackfillJob(cmd.Context(), db, args[0]); err != nil {
+			config.Log.Fatal("Failed to pause backfill", err)
+		}
+
+		config.Log.Infof("Paused backfill %s", args[0])
+	},
+}
+
+var backfillResumeCmd = &cobra.Command{
+	Use:   "resume [job]",
+	Short: "Resumes a paused backfill.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupBackfillCommand(cmd)
+
+		if err := dbTypes.ResumeBackfillJob(cmd.Context(), db, args[0]); err != nil {
+			config.Log.Fatal("Failed to resume backfill", err)
+		}
+
+		config.Log.Infof("Resumed backfill %s", args[0])
+	},
+}
+
+var backfillResetCmd = &cobra.Command{
+	Use:   "reset [job]",
+	Short: "Clears the progress of a backfill so its next run starts from the first row.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupBackfillCommand(cmd)
+
+		if err := dbTypes.ResetBackfillJob(cmd.Context(), db, args[0]); err != nil {
+			config.Log.Fatal("Failed to reset backfill", err)
+		}
+
+		config.Log.Infof("Reset backfill %s", args[0])
+	},
+}
+
+var backfillIBCDenomsCmd = &cobra.Command{
+	Use:   "ibc-denoms",
+	Short: "Resolves the denom traces of the ibc/ denoms of the indexed fees.",
+	Long: `Queries the denom trace of every ibc/ denom the indexed fees of each configured chain were paid in from the chain
+	and stores it in the ibc_denoms table. Hashes already resolved are skipped, hashes that failed before are retried right
+	away. A hash that still cannot be resolved is stored with its error and retried by the indexer or the next backfill.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupBackfillCommand(cmd)
+
+		if err := viperConf.UnmarshalKey("chains", &indexer.Config.Chains, viper.DecodeHook(config.DecodeHook())); err != nil {
+			config.Log.Fatal("Failed to read the chains", err)
+		}
+		if err := indexer.Config.Validate(); err != nil {
+			config.Log.Fatal("Invalid config", err)
+		}
+		indexer.DB = db
+
+		chainIndexers := []*indexerPackage.Indexer{&indexer}
+		if indexer.Config.MultiChain() {
+			chainIndexers = nil
+			for _, chain := range indexer.Config.Chains {
+				chainIndexers = append(chainIndexers, indexer.ForChain(chain))
+			}
+		}
+
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+		defer stop()
+
+		for _, idxr := range chainIndexers {
+			if err := backfillIBCDenoms(ctx, idxr); err != nil {
+				idxr.Config.ChainLog().Fatal("IBC denom backfill stopped", err)
+			}
+		}
+	},
+}
+
+// backfillIBCDenoms resolves the ibc/ fee denoms of the chain of the indexer
+func backfillIBCDenoms(ctx context.Context, idxr *indexerPackage.Indexer) error {
+	var err error
+	idxr.ChainClient, err = probe.NewProbeClient(idxr.Config.Probe, idxr.CustomModuleBasics)
+	if err != nil {
+		return fmt.Errorf("error connecting to chain: %w", err)
+	}
+
+	dbChainID, err := dbTypes.GetDBChainID(ctx, idxr.DB, models.Chain{ChainID: idxr.Config.Probe.ChainID, Name: idxr.Config.Probe.ChainName})
+	if err != nil {
+		return err
+	}
+
+	resolved, failed, err := idxr.NewIBCDenomResolver(dbChainID).Backfill(ctx)
+	if err != nil {
+		return err
+	}
+
+	idxr.Config.ChainLog().Infof("Resolved %d IBC denoms, %d could not be resolved and will be retried", resolved, failed)
+	return nil
+}
+
+func allBackfillJobs() []dbTypes.BackfillJob {
+	return append(dbTypes.BuiltinBackfillJobs(), indexer.BackfillJobs...)
+}
+
+func findBackfillJob(name string) (dbTypes.BackfillJob, bool) {
+	for _, job := range allBackfillJobs() {
+		if job.Name() == name {
+			return job, true
+		}
+	}
+
+	return nil, false
+}
+
+func setupBackfillCommand(cmd *cobra.Command) *gorm.DB {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	db, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the database", err)
+	}
+
+	return db
+}
@@ -0,0 +1,265 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/core"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	indexerPackage "github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	"github.com/spf13/cobra"
+)
+
+// dryRunSummaryMaxFailedHeights is the number of failed heights listed at the end of a dry run
+const dryRunSummaryMaxFailedHeights = 20
+
+var dryRunOptions struct {
+	enabled bool
+	output  string
+}
+
+func init() {
+	indexCmd.Flags().BoolVar(&dryRunOptions.enabled, "dry-run", false, "fetch and decode base.start-block to base.end-block and print what indexing them would write, without connecting to the database")
+	indexCmd.Flags().StringVar(&dryRunOptions.output, "dry-run-output", "", "write the block summaries of --dry-run to this JSON file instead of printing them")
+}
+
+// dryRun fetches and decodes the configured heights like the indexer would and reports what indexing each block would
+// write. The database is never used. Exits with an error when a block could not be fetched or decoded.
+func dryRun(cmd *cobra.Command) {
+	if indexer.Config.MultiChain() {
+		config.Log.Fatal("--dry-run checks a single chain, configure it in the probe section instead of chains")
+	}
+
+	cfg := indexer.Config
+	log := cfg.ChainLog()
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	config.SetChainConfig(cfg.Probe.AccountPrefix)
+
+	if err := setupChainClient(ctx, &indexer, nil); err != nil {
+		log.Fatal("Failed to connect to the chain", err)
+	}
+
+	end := cfg.Base.EndBlock
+	if end == dbTypes.OpenEnd {
+		latestHeight, err := rpc.GetLatestBlockHeight(indexer.ChainClient)
+		if err != nil {
+			log.Fatal("Error getting blockchain latest height", err)
+		}
+		end = latestHeight
+	}
+	heights, err := dbTypes.NewHeightRange(cfg.Base.StartBlock, end)
+	if err != nil {
+		log.Fatal("Invalid heights", err)
+	}
+
+	enqueue, err := core.GenerateHeightRangeEnqueueFunction(ctx, *cfg, heights, cfg.Base.TransactionIndexingEnabled, cfg.Base.BlockEventIndexingEnabled)
+	if err != nil {
+		log.Fatal("Invalid heights", err)
+	}
+	if indexer.RangeProfiles.IsSet() {
+		enqueue = core.GenerateRangeProfileEnqueueFunction(enqueue, indexer.RangeProfiles)
+	}
+
+	report, err := newDryRunReport(dryRunOptions.output)
+	if err != nil {
+		log.Fatal("Failed to open the dry run output", err)
+	}
+
+	log.Infof("Dry run of heights %s, transactions: %t, block events: %t, nothing will be written to the database", heights, cfg.Base.TransactionIndexingEnabled, cfg.Base.BlockEventIndexingEnabled)
+
+	// Without a database the blocks that could not be fetched are reported instead of recorded as failed
+	fetchPool := core.NewBlockFetchPool(rpcWorkers(cfg), cfg.Probe.ChainID, cfg, indexer.ChainClient, nil, nil)
+	fetch := fetchPool.Fetch
+	fetchPool.Fetch = func(ctx context.Context, block *core.EnqueueData) (core.IndexerBlockEventData, bool) {
+		data, ok := fetch(ctx, block)
+		if !ok && ctx.Err() == nil {
+			summary := indexerPackage.NewDryRunSummary(block.Height)
+			summary.Errors = append(summary.Errors, "the block could not be fetched from the RPC, see the logs")
+			report.write(summary)
+		}
+		return data, ok
+	}
+
+	blockEnqueueChan := make(chan *core.EnqueueData, 100)
+	blockRPCWorkerDataChan := make(chan core.IndexerBlockEventData, 10)
+	go fetchPool.Run(ctx, blockEnqueueChan, blockRPCWorkerDataChan)
+	go func() {
+		defer close(blockEnqueueChan)
+		if err := enqueue(blockEnqueueChan); err != nil {
+			log.Error("Block enqueue failed", err)
+		}
+	}()
+
+	for blockData := range blockRPCWorkerDataChan {
+		report.write(indexer.DryRunBlock(blockData))
+	}
+
+	if err := report.close(); err != nil {
+		log.Fatal("Failed to write the dry run output", err)
+	}
+
+	failed := report.failedHeights()
+	if ctx.Err() != nil {
+		fmt.Printf("Dry run of heights %s interrupted after %d blocks, %d failed\n", heights, report.blocks, len(failed))
+	} else {
+		fmt.Printf("Dry run of heights %s: %d blocks, %d decoded, %d failed\n", heights, report.blocks, report.blocks-len(failed), len(failed))
+	}
+
+	if len(failed) == 0 {
+		return
+	}
+	listed := failed
+	if len(listed) > dryRunSummaryMaxFailedHeights {
+		listed = listed[:dryRunSummaryMaxFailedHeights]
+	}
+	fmt.Printf("Failed heights: %v", listed)
+	if len(failed) > len(listed) {
+		fmt.Printf(" and %d more", len(failed)-len(listed))
+	}
+	fmt.Println()
+	log.Fatalf("%d blocks could not be fetched or decoded", len(failed))
+}
+
+// dryRunReport writes the block summaries of a dry run as text to stdout, or as a JSON array to a file
+type dryRunReport struct {
+	mu     sync.Mutex
+	out    io.Writer
+	file   *os.File // Set when the summaries are written to a JSON file
+	blocks int
+	failed []int64
+	err    error // First error writing the summaries
+}
+
+// newDryRunReport returns a report printing the summaries, or writing them to the JSON file at path when it is not empty
+func newDryRunReport(path string) (*dryRunReport, error) {
+	if path == "" {
+		return &dryRunReport{out: os.Stdout}, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(file, "["); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &dryRunReport{out: file, file: file}, nil
+}
+
+// write writes the summary of a block. The fetch workers report the blocks they failed to fetch while the others are
+// written, so the writes are serialized.
+func (r *dryRunReport) write(summary indexerPackage.DryRunSummary) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if summary.Failed() {
+		r.failed = append(r.failed, summary.Height)
+	}
+
+	var err error
+	if r.file != nil {
+		err = r.writeJSON(summary)
+	} else {
+		_, err = io.WriteString(r.out, formatDryRunSummary(summary))
+	}
+	if err != nil && r.err == nil {
+		r.err = err
+	}
+	r.blocks++
+}
+
+func (r *dryRunReport) writeJSON(summary indexerPackage.DryRunSummary) error {
+	b, err := json.MarshalIndent(summary, "  ", "  ")
+	if err != nil {
+		return err
+	}
+
+	separator := "\n  "
+	if r.blocks != 0 {
+		separator = ",\n  "
+	}
+	_, err = io.WriteString(r.out, separator+string(b))
+	return err
+}
+
+// close ends the JSON array and closes the file, returning the first error writing the summaries
+func (r *dryRunReport) close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return r.err
+	}
+	_, err := io.WriteString(r.file, "\n]\n")
+	if closeErr := r.file.Close(); err == nil {
+		err = closeErr
+	}
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+// failedHeights returns the heights of the blocks that failed, in increasing order
+func (r *dryRunReport) failedHeights() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	failed := append([]int64(nil), r.failed...)
+	sort.Slice(failed, func(i, j int) bool { return failed[i] < failed[j] })
+	return failed
+}
+
+// formatDryRunSummary formats the summary of a block as text, one line per part of the block that has something to report
+func formatDryRunSummary(summary indexerPackage.DryRunSummary) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Block %d: %d txs\n", summary.Height, summary.Txs)
+	if len(summary.MessageTypes) != 0 {
+		fmt.Fprintf(&b, "  Messages: %s\n", formatCounts(summary.MessageTypes))
+	}
+	if len(summary.MessageEventTypes) != 0 {
+		fmt.Fprintf(&b, "  Message events: %s\n", formatCounts(summary.MessageEventTypes))
+	}
+	if len(summary.BlockEventTypes) != 0 {
+		fmt.Fprintf(&b, "  Block events: %s\n", formatCounts(summary.BlockEventTypes))
+	}
+	if len(summary.FeeDenoms) != 0 {
+		fmt.Fprintf(&b, "  Fee denoms: %s\n", strings.Join(summary.FeeDenoms, ", "))
+	}
+	for _, warning := range summary.Warnings {
+		fmt.Fprintf(&b, "  Warning: %s\n", warning)
+	}
+	for _, err := range summary.Errors {
+		fmt.Fprintf(&b, "  Error: %s\n", err)
+	}
+	return b.String()
+}
+
+// formatCounts formats the counts by name, in name order
+func formatCounts(counts map[string]int) string {
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	formatted := make([]string, len(names))
+	for i, name := range names {
+		formatted[i] = fmt.Sprintf("%s %d", name, counts[name])
+	}
+	return strings.Join(formatted, ", ")
+}
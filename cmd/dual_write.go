@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	convergenceSampleSize int
+	forceCutover          bool
+)
+
+func init() {
+	dualWriteReportCmd.Flags().IntVar(&convergenceSampleSize, "sample-size", 100, "number of evenly spaced heights to compare row counts for")
+	indexCmd.AddCommand(dualWriteReportCmd)
+
+	dualWriteCutoverCmd.Flags().IntVar(&convergenceSampleSize, "sample-size", 100, "number of evenly spaced heights to compare row counts for")
+	dualWriteCutoverCmd.Flags().BoolVar(&forceCutover, "force", false, "cut over even if the secondary has not converged with the primary")
+	indexCmd.AddCommand(dualWriteCutoverCmd)
+}
+
+var dualWriteReportCmd = &cobra.Command{
+	Use:   "dual-write-report",
+	Short: "Reports whether the dual write secondary database has converged with the primary.",
+	Long: `Compares the indexing watermarks and sampled per-height row counts between the primary database and the
+	secondary database configured for dual write mode. Use this to decide when the secondary has caught up and is
+	safe to cut over to.`,
+	Run: dualWriteReport,
+}
+
+var dualWriteCutoverCmd = &cobra.Command{
+	Use:   "dual-write-cutover",
+	Short: "Promotes the dual write secondary database to primary.",
+	Long: `Hands the chain over from the primary database to the secondary database configured for dual write mode.
+	Stop every indexer of the chain first, the cutover takes the chain lock on both databases. The secondary must have
+	converged with the primary, see dual-write-report, unless --force is set.
+
+	The cutover is recorded on the old primary. From then on the index command no longer writes the chain to it: while
+	the secondary is still configured it is promoted to primary on startup, otherwise indexing stops with an error.
+	Swap the database and secondary-database sections of the config, or remove the secondary, to finish the migration.`,
+	Run: dualWriteCutover,
+}
+
+// connectDualWriteDBs connects to the primary and secondary databases of dual write mode, exiting when either is unavailable
+func connectDualWriteDBs(cmd *cobra.Command) (*gorm.DB, *gorm.DB) {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	if !indexer.Config.SecondaryDatabaseEnabled() {
+		config.Log.Fatalf("secondary-database.host must be set to run %s", cmd.Name())
+	}
+
+	primary, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the primary database", err)
+	}
+
+	secondary, err := ConnectToSecondaryDBAndMigrate(indexer.Config.SecondaryDatabase, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the secondary database", err)
+	}
+
+	return primary, secondary
+}
+
+func dualWriteReport(cmd *cobra.Command, args []string) {
+	primary, secondary := connectDualWriteDBs(cmd)
+
+	report, err := dbTypes.GetConvergenceReport(cmd.Context(), primary, secondary, indexer.Config.Probe.ChainID, convergenceSampleSize)
+	if err != nil {
+		config.Log.Fatal("Failed to generate dual write report", err)
+	}
+
+	printConvergenceReport(report)
+}
+
+func dualWriteCutover(cmd *cobra.Command, args []string) {
+	primary, secondary := connectDualWriteDBs(cmd)
+
+	report, err := dbTypes.CutOver(cmd.Context(), primary, secondary, indexer.Config.Probe.ChainID, describeDatabase(indexer.Config.SecondaryDatabase), convergenceSampleSize, forceCutover)
+	printConvergenceReport(report)
+	if err != nil {
+		config.Log.Fatal("Failed to cut over to the secondary database", err)
+	}
+
+	config.Log.Infof("Chain %s was cut over to the secondary database. Swap the database and secondary-database sections of the config to finish the migration.", indexer.Config.Probe.ChainID)
+}
+
+func printConvergenceReport(report dbTypes.ConvergenceReport) {
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		config.Log.Fatal("Failed to marshal dual write report", err)
+	}
+
+	fmt.Println(string(out))
+}
+
+// describeDatabase identifies the database in the cutover record without its credentials
+func describeDatabase(conf config.Database) string {
+	if conf.Host == "" {
+		return "the secondary database"
+	}
+	return fmt.Sprintf("%s:%s/%s", conf.Host, conf.Port, conf.Database)
+}
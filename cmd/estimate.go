@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/probe"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	estimateSamples         int
+	estimateOutput          string
+	estimateCalibrationFile string
+	estimateMinRows         int64
+)
+
+func init() {
+	estimateCmd.Flags().IntVar(&estimateSamples, "samples", 100, "number of heights sampled evenly across the range")
+	estimateCmd.Flags().StringVar(&estimateOutput, "output", "text", "output format: text or json")
+	estimateCmd.Flags().StringVar(&estimateCalibrationFile, "calibration-file", "", "JSON file of per table row and index bytes, as printed by estimate calibrate. Tables missing from it use the built in defaults")
+	estimateCalibrateCmd.Flags().Int64Var(&estimateMinRows, "min-rows", 10000, "leave out tables with fewer rows than this")
+	estimateCmd.AddCommand(estimateCalibrateCmd)
+	indexCmd.AddCommand(estimateCmd)
+}
+
+var estimateCmd = &cobra.Command{
+	Use:   "estimate",
+	Short: "Estimates the disk usage of indexing the configured height range.",
+	Long: `Estimates how much disk indexing base.start-block to base.end-block will use with the current config. Heights
+	are sampled evenly across the range, fetched and parsed like the indexer would with the configured filters and parsers,
+	and the rows each table would get are extrapolated to the whole range with 95% confidence bounds. An end block of -1
+	estimates up to the latest height of the chain. Nothing is written to the database.`,
+	Run: estimate,
+}
+
+var estimateCalibrateCmd = &cobra.Command{
+	Use:   "calibrate",
+	Short: "Prints the per row storage costs of a populated database, for use with estimate --calibration-file.",
+	Run:   estimateCalibrate,
+}
+
+func estimate(cmd *cobra.Command, args []string) {
+	BindFlags(cmd, viperConf)
+
+	if err := indexer.Config.Validate(); err != nil {
+		config.Log.Fatal("Invalid config", err)
+	}
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	if estimateOutput != "text" && estimateOutput != "json" {
+		config.Log.Fatalf("Unknown output format %s, must be text or json", estimateOutput)
+	}
+
+	calibration := make(map[string]dbTypes.TableCalibration)
+	if estimateCalibrationFile != "" {
+		b, err := os.ReadFile(estimateCalibrationFile)
+		if err != nil {
+			config.Log.Fatal("Failed to read calibration file", err)
+		}
+		if err := json.Unmarshal(b, &calibration); err != nil {
+			config.Log.Fatal("Failed to parse calibration file", err)
+		}
+	}
+
+	loadFilterFile()
+	config.SetChainConfig(indexer.Config.Probe.AccountPrefix)
+	indexer.ChainClient = probe.GetProbeClient(indexer.Config.Probe, indexer.CustomModuleBasics)
+
+	if indexer.Config.Base.StartBlock < 1 {
+		config.Log.Fatal("base.start-block must be a height to estimate from")
+	}
+
+	endHeight := indexer.Config.Base.EndBlock
+	if endHeight == -1 {
+		latestHeight, err := rpc.GetLatestBlockHeightWithRetry(indexer.ChainClient, indexer.Config.Base.RequestRetryAttempts, indexer.Config.Base.RequestRetryMaxWait)
+		if err != nil {
+			config.Log.Fatal("Failed to get the latest height of the chain", err)
+		}
+		endHeight = latestHeight
+	}
+
+	heights, err := dbTypes.NewHeightRange(indexer.Config.Base.StartBlock, endHeight)
+	if err != nil {
+		config.Log.Fatal("Invalid height range", err)
+	}
+
+	samples, failed, err := indexer.SampleBlocks(dbTypes.SampleHeights(heights, estimateSamples))
+	if err != nil {
+		config.Log.Fatal("Failed to sample blocks", err)
+	}
+
+	if len(failed) != 0 {
+		config.Log.Warnf("%d sampled heights failed and were left out of the estimate: %v", len(failed), failed)
+	}
+
+	usage, err := dbTypes.EstimateDiskUsage(samples, heights, calibration)
+	if err != nil {
+		config.Log.Fatal("Failed to estimate disk usage", err)
+	}
+
+	if estimateOutput == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(usage); err != nil {
+			config.Log.Fatal("Failed to write estimate", err)
+		}
+		return
+	}
+
+	fmt.Printf("Estimated disk usage for %s heights %s, %d heights from %d samples, 95%% bounds\n\n", indexer.Config.Probe.ChainID, heights, usage.TotalHeights, usage.Samples)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tROWS/BLOCK\tROWS\tDATA\tINDEXES\tTOTAL\tLOW\tHIGH")
+	for _, table := range usage.Tables {
+		fmt.Fprintf(w, "%s\t%.2f\t%.0f\t%s\t%s\t%s\t%s\t%s\n", table.Table, table.RowsPerBlock, table.Rows.Estimate, formatBytes(table.DataBytes.Estimate),
+			formatBytes(table.IndexBytes.Estimate), formatBytes(table.TotalBytes.Estimate), formatBytes(table.TotalBytes.Low), formatBytes(table.TotalBytes.High))
+	}
+	fmt.Fprintf(w, "Total\t\t\t\t\t%s\t%s\t%s\n", formatBytes(usage.TotalBytes.Estimate), formatBytes(usage.TotalBytes.Low), formatBytes(usage.TotalBytes.High))
+	w.Flush()
+}
+
+func estimateCalibrate(cmd *cobra.Command, args []string) {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	db, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the database", err)
+	}
+
+	calibration, err := dbTypes.GetDiskCalibration(cmd.Context(), db, estimateMinRows)
+	if err != nil {
+		config.Log.Fatal("Failed to calibrate", err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(calibration); err != nil {
+		config.Log.Fatal("Failed to write calibration", err)
+	}
+}
+
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
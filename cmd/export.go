@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var exportOptions struct {
+	chainID     string
+	datasets    []string
+	outputDir   string
+	startHeight int64
+	endHeight   int64
+	from        string
+	to          string
+	address     string
+	messageType string
+}
+
+func init() {
+	exportCmd.Flags().StringVar(&exportOptions.chainID, "chain", "", "chain ID of the chain to export, defaults to probe.chain-id. Required with chains.")
+	exportCmd.Flags().StringSliceVar(&exportOptions.datasets, "datasets", dbTypes.ExportDatasets, "datasets to export, any of txs, messages and fees")
+	exportCmd.Flags().StringVar(&exportOptions.outputDir, "output-dir", ".", "directory the CSV files are written to, as <chain ID>_<dataset>.csv")
+	exportCmd.Flags().Int64Var(&exportOptions.startHeight, "start-height", 1, "lowest height to export")
+	exportCmd.Flags().Int64Var(&exportOptions.endHeight, "end-height", -1, "highest height to export, -1 for no upper bound")
+	exportCmd.Flags().StringVar(&exportOptions.from, "from", "", "export the blocks from this time on, as an RFC 3339 time or a YYYY-MM-DD date in UTC")
+	exportCmd.Flags().StringVar(&exportOptions.to, "to", "", "export the blocks before this time, as an RFC 3339 time or a YYYY-MM-DD date in UTC")
+	exportCmd.Flags().StringVar(&exportOptions.address, "address", "", "export the txs signed by the address or with a fee paid by it")
+	exportCmd.Flags().StringVar(&exportOptions.messageType, "message-type", "", "export the messages of the type, or the txs and fees of txs with a message of the type. A type containing % is a LIKE pattern with % as the only wildcard")
+	indexCmd.AddCommand(exportCmd)
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Exports the txs, messages and fees of a chain to CSV files.",
+	Long: `Exports the indexed txs, messages and fees of the chain to one CSV file per dataset in --output-dir, named
+	<chain ID>_<dataset>.csv and overwritten when they exist. The rows can be narrowed to a height range, a time range, the
+	txs of an address and a message type. Rows are streamed from the database in height order. Reports the number of rows
+	written to each file.`,
+	Run: export,
+}
+
+func export(cmd *cobra.Command, args []string) {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	for _, dataset := range exportOptions.datasets {
+		if !slices.Contains(dbTypes.ExportDatasets, dataset) {
+			config.Log.Fatalf("Unknown dataset %s, must be one of %s", dataset, strings.Join(dbTypes.ExportDatasets, ", "))
+		}
+	}
+
+	heights, err := dbTypes.NewHeightRange(exportOptions.startHeight, exportOptions.endHeight)
+	if err != nil {
+		config.Log.Fatal("Invalid height range", err)
+	}
+	from, err := parseExportTime(exportOptions.from)
+	if err != nil {
+		config.Log.Fatal("Invalid --from", err)
+	}
+	to, err := parseExportTime(exportOptions.to)
+	if err != nil {
+		config.Log.Fatal("Invalid --to", err)
+	}
+
+	db, chain := connectExportChain(cmd.Context(), exportOptions.chainID)
+
+	for _, dataset := range exportOptions.datasets {
+		opts := dbTypes.ExportOptions{
+			Dataset:     dataset,
+			Heights:     heights,
+			From:        from,
+			To:          to,
+			Address:     exportOptions.address,
+			MessageType: exportOptions.messageType,
+		}
+		path := filepath.Join(exportOptions.outputDir, fmt.Sprintf("%s_%s.csv", chain.ChainID, dataset))
+
+		written, err := exportCSVFile(cmd.Context(), db, chain, opts, path)
+		if err != nil {
+			config.Log.Fatalf("Failed to export %s to %s: %v", dataset, path, err)
+		}
+		fmt.Printf("Wrote %d %s rows to %s\n", written, dataset, path)
+	}
+}
+
+// connectExportChain connects to the database, reading from the read replica when one is configured, and returns the
+// indexed chain with the chain ID. The chain ID defaults to probe.chain-id when only one chain is configured.
+func connectExportChain(ctx context.Context, chainID string) (*gorm.DB, dbTypes.ChainRef) {
+	if chainID == "" {
+		if indexer.Config.MultiChain() {
+			config.Log.Fatal("--chain is required when several chains are configured")
+		}
+		chainID = indexer.Config.Probe.ChainID
+	}
+
+	db, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the database", err)
+	}
+	useReadReplica(db)
+
+	chain, err := dbTypes.GetChainRef(ctx, db, chainID)
+	if err != nil {
+		config.Log.Fatal("Failed to get chain from DB", err)
+	}
+	if err := chain.Validate(); err != nil {
+		config.Log.Fatal("Chain has not been indexed", err)
+	}
+	return db, chain
+}
+
+// exportCSVFile exports the rows to the CSV file at path. The file is removed when the export fails, so no partial
+// export is left behind.
+func exportCSVFile(ctx context.Context, db *gorm.DB, chain dbTypes.ChainRef, opts dbTypes.ExportOptions, path string) (int64, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := dbTypes.ExportCSV(ctx, db, chain, opts, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return written, err
+	}
+	return written, nil
+}
+
+// parseExportTime parses an RFC 3339 time or a YYYY-MM-DD date in UTC, the zero time for an empty value
+func parseExportTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/spf13/cobra"
+)
+
+var exportParquetOptions struct {
+	chainID         string
+	outputDir       string
+	startHeight     int64
+	endHeight       int64
+	partitionBlocks int64
+	pageSize        int
+}
+
+func init() {
+	exportParquetCmd.Flags().StringVar(&exportParquetOptions.chainID, "chain", "", "chain ID of the chain to export, defaults to probe.chain-id. Required with chains.")
+	exportParquetCmd.Flags().StringVar(&exportParquetOptions.outputDir, "output-dir", "", "directory the Parquet files and their manifest are written to")
+	exportParquetCmd.Flags().Int64Var(&exportParquetOptions.startHeight, "start-height", 1, "lowest height to export")
+	exportParquetCmd.Flags().Int64Var(&exportParquetOptions.endHeight, "end-height", -1, "highest height to export, -1 to export up to the highest indexed height")
+	exportParquetCmd.Flags().Int64Var(&exportParquetOptions.partitionBlocks, "partition-blocks", dbTypes.DefaultParquetPartitionBlocks, "number of blocks in each Parquet file")
+	exportParquetCmd.Flags().IntVar(&exportParquetOptions.pageSize, "page-size", dbTypes.DefaultParquetPageSize, "number of rows read from the database at a time")
+	_ = exportParquetCmd.MarkFlagRequired("output-dir")
+	indexCmd.AddCommand(exportParquetCmd)
+}
+
+var exportParquetCmd = &cobra.Command{
+	Use:   "export-parquet",
+	Short: "Exports the message event attributes of a chain to Parquet files.",
+	Long: `Exports the message event attributes of the chain, joined with their events, messages, txs and blocks, to Parquet
+	files of --partition-blocks blocks each in --output-dir. A manifest.json in the directory lists the completed files.
+	Running the export again with the same directory resumes after the last completed file, so an interrupted export is
+	continued and an export without --end-height adds the blocks indexed since.`,
+	Run: exportParquet,
+}
+
+func exportParquet(cmd *cobra.Command, args []string) {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	heights, err := dbTypes.NewHeightRange(exportParquetOptions.startHeight, exportParquetOptions.endHeight)
+	if err != nil {
+		config.Log.Fatal("Invalid height range", err)
+	}
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	db, chain := connectExportChain(ctx, exportParquetOptions.chainID)
+
+	opts := dbTypes.ParquetExportOptions{
+		Dir:             exportParquetOptions.outputDir,
+		Heights:         heights,
+		PartitionBlocks: exportParquetOptions.partitionBlocks,
+		PageSize:        exportParquetOptions.pageSize,
+	}
+	manifest, err := dbTypes.ExportParquet(ctx, db, chain, opts, func(partition dbTypes.ParquetPartition) {
+		fmt.Printf("Wrote %d rows of heights %d to %d to %s\n", partition.Rows, partition.StartHeight, partition.EndHeight, partition.File)
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			config.Log.Fatalf("Export interrupted with %d files completed, run it again to resume", len(manifest.Partitions))
+		}
+		config.Log.Fatal("Parquet export failed, run it again to resume from the last completed file", err)
+	}
+
+	if len(manifest.Partitions) == 0 {
+		fmt.Printf("No heights to export to %s\n", opts.Dir)
+		return
+	}
+	fmt.Printf("Export in %s is complete up to height %d, %d files\n", opts.Dir, manifest.Partitions[len(manifest.Partitions)-1].EndHeight, len(manifest.Partitions))
+}
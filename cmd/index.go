@@ -1,10 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/DefiantLabs/cosmos-indexer/config"
@@ -13,20 +22,32 @@ import (
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
 	"github.com/DefiantLabs/cosmos-indexer/filter"
 	indexerPackage "github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/kafka"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
 	"github.com/DefiantLabs/cosmos-indexer/probe"
 	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	"github.com/DefiantLabs/cosmos-indexer/tracing"
+	"github.com/DefiantLabs/cosmos-indexer/webhook"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
-var indexer indexerPackage.Indexer
+var (
+	indexer       indexerPackage.Indexer
+	migrateDryRun bool
+)
 
 func init() {
 	indexer.Config = &config.IndexConfig{}
 	config.SetupLogFlags(&indexer.Config.Log, indexCmd)
 	config.SetupDatabaseFlags(&indexer.Config.Database, indexCmd)
+	config.SetupSecondaryDatabaseFlags(&indexer.Config.SecondaryDatabase, indexCmd)
+	config.SetupReadReplicaFlags(&indexer.Config.ReadReplica, indexCmd)
 	config.SetupProbeFlags(&indexer.Config.Probe, indexCmd)
 	config.SetupThrottlingFlag(&indexer.Config.Base.Throttling, indexCmd)
 	config.SetupIndexSpecificFlags(indexer.Config, indexCmd)
+	indexCmd.Flags().BoolVar(&migrateDryRun, "migrate-dry-run", false, "print the schema changes the migrations would make to the database and exit without applying them")
 
 	rootCmd.AddCommand(indexCmd)
 }
@@ -50,7 +71,22 @@ func GetBuiltinIndexer() *indexerPackage.Indexer {
 func setupIndex(cmd *cobra.Command, args []string) error {
 	BindFlags(cmd, viperConf)
 
-	err := indexer.Config.Validate()
+	// Lists of tables are not bound to flags
+	err := viperConf.UnmarshalKey("chains", &indexer.Config.Chains, viper.DecodeHook(config.DecodeHook()))
+	if err != nil {
+		return err
+	}
+	err = viperConf.UnmarshalKey("webhooks", &indexer.Config.Webhooks)
+	if err != nil {
+		return err
+	}
+
+	// Dry runs do not connect to the database, its config may be left out
+	if dryRunOptions.enabled {
+		err = indexer.Config.ValidateWithoutDatabase()
+	} else {
+		err = indexer.Config.Validate()
+	}
 	if err != nil {
 		return err
 	}
@@ -68,54 +104,52 @@ func setupIndex(cmd *cobra.Command, args []string) error {
 		indexer.Config.Base.StartBlock = 1
 	}
 
+	if migrateDryRun {
+		if err := printMigrationPlan(); err != nil {
+			config.Log.Fatal("Error planning DB migrations", err)
+		}
+		os.Exit(0)
+	}
+
+	if dryRunOptions.enabled {
+		loadFilterFile()
+		return nil
+	}
+
 	// If DB has not been preset, connect to the database and migrate using the default configuration settings
 	if indexer.DB == nil {
-		db, err := ConnectToDBAndMigrate(indexer.Config.Database)
+		db, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
 		if err != nil {
 			config.Log.Fatal("Could not establish connection to the database", err)
 		}
 
 		indexer.DB = db
 	} else {
-		err = dbTypes.MigrateModels(indexer.DB)
+		err = migrateDB(indexer.DB, indexer.Config.Database)
 		if err != nil {
 			config.Log.Fatal("Error running DB migrations", err)
 		}
 	}
 
-	indexer.DryRun = indexer.Config.Base.Dry
-
-	indexer.BlockEventFilterRegistries = indexerPackage.BlockEventFilterRegistries{
-		BeginBlockEventFilterRegistry: &filter.StaticBlockEventFilterRegistry{},
-		EndBlockEventFilterRegistry:   &filter.StaticBlockEventFilterRegistry{},
-	}
-
-	if indexer.Config.Base.FilterFile != "" {
-		f, err := os.Open(indexer.Config.Base.FilterFile)
+	// Dual write mode, the secondary is best effort and must never prevent indexing on the primary
+	if indexer.SecondaryDB == nil && indexer.Config.SecondaryDatabaseEnabled() {
+		secondaryDB, err := ConnectToSecondaryDBAndMigrate(indexer.Config.SecondaryDatabase, indexer.DBConnectOptions)
 		if err != nil {
-			config.Log.Fatalf("Failed to open block event filter file %s: %s", indexer.Config.Base.FilterFile, err)
-		}
-
-		b, err := io.ReadAll(f)
-		if err != nil {
-			config.Log.Fatal("Failed to parse block event filter config", err)
+			config.Log.Error("Could not establish connection to the secondary database, dual write mode will be disabled", err)
+		} else {
+			indexer.SecondaryDB = secondaryDB
 		}
+	}
 
-		var fileMessageTypeFilters []filter.MessageTypeFilter
+	if !promoteCutOverSecondary(cmd.Context()) {
+		useReadReplica(indexer.DB)
+	} else if indexer.Config.ReadReplicaEnabled() {
+		config.Log.Warn("The read replica replicates the old primary database, reads will use the promoted database")
+	}
 
-		indexer.BlockEventFilterRegistries.BeginBlockEventFilterRegistry.BlockEventFilters,
-			indexer.BlockEventFilterRegistries.BeginBlockEventFilterRegistry.RollingWindowEventFilters,
-			indexer.BlockEventFilterRegistries.EndBlockEventFilterRegistry.BlockEventFilters,
-			indexer.BlockEventFilterRegistries.EndBlockEventFilterRegistry.RollingWindowEventFilters,
-			fileMessageTypeFilters,
-			err = config.ParseJSONFilterConfig(b)
+	indexer.DryRun = indexer.Config.Base.Dry
 
-		if err != nil {
-			config.Log.Fatal("Failed to parse block event filter config", err)
-		}
-
-		indexer.MessageTypeFilters = append(indexer.MessageTypeFilters, fileMessageTypeFilters...)
-	}
+	loadFilterFile()
 
 	if len(indexer.CustomModels) != 0 {
 		err = dbTypes.MigrateInterfaces(indexer.DB, indexer.CustomModels)
@@ -125,21 +159,21 @@ func setupIndex(cmd *cobra.Command, args []string) error {
 	}
 
 	if len(indexer.CustomBeginBlockParserTrackers) != 0 {
-		err = dbTypes.FindOrCreateCustomBlockEventParsers(indexer.DB, indexer.CustomBeginBlockParserTrackers)
+		err = dbTypes.FindOrCreateCustomBlockEventParsers(cmd.Context(), indexer.DB, indexer.CustomBeginBlockParserTrackers)
 		if err != nil {
 			config.Log.Fatal("Failed to migrate custom block event parsers", err)
 		}
 	}
 
 	if len(indexer.CustomEndBlockParserTrackers) != 0 {
-		err = dbTypes.FindOrCreateCustomBlockEventParsers(indexer.DB, indexer.CustomEndBlockParserTrackers)
+		err = dbTypes.FindOrCreateCustomBlockEventParsers(cmd.Context(), indexer.DB, indexer.CustomEndBlockParserTrackers)
 		if err != nil {
 			config.Log.Fatal("Failed to migrate custom block event parsers", err)
 		}
 	}
 
 	if len(indexer.CustomMessageParserTrackers) != 0 {
-		err = dbTypes.FindOrCreateCustomMessageParsers(indexer.DB, indexer.CustomMessageParserTrackers)
+		err = dbTypes.FindOrCreateCustomMessageParsers(cmd.Context(), indexer.DB, indexer.CustomMessageParserTrackers)
 		if err != nil {
 			config.Log.Fatal("Failed to migrate custom message parsers", err)
 		}
@@ -149,45 +183,499 @@ func setupIndex(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
-// SetupIndexer sets up the "indexer" package Indexer instance with the configuration, database, and chain client
-func setupIndexer() *indexerPackage.Indexer {
+// loadFilterFile sets up the block event filter registries and adds the message type filters from base.filter-file, then
+// loads the range profiles from base.range-profiles-file with their own filter files
+func loadFilterFile() {
+	// Filters added in code apply to every range profile
+	codeMessageTypeFilters := slices.Clip(indexer.MessageTypeFilters)
+
+	var fileMessageTypeFilters []filter.MessageTypeFilter
+	indexer.BlockEventFilterRegistries, fileMessageTypeFilters = parseFilterFile(indexer.Config.Base.FilterFile)
+	indexer.MessageTypeFilters = append(indexer.MessageTypeFilters, fileMessageTypeFilters...)
+
 	var err error
+	indexer.RangeProfiles, err = config.LoadRangeProfiles(indexer.Config)
+	if err != nil {
+		config.Log.Fatal("Invalid range profiles", err)
+	}
 
-	config.SetChainConfig(indexer.Config.Probe.AccountPrefix)
+	indexer.RangeProfileFilters = make(map[string]indexerPackage.RangeProfileFilters)
+	for _, profile := range indexer.RangeProfiles.All() {
+		if profile.FilterFile == "" {
+			continue
+		}
 
-	indexer.ChainClient = probe.GetProbeClient(indexer.Config.Probe, indexer.CustomModuleBasics)
+		registries, profileMessageTypeFilters := parseFilterFile(profile.FilterFile)
+		indexer.RangeProfileFilters[profile.Name] = indexerPackage.RangeProfileFilters{
+			MessageTypeFilters:         append(codeMessageTypeFilters, profileMessageTypeFilters...),
+			BlockEventFilterRegistries: registries,
+		}
+	}
+}
+
+// parseFilterFile sets up block event filter registries with the filters in the file, an empty path gives empty registries
+func parseFilterFile(path string) (indexerPackage.BlockEventFilterRegistries, []filter.MessageTypeFilter) {
+	registries := indexerPackage.BlockEventFilterRegistries{
+		BeginBlockEventFilterRegistry: &filter.StaticBlockEventFilterRegistry{},
+		EndBlockEventFilterRegistry:   &filter.StaticBlockEventFilterRegistry{},
+	}
+
+	if path == "" {
+		return registries, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		config.Log.Fatalf("Failed to open block event filter file %s: %s", path, err)
+	}
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		config.Log.Fatal("Failed to parse block event filter config", err)
+	}
+
+	var messageTypeFilters []filter.MessageTypeFilter
+
+	registries.BeginBlockEventFilterRegistry.BlockEventFilters,
+		registries.BeginBlockEventFilterRegistry.RollingWindowEventFilters,
+		registries.EndBlockEventFilterRegistry.BlockEventFilters,
+		registries.EndBlockEventFilterRegistry.RollingWindowEventFilters,
+		messageTypeFilters,
+		err = config.ParseJSONFilterConfig(b)
+
+	if err != nil {
+		config.Log.Fatal("Failed to parse block event filter config", err)
+	}
+
+	return registries, messageTypeFilters
+}
+
+// printMigrationPlan prints the statements the migrations would execute on the database as a SQL script
+func printMigrationPlan() error {
+	database := indexer.DB
+	if database == nil {
+		var err error
+		database, err = dbTypes.PostgresDbConnectWithRetry(context.Background(), indexer.Config.Database, indexer.DBConnectOptions)
+		if err != nil {
+			return err
+		}
+	}
+
+	planFunc := dbTypes.MigrationPlan
+	if indexer.Config.Database.LegacyAutoMigrate {
+		planFunc = dbTypes.AutoMigrationPlan
+	}
+
+	plan, err := planFunc(context.Background(), database)
+	if err != nil {
+		return err
+	}
+
+	if len(plan) == 0 {
+		fmt.Println("-- No pending schema changes")
+		return nil
+	}
+
+	for _, change := range plan {
+		fmt.Printf("-- migration %d: %s %s %s\n%s;\n\n", change.Migration, change.Kind, change.Table, change.Name, change.SQL)
+	}
+
+	return nil
+}
+
+// setupChainClient connects the indexer to the RPC of its chain and, depending on the app configuration, waits for the
+// node to catch up with the chain
+func setupChainClient(ctx context.Context, idxr *indexerPackage.Indexer, indexMetrics *metrics.Metrics) error {
+	var err error
+
+	idxr.ChainClient, err = probe.NewProbeClient(idxr.Config.Probe, idxr.CustomModuleBasics)
+	if err != nil {
+		return fmt.Errorf("error connecting to chain: %w", err)
+	}
+
+	if failover, ok := idxr.ChainClient.RPCClient.(*rpc.FailoverClient); ok {
+		if len(idxr.Config.Probe.RPCFallbacks) != 0 {
+			idxr.Config.ChainLog().Infof("RPC failover enabled with %d fallback endpoints", len(idxr.Config.Probe.RPCFallbacks))
+		}
+		if rate := idxr.Config.Probe.RPCRequestsPerSecond; rate > 0 {
+			idxr.Config.ChainLog().Infof("RPC requests limited to %g per second per endpoint", rate)
+		}
+		if indexMetrics != nil {
+			failover.UseMetrics(indexMetrics)
+		}
+		// Checked once before indexing, so the endpoints that are down or pruned are known from the start
+		failover.CheckHealth(ctx)
+		go failover.Run(ctx, time.Duration(idxr.Config.Probe.RPCHealthInterval)*time.Second)
+	}
+
+	waitForChainDelay := func() error {
+		select {
+		case <-time.After(time.Second * time.Duration(idxr.Config.Base.WaitForChainDelay)):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 
 	// Depending on the app configuration, wait for the chain to catch up
-	chainCatchingUp, err := rpc.IsCatchingUp(indexer.ChainClient)
-	for indexer.Config.Base.WaitForChain && chainCatchingUp && err == nil {
+	chainCatchingUp, err := rpc.IsCatchingUp(idxr.ChainClient)
+	for idxr.Config.Base.WaitForChain && chainCatchingUp && err == nil {
 		// Wait between status checks, don't spam the node with requests
-		config.Log.Debug("Chain is still catching up, please wait or disable check in config.")
-		time.Sleep(time.Second * time.Duration(indexer.Config.Base.WaitForChainDelay))
-		chainCatchingUp, err = rpc.IsCatchingUp(indexer.ChainClient)
+		idxr.Config.ChainLog().Debug("Chain is still catching up, please wait or disable check in config.")
+		if err := waitForChainDelay(); err != nil {
+			return err
+		}
+		chainCatchingUp, err = rpc.IsCatchingUp(idxr.ChainClient)
 
 		// This EOF error pops up from time to time and is unpredictable
 		// It is most likely an error on the node, we would need to see any error logs on the node side
 		// Try one more time
 		if err != nil && strings.HasSuffix(err.Error(), "EOF") {
-			time.Sleep(time.Second * time.Duration(indexer.Config.Base.WaitForChainDelay))
-			chainCatchingUp, err = rpc.IsCatchingUp(indexer.ChainClient)
+			if err := waitForChainDelay(); err != nil {
+				return err
+			}
+			chainCatchingUp, err = rpc.IsCatchingUp(idxr.ChainClient)
 		}
 	}
 	if err != nil {
-		config.Log.Fatal("Error querying chain status.", err)
+		return fmt.Errorf("error querying chain status: %w", err)
 	}
 
-	return &indexer
+	return nil
 }
 
 func index(cmd *cobra.Command, args []string) {
-	// Setup the indexer with config, db, and cl
-	idxr := setupIndexer()
-	dbConn, err := idxr.DB.DB()
+	if dryRunOptions.enabled {
+		dryRun(cmd)
+		return
+	}
+
+	dbConn, err := indexer.DB.DB()
 	if err != nil {
 		config.Log.Fatal("Failed to connect to DB", err)
 	}
-	defer dbConn.Close()
+	// Closed once the DB writes stopped, so the pools do not close connections in the middle of a transaction
+	defer closeDBPools(dbConn)
+
+	// Cancelled on SIGTERM or interrupt. The fetching stops and the blocks already fetched are written for up to
+	// base.shutdown-timeout, then the writes in flight are rolled back and indexing resumes from them on the next run.
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if endpoint := indexer.Config.Tracing.OTLPEndpoint; endpoint != "" {
+		tracerProvider, shutdown, err := tracing.Setup(ctx, endpoint, indexer.Config.Tracing.Insecure)
+		if err != nil {
+			config.Log.Fatal("Failed to set up tracing", err)
+		}
+		// Flushes the spans of the last blocks, ctx is already cancelled on shutdown
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(shutdownCtx); err != nil {
+				config.Log.Error("Error flushing traces", err)
+			}
+		}()
+		err = dbTypes.UseTracing(indexer.DB, tracerProvider)
+		if err != nil {
+			config.Log.Fatal("Failed to register tracing on DB", err)
+		}
+		config.Log.Infof("Exporting traces to %s", endpoint)
+	}
+
+	var indexMetrics *metrics.Metrics
+	if port := indexer.Config.Metrics.Port; port != "" {
+		indexMetrics = metrics.New()
+		err = dbTypes.UseMetrics(indexer.DB, indexMetrics)
+		if err != nil {
+			config.Log.Fatal("Failed to register metrics on DB", err)
+		}
+		config.Log.Infof("Serving metrics on port %s at /metrics", port)
+		go func() {
+			if err := metrics.Serve(ctx, port, indexMetrics); err != nil {
+				config.Log.Error("Error serving metrics", err)
+			}
+		}()
+	}
+
+	// Nothing is committed with base.dry, the blocks would be published without being indexed
+	if indexer.Config.KafkaEnabled() && indexer.DryRun {
+		config.Log.Warn("Blocks are not published to Kafka with base.dry")
+	} else if indexer.Config.KafkaEnabled() {
+		stopPublishing := startKafkaPublisher(indexMetrics)
+		defer stopPublishing()
+	}
+
+	if len(indexer.Config.Webhooks) != 0 && indexer.DryRun {
+		config.Log.Warn("Webhooks are not notified with base.dry")
+	} else if len(indexer.Config.Webhooks) != 0 {
+		stopNotifying := startWebhookNotifier(ctx, indexMetrics)
+		defer stopNotifying()
+	}
+
+	// Watched addresses are not chain specific, the chains share the watchlist
+	if indexer.Config.Watchlist.Enabled {
+		err = indexer.LoadWatchlist(ctx)
+		if err != nil {
+			config.Log.Fatal("Failed to load watchlist from DB", err)
+		}
+		config.Log.Infof("Watchlist enabled, %d addresses are watched", indexer.Watchlist.Len())
+		go indexer.ReloadWatchlistPeriodically(ctx, time.Duration(indexer.Config.Watchlist.ReloadInterval)*time.Second)
+	}
+
+	if indexer.Config.MultiChain() {
+		indexChains(ctx, indexMetrics)
+		return
+	}
+
+	config.SetChainConfig(indexer.Config.Probe.AccountPrefix)
+
+	if err := runChain(ctx, &indexer, indexMetrics); err != nil {
+		config.Log.Fatal("Indexing failed", err)
+	}
+}
+
+// promoteCutOverSecondary stops writes to a primary database the chain was cut over from by dual-write-cutover, the
+// secondary database becomes the primary and dual write is disabled. Exits when no secondary is connected to take over.
+// Returns true when the secondary was promoted.
+func promoteCutOverSecondary(ctx context.Context) bool {
+	err := dbTypes.CheckChainCutover(ctx, indexer.DB, indexer.Config.Probe.ChainID)
+	if err == nil {
+		return false
+	}
+
+	var cutOverErr *dbTypes.ChainCutOverError
+	if !errors.As(err, &cutOverErr) {
+		config.Log.Fatal("Failed to check the chain for a dual write cutover", err)
+	}
+	if indexer.SecondaryDB == nil {
+		config.Log.Fatal("Refusing to index on the database, point database at the new primary", err)
+	}
+	if err := dbTypes.CheckChainCutover(ctx, indexer.SecondaryDB, indexer.Config.Probe.ChainID); err != nil {
+		config.Log.Fatal("Refusing to promote the secondary database", err)
+	}
+
+	config.Log.Warnf("%v. Promoting the secondary database to primary, dual write is disabled. Swap the database and secondary-database sections of the config to finish the migration.", err)
+	if sqlDB, err := indexer.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+	indexer.DB = indexer.SecondaryDB
+	indexer.SecondaryDB = nil
+	return true
+}
+
+// closeDBPools closes the connection pools of the database, the secondary database and the read replica
+func closeDBPools(dbConn *sql.DB) {
+	if err := dbConn.Close(); err != nil {
+		config.Log.Error("Error closing the DB connections", err)
+	}
+
+	for _, pool := range []*gorm.DB{indexer.SecondaryDB, indexer.ReadReplicaDB} {
+		if pool == nil {
+			continue
+		}
+		if conn, err := pool.DB(); err == nil {
+			if err := conn.Close(); err != nil {
+				config.Log.Error("Error closing the DB connections", err)
+			}
+		}
+	}
+	config.Log.Info("Closed the DB connections")
+}
+
+// chainProgressInterval is the interval between the progress reports of the chains when several are indexed
+const chainProgressInterval = time.Minute
+
+// dualWriteFlushTimeout is how long the writes queued for the secondary database are written for on shutdown
+const dualWriteFlushTimeout = 30 * time.Second
+
+// kafkaFlushTimeout is how long the blocks buffered for Kafka are published for on shutdown
+const kafkaFlushTimeout = 10 * time.Second
+
+// startKafkaPublisher publishes the blocks committed for every chain to Kafka until the returned func is called. The func
+// publishes the blocks still buffered for up to kafkaFlushTimeout and closes the publisher.
+func startKafkaPublisher(indexMetrics *metrics.Metrics) func() {
+	publisher, err := kafka.NewPublisher(indexer.Config.Kafka, indexMetrics)
+	if err != nil {
+		config.Log.Fatal("Failed to set up the Kafka publisher", err)
+	}
+
+	// A slow broker drops blocks from the buffer instead of slowing down the DB writes
+	notifications, unsubscribe := indexer.SubscribeBlocks("",
+		indexerPackage.WithBufferSize(int(indexer.Config.Kafka.BufferSize)),
+		indexerPackage.WithDeliveryPolicy(indexerPackage.DeliveryPolicyDrop),
+		indexerPackage.WithOnDrop(publisher.ObserveBufferFull))
+
+	// Not cancelled with the indexing, so the blocks committed while the indexer drains are still published
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		publisher.Run(ctx, notifications)
+	}()
+	config.Log.Infof("Publishing blocks to Kafka topic %s", indexer.Config.Kafka.Topic)
+
+	return func() {
+		unsubscribe()
+		select {
+		case <-done:
+		case <-time.After(kafkaFlushTimeout):
+			config.Log.Warnf("Publishing to Kafka did not finish within %s, dropping the blocks left", kafkaFlushTimeout)
+			cancel()
+			<-done
+		}
+		cancel()
+		if err := publisher.Close(); err != nil {
+			config.Log.Error("Error closing the Kafka publisher", err)
+		}
+	}
+}
+
+// webhookFlushTimeout is how long the events queued for the webhooks are delivered for on shutdown
+const webhookFlushTimeout = 10 * time.Second
+
+// startWebhookNotifier notifies the webhooks of the config of the blocks committed for every chain and of their failed
+// blocks until the returned func is called. The func delivers the events still queued for up to webhookFlushTimeout.
+func startWebhookNotifier(ctx context.Context, indexMetrics *metrics.Metrics) func() {
+	notifier := webhook.NewNotifier(indexer.Config.Webhooks, indexMetrics)
+
+	// Not cancelled with the indexing, so the events of the blocks committed while the indexer drains are still delivered
+	deliveryCtx, cancel := context.WithCancel(context.Background())
+	notifier.Start(deliveryCtx)
+
+	// The notifier only queues the events and never falls behind, the queue of each webhook absorbs its slow receiver
+	notifications, unsubscribe := indexer.SubscribeBlocks("", indexerPackage.WithDeliveryPolicy(indexerPackage.DeliveryPolicyBlock))
+	notified := make(chan struct{})
+	go func() {
+		defer close(notified)
+		notifier.Run(notifications)
+	}()
+
+	watchCtx, stopWatching := context.WithCancel(ctx)
+	watched := make(chan struct{})
+	go func() {
+		defer close(watched)
+		notifier.WatchFailedBlocks(watchCtx, indexer.DB, indexer.Config.ChainIDs())
+	}()
+
+	config.Log.Infof("Notifying %d webhooks", len(indexer.Config.Webhooks))
+
+	return func() {
+		unsubscribe()
+		stopWatching()
+		<-notified
+		<-watched
+
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			notifier.Close()
+		}()
+		select {
+		case <-closed:
+		case <-time.After(webhookFlushTimeout):
+			config.Log.Warnf("Delivering to the webhooks did not finish within %s, dropping the events left", webhookFlushTimeout)
+			cancel()
+			<-closed
+		}
+		cancel()
+	}
+}
+
+// indexChains indexes the chains of the config next to each other, each with its own chain client and block pipeline on
+// the shared database connections. A chain that fails is logged and reported in the metrics while the others keep being
+// indexed, the process exits with an error once all of them stopped.
+func indexChains(ctx context.Context, indexMetrics *metrics.Metrics) {
+	if indexer.BlockEnqueueFunction != nil {
+		config.Log.Fatal("A custom block enqueue function cannot be used with chains, it would enqueue the same heights on every chain")
+	}
+
+	// The bech32 prefixes of the SDK are global to the process, the addresses of the other chains are encoded with the
+	// account prefix of their chain client instead
+	config.SetChainConfig(indexer.Config.Chains[0].AccountPrefix)
+
+	chainIndexers := make([]*indexerPackage.Indexer, len(indexer.Config.Chains))
+	for i, chain := range indexer.Config.Chains {
+		chainIndexers[i] = indexer.ForChain(chain)
+	}
+
+	config.Log.Infof("Indexing %d chains", len(chainIndexers))
+	go reportChainProgress(ctx, chainIndexers, chainProgressInterval)
+
+	var wg sync.WaitGroup
+	var failed atomic.Int64
+	for _, idxr := range chainIndexers {
+		wg.Add(1)
+		go func(idxr *indexerPackage.Indexer) {
+			defer wg.Done()
+
+			if err := runChain(ctx, idxr, indexMetrics); err != nil {
+				idxr.Config.ChainLog().Error("Indexing the chain failed, the other chains are still indexed", err)
+				failed.Add(1)
+			}
+		}(idxr)
+	}
+	wg.Wait()
+
+	if failed.Load() != 0 {
+		config.Log.Fatalf("Indexing failed for %d of %d chains", failed.Load(), len(chainIndexers))
+	}
+}
+
+// runChain connects the indexer to its chain and indexes it, recording in the metrics whether the chain is indexed
+func runChain(ctx context.Context, idxr *indexerPackage.Indexer, indexMetrics *metrics.Metrics) error {
+	if indexMetrics != nil {
+		indexMetrics.SetChainIndexing(idxr.Config.Probe.ChainID, true)
+	}
+
+	err := setupChainClient(ctx, idxr, indexMetrics)
+	if err == nil {
+		err = indexChain(ctx, idxr, indexMetrics)
+	}
+
+	// Stopping on shutdown is not a failure of the chain
+	if err != nil && ctx.Err() == nil {
+		if indexMetrics != nil {
+			indexMetrics.SetChainIndexing(idxr.Config.Probe.ChainID, false)
+		}
+		return err
+	}
+	return nil
+}
+
+// reportChainProgress logs the progress of every chain on the interval until ctx is cancelled, so a chain falling
+// behind or stalled shows up next to the others
+func reportChainProgress(ctx context.Context, chainIndexers []*indexerPackage.Indexer, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, idxr := range chainIndexers {
+			progress := idxr.Progress()
+			if progress.Blocks == 0 {
+				idxr.Config.ChainLog().Info("No blocks indexed since startup")
+				continue
+			}
+			idxr.Config.ChainLog().Infof("Indexed %d blocks since startup, highest height %d, last block indexed %s ago",
+				progress.Blocks, progress.Height, time.Since(progress.IndexedAt).Round(time.Second))
+		}
+	}
+}
+
+// indexChain indexes the chain of the indexer according to its config until the blocks to index run out or ctx is
+// cancelled. Errors of the chain, like a failing RPC, are returned so the other chains of the process keep going.
+// indexMetrics may be nil.
+func indexChain(ctx context.Context, idxr *indexerPackage.Indexer, indexMetrics *metrics.Metrics) error {
+	// Stops the background work of the chain, like retention, once it is no longer indexed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	log := idxr.Config.ChainLog()
 
 	// blockChans are just the block heights; limit max jobs in the queue, otherwise this queue would contain one
 	// item (block height) for every block on the entire blockchain we're indexing. Furthermore, once the queue
@@ -199,76 +687,355 @@ func index(cmd *cobra.Command, args []string) {
 	// Realistically, I expect that RPC queries will be slower than our relational DB on the local network.
 	// If RPC queries are faster than DB inserts this buffer will fill up.
 	// We will periodically check the buffer size to monitor performance so we can optimize later.
-	rpcQueryThreads := int(idxr.Config.Base.RPCWorkers)
-	if rpcQueryThreads == 0 {
-		rpcQueryThreads = 4
-	} else if rpcQueryThreads > 64 {
-		rpcQueryThreads = 64
-	}
+	rpcQueryThreads := rpcWorkers(idxr.Config)
 
-	var wg sync.WaitGroup // This group is to ensure we are done processing transactions and events before returning
+	var wg sync.WaitGroup                 // This group is to ensure we are done processing transactions and events before returning
+	var dbUpdatesWaitGroup sync.WaitGroup // Waited on alone during shutdown, block processing may be stuck sending to the stopped DB updates
 
 	chain := models.Chain{
-		ChainID: idxr.Config.Probe.ChainID,
-		Name:    idxr.Config.Probe.ChainName,
+		ChainID:      idxr.Config.Probe.ChainID,
+		Name:         idxr.Config.Probe.ChainName,
+		Bech32Prefix: idxr.Config.Probe.AccountPrefix,
+		BaseDenom:    idxr.Config.Probe.BaseDenom,
+		Network:      idxr.Config.Probe.Network,
 	}
 
-	dbChainID, err := dbTypes.GetDBChainID(idxr.DB, chain)
+	dbChainID, err := dbTypes.GetDBChainID(ctx, idxr.DB, chain)
 	if err != nil {
-		config.Log.Fatal("Failed to add/create chain in DB", err)
+		return fmt.Errorf("failed to add/create chain in DB: %w", err)
 	}
 
-	// This block consolidates all base RPC requests into one worker.
-	// Workers read from the enqueued blocks and query blockchain data from the RPC server.
-	var blockRPCWaitGroup sync.WaitGroup
-	blockRPCWorkerDataChan := make(chan core.IndexerBlockEventData, 10)
-	for i := 0; i < rpcQueryThreads; i++ {
-		blockRPCWaitGroup.Add(1)
-		go core.BlockRPCWorker(&blockRPCWaitGroup, blockEnqueueChan, dbChainID, idxr.Config.Probe.ChainID, idxr.Config, idxr.ChainClient, idxr.DB, blockRPCWorkerDataChan)
+	// Held until the indexer exits, so a second indexer on the same chain stops here instead of indexing the same heights
+	if !idxr.DryRun && !idxr.Config.Base.Force {
+		chainLock, err := dbTypes.AcquireChainLock(ctx, idxr.DB, dbTypes.ChainRef{ID: dbChainID, ChainID: idxr.Config.Probe.ChainID})
+		if err != nil {
+			return fmt.Errorf("failed to lock the chain, set base.force to index it anyway: %w", err)
+		}
+		defer func() {
+			if err := chainLock.Release(); err != nil {
+				log.Error("Failed to release the chain lock", err)
+			}
+		}()
 	}
 
-	go func() {
-		blockRPCWaitGroup.Wait()
-		close(blockRPCWorkerDataChan)
-	}()
+	if idxr.SecondaryDB != nil && idxr.DualWriter == nil {
+		log.Info("Dual write mode enabled, block writes will be mirrored to the secondary database")
+		dualWriter := dbTypes.NewDualWriter(idxr.DB, idxr.SecondaryDB, chain)
+		idxr.DualWriter = dualWriter
+		// Runs when indexChain returns, after the DB writes were waited on
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.Background(), dualWriteFlushTimeout)
+			defer cancel()
+			if err := dualWriter.Close(flushCtx); err != nil {
+				log.Warnf("The writes queued for the secondary database did not finish within %s, they were dropped", dualWriteFlushTimeout)
+			}
+		}()
+	}
 
-	// Block BeginBlocker and EndBlocker indexing requirements. Indexes block events that took place in the BeginBlock and EndBlock state transitions
-	blockEventsDataChan := make(chan *indexerPackage.BlockEventsDBData, 4*rpcQueryThreads)
-	txDataChan := make(chan *indexerPackage.DBData, 4*rpcQueryThreads)
+	if idxr.RangeProfiles.IsSet() {
+		if err := checkRangeProfileChanges(ctx, idxr, dbChainID); err != nil {
+			return err
+		}
+	}
 
-	wg.Add(1)
-	go idxr.ProcessBlocks(&wg, core.HandleFailedBlock, blockRPCWorkerDataChan, blockEventsDataChan, txDataChan, dbChainID, indexer.BlockEventFilterRegistries)
+	if idxr.Config.Flags.ResolveIBCDenoms && !idxr.DryRun {
+		log.Info("IBC denom resolution enabled, the denom traces of new ibc/ fee denoms will be queried from the chain")
+		idxr.ResolveIBCDenoms(ctx, dbChainID)
+	}
 
-	wg.Add(1)
-	go idxr.DoDBUpdates(&wg, txDataChan, blockEventsDataChan, dbChainID)
+	if idxr.Config.RetentionEnabled() {
+		log.Infof("Retention policy enabled, pruning blocks every %d seconds", idxr.Config.Retention.Interval)
+		go idxr.PruneRetentionPeriodically(ctx, dbTypes.ChainRef{ID: dbChainID, ChainID: idxr.Config.Probe.ChainID}, time.Duration(idxr.Config.Retention.Interval)*time.Second)
+	}
 
+	var gapEnqueueFunction func(chan *core.EnqueueData) error
+	// Set when the enqueue resumes from the indexer checkpoints
+	usesCheckpoints := false
 	switch {
 	// If block enqueue function has been explicitly set, use that
 	case idxr.BlockEnqueueFunction != nil:
 	// Default block enqueue functions based on config values
 	case idxr.Config.Base.ReindexMessageType != "":
-		idxr.BlockEnqueueFunction, err = core.GenerateMsgTypeEnqueueFunction(idxr.DB, *idxr.Config, dbChainID, idxr.Config.Base.ReindexMessageType)
-		if err != nil {
-			config.Log.Fatal("Failed to generate block enqueue function", err)
-		}
+		idxr.BlockEnqueueFunction, err = core.GenerateMsgTypeEnqueueFunction(ctx, idxr.DB, *idxr.Config, dbChainID, idxr.Config.Base.ReindexMessageType)
+	case idxr.Config.Base.ReprocessFailedTxs:
+		idxr.BlockEnqueueFunction, err = core.GenerateFailedTxsEnqueueFunction(ctx, idxr.DB, *idxr.Config, idxr.ChainClient, dbChainID)
 	case idxr.Config.Base.BlockInputFile != "":
-		idxr.BlockEnqueueFunction, err = core.GenerateBlockFileEnqueueFunction(idxr.DB, *idxr.Config, idxr.ChainClient, dbChainID, idxr.Config.Base.BlockInputFile)
-		if err != nil {
-			config.Log.Fatal("Failed to generate block enqueue function", err)
+		idxr.BlockEnqueueFunction, err = core.GenerateBlockFileEnqueueFunction(ctx, idxr.DB, *idxr.Config, idxr.ChainClient, dbChainID, idxr.Config.Base.BlockInputFile)
+	case idxr.Config.Base.GapBackfill:
+		// The head is followed from above the indexed blocks, the gaps below are indexed by the gap backfill
+		headConfig := *idxr.Config
+		gapEnqueueFunction, headConfig.Base.StartBlock, err = generateGapEnqueueFunction(ctx, idxr, dbChainID, indexMetrics)
+		if err == nil {
+			idxr.BlockEnqueueFunction, err = core.GenerateDefaultEnqueueFunction(ctx, idxr.DB, headConfig, idxr.ChainClient, dbChainID)
 		}
+		usesCheckpoints = true
 	default:
-		idxr.BlockEnqueueFunction, err = core.GenerateDefaultEnqueueFunction(idxr.DB, *idxr.Config, idxr.ChainClient, dbChainID)
+		usesCheckpoints = true
+		idxr.BlockEnqueueFunction, err = core.GenerateDefaultEnqueueFunction(ctx, idxr.DB, *idxr.Config, idxr.ChainClient, dbChainID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to generate block enqueue function: %w", err)
+	}
+
+	// The checkpoints the enqueue resumed from are checked against the blocks in the background
+	if usesCheckpoints && !idxr.DryRun && !idxr.Config.Base.ReIndex {
+		go verifyIndexerCheckpoints(ctx, idxr, dbTypes.ChainRef{ID: dbChainID, ChainID: idxr.Config.Probe.ChainID})
+	}
+
+	blockEnqueueFunction := idxr.BlockEnqueueFunction
+	if idxr.RangeProfiles.IsSet() {
+		blockEnqueueFunction = core.GenerateRangeProfileEnqueueFunction(blockEnqueueFunction, idxr.RangeProfiles)
+		if gapEnqueueFunction != nil {
+			gapEnqueueFunction = core.GenerateRangeProfileEnqueueFunction(gapEnqueueFunction, idxr.RangeProfiles)
+		}
+	}
+
+	// This block consolidates all base RPC requests into a pool of workers.
+	// Workers read from the enqueued blocks and query blockchain data from the RPC server, the pool passes the blocks on
+	// in the order they were enqueued.
+	blockRPCWorkerDataChan := make(chan core.IndexerBlockEventData, 10)
+	// Failed block reattempts can enqueue a height that another worker is already fetching, the workers share those fetches
+	fetchCoalescer := core.NewFetchCoalescer()
+	fetchPool := core.NewBlockFetchPool(rpcQueryThreads, idxr.Config.Probe.ChainID, idxr.Config, idxr.ChainClient, idxr.DB, fetchCoalescer)
+	fetchPool.Pending = idxr.PendingHeights()
+	if gapEnqueueFunction == nil {
+		go fetchPool.Run(ctx, blockEnqueueChan, blockRPCWorkerDataChan)
+	} else {
+		runGapBackfill(ctx, idxr, gapEnqueueFunction, fetchPool, fetchCoalescer, blockEnqueueChan, blockRPCWorkerDataChan)
+	}
+
+	// Block BeginBlocker and EndBlocker indexing requirements. Indexes block events that took place in the BeginBlock and EndBlock state transitions
+	blockEventsDataChan := make(chan *indexerPackage.BlockEventsDBData, 4*rpcQueryThreads)
+	txDataChan := make(chan *indexerPackage.DBData, 4*rpcQueryThreads)
+
+	// The blocks already fetched are still processed and written on shutdown, for up to base.shutdown-timeout
+	shutdownTimeout := time.Duration(idxr.Config.Base.ShutdownTimeout) * time.Second
+	writeCtx, stopWrites := drainContext(ctx, shutdownTimeout)
+	defer stopWrites()
+
+	wg.Add(1)
+	go idxr.ProcessBlocks(writeCtx, &wg, core.HandleFailedBlock, blockRPCWorkerDataChan, blockEventsDataChan, txDataChan, dbChainID, idxr.BlockEventFilterRegistries)
+
+	dbUpdatesWaitGroup.Add(1)
+	go idxr.DoDBUpdates(writeCtx, &dbUpdatesWaitGroup, txDataChan, blockEventsDataChan, dbChainID)
+
+	// The enqueue can block on a full queue, run it in the background so shutdown does not wait on it
+	enqueueErr := make(chan error, 1)
+	go func() {
+		enqueueErr <- blockEnqueueFunction(blockEnqueueChan)
+	}()
+
+	select {
+	case err = <-enqueueErr:
+		// The blocks already enqueued are still indexed before the error is returned
+		close(blockEnqueueChan)
 		if err != nil {
-			config.Log.Fatal("Failed to generate block enqueue function", err)
+			err = fmt.Errorf("block enqueue failed: %w", err)
+		}
+	case <-ctx.Done():
+		log.Infof("Shutting down, writing the blocks already fetched for up to %s", shutdownTimeout)
+	}
+
+	dbUpdatesWaitGroup.Wait()
+	if ctx.Err() == nil {
+		wg.Wait()
+		return err
+	}
+
+	if writeCtx.Err() != nil {
+		log.Warnf("The blocks already fetched were not written within %s, the writes in flight were rolled back", shutdownTimeout)
+	}
+	logAbandonedHeights(idxr, blockEnqueueChan)
+	return err
+}
+
+// rpcWorkers returns the number of RPC workers fetching the blocks, base.rpc-workers capped at 64 and 4 when unset
+func rpcWorkers(cfg *config.IndexConfig) int {
+	workers := int(cfg.Base.RPCWorkers)
+	if workers == 0 {
+		return 4
+	} else if workers > 64 {
+		return 64
+	}
+	return workers
+}
+
+// drainContext returns a context for the DB writes that is cancelled timeout after ctx, so the writes in flight when the
+// indexer is stopped can commit. The returned cancel func cancels it right away.
+func drainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	drainCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-drainCtx.Done():
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-drainCtx.Done():
+		}
+		cancel()
+	}()
+	return drainCtx, cancel
+}
+
+// logAbandonedHeights logs the heights left unindexed by the shutdown: the heights in the pipeline that were not written
+// and the ones still waiting in the queue. They are indexed again on the next run.
+func logAbandonedHeights(idxr *indexerPackage.Indexer, blockEnqueueChan chan *core.EnqueueData) {
+	heights := idxr.PendingHeights().Heights()
+	for queued := true; queued; {
+		select {
+		case block := <-blockEnqueueChan:
+			if block != nil {
+				heights = append(heights, block.Height)
+			}
+		default:
+			queued = false
+		}
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	log := idxr.Config.ChainLog()
+	ranges := core.ContiguousRanges(heights)
+	if len(ranges) == 0 {
+		log.Info("Shutdown complete, no blocks in flight were abandoned")
+		return
+	}
+
+	described := make([]string, len(ranges))
+	for i, heights := range ranges {
+		described[i] = heights.String()
+	}
+	log.Warnf("Shutdown abandoned heights %s, they were not indexed and will be retried on the next run", strings.Join(described, ", "))
+}
+
+// verifyIndexerCheckpoints checks the checkpoints of the enabled datasets against the blocks from the start block and
+// corrects the ones that diverged, see dbTypes.VerifyIndexerCheckpoint. The chains without checkpoints get them here.
+func verifyIndexerCheckpoints(ctx context.Context, idxr *indexerPackage.Indexer, chain dbTypes.ChainRef) {
+	log := idxr.Config.ChainLog()
+	start := idxr.Config.Base.StartBlock
+	if start <= 0 {
+		start = 1
+	}
+
+	for _, workerType := range dbTypes.CheckpointWorkerTypes(idxr.Config.Base.TransactionIndexingEnabled, idxr.Config.Base.BlockEventIndexingEnabled) {
+		verification, err := dbTypes.VerifyIndexerCheckpoint(ctx, idxr.DB, chain, workerType, start)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				log.Errorf("Failed to verify the %s checkpoint. Err: %v", workerType, err)
+			}
+		case verification.Ahead():
+			log.Warnf("The %s checkpoint was at height %d but height %d is not indexed, reset it to height %d. The heights skipped by this run are indexed by the next one or with base.gap-backfill",
+				workerType, verification.Previous, verification.Scanned+1, verification.Scanned)
+		case !verification.Found:
+			log.Infof("Created the %s checkpoint at height %d", workerType, verification.Checkpoint.LastContiguousHeight)
+		default:
+			log.Debugf("Verified the %s checkpoint, at height %d", workerType, verification.Checkpoint.LastContiguousHeight)
 		}
 	}
+}
+
+// generateGapEnqueueFunction returns the enqueue function of the gap backfill, indexing the gaps from base.start-block up
+// to the highest indexed block, and the height the head is followed from. The enqueue function is nil when nothing is
+// indexed above the start block yet, the head then starts at the start block.
+func generateGapEnqueueFunction(ctx context.Context, idxr *indexerPackage.Indexer, dbChainID uint, indexMetrics *metrics.Metrics) (func(chan *core.EnqueueData) error, int64, error) {
+	start := idxr.Config.Base.StartBlock
+	if start <= 0 {
+		start = 1
+	}
 
-	err = idxr.BlockEnqueueFunction(blockEnqueueChan)
+	chain := dbTypes.ChainRef{ID: dbChainID, ChainID: idxr.Config.Probe.ChainID}
+	highest, err := dbTypes.GetSnapshotHeight(ctx, idxr.DB, chain)
 	if err != nil {
-		config.Log.Fatal("Block enqueue failed", err)
+		return nil, 0, fmt.Errorf("failed to get the highest indexed block: %w", err)
+	}
+	if highest < start {
+		idxr.Config.ChainLog().Infof("No blocks indexed from height %d yet, nothing to backfill", start)
+		return nil, start, nil
 	}
 
-	close(blockEnqueueChan)
+	heights := dbTypes.HeightRange{Start: start, End: highest}
+	if idxr.Config.Base.EndBlock != dbTypes.OpenEnd && idxr.Config.Base.EndBlock < heights.End {
+		heights.End = idxr.Config.Base.EndBlock
+	}
 
-	wg.Wait()
+	gapEnqueueFunction, err := core.GenerateGapEnqueueFunction(ctx, idxr.DB, *idxr.Config, chain, heights, indexMetrics)
+	if err != nil {
+		return nil, 0, err
+	}
+	return gapEnqueueFunction, highest + 1, nil
+}
+
+// runGapBackfill starts the fetch pools of the head and of the gap backfill and merges the blocks they fetch into the
+// output, the blocks of the head first. The gap backfill has its own workers and rate limit so it never starves the head,
+// it stops once its gaps are indexed while the head keeps going.
+func runGapBackfill(ctx context.Context, idxr *indexerPackage.Indexer, gapEnqueueFunction func(chan *core.EnqueueData) error, headPool *core.BlockFetchPool, coalescer *core.FetchCoalescer, blockEnqueueChan chan *core.EnqueueData, output chan core.IndexerBlockEventData) {
+	log := idxr.Config.ChainLog()
+
+	headData := make(chan core.IndexerBlockEventData, 10)
+	go headPool.Run(ctx, blockEnqueueChan, headData)
+
+	gapWorkers := int(idxr.Config.Base.GapRPCWorkers)
+	if gapWorkers < 1 {
+		gapWorkers = 1
+	}
+	// The pools share the coalescer, a failed head block reattempted inside a gap is only fetched once
+	gapPool := core.NewBlockFetchPool(gapWorkers, idxr.Config.Probe.ChainID, idxr.Config, idxr.ChainClient, idxr.DB, coalescer)
+	gapPool.RateLimit = idxr.Config.Base.GapRateLimit
+	gapPool.Pending = idxr.PendingHeights()
+
+	gapEnqueueChan := make(chan *core.EnqueueData, 100)
+	gapData := make(chan core.IndexerBlockEventData, 10)
+	go gapPool.Run(ctx, gapEnqueueChan, gapData)
+
+	log.Infof("Gap backfill enabled with %d RPC workers at %d blocks per second per worker", gapWorkers, gapPool.RateLimit)
+	go func() {
+		// A failing backfill leaves its gaps for the next run, the head keeps being indexed
+		if err := gapEnqueueFunction(gapEnqueueChan); err != nil {
+			log.Error("Gap backfill failed", err)
+		}
+		close(gapEnqueueChan)
+	}()
+
+	go core.MergeBlockData(ctx, headData, gapData, output)
+}
+
+// checkRangeProfileChanges returns an error when blocks were indexed with a different range profile than the one now
+// configured for their height, unless base.apply-profile-changes is set to reindex them with the configured profile
+func checkRangeProfileChanges(ctx context.Context, idxr *indexerPackage.Indexer, dbChainID uint) error {
+	log := idxr.Config.ChainLog()
+
+	mismatches, err := dbTypes.GetRangeProfileMismatches(ctx, idxr.DB, dbChainID, idxr.RangeProfiles)
+	if err != nil {
+		return fmt.Errorf("failed to check blocks against the range profiles: %w", err)
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	for _, mismatch := range mismatches {
+		log.Warnf("%d blocks from height %d to %d were indexed with range profile %s but are now configured with range profile %s",
+			mismatch.Blocks, mismatch.StartHeight, mismatch.EndHeight, mismatch.IndexedWith, mismatch.Profile)
+	}
+
+	if !idxr.Config.Base.ApplyProfileChanges {
+		return errors.New("range profiles changed for indexed blocks. Set base.apply-profile-changes to reindex them with the configured profiles, or restore the previous profiles")
+	}
+
+	if idxr.DryRun {
+		log.Warn("Dry run, blocks indexed with a different range profile will not be reindexed")
+		return nil
+	}
+
+	reset, err := dbTypes.ResetRangeProfileMismatches(ctx, idxr.DB, dbChainID, idxr.RangeProfiles)
+	if err != nil {
+		return fmt.Errorf("failed to mark blocks for reindexing with their range profile: %w", err)
+	}
+	log.Infof("Marked %d blocks for reindexing with their configured range profile", reset)
+	return nil
 }
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/spf13/cobra"
+)
+
+var purgeOptions dbTypes.PurgeOptions
+
+func init() {
+	purgeChainCmd.Flags().StringVar(&purgeOptions.ConfirmChainID, "confirm-chain-id", "", "the chain ID of the purged chain, must match probe.chain-id")
+	purgeChainCmd.Flags().BoolVar(&purgeOptions.DryRun, "dry-run", false, "only count the rows that would be deleted")
+	purgeChainCmd.Flags().BoolVar(&purgeOptions.KeepDictionaries, "keep-dictionaries", false, "keep the message types, event types, attribute keys, addresses and denominations no other chain references")
+	purgeChainCmd.Flags().IntVar(&purgeOptions.ChunkSize, "chunk-size", 100, "number of blocks deleted per database transaction")
+	indexCmd.AddCommand(purgeChainCmd)
+}
+
+var purgeChainCmd = &cobra.Command{
+	Use:   "purge-chain",
+	Short: "Deletes everything indexed for the chain.",
+	Long: `Deletes the blocks, txs, messages, events and attributes, failed blocks, validators and upgrades indexed for the
+	chain of probe.chain-id, and the chain itself, in chunks of blocks so tables are not locked for the whole purge.
+	Refuses to run unless --confirm-chain-id matches the chain ID. Use --dry-run to count the rows first.`,
+	Run: purgeChain,
+}
+
+func purgeChain(cmd *cobra.Command, args []string) {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	db, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the database", err)
+	}
+
+	chain, err := dbTypes.GetChainRef(cmd.Context(), db, indexer.Config.Probe.ChainID)
+	if err != nil {
+		config.Log.Fatal("Failed to get the chain", err)
+	}
+	if err := chain.Validate(); err != nil {
+		config.Log.Fatal("Chain has not been indexed", err)
+	}
+
+	report, err := dbTypes.PurgeChainData(cmd.Context(), db, chain.ID, purgeOptions)
+	if err != nil {
+		config.Log.Fatal("Failed to purge the chain", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "DELETED"
+	if report.DryRun {
+		header = "TO DELETE"
+	}
+	fmt.Fprintf(w, "TABLE\t%s\n", header)
+	for _, count := range report.Tables {
+		fmt.Fprintf(w, "%s\t%d\n", count.Table, count.Rows)
+	}
+	w.Flush()
+}
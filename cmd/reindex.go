@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/core"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	indexerPackage "github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	"github.com/spf13/cobra"
+)
+
+// reindexProgressInterval is the interval between the progress reports of a reindex
+const reindexProgressInterval = 10 * time.Second
+
+// reindexSummaryMaxFailedHeights is the number of failed heights listed in the summary of a reindex
+const reindexSummaryMaxFailedHeights = 20
+
+var reindexOptions struct {
+	chainID string
+	start   int64
+	end     int64
+	txs     bool
+	events  bool
+	force   bool
+}
+
+func init() {
+	reindexCmd.Flags().StringVar(&reindexOptions.chainID, "chain", "", "chain ID of the chain to reindex, defaults to probe.chain-id. Required with chains.")
+	reindexCmd.Flags().Int64Var(&reindexOptions.start, "start", 0, "first height to reindex")
+	reindexCmd.Flags().Int64Var(&reindexOptions.end, "end", 0, "last height to reindex")
+	reindexCmd.Flags().BoolVar(&reindexOptions.txs, "txs", false, "reindex the transactions of the heights")
+	reindexCmd.Flags().BoolVar(&reindexOptions.events, "events", false, "reindex the block events of the heights")
+	reindexCmd.Flags().BoolVar(&reindexOptions.force, "force", false, "reindex even when another indexer holds the lock of the chain")
+	_ = reindexCmd.MarkFlagRequired("start")
+	_ = reindexCmd.MarkFlagRequired("end")
+	indexCmd.AddCommand(reindexCmd)
+}
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Reindexes an explicit range of heights of a chain.",
+	Long: `Fetches every height from --start to --end and indexes it again, whether or not it is already indexed, replacing the
+	data stored for it. Reindexes the transactions and block events of the heights, or only the datasets selected with --txs
+	and --events. Refuses to run while another indexer holds the lock of the chain, unless --force is given. Reports its
+	progress while running and a summary of the blocks that succeeded and failed at the end.`,
+	PreRunE: setupIndex,
+	Run:     reindex,
+}
+
+func reindex(cmd *cobra.Command, args []string) {
+	idxr, err := reindexIndexer(reindexOptions.chainID)
+	if err != nil {
+		config.Log.Fatal("Invalid chain", err)
+	}
+
+	if reindexOptions.start < 1 || reindexOptions.end < reindexOptions.start {
+		config.Log.Fatalf("Invalid heights, --start must be at least 1 and --end at least --start, got %d to %d", reindexOptions.start, reindexOptions.end)
+	}
+	heights := dbTypes.HeightRange{Start: reindexOptions.start, End: reindexOptions.end}
+
+	// Without a selection, both datasets are reindexed
+	indexTransactions, indexBlockEvents := reindexOptions.txs, reindexOptions.events
+	if !indexTransactions && !indexBlockEvents {
+		indexTransactions, indexBlockEvents = true, true
+	}
+
+	cfg := idxr.Config
+	cfg.Base.StartBlock = heights.Start
+	cfg.Base.EndBlock = heights.End
+	cfg.Base.ReIndex = true
+	cfg.Base.ReindexReplace = true
+	cfg.Base.TransactionIndexingEnabled = indexTransactions
+	cfg.Base.BlockEventIndexingEnabled = indexBlockEvents
+	cfg.Base.Force = cfg.Base.Force || reindexOptions.force
+	log := cfg.ChainLog()
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	idxr.BlockEnqueueFunction, err = core.GenerateHeightRangeEnqueueFunction(ctx, *cfg, heights, indexTransactions, indexBlockEvents)
+	if err != nil {
+		log.Fatal("Invalid heights", err)
+	}
+
+	config.SetChainConfig(cfg.Probe.AccountPrefix)
+
+	if err := setupChainClient(ctx, idxr, nil); err != nil {
+		log.Fatal("Failed to connect to the chain", err)
+	}
+
+	latestHeight, err := rpc.GetLatestBlockHeight(idxr.ChainClient)
+	if err != nil {
+		log.Fatal("Error getting blockchain latest height", err)
+	}
+	if heights.End > latestHeight {
+		log.Fatalf("Cannot reindex up to height %d, the latest height of the chain is %d", heights.End, latestHeight)
+	}
+
+	log.Infof("Reindexing heights %s, transactions: %t, block events: %t", heights, indexTransactions, indexBlockEvents)
+	started := time.Now()
+	go reportReindexProgress(ctx, idxr, heights, reindexProgressInterval)
+
+	if err := indexChain(ctx, idxr, nil); err != nil && ctx.Err() == nil {
+		log.Fatal("Reindexing failed", err)
+	}
+
+	if err := printReindexSummary(idxr, heights, started, ctx.Err() != nil); err != nil {
+		log.Fatal("Failed to summarize the reindex", err)
+	}
+}
+
+// reindexIndexer returns the indexer of the chain with the chain ID, the chain of the probe section when it is empty
+func reindexIndexer(chainID string) (*indexerPackage.Indexer, error) {
+	if !indexer.Config.MultiChain() {
+		if chainID != "" && chainID != indexer.Config.Probe.ChainID {
+			return nil, fmt.Errorf("chain %s is not configured, the configured chain is %s", chainID, indexer.Config.Probe.ChainID)
+		}
+		return &indexer, nil
+	}
+
+	if chainID == "" {
+		return nil, errors.New("--chain is required when several chains are configured")
+	}
+	for _, chain := range indexer.Config.Chains {
+		if chain.ChainID == chainID {
+			return indexer.ForChain(chain), nil
+		}
+	}
+	return nil, fmt.Errorf("chain %s is not configured", chainID)
+}
+
+// reportReindexProgress logs the progress of the reindex on the interval until ctx is cancelled
+func reportReindexProgress(ctx context.Context, idxr *indexerPackage.Indexer, heights dbTypes.HeightRange, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	total := heights.End - heights.Start + 1
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		progress := idxr.Progress()
+		if progress.Height == 0 {
+			idxr.Config.ChainLog().Info("No blocks reindexed yet")
+			continue
+		}
+		done := progress.Height - heights.Start + 1
+		idxr.Config.ChainLog().Infof("Reindexed up to height %d, %d of %d heights (%.1f%%)", progress.Height, done, total, 100*float64(done)/float64(total))
+	}
+}
+
+// printReindexSummary prints the blocks of the range that were reindexed and the ones that failed since the reindex started
+func printReindexSummary(idxr *indexerPackage.Indexer, heights dbTypes.HeightRange, started time.Time, interrupted bool) error {
+	// The command context is cancelled on interrupt, the summary is still printed
+	ctx := context.Background()
+	chain, err := dbTypes.GetChainRef(ctx, idxr.DB, idxr.Config.Probe.ChainID)
+	if err != nil {
+		return err
+	}
+
+	failed, err := dbTypes.GetFailedHeightsSince(ctx, idxr.DB, chain, heights, started)
+	if err != nil {
+		return err
+	}
+
+	total := heights.End - heights.Start + 1
+	elapsed := time.Since(started).Round(time.Second)
+	if interrupted {
+		progress := idxr.Progress()
+		fmt.Printf("Reindex of heights %s interrupted after %s, highest height reindexed %d, %d blocks failed\n", heights, elapsed, progress.Height, len(failed))
+	} else {
+		fmt.Printf("Reindexed heights %s in %s: %d blocks, %d succeeded, %d failed\n", heights, elapsed, total, total-int64(len(failed)), len(failed))
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+	listed := failed
+	if len(listed) > reindexSummaryMaxFailedHeights {
+		listed = listed[:reindexSummaryMaxFailedHeights]
+	}
+	fmt.Printf("Failed heights: %v", listed)
+	if len(failed) > len(listed) {
+		fmt.Printf(" and %d more", len(failed)-len(listed))
+	}
+	fmt.Println(", see the failed_blocks and failed_event_blocks tables")
+	return nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -101,7 +102,12 @@ func BindFlags(cmd *cobra.Command, v *viper.Viper) {
 		// Apply the viper config value to the flag when the flag is not set and viper has a value
 		if !f.Changed && v.IsSet(configName) {
 			val := v.Get(configName)
-			err := cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+			var err error
+			if decoder, ok := f.Value.(config.ConfigValueDecoder); ok {
+				err = decoder.DecodeConfigValue(val)
+			} else {
+				err = cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+			}
 			if err != nil {
 				log.Fatalf("Failed to bind config file value %v. Err: %v", configName, err)
 			}
@@ -114,7 +120,12 @@ func setupLogger(logLevel string, logPath string, prettyLogging bool) {
 }
 
 func ConnectToDBAndMigrate(dbConfig config.Database) (*gorm.DB, error) {
-	database, err := db.PostgresDbConnect(dbConfig.Host, dbConfig.Port, dbConfig.Database, dbConfig.User, dbConfig.Password, strings.ToLower(dbConfig.LogLevel))
+	return ConnectToDBWithOptionsAndMigrate(dbConfig, db.ConnectOptions{})
+}
+
+// ConnectToDBWithOptionsAndMigrate is ConnectToDBAndMigrate with gorm customizations (plugins, post connect hook, custom gorm.Config)
+func ConnectToDBWithOptionsAndMigrate(dbConfig config.Database, connectOptions db.ConnectOptions) (*gorm.DB, error) {
+	database, err := db.PostgresDbConnectWithRetry(context.Background(), dbConfig, connectOptions)
 	if err != nil {
 		config.Log.Fatal("Could not establish connection to the database", err)
 	}
@@ -124,10 +135,101 @@ func ConnectToDBAndMigrate(dbConfig config.Database) (*gorm.DB, error) {
 	sqldb.SetMaxOpenConns(100)
 	sqldb.SetConnMaxLifetime(time.Hour)
 
-	err = db.MigrateModels(database)
+	err = migrateDB(database, dbConfig)
 	if err != nil {
 		config.Log.Error("Error running DB migrations", err)
 	}
 
 	return database, err
 }
+
+// migrateDB applies the pending schema migrations, or runs the legacy AutoMigrate when the database config asks for it,
+// then creates the optional indexes enabled in the database config
+func migrateDB(database *gorm.DB, dbConfig config.Database) error {
+	var err error
+	if dbConfig.LegacyAutoMigrate {
+		config.Log.Warn("database.legacy-auto-migrate is set, the schema is managed with AutoMigrate and its version is not checked")
+		err = db.AutoMigrateModels(database)
+	} else {
+		err = db.MigrateModels(database)
+	}
+	if err != nil {
+		return err
+	}
+
+	if dbConfig.MessageValueIndex {
+		if err := db.CreateMessageValueIndex(database); err != nil {
+			return err
+		}
+	}
+	if dbConfig.AttributeValueTrigramIndex {
+		return db.CreateAttributeValueTrigramIndex(database)
+	}
+	return nil
+}
+
+// ConnectToSecondaryDBAndMigrate connects to the secondary database used in dual write mode.
+// Unlike ConnectToDBAndMigrate, connection failures are returned to the caller since the secondary is optional.
+func ConnectToSecondaryDBAndMigrate(dbConfig config.Database, connectOptions db.ConnectOptions) (*gorm.DB, error) {
+	database, err := db.PostgresDbConnectWithRetry(context.Background(), dbConfig, connectOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	sqldb, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqldb.SetMaxIdleConns(10)
+	sqldb.SetMaxOpenConns(100)
+	sqldb.SetConnMaxLifetime(time.Hour)
+
+	err = migrateDB(database, dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// ConnectToReadReplica connects to the read replica used by the read only query helpers. The replica is not migrated, it
+// follows the schema of the database it replicates.
+func ConnectToReadReplica(dbConfig config.Database, connectOptions db.ConnectOptions) (*gorm.DB, error) {
+	database, err := db.PostgresDbConnectWithRetry(context.Background(), dbConfig, connectOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	sqldb, err := database.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqldb.SetMaxIdleConns(10)
+	sqldb.SetMaxOpenConns(100)
+	sqldb.SetConnMaxLifetime(time.Hour)
+
+	return database, nil
+}
+
+// useReadReplica routes the read only query helpers of the database to the configured read replica. The replica is
+// optional, reads stay on the database when it cannot be reached.
+func useReadReplica(database *gorm.DB) {
+	if indexer.ReadReplicaDB == nil && indexer.Config.ReadReplicaEnabled() {
+		replica, err := ConnectToReadReplica(indexer.Config.ReadReplica, indexer.DBConnectOptions)
+		if err != nil {
+			config.Log.Error("Could not establish connection to the read replica, reads will use the database", err)
+			return
+		}
+		indexer.ReadReplicaDB = replica
+	}
+
+	if indexer.ReadReplicaDB == nil {
+		return
+	}
+
+	if err := db.UseReadReplica(database, indexer.ReadReplicaDB); err != nil {
+		config.Log.Error("Could not register the read replica, reads will use the database", err)
+		return
+	}
+	config.Log.Info("Read replica enabled, stats and reports will read from it")
+}
@@ -0,0 +1,309 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var (
+	statsStartHeight int64
+	statsEndHeight   int64
+	statsByEra       bool
+	statsVerify      bool
+)
+
+func init() {
+	statsTypesCmd.Flags().Int64Var(&statsStartHeight, "start-height", 1, "lowest height to include in the stats")
+	statsTypesCmd.Flags().Int64Var(&statsEndHeight, "end-height", -1, "highest height to include in the stats, -1 for no upper bound")
+	statsTypesCmd.Flags().BoolVar(&statsByEra, "by-upgrade-era", false, "split the stats by the upgrade era each height belongs to")
+	statsUpgradesCmd.Flags().Int64Var(&statsStartHeight, "start-height", 1, "lowest plan height to include")
+	statsUpgradesCmd.Flags().Int64Var(&statsEndHeight, "end-height", -1, "highest plan height to include, -1 for no upper bound")
+	statsCompletenessCmd.Flags().Int64Var(&statsStartHeight, "start-height", 1, "lowest height to include in the report")
+	statsCompletenessCmd.Flags().Int64Var(&statsEndHeight, "end-height", -1, "highest height to include in the report, -1 for the highest height in the database")
+	statsCheckpointsCmd.Flags().BoolVar(&statsVerify, "verify", false, "check the checkpoints against the indexed blocks from base.start-block and correct them")
+	statsCmd.AddCommand(statsTypesCmd)
+	statsCmd.AddCommand(statsCompletenessCmd)
+	statsCmd.AddCommand(statsUpgradesCmd)
+	statsCmd.AddCommand(statsCheckpointsCmd)
+	indexCmd.AddCommand(statsCmd)
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Reports statistics about the indexed dataset.",
+}
+
+var statsTypesCmd = &cobra.Command{
+	Use:   "types",
+	Short: "Lists the message, message event and block event types indexed for the chain.",
+	Long: `Lists every message type, message event type and block event type indexed for the configured chain,
+	with how often it occurs and the first and last heights it was seen at. Useful for deciding which types to
+	filter or write parsers for.`,
+	Run: statsTypes,
+}
+
+var statsCompletenessCmd = &cobra.Command{
+	Use:   "completeness",
+	Short: "Reports what percentage of the height range is fully indexed and breaks down the remainder.",
+	Long: `Reports what percentage of heights in the range are fully indexed for the configured chain, according to the
+	transaction and block event indexing enabled in the config. The remainder is broken down into partially indexed blocks,
+	missing heights with the worst contiguous gap, and heights with unresolved failures.`,
+	Run: statsCompleteness,
+}
+
+var statsUpgradesCmd = &cobra.Command{
+	Use:   "upgrades",
+	Short: "Lists the software upgrades scheduled on the chain.",
+	Long: `Lists the software upgrades scheduled on the configured chain with the height they were scheduled at, the plan height
+	and whether they were applied or cancelled. Upgrades are only tracked when the upgrade parsers are registered.`,
+	Run: statsUpgrades,
+}
+
+var statsCheckpointsCmd = &cobra.Command{
+	Use:   "checkpoints",
+	Short: "Lists the indexer checkpoints of the chain and optionally verifies them.",
+	Long: `Lists the last contiguous height indexed for each dataset of the configured chain, which the indexer resumes from.
+	With --verify, scans the indexed blocks from base.start-block for the datasets enabled in the config, like the indexer
+	does at startup, and corrects the checkpoints that diverged from them.`,
+	Run: statsCheckpoints,
+}
+
+func statsTypes(cmd *cobra.Command, args []string) {
+	db, chain, heights := setupStats(cmd)
+
+	// All stats are read from one snapshot so the totals match while the indexer is running
+	err := dbTypes.WithSnapshot(cmd.Context(), db, func(tx *gorm.DB) error {
+		ctx := tx.Statement.Context
+		snapshotHeight, err := dbTypes.GetSnapshotHeight(ctx, tx, chain)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Type stats as of height %d\n\n", snapshotHeight)
+
+		if !statsByEra {
+			printTypeStatsInRange(ctx, tx, chain, heights)
+			return nil
+		}
+
+		eras, err := dbTypes.GetUpgradeEras(ctx, tx, chain)
+		if err != nil {
+			return err
+		}
+
+		for _, era := range eras {
+			eraHeights, ok := era.Heights.Intersect(heights)
+			if !ok {
+				continue
+			}
+
+			name := era.Name
+			if name == "" {
+				name = "genesis"
+			}
+			fmt.Printf("Upgrade era %s, heights %s\n\n", name, eraHeights)
+			printTypeStatsInRange(ctx, tx, chain, eraHeights)
+		}
+
+		return nil
+	})
+	if err != nil {
+		config.Log.Fatal("Failed to get type stats", err)
+	}
+}
+
+func statsUpgrades(cmd *cobra.Command, args []string) {
+	db, chain, heights := setupStats(cmd)
+
+	upgrades, err := dbTypes.GetUpgradesByChain(cmd.Context(), db, chain)
+	if err != nil {
+		config.Log.Fatal("Failed to get upgrades", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPLAN HEIGHT\tSCHEDULED AT\tSTATUS")
+	for _, upgrade := range upgrades {
+		if !heights.Contains(upgrade.PlanHeight) {
+			continue
+		}
+
+		status := "pending"
+		switch {
+		case upgrade.Cancelled:
+			status = fmt.Sprintf("cancelled at %d", *upgrade.CancelledHeight)
+		case upgrade.AppliedHeight != nil:
+			status = fmt.Sprintf("applied at %d", *upgrade.AppliedHeight)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", upgrade.Name, upgrade.PlanHeight, upgrade.ScheduledHeight, status)
+	}
+	w.Flush()
+}
+
+func printTypeStatsInRange(ctx context.Context, db *gorm.DB, chain dbTypes.ChainRef, heights dbTypes.HeightRange) {
+	messageTypeStats, err := dbTypes.GetMessageTypeStatsInRange(ctx, db, chain, heights)
+	if err != nil {
+		config.Log.Fatal("Failed to get message type stats", err)
+	}
+
+	messageEventTypeStats, err := dbTypes.GetMessageEventTypeStatsInRange(ctx, db, chain, heights)
+	if err != nil {
+		config.Log.Fatal("Failed to get message event type stats", err)
+	}
+
+	blockEventTypeStats, err := dbTypes.GetBlockEventTypeStatsInRange(ctx, db, chain, heights)
+	if err != nil {
+		config.Log.Fatal("Failed to get block event type stats", err)
+	}
+
+	printTypeStats("Message Types", messageTypeStats)
+	printTypeStats("Message Event Types", messageEventTypeStats)
+	printTypeStats("Block Event Types", blockEventTypeStats)
+}
+
+func statsCompleteness(cmd *cobra.Command, args []string) {
+	db, chain, heights := setupStats(cmd)
+
+	requirements := dbTypes.CompletenessRequirements{
+		Transactions: indexer.Config.Base.TransactionIndexingEnabled,
+		BlockEvents:  indexer.Config.Base.BlockEventIndexingEnabled,
+	}
+
+	// Blocks indexed with a range profile only need what the profile indexes
+	profiles, err := config.LoadRangeProfiles(indexer.Config)
+	if err != nil {
+		config.Log.Fatal("Invalid range profiles", err)
+	}
+
+	if profiles.IsSet() {
+		requirements.Profiles = make(map[string]dbTypes.CompletenessRequirements)
+		for _, profile := range profiles.All() {
+			requirements.Profiles[profile.Name] = dbTypes.CompletenessRequirements{
+				Transactions: profile.IndexTransactions,
+				BlockEvents:  profile.IndexBlockEvents,
+			}
+		}
+	}
+
+	report, err := dbTypes.GetCompletenessReport(cmd.Context(), db, chain, heights, requirements)
+	if err != nil {
+		config.Log.Fatal("Failed to get completeness report", err)
+	}
+
+	fmt.Printf("Completeness for %s heights %d to %d, as of height %d\n\n", report.ChainID, report.Heights.Start, report.Heights.End, report.SnapshotHeight)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Total heights\t%d\t\n", report.TotalHeights)
+	fmt.Fprintf(w, "Fully indexed\t%d\t%.4f%%\n", report.FullyIndexed, report.FullyIndexedPercent)
+	fmt.Fprintf(w, "Partially indexed\t%d\t%.4f%%\n", report.Partial, report.PartialPercent)
+	fmt.Fprintf(w, "Missing\t%d\t%.4f%%\n", report.Missing, report.MissingPercent)
+	if report.Pruned != 0 {
+		fmt.Fprintf(w, "Pruned\t%d\t\n", report.Pruned)
+	}
+	fmt.Fprintf(w, "Gaps\t%d\t\n", report.GapCount)
+	if report.WorstGap != nil {
+		fmt.Fprintf(w, "Worst gap\t%d to %d\t%d heights\n", report.WorstGap.Start, report.WorstGap.End, report.WorstGap.Length)
+	}
+	fmt.Fprintf(w, "Failed tx heights\t%d\t\n", report.FailedTxHeights)
+	fmt.Fprintf(w, "Failed block event heights\t%d\t\n", report.FailedEventHeights)
+	if report.OldestUnresolvedFailure != nil {
+		fmt.Fprintf(w, "Oldest unresolved failure\t%s\t%s ago\n", report.OldestUnresolvedFailure.Format(time.RFC3339), report.OldestUnresolvedFailureAge.Round(time.Second))
+	}
+	fmt.Fprintf(w, "Heights with quarantined attributes\t%d\t\n", report.QuarantinedHeights)
+	for _, quarantined := range report.QuarantineCounts {
+		fmt.Fprintf(w, "Quarantined %s attributes\t%d\t%d samples, last seen at %d\n", quarantined.EventType, quarantined.Count, quarantined.Samples, quarantined.LastSeenHeight)
+	}
+	for _, profile := range report.IndexProfiles {
+		if profile.Profile != "" {
+			fmt.Fprintf(w, "Indexed with range profile %s\t%d\t\n", profile.Profile, profile.Blocks)
+		}
+	}
+	w.Flush()
+}
+
+func statsCheckpoints(cmd *cobra.Command, args []string) {
+	db, chain, _ := setupStats(cmd)
+
+	if statsVerify {
+		start := indexer.Config.Base.StartBlock
+		if start <= 0 {
+			start = 1
+		}
+		for _, workerType := range dbTypes.CheckpointWorkerTypes(indexer.Config.Base.TransactionIndexingEnabled, indexer.Config.Base.BlockEventIndexingEnabled) {
+			verification, err := dbTypes.VerifyIndexerCheckpoint(cmd.Context(), db, chain, workerType, start)
+			if err != nil {
+				config.Log.Fatal("Failed to verify the checkpoints", err)
+			}
+
+			switch {
+			case verification.Ahead():
+				fmt.Printf("%s checkpoint diverged: it was at height %d but height %d is not indexed, reset to height %d\n", workerType, verification.Previous, verification.Scanned+1, verification.Scanned)
+			case !verification.Found:
+				fmt.Printf("%s checkpoint created at height %d\n", workerType, verification.Checkpoint.LastContiguousHeight)
+			default:
+				fmt.Printf("%s checkpoint verified\n", workerType)
+			}
+		}
+		fmt.Println()
+	}
+
+	checkpoints, err := dbTypes.GetIndexerCheckpoints(cmd.Context(), db, chain)
+	if err != nil {
+		config.Log.Fatal("Failed to get the checkpoints", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATASET\tSTART HEIGHT\tLAST CONTIGUOUS HEIGHT\tUPDATED AT")
+	for _, checkpoint := range checkpoints {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", checkpoint.WorkerType, checkpoint.StartHeight, checkpoint.LastContiguousHeight, checkpoint.UpdatedAt.Format(time.RFC3339))
+	}
+	w.Flush()
+}
+
+// setupStats validates the height range flags and loads the configured chain, exiting if it has not been indexed
+func setupStats(cmd *cobra.Command) (*gorm.DB, dbTypes.ChainRef, dbTypes.HeightRange) {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	heights, err := dbTypes.NewHeightRange(statsStartHeight, statsEndHeight)
+	if err != nil {
+		config.Log.Fatal("Invalid height range", err)
+	}
+
+	db, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the database", err)
+	}
+
+	useReadReplica(db)
+
+	chain, err := dbTypes.GetChainRef(cmd.Context(), db, indexer.Config.Probe.ChainID)
+	if err != nil {
+		config.Log.Fatal("Failed to get chain from DB", err)
+	}
+
+	if err := chain.Validate(); err != nil {
+		config.Log.Fatal("Chain has not been indexed", err)
+	}
+
+	return db, chain, heights
+}
+
+func printTypeStats(title string, stats []dbTypes.TypeStats) {
+	fmt.Printf("%s\n\n", title)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TYPE\tCOUNT\tFIRST SEEN\tLAST SEEN")
+	for _, stat := range stats {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", stat.Type, stat.Count, stat.FirstSeenHeight, stat.LastSeenHeight)
+	}
+	w.Flush()
+
+	fmt.Println()
+}
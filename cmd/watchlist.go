@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+var watchlistLabel string
+
+func init() {
+	watchlistAddCmd.Flags().StringVar(&watchlistLabel, "label", "", "a label to describe the watched address")
+	watchlistCmd.AddCommand(watchlistAddCmd, watchlistRemoveCmd, watchlistListCmd)
+	indexCmd.AddCommand(watchlistCmd)
+}
+
+var watchlistCmd = &cobra.Command{
+	Use:   "watchlist",
+	Short: "Manages the addresses on the watchlist.",
+	Long: `Txs involving watched addresses are indexed in full regardless of the message type filters when watchlist.enabled is set.
+	Changes are picked up by running indexers on their next watchlist reload.`,
+}
+
+var watchlistAddCmd = &cobra.Command{
+	Use:   "add [address]",
+	Short: "Adds an address to the watchlist.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupWatchlistCommand(cmd)
+
+		_, err := dbTypes.AddWatchedAddress(cmd.Context(), db, args[0], watchlistLabel)
+		if err != nil {
+			config.Log.Fatal("Failed to add address to the watchlist", err)
+		}
+
+		config.Log.Infof("Added %s to the watchlist", args[0])
+	},
+}
+
+var watchlistRemoveCmd = &cobra.Command{
+	Use:   "remove [address]",
+	Short: "Removes an address from the watchlist.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupWatchlistCommand(cmd)
+
+		err := dbTypes.RemoveWatchedAddress(cmd.Context(), db, args[0])
+		if err != nil {
+			config.Log.Fatal("Failed to remove address from the watchlist", err)
+		}
+
+		config.Log.Infof("Removed %s from the watchlist", args[0])
+	},
+}
+
+var watchlistListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists the addresses on the watchlist.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db := setupWatchlistCommand(cmd)
+
+		watchedAddresses, err := dbTypes.GetWatchedAddresses(cmd.Context(), db)
+		if err != nil {
+			config.Log.Fatal("Failed to get the watchlist", err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ADDRESS\tLABEL\tADDED")
+		for _, watchedAddress := range watchedAddresses {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", watchedAddress.Address.Address, watchedAddress.Label, watchedAddress.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		w.Flush()
+	},
+}
+
+func setupWatchlistCommand(cmd *cobra.Command) *gorm.DB {
+	BindFlags(cmd, viperConf)
+	setupLogger(indexer.Config.Log.Level, indexer.Config.Log.Path, indexer.Config.Log.Pretty)
+
+	db, err := ConnectToDBWithOptionsAndMigrate(indexer.Config.Database, indexer.DBConnectOptions)
+	if err != nil {
+		config.Log.Fatal("Could not establish connection to the database", err)
+	}
+
+	return db
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ChainConfig is one of the chains of the chains list of the config file. The chains of the list are indexed next to
+// each other by the same process into the same database, each with its own RPC endpoint and heights. The other sections
+// of the config apply to every chain.
+type ChainConfig struct {
+	Probe      `mapstructure:",squash"`
+	StartBlock *int64 `mapstructure:"start-block"` // base.start-block when unset
+	EndBlock   *int64 `mapstructure:"end-block"`   // base.end-block when unset
+}
+
+// MultiChain returns true if the config lists the chains to index instead of the single chain of the probe section
+func (conf *IndexConfig) MultiChain() bool {
+	return len(conf.Chains) != 0
+}
+
+// ForChain returns the config of one of the chains: a copy of the config with the probe settings and heights of the
+// chain. The other sections are shared by all the chains.
+func (conf *IndexConfig) ForChain(chain ChainConfig) *IndexConfig {
+	chainConf := *conf
+	chainConf.Chains = nil
+	chainConf.Probe = chain.Probe
+	if chain.StartBlock != nil {
+		chainConf.Base.StartBlock = *chain.StartBlock
+	}
+	if chain.EndBlock != nil {
+		chainConf.Base.EndBlock = *chain.EndBlock
+	}
+	return &chainConf
+}
+
+// ChainLog returns the logger of the chain indexed with the config, adding its chain ID to every entry
+func (conf *IndexConfig) ChainLog() *Logger {
+	if conf == nil {
+		return Log
+	}
+	return Log.WithChain(conf.Probe.ChainID)
+}
+
+// validateChains validates the probe settings and heights of every chain and fills in the RPC ports, like the probe
+// section of a single chain
+func (conf *IndexConfig) validateChains() error {
+	if conf.Base.BlockInputFile != "" {
+		return errors.New("base.block-input-file cannot be used with chains, set the heights of each chain instead")
+	}
+
+	chainIDs := make(map[string]struct{}, len(conf.Chains))
+	for i := range conf.Chains {
+		chain := &conf.Chains[i]
+
+		probeConf, err := validateProbeConf(chain.Probe)
+		if err != nil {
+			return fmt.Errorf("chains[%d]: %w", i, err)
+		}
+		chain.Probe = probeConf
+
+		if _, ok := chainIDs[chain.ChainID]; ok {
+			return fmt.Errorf("chains[%d]: chain-id %s is listed more than once", i, chain.ChainID)
+		}
+		chainIDs[chain.ChainID] = struct{}{}
+
+		chainConf := conf.ForChain(*chain)
+		if chainConf.Base.StartBlock == 0 {
+			return fmt.Errorf("chains[%d]: start-block must be set on the chain or in base.start-block", i)
+		}
+		if chainConf.Base.EndBlock == 0 {
+			return fmt.Errorf("chains[%d]: end-block must be set on the chain or in base.end-block", i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+func (suite *IndexConfigTestSuite) TestChains() {
+	conf := IndexConfig{
+		Database: Database{
+			Host:     "fake-host",
+			Port:     "5432",
+			Database: "fake-database",
+			User:     "fake-user",
+			Password: "fake-password",
+		},
+	}
+	conf.Base.TransactionIndexingEnabled = true
+	conf.Base.EndBlock = -1
+
+	viperConf := viper.New()
+	viperConf.SetConfigType("toml")
+	err := viperConf.ReadConfig(strings.NewReader(`
+[[chains]]
+rpc = "http://cosmos-rpc"
+account-prefix = "cosmos"
+chain-id = "cosmoshub-4"
+chain-name = "cosmoshub"
+start-block = 100
+
+[[chains]]
+rpc = "http://osmosis-rpc"
+account-prefix = "osmo"
+chain-id = "osmosis-1"
+chain-name = "osmosis"
+base-denom = "uosmo"
+end-block = 200
+`))
+	suite.Require().NoError(err)
+	suite.Require().Empty(CheckSuperfluousIndexKeys(viperConf.AllKeys()))
+	suite.Require().NoError(viperConf.UnmarshalKey("chains", &conf.Chains))
+	suite.Require().Len(conf.Chains, 2)
+	suite.Require().True(conf.MultiChain())
+
+	// The top level probe section is not required with chains, base.start-block is required by the chain without its own
+	err = conf.Validate()
+	suite.Require().ErrorContains(err, "chains[1]: start-block")
+
+	conf.Base.StartBlock = 1
+	suite.Require().NoError(conf.Validate())
+	suite.Require().Equal("http://cosmos-rpc:80", conf.Chains[0].RPC)
+
+	cosmos := conf.ForChain(conf.Chains[0])
+	suite.Require().Equal("cosmoshub-4", cosmos.Probe.ChainID)
+	suite.Require().Equal(int64(100), cosmos.Base.StartBlock)
+	suite.Require().Equal(int64(-1), cosmos.Base.EndBlock)
+	suite.Require().False(cosmos.MultiChain())
+
+	osmosis := conf.ForChain(conf.Chains[1])
+	suite.Require().Equal("uosmo", osmosis.Probe.BaseDenom)
+	suite.Require().Equal(int64(1), osmosis.Base.StartBlock)
+	suite.Require().Equal(int64(200), osmosis.Base.EndBlock)
+
+	conf.Chains[1].ChainID = "cosmoshub-4"
+	suite.Require().ErrorContains(conf.Validate(), "listed more than once")
+
+	conf.Chains[1].ChainID = "osmosis-1"
+	conf.Chains[1].AccountPrefix = ""
+	suite.Require().ErrorContains(conf.Validate(), "chains[1]: probe account-prefix must be set")
+
+	conf.Chains[1].AccountPrefix = "osmo"
+	conf.Base.BlockInputFile = "blocks.json"
+	suite.Require().Error(conf.Validate())
+}
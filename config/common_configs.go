@@ -3,10 +3,14 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/DefiantLabs/cosmos-indexer/util"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/spf13/cobra"
 )
 
@@ -18,21 +22,104 @@ type log struct {
 }
 
 type Database struct {
+	// URL is a full PostgreSQL connection URI or keyword/value connection string passed to the driver as is, for
+	// options like application_name or search_path. It takes precedence over the connection fields below, which must
+	// match it or be left unset.
+	URL string `mapstructure:"url"`
+	// Dialect is the server the database runs on. CockroachDB is reached with the PostgreSQL driver, helpers that rely on
+	// PostgreSQL only features return an error on it.
+	Dialect  string
 	Host     string
 	Port     string
 	Database string
 	User     string
 	Password string
 	LogLevel string `mapstructure:"log-level"`
+	// TLS settings passed to the PostgreSQL driver, see the libpq docs of the parameters with the same names
+	SSLMode     string `mapstructure:"sslmode"`
+	SSLRootCert string `mapstructure:"sslrootcert"`
+	SSLCert     string `mapstructure:"sslcert"`
+	SSLKey      string `mapstructure:"sslkey"`
+	// Retries of the initial connection while the database is not accepting connections yet, -1 retries forever
+	ConnectRetryAttempts int64  `mapstructure:"connect-retry-attempts"`
+	ConnectRetryMaxWait  uint64 `mapstructure:"connect-retry-max-wait"`
+	// LegacyAutoMigrate manages the schema with AutoMigrate as before versioned migrations, without recording versions
+	LegacyAutoMigrate bool `mapstructure:"legacy-auto-migrate"`
+	// Partitioning creates the message tables partitioned by block height, see PartitioningHeight. Empty to disable.
+	Partitioning    string `mapstructure:"partitioning"`
+	PartitionSize   int64  `mapstructure:"partition-size"`   // Heights per partition
+	PartitionsAhead int64  `mapstructure:"partitions-ahead"` // Partitions created past the one of the height being indexed
+	// MessageValueIndex creates the GIN index on the decoded message values queried by JSON path
+	MessageValueIndex bool `mapstructure:"message-value-index"`
+	// AttributeValueTrigramIndex creates the pg_trgm index on the message event attribute values searched by substring
+	AttributeValueTrigramIndex bool `mapstructure:"attribute-value-trigram-index"`
+	// InsertBatchSize is the number of rows per INSERT of the bulk inserts, 0 for the default
+	InsertBatchSize int `mapstructure:"insert-batch-size"`
+	// CopyInserts loads message events and their attributes with COPY and merges them into their tables in one statement
+	CopyInserts bool `mapstructure:"copy-inserts"`
 }
 
+// DefaultDatabasePort is the default of the database port flag
+const DefaultDatabasePort = "5432"
+
+// PostgreSQL sslmode values, in order of increasing protection
+const (
+	SSLModeDisable    = "disable"
+	SSLModeAllow      = "allow"
+	SSLModePrefer     = "prefer"
+	SSLModeRequire    = "require"
+	SSLModeVerifyCA   = "verify-ca"
+	SSLModeVerifyFull = "verify-full"
+)
+
+var SSLModes = []string{SSLModeDisable, SSLModeAllow, SSLModePrefer, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull}
+
+// Database dialects
+const (
+	DialectPostgres    = "postgres"
+	DialectCockroachDB = "cockroachdb"
+)
+
+var Dialects = []string{DialectPostgres, DialectCockroachDB}
+
+// PartitioningHeight range partitions messages, message_events and message_event_attributes by block height
+const PartitioningHeight = "height"
+
+// MaxInsertBatchSize is the largest database insert-batch-size. Rows of the widest bulk inserted table take up to 9 bind
+// parameters and PostgreSQL allows 65535 per statement.
+const MaxInsertBatchSize = 5000
+
 type Probe struct {
 	RPC           string
 	AccountPrefix string `mapstructure:"account-prefix"`
 	ChainID       string `mapstructure:"chain-id"`
 	ChainName     string `mapstructure:"chain-name"`
+	BaseDenom     string `mapstructure:"base-denom"`
+	Network       string `mapstructure:"network"`
+	// RPC endpoints the requests fail over to when the rpc endpoint is unhealthy, see rpc.FailoverClient
+	RPCFallbacks      []RPCEndpoint `mapstructure:"rpc-fallbacks"`
+	RPCMaxFailures    int64         `mapstructure:"rpc-max-failures"`
+	RPCMaxLag         int64         `mapstructure:"rpc-max-lag"`
+	RPCHealthInterval int64         `mapstructure:"rpc-health-interval"`
+	// Requests per second sent to each RPC endpoint in bursts of RPCBurst requests, 0 for no limit. Fallbacks may set
+	// their own, see RPCEndpoint.
+	RPCRequestsPerSecond float64 `mapstructure:"rpc-requests-per-second"`
+	RPCBurst             int64   `mapstructure:"rpc-burst"`
 }
 
+// Defaults of the RPC failover settings of the probe section, applied when they are not set
+const (
+	DefaultRPCMaxFailures    = 3
+	DefaultRPCMaxLag         = 20
+	DefaultRPCHealthInterval = 30
+)
+
+// Networks of a chain, see probe.network
+const (
+	NetworkMainnet = "mainnet"
+	NetworkTestnet = "testnet"
+)
+
 type throttlingBase struct {
 	Throttling float64 `mapstructure:"throttling"`
 }
@@ -49,12 +136,42 @@ func SetupLogFlags(logConf *log, cmd *cobra.Command) {
 }
 
 func SetupDatabaseFlags(databaseConf *Database, cmd *cobra.Command) {
-	cmd.PersistentFlags().StringVar(&databaseConf.Host, "database.host", "", "database host")
-	cmd.PersistentFlags().StringVar(&databaseConf.Port, "database.port", "5432", "database port")
-	cmd.PersistentFlags().StringVar(&databaseConf.Database, "database.database", "", "database name")
-	cmd.PersistentFlags().StringVar(&databaseConf.User, "database.user", "", "database user")
-	cmd.PersistentFlags().StringVar(&databaseConf.Password, "database.password", "", "database password")
-	cmd.PersistentFlags().StringVar(&databaseConf.LogLevel, "database.log-level", "", "database loglevel")
+	setupDatabaseFlagsWithPrefix(databaseConf, cmd, "database", "database")
+}
+
+// SetupSecondaryDatabaseFlags sets up the flags for the optional secondary database used in dual write mode
+func SetupSecondaryDatabaseFlags(databaseConf *Database, cmd *cobra.Command) {
+	setupDatabaseFlagsWithPrefix(databaseConf, cmd, "secondary-database", "secondary database (dual write mode, leave host and url unset to disable)")
+}
+
+// SetupReadReplicaFlags sets up the flags for the optional read replica used by the read only query helpers
+func SetupReadReplicaFlags(databaseConf *Database, cmd *cobra.Command) {
+	setupDatabaseFlagsWithPrefix(databaseConf, cmd, "read-replica", "read replica (leave host and url unset to read from the database)")
+}
+
+func setupDatabaseFlagsWithPrefix(databaseConf *Database, cmd *cobra.Command, prefix string, description string) {
+	cmd.PersistentFlags().StringVar(&databaseConf.URL, prefix+".url", "", description+" connection URI, passed to the driver as is and used instead of the host, port, name, user, password and ssl flags")
+	cmd.PersistentFlags().StringVar(&databaseConf.Dialect, prefix+".dialect", DialectPostgres, description+" dialect: "+strings.Join(Dialects, ", "))
+	cmd.PersistentFlags().StringVar(&databaseConf.Host, prefix+".host", "", description+" host")
+	cmd.PersistentFlags().StringVar(&databaseConf.Port, prefix+".port", DefaultDatabasePort, description+" port")
+	cmd.PersistentFlags().StringVar(&databaseConf.Database, prefix+".database", "", description+" name")
+	cmd.PersistentFlags().StringVar(&databaseConf.User, prefix+".user", "", description+" user")
+	cmd.PersistentFlags().StringVar(&databaseConf.Password, prefix+".password", "", description+" password")
+	cmd.PersistentFlags().StringVar(&databaseConf.LogLevel, prefix+".log-level", "", description+" loglevel")
+	cmd.PersistentFlags().StringVar(&databaseConf.SSLMode, prefix+".sslmode", SSLModeDisable, description+" sslmode: "+strings.Join(SSLModes, ", "))
+	cmd.PersistentFlags().StringVar(&databaseConf.SSLRootCert, prefix+".sslrootcert", "", description+" path to the root certificate used to verify the server with verify-ca or verify-full")
+	cmd.PersistentFlags().StringVar(&databaseConf.SSLCert, prefix+".sslcert", "", description+" path to the client certificate")
+	cmd.PersistentFlags().StringVar(&databaseConf.SSLKey, prefix+".sslkey", "", description+" path to the client certificate key")
+	cmd.PersistentFlags().Int64Var(&databaseConf.ConnectRetryAttempts, prefix+".connect-retry-attempts", 10, description+" connection retries while it is not accepting connections, 0 to fail on the first error and -1 to retry forever")
+	cmd.PersistentFlags().Uint64Var(&databaseConf.ConnectRetryMaxWait, prefix+".connect-retry-max-wait", 30, description+" max seconds to wait between connection retries, the wait doubles from 1 second up to this")
+	cmd.PersistentFlags().BoolVar(&databaseConf.LegacyAutoMigrate, prefix+".legacy-auto-migrate", false, description+" schema management with gorm AutoMigrate instead of versioned migrations, for deployments that cannot adopt them yet")
+	cmd.PersistentFlags().StringVar(&databaseConf.Partitioning, prefix+".partitioning", "", description+" partitioning of the message tables, height or empty to disable. Only applies when the tables are created")
+	cmd.PersistentFlags().Int64Var(&databaseConf.PartitionSize, prefix+".partition-size", 1000000, description+" heights per partition of the message tables")
+	cmd.PersistentFlags().Int64Var(&databaseConf.PartitionsAhead, prefix+".partitions-ahead", 1, description+" partitions of the message tables created ahead of the height being indexed")
+	cmd.PersistentFlags().BoolVar(&databaseConf.MessageValueIndex, prefix+".message-value-index", false, description+" GIN index on the decoded message values stored with flags.store-message-bodies, for JSON path queries")
+	cmd.PersistentFlags().BoolVar(&databaseConf.AttributeValueTrigramIndex, prefix+".attribute-value-trigram-index", false, description+" trigram index on the message event attribute values, for substring searches. Skipped with a warning when the pg_trgm extension is not available")
+	cmd.PersistentFlags().IntVar(&databaseConf.InsertBatchSize, prefix+".insert-batch-size", 1000, fmt.Sprintf("%s rows per INSERT when indexing blocks, large blocks are split into several statements to stay under the bind parameter limit. At most %d", description, MaxInsertBatchSize))
+	cmd.PersistentFlags().BoolVar(&databaseConf.CopyInserts, prefix+".copy-inserts", false, description+" loads message events and their attributes with COPY into a temporary table and merges them with one INSERT, faster than batched INSERTs when backfilling large blocks")
 }
 
 func SetupProbeFlags(probeConf *Probe, cmd *cobra.Command) {
@@ -62,6 +179,14 @@ func SetupProbeFlags(probeConf *Probe, cmd *cobra.Command) {
 	cmd.PersistentFlags().StringVar(&probeConf.AccountPrefix, "probe.account-prefix", "", "probe account prefix")
 	cmd.PersistentFlags().StringVar(&probeConf.ChainID, "probe.chain-id", "", "probe chain ID")
 	cmd.PersistentFlags().StringVar(&probeConf.ChainName, "probe.chain-name", "", "probe chain name")
+	cmd.PersistentFlags().StringVar(&probeConf.BaseDenom, "probe.base-denom", "", "staking denomination of the chain, e.g. uatom, stored on the chain row")
+	cmd.PersistentFlags().StringVar(&probeConf.Network, "probe.network", "", "network of the chain, mainnet or testnet, stored on the chain row")
+	cmd.PersistentFlags().Var(&rpcEndpointsValue{value: &probeConf.RPCFallbacks}, "probe.rpc-fallbacks", "node rpc endpoints the requests fail over to when the rpc endpoint is unhealthy")
+	cmd.PersistentFlags().Int64Var(&probeConf.RPCMaxFailures, "probe.rpc-max-failures", DefaultRPCMaxFailures, "consecutive failed requests after which an rpc endpoint is marked unhealthy")
+	cmd.PersistentFlags().Int64Var(&probeConf.RPCMaxLag, "probe.rpc-max-lag", DefaultRPCMaxLag, "blocks an rpc endpoint can be behind the most recent endpoint before it is marked unhealthy")
+	cmd.PersistentFlags().Int64Var(&probeConf.RPCHealthInterval, "probe.rpc-health-interval", DefaultRPCHealthInterval, "seconds between the health checks of the rpc endpoints")
+	cmd.PersistentFlags().Float64Var(&probeConf.RPCRequestsPerSecond, "probe.rpc-requests-per-second", 0, "maximum requests per second sent to each rpc endpoint by all the workers together (0 for no limit)")
+	cmd.PersistentFlags().Int64Var(&probeConf.RPCBurst, "probe.rpc-burst", 1, "requests sent to an rpc endpoint at once before probe.rpc-requests-per-second applies")
 }
 
 func SetupThrottlingFlag(throttlingValue *float64, cmd *cobra.Command) {
@@ -69,6 +194,74 @@ func SetupThrottlingFlag(throttlingValue *float64, cmd *cobra.Command) {
 }
 
 func validateDatabaseConf(dbConf Database) error {
+	if err := validateDatabaseConnection(dbConf); err != nil {
+		return err
+	}
+
+	if dbConf.Dialect != "" && !slices.Contains(Dialects, dbConf.Dialect) {
+		return fmt.Errorf("database dialect %q is invalid, must be one of %s", dbConf.Dialect, strings.Join(Dialects, ", "))
+	}
+
+	if err := validatePartitioning(dbConf); err != nil {
+		return err
+	}
+
+	if dbConf.MessageValueIndex && dbConf.Dialect == DialectCockroachDB {
+		return errors.New("database message-value-index requires PostgreSQL")
+	}
+
+	if dbConf.InsertBatchSize < 0 || dbConf.InsertBatchSize > MaxInsertBatchSize {
+		return fmt.Errorf("database insert-batch-size must be between 0 and %d", MaxInsertBatchSize)
+	}
+
+	if dbConf.AttributeValueTrigramIndex && dbConf.Dialect == DialectCockroachDB {
+		return errors.New("database attribute-value-trigram-index requires PostgreSQL")
+	}
+
+	if dbConf.CopyInserts && dbConf.Dialect == DialectCockroachDB {
+		return errors.New("database copy-inserts requires PostgreSQL")
+	}
+
+	if dbConf.ConnectRetryAttempts < -1 {
+		return errors.New("database connect-retry-attempts must be -1 or greater")
+	}
+
+	if dbConf.ConnectRetryAttempts != 0 && dbConf.ConnectRetryMaxWait == 0 {
+		return errors.New("database connect-retry-max-wait must be greater than 0 when connection retries are enabled")
+	}
+
+	return nil
+}
+
+func validatePartitioning(dbConf Database) error {
+	if dbConf.Partitioning == "" {
+		return nil
+	}
+
+	if dbConf.Partitioning != PartitioningHeight {
+		return fmt.Errorf("database partitioning %q is invalid, must be %s or empty", dbConf.Partitioning, PartitioningHeight)
+	}
+
+	if dbConf.Dialect == DialectCockroachDB {
+		return errors.New("database partitioning requires PostgreSQL")
+	}
+
+	if dbConf.PartitionSize <= 0 {
+		return errors.New("database partition-size must be greater than 0 when partitioning is enabled")
+	}
+
+	if dbConf.PartitionsAhead < 0 {
+		return errors.New("database partitions-ahead must be 0 or greater")
+	}
+
+	return nil
+}
+
+func validateDatabaseConnection(dbConf Database) error {
+	if !util.StrNotSet(dbConf.URL) {
+		return validateDatabaseURL(dbConf)
+	}
+
 	if util.StrNotSet(dbConf.Host) {
 		return errors.New("database host must be set")
 	}
@@ -85,20 +278,125 @@ func validateDatabaseConf(dbConf Database) error {
 		return errors.New("database password must be set")
 	}
 
+	if err := ValidateSSLMode(dbConf.SSLMode); err != nil {
+		return err
+	}
+
+	if util.StrNotSet(dbConf.SSLCert) != util.StrNotSet(dbConf.SSLKey) {
+		return errors.New("database sslcert and sslkey must be set together")
+	}
+
+	return nil
+}
+
+// validateDatabaseURL checks the URL parses and that the connection fields set next to it match what the URL connects to.
+// The port and sslmode are only compared when they are changed from their defaults.
+func validateDatabaseURL(dbConf Database) error {
+	urlConf, err := pgconn.ParseConfig(dbConf.URL)
+	if err != nil {
+		return fmt.Errorf("database url is invalid: %w", err)
+	}
+
+	var conflicts []string
+	for _, field := range []struct {
+		key      string
+		value    string
+		urlValue string
+	}{
+		{"host", dbConf.Host, urlConf.Host},
+		{"database", dbConf.Database, urlConf.Database},
+		{"user", dbConf.User, urlConf.User},
+		{"password", dbConf.Password, urlConf.Password},
+	} {
+		if !util.StrNotSet(field.value) && field.value != field.urlValue {
+			conflicts = append(conflicts, field.key)
+		}
+	}
+
+	if !util.StrNotSet(dbConf.Port) && dbConf.Port != DefaultDatabasePort && dbConf.Port != strconv.Itoa(int(urlConf.Port)) {
+		conflicts = append(conflicts, "port")
+	}
+
+	// The TLS settings of the URL cannot be compared, they must be set in the URL
+	if !util.StrNotSet(dbConf.SSLMode) && dbConf.SSLMode != SSLModeDisable {
+		conflicts = append(conflicts, "sslmode")
+	}
+
+	for _, field := range []struct {
+		key   string
+		value string
+	}{
+		{"sslrootcert", dbConf.SSLRootCert},
+		{"sslcert", dbConf.SSLCert},
+		{"sslkey", dbConf.SSLKey},
+	} {
+		if !util.StrNotSet(field.value) {
+			conflicts = append(conflicts, field.key)
+		}
+	}
+
+	if len(conflicts) != 0 {
+		return fmt.Errorf("database url is set but %s differ from it, leave them unset or set them in the url", strings.Join(conflicts, ", "))
+	}
+
 	return nil
 }
 
+// Address returns the host and port of the database for logging, read from the URL when it is set
+func (dbConf Database) Address() string {
+	if util.StrNotSet(dbConf.URL) {
+		return net.JoinHostPort(dbConf.Host, dbConf.Port)
+	}
+
+	urlConf, err := pgconn.ParseConfig(dbConf.URL)
+	if err != nil {
+		return "the database url"
+	}
+	return net.JoinHostPort(urlConf.Host, strconv.Itoa(int(urlConf.Port)))
+}
+
+// ValidateSSLMode checks the mode is a PostgreSQL sslmode, an empty mode is disable
+func ValidateSSLMode(mode string) error {
+	if mode == "" || slices.Contains(SSLModes, mode) {
+		return nil
+	}
+	return fmt.Errorf("database sslmode %q is invalid, must be one of %s", mode, strings.Join(SSLModes, ", "))
+}
+
 func validateProbeConf(probeConf Probe) (Probe, error) {
 	if util.StrNotSet(probeConf.RPC) {
 		return probeConf, errors.New("probe rpc must be set")
 	}
-	// add port if not set
-	if strings.Count(probeConf.RPC, ":") != 2 {
-		if strings.HasPrefix(probeConf.RPC, "https:") {
-			probeConf.RPC = fmt.Sprintf("%s:443", probeConf.RPC)
-		} else if strings.HasPrefix(probeConf.RPC, "http:") {
-			probeConf.RPC = fmt.Sprintf("%s:80", probeConf.RPC)
+	probeConf.RPC = addRPCPort(probeConf.RPC)
+
+	fallbacks := make([]RPCEndpoint, 0, len(probeConf.RPCFallbacks))
+	for _, fallback := range probeConf.RPCFallbacks {
+		if util.StrNotSet(fallback.Address) {
+			return probeConf, errors.New("probe rpc-fallbacks must not contain empty endpoints")
+		}
+		if (fallback.RequestsPerSecond != nil && *fallback.RequestsPerSecond < 0) || (fallback.Burst != nil && *fallback.Burst < 0) {
+			return probeConf, fmt.Errorf("probe rpc-fallbacks: rps and burst of %s must not be negative", fallback.Address)
 		}
+		fallback.Address = addRPCPort(fallback.Address)
+		fallbacks = append(fallbacks, fallback)
+	}
+	probeConf.RPCFallbacks = fallbacks
+
+	// The chains list is not read through the flags, unset values take the defaults of the flags
+	if probeConf.RPCMaxFailures == 0 {
+		probeConf.RPCMaxFailures = DefaultRPCMaxFailures
+	}
+	if probeConf.RPCMaxLag == 0 {
+		probeConf.RPCMaxLag = DefaultRPCMaxLag
+	}
+	if probeConf.RPCHealthInterval == 0 {
+		probeConf.RPCHealthInterval = DefaultRPCHealthInterval
+	}
+	if probeConf.RPCMaxFailures < 0 || probeConf.RPCMaxLag < 0 || probeConf.RPCHealthInterval < 0 {
+		return probeConf, errors.New("probe rpc-max-failures, rpc-max-lag and rpc-health-interval must not be negative")
+	}
+	if probeConf.RPCRequestsPerSecond < 0 || probeConf.RPCBurst < 0 {
+		return probeConf, errors.New("probe rpc-requests-per-second and rpc-burst must not be negative")
 	}
 
 	if util.StrNotSet(probeConf.AccountPrefix) {
@@ -110,9 +408,24 @@ func validateProbeConf(probeConf Probe) (Probe, error) {
 	if util.StrNotSet(probeConf.ChainName) {
 		return probeConf, errors.New("probe chain-name must be set")
 	}
+	if probeConf.Network != "" && probeConf.Network != NetworkMainnet && probeConf.Network != NetworkTestnet {
+		return probeConf, fmt.Errorf("probe network must be %s or %s", NetworkMainnet, NetworkTestnet)
+	}
 	return probeConf, nil
 }
 
+// addRPCPort adds the default port of the scheme to an RPC endpoint without a port
+func addRPCPort(rpc string) string {
+	if strings.Count(rpc, ":") != 2 {
+		if strings.HasPrefix(rpc, "https:") {
+			return fmt.Sprintf("%s:443", rpc)
+		} else if strings.HasPrefix(rpc, "http:") {
+			return fmt.Sprintf("%s:80", rpc)
+		}
+	}
+	return rpc
+}
+
 func validateThrottlingConf(throttlingConf throttlingBase) error {
 	if throttlingConf.Throttling < 0 {
 		return errors.New("throttling must be a positive number or 0")
@@ -152,6 +465,18 @@ func addDatabaseConfigKeys(validKeys map[string]struct{}) {
 	}
 }
 
+func addSecondaryDatabaseConfigKeys(validKeys map[string]struct{}) {
+	for _, key := range getValidConfigKeys(Database{}, "secondary-database") {
+		validKeys[key] = struct{}{}
+	}
+}
+
+func addReadReplicaConfigKeys(validKeys map[string]struct{}) {
+	for _, key := range getValidConfigKeys(Database{}, "read-replica") {
+		validKeys[key] = struct{}{}
+	}
+}
+
 func addLogConfigKeys(validKeys map[string]struct{}) {
 	for _, key := range getValidConfigKeys(log{}, "") {
 		validKeys[key] = struct{}{}
@@ -4,16 +4,27 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/DefiantLabs/cosmos-indexer/util"
 	"github.com/spf13/cobra"
 )
 
 type IndexConfig struct {
-	Database Database
-	Base     indexBase
-	Log      log
-	Probe    Probe
-	Flags    flags
+	Database          Database
+	SecondaryDatabase Database
+	ReadReplica       Database
+	Base              indexBase
+	Log               log
+	Probe             Probe
+	Flags             flags
+	Watchlist         watchlist
+	Metrics           metrics
+	Tracing           tracing
+	Kafka             Kafka
+	Retention         retention
+	Chains            []ChainConfig // Chains indexed next to each other instead of the chain of the probe section, see MultiChain
+	Webhooks          []Webhook     // Webhooks notified of the indexed blocks and failures
 }
 
 type indexBase struct {
@@ -21,11 +32,25 @@ type indexBase struct {
 	retryBase
 	ReindexMessageType         string `mapstructure:"reindex-message-type"`
 	ReattemptFailedBlocks      bool   `mapstructure:"reattempt-failed-blocks"`
+	QuarantineAfterAttempts    int64  `mapstructure:"quarantine-after-attempts"`
+	FinalityLag                int64  `mapstructure:"finality-lag"`
+	Follow                     string `mapstructure:"follow"`
+	FollowTimeout              int64  `mapstructure:"follow-timeout"`
 	StartBlock                 int64  `mapstructure:"start-block"`
 	EndBlock                   int64  `mapstructure:"end-block"`
+	AllowPruned                bool   `mapstructure:"allow-pruned"`
 	BlockInputFile             string `mapstructure:"block-input-file"`
 	ReIndex                    bool   `mapstructure:"reindex"`
+	ReindexReplace             bool   `mapstructure:"reindex-replace"`
+	ReprocessFailedTxs         bool   `mapstructure:"reprocess-failed-txs"`
 	RPCWorkers                 int64  `mapstructure:"rpc-workers"`
+	RPCRateLimit               int64  `mapstructure:"rpc-rate-limit"`
+	RPCRetryMaxElapsed         int64  `mapstructure:"rpc-retry-max-elapsed"`
+	GapBackfill                bool   `mapstructure:"gap-backfill"`
+	GapRPCWorkers              int64  `mapstructure:"gap-rpc-workers"`
+	GapRateLimit               int64  `mapstructure:"gap-rate-limit"`
+	BlockBatchSize             int64  `mapstructure:"block-batch-size"`
+	ShutdownTimeout            int64  `mapstructure:"shutdown-timeout"`
 	BlockTimer                 int64  `mapstructure:"block-timer"`
 	WaitForChain               bool   `mapstructure:"wait-for-chain"`
 	WaitForChainDelay          int64  `mapstructure:"wait-for-chain-delay"`
@@ -33,34 +58,137 @@ type indexBase struct {
 	ExitWhenCaughtUp           bool   `mapstructure:"exit-when-caught-up"`
 	BlockEventIndexingEnabled  bool   `mapstructure:"index-block-events"`
 	FilterFile                 string `mapstructure:"filter-file"`
+	RangeProfilesFile          string `mapstructure:"range-profiles-file"`
+	ApplyProfileChanges        bool   `mapstructure:"apply-profile-changes"`
 	Dry                        bool   `mapstructure:"dry"`
+	Force                      bool   `mapstructure:"force"`
 }
 
+// How the indexer learns about new blocks once it reached the latest block of the node
+const (
+	FollowPoll      = "poll"      // query the latest height of the node
+	FollowWebsocket = "websocket" // subscribe to new block headers over the websocket of the node, polling while it is down
+)
+
+// Policies for event attribute values that contain null bytes or invalid UTF-8, which PostgreSQL rejects in text columns
+const (
+	InvalidTextPolicySanitize = "sanitize" // strip null bytes and replace invalid UTF-8 sequences
+	InvalidTextPolicyBytea    = "bytea"    // sanitize the text value and keep the original bytes in an overflow column
+	InvalidTextPolicyFail     = "fail"     // fail the block
+)
+
+// Encodings of block event attribute keys and values in the block results returned by the RPC
+const (
+	AttributeEncodingPlain  = "plain"
+	AttributeEncodingBase64 = "base64" // CometBFT versions before 0.37 base64 encode attribute keys and values
+	AttributeEncodingAuto   = "auto"   // detect the encoding of each event
+)
+
+// Policies for block event attributes that cannot be decoded with the configured encoding
+const (
+	UnrecognizedAttributePolicyQuarantine = "quarantine" // skip the attribute, index the rest of the block and keep a sample of the raw attribute
+	UnrecognizedAttributePolicyFail       = "fail"       // fail the block
+)
+
 // Flags for specific, deeper indexing behavior
 type flags struct {
-	IndexTxMessageRaw        bool `mapstructure:"index-tx-message-raw"`
-	BlockEventsBase64Encoded bool `mapstructure:"block-events-base64-encoded"`
+	IndexTxMessageRaw            bool   `mapstructure:"index-tx-message-raw"`
+	BlockEventsBase64Encoded     bool   `mapstructure:"block-events-base64-encoded"`
+	BlockEventsAttributeEncoding string `mapstructure:"block-events-attribute-encoding"`
+	UnrecognizedAttributePolicy  string `mapstructure:"unrecognized-attribute-policy"`
+	AttributeQuarantineSampleCap int64  `mapstructure:"attribute-quarantine-sample-cap"`
+	InvalidTextPolicy            string `mapstructure:"invalid-text-policy"`
+	TxErrorMaxLength             int64  `mapstructure:"tx-error-max-length"`
+	IndexBlockSignatures         bool   `mapstructure:"index-block-signatures"`
+	StoreMessageBodies           bool   `mapstructure:"store-message-bodies"`
+	ResolveIBCDenoms             bool   `mapstructure:"resolve-ibc-denoms"`
+}
+
+// Watched addresses are indexed in full and trigger webhook notifications, membership is stored in the DB
+type watchlist struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	ReloadInterval int64  `mapstructure:"reload-interval"`
+	WebhookURL     string `mapstructure:"webhook-url"`
+}
+
+// Prometheus metrics of the indexer, served on /metrics when a port is set
+type metrics struct {
+	Port string `mapstructure:"port"`
+}
+
+// Retention policy pruning the tx data and block events of old blocks, disabled when neither blocks nor days is set
+type retention struct {
+	Blocks    int64 `mapstructure:"blocks"`
+	Days      int64 `mapstructure:"days"`
+	Interval  int64 `mapstructure:"interval"`
+	ChunkSize int64 `mapstructure:"chunk-size"`
+}
+
+// OpenTelemetry tracing of the indexing of blocks, exported over OTLP when an endpoint is set
+type tracing struct {
+	OTLPEndpoint string `mapstructure:"otlp-endpoint"`
+	Insecure     bool   `mapstructure:"insecure"`
+}
+
+// Kafka topic a message is published to for every block committed to the database, disabled when no brokers are set
+type Kafka struct {
+	Brokers               []string `mapstructure:"brokers"`
+	Topic                 string   `mapstructure:"topic"`
+	TLS                   bool     `mapstructure:"tls"`
+	TLSCAFile             string   `mapstructure:"tls-ca-file"`
+	TLSCertFile           string   `mapstructure:"tls-cert-file"`
+	TLSKeyFile            string   `mapstructure:"tls-key-file"`
+	TLSInsecureSkipVerify bool     `mapstructure:"tls-insecure-skip-verify"`
+	SASLMechanism         string   `mapstructure:"sasl-mechanism"`
+	SASLUsername          string   `mapstructure:"sasl-username"`
+	SASLPassword          string   `mapstructure:"sasl-password"`
+	BufferSize            int64    `mapstructure:"buffer-size"`
+	MaxAttempts           int64    `mapstructure:"max-attempts"`
 }
 
+// SASL mechanisms of the Kafka brokers
+const (
+	KafkaSASLPlain       = "plain"
+	KafkaSASLSCRAMSHA256 = "scram-sha-256"
+	KafkaSASLSCRAMSHA512 = "scram-sha-512"
+)
+
 func SetupIndexSpecificFlags(conf *IndexConfig, cmd *cobra.Command) {
 	// chain indexing
 	cmd.PersistentFlags().Int64Var(&conf.Base.StartBlock, "base.start-block", 0, "block to start indexing at (use -1 to resume from highest block indexed)")
 	cmd.PersistentFlags().Int64Var(&conf.Base.EndBlock, "base.end-block", -1, "block to stop indexing at (use -1 to index indefinitely")
 	cmd.PersistentFlags().StringVar(&conf.Base.BlockInputFile, "base.block-input-file", "", "A file location containing a JSON list of block heights to index. Will override start and end block flags.")
 	cmd.PersistentFlags().BoolVar(&conf.Base.ReIndex, "base.reindex", false, "if true, this will re-attempt to index blocks we have already indexed (defaults to false)")
+	cmd.PersistentFlags().BoolVar(&conf.Base.ReindexReplace, "base.reindex-replace", false, "if true, the messages, events, attributes and fees of a block already indexed are deleted before it is indexed again, instead of upserting the new data over them")
 	cmd.PersistentFlags().BoolVar(&conf.Base.ReattemptFailedBlocks, "base.reattempt-failed-blocks", false, "re-enqueue failed blocks for reattempts at startup.")
+	cmd.PersistentFlags().Int64Var(&conf.Base.QuarantineAfterAttempts, "base.quarantine-after-attempts", 0, "quarantine failed blocks after this many failed attempts, so they are no longer reattempted or enqueued (0 to never quarantine)")
+	cmd.PersistentFlags().Int64Var(&conf.Base.FinalityLag, "base.finality-lag", 0, "number of blocks to stay behind the latest block when following the chain, so blocks that may still be reorged are not indexed")
+	cmd.PersistentFlags().StringVar(&conf.Base.Follow, "base.follow", FollowPoll, "how new blocks are followed once caught up, poll or websocket")
+	cmd.PersistentFlags().Int64Var(&conf.Base.FollowTimeout, "base.follow-timeout", 30, "seconds without a new block over the websocket after which it is considered dropped and the node is polled until it is subscribed again")
+	cmd.PersistentFlags().BoolVar(&conf.Base.ReprocessFailedTxs, "base.reprocess-failed-txs", false, "if true, the block enqueue method will reindex the blocks between start and end block with failed txs or messages that now decode, e.g. after adding or fixing their proto definitions")
 	cmd.PersistentFlags().StringVar(&conf.Base.ReindexMessageType, "base.reindex-message-type", "", "a Cosmos message type URL. When set, the block enqueue method will reindex all blocks between start and end block that contain this message type.")
 	// block event indexing
 	cmd.PersistentFlags().BoolVar(&conf.Base.TransactionIndexingEnabled, "base.index-transactions", false, "enable transaction indexing?")
 	cmd.PersistentFlags().BoolVar(&conf.Base.BlockEventIndexingEnabled, "base.index-block-events", false, "enable block beginblocker and endblocker event indexing?")
 	// filter configs
 	cmd.PersistentFlags().StringVar(&conf.Base.FilterFile, "base.filter-file", "", "path to a file containing a JSON config of block event and message type filters to apply to beginblocker events, endblocker events and TX messages")
+	cmd.PersistentFlags().StringVar(&conf.Base.RangeProfilesFile, "base.range-profiles-file", "", "path to a file containing a JSON config of height ranges indexed with their own datasets, raw storage and filters")
+	cmd.PersistentFlags().BoolVar(&conf.Base.ApplyProfileChanges, "base.apply-profile-changes", false, "reindex blocks that were indexed with a different range profile than the one now configured for their height")
 	// other base setting
 	cmd.PersistentFlags().BoolVar(&conf.Base.Dry, "base.dry", false, "index the chain but don't insert data in the DB.")
+	cmd.PersistentFlags().BoolVar(&conf.Base.Force, "base.force", false, "start indexing even when another indexer holds the lock of the chain. Only use it when the other indexer is known to be stopped.")
 	cmd.PersistentFlags().Int64Var(&conf.Base.RPCWorkers, "base.rpc-workers", 1, "the number of concurrent RPC request workers to spin up.")
+	cmd.PersistentFlags().Int64Var(&conf.Base.RPCRateLimit, "base.rpc-rate-limit", 0, "the maximum number of blocks fetched per second by each RPC worker (0 for no limit)")
+	cmd.PersistentFlags().BoolVar(&conf.Base.GapBackfill, "base.gap-backfill", false, "if true, follow the chain from the highest indexed block while a separate, lower priority pipeline indexes the missing heights below it")
+	cmd.PersistentFlags().Int64Var(&conf.Base.GapRPCWorkers, "base.gap-rpc-workers", 1, "the number of concurrent RPC request workers of the gap backfill")
+	cmd.PersistentFlags().Int64Var(&conf.Base.GapRateLimit, "base.gap-rate-limit", 5, "the maximum number of blocks fetched per second by each RPC worker of the gap backfill (0 for no limit)")
+	cmd.PersistentFlags().Int64Var(&conf.Base.RPCRetryMaxElapsed, "base.rpc-retry-max-elapsed", 30, "seconds to retry the transient errors of the RPC requests fetching a block, with exponential backoff, before the block is recorded as failed (0 to not retry)")
+	cmd.PersistentFlags().Int64Var(&conf.Base.BlockBatchSize, "base.block-batch-size", 1, "the maximum number of blocks whose transactions are indexed in one database transaction. Batches are made of the blocks already waiting to be written, so blocks are still written one by one once caught up.")
+	cmd.PersistentFlags().Int64Var(&conf.Base.ShutdownTimeout, "base.shutdown-timeout", 30, "seconds to keep writing the blocks already fetched after SIGTERM or an interrupt before rolling back the writes in flight (0 to roll back right away)")
 	cmd.PersistentFlags().BoolVar(&conf.Base.WaitForChain, "base.wait-for-chain", false, "wait for chain to be in sync?")
 	cmd.PersistentFlags().Int64Var(&conf.Base.WaitForChainDelay, "base.wait-for-chain-delay", 10, "seconds to wait between each check for node to catch up to the chain")
 	cmd.PersistentFlags().Int64Var(&conf.Base.BlockTimer, "base.block-timer", 10000, "print out how long it takes to process this many blocks")
+	cmd.PersistentFlags().BoolVar(&conf.Base.AllowPruned, "base.allow-pruned", false, "if true, start from the earliest block of the RPC node when the start block was pruned by the node and record the skipped heights as unavailable, instead of failing")
 	cmd.PersistentFlags().BoolVar(&conf.Base.ExitWhenCaughtUp, "base.exit-when-caught-up", false, "Gets the latest block at runtime and exits when this block has been reached.")
 	cmd.PersistentFlags().Int64Var(&conf.Base.RequestRetryAttempts, "base.request-retry-attempts", 0, "number of RPC query retries to make")
 	cmd.PersistentFlags().Uint64Var(&conf.Base.RequestRetryMaxWait, "base.request-retry-max-wait", 30, "max retry incremental backoff wait time in seconds")
@@ -68,6 +196,46 @@ func SetupIndexSpecificFlags(conf *IndexConfig, cmd *cobra.Command) {
 	// flags
 	cmd.PersistentFlags().BoolVar(&conf.Flags.IndexTxMessageRaw, "flags.index-tx-message-raw", false, "if true, this will index the raw message bytes. This will significantly increase the size of the database.")
 	cmd.PersistentFlags().BoolVar(&conf.Flags.BlockEventsBase64Encoded, "flags.block-events-base64-encoded", false, "if true, decode the block event attributes and keys as base64. Some versions of CometBFT encode the block event attributes and keys as base64 in the response from RPC.")
+	cmd.PersistentFlags().StringVar(&conf.Flags.BlockEventsAttributeEncoding, "flags.block-events-attribute-encoding", "", "encoding of block event attribute keys and values: plain, base64 or auto (detect per event). Defaults to base64 when flags.block-events-base64-encoded is set, otherwise plain.")
+	cmd.PersistentFlags().StringVar(&conf.Flags.UnrecognizedAttributePolicy, "flags.unrecognized-attribute-policy", UnrecognizedAttributePolicyQuarantine, "what to do with block event attributes that cannot be decoded: quarantine (skip them and keep a sample) or fail")
+	cmd.PersistentFlags().Int64Var(&conf.Flags.AttributeQuarantineSampleCap, "flags.attribute-quarantine-sample-cap", 100, "maximum number of quarantined attribute samples kept per chain and event type")
+	cmd.PersistentFlags().StringVar(&conf.Flags.InvalidTextPolicy, "flags.invalid-text-policy", InvalidTextPolicySanitize, "how to store event attribute values containing null bytes or invalid UTF-8: sanitize, bytea (sanitize and keep the original bytes) or fail")
+	cmd.PersistentFlags().Int64Var(&conf.Flags.TxErrorMaxLength, "flags.tx-error-max-length", 2048, "maximum length in bytes of the error message stored for failed txs, longer raw logs are truncated (0 for no limit)")
+	cmd.PersistentFlags().BoolVar(&conf.Flags.IndexBlockSignatures, "flags.index-block-signatures", false, "if true, index which validators signed the last commit of every block. Adds a row per validator and block.")
+	cmd.PersistentFlags().BoolVar(&conf.Flags.StoreMessageBodies, "flags.store-message-bodies", false, "if true, store the decoded body of every message as JSON in the messages value column. This will significantly increase the size of the database.")
+	cmd.PersistentFlags().BoolVar(&conf.Flags.ResolveIBCDenoms, "flags.resolve-ibc-denoms", false, "if true, query the denom trace of every new ibc/ fee denom from the chain and store it in the ibc_denoms table")
+
+	// watchlist
+	cmd.PersistentFlags().BoolVar(&conf.Watchlist.Enabled, "watchlist.enabled", false, "if true, txs involving addresses on the watchlist are indexed in full regardless of the message type filters")
+	cmd.PersistentFlags().Int64Var(&conf.Watchlist.ReloadInterval, "watchlist.reload-interval", 60, "seconds between reloads of the watchlist from the database")
+	cmd.PersistentFlags().StringVar(&conf.Watchlist.WebhookURL, "watchlist.webhook-url", "", "URL to POST a notification to whenever a tx involving a watched address is indexed")
+
+	// metrics
+	cmd.PersistentFlags().StringVar(&conf.Metrics.Port, "metrics.port", "", "port to serve Prometheus metrics on at /metrics, metrics are not served if unset")
+
+	// tracing
+	cmd.PersistentFlags().StringVar(&conf.Tracing.OTLPEndpoint, "tracing.otlp-endpoint", "", "OTLP gRPC endpoint to export traces of the indexed blocks to, like localhost:4317. Traces are not recorded if unset.")
+	cmd.PersistentFlags().BoolVar(&conf.Tracing.Insecure, "tracing.insecure", false, "if true, export traces to the OTLP endpoint without TLS")
+
+	// kafka
+	cmd.PersistentFlags().StringSliceVar(&conf.Kafka.Brokers, "kafka.brokers", nil, "Kafka brokers to publish a message to for every block committed to the database, like localhost:9092. Blocks are not published if unset.")
+	cmd.PersistentFlags().StringVar(&conf.Kafka.Topic, "kafka.topic", "", "Kafka topic the block messages are published to")
+	cmd.PersistentFlags().BoolVar(&conf.Kafka.TLS, "kafka.tls", false, "if true, connect to the Kafka brokers over TLS")
+	cmd.PersistentFlags().StringVar(&conf.Kafka.TLSCAFile, "kafka.tls-ca-file", "", "path to the CA certificate used to verify the Kafka brokers, the system roots are used if unset")
+	cmd.PersistentFlags().StringVar(&conf.Kafka.TLSCertFile, "kafka.tls-cert-file", "", "path to the client certificate presented to the Kafka brokers")
+	cmd.PersistentFlags().StringVar(&conf.Kafka.TLSKeyFile, "kafka.tls-key-file", "", "path to the client certificate key")
+	cmd.PersistentFlags().BoolVar(&conf.Kafka.TLSInsecureSkipVerify, "kafka.tls-insecure-skip-verify", false, "if true, the certificates of the Kafka brokers are not verified")
+	cmd.PersistentFlags().StringVar(&conf.Kafka.SASLMechanism, "kafka.sasl-mechanism", "", "SASL mechanism to authenticate to the Kafka brokers with: plain, scram-sha-256 or scram-sha-512. No authentication if unset.")
+	cmd.PersistentFlags().StringVar(&conf.Kafka.SASLUsername, "kafka.sasl-username", "", "SASL username")
+	cmd.PersistentFlags().StringVar(&conf.Kafka.SASLPassword, "kafka.sasl-password", "", "SASL password")
+	cmd.PersistentFlags().Int64Var(&conf.Kafka.BufferSize, "kafka.buffer-size", 1000, "number of committed blocks waiting to be published to Kafka, blocks committed while the buffer is full are not published")
+	cmd.PersistentFlags().Int64Var(&conf.Kafka.MaxAttempts, "kafka.max-attempts", 10, "number of attempts to write a block message to Kafka, with exponential backoff, before it is dropped")
+
+	// retention
+	cmd.PersistentFlags().Int64Var(&conf.Retention.Blocks, "retention.blocks", 0, "number of most recent blocks to keep the txs, messages and block events of, older blocks are pruned (0 to keep all)")
+	cmd.PersistentFlags().Int64Var(&conf.Retention.Days, "retention.days", 0, "number of days to keep the txs, messages and block events of blocks for, older blocks are pruned (0 to keep all)")
+	cmd.PersistentFlags().Int64Var(&conf.Retention.Interval, "retention.interval", 3600, "seconds between prunes of the blocks outside the retention policy")
+	cmd.PersistentFlags().Int64Var(&conf.Retention.ChunkSize, "retention.chunk-size", 100, "number of blocks pruned per database transaction")
 }
 
 func (conf *IndexConfig) Validate() error {
@@ -76,15 +244,45 @@ func (conf *IndexConfig) Validate() error {
 		return err
 	}
 
-	probeConf := conf.Probe
+	return conf.ValidateWithoutDatabase()
+}
 
-	probeConf, err = validateProbeConf(probeConf)
+// ValidateWithoutDatabase validates the config except the database section, for the runs that do not connect to the
+// primary database like dry runs
+func (conf *IndexConfig) ValidateWithoutDatabase() error {
+	var err error
 
-	if err != nil {
-		return err
+	// The secondary database is optional and only validated when dual write mode is enabled
+	if conf.SecondaryDatabaseEnabled() {
+		err = validateDatabaseConf(conf.SecondaryDatabase)
+		if err != nil {
+			return fmt.Errorf("secondary-database: %w", err)
+		}
+	}
+
+	if conf.ReadReplicaEnabled() {
+		err = validateDatabaseConf(conf.ReadReplica)
+		if err != nil {
+			return fmt.Errorf("read-replica: %w", err)
+		}
 	}
 
-	conf.Probe = probeConf
+	if conf.MultiChain() {
+		err = conf.validateChains()
+		if err != nil {
+			return err
+		}
+	} else {
+		probeConf := conf.Probe
+
+		probeConf, err = validateProbeConf(probeConf)
+
+		if err != nil {
+			return err
+		}
+
+		conf.Probe = probeConf
+	}
 
 	err = validateThrottlingConf(conf.Base.throttlingBase)
 
@@ -96,8 +294,8 @@ func (conf *IndexConfig) Validate() error {
 		return errors.New("must enable at least one of base.index-transactions or base.index-block-events")
 	}
 
-	// Check for required configs when base indexer is enabled
-	if conf.Base.TransactionIndexingEnabled || conf.Base.BlockEventIndexingEnabled {
+	// Check for required configs when base indexer is enabled, the heights of the chains are checked with the chains
+	if (conf.Base.TransactionIndexingEnabled || conf.Base.BlockEventIndexingEnabled) && !conf.MultiChain() {
 		if conf.Base.StartBlock == 0 {
 			return errors.New("base.start-block must be set when index-chain is enabled")
 		}
@@ -106,6 +304,136 @@ func (conf *IndexConfig) Validate() error {
 		}
 	}
 
+	if conf.Flags.InvalidTextPolicy == "" {
+		conf.Flags.InvalidTextPolicy = InvalidTextPolicySanitize
+	}
+
+	switch conf.Flags.InvalidTextPolicy {
+	case InvalidTextPolicySanitize, InvalidTextPolicyBytea, InvalidTextPolicyFail:
+	default:
+		return fmt.Errorf("flags.invalid-text-policy must be one of %s, %s or %s", InvalidTextPolicySanitize, InvalidTextPolicyBytea, InvalidTextPolicyFail)
+	}
+
+	switch {
+	case conf.Flags.BlockEventsAttributeEncoding == "" && conf.Flags.BlockEventsBase64Encoded:
+		conf.Flags.BlockEventsAttributeEncoding = AttributeEncodingBase64
+	case conf.Flags.BlockEventsAttributeEncoding == "":
+		conf.Flags.BlockEventsAttributeEncoding = AttributeEncodingPlain
+	case conf.Flags.BlockEventsBase64Encoded && conf.Flags.BlockEventsAttributeEncoding != AttributeEncodingBase64:
+		return fmt.Errorf("flags.block-events-base64-encoded conflicts with flags.block-events-attribute-encoding %s", conf.Flags.BlockEventsAttributeEncoding)
+	}
+
+	switch conf.Flags.BlockEventsAttributeEncoding {
+	case AttributeEncodingPlain, AttributeEncodingBase64, AttributeEncodingAuto:
+	default:
+		return fmt.Errorf("flags.block-events-attribute-encoding must be one of %s, %s or %s", AttributeEncodingPlain, AttributeEncodingBase64, AttributeEncodingAuto)
+	}
+
+	if conf.Flags.UnrecognizedAttributePolicy == "" {
+		conf.Flags.UnrecognizedAttributePolicy = UnrecognizedAttributePolicyQuarantine
+	}
+
+	switch conf.Flags.UnrecognizedAttributePolicy {
+	case UnrecognizedAttributePolicyQuarantine, UnrecognizedAttributePolicyFail:
+	default:
+		return fmt.Errorf("flags.unrecognized-attribute-policy must be one of %s or %s", UnrecognizedAttributePolicyQuarantine, UnrecognizedAttributePolicyFail)
+	}
+
+	if conf.Base.QuarantineAfterAttempts < 0 {
+		return errors.New("base.quarantine-after-attempts must not be negative")
+	}
+
+	if conf.Base.FinalityLag < 0 {
+		return errors.New("base.finality-lag must not be negative")
+	}
+
+	if conf.Base.Follow == "" {
+		conf.Base.Follow = FollowPoll
+	}
+
+	switch conf.Base.Follow {
+	case FollowPoll:
+	case FollowWebsocket:
+		if conf.Base.FollowTimeout <= 0 {
+			return errors.New("base.follow-timeout must be positive")
+		}
+	default:
+		return fmt.Errorf("base.follow must be one of %s or %s", FollowPoll, FollowWebsocket)
+	}
+
+	if conf.Base.RPCRateLimit < 0 {
+		return errors.New("base.rpc-rate-limit must not be negative")
+	}
+
+	if conf.Base.GapBackfill {
+		switch {
+		case conf.Base.ReIndex:
+			return errors.New("base.gap-backfill cannot be used with base.reindex, it only indexes the missing heights")
+		case conf.Base.BlockInputFile != "" || conf.Base.ReindexMessageType != "" || conf.Base.ReprocessFailedTxs:
+			return errors.New("base.gap-backfill cannot be used with base.block-input-file, base.reindex-message-type or base.reprocess-failed-txs")
+		}
+	}
+
+	if conf.Base.GapRPCWorkers < 0 {
+		return errors.New("base.gap-rpc-workers must not be negative")
+	}
+
+	if conf.Base.GapRateLimit < 0 {
+		return errors.New("base.gap-rate-limit must not be negative")
+	}
+
+	if conf.Base.RPCRetryMaxElapsed < 0 {
+		return errors.New("base.rpc-retry-max-elapsed must not be negative")
+	}
+
+	if conf.Base.BlockBatchSize < 0 {
+		return errors.New("base.block-batch-size must not be negative")
+	}
+
+	if conf.Base.ShutdownTimeout < 0 {
+		return errors.New("base.shutdown-timeout must not be negative")
+	}
+
+	if conf.Flags.AttributeQuarantineSampleCap < 0 {
+		return errors.New("flags.attribute-quarantine-sample-cap must not be negative")
+	}
+
+	if conf.Flags.TxErrorMaxLength < 0 {
+		return errors.New("flags.tx-error-max-length must not be negative")
+	}
+
+	if conf.Watchlist.Enabled && conf.Watchlist.ReloadInterval <= 0 {
+		return errors.New("watchlist.reload-interval must be greater than 0")
+	}
+
+	if conf.Retention.Blocks < 0 || conf.Retention.Days < 0 {
+		return errors.New("retention.blocks and retention.days must not be negative")
+	}
+
+	if conf.Retention.Blocks != 0 && conf.Retention.Days != 0 {
+		return errors.New("only one of retention.blocks and retention.days can be set")
+	}
+
+	if conf.RetentionEnabled() && (conf.Retention.Interval <= 0 || conf.Retention.ChunkSize <= 0) {
+		return errors.New("retention.interval and retention.chunk-size must be greater than 0")
+	}
+
+	if conf.KafkaEnabled() {
+		if err := validateKafkaConf(conf.Kafka); err != nil {
+			return err
+		}
+	}
+
+	if err := conf.validateWebhooks(); err != nil {
+		return err
+	}
+
+	if conf.Metrics.Port != "" {
+		if port, err := strconv.ParseUint(conf.Metrics.Port, 10, 16); err != nil || port == 0 {
+			return fmt.Errorf("metrics.port %s must be a port number between 1 and 65535", conf.Metrics.Port)
+		}
+	}
+
 	if conf.Base.FilterFile != "" {
 		// check if file exists
 		if _, err := os.Stat(conf.Base.FilterFile); os.IsNotExist(err) {
@@ -113,13 +441,71 @@ func (conf *IndexConfig) Validate() error {
 		}
 	}
 
+	if conf.Base.RangeProfilesFile != "" {
+		if _, err := os.Stat(conf.Base.RangeProfilesFile); os.IsNotExist(err) {
+			return fmt.Errorf("base.range-profiles-file %s does not exist", conf.Base.RangeProfilesFile)
+		}
+	}
+
+	return nil
+}
+
+// SecondaryDatabaseEnabled returns true if a secondary database has been configured for dual write mode
+func (conf *IndexConfig) SecondaryDatabaseEnabled() bool {
+	return !util.StrNotSet(conf.SecondaryDatabase.Host) || !util.StrNotSet(conf.SecondaryDatabase.URL)
+}
+
+// RetentionEnabled returns true if a retention policy prunes old blocks
+func (conf *IndexConfig) RetentionEnabled() bool {
+	return conf.Retention.Blocks > 0 || conf.Retention.Days > 0
+}
+
+// KafkaEnabled returns true if committed blocks are published to Kafka
+func (conf *IndexConfig) KafkaEnabled() bool {
+	return len(conf.Kafka.Brokers) != 0
+}
+
+func validateKafkaConf(kafkaConf Kafka) error {
+	if kafkaConf.Topic == "" {
+		return errors.New("kafka.topic must be set with kafka.brokers")
+	}
+
+	if (kafkaConf.TLSCAFile != "" || kafkaConf.TLSCertFile != "" || kafkaConf.TLSInsecureSkipVerify) && !kafkaConf.TLS {
+		return errors.New("kafka.tls must be set to use kafka.tls-ca-file, kafka.tls-cert-file or kafka.tls-insecure-skip-verify")
+	}
+
+	if (kafkaConf.TLSCertFile == "") != (kafkaConf.TLSKeyFile == "") {
+		return errors.New("kafka.tls-cert-file and kafka.tls-key-file must be set together")
+	}
+
+	switch kafkaConf.SASLMechanism {
+	case "":
+	case KafkaSASLPlain, KafkaSASLSCRAMSHA256, KafkaSASLSCRAMSHA512:
+		if kafkaConf.SASLUsername == "" {
+			return errors.New("kafka.sasl-username must be set with kafka.sasl-mechanism")
+		}
+	default:
+		return fmt.Errorf("kafka.sasl-mechanism must be one of %s, %s or %s", KafkaSASLPlain, KafkaSASLSCRAMSHA256, KafkaSASLSCRAMSHA512)
+	}
+
+	if kafkaConf.BufferSize <= 0 || kafkaConf.MaxAttempts <= 0 {
+		return errors.New("kafka.buffer-size and kafka.max-attempts must be greater than 0")
+	}
+
 	return nil
 }
 
+// ReadReplicaEnabled returns true if a read replica has been configured for the read only query helpers
+func (conf *IndexConfig) ReadReplicaEnabled() bool {
+	return !util.StrNotSet(conf.ReadReplica.Host) || !util.StrNotSet(conf.ReadReplica.URL)
+}
+
 func CheckSuperfluousIndexKeys(keys []string) []string {
 	validKeys := make(map[string]struct{})
 
 	addDatabaseConfigKeys(validKeys)
+	addSecondaryDatabaseConfigKeys(validKeys)
+	addReadReplicaConfigKeys(validKeys)
 	addLogConfigKeys(validKeys)
 	addProbeConfigKeys(validKeys)
 
@@ -140,6 +526,30 @@ func CheckSuperfluousIndexKeys(keys []string) []string {
 		validKeys[key] = struct{}{}
 	}
 
+	for _, key := range getValidConfigKeys(watchlist{}, "watchlist") {
+		validKeys[key] = struct{}{}
+	}
+
+	for _, key := range getValidConfigKeys(metrics{}, "metrics") {
+		validKeys[key] = struct{}{}
+	}
+
+	for _, key := range getValidConfigKeys(tracing{}, "tracing") {
+		validKeys[key] = struct{}{}
+	}
+
+	for _, key := range getValidConfigKeys(Kafka{}, "kafka") {
+		validKeys[key] = struct{}{}
+	}
+
+	for _, key := range getValidConfigKeys(retention{}, "retention") {
+		validKeys[key] = struct{}{}
+	}
+
+	// The chains and webhooks are lists of tables, their keys are not flattened
+	validKeys["chains"] = struct{}{}
+	validKeys["webhooks"] = struct{}{}
+
 	// Check keys
 	ignoredKeys := make([]string, 0)
 	for _, key := range keys {
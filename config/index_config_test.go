@@ -52,6 +52,191 @@ func (suite *IndexConfigTestSuite) TestIndexConfig() {
 	conf.Base.EndBlock = 2
 	err = conf.Validate()
 	suite.Require().NoError(err)
+
+	// Partially configured secondary databases should fail validation
+	conf.SecondaryDatabase.Host = "fake-secondary-host"
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.SecondaryDatabase = conf.Database
+	conf.SecondaryDatabase.Host = "fake-secondary-host"
+	err = conf.Validate()
+	suite.Require().NoError(err)
+	suite.Require().True(conf.SecondaryDatabaseEnabled())
+
+	// Same for read replicas
+	conf.ReadReplica.URL = "postgres://reader@fake-replica-host/fake-database?connect_timeout=5"
+	conf.ReadReplica.Password = "fake-password"
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.ReadReplica.Password = ""
+	err = conf.Validate()
+	suite.Require().NoError(err)
+	suite.Require().True(conf.ReadReplicaEnabled())
+
+	conf.Watchlist.Enabled = true
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Watchlist.ReloadInterval = 60
+	err = conf.Validate()
+	suite.Require().NoError(err)
+	suite.Require().Equal(InvalidTextPolicySanitize, conf.Flags.InvalidTextPolicy)
+
+	conf.Flags.InvalidTextPolicy = "escape"
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Flags.InvalidTextPolicy = InvalidTextPolicyBytea
+	err = conf.Validate()
+	suite.Require().NoError(err)
+	suite.Require().Equal(AttributeEncodingPlain, conf.Flags.BlockEventsAttributeEncoding)
+	suite.Require().Equal(UnrecognizedAttributePolicyQuarantine, conf.Flags.UnrecognizedAttributePolicy)
+
+	// The legacy base64 flag selects the base64 encoding and conflicts with any other
+	conf.Flags.BlockEventsAttributeEncoding = ""
+	conf.Flags.BlockEventsBase64Encoded = true
+	err = conf.Validate()
+	suite.Require().NoError(err)
+	suite.Require().Equal(AttributeEncodingBase64, conf.Flags.BlockEventsAttributeEncoding)
+
+	conf.Flags.BlockEventsAttributeEncoding = AttributeEncodingAuto
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Flags.BlockEventsBase64Encoded = false
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Flags.UnrecognizedAttributePolicy = "drop"
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Flags.UnrecognizedAttributePolicy = UnrecognizedAttributePolicyFail
+	conf.Base.QuarantineAfterAttempts = -1
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Base.QuarantineAfterAttempts = 5
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Flags.TxErrorMaxLength = -1
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Flags.TxErrorMaxLength = 0
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Base.FinalityLag = -1
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Base.FinalityLag = 2
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Base.BlockBatchSize = -1
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Base.BlockBatchSize = 50
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Base.ShutdownTimeout = -1
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Base.ShutdownTimeout = 0
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Base.GapBackfill = true
+	conf.Base.ReIndex = true
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Base.ReIndex = false
+	conf.Base.GapRateLimit = -1
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Base.GapRateLimit = 5
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Metrics.Port = "metrics"
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Metrics.Port = "65536"
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Metrics.Port = "9100"
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Retention.Blocks = 1000
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Retention.Interval = 3600
+	conf.Retention.ChunkSize = 100
+	err = conf.Validate()
+	suite.Require().NoError(err)
+	suite.Require().True(conf.RetentionEnabled())
+
+	conf.Retention.Days = 30
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Retention.Blocks = 0
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	conf.Retention.Days = -1
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Retention.Days = 0
+	conf.Kafka = Kafka{Brokers: []string{"localhost:9092"}, BufferSize: 1000, MaxAttempts: 10}
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Kafka.Topic = "blocks"
+	err = conf.Validate()
+	suite.Require().NoError(err)
+	suite.Require().True(conf.KafkaEnabled())
+
+	conf.Kafka.TLSCertFile = "client.crt"
+	conf.Kafka.TLS = true
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Kafka.TLSKeyFile = "client.key"
+	conf.Kafka.SASLMechanism = "gssapi"
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Kafka.SASLMechanism = KafkaSASLSCRAMSHA512
+	err = conf.Validate()
+	suite.Require().Error(err)
+
+	conf.Kafka.SASLUsername = "indexer"
+	err = conf.Validate()
+	suite.Require().NoError(err)
+
+	// Dry runs leave the database out
+	conf.Kafka = Kafka{}
+	conf.Database = Database{}
+	err = conf.Validate()
+	suite.Require().Error(err)
+	err = conf.ValidateWithoutDatabase()
+	suite.Require().NoError(err)
 }
 
 func (suite *IndexConfigTestSuite) TestCheckSuperfluousIndexKeys() {
@@ -65,6 +250,31 @@ func (suite *IndexConfigTestSuite) TestCheckSuperfluousIndexKeys() {
 
 	validKeys = CheckSuperfluousIndexKeys(keys)
 	suite.Require().Len(validKeys, 1)
+
+	keys = append(keys, "secondary-database.host")
+
+	validKeys = CheckSuperfluousIndexKeys(keys)
+	suite.Require().Len(validKeys, 1)
+
+	keys = append(keys, "watchlist.webhook-url")
+
+	validKeys = CheckSuperfluousIndexKeys(keys)
+	suite.Require().Len(validKeys, 1)
+
+	keys = append(keys, "tracing.otlp-endpoint")
+
+	validKeys = CheckSuperfluousIndexKeys(keys)
+	suite.Require().Len(validKeys, 1)
+
+	keys = append(keys, "retention.chunk-size")
+
+	validKeys = CheckSuperfluousIndexKeys(keys)
+	suite.Require().Len(validKeys, 1)
+
+	keys = append(keys, "kafka.sasl-mechanism")
+
+	validKeys = CheckSuperfluousIndexKeys(keys)
+	suite.Require().Len(validKeys, 1)
 }
 
 func TestIndexConfig(t *testing.T) {
@@ -10,70 +10,84 @@ import (
 	zlog "github.com/rs/zerolog/log"
 )
 
-type Logger struct{}
+type Logger struct {
+	chainID string // Added to every entry as chain_id, see WithChain
+}
 
 // Log is exposed on the config as a drop-in replacement for our old logger
 var Log *Logger
 
+// WithChain returns a logger adding the chain ID to every entry, for the logs of one of the chains indexed by the process
+func (l *Logger) WithChain(chainID string) *Logger {
+	return &Logger{chainID: chainID}
+}
+
+func (l *Logger) with(event *zerolog.Event) *zerolog.Event {
+	if l == nil || l.chainID == "" {
+		return event
+	}
+	return event.Str("chain_id", l.chainID)
+}
+
 // These functions are provided to reduce refactoring.
 func (l *Logger) Debug(msg string, err ...error) {
 	if len(err) == 1 {
-		zlog.Debug().Err(err[0]).Msg(msg)
+		l.with(zlog.Debug()).Err(err[0]).Msg(msg)
 		return
 	}
-	zlog.Debug().Msg(msg)
+	l.with(zlog.Debug()).Msg(msg)
 }
 
 func (l *Logger) Debugf(msg string, args ...interface{}) {
-	zlog.Debug().Msg(fmt.Sprintf(msg, args...))
+	l.with(zlog.Debug()).Msg(fmt.Sprintf(msg, args...))
 }
 
 func (l *Logger) Info(msg string, err ...error) {
 	if len(err) == 1 {
-		zlog.Info().Err(err[0]).Msg(msg)
+		l.with(zlog.Info()).Err(err[0]).Msg(msg)
 		return
 	}
-	zlog.Info().Msg(msg)
+	l.with(zlog.Info()).Msg(msg)
 }
 
 func (l *Logger) Infof(msg string, args ...interface{}) {
-	zlog.Info().Msg(fmt.Sprintf(msg, args...))
+	l.with(zlog.Info()).Msg(fmt.Sprintf(msg, args...))
 }
 
 func (l *Logger) Warn(msg string, err ...error) {
 	if len(err) == 1 {
-		zlog.Warn().Err(err[0]).Msg(msg)
+		l.with(zlog.Warn()).Err(err[0]).Msg(msg)
 		return
 	}
-	zlog.Warn().Msg(msg)
+	l.with(zlog.Warn()).Msg(msg)
 }
 
 func (l *Logger) Warnf(msg string, args ...interface{}) {
-	zlog.Warn().Msg(fmt.Sprintf(msg, args...))
+	l.with(zlog.Warn()).Msg(fmt.Sprintf(msg, args...))
 }
 
 func (l *Logger) Error(msg string, err ...error) {
 	if len(err) == 1 {
-		zlog.Error().Err(err[0]).Msg(msg)
+		l.with(zlog.Error()).Err(err[0]).Msg(msg)
 		return
 	}
-	zlog.Error().Msg(msg)
+	l.with(zlog.Error()).Msg(msg)
 }
 
 func (l *Logger) Errorf(msg string, args ...interface{}) {
-	zlog.Error().Msg(fmt.Sprintf(msg, args...))
+	l.with(zlog.Error()).Msg(fmt.Sprintf(msg, args...))
 }
 
 func (l *Logger) Fatal(msg string, err ...error) {
 	if len(err) == 1 {
-		zlog.Fatal().Err(err[0]).Msg(msg)
+		l.with(zlog.Fatal()).Err(err[0]).Msg(msg)
 		return
 	}
-	zlog.Fatal().Msg(msg)
+	l.with(zlog.Fatal()).Msg(msg)
 }
 
 func (l *Logger) Fatalf(msg string, args ...interface{}) {
-	zlog.Fatal().Msg(fmt.Sprintf(msg, args...))
+	l.with(zlog.Fatal()).Msg(fmt.Sprintf(msg, args...))
 }
 
 func DoConfigureLogger(logPath string, logLevel string, prettyLogging bool) {
@@ -0,0 +1,210 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// RangeProfile is the indexing configuration of a height range. Profiles can only narrow the base config, a dataset
+// must be enabled in base to be enabled in a profile.
+type RangeProfile struct {
+	Name        string `json:"name"`
+	StartHeight int64  `json:"start_height"`
+	EndHeight   int64  `json:"end_height"` // -1 for no upper bound
+	// IndexTransactions and IndexBlockEvents replace base.index-transactions and base.index-block-events in the range
+	IndexTransactions bool `json:"index_transactions"`
+	IndexBlockEvents  bool `json:"index_block_events"`
+	// IndexTxMessageRaw replaces flags.index-tx-message-raw in the range
+	IndexTxMessageRaw bool `json:"index_tx_message_raw"`
+	// FilterFile replaces base.filter-file in the range, base.filter-file is used when it is empty
+	FilterFile string `json:"filter_file"`
+}
+
+// RangeProfiles is an ordered list of non overlapping height ranges with their own indexing configuration. Heights outside
+// every range use Default, or the base config when there is no default.
+type RangeProfiles struct {
+	Ranges  []RangeProfile `json:"ranges"`
+	Default *RangeProfile  `json:"default"` // Start and end heights are not used
+}
+
+// ParseRangeProfiles parses the JSON range profiles file format. Use Validate to check the ranges against the config.
+func ParseRangeProfiles(profilesJSON []byte) (RangeProfiles, error) {
+	var profiles RangeProfiles
+
+	decoder := json.NewDecoder(bytes.NewReader(profilesJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&profiles); err != nil {
+		return profiles, err
+	}
+
+	if len(profiles.Ranges) == 0 && profiles.Default == nil {
+		return profiles, errors.New("no ranges or default profile")
+	}
+
+	return profiles, nil
+}
+
+// IsSet returns true if any range or a default profile is configured
+func (profiles RangeProfiles) IsSet() bool {
+	return len(profiles.Ranges) != 0 || profiles.Default != nil
+}
+
+// All returns the range profiles followed by the default profile
+func (profiles RangeProfiles) All() []RangeProfile {
+	all := slices.Clip(profiles.Ranges)
+	if profiles.Default != nil {
+		all = append(all, *profiles.Default)
+	}
+	return all
+}
+
+// Validate checks the profiles against the base config. Ranges must be in order and must not overlap. Without a default
+// profile the ranges must cover every height from base.start-block to base.end-block.
+func (profiles RangeProfiles) Validate(conf *IndexConfig) error {
+	names := make(map[string]struct{})
+	checkProfile := func(profile RangeProfile) error {
+		if profile.Name == "" {
+			return errors.New("range profiles must have a name")
+		}
+
+		if _, ok := names[profile.Name]; ok {
+			return fmt.Errorf("range profile name %s is used more than once", profile.Name)
+		}
+		names[profile.Name] = struct{}{}
+
+		if !profile.IndexTransactions && !profile.IndexBlockEvents {
+			return fmt.Errorf("range profile %s must index transactions, block events or both", profile.Name)
+		}
+
+		if profile.IndexTransactions && !conf.Base.TransactionIndexingEnabled {
+			return fmt.Errorf("range profile %s indexes transactions but base.index-transactions is disabled", profile.Name)
+		}
+
+		if profile.IndexBlockEvents && !conf.Base.BlockEventIndexingEnabled {
+			return fmt.Errorf("range profile %s indexes block events but base.index-block-events is disabled", profile.Name)
+		}
+
+		if profile.FilterFile != "" {
+			if _, err := os.Stat(profile.FilterFile); os.IsNotExist(err) {
+				return fmt.Errorf("range profile %s filter file %s does not exist", profile.Name, profile.FilterFile)
+			}
+		}
+
+		return nil
+	}
+
+	for i, profile := range profiles.Ranges {
+		if err := checkProfile(profile); err != nil {
+			return err
+		}
+
+		if profile.StartHeight < 1 {
+			return fmt.Errorf("range profile %s start height must be greater than 0", profile.Name)
+		}
+
+		if profile.EndHeight != -1 && profile.EndHeight < profile.StartHeight {
+			return fmt.Errorf("range profile %s end height must be -1 or at least its start height", profile.Name)
+		}
+
+		if i > 0 {
+			previous := profiles.Ranges[i-1]
+			if previous.EndHeight == -1 || profile.StartHeight <= previous.EndHeight {
+				return fmt.Errorf("range profile %s overlaps range profile %s or is out of order", profile.Name, previous.Name)
+			}
+		}
+	}
+
+	if profiles.Default != nil {
+		return checkProfile(*profiles.Default)
+	}
+
+	if gap, ok := profiles.firstUncovered(conf.Base.StartBlock, conf.Base.EndBlock); ok {
+		return fmt.Errorf("height %d is not in any range profile, cover every height from base.start-block to base.end-block or add a default profile", gap)
+	}
+
+	return nil
+}
+
+// firstUncovered returns the first height from start to end (-1 for no end) that is not in a range
+func (profiles RangeProfiles) firstUncovered(start int64, end int64) (int64, bool) {
+	height := start
+	if height < 1 {
+		height = 1
+	}
+
+	for _, profile := range profiles.Ranges {
+		if end != -1 && height > end {
+			return 0, false
+		}
+
+		if profile.EndHeight != -1 && profile.EndHeight < height {
+			continue
+		}
+
+		if profile.StartHeight > height {
+			return height, true
+		}
+
+		if profile.EndHeight == -1 {
+			return 0, false
+		}
+		height = profile.EndHeight + 1
+	}
+
+	if end != -1 && height > end {
+		return 0, false
+	}
+
+	return height, true
+}
+
+// ProfileAt returns the profile configured for the height. The second return value is false when the height is in no
+// range and there is no default profile.
+func (profiles RangeProfiles) ProfileAt(height int64) (RangeProfile, bool) {
+	for _, profile := range profiles.Ranges {
+		if height >= profile.StartHeight && (profile.EndHeight == -1 || height <= profile.EndHeight) {
+			return profile, true
+		}
+	}
+
+	if profiles.Default != nil {
+		return *profiles.Default, true
+	}
+
+	return RangeProfile{}, false
+}
+
+// Apply returns a copy of the config with the datasets and raw storage of the profile
+func (profile RangeProfile) Apply(conf IndexConfig) IndexConfig {
+	conf.Base.TransactionIndexingEnabled = profile.IndexTransactions
+	conf.Base.BlockEventIndexingEnabled = profile.IndexBlockEvents
+	conf.Flags.IndexTxMessageRaw = profile.IndexTxMessageRaw
+	return conf
+}
+
+// LoadRangeProfiles reads and validates base.range-profiles-file, the returned profiles are empty when it is not set
+func LoadRangeProfiles(conf *IndexConfig) (RangeProfiles, error) {
+	if conf.Base.RangeProfilesFile == "" {
+		return RangeProfiles{}, nil
+	}
+
+	b, err := os.ReadFile(conf.Base.RangeProfilesFile)
+	if err != nil {
+		return RangeProfiles{}, err
+	}
+
+	profiles, err := ParseRangeProfiles(b)
+	if err != nil {
+		return RangeProfiles{}, fmt.Errorf("failed to parse range profiles file %s: %w", conf.Base.RangeProfilesFile, err)
+	}
+
+	if err := profiles.Validate(conf); err != nil {
+		return RangeProfiles{}, err
+	}
+
+	return profiles, nil
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RangeProfilesTestSuite struct {
+	suite.Suite
+	conf IndexConfig
+}
+
+func (suite *RangeProfilesTestSuite) SetupTest() {
+	suite.conf = IndexConfig{}
+	suite.conf.Base.StartBlock = 1
+	suite.conf.Base.EndBlock = -1
+	suite.conf.Base.TransactionIndexingEnabled = true
+	suite.conf.Base.BlockEventIndexingEnabled = true
+}
+
+func (suite *RangeProfilesTestSuite) TestParseRangeProfiles() {
+	profiles, err := ParseRangeProfiles([]byte(`{
+		"ranges": [
+			{"name": "skeleton", "start_height": 1, "end_height": 999, "index_transactions": true},
+			{"name": "full", "start_height": 1000, "end_height": -1, "index_transactions": true, "index_block_events": true, "index_tx_message_raw": true}
+		]
+	}`))
+	suite.Require().NoError(err)
+	suite.Require().Len(profiles.Ranges, 2)
+	suite.Assert().Nil(profiles.Default)
+	suite.Assert().Equal(RangeProfile{Name: "full", StartHeight: 1000, EndHeight: -1, IndexTransactions: true, IndexBlockEvents: true, IndexTxMessageRaw: true}, profiles.Ranges[1])
+	suite.Assert().NoError(profiles.Validate(&suite.conf))
+
+	_, err = ParseRangeProfiles([]byte(`{"ranges": [{"name": "typo", "start_heigth": 1}]}`))
+	suite.Assert().Error(err)
+
+	_, err = ParseRangeProfiles([]byte(`{}`))
+	suite.Assert().Error(err)
+}
+
+func (suite *RangeProfilesTestSuite) TestValidate() {
+	skeleton := RangeProfile{Name: "skeleton", StartHeight: 1, EndHeight: 99, IndexTransactions: true}
+	full := RangeProfile{Name: "full", StartHeight: 100, EndHeight: -1, IndexTransactions: true, IndexBlockEvents: true}
+
+	suite.Assert().NoError(RangeProfiles{Ranges: []RangeProfile{skeleton, full}}.Validate(&suite.conf))
+
+	// Out of order and overlapping ranges
+	suite.Assert().Error(RangeProfiles{Ranges: []RangeProfile{full, skeleton}}.Validate(&suite.conf))
+	overlapping := full
+	overlapping.StartHeight = 99
+	suite.Assert().Error(RangeProfiles{Ranges: []RangeProfile{skeleton, overlapping}}.Validate(&suite.conf))
+
+	// Duplicate and missing names
+	duplicate := full
+	duplicate.Name = skeleton.Name
+	suite.Assert().Error(RangeProfiles{Ranges: []RangeProfile{skeleton, duplicate}}.Validate(&suite.conf))
+	unnamed := full
+	unnamed.Name = ""
+	suite.Assert().Error(RangeProfiles{Ranges: []RangeProfile{skeleton, unnamed}}.Validate(&suite.conf))
+
+	// Profiles can only narrow the base config and must index something
+	suite.conf.Base.BlockEventIndexingEnabled = false
+	suite.Assert().Error(RangeProfiles{Ranges: []RangeProfile{skeleton, full}}.Validate(&suite.conf))
+	suite.conf.Base.BlockEventIndexingEnabled = true
+	suite.Assert().Error(RangeProfiles{Ranges: []RangeProfile{{Name: "nothing", StartHeight: 1, EndHeight: -1}}}.Validate(&suite.conf))
+}
+
+func (suite *RangeProfilesTestSuite) TestValidateCoverage() {
+	early := RangeProfile{Name: "early", StartHeight: 1, EndHeight: 99, IndexTransactions: true}
+	late := RangeProfile{Name: "late", StartHeight: 200, EndHeight: 299, IndexTransactions: true}
+	fallback := RangeProfile{Name: "fallback", IndexTransactions: true}
+
+	// 100 to 199 and everything after 299 are not covered
+	err := RangeProfiles{Ranges: []RangeProfile{early, late}}.Validate(&suite.conf)
+	suite.Require().Error(err)
+	suite.Assert().Contains(err.Error(), "height 100")
+
+	// A default profile covers the rest
+	suite.Assert().NoError(RangeProfiles{Ranges: []RangeProfile{early, late}, Default: &fallback}.Validate(&suite.conf))
+
+	// Only the configured heights need to be covered
+	suite.conf.Base.StartBlock = 200
+	suite.conf.Base.EndBlock = 250
+	suite.Assert().NoError(RangeProfiles{Ranges: []RangeProfile{early, late}}.Validate(&suite.conf))
+
+	suite.conf.Base.EndBlock = 300
+	err = RangeProfiles{Ranges: []RangeProfile{early, late}}.Validate(&suite.conf)
+	suite.Require().Error(err)
+	suite.Assert().Contains(err.Error(), "height 300")
+}
+
+func (suite *RangeProfilesTestSuite) TestProfileAt() {
+	early := RangeProfile{Name: "early", StartHeight: 1, EndHeight: 99, IndexTransactions: true}
+	late := RangeProfile{Name: "late", StartHeight: 200, EndHeight: -1, IndexTransactions: true}
+	profiles := RangeProfiles{Ranges: []RangeProfile{early, late}}
+
+	profile, ok := profiles.ProfileAt(99)
+	suite.Assert().True(ok)
+	suite.Assert().Equal("early", profile.Name)
+
+	_, ok = profiles.ProfileAt(100)
+	suite.Assert().False(ok)
+
+	profile, ok = profiles.ProfileAt(1000000)
+	suite.Assert().True(ok)
+	suite.Assert().Equal("late", profile.Name)
+
+	profiles.Default = &RangeProfile{Name: "fallback", IndexTransactions: true}
+	profile, ok = profiles.ProfileAt(100)
+	suite.Assert().True(ok)
+	suite.Assert().Equal("fallback", profile.Name)
+}
+
+func (suite *RangeProfilesTestSuite) TestApply() {
+	suite.conf.Flags.IndexTxMessageRaw = false
+
+	applied := RangeProfile{Name: "skeleton", IndexTransactions: true, IndexTxMessageRaw: true}.Apply(suite.conf)
+	suite.Assert().True(applied.Base.TransactionIndexingEnabled)
+	suite.Assert().False(applied.Base.BlockEventIndexingEnabled)
+	suite.Assert().True(applied.Flags.IndexTxMessageRaw)
+
+	// The original config is not changed
+	suite.Assert().True(suite.conf.Base.BlockEventIndexingEnabled)
+	suite.Assert().False(suite.conf.Flags.IndexTxMessageRaw)
+}
+
+func TestRangeProfilesTestSuite(t *testing.T) {
+	suite.Run(t, new(RangeProfilesTestSuite))
+}
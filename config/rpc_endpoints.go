@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// RPCEndpoint is an entry of probe rpc-fallbacks. In the config file an entry is either the address of the endpoint or a
+// table with the address and the rate limit of the endpoint:
+//
+//	rpc-fallbacks = ["https://rpc.one:443", { address = "https://rpc.two:443", rps = 5, burst = 2 }]
+type RPCEndpoint struct {
+	Address           string
+	RequestsPerSecond *float64 `mapstructure:"rps"`   // probe rpc-requests-per-second when unset, 0 for no limit
+	Burst             *int64   `mapstructure:"burst"` // probe rpc-burst when unset
+}
+
+// RateLimit returns the requests per second and burst of the endpoint, the ones of the probe section when it sets none
+func (endpoint RPCEndpoint) RateLimit(probe Probe) (float64, int64) {
+	rate, burst := probe.RPCRequestsPerSecond, probe.RPCBurst
+	if endpoint.RequestsPerSecond != nil {
+		rate = *endpoint.RequestsPerSecond
+	}
+	if endpoint.Burst != nil {
+		burst = *endpoint.Burst
+	}
+	return rate, burst
+}
+
+// DecodeHook is the decode hook of the config sections read with viper UnmarshalKey, like chains. It keeps the default
+// hooks of viper and decodes the address entries of rpc-fallbacks.
+func DecodeHook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		rpcEndpointDecodeHook,
+	)
+}
+
+func rpcEndpointDecodeHook(from reflect.Type, to reflect.Type, data any) (any, error) {
+	if from.Kind() != reflect.String || to != reflect.TypeOf(RPCEndpoint{}) {
+		return data, nil
+	}
+	return RPCEndpoint{Address: data.(string)}, nil
+}
+
+// rpcEndpointsValue is the flag of probe rpc-fallbacks. On the command line it takes a comma separated list of addresses,
+// the config file value is decoded by DecodeConfigValue since its entries may be tables.
+type rpcEndpointsValue struct {
+	value   *[]RPCEndpoint
+	changed bool
+}
+
+func (v *rpcEndpointsValue) Set(val string) error {
+	addresses, err := csv.NewReader(strings.NewReader(val)).Read()
+	if err != nil {
+		return err
+	}
+
+	endpoints := make([]RPCEndpoint, 0, len(addresses))
+	for _, address := range addresses {
+		endpoints = append(endpoints, RPCEndpoint{Address: address})
+	}
+	if !v.changed {
+		*v.value = endpoints
+	} else {
+		*v.value = append(*v.value, endpoints...)
+	}
+	v.changed = true
+	return nil
+}
+
+func (v *rpcEndpointsValue) Type() string {
+	return "stringSlice"
+}
+
+func (v *rpcEndpointsValue) String() string {
+	addresses := make([]string, 0, len(*v.value))
+	for _, endpoint := range *v.value {
+		addresses = append(addresses, endpoint.Address)
+	}
+	return "[" + strings.Join(addresses, ",") + "]"
+}
+
+// DecodeConfigValue sets the endpoints to the rpc-fallbacks value of the config file
+func (v *rpcEndpointsValue) DecodeConfigValue(value any) error {
+	var endpoints []RPCEndpoint
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       DecodeHook(),
+		WeaklyTypedInput: true,
+		Result:           &endpoints,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(value); err != nil {
+		return fmt.Errorf("probe rpc-fallbacks must be a list of addresses or tables with an address: %w", err)
+	}
+
+	*v.value = endpoints
+	v.changed = true
+	return nil
+}
+
+// ConfigValueDecoder is implemented by the flags whose config file value cannot be set from its string form, BindFlags
+// passes them the value read by viper instead
+type ConfigValueDecoder interface {
+	DecodeConfigValue(value any) error
+}
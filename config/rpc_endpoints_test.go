@@ -0,0 +1,72 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func (suite *IndexConfigTestSuite) TestRPCFallbacks() {
+	viperConf := viper.New()
+	viperConf.SetConfigType("toml")
+	err := viperConf.ReadConfig(strings.NewReader(`
+[probe]
+rpc-fallbacks = ["http://rpc-one", { address = "http://rpc-two", rps = 5 }, { address = "http://rpc-three", rps = 0, burst = 3 }]
+
+[[chains]]
+rpc = "http://osmosis-rpc"
+rpc-fallbacks = ["http://osmosis-rpc-two", { address = "http://osmosis-rpc-three", burst = 4 }]
+`))
+	suite.Require().NoError(err)
+
+	// The config file value is decoded by the flag, see BindFlags
+	var probe Probe
+	cmd := &cobra.Command{}
+	SetupProbeFlags(&probe, cmd)
+	probe.RPCRequestsPerSecond = 10
+	probe.RPCBurst = 2
+
+	decoder, ok := cmd.PersistentFlags().Lookup("probe.rpc-fallbacks").Value.(ConfigValueDecoder)
+	suite.Require().True(ok)
+	suite.Require().NoError(decoder.DecodeConfigValue(viperConf.Get("probe.rpc-fallbacks")))
+	suite.Require().Len(probe.RPCFallbacks, 3)
+
+	rateLimits := [][2]any{{10.0, int64(2)}, {5.0, int64(2)}, {0.0, int64(3)}}
+	for i, endpoint := range probe.RPCFallbacks {
+		rate, burst := endpoint.RateLimit(probe)
+		suite.Require().Equal(rateLimits[i], [2]any{rate, burst}, endpoint.Address)
+	}
+	suite.Require().Equal("http://rpc-two", probe.RPCFallbacks[1].Address)
+
+	suite.Require().Error(decoder.DecodeConfigValue([]any{map[string]any{"address": "http://rpc-one", "rps": "fast"}}))
+
+	// The command line takes a list of addresses
+	var flagProbe Probe
+	cmd = &cobra.Command{}
+	SetupProbeFlags(&flagProbe, cmd)
+	suite.Require().NoError(cmd.PersistentFlags().Set("probe.rpc-fallbacks", "http://rpc-four,http://rpc-five"))
+	suite.Require().Equal([]RPCEndpoint{{Address: "http://rpc-four"}, {Address: "http://rpc-five"}}, flagProbe.RPCFallbacks)
+
+	var chains []ChainConfig
+	suite.Require().NoError(viperConf.UnmarshalKey("chains", &chains, viper.DecodeHook(DecodeHook())))
+	suite.Require().Len(chains, 1)
+	suite.Require().Len(chains[0].RPCFallbacks, 2)
+	suite.Require().Equal("http://osmosis-rpc-two", chains[0].RPCFallbacks[0].Address)
+	suite.Require().Equal(int64(4), *chains[0].RPCFallbacks[1].Burst)
+	suite.Require().Nil(chains[0].RPCFallbacks[1].RequestsPerSecond)
+
+	negative := -1.0
+	probe.RPC = "http://rpc"
+	probe.AccountPrefix = "cosmos"
+	probe.ChainID = "cosmoshub-4"
+	probe.ChainName = "cosmoshub"
+	probe.RPCFallbacks = []RPCEndpoint{{Address: "http://rpc-one", RequestsPerSecond: &negative}}
+	_, err = validateProbeConf(probe)
+	suite.Require().ErrorContains(err, "rps and burst of http://rpc-one must not be negative")
+
+	probe.RPCFallbacks = []RPCEndpoint{{Address: "http://rpc-one"}}
+	probe, err = validateProbeConf(probe)
+	suite.Require().NoError(err)
+	suite.Require().Equal("http://rpc-one:80", probe.RPCFallbacks[0].Address)
+}
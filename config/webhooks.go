@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// Webhook is one of the webhooks of the webhooks list of the config file, a URL an event is POSTed to as JSON whenever
+// one of its triggers fires
+type Webhook struct {
+	Name                  string   `mapstructure:"name"` // Identifies the webhook in the logs and metrics
+	URL                   string   `mapstructure:"url"`
+	Secret                string   `mapstructure:"secret"` // Key of the HMAC-SHA256 signature of the events, unsigned when empty
+	Triggers              []string `mapstructure:"triggers"`
+	ChainID               string   `mapstructure:"chain-id"`      // Only the events of the chain are delivered, every chain when empty
+	MessageTypes          []string `mapstructure:"message-types"` // Message types firing the message-type trigger
+	FailedBlocksThreshold int64    `mapstructure:"failed-blocks-threshold"`
+	FailedBlocksInterval  int64    `mapstructure:"failed-blocks-interval"` // Seconds between the checks of the failed-blocks trigger
+	QueueSize             int64    `mapstructure:"queue-size"`
+	MaxAttempts           int64    `mapstructure:"max-attempts"`
+	Timeout               int64    `mapstructure:"timeout"` // Seconds before a POST is abandoned
+}
+
+// The triggers of a webhook
+const (
+	WebhookTriggerBlock          = "block"           // a block is committed to the database
+	WebhookTriggerWatchedAddress = "watched-address" // a tx involving a watched address is committed to the database
+	WebhookTriggerMessageType    = "message-type"    // a tx with a message of one of the message types is committed to the database
+	WebhookTriggerFailedBlocks   = "failed-blocks"   // the failed blocks of a chain exceed the threshold
+)
+
+// WebhookTriggers are the triggers a webhook can be configured with
+var WebhookTriggers = []string{WebhookTriggerBlock, WebhookTriggerWatchedAddress, WebhookTriggerMessageType, WebhookTriggerFailedBlocks}
+
+// Defaults of the optional settings of a webhook
+const (
+	DefaultWebhookQueueSize            = 100
+	DefaultWebhookMaxAttempts          = 5
+	DefaultWebhookTimeout              = 10
+	DefaultWebhookFailedBlocksInterval = 60
+)
+
+// HasTrigger returns true if the webhook is configured with the trigger
+func (webhook Webhook) HasTrigger(trigger string) bool {
+	return slices.Contains(webhook.Triggers, trigger)
+}
+
+// ChainIDs returns the chain IDs of the chains indexed with the config, the chains of the chains list or the chain of
+// the probe section
+func (conf *IndexConfig) ChainIDs() []string {
+	if !conf.MultiChain() {
+		return []string{conf.Probe.ChainID}
+	}
+
+	chainIDs := make([]string, len(conf.Chains))
+	for i, chain := range conf.Chains {
+		chainIDs[i] = chain.ChainID
+	}
+	return chainIDs
+}
+
+// validateWebhooks validates the triggers of every webhook and fills in the defaults of their optional settings. The
+// chains are validated first, the chain ID of a webhook must be one of theirs.
+func (conf *IndexConfig) validateWebhooks() error {
+	names := make(map[string]struct{}, len(conf.Webhooks))
+	for i := range conf.Webhooks {
+		webhook := &conf.Webhooks[i]
+
+		if err := conf.validateWebhook(webhook); err != nil {
+			return fmt.Errorf("webhooks[%d]: %w", i, err)
+		}
+
+		if _, ok := names[webhook.Name]; ok {
+			return fmt.Errorf("webhooks[%d]: name %s is used more than once", i, webhook.Name)
+		}
+		names[webhook.Name] = struct{}{}
+	}
+	return nil
+}
+
+func (conf *IndexConfig) validateWebhook(webhook *Webhook) error {
+	if webhook.Name == "" {
+		return errors.New("name must be set")
+	}
+
+	webhookURL, err := url.Parse(webhook.URL)
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+		return fmt.Errorf("url %q must be an http or https URL", webhook.URL)
+	}
+
+	if len(webhook.Triggers) == 0 {
+		return errors.New("triggers must be set")
+	}
+	for _, trigger := range webhook.Triggers {
+		if !slices.Contains(WebhookTriggers, trigger) {
+			return fmt.Errorf("unknown trigger %s, must be one of %s, %s, %s or %s", trigger,
+				WebhookTriggerBlock, WebhookTriggerWatchedAddress, WebhookTriggerMessageType, WebhookTriggerFailedBlocks)
+		}
+	}
+
+	if webhook.ChainID != "" && !slices.Contains(conf.ChainIDs(), webhook.ChainID) {
+		return fmt.Errorf("chain-id %s is not an indexed chain", webhook.ChainID)
+	}
+
+	// Watched addresses are only looked up with the watchlist enabled
+	if webhook.HasTrigger(WebhookTriggerWatchedAddress) && !conf.Watchlist.Enabled {
+		return fmt.Errorf("the %s trigger requires watchlist.enabled", WebhookTriggerWatchedAddress)
+	}
+
+	if webhook.HasTrigger(WebhookTriggerMessageType) != (len(webhook.MessageTypes) != 0) {
+		return fmt.Errorf("message-types must be set with the %s trigger and only with it", WebhookTriggerMessageType)
+	}
+
+	if webhook.HasTrigger(WebhookTriggerFailedBlocks) {
+		if webhook.FailedBlocksThreshold < 0 {
+			return errors.New("failed-blocks-threshold cannot be negative")
+		}
+		if webhook.FailedBlocksInterval == 0 {
+			webhook.FailedBlocksInterval = DefaultWebhookFailedBlocksInterval
+		}
+		if webhook.FailedBlocksInterval < 0 {
+			return errors.New("failed-blocks-interval must be greater than 0")
+		}
+	} else if webhook.FailedBlocksThreshold != 0 || webhook.FailedBlocksInterval != 0 {
+		return fmt.Errorf("failed-blocks-threshold and failed-blocks-interval are only used with the %s trigger", WebhookTriggerFailedBlocks)
+	}
+
+	if webhook.QueueSize == 0 {
+		webhook.QueueSize = DefaultWebhookQueueSize
+	}
+	if webhook.MaxAttempts == 0 {
+		webhook.MaxAttempts = DefaultWebhookMaxAttempts
+	}
+	if webhook.Timeout == 0 {
+		webhook.Timeout = DefaultWebhookTimeout
+	}
+	if webhook.QueueSize < 0 || webhook.MaxAttempts < 0 || webhook.Timeout < 0 {
+		return errors.New("queue-size, max-attempts and timeout must be greater than 0")
+	}
+
+	return nil
+}
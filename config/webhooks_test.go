@@ -0,0 +1,90 @@
+package config
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+func (suite *IndexConfigTestSuite) TestWebhooks() {
+	conf := IndexConfig{
+		Database: Database{
+			Host:     "fake-host",
+			Port:     "5432",
+			Database: "fake-database",
+			User:     "fake-user",
+			Password: "fake-password",
+		},
+		Probe: Probe{
+			RPC:           "http://cosmos-rpc",
+			AccountPrefix: "cosmos",
+			ChainID:       "cosmoshub-4",
+			ChainName:     "cosmoshub",
+		},
+	}
+	conf.Base.TransactionIndexingEnabled = true
+	conf.Base.StartBlock = 1
+	conf.Base.EndBlock = -1
+
+	viperConf := viper.New()
+	viperConf.SetConfigType("toml")
+	err := viperConf.ReadConfig(strings.NewReader(`
+[[webhooks]]
+name = "blocks"
+url = "https://example.com/blocks"
+secret = "secret"
+triggers = ["block", "message-type"]
+message-types = ["/cosmos.bank.v1beta1.MsgSend"]
+
+[[webhooks]]
+name = "alerts"
+url = "http://localhost:8080/alerts"
+triggers = ["failed-blocks"]
+chain-id = "cosmoshub-4"
+failed-blocks-threshold = 10
+queue-size = 10
+`))
+	suite.Require().NoError(err)
+	suite.Require().Empty(CheckSuperfluousIndexKeys(viperConf.AllKeys()))
+	suite.Require().NoError(viperConf.UnmarshalKey("webhooks", &conf.Webhooks))
+	suite.Require().Len(conf.Webhooks, 2)
+
+	suite.Require().NoError(conf.Validate())
+	suite.Require().True(conf.Webhooks[0].HasTrigger(WebhookTriggerMessageType))
+	suite.Require().False(conf.Webhooks[0].HasTrigger(WebhookTriggerFailedBlocks))
+	suite.Require().Equal(int64(DefaultWebhookQueueSize), conf.Webhooks[0].QueueSize)
+	suite.Require().Equal(int64(DefaultWebhookMaxAttempts), conf.Webhooks[0].MaxAttempts)
+	suite.Require().Equal(int64(DefaultWebhookTimeout), conf.Webhooks[0].Timeout)
+	suite.Require().Equal(int64(10), conf.Webhooks[1].QueueSize)
+	suite.Require().Equal(int64(DefaultWebhookFailedBlocksInterval), conf.Webhooks[1].FailedBlocksInterval)
+
+	invalid := []struct {
+		update func(webhook *Webhook)
+		err    string
+	}{
+		{func(webhook *Webhook) { webhook.Name = "" }, "webhooks[1]: name must be set"},
+		{func(webhook *Webhook) { webhook.Name = "blocks" }, "webhooks[1]: name blocks is used more than once"},
+		{func(webhook *Webhook) { webhook.URL = "localhost:8080/alerts" }, "must be an http or https URL"},
+		{func(webhook *Webhook) { webhook.Triggers = nil }, "triggers must be set"},
+		{func(webhook *Webhook) { webhook.Triggers = []string{"new-block"} }, "unknown trigger new-block"},
+		{func(webhook *Webhook) { webhook.ChainID = "osmosis-1" }, "chain-id osmosis-1 is not an indexed chain"},
+		{func(webhook *Webhook) { webhook.Triggers = append(webhook.Triggers, WebhookTriggerWatchedAddress) }, "requires watchlist.enabled"},
+		{func(webhook *Webhook) { webhook.Triggers = append(webhook.Triggers, WebhookTriggerMessageType) }, "message-types must be set"},
+		{func(webhook *Webhook) { webhook.MessageTypes = []string{"/cosmos.bank.v1beta1.MsgSend"} }, "message-types must be set"},
+		{func(webhook *Webhook) { webhook.FailedBlocksThreshold = -1 }, "failed-blocks-threshold cannot be negative"},
+		{func(webhook *Webhook) { webhook.Triggers = []string{WebhookTriggerBlock} }, "only used with the failed-blocks trigger"},
+		{func(webhook *Webhook) { webhook.MaxAttempts = -1 }, "must be greater than 0"},
+	}
+	for _, tt := range invalid {
+		invalidConf := conf
+		invalidConf.Webhooks = slices.Clone(conf.Webhooks)
+		tt.update(&invalidConf.Webhooks[1])
+		suite.Require().ErrorContains(invalidConf.Validate(), tt.err)
+	}
+
+	conf.Watchlist.Enabled = true
+	conf.Watchlist.ReloadInterval = 60
+	conf.Webhooks[1].Triggers = append(conf.Webhooks[1].Triggers, WebhookTriggerWatchedAddress)
+	suite.Require().NoError(conf.Validate())
+}
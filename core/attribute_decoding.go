@@ -0,0 +1,88 @@
+package core
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	abci "github.com/cometbft/cometbft/abci/types"
+)
+
+// ErrUnrecognizedAttribute is returned when a block event attribute cannot be decoded and flags.unrecognized-attribute-policy is fail
+var ErrUnrecognizedAttribute = errors.New("block event attribute has an unrecognized encoding, see flags.unrecognized-attribute-policy")
+
+// attributeEncoding returns the configured block event attribute encoding. Configs that were not validated fall back to
+// the legacy base64 flag.
+func attributeEncoding(conf config.IndexConfig) string {
+	if conf.Flags.BlockEventsAttributeEncoding != "" {
+		return conf.Flags.BlockEventsAttributeEncoding
+	}
+
+	if conf.Flags.BlockEventsBase64Encoded {
+		return config.AttributeEncodingBase64
+	}
+
+	return config.AttributeEncodingPlain
+}
+
+// eventAttributeEncoding resolves the auto encoding for a single event. The attributes of an event are treated as base64
+// when every key decodes to a recognizable key and every value decodes, plain keys rarely survive both checks.
+func eventAttributeEncoding(event abci.Event, encoding string) string {
+	if encoding != config.AttributeEncodingAuto {
+		return encoding
+	}
+
+	if len(event.Attributes) == 0 {
+		return config.AttributeEncodingPlain
+	}
+
+	for _, attribute := range event.Attributes {
+		key, err := base64.StdEncoding.DecodeString(attribute.Key)
+		if err != nil || !isRecognizableKey(string(key)) {
+			return config.AttributeEncodingPlain
+		}
+
+		if _, err := base64.StdEncoding.DecodeString(attribute.Value); err != nil {
+			return config.AttributeEncodingPlain
+		}
+	}
+
+	return config.AttributeEncodingBase64
+}
+
+// decodeAttribute decodes the key and value of an attribute, the error describes why the attribute is unrecognized
+func decodeAttribute(attribute abci.EventAttribute, encoding string) (key string, value string, err error) {
+	if encoding != config.AttributeEncodingBase64 {
+		return attribute.Key, attribute.Value, nil
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(attribute.Key)
+	if err != nil {
+		return "", "", fmt.Errorf("key is not valid base64: %w", err)
+	}
+
+	valueBytes, err := base64.StdEncoding.DecodeString(attribute.Value)
+	if err != nil {
+		return "", "", fmt.Errorf("value is not valid base64: %w", err)
+	}
+
+	return string(keyBytes), string(valueBytes), nil
+}
+
+// isRecognizableKey reports whether a decoded key looks like an attribute key rather than arbitrary bytes
+func isRecognizableKey(key string) bool {
+	if key == "" || !utf8.ValidString(key) {
+		return false
+	}
+
+	for _, r := range key {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+
+	return true
+}
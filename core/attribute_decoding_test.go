@@ -0,0 +1,107 @@
+package core
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	abci "github.com/cometbft/cometbft/abci/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type AttributeDecodingTestSuite struct {
+	suite.Suite
+}
+
+func encodedAttribute(key string, value string) abci.EventAttribute {
+	return abci.EventAttribute{Key: base64.StdEncoding.EncodeToString([]byte(key)), Value: base64.StdEncoding.EncodeToString([]byte(value))}
+}
+
+func processEvents(conf config.IndexConfig, events []abci.Event) ([]models.BlockEventAttribute, []models.QuarantinedAttribute, error) {
+	wrappers, quarantined, err := ProcessRPCBlockEvents(&models.Block{Height: 10, ChainID: 1}, events, models.EndBlockEvent, make(map[string]models.BlockEventType), make(map[string]models.BlockEventAttributeKey), nil, conf)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var attributes []models.BlockEventAttribute
+	for _, wrapper := range wrappers {
+		attributes = append(attributes, wrapper.Attributes...)
+	}
+	return attributes, quarantined, nil
+}
+
+func (suite *AttributeDecodingTestSuite) TestAutoEncodingDetectsPerEvent() {
+	conf := config.IndexConfig{}
+	conf.Flags.BlockEventsAttributeEncoding = config.AttributeEncodingAuto
+
+	events := []abci.Event{
+		{Type: "transfer", Attributes: []abci.EventAttribute{encodedAttribute("recipient", "cosmos1abc"), encodedAttribute("amount", "10uatom")}},
+		{Type: "transfer", Attributes: []abci.EventAttribute{{Key: "recipient", Value: "cosmos1abc"}, {Key: "amount", Value: "10uatom"}}},
+	}
+
+	attributes, quarantined, err := processEvents(conf, events)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(quarantined)
+	suite.Require().Len(attributes, 4)
+	for _, attribute := range attributes {
+		suite.Assert().Contains([]string{"recipient", "amount"}, attribute.BlockEventAttributeKey.Key)
+		suite.Assert().Contains([]string{"cosmos1abc", "10uatom"}, attribute.Value)
+	}
+}
+
+func (suite *AttributeDecodingTestSuite) TestLegacyBase64Flag() {
+	conf := config.IndexConfig{}
+	conf.Flags.BlockEventsBase64Encoded = true
+
+	attributes, _, err := processEvents(conf, []abci.Event{{Type: "transfer", Attributes: []abci.EventAttribute{encodedAttribute("amount", "10uatom")}}})
+	suite.Require().NoError(err)
+	suite.Require().Len(attributes, 1)
+	suite.Assert().Equal("amount", attributes[0].BlockEventAttributeKey.Key)
+	suite.Assert().Equal("10uatom", attributes[0].Value)
+}
+
+func (suite *AttributeDecodingTestSuite) TestQuarantineKeepsRecognizableAttributes() {
+	conf := config.IndexConfig{}
+	conf.Flags.BlockEventsAttributeEncoding = config.AttributeEncodingBase64
+	conf.Flags.UnrecognizedAttributePolicy = config.UnrecognizedAttributePolicyQuarantine
+
+	events := []abci.Event{{Type: "transfer", Attributes: []abci.EventAttribute{
+		{Key: "{\"proto\":\"json\"}", Value: "10uatom"},
+		encodedAttribute("amount", "10uatom"),
+	}}}
+
+	attributes, quarantined, err := processEvents(conf, events)
+	suite.Require().NoError(err)
+	suite.Require().Len(attributes, 1)
+	suite.Assert().Equal("amount", attributes[0].BlockEventAttributeKey.Key)
+	// The index is the attribute's position in the RPC response
+	suite.Assert().Equal(uint64(1), attributes[0].Index)
+
+	suite.Require().Len(quarantined, 1)
+	suite.Assert().Equal(models.QuarantinedAttribute{
+		ChainID:           1,
+		EventType:         "transfer",
+		Height:            10,
+		LifecyclePosition: models.EndBlockEvent,
+		EventIndex:        0,
+		AttributeIndex:    0,
+		RawKey:            []byte("{\"proto\":\"json\"}"),
+		RawValue:          []byte("10uatom"),
+		Reason:            quarantined[0].Reason,
+	}, quarantined[0])
+	suite.Assert().NotEmpty(quarantined[0].Reason)
+}
+
+func (suite *AttributeDecodingTestSuite) TestFailPolicy() {
+	conf := config.IndexConfig{}
+	conf.Flags.BlockEventsAttributeEncoding = config.AttributeEncodingBase64
+	conf.Flags.UnrecognizedAttributePolicy = config.UnrecognizedAttributePolicyFail
+
+	_, _, err := processEvents(conf, []abci.Event{{Type: "transfer", Attributes: []abci.EventAttribute{{Key: "amount!", Value: "10uatom"}}}})
+	suite.Assert().ErrorIs(err, ErrUnrecognizedAttribute)
+}
+
+func TestAttributeDecodingSuite(t *testing.T) {
+	suite.Run(t, new(AttributeDecodingTestSuite))
+}
@@ -1,7 +1,10 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
 	"os"
 	"sort"
@@ -23,13 +26,25 @@ type EnqueueData struct {
 	Height            int64
 	IndexBlockEvents  bool
 	IndexTransactions bool
+	Priority          FetchPriority // Priority of the lane that enqueued the height, see FetchCoalescer
 }
 
-func GenerateBlockFileEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client *client.ChainClient, chainID uint, blockInputFile string) (func(chan *EnqueueData) error, error) {
+// FetchPriority is the priority of the lane a height was enqueued on. When requests of several lanes for the same height
+// are coalesced, the lane with the highest priority passes the fetched block on.
+type FetchPriority int
+
+const (
+	// PriorityBackfill is the priority of the gap backfill below the head of the chain
+	PriorityBackfill FetchPriority = -1
+	// PriorityHead is the priority of every other enqueue, the default
+	PriorityHead FetchPriority = 0
+)
+
+func GenerateBlockFileEnqueueFunction(ctx context.Context, db *gorm.DB, cfg config.IndexConfig, client *client.ChainClient, chainID uint, blockInputFile string) (func(chan *EnqueueData) error, error) {
 	return func(blockChan chan *EnqueueData) error {
 		plan, err := os.ReadFile(blockInputFile)
 		if err != nil {
-			config.Log.Errorf("Error reading block input file. Err: %v", err)
+			cfg.ChainLog().Errorf("Error reading block input file. Err: %v", err)
 			return err
 		}
 		var blocksToIndex []uint64
@@ -40,16 +55,16 @@ func GenerateBlockFileEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, clien
 
 			switch {
 			case errString == "json: cannot unmarshal string into Go value of type int":
-				config.Log.Errorf("Error parsing block input file. Err: Found non-integer value in block array")
+				cfg.ChainLog().Errorf("Error parsing block input file. Err: Found non-integer value in block array")
 				return err
 			case errString == "cannot unmarshal object into Go value of type []uint64":
-				config.Log.Errorf("Error parsing block input file. Err: Found object that could not be parsed into an array of integers")
+				cfg.ChainLog().Errorf("Error parsing block input file. Err: Found object that could not be parsed into an array of integers")
 				return err
 			case strings.Contains(errString, "cannot unmarshal number"):
-				config.Log.Errorf("Error parsing block input file. Err: Found number that could not be parsed into Go unsigned integer")
+				cfg.ChainLog().Errorf("Error parsing block input file. Err: Found number that could not be parsed into Go unsigned integer")
 				return err
 			default:
-				config.Log.Errorf("Error parsing block input file. Err: %v", err)
+				cfg.ChainLog().Errorf("Error parsing block input file. Err: %v", err)
 				return err
 			}
 		}
@@ -61,7 +76,8 @@ func GenerateBlockFileEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, clien
 		// Get latest block height and check to see if we are trying to index blocks outside range
 		earliestBlock, latestBlock, err := rpc.GetEarliestAndLatestBlockHeights(client)
 		if err != nil {
-			config.Log.Fatal("Error getting blockchain latest height. Err: %v", err)
+			cfg.ChainLog().Errorf("Error getting blockchain latest height. Err: %v", err)
+			return err
 		}
 
 		unindexableBlockHeights := []uint64{}
@@ -75,11 +91,11 @@ func GenerateBlockFileEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, clien
 		}
 
 		if len(unindexableBlockHeights) != 0 {
-			config.Log.Warnf("The following blocks are past the blockchain earliest height (%d) and latest height (%d) and will be skipped: %v", earliestBlock, latestBlock, unindexableBlockHeights)
+			cfg.ChainLog().Warnf("The following blocks are past the blockchain earliest height (%d) and latest height (%d) and will be skipped: %v", earliestBlock, latestBlock, unindexableBlockHeights)
 		}
 
 		if len(blockInRange) == 0 {
-			config.Log.Infof("No blocks to index within blockchain earliest height (%d) and latest height (%d), exiting", earliestBlock, latestBlock)
+			cfg.ChainLog().Infof("No blocks to index within blockchain earliest height (%d) and latest height (%d), exiting", earliestBlock, latestBlock)
 			return nil
 		}
 
@@ -88,7 +104,7 @@ func GenerateBlockFileEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, clien
 			if cfg.Base.Throttling != 0 {
 				time.Sleep(time.Second * time.Duration(cfg.Base.Throttling))
 			}
-			config.Log.Debugf("Sending block %v to be indexed.", height)
+			cfg.ChainLog().Debugf("Sending block %v to be indexed.", height)
 			// Add the new block to the queue
 			blockChan <- &EnqueueData{
 				IndexBlockEvents:  cfg.Base.BlockEventIndexingEnabled,
@@ -100,16 +116,23 @@ func GenerateBlockFileEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, clien
 	}, nil
 }
 
-func GenerateMsgTypeEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, chainID uint, msgType string) (func(chan *EnqueueData) error, error) {
+func GenerateMsgTypeEnqueueFunction(ctx context.Context, db *gorm.DB, cfg config.IndexConfig, chainID uint, msgType string) (func(chan *EnqueueData) error, error) {
 	// get the block range
 	startBlock := cfg.Base.StartBlock
 	endBlock := cfg.Base.EndBlock
-	if endBlock == -1 {
-		heighestBlock := dbTypes.GetHighestIndexedBlock(db, chainID)
-		endBlock = heighestBlock.Height
+	if endBlock == dbTypes.OpenEnd {
+		highestBlock, found, err := dbTypes.GetHighestIndexedBlock(ctx, db, chainID)
+		if err != nil {
+			cfg.ChainLog().Errorf("Error getting the highest indexed block. Err: %v", err)
+			return nil, err
+		}
+		if !found {
+			cfg.ChainLog().Infof("No blocks indexed for the chain yet, there is nothing to reindex")
+		}
+		endBlock = highestBlock.Height
 	}
 
-	rows, err := db.Raw(`SELECT height FROM blocks
+	rows, err := db.WithContext(ctx).Raw(`SELECT height FROM blocks
 							JOIN txes ON txes.block_id = blocks.id
 							JOIN messages ON messages.tx_id = txes.id
 							JOIN message_types ON message_types.id = messages.message_type_id
@@ -117,7 +140,7 @@ func GenerateMsgTypeEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, chainID
 							WHERE height >= ? AND height <= ? AND chain_id = ?::int;
 							`, msgType, startBlock, endBlock, chainID).Rows()
 	if err != nil {
-		config.Log.Errorf("Error checking DB for blocks to reindex. Err: %v", err)
+		cfg.ChainLog().Errorf("Error checking DB for blocks to reindex. Err: %v", err)
 		return nil, err
 	}
 
@@ -127,9 +150,10 @@ func GenerateMsgTypeEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, chainID
 			var block int64
 			err = db.ScanRows(rows, &block)
 			if err != nil {
-				config.Log.Fatal("Error getting block height. Err: %v", err)
+				cfg.ChainLog().Errorf("Error getting block height. Err: %v", err)
+				return err
 			}
-			config.Log.Debugf("Sending block %v to be re-indexed.", block)
+			cfg.ChainLog().Debugf("Sending block %v to be re-indexed.", block)
 
 			if cfg.Base.Throttling != 0 {
 				time.Sleep(time.Second * time.Duration(cfg.Base.Throttling))
@@ -147,30 +171,85 @@ func GenerateMsgTypeEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, chainID
 	}, nil
 }
 
+// GenerateHeightRangeEnqueueFunction enqueues every height of the range with the datasets, whether or not the heights are
+// already indexed, for reindexing an explicit range of heights
+func GenerateHeightRangeEnqueueFunction(ctx context.Context, cfg config.IndexConfig, heights dbTypes.HeightRange, indexTransactions bool, indexBlockEvents bool) (func(chan *EnqueueData) error, error) {
+	if err := heights.Validate(); err != nil {
+		return nil, err
+	}
+	if heights.IsOpen() {
+		return nil, &dbTypes.HeightRangeError{Range: heights, Err: errors.New("reindexed range must have an end")}
+	}
+
+	return func(blockChan chan *EnqueueData) error {
+		for height := heights.Start; height <= heights.End; height++ {
+			if ctx.Err() != nil {
+				cfg.ChainLog().Info("Indexer is shutting down, exiting enqueue func.")
+				return nil
+			}
+
+			if cfg.Base.Throttling != 0 {
+				time.Sleep(time.Second * time.Duration(cfg.Base.Throttling))
+			}
+			cfg.ChainLog().Debugf("Sending block %v to be re-indexed.", height)
+
+			select {
+			case blockChan <- &EnqueueData{Height: height, IndexTransactions: indexTransactions, IndexBlockEvents: indexBlockEvents}:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		return nil
+	}, nil
+}
+
 // The default enqueue function will enqueue blocks according to the configuration passed in. It has a few default cases detailed here:
 // Based on whether transaction indexing or block event indexing are enabled, it will choose a start block based on passed in config values.
 // If reindexing is disabled, it will not reindex blocks that have already been indexed. This means it may skip around finding blocks that have not been
 // indexed according to the current configuration.
 // If failed block reattempts are enabled, it will enqueue those according to the passed in configuration as well.
-func GenerateDefaultEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client *client.ChainClient, chainID uint) (func(chan *EnqueueData) error, error) {
+func GenerateDefaultEnqueueFunction(ctx context.Context, db *gorm.DB, cfg config.IndexConfig, client *client.ChainClient, chainID uint) (func(chan *EnqueueData) error, error) {
+	chain := dbTypes.ChainRef{ID: chainID, ChainID: cfg.Probe.ChainID}
+
+	if cfg.Base.QuarantineAfterAttempts > 0 {
+		quarantined, err := dbTypes.QuarantineFailedBlocks(ctx, db, chain, cfg.Base.QuarantineAfterAttempts)
+		if err != nil {
+			cfg.ChainLog().Error("Error quarantining repeatedly failing blocks", err)
+			return nil, err
+		}
+		if quarantined != 0 {
+			cfg.ChainLog().Warnf("Quarantined %d failed blocks that failed %d times, they will be skipped until released", quarantined, cfg.Base.QuarantineAfterAttempts)
+		}
+	}
+
 	var failedBlockEnqueueData []*EnqueueData
 	if cfg.Base.ReattemptFailedBlocks {
 		var failedEventBlocks []models.FailedEventBlock
 		var failedBlocks []models.FailedBlock
+		var err error
 
 		uniqueBlockFailures := make(map[int64]*EnqueueData)
 		if cfg.Base.BlockEventIndexingEnabled {
-			err := db.Table("failed_event_blocks").Where("blockchain_id = ?::int", chainID).Order("height asc").Scan(&failedEventBlocks).Error
+			removed, err := dbTypes.DeleteIndexedFailedEventBlocks(ctx, db)
 			if err != nil {
-				config.Log.Error("Error retrieving failed event blocks for reenqueue", err)
+				cfg.ChainLog().Error("Error removing failed event blocks that have since been indexed", err)
+				return nil, err
+			}
+			if removed != 0 {
+				cfg.ChainLog().Infof("Removed %d failed event blocks that have since been indexed", removed)
+			}
+
+			err = db.WithContext(ctx).Table("failed_event_blocks").Where("blockchain_id = ?::int AND NOT quarantined", chainID).Order("height asc").Scan(&failedEventBlocks).Error
+			if err != nil {
+				cfg.ChainLog().Error("Error retrieving failed event blocks for reenqueue", err)
 				return nil, err
 			}
 		}
 
 		if cfg.Base.TransactionIndexingEnabled {
-			err := db.Table("failed_blocks").Where("blockchain_id = ?::int", chainID).Order("height asc").Scan(&failedBlocks).Error
+			failedBlocks, err = dbTypes.GetFailedBlocks(ctx, db, chain, dbTypes.HeightsFrom(1))
 			if err != nil {
-				config.Log.Error("Error retrieving failed blocks for reenqueue", err)
+				cfg.ChainLog().Error("Error retrieving failed blocks for reenqueue", err)
 				return nil, err
 			}
 		}
@@ -184,6 +263,9 @@ func GenerateDefaultEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client
 		}
 
 		for _, failedBlock := range failedBlocks {
+			if failedBlock.Quarantined {
+				continue
+			}
 			if _, ok := uniqueBlockFailures[failedBlock.Height]; ok {
 				uniqueBlockFailures[failedBlock.Height].IndexTransactions = true
 			} else {
@@ -213,39 +295,80 @@ func GenerateDefaultEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client
 		startBlock = 1
 	}
 
-	var blocksFromStart []models.Block
+	heights, err := dbTypes.NewHeightRange(startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	// Heights pruned by the RPC nodes can never be fetched
+	earliestBlock, err := rpc.GetEarliestAvailableHeight(client)
+	if err != nil {
+		cfg.ChainLog().Errorf("Error getting blockchain earliest height. Err: %v", err)
+		return nil, err
+	}
+	if startBlock, err = skipPrunedHeights(ctx, db, cfg, chain, heights, startBlock, earliestBlock); err != nil {
+		return nil, err
+	}
+	floor, err := dbTypes.GetUnavailableFloor(ctx, db, chain)
+	if err != nil {
+		return nil, err
+	}
 
-	if !reindexing {
-		var err error
-		config.Log.Info("Reindexing is disabled, skipping blocks that have already been indexed")
-		// We need to pick up where we last left off, find blocks after start and skip already indexed blocks
-		blocksFromStart, err = dbTypes.GetBlocksFromStart(db, chainID, startBlock, endBlock)
+	var blocksInDB *indexedBlocks
 
+	if !reindexing {
+		cfg.ChainLog().Info("Reindexing is disabled, skipping blocks that have already been indexed")
+		// The checkpoints skip the heights known to be indexed without scanning their blocks
+		workerTypes := dbTypes.CheckpointWorkerTypes(cfg.Base.TransactionIndexingEnabled, cfg.Base.BlockEventIndexingEnabled)
+		resume, err := dbTypes.GetCheckpointResumeHeight(ctx, db, chain, startBlock, workerTypes...)
 		if err != nil {
+			cfg.ChainLog().Error("Error getting the indexer checkpoints", err)
 			return nil, err
 		}
+		if resume > startBlock {
+			cfg.ChainLog().Infof("Heights %d to %d are indexed according to the checkpoints, resuming from height %d", startBlock, resume-1, resume)
+			startBlock = resume
+		}
 
+		// We need to pick up where we last left off, find blocks after start and skip already indexed blocks
+		if heights.Contains(startBlock) {
+			blocksInDB = newIndexedBlocks(ctx, db, chain, dbTypes.HeightRange{Start: startBlock, End: heights.End})
+
+			// Load the first page now so database errors fail the setup
+			if _, _, err := blocksInDB.get(startBlock); err != nil {
+				return nil, err
+			}
+		}
 	} else {
-		config.Log.Info("Reindexing is enabled starting from initial start height")
+		cfg.ChainLog().Info("Reindexing is enabled starting from initial start height")
+	}
+
+	// Quarantined failures are known holes, the parts of a block that keep failing are not enqueued again
+	quarantined, err := dbTypes.GetQuarantinedFailures(ctx, db, chain, heights)
+	if err != nil {
+		return nil, err
 	}
 
+	follower := newBlockFollower(cfg, client)
+
 	return func(blockChan chan *EnqueueData) error {
-		blocksInDB := make(map[int64]models.Block)
-		for _, block := range blocksFromStart {
-			blocksInDB[block.Height] = block
-		}
+		defer follower.stop()
 
 		if len(failedBlockEnqueueData) > 0 && cfg.Base.ReattemptFailedBlocks {
-			config.Log.Info("Re-enqueuing failed blocks")
+			cfg.ChainLog().Info("Re-enqueuing failed blocks")
 			for _, block := range failedBlockEnqueueData {
+				if block.Height < floor {
+					cfg.ChainLog().Debugf("Failed block %v is unavailable on the RPC nodes, skipping", block.Height)
+					continue
+				}
 
 				switch {
 				case block.IndexBlockEvents && block.IndexTransactions:
-					config.Log.Infof("Re-attempting failed block %v for both block events and transactions", block.Height)
+					cfg.ChainLog().Infof("Re-attempting failed block %v for both block events and transactions", block.Height)
 				case block.IndexBlockEvents:
-					config.Log.Infof("Re-attempting failed block: %v for block events", block.Height)
+					cfg.ChainLog().Infof("Re-attempting failed block: %v for block events", block.Height)
 				case block.IndexTransactions:
-					config.Log.Infof("Re-attempting failed block: %v for transactions", block.Height)
+					cfg.ChainLog().Infof("Re-attempting failed block: %v for transactions", block.Height)
 				}
 
 				if block.IndexBlockEvents || block.IndexTransactions {
@@ -255,34 +378,48 @@ func GenerateDefaultEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client
 					}
 				}
 			}
-			config.Log.Info("All failed blocks have been re-enqueued for processing")
+			cfg.ChainLog().Info("All failed blocks have been re-enqueued for processing")
 		} else if cfg.Base.ReattemptFailedBlocks {
-			config.Log.Info("No failed blocks to re-enqueue")
+			cfg.ChainLog().Info("No failed blocks to re-enqueue")
 		}
 
 		currBlock := startBlock
 
 		for {
+			if ctx.Err() != nil {
+				cfg.ChainLog().Info("Indexer is shutting down, exiting enqueue func.")
+				return nil
+			}
+
 			// The program is configured to stop running after a set block height.
 			// Generally this will only be done while debugging or if a particular block was incorrectly processed.
-			if endBlock != -1 && currBlock > endBlock {
-				config.Log.Info("Hit the last block we're allowed to index, exiting enqueue func.")
+			if !heights.Contains(currBlock) {
+				cfg.ChainLog().Info("Hit the last block we're allowed to index, exiting enqueue func.")
 				return nil
 			} else if cfg.Base.ExitWhenCaughtUp && currBlock > latestBlock {
-				config.Log.Info("Hit the last block we're allowed to index, exiting enqueue func.")
+				cfg.ChainLog().Info("Hit the last block we're allowed to index, exiting enqueue func.")
 				return nil
 			}
 
 			// The job queue is running out of jobs to process, see if the blockchain has produced any new blocks we haven't indexed yet.
 			if len(blockChan) <= cap(blockChan)/4 {
-				// This is the latest block height available on the Node.
+				// This is the latest block height available on the Node, a websocket follower waits for a block we can enqueue.
 
 				var err error
-				latestBlock, err = rpc.GetLatestBlockHeightWithRetry(client, cfg.Base.RequestRetryAttempts, cfg.Base.RequestRetryMaxWait)
+				latestBlock, err = follower.latestHeight(ctx, currBlock+cfg.Base.FinalityLag)
 				if err != nil {
-					config.Log.Error("Error getting blockchain latest height. Err: %v", err)
+					cfg.ChainLog().Error("Error getting blockchain latest height. Err: %v", err)
 					return err
 				}
+				// Stay behind the tip, blocks close to it may still be reorged
+				latestBlock -= cfg.Base.FinalityLag
+
+				// After a failover the remaining nodes may have pruned the next heights
+				if failover, ok := client.RPCClient.(*rpc.FailoverClient); ok {
+					if currBlock, err = skipPrunedHeights(ctx, db, cfg, chain, heights, currBlock, failover.EarliestHeight()); err != nil {
+						return err
+					}
+				}
 
 				// Throttling in case of hitting public APIs
 				if cfg.Base.Throttling != 0 {
@@ -290,36 +427,58 @@ func GenerateDefaultEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client
 				}
 
 				// Already at the latest block, wait for the next block to be available.
-				for currBlock < latestBlock && (currBlock <= endBlock || endBlock == -1) && len(blockChan) != cap(blockChan) {
+				for currBlock < latestBlock && heights.Contains(currBlock) && len(blockChan) != cap(blockChan) {
+					_, txsQuarantined := quarantined.Transactions[currBlock]
+					_, eventsQuarantined := quarantined.BlockEvents[currBlock]
+					indexBlockEvents := cfg.Base.BlockEventIndexingEnabled && !eventsQuarantined
+					indexTransactions := cfg.Base.TransactionIndexingEnabled && !txsQuarantined
+
+					if !indexBlockEvents && !indexTransactions {
+						cfg.ChainLog().Debugf("Block %d is quarantined, skipping", currBlock)
+						currBlock++
+						continue
+					}
+
 					// if we are not re-indexing, skip curr block if already indexed
-					block, blockExists := blocksInDB[currBlock]
+					var block models.Block
+					blockExists := false
+					if blocksInDB != nil {
+						if block, blockExists, err = blocksInDB.get(currBlock); err != nil {
+							return err
+						}
+					}
 
 					// Skip blocks already in DB that do not need indexing according to the config
 					if !reindexing && blockExists {
-						config.Log.Debugf("Block %d already in DB, checking if it needs indexing", currBlock)
+						cfg.ChainLog().Debugf("Block %d already in DB, checking if it needs indexing", currBlock)
 
 						needsIndex := false
 
-						if cfg.Base.BlockEventIndexingEnabled && !block.BlockEventsIndexed {
+						// Pruned blocks were deleted by the retention policy, they are not indexed again
+						if block.Pruned {
+							cfg.ChainLog().Debugf("Block %d was pruned, skipping", currBlock)
+							currBlock++
+							continue
+						}
+
+						if indexBlockEvents && !block.BlockEventsIndexed {
 							needsIndex = true
-						} else if cfg.Base.TransactionIndexingEnabled && !block.TxIndexed {
+						} else if indexTransactions && !block.TxIndexed {
 							needsIndex = true
 						}
 
 						if !needsIndex {
-							config.Log.Debugf("Block %d already indexed, skipping", currBlock)
+							cfg.ChainLog().Debugf("Block %d already indexed, skipping", currBlock)
 							currBlock++
 							continue
 						}
-						config.Log.Debugf("Block %d needs indexing, adding to queue", currBlock)
+						cfg.ChainLog().Debugf("Block %d needs indexing, adding to queue", currBlock)
 						blockChan <- &EnqueueData{
 							Height:            currBlock,
-							IndexBlockEvents:  cfg.Base.BlockEventIndexingEnabled && !block.BlockEventsIndexed,
-							IndexTransactions: cfg.Base.TransactionIndexingEnabled && !block.TxIndexed,
+							IndexBlockEvents:  indexBlockEvents && !block.BlockEventsIndexed,
+							IndexTransactions: indexTransactions && !block.TxIndexed,
 						}
 
-						delete(blocksInDB, currBlock)
-
 						currBlock++
 
 						if cfg.Base.Throttling != 0 {
@@ -332,8 +491,8 @@ func GenerateDefaultEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client
 					// Add the new block to the queue
 					blockChan <- &EnqueueData{
 						Height:            currBlock,
-						IndexBlockEvents:  cfg.Base.BlockEventIndexingEnabled,
-						IndexTransactions: cfg.Base.TransactionIndexingEnabled,
+						IndexBlockEvents:  indexBlockEvents,
+						IndexTransactions: indexTransactions,
 					}
 					currBlock++
 
@@ -345,3 +504,98 @@ func GenerateDefaultEnqueueFunction(db *gorm.DB, cfg config.IndexConfig, client
 		}
 	}, nil
 }
+
+// skipPrunedHeights handles a next height to index below the earliest height the RPC nodes of the chain can serve. Without
+// AllowPruned it returns an error. With it, the pruned heights within the range are recorded as unavailable and the
+// earliest height is returned to continue from.
+func skipPrunedHeights(ctx context.Context, db *gorm.DB, cfg config.IndexConfig, chain dbTypes.ChainRef, heights dbTypes.HeightRange, next int64, earliest int64) (int64, error) {
+	if next >= earliest {
+		return next, nil
+	}
+	if !cfg.Base.AllowPruned {
+		return next, fmt.Errorf("block %d was pruned by the RPC node, its earliest block is %d: index from an archive node, start from block %d or set base.allow-pruned to skip the pruned blocks", next, earliest, earliest)
+	}
+
+	skipped := dbTypes.HeightRange{Start: next, End: earliest - 1}
+	if !heights.IsOpen() && heights.End < skipped.End {
+		skipped.End = heights.End
+	}
+	cfg.ChainLog().Warnf("Blocks %s were pruned by the RPC node, skipping them and continuing from block %d", skipped, earliest)
+	if err := dbTypes.RecordUnavailableBlockRange(ctx, db, chain, skipped, "pruned by the RPC node"); err != nil {
+		cfg.ChainLog().Errorf("Error recording the pruned blocks. Err: %v", err)
+		return next, err
+	}
+	return earliest, nil
+}
+
+// indexedBlocks looks up the blocks already in the database for the default enqueue function. Heights are looked up in
+// increasing order, so the blocks are loaded a page at a time as the enqueue advances instead of the whole range at once.
+type indexedBlocks struct {
+	ctx      context.Context
+	db       *gorm.DB
+	chain    dbTypes.ChainRef
+	next     dbTypes.HeightRange
+	hasMore  bool
+	loadedTo int64 // Highest height covered by the loaded page while there are more pages
+	blocks   map[int64]models.Block
+}
+
+func newIndexedBlocks(ctx context.Context, db *gorm.DB, chain dbTypes.ChainRef, heights dbTypes.HeightRange) *indexedBlocks {
+	// The indexed blocks decide what to enqueue, a lagging read replica would enqueue blocks that are already indexed
+	return &indexedBlocks{ctx: dbTypes.ReadFromPrimary(ctx), db: db, chain: chain, next: heights, hasMore: true, loadedTo: heights.Start - 1}
+}
+
+// get returns the block at height, if it is in the database. The height must not be lower than in the previous call.
+func (b *indexedBlocks) get(height int64) (models.Block, bool, error) {
+	for b.hasMore && height > b.loadedTo {
+		page, err := dbTypes.GetBlocksPage(b.ctx, b.db, b.chain, b.next, dbTypes.DefaultBlocksPageSize)
+		if err != nil {
+			return models.Block{}, false, err
+		}
+
+		b.blocks = make(map[int64]models.Block, len(page.Blocks))
+		for _, block := range page.Blocks {
+			b.blocks[block.Height] = block
+		}
+
+		b.next, b.hasMore = page.Next, page.HasMore
+		if page.HasMore {
+			b.loadedTo = page.Blocks[len(page.Blocks)-1].Height
+		}
+	}
+
+	block, ok := b.blocks[height]
+	return block, ok, nil
+}
+
+// GenerateRangeProfileEnqueueFunction wraps a block enqueue function so each enqueued height only indexes the datasets
+// enabled by the range profile of its height. Heights left with nothing to index are skipped, heights without a profile
+// are enqueued as they are.
+func GenerateRangeProfileEnqueueFunction(enqueue func(chan *EnqueueData) error, profiles config.RangeProfiles) func(chan *EnqueueData) error {
+	return func(blockChan chan *EnqueueData) error {
+		// Same capacity, so enqueue functions checking how full the queue is see the same fill level
+		profiledChan := make(chan *EnqueueData, cap(blockChan))
+		enqueueErr := make(chan error, 1)
+
+		go func() {
+			defer close(profiledChan)
+			enqueueErr <- enqueue(profiledChan)
+		}()
+
+		for data := range profiledChan {
+			if profile, ok := profiles.ProfileAt(data.Height); ok {
+				data.IndexTransactions = data.IndexTransactions && profile.IndexTransactions
+				data.IndexBlockEvents = data.IndexBlockEvents && profile.IndexBlockEvents
+			}
+
+			if !data.IndexTransactions && !data.IndexBlockEvents {
+				config.Log.Debugf("Block %d has nothing to index with its range profile, skipping", data.Height)
+				continue
+			}
+
+			blockChan <- data
+		}
+
+		return <-enqueueErr
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/stretchr/testify/suite"
+)
+
+type BlockEnqueueTestSuite struct {
+	suite.Suite
+}
+
+func (suite *BlockEnqueueTestSuite) TestRangeProfileEnqueueFunction() {
+	profiles := config.RangeProfiles{
+		Ranges: []config.RangeProfile{
+			{Name: "skeleton", StartHeight: 1, EndHeight: 2, IndexTransactions: true},
+			{Name: "events", StartHeight: 3, EndHeight: 3, IndexBlockEvents: true},
+		},
+	}
+
+	enqueueErr := errors.New("enqueue failed")
+	enqueue := func(blockChan chan *EnqueueData) error {
+		for height := int64(1); height <= 4; height++ {
+			blockChan <- &EnqueueData{Height: height, IndexTransactions: true, IndexBlockEvents: true}
+		}
+		// Already has its txs, the profile does not index block events
+		blockChan <- &EnqueueData{Height: 2, IndexBlockEvents: true}
+		return enqueueErr
+	}
+
+	blockChan := make(chan *EnqueueData, 10)
+	err := GenerateRangeProfileEnqueueFunction(enqueue, profiles)(blockChan)
+	suite.Assert().ErrorIs(err, enqueueErr)
+	close(blockChan)
+
+	var enqueued []EnqueueData
+	for data := range blockChan {
+		enqueued = append(enqueued, *data)
+	}
+
+	suite.Assert().Equal([]EnqueueData{
+		{Height: 1, IndexTransactions: true},
+		{Height: 2, IndexTransactions: true},
+		{Height: 3, IndexBlockEvents: true},
+		// No profile and no default, the enqueued datasets are kept
+		{Height: 4, IndexTransactions: true, IndexBlockEvents: true},
+	}, enqueued)
+}
+
+func (suite *BlockEnqueueTestSuite) TestHeightRangeEnqueueFunction() {
+	enqueue, err := GenerateHeightRangeEnqueueFunction(context.Background(), config.IndexConfig{}, dbTypes.HeightRange{Start: 5, End: 7}, false, true)
+	suite.Require().NoError(err)
+
+	blockChan := make(chan *EnqueueData, 10)
+	suite.Require().NoError(enqueue(blockChan))
+	close(blockChan)
+
+	var enqueued []EnqueueData
+	for data := range blockChan {
+		enqueued = append(enqueued, *data)
+	}
+	suite.Assert().Equal([]EnqueueData{
+		{Height: 5, IndexBlockEvents: true},
+		{Height: 6, IndexBlockEvents: true},
+		{Height: 7, IndexBlockEvents: true},
+	}, enqueued)
+
+	_, err = GenerateHeightRangeEnqueueFunction(context.Background(), config.IndexConfig{}, dbTypes.HeightsFrom(5), true, true)
+	suite.Assert().Error(err)
+}
+
+func TestBlockEnqueueSuite(t *testing.T) {
+	suite.Run(t, new(BlockEnqueueTestSuite))
+}
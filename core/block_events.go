@@ -1,7 +1,7 @@
 package core
 
 import (
-	"encoding/base64"
+	"fmt"
 
 	abci "github.com/cometbft/cometbft/abci/types"
 
@@ -22,27 +22,35 @@ func ProcessRPCBlockResults(conf config.IndexConfig, block models.Block, blockRe
 	blockDBWrapper.UniqueBlockEventTypes = make(map[string]models.BlockEventType)
 
 	var err error
-	blockDBWrapper.BeginBlockEvents, err = ProcessRPCBlockEvents(blockDBWrapper.Block, blockResults.BeginBlockEvents, models.BeginBlockEvent, blockDBWrapper.UniqueBlockEventTypes, blockDBWrapper.UniqueBlockEventAttributeKeys, customBeginBlockParsers, conf)
+	var quarantined []models.QuarantinedAttribute
+	blockDBWrapper.BeginBlockEvents, quarantined, err = ProcessRPCBlockEvents(blockDBWrapper.Block, blockResults.BeginBlockEvents, models.BeginBlockEvent, blockDBWrapper.UniqueBlockEventTypes, blockDBWrapper.UniqueBlockEventAttributeKeys, customBeginBlockParsers, conf)
 
 	if err != nil {
 		return nil, err
 	}
+	blockDBWrapper.QuarantinedAttributes = append(blockDBWrapper.QuarantinedAttributes, quarantined...)
 
-	blockDBWrapper.EndBlockEvents, err = ProcessRPCBlockEvents(blockDBWrapper.Block, blockResults.EndBlockEvents, models.EndBlockEvent, blockDBWrapper.UniqueBlockEventTypes, blockDBWrapper.UniqueBlockEventAttributeKeys, customEndBlockParsers, conf)
+	blockDBWrapper.EndBlockEvents, quarantined, err = ProcessRPCBlockEvents(blockDBWrapper.Block, blockResults.EndBlockEvents, models.EndBlockEvent, blockDBWrapper.UniqueBlockEventTypes, blockDBWrapper.UniqueBlockEventAttributeKeys, customEndBlockParsers, conf)
 
 	if err != nil {
 		return nil, err
 	}
+	blockDBWrapper.QuarantinedAttributes = append(blockDBWrapper.QuarantinedAttributes, quarantined...)
 
 	return &blockDBWrapper, nil
 }
 
-func ProcessRPCBlockEvents(block *models.Block, blockEvents []abci.Event, blockLifecyclePosition models.BlockLifecyclePosition, uniqueEventTypes map[string]models.BlockEventType, uniqueAttributeKeys map[string]models.BlockEventAttributeKey, customParsers map[string][]parsers.BlockEventParser, conf config.IndexConfig) ([]db.BlockEventDBWrapper, error) {
+// ProcessRPCBlockEvents builds the block event wrappers for one lifecycle position. Attributes that cannot be decoded with
+// the configured encoding are left out of their event and returned as quarantined, unless the policy is fail.
+func ProcessRPCBlockEvents(block *models.Block, blockEvents []abci.Event, blockLifecyclePosition models.BlockLifecyclePosition, uniqueEventTypes map[string]models.BlockEventType, uniqueAttributeKeys map[string]models.BlockEventAttributeKey, customParsers map[string][]parsers.BlockEventParser, conf config.IndexConfig) ([]db.BlockEventDBWrapper, []models.QuarantinedAttribute, error) {
 	beginBlockEvents := make([]db.BlockEventDBWrapper, len(blockEvents))
+	var quarantined []models.QuarantinedAttribute
+
+	encoding := attributeEncoding(conf)
 
 	for index, event := range blockEvents {
 		eventType := models.BlockEventType{
-			Type: event.Type,
+			Type: sanitizeLookupValue(event.Type),
 		}
 		beginBlockEvents[index].BlockEvent = models.BlockEvent{
 			Index:             uint64(index),
@@ -51,42 +59,50 @@ func ProcessRPCBlockEvents(block *models.Block, blockEvents []abci.Event, blockL
 			BlockEventType:    eventType,
 		}
 
-		uniqueEventTypes[event.Type] = eventType
+		uniqueEventTypes[eventType.Type] = eventType
 
-		beginBlockEvents[index].Attributes = make([]models.BlockEventAttribute, len(event.Attributes))
+		beginBlockEvents[index].Attributes = make([]models.BlockEventAttribute, 0, len(event.Attributes))
+		eventEncoding := eventAttributeEncoding(event, encoding)
 
 		for attrIndex, attribute := range event.Attributes {
-
-			var value string
-			var keyItem string
-			if conf.Flags.BlockEventsBase64Encoded {
-				// Should we even be decoding these from base64? What are the implications?
-				valueBytes, err := base64.StdEncoding.DecodeString(attribute.Value)
-				if err != nil {
-					return nil, err
-				}
-
-				keyBytes, err := base64.StdEncoding.DecodeString(attribute.Key)
-				if err != nil {
-					return nil, err
+			keyItem, value, err := decodeAttribute(attribute, eventEncoding)
+			if err != nil {
+				if conf.Flags.UnrecognizedAttributePolicy == config.UnrecognizedAttributePolicyFail {
+					return nil, nil, fmt.Errorf("%w: %s event %d attribute %d: %s", ErrUnrecognizedAttribute, eventType.Type, index, attrIndex, err)
 				}
 
-				value = string(valueBytes)
-				keyItem = string(keyBytes)
-			} else {
-				value = attribute.Value
-				keyItem = attribute.Key
+				config.Log.Warnf("Quarantining unrecognized %s attribute %d of %s event %d at height %d on chain %d: %s", eventEncoding, attrIndex, eventType.Type, index, block.Height, block.ChainID, err)
+				quarantined = append(quarantined, models.QuarantinedAttribute{
+					ChainID:           block.ChainID,
+					EventType:         eventType.Type,
+					Height:            block.Height,
+					LifecyclePosition: blockLifecyclePosition,
+					EventIndex:        uint64(index),
+					AttributeIndex:    uint64(attrIndex),
+					RawKey:            []byte(attribute.Key),
+					RawValue:          []byte(attribute.Value),
+					Reason:            err.Error(),
+				})
+				continue
 			}
 
 			key := models.BlockEventAttributeKey{
-				Key: keyItem,
+				Key: sanitizeLookupValue(keyItem),
+			}
+
+			sanitized, err := sanitizeAttributeValue(value, conf.Flags.InvalidTextPolicy)
+			if err != nil {
+				return nil, nil, err
 			}
 
-			beginBlockEvents[index].Attributes[attrIndex] = models.BlockEventAttribute{
-				Value:                  value,
+			// The index is the position in the RPC response, so it stays stable when earlier attributes are quarantined
+			beginBlockEvents[index].Attributes = append(beginBlockEvents[index].Attributes, models.BlockEventAttribute{
+				Value:                  sanitized.Value,
+				ValueBytes:             sanitized.ValueBytes,
+				Sanitized:              sanitized.Sanitized,
 				BlockEventAttributeKey: key,
 				Index:                  uint64(attrIndex),
-			}
+			})
 
 			uniqueAttributeKeys[key.Key] = key
 
@@ -108,7 +124,7 @@ func ProcessRPCBlockEvents(block *models.Block, blockEvents []abci.Event, blockL
 
 	}
 
-	return beginBlockEvents, nil
+	return beginBlockEvents, quarantined, nil
 }
 
 func FilterRPCBlockEvents(blockEvents []db.BlockEventDBWrapper, filterRegistry filter.StaticBlockEventFilterRegistry) ([]db.BlockEventDBWrapper, error) {
@@ -0,0 +1,102 @@
+package core
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type coalesceKey struct {
+	chainID string
+	height  int64
+}
+
+type inFlightFetch struct {
+	request EnqueueData
+	done    chan struct{}
+	result  IndexerBlockEventData
+	err     error
+
+	// The requests that joined the fetch are numbered from 1, the fetching request is 0. The one with the highest priority,
+	// the first of them on a tie, passes the result on.
+	joined   int
+	leader   int
+	priority FetchPriority
+}
+
+// FetchCoalescer shares a single RPC fetch between concurrent requests for the same height on the same chain, for example a
+// failed block reattempt racing the regular enqueue for that height across RPC workers. Results are only shared while the
+// fetch is in flight, nothing is cached once it completes.
+type FetchCoalescer struct {
+	mu        sync.Mutex
+	inFlight  map[coalesceKey]*inFlightFetch
+	coalesced atomic.Int64
+}
+
+func NewFetchCoalescer() *FetchCoalescer {
+	return &FetchCoalescer{
+		inFlight: make(map[coalesceKey]*inFlightFetch),
+	}
+}
+
+// Do runs fetch for the request unless a fetch for the same chain and height that covers the request (it fetches at least the
+// same block events and transactions) is already in flight, in which case it waits for and returns that fetch's result.
+// leader is true for a single caller of the coalesced group, so the result is passed on for processing once: the caller
+// whose request has the highest priority, the one whose fetch ran unless a request of a higher priority joined it.
+// A nil FetchCoalescer always runs fetch.
+func (c *FetchCoalescer) Do(chainID string, request EnqueueData, fetch func() (IndexerBlockEventData, error)) (result IndexerBlockEventData, leader bool, err error) {
+	if c == nil {
+		result, err = fetch()
+		return result, true, err
+	}
+
+	key := coalesceKey{chainID: chainID, height: request.Height}
+
+	c.mu.Lock()
+	if existing, ok := c.inFlight[key]; ok {
+		if covers(existing.request, request) {
+			existing.joined++
+			joined := existing.joined
+			if request.Priority > existing.priority {
+				existing.leader = joined
+				existing.priority = request.Priority
+			}
+			c.mu.Unlock()
+			c.coalesced.Add(1)
+			<-existing.done
+			return existing.result, existing.leader == joined, existing.err
+		}
+
+		// The in flight fetch is missing data this request needs, fetch independently without replacing it
+		c.mu.Unlock()
+		result, err = fetch()
+		return result, true, err
+	}
+
+	current := &inFlightFetch{request: request, done: make(chan struct{}), priority: request.Priority}
+	c.inFlight[key] = current
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.inFlight, key)
+		// No request joins once the fetch is out of the map, the leader is settled
+		leader = current.leader == 0
+		c.mu.Unlock()
+		close(current.done)
+	}()
+
+	current.result, current.err = fetch()
+	return current.result, false, current.err
+}
+
+// Coalesced returns the number of requests that were served by another request's fetch
+func (c *FetchCoalescer) Coalesced() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.coalesced.Load()
+}
+
+func covers(inFlight EnqueueData, request EnqueueData) bool {
+	return (inFlight.IndexBlockEvents || !request.IndexBlockEvents) && (inFlight.IndexTransactions || !request.IndexTransactions)
+}
@@ -0,0 +1,212 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+const (
+	coalesceWaitTimeout = 5 * time.Second
+	coalesceWaitTick    = 10 * time.Millisecond
+)
+
+type CoalesceTestSuite struct {
+	suite.Suite
+}
+
+// Overlapping ranges enqueued by concurrent workers while every fetch is held in flight
+func (suite *CoalesceTestSuite) TestOverlappingRequestsFetchOncePerHeight() {
+	coalescer := NewFetchCoalescer()
+
+	var fetches sync.Map
+	var leaders atomic.Int64
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+
+	ranges := [][2]int64{{1, 10}, {5, 15}, {1, 15}}
+	requests := 0
+	for _, heights := range ranges {
+		requests += int(heights[1] - heights[0] + 1)
+	}
+
+	for _, heights := range ranges {
+		for height := heights[0]; height <= heights[1]; height++ {
+			wg.Add(1)
+			go func(height int64) {
+				defer wg.Done()
+				request := EnqueueData{Height: height, IndexBlockEvents: true, IndexTransactions: true}
+
+				_, leader, err := coalescer.Do("testchain-1", request, func() (IndexerBlockEventData, error) {
+					count, _ := fetches.LoadOrStore(height, new(atomic.Int64))
+					count.(*atomic.Int64).Add(1)
+					<-release
+					return IndexerBlockEventData{IndexBlockEvents: true, IndexTransactions: true}, nil
+				})
+				if leader {
+					leaders.Add(1)
+				}
+				suite.Assert().NoError(err)
+			}(height)
+		}
+	}
+
+	// Hold every fetch in flight until all overlapping requests have joined one
+	suite.Eventually(func() bool { return coalescer.Coalesced() == int64(requests-15) }, coalesceWaitTimeout, coalesceWaitTick)
+	close(release)
+	wg.Wait()
+
+	for height := int64(1); height <= 15; height++ {
+		count, ok := fetches.Load(height)
+		suite.Require().True(ok)
+		suite.Assert().Equal(int64(1), count.(*atomic.Int64).Load(), "height %d", height)
+	}
+
+	suite.Assert().Equal(int64(15), leaders.Load())
+	suite.Assert().Equal(int64(requests-15), coalescer.Coalesced())
+}
+
+func (suite *CoalesceTestSuite) TestFollowerReceivesLeaderResult() {
+	coalescer := NewFetchCoalescer()
+	fetchErr := errors.New("block not found")
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+
+	go func() {
+		_, _, _ = coalescer.Do("testchain-1", EnqueueData{Height: 1, IndexTransactions: true}, func() (IndexerBlockEventData, error) {
+			close(inFlight)
+			<-release
+			return IndexerBlockEventData{}, fetchErr
+		})
+	}()
+	<-inFlight
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, leader, err := coalescer.Do("testchain-1", EnqueueData{Height: 1, IndexTransactions: true}, func() (IndexerBlockEventData, error) {
+			suite.Fail("follower should not fetch")
+			return IndexerBlockEventData{}, nil
+		})
+		suite.Assert().False(leader)
+		suite.Assert().ErrorIs(err, fetchErr)
+	}()
+
+	suite.Eventually(func() bool { return coalescer.Coalesced() == 1 }, coalesceWaitTimeout, coalesceWaitTick)
+	close(release)
+	<-done
+}
+
+func (suite *CoalesceTestSuite) TestDoesNotCoalesceUncoveredRequests() {
+	coalescer := NewFetchCoalescer()
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		_, _, _ = coalescer.Do("testchain-1", EnqueueData{Height: 1, IndexBlockEvents: true}, func() (IndexerBlockEventData, error) {
+			close(inFlight)
+			<-release
+			return IndexerBlockEventData{}, nil
+		})
+	}()
+	<-inFlight
+
+	// The in flight fetch does not include transactions, and a different chain never shares a fetch
+	for _, request := range []struct {
+		chainID string
+		data    EnqueueData
+	}{
+		{"testchain-1", EnqueueData{Height: 1, IndexBlockEvents: true, IndexTransactions: true}},
+		{"testchain-2", EnqueueData{Height: 1, IndexBlockEvents: true}},
+	} {
+		fetched := false
+		_, leader, err := coalescer.Do(request.chainID, request.data, func() (IndexerBlockEventData, error) {
+			fetched = true
+			return IndexerBlockEventData{}, nil
+		})
+		suite.Require().NoError(err)
+		suite.Assert().True(leader)
+		suite.Assert().True(fetched)
+	}
+
+	close(release)
+	<-done
+
+	// Completed fetches are not cached
+	fetched := false
+	_, leader, _ := coalescer.Do("testchain-1", EnqueueData{Height: 1, IndexBlockEvents: true}, func() (IndexerBlockEventData, error) {
+		fetched = true
+		return IndexerBlockEventData{}, nil
+	})
+	suite.Assert().True(leader)
+	suite.Assert().True(fetched)
+	suite.Assert().Equal(int64(0), coalescer.Coalesced())
+}
+
+func (suite *CoalesceTestSuite) TestHighestPriorityPassesResultOn() {
+	coalescer := NewFetchCoalescer()
+	inFlight := make(chan struct{})
+	release := make(chan struct{})
+
+	type outcome struct {
+		priority FetchPriority
+		leader   bool
+	}
+	outcomes := make(chan outcome, 4)
+	do := func(priority FetchPriority) {
+		_, leader, err := coalescer.Do("testchain-1", EnqueueData{Height: 1, IndexTransactions: true, Priority: priority}, func() (IndexerBlockEventData, error) {
+			close(inFlight)
+			<-release
+			return IndexerBlockEventData{}, nil
+		})
+		suite.Assert().NoError(err)
+		outcomes <- outcome{priority: priority, leader: leader}
+	}
+
+	// The gap backfill fetches the height, then a failed block reattempt of the head and a second backfill request join it
+	go do(PriorityBackfill)
+	<-inFlight
+	go do(PriorityHead)
+	suite.Eventually(func() bool { return coalescer.Coalesced() == 1 }, coalesceWaitTimeout, coalesceWaitTick)
+	go do(PriorityBackfill)
+	suite.Eventually(func() bool { return coalescer.Coalesced() == 2 }, coalesceWaitTimeout, coalesceWaitTick)
+	close(release)
+
+	leaders := map[FetchPriority]int{}
+	for i := 0; i < 3; i++ {
+		result := <-outcomes
+		if result.leader {
+			leaders[result.priority]++
+		}
+	}
+	suite.Assert().Equal(map[FetchPriority]int{PriorityHead: 1}, leaders)
+
+	// Without a higher priority request the fetching request stays the leader
+	inFlight = make(chan struct{})
+	release = make(chan struct{})
+	go do(PriorityHead)
+	<-inFlight
+	go do(PriorityBackfill)
+	suite.Eventually(func() bool { return coalescer.Coalesced() == 3 }, coalesceWaitTimeout, coalesceWaitTick)
+	close(release)
+
+	leaders = map[FetchPriority]int{}
+	for i := 0; i < 2; i++ {
+		result := <-outcomes
+		if result.leader {
+			leaders[result.priority]++
+		}
+	}
+	suite.Assert().Equal(map[FetchPriority]int{PriorityHead: 1}, leaders)
+}
+
+func TestCoalesceSuite(t *testing.T) {
+	suite.Run(t, new(CoalesceTestSuite))
+}
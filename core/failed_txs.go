@@ -0,0 +1,106 @@
+package core
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/probe/client"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
+	"gorm.io/gorm"
+)
+
+// GenerateFailedTxsEnqueueFunction enqueues the blocks between start and end block whose failed txs or messages now decode
+// with the codec of the client, e.g. after a proto definition was added or fixed, so they are indexed fully.
+// See base.reprocess-failed-txs.
+func GenerateFailedTxsEnqueueFunction(ctx context.Context, db *gorm.DB, cfg config.IndexConfig, client *client.ChainClient, chainID uint) (func(chan *EnqueueData) error, error) {
+	startBlock := cfg.Base.StartBlock
+	if startBlock < 1 {
+		startBlock = 1
+	}
+	heights, err := dbTypes.NewHeightRange(startBlock, cfg.Base.EndBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := ReprocessableFailedTxHeights(ctx, db, client, dbTypes.ChainRef{ID: chainID, ChainID: cfg.Probe.ChainID}, heights)
+	if err != nil {
+		config.Log.Errorf("Error checking DB for failed txs to reprocess. Err: %v", err)
+		return nil, err
+	}
+	config.Log.Infof("Found %d blocks with failed txs or messages that now decode", len(blocks))
+
+	return func(blockChan chan *EnqueueData) error {
+		for _, block := range blocks {
+			config.Log.Debugf("Sending block %v to be re-indexed.", block)
+
+			if cfg.Base.Throttling != 0 {
+				time.Sleep(time.Second * time.Duration(cfg.Base.Throttling))
+			}
+
+			blockChan <- &EnqueueData{
+				IndexBlockEvents:  false,
+				IndexTransactions: true,
+				Height:            block,
+			}
+		}
+		return nil
+	}, nil
+}
+
+// ReprocessableFailedTxHeights re-decodes the stored bytes of the failed txs and messages of the chain within the height range
+// with the codec of the client. Returns the heights of the blocks with at least one of them that now decodes, in order.
+func ReprocessableFailedTxHeights(ctx context.Context, db *gorm.DB, client *client.ChainClient, chain dbTypes.ChainRef, heights dbTypes.HeightRange) ([]int64, error) {
+	failedTxs, err := dbTypes.GetFailedTxs(ctx, db, chain, heights)
+	if err != nil {
+		return nil, err
+	}
+
+	failedMessages, err := dbTypes.GetFailedMessages(ctx, db, chain, heights)
+	if err != nil {
+		return nil, err
+	}
+
+	reprocess := make(map[int64]bool)
+	for _, failedTx := range failedTxs {
+		if failedTxDecodes(client, failedTx) {
+			reprocess[failedTx.Block.Height] = true
+		}
+	}
+	for _, failedMessage := range failedMessages {
+		if failedMessageDecodes(client, failedMessage) {
+			reprocess[failedMessage.Tx.Block.Height] = true
+		}
+	}
+
+	var blocks []int64
+	for height := range reprocess {
+		blocks = append(blocks, height)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	return blocks, nil
+}
+
+// failedTxDecodes reports whether the stored tx decodes with either of the decoders of ProcessRPCBlockByHeightTXs
+func failedTxDecodes(client *client.ChainClient, failedTx models.FailedTx) bool {
+	if len(failedTx.TxBytes) == 0 {
+		return false
+	}
+	if _, err := client.Codec.TxConfig.TxDecoder()(failedTx.TxBytes); err == nil {
+		return true
+	}
+	_, err := InAppTxDecoder(client.Codec)(failedTx.TxBytes)
+	return err == nil
+}
+
+// failedMessageDecodes reports whether the stored message unpacks into a registered message type
+func failedMessageDecodes(client *client.ChainClient, failedMessage models.FailedMessage) bool {
+	if failedMessage.TypeURL == "" {
+		return false
+	}
+	_, err := unpackMessage(client, &codectypes.Any{TypeUrl: failedMessage.TypeURL, Value: failedMessage.MessageBytes})
+	return err == nil
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	"github.com/DefiantLabs/probe/client"
+	"gorm.io/gorm"
+)
+
+// BlockFetchPool fetches the enqueued blocks with concurrent RPC workers and passes them on in the order they were
+// enqueued, so the blocks are processed and written in height order while they are fetched out of order.
+//
+// At most Window blocks are in flight between the enqueue channel and the output channel, counting the blocks being
+// fetched and the blocks waiting in the reorder buffer for an earlier block. A stalled output channel stops the workers
+// once the window is full instead of buffering the fetched blocks.
+type BlockFetchPool struct {
+	Workers   int
+	RateLimit int64           // Blocks fetched per second by each worker, 0 for no limit
+	Window    int             // Blocks in flight, 4 per worker when 0
+	Pending   *PendingHeights // Tracks the dispatched heights, the ones not passed on are done unless ctx was cancelled
+	// Fetch returns the data of the block, false when there is nothing to pass on
+	Fetch func(ctx context.Context, block *EnqueueData) (IndexerBlockEventData, bool)
+}
+
+// NewBlockFetchPool returns a pool of workers fetching blocks like BlockRPCWorker does, with the rate limit of the config.
+// With a nil db the blocks that could not be fetched are not recorded as failed.
+func NewBlockFetchPool(workers int, chainStringID string, cfg *config.IndexConfig, chainClient *client.ChainClient, db *gorm.DB, coalescer *FetchCoalescer) *BlockFetchPool {
+	rpcClient := rpc.NewURIClient(chainClient)
+
+	return &BlockFetchPool{
+		Workers:   workers,
+		RateLimit: cfg.Base.RPCRateLimit,
+		Fetch: func(ctx context.Context, block *EnqueueData) (IndexerBlockEventData, bool) {
+			return fetchEnqueuedBlock(ctx, block, chainStringID, cfg, chainClient, rpcClient, db, coalescer)
+		},
+	}
+}
+
+type fetchJob struct {
+	seq   uint64
+	block *EnqueueData
+}
+
+type fetchResult struct {
+	seq  uint64
+	data IndexerBlockEventData
+	ok   bool
+}
+
+// Run fetches the blocks of blockEnqueueChan until it is closed or ctx is cancelled, then closes outputChannel. Once ctx
+// is cancelled no more blocks are dispatched, the blocks already fetched are still passed on.
+func (p *BlockFetchPool) Run(ctx context.Context, blockEnqueueChan chan *EnqueueData, outputChannel chan IndexerBlockEventData) {
+	defer close(outputChannel)
+
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	window := p.Window
+	if window < 1 {
+		window = 4 * workers
+	}
+
+	// A slot is taken when a block is dispatched and released once the block leaves the reorder buffer
+	slots := make(chan struct{}, window)
+	jobs := make(chan fetchJob)
+	results := make(chan fetchResult, workers)
+
+	go func() {
+		defer close(jobs)
+		var seq uint64
+		for {
+			var block *EnqueueData
+			select {
+			case next, ok := <-blockEnqueueChan:
+				if !ok {
+					return
+				}
+				block = next
+			case <-ctx.Done():
+				return
+			}
+
+			p.Pending.Add(block.Height)
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			jobs <- fetchJob{seq: seq, block: block}
+			seq++
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx, jobs, results)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// Workers finish out of order, blocks wait here for the blocks enqueued before them
+	pending := make(map[uint64]fetchResult, window)
+	var next uint64
+	for result := range results {
+		pending[result.seq] = result
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if ready.ok {
+				outputChannel <- ready.data
+			}
+			<-slots
+		}
+	}
+}
+
+func (p *BlockFetchPool) work(ctx context.Context, jobs chan fetchJob, results chan fetchResult) {
+	var interval time.Duration
+	if p.RateLimit > 0 {
+		interval = time.Second / time.Duration(p.RateLimit)
+	}
+
+	var last time.Time
+	for job := range jobs {
+		if wait := interval - time.Since(last); interval > 0 && wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+			}
+		}
+		last = time.Now()
+
+		data, ok := p.Fetch(ctx, job.block)
+		// A fetch cut short by the shutdown leaves its height abandoned
+		if !ok && ctx.Err() == nil {
+			p.Pending.Done(job.block.Height)
+		}
+		results <- fetchResult{seq: job.seq, data: data, ok: ok}
+	}
+}
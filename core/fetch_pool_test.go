@@ -0,0 +1,229 @@
+package core
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	cmttypes "github.com/cometbft/cometbft/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type FetchPoolTestSuite struct {
+	suite.Suite
+}
+
+func fetchedBlock(height int64) IndexerBlockEventData {
+	return IndexerBlockEventData{BlockData: &ctypes.ResultBlock{Block: &cmttypes.Block{Header: cmttypes.Header{Height: height}}}}
+}
+
+func (suite *FetchPoolTestSuite) TestOrderedDelivery() {
+	pool := &BlockFetchPool{
+		Workers: 4,
+		Fetch: func(ctx context.Context, block *EnqueueData) (IndexerBlockEventData, bool) {
+			// Earlier blocks take longer, so the workers finish out of order
+			time.Sleep(time.Duration(10-block.Height%10) * time.Millisecond)
+			return fetchedBlock(block.Height), block.Height != 7
+		},
+	}
+
+	blockChan := make(chan *EnqueueData, 20)
+	for height := int64(1); height <= 20; height++ {
+		blockChan <- &EnqueueData{Height: height}
+	}
+	close(blockChan)
+
+	output := make(chan IndexerBlockEventData)
+	go pool.Run(context.Background(), blockChan, output)
+
+	var heights []int64
+	for data := range output {
+		heights = append(heights, data.BlockData.Block.Height)
+	}
+
+	// Blocks that were not fetched are skipped without holding back the others
+	var expected []int64
+	for height := int64(1); height <= 20; height++ {
+		if height != 7 {
+			expected = append(expected, height)
+		}
+	}
+	suite.Assert().Equal(expected, heights)
+}
+
+func (suite *FetchPoolTestSuite) TestBackPressure() {
+	var fetched atomic.Int64
+	pool := &BlockFetchPool{
+		Workers: 2,
+		Window:  3,
+		Fetch: func(ctx context.Context, block *EnqueueData) (IndexerBlockEventData, bool) {
+			fetched.Add(1)
+			return fetchedBlock(block.Height), true
+		},
+	}
+
+	blockChan := make(chan *EnqueueData, 20)
+	for height := int64(1); height <= 20; height++ {
+		blockChan <- &EnqueueData{Height: height}
+	}
+	close(blockChan)
+
+	// Nothing reads the output, the pool stops once the window is full
+	output := make(chan IndexerBlockEventData)
+	go pool.Run(context.Background(), blockChan, output)
+
+	time.Sleep(50 * time.Millisecond)
+	suite.Assert().Equal(int64(3), fetched.Load())
+
+	suite.Assert().Equal(int64(1), (<-output).BlockData.Block.Height)
+	time.Sleep(50 * time.Millisecond)
+	suite.Assert().Equal(int64(4), fetched.Load())
+
+	for range output {
+	}
+	suite.Assert().Equal(int64(20), fetched.Load())
+}
+
+func (suite *FetchPoolTestSuite) TestRateLimit() {
+	pool := &BlockFetchPool{
+		Workers:   1,
+		RateLimit: 20,
+		Fetch: func(ctx context.Context, block *EnqueueData) (IndexerBlockEventData, bool) {
+			return fetchedBlock(block.Height), true
+		},
+	}
+
+	blockChan := make(chan *EnqueueData, 5)
+	for height := int64(1); height <= 5; height++ {
+		blockChan <- &EnqueueData{Height: height}
+	}
+	close(blockChan)
+
+	output := make(chan IndexerBlockEventData, 5)
+	start := time.Now()
+	pool.Run(context.Background(), blockChan, output)
+
+	// The first block is fetched right away, the others 50ms apart
+	suite.Assert().GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+	suite.Assert().Len(output, 5)
+}
+
+func (suite *FetchPoolTestSuite) TestMergeBlockData() {
+	head := make(chan IndexerBlockEventData, 3)
+	gaps := make(chan IndexerBlockEventData, 3)
+	for i := int64(1); i <= 3; i++ {
+		head <- fetchedBlock(100 + i)
+		gaps <- fetchedBlock(i)
+	}
+
+	output := make(chan IndexerBlockEventData)
+	go MergeBlockData(context.Background(), head, gaps, output)
+
+	// The ready blocks of the head are passed on before the gaps
+	var heights []int64
+	for i := 0; i < 4; i++ {
+		heights = append(heights, (<-output).BlockData.Block.Height)
+	}
+	suite.Assert().Equal([]int64{101, 102, 103, 1}, heights)
+
+	// The gaps keep going once the head is closed, the output is closed once both are
+	close(head)
+	gaps <- fetchedBlock(4)
+	close(gaps)
+	heights = nil
+	for data := range output {
+		heights = append(heights, data.BlockData.Block.Height)
+	}
+	suite.Assert().Equal([]int64{2, 3, 4}, heights)
+}
+
+func (suite *FetchPoolTestSuite) TestMergeBlockDataCancelled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	output := make(chan IndexerBlockEventData)
+	done := make(chan struct{})
+	go func() {
+		MergeBlockData(ctx, make(chan IndexerBlockEventData), make(chan IndexerBlockEventData), output)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		suite.Fail("MergeBlockData did not return after ctx was cancelled")
+	}
+	_, ok := <-output
+	suite.Assert().False(ok)
+}
+
+func (suite *FetchPoolTestSuite) TestPendingHeights() {
+	pending := &PendingHeights{}
+	pool := &BlockFetchPool{
+		Workers: 2,
+		Pending: pending,
+		Fetch: func(ctx context.Context, block *EnqueueData) (IndexerBlockEventData, bool) {
+			return fetchedBlock(block.Height), block.Height != 3
+		},
+	}
+
+	blockChan := make(chan *EnqueueData, 5)
+	for height := int64(1); height <= 5; height++ {
+		blockChan <- &EnqueueData{Height: height}
+	}
+	close(blockChan)
+
+	output := make(chan IndexerBlockEventData, 5)
+	pool.Run(context.Background(), blockChan, output)
+
+	// The failed block is done, the fetched ones are pending until the consumer is done with them
+	suite.Assert().Equal([]int64{1, 2, 4, 5}, pending.Heights())
+	for data := range output {
+		if data.BlockData.Block.Height%2 == 0 {
+			pending.Done(data.BlockData.Block.Height)
+		}
+	}
+	suite.Assert().Equal([]int64{1, 5}, pending.Heights())
+
+	// A height is pending until every reference to it is done
+	pending.Add(1)
+	pending.Done(1)
+	suite.Assert().Equal([]int64{1, 5}, pending.Heights())
+	pending.Done(1)
+	suite.Assert().Equal([]int64{5}, pending.Heights())
+}
+
+func (suite *FetchPoolTestSuite) TestRunCancelledWithEmptyQueue() {
+	pool := &BlockFetchPool{
+		Workers: 2,
+		Fetch: func(ctx context.Context, block *EnqueueData) (IndexerBlockEventData, bool) {
+			return fetchedBlock(block.Height), true
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	output := make(chan IndexerBlockEventData)
+	go pool.Run(ctx, make(chan *EnqueueData), output)
+
+	cancel()
+	select {
+	case _, ok := <-output:
+		suite.Assert().False(ok)
+	case <-time.After(time.Second):
+		suite.Fail("Run did not return after ctx was cancelled")
+	}
+}
+
+func (suite *FetchPoolTestSuite) TestContiguousRanges() {
+	suite.Assert().Empty(ContiguousRanges(nil))
+	suite.Assert().Equal(
+		[]dbTypes.HeightRange{{Start: 1, End: 3}, {Start: 5, End: 5}, {Start: 7, End: 8}},
+		ContiguousRanges([]int64{1, 2, 2, 3, 5, 7, 8}),
+	)
+}
+
+func TestFetchPoolSuite(t *testing.T) {
+	suite.Run(t, new(FetchPoolTestSuite))
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	"github.com/DefiantLabs/probe/client"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	cmttypes "github.com/cometbft/cometbft/types"
+)
+
+const followSubscriber = "cosmos-indexer"
+
+// blockFollower reports the latest height of the node to the default enqueue function
+type blockFollower interface {
+	// latestHeight returns the latest height of the node. Followers that are notified of new blocks wait until the
+	// height is above after, or until they fall back to polling.
+	latestHeight(ctx context.Context, after int64) (int64, error)
+	stop()
+}
+
+func newBlockFollower(cfg config.IndexConfig, cl *client.ChainClient) blockFollower {
+	poll := func() (int64, error) {
+		return rpc.GetLatestBlockHeightWithRetry(cl, cfg.Base.RequestRetryAttempts, cfg.Base.RequestRetryMaxWait)
+	}
+
+	// Exiting when caught up needs the height of the node right away, there is nothing to wait for
+	if cfg.Base.Follow != config.FollowWebsocket || cfg.Base.ExitWhenCaughtUp {
+		return pollFollower(poll)
+	}
+
+	return &websocketFollower{
+		cfg:  cfg,
+		poll: poll,
+		subscribe: func(ctx context.Context) (<-chan ctypes.ResultEvent, error) {
+			if !cl.RPCClient.IsRunning() {
+				if err := cl.RPCClient.Start(); err != nil {
+					return nil, err
+				}
+			}
+			return cl.RPCClient.Subscribe(ctx, followSubscriber, cmttypes.EventQueryNewBlockHeader.String())
+		},
+		unsubscribe: func() {
+			if err := cl.RPCClient.UnsubscribeAll(context.Background(), followSubscriber); err != nil {
+				cfg.ChainLog().Debugf("Error unsubscribing from new block headers: %v", err)
+			}
+		},
+		close: func() {
+			if cl.RPCClient.IsRunning() {
+				if err := cl.RPCClient.Stop(); err != nil {
+					cfg.ChainLog().Debugf("Error closing the websocket: %v", err)
+				}
+			}
+		},
+		timeout: time.Second * time.Duration(cfg.Base.FollowTimeout),
+	}
+}
+
+// pollFollower queries the latest height of the node every time
+type pollFollower func() (int64, error)
+
+func (f pollFollower) latestHeight(ctx context.Context, after int64) (int64, error) {
+	return f()
+}
+
+func (f pollFollower) stop() {}
+
+// websocketFollower follows the new block headers of the node over its websocket, and polls the node while the
+// subscription is down. Heights only raise the latest height the enqueue function goes up to, every height below it is
+// enqueued in order, so blocks produced while the websocket was down are not missed.
+type websocketFollower struct {
+	cfg         config.IndexConfig
+	poll        func() (int64, error)
+	subscribe   func(ctx context.Context) (<-chan ctypes.ResultEvent, error)
+	unsubscribe func()
+	close       func()
+	timeout     time.Duration
+
+	events     <-chan ctypes.ResultEvent // nil while polling
+	latest     int64
+	subscribed time.Time // last subscription attempt, subscribing again waits for the timeout
+}
+
+func (f *websocketFollower) latestHeight(ctx context.Context, after int64) (int64, error) {
+	if f.events == nil && time.Since(f.subscribed) >= f.timeout {
+		f.subscribed = time.Now()
+		events, err := f.subscribe(ctx)
+		if err != nil {
+			f.cfg.ChainLog().Warnf("Error subscribing to new block headers, polling the node until it is subscribed again: %v", err)
+		} else {
+			f.cfg.ChainLog().Info("Following new block headers over the websocket")
+			f.events = events
+			// Only new blocks are delivered, the blocks produced before subscribing are found by polling once
+			return f.pollLatest()
+		}
+	}
+
+	if f.events == nil {
+		return f.pollLatest()
+	}
+
+	// Heights delivered since the last call
+	for drained := false; !drained; {
+		select {
+		case event := <-f.events:
+			f.receive(event)
+		default:
+			drained = true
+		}
+	}
+
+	if f.latest > after {
+		return f.latest, nil
+	}
+
+	timer := time.NewTimer(f.timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return f.latest, nil
+		case event := <-f.events:
+			f.receive(event)
+			if f.latest > after {
+				return f.latest, nil
+			}
+		case <-timer.C:
+			// The subscription channel is never closed, a dropped websocket is silent
+			f.cfg.ChainLog().Warnf("No new block header over the websocket for %s, polling the node until it is subscribed again", f.timeout)
+			f.unsubscribe()
+			f.events = nil
+			f.subscribed = time.Now()
+			return f.pollLatest()
+		}
+	}
+}
+
+func (f *websocketFollower) pollLatest() (int64, error) {
+	latest, err := f.poll()
+	if err != nil {
+		return 0, err
+	}
+	f.latest = latest
+	return latest, nil
+}
+
+// receive records the height of a new block header. The height of a node restarted from an earlier state goes down, the
+// enqueue function waits until the node is back above the heights it already enqueued.
+func (f *websocketFollower) receive(event ctypes.ResultEvent) {
+	header, ok := event.Data.(cmttypes.EventDataNewBlockHeader)
+	if !ok {
+		return
+	}
+
+	height := header.Header.Height
+	switch {
+	case height == f.latest:
+		// Delivered again after the websocket reconnected
+	case height < f.latest:
+		f.cfg.ChainLog().Warnf("Node reported height %d below the latest height %d, it may have been restarted from an earlier state", height, f.latest)
+		f.latest = height
+	default:
+		f.latest = height
+	}
+}
+
+func (f *websocketFollower) stop() {
+	if f.events != nil {
+		f.unsubscribe()
+		f.events = nil
+	}
+	f.close()
+}
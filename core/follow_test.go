@@ -0,0 +1,130 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	cmttypes "github.com/cometbft/cometbft/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type FollowTestSuite struct {
+	suite.Suite
+	events       chan ctypes.ResultEvent
+	polled       int64
+	polls        int
+	subscribes   int
+	subscribeErr error
+	follower     *websocketFollower
+}
+
+func (suite *FollowTestSuite) SetupTest() {
+	suite.events = make(chan ctypes.ResultEvent, 10)
+	suite.polled = 10
+	suite.polls = 0
+	suite.subscribes = 0
+	suite.subscribeErr = nil
+	suite.follower = &websocketFollower{
+		poll: func() (int64, error) {
+			suite.polls++
+			return suite.polled, nil
+		},
+		subscribe: func(ctx context.Context) (<-chan ctypes.ResultEvent, error) {
+			suite.subscribes++
+			if suite.subscribeErr != nil {
+				return nil, suite.subscribeErr
+			}
+			return suite.events, nil
+		},
+		unsubscribe: func() {},
+		close:       func() {},
+		timeout:     50 * time.Millisecond,
+	}
+}
+
+func (suite *FollowTestSuite) send(heights ...int64) {
+	for _, height := range heights {
+		suite.events <- ctypes.ResultEvent{Data: cmttypes.EventDataNewBlockHeader{Header: cmttypes.Header{Height: height}}}
+	}
+}
+
+func (suite *FollowTestSuite) TestFollow() {
+	ctx := context.Background()
+
+	// The height at subscription is polled, blocks produced before subscribing are not delivered
+	latest, err := suite.follower.latestHeight(ctx, 5)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(10), latest)
+
+	// Caught up, duplicate deliveries are skipped until a new block arrives
+	suite.send(10, 10, 11)
+	latest, err = suite.follower.latestHeight(ctx, 10)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(11), latest)
+
+	// A node restarted at a lower height is waited out
+	suite.send(8, 9, 11, 12)
+	latest, err = suite.follower.latestHeight(ctx, 11)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(12), latest)
+
+	// Still behind the delivered heights, nothing to wait for
+	latest, err = suite.follower.latestHeight(ctx, 11)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(12), latest)
+
+	suite.Assert().Equal(1, suite.polls)
+	suite.Assert().Equal(1, suite.subscribes)
+}
+
+func (suite *FollowTestSuite) TestFallBackToPolling() {
+	ctx := context.Background()
+	_, err := suite.follower.latestHeight(ctx, 5)
+	suite.Require().NoError(err)
+
+	// A silent websocket times out and the node is polled
+	suite.polled = 15
+	latest, err := suite.follower.latestHeight(ctx, 10)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(15), latest)
+	suite.Assert().Nil(suite.follower.events)
+
+	// Subscribing again waits for the timeout, failures keep polling
+	suite.subscribeErr = errors.New("connection refused")
+	suite.polled = 16
+	latest, err = suite.follower.latestHeight(ctx, 15)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(16), latest)
+	suite.Assert().Equal(1, suite.subscribes)
+
+	time.Sleep(suite.follower.timeout)
+	_, err = suite.follower.latestHeight(ctx, 16)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(2, suite.subscribes)
+
+	// Once subscribed again, the height is polled so the blocks of the outage are enqueued
+	suite.subscribeErr = nil
+	suite.polled = 20
+	time.Sleep(suite.follower.timeout)
+	latest, err = suite.follower.latestHeight(ctx, 16)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(20), latest)
+	suite.Assert().Equal(3, suite.subscribes)
+	suite.Assert().NotNil(suite.follower.events)
+}
+
+func (suite *FollowTestSuite) TestPollWhenExitingCaughtUp() {
+	cfg := config.IndexConfig{}
+	cfg.Base.Follow = config.FollowWebsocket
+	cfg.Base.ExitWhenCaughtUp = true
+	_, ok := newBlockFollower(cfg, nil).(pollFollower)
+	suite.Assert().True(ok)
+}
+
+func TestFollowSuite(t *testing.T) {
+	suite.Run(t, new(FollowTestSuite))
+}
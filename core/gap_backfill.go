@@ -0,0 +1,113 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"gorm.io/gorm"
+)
+
+// gapProgressInterval is the interval between the progress logs of the gap backfill
+const gapProgressInterval = time.Minute
+
+// GenerateGapEnqueueFunction enqueues the heights of the range that are not fully indexed under the config, see
+// dbTypes.GetMissingBlockRanges, for the gap backfill running below the head of the chain. The gaps are found once, the
+// enqueue function returns once all of them were enqueued. m may be nil.
+func GenerateGapEnqueueFunction(ctx context.Context, db *gorm.DB, cfg config.IndexConfig, chain dbTypes.ChainRef, heights dbTypes.HeightRange, m *metrics.Metrics) (func(chan *EnqueueData) error, error) {
+	requirements := dbTypes.CompletenessRequirements{Transactions: cfg.Base.TransactionIndexingEnabled, BlockEvents: cfg.Base.BlockEventIndexingEnabled}
+	gaps, err := dbTypes.GetMissingBlockRanges(ctx, db, chain, heights, requirements)
+	if err != nil {
+		cfg.ChainLog().Errorf("Error finding the gaps to backfill. Err: %v", err)
+		return nil, err
+	}
+
+	var remaining int64
+	for _, gap := range gaps {
+		remaining += gap.Length
+	}
+
+	return func(blockChan chan *EnqueueData) error {
+		if m != nil {
+			m.SetGapBackfillRemaining(chain.ChainID, remaining)
+		}
+		if remaining == 0 {
+			cfg.ChainLog().Infof("No gaps to backfill in heights %s", heights)
+			return nil
+		}
+		cfg.ChainLog().Infof("Backfilling %d missing heights in %d gaps of heights %s", remaining, len(gaps), heights)
+
+		total := remaining
+		lastProgress := time.Now()
+		for _, gap := range gaps {
+			for height := gap.Start; height <= gap.End; height++ {
+				select {
+				case blockChan <- &EnqueueData{
+					Height:            height,
+					IndexBlockEvents:  cfg.Base.BlockEventIndexingEnabled,
+					IndexTransactions: cfg.Base.TransactionIndexingEnabled,
+					Priority:          PriorityBackfill,
+				}:
+				case <-ctx.Done():
+					cfg.ChainLog().Info("Indexer is shutting down, exiting gap backfill enqueue func.")
+					return nil
+				}
+
+				remaining--
+				if m != nil {
+					m.ObserveGapBackfillHeight(chain.ChainID, remaining)
+				}
+				if time.Since(lastProgress) >= gapProgressInterval {
+					cfg.ChainLog().Infof("Gap backfill enqueued %d of %d missing heights, at height %d", total-remaining, total, height)
+					lastProgress = time.Now()
+				}
+			}
+		}
+
+		cfg.ChainLog().Infof("Gap backfill enqueued all %d missing heights", total)
+		return nil
+	}, nil
+}
+
+// MergeBlockData passes the fetched blocks of the head and of the gap backfill on to the output, the blocks of the head
+// first when both are ready, so the backfill never holds back the head. The output is closed once both inputs are closed
+// or ctx is cancelled.
+func MergeBlockData(ctx context.Context, head <-chan IndexerBlockEventData, gaps <-chan IndexerBlockEventData, output chan<- IndexerBlockEventData) {
+	defer close(output)
+
+	for head != nil || gaps != nil {
+		var data IndexerBlockEventData
+		var ok bool
+
+		select {
+		case data, ok = <-head:
+			if !ok {
+				head = nil
+				continue
+			}
+		default:
+			select {
+			case data, ok = <-head:
+				if !ok {
+					head = nil
+					continue
+				}
+			case data, ok = <-gaps:
+				if !ok {
+					gaps = nil
+					continue
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case output <- data:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
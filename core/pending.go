@@ -0,0 +1,77 @@
+package core
+
+import (
+	"sort"
+	"sync"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+)
+
+// PendingHeights counts the references to the heights in the block pipeline, from the fetch to the DB writes of their
+// datasets. A height is added when it is dispatched to the fetch workers and once more for every dataset passed on to
+// the DB writes, and is done when each of them was indexed, recorded as failed or dropped. The heights still pending
+// once the pipeline stopped were abandoned and are indexed again on the next run. A nil PendingHeights tracks nothing.
+type PendingHeights struct {
+	mu      sync.Mutex
+	heights map[int64]int
+}
+
+// Add adds a reference to the height
+func (p *PendingHeights) Add(height int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.heights == nil {
+		p.heights = make(map[int64]int)
+	}
+	p.heights[height]++
+}
+
+// Done releases a reference to the height
+func (p *PendingHeights) Done(height int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.heights[height] <= 1 {
+		delete(p.heights, height)
+		return
+	}
+	p.heights[height]--
+}
+
+// Heights returns the pending heights in increasing order
+func (p *PendingHeights) Heights() []int64 {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	heights := make([]int64, 0, len(p.heights))
+	for height := range p.heights {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+	return heights
+}
+
+// ContiguousRanges returns the ranges of consecutive heights of the sorted heights, in order. Duplicates are allowed.
+func ContiguousRanges(heights []int64) []dbTypes.HeightRange {
+	var ranges []dbTypes.HeightRange
+	for _, height := range heights {
+		if last := len(ranges) - 1; last >= 0 && height <= ranges[last].End+1 {
+			if height > ranges[last].End {
+				ranges[last].End = height
+			}
+			continue
+		}
+		ranges = append(ranges, dbTypes.HeightRange{Start: height, End: height})
+	}
+	return ranges
+}
@@ -6,7 +6,9 @@ import (
 	"github.com/DefiantLabs/cosmos-indexer/config"
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
 	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	cmttypes "github.com/cometbft/cometbft/types"
 	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
 )
 
 type BlockProcessingFailure int
@@ -25,6 +27,13 @@ type FailedBlockHandler func(height int64, code BlockProcessingFailure, err erro
 
 // Process RPC Block data into the model object used by the application.
 func ProcessBlock(blockData *ctypes.ResultBlock, blockResultsData *ctypes.ResultBlockResults, chainID uint) (models.Block, error) {
+	return ProcessChainBlock(blockData, blockResultsData, chainID, "")
+}
+
+// ProcessChainBlock processes the block like ProcessBlock, encoding the consensus addresses with the valcons prefix of
+// the account prefix of the chain. The bech32 prefixes of the SDK are global to the process, they only match one of the
+// chains when several are indexed. An empty account prefix uses the SDK prefixes.
+func ProcessChainBlock(blockData *ctypes.ResultBlock, blockResultsData *ctypes.ResultBlockResults, chainID uint, accountPrefix string) (models.Block, error) {
 	block := models.Block{
 		Height:  blockData.Block.Height,
 		ChainID: chainID,
@@ -35,12 +44,55 @@ func ProcessBlock(blockData *ctypes.ResultBlock, blockResultsData *ctypes.Result
 		return block, err
 	}
 
-	block.ProposerConsAddress = models.Address{Address: propAddressFromHex.String()}
+	proposer, err := consAddress(accountPrefix, propAddressFromHex)
+	if err != nil {
+		return block, err
+	}
+
+	block.ProposerConsAddress = models.Address{Address: proposer}
 	block.TimeStamp = blockData.Block.Time
+	block.BlockHash = blockData.BlockID.Hash.String()
+	block.BlockSizeBytes = int64(blockData.Block.Size())
+	block.Signatures, err = processCommitSignatures(blockData.Block.LastCommit, accountPrefix)
+	if err != nil {
+		return block, err
+	}
 
 	return block, nil
 }
 
+// consAddress encodes the consensus address with the valcons prefix of the account prefix, the SDK prefix when it is empty
+func consAddress(accountPrefix string, address sdkTypes.ConsAddress) (string, error) {
+	if accountPrefix == "" {
+		return address.String(), nil
+	}
+	return bech32.ConvertAndEncode(accountPrefix+"valcons", address)
+}
+
+// processCommitSignatures returns the signatures of the commit by validator consensus address. Absent validators are left
+// out, their signature has no address.
+func processCommitSignatures(commit *cmttypes.Commit, accountPrefix string) ([]models.BlockSignature, error) {
+	if commit == nil {
+		return nil, nil
+	}
+
+	var signatures []models.BlockSignature
+	for _, signature := range commit.Signatures {
+		if signature.BlockIDFlag == cmttypes.BlockIDFlagAbsent || len(signature.ValidatorAddress) == 0 {
+			continue
+		}
+		validator, err := consAddress(accountPrefix, sdkTypes.ConsAddress(signature.ValidatorAddress))
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, models.BlockSignature{
+			Validator: models.Validator{ConsAddress: validator},
+			Signed:    signature.BlockIDFlag == cmttypes.BlockIDFlagCommit,
+		})
+	}
+	return signatures, nil
+}
+
 // Log error to stdout. Not much else we can do to handle right now.
 func HandleFailedBlock(height int64, code BlockProcessingFailure, err error) {
 	reason := "{unknown error}"
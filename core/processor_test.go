@@ -0,0 +1,49 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	cmttypes "github.com/cometbft/cometbft/types"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type ProcessorTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ProcessorTestSuite) TestProcessCommitSignatures() {
+	signer := []byte{0x01, 0x02, 0x03}
+	nilVoter := []byte{0x04, 0x05, 0x06}
+	commit := &cmttypes.Commit{
+		Height: 9,
+		Signatures: []cmttypes.CommitSig{
+			{BlockIDFlag: cmttypes.BlockIDFlagCommit, ValidatorAddress: signer},
+			{BlockIDFlag: cmttypes.BlockIDFlagAbsent},
+			{BlockIDFlag: cmttypes.BlockIDFlagNil, ValidatorAddress: nilVoter},
+		},
+	}
+
+	signatures, err := processCommitSignatures(commit, "")
+	suite.Require().NoError(err)
+	suite.Require().Len(signatures, 2)
+	suite.Assert().Equal(sdkTypes.ConsAddress(signer).String(), signatures[0].Validator.ConsAddress)
+	suite.Assert().True(signatures[0].Signed)
+	suite.Assert().Equal(sdkTypes.ConsAddress(nilVoter).String(), signatures[1].Validator.ConsAddress)
+	suite.Assert().False(signatures[1].Signed)
+
+	// Encoded with the valcons prefix of the chain rather than the prefix of the SDK
+	signatures, err = processCommitSignatures(commit, "osmo")
+	suite.Require().NoError(err)
+	suite.Assert().True(strings.HasPrefix(signatures[0].Validator.ConsAddress, "osmovalcons1"))
+
+	// The first block has no last commit
+	signatures, err = processCommitSignatures(nil, "")
+	suite.Require().NoError(err)
+	suite.Assert().Empty(signatures)
+}
+
+func TestProcessorSuite(t *testing.T) {
+	suite.Run(t, new(ProcessorTestSuite))
+}
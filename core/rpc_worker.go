@@ -1,15 +1,18 @@
 package core
 
 import (
-	"net/http"
+	"context"
 	"sync"
+	"time"
 
 	"github.com/DefiantLabs/cosmos-indexer/config"
 	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
 	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	"github.com/DefiantLabs/cosmos-indexer/tracing"
 	"github.com/DefiantLabs/probe/client"
 	ctypes "github.com/cometbft/cometbft/rpc/core/types"
 	txTypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -22,95 +25,162 @@ type IndexerBlockEventData struct {
 	TxRequestsFailed         bool
 	IndexBlockEvents         bool
 	IndexTransactions        bool
+	Trace                    trace.SpanContext // Span context of the fetch of the block, the root of the trace of the block
 }
 
 // This function is responsible for making all RPC requests to the chain needed for later processing.
 // The indexer relies on a number of RPC endpoints for full block data, including block event and transaction searches.
-func BlockRPCWorker(wg *sync.WaitGroup, blockEnqueueChan chan *EnqueueData, chainID uint, chainStringID string, cfg *config.IndexConfig, chainClient *client.ChainClient, db *gorm.DB, outputChannel chan IndexerBlockEventData) {
+// Workers sharing a coalescer fetch each height once when the same height is enqueued by more than one worker at a time,
+// only the worker that ran the fetch passes the data on. A nil coalescer disables coalescing.
+func BlockRPCWorker(ctx context.Context, wg *sync.WaitGroup, blockEnqueueChan chan *EnqueueData, chainID uint, chainStringID string, cfg *config.IndexConfig, chainClient *client.ChainClient, db *gorm.DB, coalescer *FetchCoalescer, outputChannel chan IndexerBlockEventData) {
 	defer wg.Done()
-	rpcClient := rpc.URIClient{
-		Address: chainClient.Config.RPCAddr,
-		Client:  &http.Client{},
-	}
+	rpcClient := rpc.NewURIClient(chainClient)
 
 	for {
 		// Get the next block to process
 		block, open := <-blockEnqueueChan
 		if !open {
-			config.Log.Debugf("Block enqueue channel closed. Exiting RPC worker.")
+			cfg.ChainLog().Debugf("Block enqueue channel closed. Exiting RPC worker.")
 			break
 		}
 
-		currentHeightIndexerData := IndexerBlockEventData{
-			BlockEventRequestsFailed: false,
-			TxRequestsFailed:         false,
-			IndexBlockEvents:         block.IndexBlockEvents,
-			IndexTransactions:        block.IndexTransactions,
+		currentHeightIndexerData, ok := fetchEnqueuedBlock(ctx, block, chainStringID, cfg, chainClient, rpcClient, db, coalescer)
+		if !ok {
+			continue
 		}
 
-		// Get the block from the RPC
-		blockData, err := rpc.GetBlock(chainClient, block.Height)
-		if err != nil {
-			// This is the only response we continue on. If we can't get the block, we can't index anything.
-			config.Log.Errorf("Error getting block %v from RPC. Err: %v", block, err)
-			err := dbTypes.UpsertFailedEventBlock(db, block.Height, chainStringID, cfg.Probe.ChainName)
-			if err != nil {
-				config.Log.Fatal("Failed to insert failed block event", err)
-			}
-			err = dbTypes.UpsertFailedBlock(db, block.Height, chainStringID, cfg.Probe.ChainName)
-			if err != nil {
-				config.Log.Fatal("Failed to insert failed block", err)
-			}
-			continue
+		outputChannel <- currentHeightIndexerData
+	}
+}
+
+// fetchEnqueuedBlock fetches the block through the coalescer, false when the block could not be fetched or was fetched
+// by a concurrent request that passes it on instead
+func fetchEnqueuedBlock(ctx context.Context, block *EnqueueData, chainStringID string, cfg *config.IndexConfig, chainClient *client.ChainClient, rpcClient rpc.URIClient, db *gorm.DB, coalescer *FetchCoalescer) (IndexerBlockEventData, bool) {
+	currentHeightIndexerData, leader, err := coalescer.Do(chainStringID, *block, func() (IndexerBlockEventData, error) {
+		return fetchBlockData(ctx, block, chainStringID, cfg, chainClient, rpcClient, db)
+	})
+
+	if !leader {
+		cfg.ChainLog().Debugf("Block %d was fetched by a concurrent request, skipping. %d requests coalesced so far.", block.Height, coalescer.Coalesced())
+		return currentHeightIndexerData, false
+	}
+
+	return currentHeightIndexerData, err == nil
+}
+
+// recordFetchFailure records the datasets of the height that could not be fetched in the failed block tables. A nil db
+// records nothing, like in dry runs.
+func recordFetchFailure(ctx context.Context, db *gorm.DB, cfg *config.IndexConfig, chainStringID string, height int64, blockEvents bool, txs bool, err error) {
+	if db == nil {
+		return
+	}
+	if blockEvents {
+		if dbErr := dbTypes.UpsertFailedEventBlock(ctx, db, height, chainStringID, cfg.Probe.ChainName, dbTypes.StageFetch, err); dbErr != nil {
+			cfg.ChainLog().Fatal("Failed to insert failed block event", dbErr)
+		}
+	}
+	if txs {
+		if dbErr := dbTypes.UpsertFailedBlock(ctx, db, height, chainStringID, cfg.Probe.ChainName, dbTypes.StageFetch, err); dbErr != nil {
+			cfg.ChainLog().Fatal("Failed to insert failed block", dbErr)
+		}
+	}
+}
+
+// fetchBlockData makes the RPC requests for a single height, recording failed blocks as it goes. An error is only returned
+// when the block itself could not be fetched, in which case there is nothing to index.
+// The fetch starts the trace of the block, the later stages start their spans from the span context passed on in the data.
+// Transient RPC errors are retried inline for up to base.rpc-retry-max-elapsed before the block is recorded as failed.
+func fetchBlockData(ctx context.Context, block *EnqueueData, chainStringID string, cfg *config.IndexConfig, chainClient *client.ChainClient, rpcClient rpc.URIClient, db *gorm.DB) (_ IndexerBlockEventData, err error) {
+	ctx, span := tracing.Start(ctx, "fetch_block", tracing.ChainID.String(chainStringID), tracing.Height.Int64(block.Height))
+	defer func() { tracing.End(span, err) }()
+
+	currentHeightIndexerData := IndexerBlockEventData{
+		BlockEventRequestsFailed: false,
+		TxRequestsFailed:         false,
+		IndexBlockEvents:         block.IndexBlockEvents,
+		IndexTransactions:        block.IndexTransactions,
+		Trace:                    span.SpanContext(),
+	}
+	retryPolicy := rpc.NewRetryPolicy(time.Duration(cfg.Base.RPCRetryMaxElapsed) * time.Second)
+
+	// Get the block from the RPC
+	_, rpcSpan := tracing.Start(ctx, "rpc.GetBlock")
+	blockData, err := rpc.Retry(ctx, retryPolicy, func(ctx context.Context) (*ctypes.ResultBlock, error) {
+		return rpc.GetBlock(chainClient, block.Height)
+	})
+	tracing.End(rpcSpan, err)
+	if err != nil {
+		// Cut short by the shutdown, the block is fetched again on the next run
+		if ctx.Err() != nil {
+			return currentHeightIndexerData, err
 		}
+		// This is the only response we stop on. If we can't get the block, we can't index anything.
+		cfg.ChainLog().Errorf("Error getting block %v from RPC. Err: %v", block, err)
+		recordFetchFailure(ctx, db, cfg, chainStringID, block.Height, true, true, err)
+		return currentHeightIndexerData, err
+	}
 
-		currentHeightIndexerData.BlockData = blockData
+	currentHeightIndexerData.BlockData = blockData
+	span.SetAttributes(tracing.TxCount.Int(len(blockData.Block.Txs)))
 
-		if block.IndexBlockEvents {
-			bresults, err := rpc.GetBlockResultWithRetry(rpcClient, block.Height, cfg.Base.RequestRetryAttempts, cfg.Base.RequestRetryMaxWait)
+	if block.IndexBlockEvents {
+		_, rpcSpan := tracing.Start(ctx, "rpc.GetBlockResults")
+		bresults, err := getBlockResults(ctx, retryPolicy, rpcClient, block.Height)
+		tracing.End(rpcSpan, err)
 
-			if err != nil {
-				config.Log.Errorf("Error getting block results for block %v from RPC. Err: %v", block, err)
-				err := dbTypes.UpsertFailedEventBlock(db, block.Height, chainStringID, cfg.Probe.ChainName)
-				if err != nil {
-					config.Log.Fatal("Failed to insert failed block event", err)
-				}
-				currentHeightIndexerData.BlockResultsData = nil
-				currentHeightIndexerData.BlockEventRequestsFailed = true
-			} else {
-				currentHeightIndexerData.BlockResultsData = bresults
+		if err != nil {
+			if ctx.Err() != nil {
+				return currentHeightIndexerData, ctx.Err()
 			}
+			cfg.ChainLog().Errorf("Error getting block results for block %v from RPC. Err: %v", block, err)
+			recordFetchFailure(ctx, db, cfg, chainStringID, block.Height, true, false, err)
+			currentHeightIndexerData.BlockResultsData = nil
+			currentHeightIndexerData.BlockEventRequestsFailed = true
+		} else {
+			currentHeightIndexerData.BlockResultsData = bresults
 		}
+	}
 
-		if block.IndexTransactions {
-			txsEventResp, err := rpc.GetTxsByBlockHeight(chainClient, block.Height)
-
-			if err != nil {
-				// Attempt to get block results to attempt an in-app codec decode of transactions.
-				if currentHeightIndexerData.BlockResultsData == nil {
-
-					bresults, err := rpc.GetBlockResultWithRetry(rpcClient, block.Height, cfg.Base.RequestRetryAttempts, cfg.Base.RequestRetryMaxWait)
-
-					if err != nil {
-						config.Log.Errorf("Error getting txs for block %v from RPC. Err: %v", block, err)
-						err := dbTypes.UpsertFailedBlock(db, block.Height, chainStringID, cfg.Probe.ChainName)
-						if err != nil {
-							config.Log.Fatal("Failed to insert failed block", err)
-						}
-						currentHeightIndexerData.GetTxsResponse = nil
-						currentHeightIndexerData.BlockResultsData = nil
-						// Only set failed when we can't get the block results either.
-						currentHeightIndexerData.TxRequestsFailed = true
-					} else {
-						currentHeightIndexerData.BlockResultsData = bresults
-					}
+	if block.IndexTransactions {
+		_, rpcSpan := tracing.Start(ctx, "rpc.GetTxsByBlockHeight")
+		txsEventResp, err := rpc.Retry(ctx, retryPolicy, func(ctx context.Context) (*txTypes.GetTxsEventResponse, error) {
+			return rpc.GetTxsByBlockHeight(chainClient, block.Height)
+		})
+		tracing.End(rpcSpan, err)
+
+		if err != nil {
+			// Attempt to get block results to attempt an in-app codec decode of transactions.
+			if currentHeightIndexerData.BlockResultsData == nil {
+
+				_, rpcSpan := tracing.Start(ctx, "rpc.GetBlockResults")
+				bresults, err := getBlockResults(ctx, retryPolicy, rpcClient, block.Height)
+				tracing.End(rpcSpan, err)
 
+				if err != nil {
+					if ctx.Err() != nil {
+						return currentHeightIndexerData, ctx.Err()
+					}
+					cfg.ChainLog().Errorf("Error getting txs for block %v from RPC. Err: %v", block, err)
+					recordFetchFailure(ctx, db, cfg, chainStringID, block.Height, false, true, err)
+					currentHeightIndexerData.GetTxsResponse = nil
+					currentHeightIndexerData.BlockResultsData = nil
+					// Only set failed when we can't get the block results either.
+					currentHeightIndexerData.TxRequestsFailed = true
+				} else {
+					currentHeightIndexerData.BlockResultsData = bresults
 				}
-			} else {
-				currentHeightIndexerData.GetTxsResponse = txsEventResp
+
 			}
+		} else {
+			currentHeightIndexerData.GetTxsResponse = txsEventResp
 		}
-
-		outputChannel <- currentHeightIndexerData
 	}
+
+	return currentHeightIndexerData, nil
+}
+
+func getBlockResults(ctx context.Context, retryPolicy rpc.RetryPolicy, rpcClient rpc.URIClient, height int64) (*ctypes.ResultBlockResults, error) {
+	return rpc.Retry(ctx, retryPolicy, func(ctx context.Context) (*ctypes.ResultBlockResults, error) {
+		return rpc.GetBlockResult(rpcClient, height)
+	})
 }
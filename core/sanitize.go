@@ -0,0 +1,95 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/util"
+)
+
+// ErrInvalidTextValue is returned when an event attribute value contains null bytes or invalid UTF-8 and flags.invalid-text-policy is fail
+var ErrInvalidTextValue = errors.New("event attribute value contains null bytes or invalid UTF-8, see flags.invalid-text-policy")
+
+type sanitizedValue struct {
+	Value      string
+	ValueBytes []byte
+	Sanitized  bool
+}
+
+// sanitizeAttributeValue applies the invalid text policy to an event attribute value so it can be stored in a text column
+func sanitizeAttributeValue(value string, policy string) (sanitizedValue, error) {
+	sanitized, changed := util.SanitizeText(value)
+	if !changed {
+		return sanitizedValue{Value: value}, nil
+	}
+
+	switch policy {
+	case config.InvalidTextPolicyFail:
+		return sanitizedValue{}, fmt.Errorf("%w: %q", ErrInvalidTextValue, value)
+	case config.InvalidTextPolicyBytea:
+		return sanitizedValue{Value: sanitized, ValueBytes: []byte(value), Sanitized: true}, nil
+	default:
+		return sanitizedValue{Value: sanitized, Sanitized: true}, nil
+	}
+}
+
+// sanitizeLookupValue sanitizes event types and attribute keys. These are stored once in lookup tables, so they are always
+// sanitized regardless of the policy.
+func sanitizeLookupValue(value string) string {
+	sanitized, _ := util.SanitizeText(value)
+	return sanitized
+}
+
+// truncateText returns the value cut to at most maxLength bytes without splitting a UTF-8 sequence. A maxLength of 0 keeps
+// the whole value.
+func truncateText(value string, maxLength int64) string {
+	if maxLength <= 0 || int64(len(value)) <= maxLength {
+		return value
+	}
+
+	end := int(maxLength)
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	return value[:end]
+}
+
+// sanitizeJSON removes the null characters PostgreSQL rejects in jsonb from the strings and keys of a JSON document. The
+// document is only decoded and encoded again when it contains an escaped null character, object keys are then sorted.
+func sanitizeJSON(value []byte) ([]byte, error) {
+	if !bytes.Contains(value, []byte(`\u0000`)) {
+		return value, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	var document any
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	return json.Marshal(sanitizeJSONValue(document))
+}
+
+func sanitizeJSONValue(value any) any {
+	switch typed := value.(type) {
+	case string:
+		return sanitizeLookupValue(typed)
+	case []any:
+		for i := range typed {
+			typed[i] = sanitizeJSONValue(typed[i])
+		}
+		return typed
+	case map[string]any:
+		sanitized := make(map[string]any, len(typed))
+		for key, item := range typed {
+			sanitized[sanitizeLookupValue(key)] = sanitizeJSONValue(item)
+		}
+		return sanitized
+	default:
+		return value
+	}
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	txtypes "github.com/DefiantLabs/cosmos-indexer/cosmos/modules/tx"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/dbtest"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/util"
+	abci "github.com/cometbft/cometbft/abci/types"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	bankTypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// Byte sequences PostgreSQL rejects in text columns
+var hostileTextSeeds = []string{
+	"plain value",
+	"",
+	"null\x00byte",
+	"\x00",
+	"\xff\xfe\xfd",
+	"\xc3\x28",              // invalid 2 byte sequence
+	"\xed\xa0\x80",          // UTF-16 surrogate
+	"\xf4\x90\x80\x80",      // above the maximum code point
+	"valid ✓ then \xe2\x82", // truncated sequence
+	"a\x00\xffb\x00",
+}
+
+type SanitizeTestSuite struct {
+	suite.Suite
+}
+
+func (suite *SanitizeTestSuite) TestSanitizeAttributeValuePolicies() {
+	value, err := sanitizeAttributeValue("valid", config.InvalidTextPolicyFail)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(sanitizedValue{Value: "valid"}, value)
+
+	value, err = sanitizeAttributeValue("null\x00\xffbyte", config.InvalidTextPolicySanitize)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(sanitizedValue{Value: "null�byte", Sanitized: true}, value)
+
+	value, err = sanitizeAttributeValue("null\x00\xffbyte", config.InvalidTextPolicyBytea)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(sanitizedValue{Value: "null�byte", ValueBytes: []byte("null\x00\xffbyte"), Sanitized: true}, value)
+
+	_, err = sanitizeAttributeValue("null\x00byte", config.InvalidTextPolicyFail)
+	suite.Assert().ErrorIs(err, ErrInvalidTextValue)
+}
+
+func (suite *SanitizeTestSuite) TestProcessRPCBlockEventsFailPolicy() {
+	conf := config.IndexConfig{}
+	conf.Flags.InvalidTextPolicy = config.InvalidTextPolicyFail
+
+	events := []abci.Event{{Type: "wasm", Attributes: []abci.EventAttribute{{Key: "key", Value: "\x00"}}}}
+	_, _, err := ProcessRPCBlockEvents(&models.Block{Height: 1}, events, models.BeginBlockEvent, make(map[string]models.BlockEventType), make(map[string]models.BlockEventAttributeKey), nil, conf)
+	suite.Assert().ErrorIs(err, ErrInvalidTextValue)
+}
+
+func (suite *SanitizeTestSuite) TestTruncateText() {
+	suite.Assert().Equal("short", truncateText("short", 10))
+	suite.Assert().Equal("trunc", truncateText("truncated", 5))
+	suite.Assert().Equal("truncated", truncateText("truncated", 0))
+	// ✓ is 3 bytes and is not split
+	suite.Assert().Equal("ok ", truncateText("ok ✓", 5))
+}
+
+func (suite *SanitizeTestSuite) TestProcessTxErrorMessage() {
+	conf := config.IndexConfig{}
+	conf.Flags.TxErrorMaxLength = 16
+
+	tx := txtypes.MergedTx{TxResponse: txtypes.Response{
+		TxHash:    "HASH",
+		TimeStamp: time.Now().Format(time.RFC3339),
+		Code:      5,
+		RawLog:    "failed to execute message; message index: 0: insufficient funds",
+	}}
+	txDBWrapper, _, err := ProcessTx(&conf, nil, tx, nil, nil)
+	suite.Require().NoError(err)
+	suite.Assert().Equal("failed to execut", txDBWrapper.Tx.ErrorMessage)
+
+	// Successful txs have no error message
+	tx.TxResponse.Code = 0
+	tx.TxResponse.RawLog = "[]"
+	txDBWrapper, _, err = ProcessTx(&conf, nil, tx, nil, nil)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(txDBWrapper.Tx.ErrorMessage)
+}
+
+func (suite *SanitizeTestSuite) TestMessageValue() {
+	message := &bankTypes.MsgSend{
+		FromAddress: "cosmos1from",
+		ToAddress:   "cosmos1to",
+		Amount:      sdkTypes.NewCoins(sdkTypes.NewInt64Coin("uatom", 5)),
+	}
+	suite.Assert().JSONEq(`{"from_address":"cosmos1from","to_address":"cosmos1to","amount":[{"denom":"uatom","amount":"5"}]}`, string(messageValue(message)))
+
+	// JSONB rejects null bytes in strings
+	message.ToAddress = "null\x00byte"
+	suite.Assert().JSONEq(`{"from_address":"cosmos1from","to_address":"nullbyte","amount":[{"denom":"uatom","amount":"5"}]}`, string(messageValue(message)))
+}
+
+func TestSanitizeSuite(t *testing.T) {
+	suite.Run(t, new(SanitizeTestSuite))
+}
+
+func FuzzSanitizeText(f *testing.F) {
+	for _, seed := range hostileTextSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, value string) {
+		sanitized, changed := util.SanitizeText(value)
+
+		require.True(t, utf8.ValidString(sanitized))
+		require.NotContains(t, sanitized, "\x00")
+		require.Equal(t, !changed, sanitized == value)
+
+		again, changedAgain := util.SanitizeText(sanitized)
+		require.False(t, changedAgain)
+		require.Equal(t, sanitized, again)
+	})
+}
+
+// FuzzSanitizedAttributesInsert feeds hostile attribute keys and values through the block event and message event
+// wrapper building functions and inserts the result, the inserts must never fail and the original bytes must be kept.
+func FuzzSanitizedAttributesInsert(f *testing.F) {
+	for _, seed := range hostileTextSeeds {
+		f.Add(seed, seed)
+	}
+
+	clean, db, err := dbtest.Setup()
+	require.NoError(f, err)
+	defer clean()
+
+	require.NoError(f, dbTypes.MigrateModels(db))
+
+	chainID, err := dbTypes.GetDBChainID(context.Background(), db, models.Chain{ChainID: "testchain-1"})
+	require.NoError(f, err)
+
+	conf := config.IndexConfig{}
+	conf.Flags.InvalidTextPolicy = config.InvalidTextPolicyBytea
+
+	var height int64
+
+	f.Fuzz(func(t *testing.T, key string, value string) {
+		var err error
+		height++
+		block := models.Block{Height: height, ChainID: chainID, TimeStamp: time.Now(), ProposerConsAddress: models.Address{Address: "proposer"}}
+
+		blockDBWrapper := &dbTypes.BlockDBWrapper{
+			Block:                         &block,
+			UniqueBlockEventTypes:         make(map[string]models.BlockEventType),
+			UniqueBlockEventAttributeKeys: make(map[string]models.BlockEventAttributeKey),
+		}
+
+		events := []abci.Event{{Type: "wasm" + key, Attributes: []abci.EventAttribute{{Key: key, Value: value}}}}
+		blockDBWrapper.BeginBlockEvents, _, err = ProcessRPCBlockEvents(blockDBWrapper.Block, events, models.BeginBlockEvent, blockDBWrapper.UniqueBlockEventTypes, blockDBWrapper.UniqueBlockEventAttributeKeys, nil, conf)
+		require.NoError(t, err)
+
+		blockDBWrapper, err = dbTypes.IndexBlockEvents(context.Background(), db, false, blockDBWrapper, fmt.Sprintf("block %d", height))
+		require.NoError(t, err)
+
+		var blockEventAttribute models.BlockEventAttribute
+		require.NoError(t, db.Where("block_event_id = ?", blockDBWrapper.BeginBlockEvents[0].BlockEvent.ID).First(&blockEventAttribute).Error)
+		requireStoredValue(t, value, blockEventAttribute.Value, blockEventAttribute.ValueBytes, blockEventAttribute.Sanitized)
+
+		uniqueEventTypes := make(map[string]models.MessageEventType)
+		uniqueAttributeKeys := make(map[string]models.MessageEventAttributeKey)
+		messageLog := &txtypes.LogMessage{Events: []txtypes.LogMessageEvent{{Type: "wasm" + key, Attributes: []txtypes.Attribute{{Key: key, Value: value}}}}}
+
+		messageType, message, err := ProcessMessage(0, &bankTypes.MsgSend{}, messageLog, uniqueEventTypes, uniqueAttributeKeys, conf.Flags.InvalidTextPolicy)
+		require.NoError(t, err)
+
+		txs := []dbTypes.TxDBWrapper{{
+			Tx:                         models.Tx{Hash: fmt.Sprintf("fuzzhash%d", height)},
+			Messages:                   []dbTypes.MessageDBWrapper{message},
+			UniqueMessageTypes:         map[string]models.MessageType{messageType: message.Message.MessageType},
+			UniqueMessageEventTypes:    uniqueEventTypes,
+			UniqueMessageAttributeKeys: uniqueAttributeKeys,
+		}}
+
+		_, txs, err = dbTypes.IndexNewBlock(context.Background(), db, block, txs, conf)
+		require.NoError(t, err)
+
+		var messageEventAttribute models.MessageEventAttribute
+		require.NoError(t, db.Where("message_event_id = ?", txs[0].Messages[0].MessageEvents[0].MessageEvent.ID).First(&messageEventAttribute).Error)
+		requireStoredValue(t, value, messageEventAttribute.Value, messageEventAttribute.ValueBytes, messageEventAttribute.Sanitized)
+	})
+}
+
+func requireStoredValue(t *testing.T, original string, value string, valueBytes []byte, sanitized bool) {
+	if utf8.ValidString(original) && !strings.ContainsRune(original, 0) {
+		require.False(t, sanitized)
+		require.Equal(t, original, value)
+		require.Empty(t, valueBytes)
+		return
+	}
+
+	require.True(t, sanitized)
+	require.Equal(t, []byte(original), valueBytes)
+}
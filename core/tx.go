@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"math/big"
 	"reflect"
@@ -18,9 +19,12 @@ import (
 	"github.com/DefiantLabs/cosmos-indexer/util"
 	"github.com/DefiantLabs/probe/client"
 	coretypes "github.com/cometbft/cometbft/rpc/core/types"
+	"github.com/cosmos/cosmos-sdk/codec"
+	codectypes "github.com/cosmos/cosmos-sdk/codec/types"
 	"github.com/cosmos/cosmos-sdk/crypto/keys/multisig"
 	cryptoTypes "github.com/cosmos/cosmos-sdk/crypto/types"
 	"github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
 	cosmosTx "github.com/cosmos/cosmos-sdk/types/tx"
 	"gorm.io/gorm"
 
@@ -31,14 +35,18 @@ func getUnexportedField(field reflect.Value) interface{} {
 	return reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Interface()
 }
 
-func ProcessRPCBlockByHeightTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient, messageTypeFilters []filter.MessageTypeFilter, blockResults *coretypes.ResultBlock, resultBlockRes *coretypes.ResultBlockResults, customParsers map[string][]parsers.MessageParser) ([]dbTypes.TxDBWrapper, *time.Time, error) {
+// ProcessRPCBlockByHeightTXs decodes the txs of the block from the raw txs of the block and the block results. Txs and messages
+// that cannot be decoded do not fail the block: the failed txs are returned, to be stored with the block, and the failed
+// messages are set on their tx, which is indexed without them.
+func ProcessRPCBlockByHeightTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient, messageTypeFilters []filter.MessageTypeFilter, watchlist *filter.Watchlist, blockResults *coretypes.ResultBlock, resultBlockRes *coretypes.ResultBlockResults, customParsers map[string][]parsers.MessageParser) ([]dbTypes.TxDBWrapper, []models.FailedTx, *time.Time, error) {
 	if len(blockResults.Block.Txs) != len(resultBlockRes.TxsResults) {
-		config.Log.Fatalf("blockResults & resultBlockRes: different length")
+		return nil, nil, nil, fmt.Errorf("block %d has %d txs but %d tx results", blockResults.Block.Height, len(blockResults.Block.Txs), len(resultBlockRes.TxsResults))
 	}
 
 	blockTime := &blockResults.Block.Time
 	blockTimeStr := blockTime.Format(time.RFC3339)
-	currTxDbWrappers := make([]dbTypes.TxDBWrapper, len(blockResults.Block.Txs))
+	currTxDbWrappers := make([]dbTypes.TxDBWrapper, 0, len(blockResults.Block.Txs))
+	var failedTxs []models.FailedTx
 
 	for txIdx, tendermintTx := range blockResults.Block.Txs {
 		txResult := resultBlockRes.TxsResults[txIdx]
@@ -57,7 +65,9 @@ func ProcessRPCBlockByHeightTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client
 		if err != nil {
 			txBasic, err = InAppTxDecoder(cl.Codec)(tendermintTx)
 			if err != nil {
-				return nil, blockTime, fmt.Errorf("ProcessRPCBlockByHeightTXs: TX cannot be parsed from block %v. This is usually a proto definition error. Err: %v", blockResults.Block.Height, err)
+				cfg.ChainLog().Warnf("TX %s cannot be parsed from block %v, recording it as failed. This is usually a proto definition error. Err: %v", tendermintHashToHex(tendermintTx.Hash()), blockResults.Block.Height, err)
+				failedTxs = append(failedTxs, models.FailedTx{Hash: tendermintHashToHex(tendermintTx.Hash()), Error: err.Error(), TxBytes: tendermintTx})
+				continue
 			}
 			txFull = txBasic.(*cosmosTx.Tx)
 		} else {
@@ -82,24 +92,30 @@ func ProcessRPCBlockByHeightTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client
 		}
 
 		if err != nil {
-			config.Log.Errorf("Error parsing events to message index events to normalize: %v", err)
-			return nil, blockTime, fmt.Errorf("logs could not be parsed")
+			cfg.ChainLog().Errorf("Error parsing events to message index events to normalize: %v", err)
+			return nil, nil, blockTime, fmt.Errorf("logs could not be parsed")
 		}
 
 		txHash := tendermintTx.Hash()
 
 		var messagesRaw [][]byte
+		var failedMessages []models.FailedMessage
+
+		// Txs involving watched addresses are indexed in full regardless of the message type filters
+		watchedAddresses := watchlist.MatchEvents(txResult.Events)
 
 		// Get the Messages and Message Logs
 		for msgIdx := range txFull.Body.Messages {
 
 			shouldIndex, err := messageTypeShouldIndex(txFull.Body.Messages[msgIdx].TypeUrl, messageTypeFilters, customParsers)
 			if err != nil {
-				return nil, blockTime, err
+				return nil, nil, blockTime, err
 			}
 
+			shouldIndex = shouldIndex || len(watchedAddresses) != 0
+
 			if !shouldIndex {
-				config.Log.Debug(fmt.Sprintf("[Block: %v] [TX: %v] Skipping msg of type '%v'.", blockResults.Block.Height, tendermintHashToHex(txHash), txFull.Body.Messages[msgIdx].TypeUrl))
+				cfg.ChainLog().Debug(fmt.Sprintf("[Block: %v] [TX: %v] Skipping msg of type '%v'.", blockResults.Block.Height, tendermintHashToHex(txHash), txFull.Body.Messages[msgIdx].TypeUrl))
 				currMessages = append(currMessages, nil)
 				currLogMsgs = append(currLogMsgs, txtypes.LogMessage{
 					MessageIndex: msgIdx,
@@ -108,28 +124,34 @@ func ProcessRPCBlockByHeightTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client
 				continue
 			}
 
-			currMsg := txFull.Body.Messages[msgIdx].GetCachedValue()
+			msg, err := unpackMessage(cl, txFull.Body.Messages[msgIdx])
+			if err != nil {
+				cfg.ChainLog().Warnf("[Block: %v] [TX: %v] Message %d of type '%v' could not be decoded, recording it as failed. Err: %v", blockResults.Block.Height, tendermintHashToHex(txHash), msgIdx, txFull.Body.Messages[msgIdx].TypeUrl, err)
+				failedMessages = append(failedMessages, failedMessage(msgIdx, txFull.Body.Messages[msgIdx], err))
+				currMessages = append(currMessages, nil)
+				currLogMsgs = append(currLogMsgs, txtypes.LogMessage{
+					MessageIndex: msgIdx,
+				})
+				messagesRaw = append(messagesRaw, nil)
+				continue
+			}
 
-			if currMsg != nil {
-				msg := currMsg.(types.Msg)
-				messagesRaw = append(messagesRaw, txFull.Body.Messages[msgIdx].Value)
-				currMessages = append(currMessages, msg)
-				msgEvents := types.StringEvents{}
-				if txResult.Code == 0 {
-					msgEvents = logs[msgIdx].Events
-				}
+			messagesRaw = append(messagesRaw, txFull.Body.Messages[msgIdx].Value)
+			currMessages = append(currMessages, msg)
+			msgEvents := types.StringEvents{}
+			if txResult.Code == 0 {
+				msgEvents = logs[msgIdx].Events
+			}
 
-				currTxLog := txtypes.LogMessage{
-					MessageIndex: msgIdx,
-					Events:       indexerEvents.StringEventstoNormalizedEvents(msgEvents),
-				}
-				currLogMsgs = append(currLogMsgs, currTxLog)
-			} else {
-				return nil, blockTime, fmt.Errorf("tx message could not be processed")
+			currTxLog := txtypes.LogMessage{
+				MessageIndex: msgIdx,
+				Events:       indexerEvents.StringEventstoNormalizedEvents(msgEvents),
 			}
+			currLogMsgs = append(currLogMsgs, currTxLog)
 		}
 
 		txBody.Messages = currMessages
+		txBody.Memo = txFull.Body.Memo
 		indexerTx.Body = txBody
 		indexerTxResp := txtypes.Response{
 			TxHash:    tendermintHashToHex(txHash),
@@ -138,6 +160,8 @@ func ProcessRPCBlockByHeightTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client
 			RawLog:    txResult.Log,
 			Log:       currLogMsgs,
 			Code:      txResult.Code,
+			GasWanted: txResult.GasWanted,
+			GasUsed:   txResult.GasUsed,
 		}
 
 		indexerTx.AuthInfo = *txFull.AuthInfo
@@ -147,34 +171,36 @@ func ProcessRPCBlockByHeightTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client
 
 		processedTx, _, err := ProcessTx(cfg, db, indexerMergedTx, messagesRaw, customParsers)
 		if err != nil {
-			return currTxDbWrappers, blockTime, err
+			return currTxDbWrappers, failedTxs, blockTime, err
 		}
 
 		filteredSigners := []types.AccAddress{}
 		for _, filteredMessage := range txBody.Messages {
 			if filteredMessage != nil {
-				filteredSigners = append(filteredSigners, filteredMessage.GetSigners()...)
+				filteredSigners = append(filteredSigners, messageSigners(filteredMessage)...)
 			}
 		}
 
 		signers, err := ProcessSigners(cl, txFull.AuthInfo, filteredSigners)
 		if err != nil {
-			return currTxDbWrappers, blockTime, err
+			return currTxDbWrappers, failedTxs, blockTime, err
 		}
 
 		processedTx.Tx.SignerAddresses = signers
 
 		fees, err := ProcessFees(db, indexerTx.AuthInfo, signers)
 		if err != nil {
-			return currTxDbWrappers, blockTime, err
+			return currTxDbWrappers, failedTxs, blockTime, err
 		}
 
 		processedTx.Tx.Fees = fees
+		processedTx.WatchedAddresses = watchedAddresses
+		processedTx.FailedMessages = failedMessages
 
-		currTxDbWrappers[txIdx] = processedTx
+		currTxDbWrappers = append(currTxDbWrappers, processedTx)
 	}
 
-	return currTxDbWrappers, blockTime, nil
+	return currTxDbWrappers, failedTxs, blockTime, nil
 }
 
 func tendermintHashToHex(hash []byte) string {
@@ -182,7 +208,8 @@ func tendermintHashToHex(hash []byte) string {
 }
 
 // ProcessRPCTXs - Given an RPC response, build out the more specific data used by the parser.
-func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient, messageTypeFilters []filter.MessageTypeFilter, txEventResp *cosmosTx.GetTxsEventResponse, customParsers map[string][]parsers.MessageParser) ([]dbTypes.TxDBWrapper, *time.Time, error) {
+// Messages that cannot be decoded are set as failed messages on their tx, which is indexed without them.
+func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient, messageTypeFilters []filter.MessageTypeFilter, watchlist *filter.Watchlist, txEventResp *cosmosTx.GetTxsEventResponse, customParsers map[string][]parsers.MessageParser) ([]dbTypes.TxDBWrapper, *time.Time, error) {
 	currTxDbWrappers := make([]dbTypes.TxDBWrapper, len(txEventResp.Txs))
 	var blockTime *time.Time
 
@@ -194,6 +221,7 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 		var currMessages []types.Msg
 		var currLogMsgs []txtypes.LogMessage
 		var messagesRaw [][]byte
+		var failedMessages []models.FailedMessage
 
 		currTx := txEventResp.Txs[txIdx]
 		currTxResp := txEventResp.TxResponses[txIdx]
@@ -202,13 +230,16 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 			// We have a version of Cosmos SDK that removed the Logs field from the TxResponse, we need to parse the events into message index logs
 			parsedLogs, err := indexerEvents.ParseTxEventsToMessageIndexEvents(len(currTx.Body.Messages), currTxResp.Events)
 			if err != nil {
-				config.Log.Errorf("Error parsing events to message index events to normalize: %v", err)
+				cfg.ChainLog().Errorf("Error parsing events to message index events to normalize: %v", err)
 				return nil, blockTime, err
 			}
 
 			currTxResp.Logs = parsedLogs
 		}
 
+		// Txs involving watched addresses are indexed in full regardless of the message type filters
+		watchedAddresses := watchlist.MatchEvents(currTxResp.Events)
+
 		// Get the Messages and Message Logs
 		for msgIdx := range currTx.Body.Messages {
 
@@ -217,8 +248,10 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 				return nil, blockTime, err
 			}
 
+			shouldIndex = shouldIndex || len(watchedAddresses) != 0
+
 			if !shouldIndex {
-				config.Log.Debug(fmt.Sprintf("[Block: %v] [TX: %v] Skipping msg of type '%v'.", currTxResp.Height, currTxResp.TxHash, currTx.Body.Messages[msgIdx].TypeUrl))
+				cfg.ChainLog().Debug(fmt.Sprintf("[Block: %v] [TX: %v] Skipping msg of type '%v'.", currTxResp.Height, currTxResp.TxHash, currTx.Body.Messages[msgIdx].TypeUrl))
 				currMessages = append(currMessages, nil)
 				currLogMsgs = append(currLogMsgs, txtypes.LogMessage{
 					MessageIndex: msgIdx,
@@ -227,40 +260,32 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 				continue
 			}
 
-			currMsg := currTx.Body.Messages[msgIdx].GetCachedValue()
-			messagesRaw = append(messagesRaw, currTx.Body.Messages[msgIdx].Value)
-
-			// If we reached here, unpacking the entire TX raw was not successful
-			// Attempt to unpack the message individually.
-			if currMsg == nil {
-				var currMsgUnpack types.Msg
-				err := cl.Codec.InterfaceRegistry.UnpackAny(currTx.Body.Messages[msgIdx], &currMsgUnpack)
-				if err != nil || currMsgUnpack == nil {
-					return nil, blockTime, fmt.Errorf("tx message could not be processed. Unpacking protos failed and CachedValue is not present. TX Hash: %s, Msg type: %s, Msg index: %d, Code: %d",
-						currTxResp.TxHash,
-						currTx.Body.Messages[msgIdx].TypeUrl,
-						msgIdx,
-						currTxResp.Code,
-					)
-				}
-				currMsg = currMsgUnpack
+			msg, err := unpackMessage(cl, currTx.Body.Messages[msgIdx])
+			if err != nil {
+				cfg.ChainLog().Warnf("[Block: %v] [TX: %v] Message %d of type '%v' could not be decoded, recording it as failed. Err: %v", currTxResp.Height, currTxResp.TxHash, msgIdx, currTx.Body.Messages[msgIdx].TypeUrl, err)
+				failedMessages = append(failedMessages, failedMessage(msgIdx, currTx.Body.Messages[msgIdx], err))
+				currMessages = append(currMessages, nil)
+				currLogMsgs = append(currLogMsgs, txtypes.LogMessage{
+					MessageIndex: msgIdx,
+				})
+				messagesRaw = append(messagesRaw, nil)
+				continue
 			}
 
-			if currMsg != nil {
-				msg := currMsg.(types.Msg)
-				currMessages = append(currMessages, msg)
-				if len(currTxResp.Logs) >= msgIdx+1 {
-					msgEvents := currTxResp.Logs[msgIdx].Events
-					currTxLog := txtypes.LogMessage{
-						MessageIndex: msgIdx,
-						Events:       indexerEvents.StringEventstoNormalizedEvents(msgEvents),
-					}
-					currLogMsgs = append(currLogMsgs, currTxLog)
+			messagesRaw = append(messagesRaw, currTx.Body.Messages[msgIdx].Value)
+			currMessages = append(currMessages, msg)
+			if len(currTxResp.Logs) >= msgIdx+1 {
+				msgEvents := currTxResp.Logs[msgIdx].Events
+				currTxLog := txtypes.LogMessage{
+					MessageIndex: msgIdx,
+					Events:       indexerEvents.StringEventstoNormalizedEvents(msgEvents),
 				}
+				currLogMsgs = append(currLogMsgs, currTxLog)
 			}
 		}
 
 		txBody.Messages = currMessages
+		txBody.Memo = currTx.Body.Memo
 		indexerTx.Body = txBody
 
 		indexerTxResp := txtypes.Response{
@@ -270,6 +295,8 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 			RawLog:    currTxResp.RawLog,
 			Log:       currLogMsgs,
 			Code:      currTxResp.Code,
+			GasWanted: currTxResp.GasWanted,
+			GasUsed:   currTxResp.GasUsed,
 		}
 
 		indexerTx.AuthInfo = *currTx.AuthInfo
@@ -289,7 +316,7 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 		filteredSigners := []types.AccAddress{}
 		for _, filteredMessage := range txBody.Messages {
 			if filteredMessage != nil {
-				filteredSigners = append(filteredSigners, filteredMessage.GetSigners()...)
+				filteredSigners = append(filteredSigners, messageSigners(filteredMessage)...)
 			}
 		}
 
@@ -310,6 +337,8 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 		}
 
 		processedTx.Tx.Fees = fees
+		processedTx.WatchedAddresses = watchedAddresses
+		processedTx.FailedMessages = failedMessages
 
 		currTxDbWrappers[txIdx] = processedTx
 	}
@@ -317,6 +346,32 @@ func ProcessRPCTXs(cfg *config.IndexConfig, db *gorm.DB, cl *client.ChainClient,
 	return currTxDbWrappers, blockTime, nil
 }
 
+// unpackMessage returns the message of the Any, unpacking it with the codec when the tx decoder did not
+func unpackMessage(cl *client.ChainClient, message *codectypes.Any) (types.Msg, error) {
+	if msg, ok := message.GetCachedValue().(types.Msg); ok {
+		return msg, nil
+	}
+
+	var msg types.Msg
+	if err := cl.Codec.InterfaceRegistry.UnpackAny(message, &msg); err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		return nil, fmt.Errorf("message of type %s unpacked to nil", message.TypeUrl)
+	}
+	return msg, nil
+}
+
+// failedMessage records the message at msgIdx of its tx that could not be decoded with err
+func failedMessage(msgIdx int, message *codectypes.Any, err error) models.FailedMessage {
+	return models.FailedMessage{
+		MessageIndex: msgIdx,
+		Error:        err.Error(),
+		TypeURL:      message.TypeUrl,
+		MessageBytes: message.Value,
+	}
+}
+
 func messageTypeShouldIndex(messageType string, filters []filter.MessageTypeFilter, customParsers map[string][]parsers.MessageParser) (bool, error) {
 	// Always index if a custom parser for the message type is present
 	if len(customParsers) != 0 {
@@ -351,7 +406,7 @@ func messageTypeShouldIndex(messageType string, filters []filter.MessageTypeFilt
 func ProcessTx(cfg *config.IndexConfig, db *gorm.DB, tx txtypes.MergedTx, messagesRaw [][]byte, customParsers map[string][]parsers.MessageParser) (txDBWapper dbTypes.TxDBWrapper, txTime time.Time, err error) {
 	txTime, err = time.Parse(time.RFC3339, tx.TxResponse.TimeStamp)
 	if err != nil {
-		config.Log.Error("Error parsing tx timestamp.", err)
+		cfg.ChainLog().Error("Error parsing tx timestamp.", err)
 		return txDBWapper, txTime, err
 	}
 
@@ -367,10 +422,17 @@ func ProcessTx(cfg *config.IndexConfig, db *gorm.DB, tx txtypes.MergedTx, messag
 		for messageIndex, message := range tx.Tx.Body.Messages {
 			if message != nil {
 				messageLog := txtypes.GetMessageLogForIndex(tx.TxResponse.Log, messageIndex)
-				messageType, currMessageDBWrapper := ProcessMessage(messageIndex, message, messageLog, uniqueEventTypes, uniqueEventAttributeKeys)
+				messageType, currMessageDBWrapper, err := ProcessMessage(messageIndex, message, messageLog, uniqueEventTypes, uniqueEventAttributeKeys, cfg.Flags.InvalidTextPolicy)
+				if err != nil {
+					cfg.ChainLog().Errorf("[Block: %v] [TX: %v] Error processing message %d. Err: %v", tx.TxResponse.Height, tx.TxResponse.TxHash, messageIndex, err)
+					return txDBWapper, txTime, err
+				}
 				currMessageDBWrapper.Message.MessageBytes = messagesRaw[messageIndex]
+				if cfg.Flags.StoreMessageBodies {
+					currMessageDBWrapper.Message.Value = messageValue(message)
+				}
 				uniqueMessageTypes[messageType] = currMessageDBWrapper.Message.MessageType
-				config.Log.Debug(fmt.Sprintf("[Block: %v] [TX: %v] Found msg of type '%v'.", tx.TxResponse.Height, tx.TxResponse.TxHash, messageType))
+				cfg.ChainLog().Debug(fmt.Sprintf("[Block: %v] [TX: %v] Found msg of type '%v'.", tx.TxResponse.Height, tx.TxResponse.TxHash, messageType))
 
 				if customParsers != nil {
 					if customMessageParsers, ok := customParsers[messageType]; ok {
@@ -392,7 +454,11 @@ func ProcessTx(cfg *config.IndexConfig, db *gorm.DB, tx txtypes.MergedTx, messag
 		}
 	}
 
-	txDBWapper.Tx = models.Tx{Hash: tx.TxResponse.TxHash, Code: code}
+	txDBWapper.Tx = models.Tx{Hash: tx.TxResponse.TxHash, Code: code, GasWanted: tx.TxResponse.GasWanted, GasUsed: tx.TxResponse.GasUsed, Memo: tx.Tx.Body.Memo}
+	// The raw log of a failed tx is the reason it failed
+	if code != 0 {
+		txDBWapper.Tx.ErrorMessage = truncateText(tx.TxResponse.RawLog, cfg.Flags.TxErrorMaxLength)
+	}
 	txDBWapper.Messages = messages
 	txDBWapper.UniqueMessageTypes = uniqueMessageTypes
 	txDBWapper.UniqueMessageAttributeKeys = uniqueEventAttributeKeys
@@ -427,7 +493,10 @@ func ProcessSigners(cl *client.ChainClient, authInfo *cosmosTx.AuthInfo, message
 
 			if ok {
 				for _, key := range multisigKey.GetPubKeys() {
-					address := types.AccAddress(key.Address().Bytes()).String()
+					address, err := accAddress(cl, key.Address().Bytes())
+					if err != nil {
+						return nil, err
+					}
 					if _, ok := signerAddressMap[address]; !ok {
 						signerAddressArray = append(signerAddressArray, models.Address{Address: address})
 					}
@@ -439,7 +508,10 @@ func ProcessSigners(cl *client.ChainClient, authInfo *cosmosTx.AuthInfo, message
 					return nil, err
 				}
 
-				address := types.AccAddress(castPubKey.Address().Bytes()).String()
+				address, err := accAddress(cl, castPubKey.Address().Bytes())
+				if err != nil {
+					return nil, err
+				}
 				if _, ok := signerAddressMap[address]; !ok {
 					signerAddressArray = append(signerAddressArray, models.Address{Address: address})
 				}
@@ -450,7 +522,10 @@ func ProcessSigners(cl *client.ChainClient, authInfo *cosmosTx.AuthInfo, message
 	}
 
 	for _, signer := range messageSigners {
-		addressStr := signer.String()
+		addressStr, err := accAddress(cl, signer)
+		if err != nil {
+			return nil, err
+		}
 		if _, ok := signerAddressMap[addressStr]; !ok {
 			signerAddressArray = append(signerAddressArray, models.Address{Address: addressStr})
 		}
@@ -468,10 +543,39 @@ func ProcessSigners(cl *client.ChainClient, authInfo *cosmosTx.AuthInfo, message
 	return signerAddressArray, nil
 }
 
+// accAddress encodes the account address with the account prefix of the chain client. The bech32 prefixes of the SDK
+// are global to the process, they only match one of the chains when several are indexed.
+func accAddress(cl *client.ChainClient, address []byte) (string, error) {
+	if cl.Config == nil || cl.Config.AccountPrefix == "" {
+		return types.AccAddress(address).String(), nil
+	}
+	return bech32.ConvertAndEncode(cl.Config.AccountPrefix, address)
+}
+
+// messageSigners returns the signers of the message. The SDK parses the signer addresses with its global bech32
+// prefixes, the messages of a chain with another prefix panic or return empty signers. Their signers are then only taken
+// from the signer infos of the tx.
+func messageSigners(message types.Msg) (signers []types.AccAddress) {
+	defer func() {
+		if r := recover(); r != nil {
+			config.Log.Debugf("Signers of message %s could not be parsed: %v", types.MsgTypeURL(message), r)
+			signers = nil
+		}
+	}()
+
+	for _, signer := range message.GetSigners() {
+		if !signer.Empty() {
+			signers = append(signers, signer)
+		}
+	}
+	return signers
+}
+
 // Processes fees into model form, applying denoms and addresses to them
 func ProcessFees(db *gorm.DB, authInfo cosmosTx.AuthInfo, signers []models.Address) ([]models.Fee, error) {
 	feeCoins := authInfo.Fee.Amount
 	payer := authInfo.Fee.GetPayer()
+	granter := authInfo.Fee.GetGranter()
 	fees := []models.Fee{}
 
 	for _, coin := range feeCoins {
@@ -488,14 +592,33 @@ func ProcessFees(db *gorm.DB, authInfo cosmosTx.AuthInfo, signers []models.Addre
 				payerAddr = signers[0]
 			}
 
-			fees = append(fees, models.Fee{Amount: amount, Denomination: denom, PayerAddress: payerAddr})
+			fee := models.Fee{Amount: amount, Denomination: denom, PayerAddress: payerAddr}
+			if granter != "" {
+				fee.GranterAddress = &models.Address{Address: granter}
+			}
+
+			fees = append(fees, fee)
 		}
 	}
 
 	return fees, nil
 }
 
-func ProcessMessage(messageIndex int, message types.Msg, messageLog *txtypes.LogMessage, uniqueEventTypes map[string]models.MessageEventType, uniqueEventAttributeKeys map[string]models.MessageEventAttributeKey) (string, dbTypes.MessageDBWrapper) {
+// messageValue returns the proto JSON of the decoded message. A message that cannot be marshaled is stored as an
+// {"error": "..."} object instead of failing the block.
+func messageValue(message types.Msg) json.RawMessage {
+	value, err := codec.ProtoMarshalJSON(message, nil)
+	if err == nil {
+		value, err = sanitizeJSON(value)
+	}
+	if err != nil {
+		config.Log.Warnf("Error marshaling message of type %s to JSON, storing the error instead. Err: %v", types.MsgTypeURL(message), err)
+		value, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	return value
+}
+
+func ProcessMessage(messageIndex int, message types.Msg, messageLog *txtypes.LogMessage, uniqueEventTypes map[string]models.MessageEventType, uniqueEventAttributeKeys map[string]models.MessageEventAttributeKey, invalidTextPolicy string) (string, dbTypes.MessageDBWrapper, error) {
 	var currMessage models.Message
 	var currMessageType models.MessageType
 	currMessage.MessageIndex = messageIndex
@@ -508,20 +631,29 @@ func ProcessMessage(messageIndex int, message types.Msg, messageLog *txtypes.Log
 	currMessageDBWrapper.Message = currMessage
 
 	for eventIndex, event := range messageLog.Events {
-		uniqueEventTypes[event.Type] = models.MessageEventType{Type: event.Type}
+		eventType := sanitizeLookupValue(event.Type)
+		uniqueEventTypes[eventType] = models.MessageEventType{Type: eventType}
 
 		var currMessageEvent dbTypes.MessageEventDBWrapper
 		currMessageEvent.MessageEvent = models.MessageEvent{
-			MessageEventType: uniqueEventTypes[event.Type],
+			MessageEventType: uniqueEventTypes[eventType],
 			Index:            uint64(eventIndex),
 		}
 		var currMessageEventAttributes []models.MessageEventAttribute
 		for attributeIndex, attribute := range event.Attributes {
-			uniqueEventAttributeKeys[attribute.Key] = models.MessageEventAttributeKey{Key: attribute.Key}
+			key := sanitizeLookupValue(attribute.Key)
+			uniqueEventAttributeKeys[key] = models.MessageEventAttributeKey{Key: key}
+
+			value, err := sanitizeAttributeValue(attribute.Value, invalidTextPolicy)
+			if err != nil {
+				return currMessageType.MessageType, currMessageDBWrapper, err
+			}
 
 			currMessageEventAttributes = append(currMessageEventAttributes, models.MessageEventAttribute{
-				Value:                    attribute.Value,
-				MessageEventAttributeKey: uniqueEventAttributeKeys[attribute.Key],
+				Value:                    value.Value,
+				ValueBytes:               value.ValueBytes,
+				Sanitized:                value.Sanitized,
+				MessageEventAttributeKey: uniqueEventAttributeKeys[key],
 				Index:                    uint64(attributeIndex),
 			})
 		}
@@ -529,5 +661,5 @@ func ProcessMessage(messageIndex int, message types.Msg, messageLog *txtypes.Log
 		currMessageEvent.Attributes = currMessageEventAttributes
 		currMessageDBWrapper.MessageEvents = append(currMessageDBWrapper.MessageEvents, currMessageEvent)
 	}
-	return currMessageType.MessageType, currMessageDBWrapper
+	return currMessageType.MessageType, currMessageDBWrapper, nil
 }
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/DefiantLabs/probe/client"
+	"github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	cosmosTx "github.com/cosmos/cosmos-sdk/types/tx"
+	bankTypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type TxTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TxTestSuite) TestProcessSignersChainPrefix() {
+	signer := types.AccAddress([]byte("signer-address-bytes"))
+	osmoSigner, err := bech32.ConvertAndEncode("osmo", signer)
+	suite.Require().NoError(err)
+
+	cl := &client.ChainClient{Config: &client.ChainClientConfig{AccountPrefix: "osmo"}}
+	signers, err := ProcessSigners(cl, &cosmosTx.AuthInfo{Fee: &cosmosTx.Fee{}}, []types.AccAddress{signer})
+	suite.Require().NoError(err)
+	suite.Require().Len(signers, 1)
+	suite.Assert().Equal(osmoSigner, signers[0].Address)
+
+	// The SDK parses the signers of the message with the global cosmos prefix
+	msg := &bankTypes.MsgSend{FromAddress: osmoSigner, ToAddress: osmoSigner}
+	suite.Assert().Empty(messageSigners(msg))
+
+	msg = &bankTypes.MsgSend{FromAddress: signer.String(), ToAddress: signer.String()}
+	suite.Assert().Equal([]types.AccAddress{signer}, messageSigners(msg))
+}
+
+func TestTxSuite(t *testing.T) {
+	suite.Run(t, new(TxTestSuite))
+}
@@ -18,6 +18,8 @@ type Response struct {
 	Code      uint32       `json:"code"`
 	RawLog    string       `json:"raw_log"`
 	Log       []LogMessage `json:"logs"`
+	GasWanted int64        `json:"gas_wanted,string"`
+	GasUsed   int64        `json:"gas_used,string"`
 }
 
 // TxLogMessage:
@@ -61,6 +63,7 @@ type LogMessageEvent struct {
 
 type Body struct {
 	Messages []sdk.Msg `json:"messages"`
+	Memo     string    `json:"memo"`
 }
 
 type AuthInfo struct {
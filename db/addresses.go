@@ -0,0 +1,137 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"gorm.io/gorm"
+)
+
+// InvalidAddressError is returned for an address that is not a bech32 address with the expected prefix
+type InvalidAddressError struct {
+	Address string
+	Reason  string
+}
+
+func (e *InvalidAddressError) Error() string {
+	return fmt.Sprintf("invalid address %q: %s", e.Address, e.Reason)
+}
+
+// NormalizeAddress returns the canonical form of a bech32 address: trimmed, lower case and re-encoded from its bytes, so the
+// same account is always stored and looked up as the same string. An empty prefix accepts any prefix. Returns an
+// *InvalidAddressError if the address does not decode or has another prefix.
+func NormalizeAddress(address, prefix string) (string, error) {
+	// bech32 rejects mixed case, the checksum is computed over the lower case form
+	normalized := strings.ToLower(strings.TrimSpace(address))
+	if normalized == "" {
+		return "", &InvalidAddressError{Address: address, Reason: "address is empty"}
+	}
+
+	hrp, data, err := bech32.DecodeAndConvert(normalized)
+	if err != nil {
+		return "", &InvalidAddressError{Address: address, Reason: err.Error()}
+	}
+	if prefix != "" && hrp != prefix {
+		return "", &InvalidAddressError{Address: address, Reason: fmt.Sprintf("expected prefix %s, got %s", prefix, hrp)}
+	}
+
+	normalized, err = bech32.ConvertAndEncode(hrp, data)
+	if err != nil {
+		return "", &InvalidAddressError{Address: address, Reason: err.Error()}
+	}
+	return normalized, nil
+}
+
+// normalizeTxAddresses normalizes the signer, fee payer and fee granter addresses of the txs in place
+func normalizeTxAddresses(txs []TxDBWrapper, prefix string) error {
+	for _, tx := range txs {
+		for i := range tx.Tx.SignerAddresses {
+			address, err := NormalizeAddress(tx.Tx.SignerAddresses[i].Address, prefix)
+			if err != nil {
+				return fmt.Errorf("signer of tx %s: %w", tx.Tx.Hash, err)
+			}
+			tx.Tx.SignerAddresses[i].Address = address
+		}
+		for i := range tx.Tx.Fees {
+			address, err := NormalizeAddress(tx.Tx.Fees[i].PayerAddress.Address, prefix)
+			if err != nil {
+				return fmt.Errorf("fee payer of tx %s: %w", tx.Tx.Hash, err)
+			}
+			tx.Tx.Fees[i].PayerAddress.Address = address
+
+			if granter := tx.Tx.Fees[i].GranterAddress; granter != nil {
+				address, err := NormalizeAddress(granter.Address, prefix)
+				if err != nil {
+					return fmt.Errorf("fee granter of tx %s: %w", tx.Tx.Hash, err)
+				}
+				granter.Address = address
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeChainAddress normalizes an address looked up on the chain like IndexNewBlocks normalizes the stored ones: with
+// NormalizeAddress against the bech32 prefix of the chain row, left as is when the row has none
+func normalizeChainAddress(db *gorm.DB, chain ChainRef, address string) (string, error) {
+	prefix, err := getChainBech32Prefix(db, chain.ID)
+	if err != nil || prefix == "" {
+		return address, err
+	}
+	return NormalizeAddress(address, prefix)
+}
+
+// addressLookupChunkSize is the number of addresses per query of GetAddresses, well under the bind parameter limit
+const addressLookupChunkSize = 5000
+
+// GetAddresses returns the indexed addresses among the given ones, normalized with NormalizeAddress against the prefix
+// before the lookup, ordered by ID. Addresses that were never indexed are left out. Large lists are looked up in chunks.
+// Returns an *InvalidAddressError for the first invalid address.
+func GetAddresses(ctx context.Context, db *gorm.DB, prefix string, addresses ...string) ([]models.Address, error) {
+	db = readDB(ctx, db)
+	if len(addresses) == 0 {
+		return nil, errors.New("at least one address is required")
+	}
+
+	// The same account may be passed in several forms, it is looked up once
+	unique := make(map[string]struct{}, len(addresses))
+	normalized := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		address, err := NormalizeAddress(address, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := unique[address]; !ok {
+			unique[address] = struct{}{}
+			normalized = append(normalized, address)
+		}
+	}
+
+	var found []models.Address
+	for start := 0; start < len(normalized); start += addressLookupChunkSize {
+		end := start + addressLookupChunkSize
+		if end > len(normalized) {
+			end = len(normalized)
+		}
+
+		var chunkFound []models.Address
+		if err := db.Where("address IN ?", normalized[start:end]).Find(&chunkFound).Error; err != nil {
+			config.Log.Errorf("Error looking up %d addresses. Err: %v", len(normalized), err)
+			return nil, err
+		}
+		found = append(found, chunkFound...)
+	}
+
+	slices.SortFunc(found, func(a, b models.Address) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+	config.Log.Debugf("Found %d of %d addresses in the db", len(found), len(normalized))
+	return found, nil
+}
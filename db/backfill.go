@@ -0,0 +1,311 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultBackfillBackoff = 5 * time.Second
+
+var (
+	// ErrBackfillJobNotFound is returned when pausing or resuming a backfill that has never been started
+	ErrBackfillJobNotFound = errors.New("backfill job has not been started")
+	// ErrBackfillJobCompleted is returned when pausing or resuming a backfill that has already completed
+	ErrBackfillJobCompleted = errors.New("backfill job has already completed")
+)
+
+// BackfillBatch is a batch of rows loaded by a BackfillJob. Cursor is the ID of the last row in the batch.
+type BackfillBatch struct {
+	Rows   any
+	Count  int
+	Cursor uint
+}
+
+// BackfillJob computes and stores something for every row of a table, walking the table in ID order. A BackfillRunner
+// runs the job in batches and persists the cursor after each one, so the job resumes where it stopped.
+type BackfillJob interface {
+	// Name uniquely identifies the job, its progress is stored under this name
+	Name() string
+	// BatchQuery loads up to limit rows with an ID above the cursor in ID order. An empty batch completes the job.
+	BatchQuery(db *gorm.DB, cursor uint, limit int) (BackfillBatch, error)
+	// ProcessBatch updates the rows of the batch, it runs in the same transaction as the cursor update
+	ProcessBatch(db *gorm.DB, batch BackfillBatch) error
+}
+
+// BackfillThrottle limits the load a backfill puts on the database, zero values disable a limit
+type BackfillThrottle struct {
+	RowsPerSecond float64
+	// MaxReplicationLag holds batches while the replay lag of any replica is above it
+	MaxReplicationLag time.Duration
+	// MaxActiveQueries holds batches while more queries than this are active on the database
+	MaxActiveQueries int64
+	// BackoffInterval is how long a held or paused job waits before checking again, defaults to 5 seconds
+	BackoffInterval time.Duration
+}
+
+// BackfillProgress is reported after every batch
+type BackfillProgress struct {
+	Job           string
+	Cursor        uint
+	RowsProcessed int64
+	RowsPerSecond float64 // Average since the runner started the job
+}
+
+// BackfillRunner runs backfill jobs in batches under a throttle
+type BackfillRunner struct {
+	DB         *gorm.DB
+	BatchSize  int
+	Throttle   BackfillThrottle
+	OnProgress func(BackfillProgress) // Optional, called after every batch
+}
+
+func NewBackfillRunner(db *gorm.DB, batchSize int, throttle BackfillThrottle) *BackfillRunner {
+	if throttle.BackoffInterval <= 0 {
+		throttle.BackoffInterval = defaultBackfillBackoff
+	}
+
+	return &BackfillRunner{
+		DB:        db,
+		BatchSize: batchSize,
+		Throttle:  throttle,
+	}
+}
+
+// Run runs the job from its stored cursor until it completes or the context is cancelled. While the job is paused
+// the runner waits for it to be resumed. Running a completed job does nothing, use ResetBackfillJob to run it again.
+func (r *BackfillRunner) Run(ctx context.Context, job BackfillJob) error {
+	db := r.DB.WithContext(ctx)
+
+	state, err := startBackfillJob(db, job.Name())
+	if err != nil {
+		return err
+	}
+
+	if state.Status == models.BackfillCompleted {
+		config.Log.Infof("Backfill %s already completed, skipping", job.Name())
+		return nil
+	}
+
+	startedAt := time.Now()
+	var rowsThisRun int64
+
+	for {
+		if err := r.waitForCapacity(ctx, job.Name()); err != nil {
+			return err
+		}
+
+		batchStart := time.Now()
+
+		batch, err := job.BatchQuery(db, state.Cursor, r.BatchSize)
+		if err != nil {
+			return recordBackfillError(r.DB, job.Name(), err)
+		}
+
+		if batch.Count == 0 {
+			now := time.Now()
+			err = db.Model(&models.BackfillJob{}).Where("name = ?", job.Name()).
+				Updates(map[string]any{"status": models.BackfillCompleted, "completed_at": now, "last_error": ""}).Error
+			if err == nil {
+				config.Log.Infof("Backfill %s completed, %d rows processed", job.Name(), state.RowsProcessed)
+			}
+			return err
+		}
+
+		err = db.Transaction(func(dbTransaction *gorm.DB) error {
+			if err := job.ProcessBatch(dbTransaction, batch); err != nil {
+				return err
+			}
+
+			// The status is left alone so a pause during the batch is not overwritten
+			return dbTransaction.Model(&models.BackfillJob{}).Where("name = ?", job.Name()).
+				Updates(map[string]any{"cursor": batch.Cursor, "rows_processed": gorm.Expr("rows_processed + ?", batch.Count), "last_error": ""}).Error
+		})
+		if err != nil {
+			return recordBackfillError(r.DB, job.Name(), err)
+		}
+
+		state.Cursor = batch.Cursor
+		state.RowsProcessed += int64(batch.Count)
+		rowsThisRun += int64(batch.Count)
+
+		progress := BackfillProgress{
+			Job:           job.Name(),
+			Cursor:        state.Cursor,
+			RowsProcessed: state.RowsProcessed,
+			RowsPerSecond: float64(rowsThisRun) / time.Since(startedAt).Seconds(),
+		}
+		config.Log.Debugf("Backfill %s processed %d rows up to cursor %d, %.1f rows/s", progress.Job, progress.RowsProcessed, progress.Cursor, progress.RowsPerSecond)
+		if r.OnProgress != nil {
+			r.OnProgress(progress)
+		}
+
+		if err := sleepContext(ctx, rateLimitDelay(batch.Count, time.Since(batchStart), r.Throttle.RowsPerSecond)); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForCapacity blocks while the job is paused or the database is over the throttle limits
+func (r *BackfillRunner) waitForCapacity(ctx context.Context, name string) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		reason, err := r.holdReason(r.DB.WithContext(ctx), name)
+		if err != nil {
+			return err
+		}
+
+		if reason == "" {
+			return nil
+		}
+
+		config.Log.Debugf("Backfill %s waiting, %s", name, reason)
+		if err := sleepContext(ctx, r.Throttle.BackoffInterval); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *BackfillRunner) holdReason(db *gorm.DB, name string) (string, error) {
+	var status models.BackfillStatus
+	if err := db.Model(&models.BackfillJob{}).Select("status").Where("name = ?", name).Scan(&status).Error; err != nil {
+		return "", err
+	}
+
+	if status == models.BackfillPaused {
+		return "job is paused", nil
+	}
+
+	// The throttles read the PostgreSQL statistics views
+	if r.Throttle.MaxReplicationLag > 0 || r.Throttle.MaxActiveQueries > 0 {
+		if err := requirePostgres(db); err != nil {
+			return "", err
+		}
+	}
+
+	if r.Throttle.MaxReplicationLag > 0 {
+		var lagSeconds float64
+		if err := db.Raw("SELECT COALESCE(EXTRACT(EPOCH FROM MAX(replay_lag)), 0) FROM pg_stat_replication").Scan(&lagSeconds).Error; err != nil {
+			return "", err
+		}
+
+		if lag := time.Duration(lagSeconds * float64(time.Second)); lag > r.Throttle.MaxReplicationLag {
+			return fmt.Sprintf("replication lag %s is above %s", lag.Round(time.Millisecond), r.Throttle.MaxReplicationLag), nil
+		}
+	}
+
+	if r.Throttle.MaxActiveQueries > 0 {
+		var activeQueries int64
+		if err := db.Raw("SELECT COUNT(*) FROM pg_stat_activity WHERE state = 'active' AND pid <> pg_backend_pid()").Scan(&activeQueries).Error; err != nil {
+			return "", err
+		}
+
+		if activeQueries > r.Throttle.MaxActiveQueries {
+			return fmt.Sprintf("%d active queries is above %d", activeQueries, r.Throttle.MaxActiveQueries), nil
+		}
+	}
+
+	return "", nil
+}
+
+// rateLimitDelay returns how much longer to wait after a batch of rows took elapsed to stay under rowsPerSecond
+func rateLimitDelay(rows int, elapsed time.Duration, rowsPerSecond float64) time.Duration {
+	if rowsPerSecond <= 0 {
+		return 0
+	}
+
+	minimum := time.Duration(float64(rows) / rowsPerSecond * float64(time.Second))
+	if elapsed >= minimum {
+		return 0
+	}
+
+	return minimum - elapsed
+}
+
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func startBackfillJob(db *gorm.DB, name string) (models.BackfillJob, error) {
+	state := models.BackfillJob{Name: name, Status: models.BackfillRunning, StartedAt: time.Now()}
+
+	err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&state).Error
+	if err != nil {
+		return state, err
+	}
+
+	err = db.Where("name = ?", name).First(&state).Error
+	return state, err
+}
+
+// recordBackfillError is passed a db without the run context, so errors are recorded for runs that were cancelled
+func recordBackfillError(db *gorm.DB, name string, backfillErr error) error {
+	if err := db.Model(&models.BackfillJob{}).Where("name = ?", name).Update("last_error", backfillErr.Error()).Error; err != nil {
+		config.Log.Error("Error recording backfill error.", err)
+	}
+
+	return fmt.Errorf("backfill %s failed: %w", name, backfillErr)
+}
+
+// GetBackfillJobs returns the progress of every backfill that has been started
+func GetBackfillJobs(ctx context.Context, db *gorm.DB) ([]models.BackfillJob, error) {
+	db = db.WithContext(ctx)
+	var jobs []models.BackfillJob
+	err := db.Order("name").Find(&jobs).Error
+	return jobs, err
+}
+
+// PauseBackfillJob pauses a backfill, runners holding the job wait until it is resumed
+func PauseBackfillJob(ctx context.Context, db *gorm.DB, name string) error {
+	db = db.WithContext(ctx)
+	return setBackfillJobStatus(db, name, models.BackfillPaused)
+}
+
+// ResumeBackfillJob resumes a paused backfill
+func ResumeBackfillJob(ctx context.Context, db *gorm.DB, name string) error {
+	db = db.WithContext(ctx)
+	return setBackfillJobStatus(db, name, models.BackfillRunning)
+}
+
+// ResetBackfillJob clears the progress of a backfill so the next run starts from the first row
+func ResetBackfillJob(ctx context.Context, db *gorm.DB, name string) error {
+	db = db.WithContext(ctx)
+	return db.Where("name = ?", name).Delete(&models.BackfillJob{}).Error
+}
+
+func setBackfillJobStatus(db *gorm.DB, name string, status models.BackfillStatus) error {
+	var state models.BackfillJob
+	err := db.Where("name = ?", name).First(&state).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", ErrBackfillJobNotFound, name)
+	} else if err != nil {
+		return err
+	}
+
+	if state.Status == models.BackfillCompleted {
+		return fmt.Errorf("%w: %s", ErrBackfillJobCompleted, name)
+	}
+
+	return db.Model(&state).Update("status", status).Error
+}
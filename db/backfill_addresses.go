@@ -0,0 +1,69 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/util"
+	"gorm.io/gorm"
+)
+
+// CanonicalAddressHexBackfill fills in Address.CanonicalHex for addresses created before it was tracked
+type CanonicalAddressHexBackfill struct{}
+
+func (CanonicalAddressHexBackfill) Name() string {
+	return "canonical-address-hex"
+}
+
+func (CanonicalAddressHexBackfill) BatchQuery(db *gorm.DB, cursor uint, limit int) (BackfillBatch, error) {
+	var addresses []models.Address
+	if err := db.Where("id > ?", cursor).Order("id").Limit(limit).Find(&addresses).Error; err != nil {
+		return BackfillBatch{}, err
+	}
+
+	batch := BackfillBatch{Rows: addresses, Count: len(addresses)}
+	if len(addresses) != 0 {
+		batch.Cursor = addresses[len(addresses)-1].ID
+	}
+
+	return batch, nil
+}
+
+func (CanonicalAddressHexBackfill) ProcessBatch(db *gorm.DB, batch BackfillBatch) error {
+	addresses, ok := batch.Rows.([]models.Address)
+	if !ok {
+		return errors.New("not an addresses batch")
+	}
+
+	// The batch is written in one UPDATE ... FROM (VALUES ...) statement
+	if err := requireDialect(db, config.DialectPostgres, config.DialectCockroachDB); err != nil {
+		return err
+	}
+
+	var values []string
+	var args []any
+	for _, address := range addresses {
+		canonicalHex := util.CanonicalAddressHex(address.Address)
+		if canonicalHex == address.CanonicalHex {
+			continue
+		}
+
+		values = append(values, "(?::bigint, ?)")
+		args = append(args, address.ID, canonicalHex)
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	return db.Exec("UPDATE addresses SET canonical_hex = v.canonical_hex FROM (VALUES "+strings.Join(values, ", ")+") AS v(id, canonical_hex) WHERE addresses.id = v.id", args...).Error
+}
+
+// BuiltinBackfillJobs returns the backfills provided by the indexer
+func BuiltinBackfillJobs() []BackfillJob {
+	return []BackfillJob{
+		CanonicalAddressHexBackfill{},
+	}
+}
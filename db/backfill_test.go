@@ -0,0 +1,28 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type BackfillTestSuite struct {
+	suite.Suite
+}
+
+func (suite *BackfillTestSuite) TestRateLimitDelay() {
+	// 100 rows at 50 rows/s must take 2 seconds
+	suite.Assert().Equal(1500*time.Millisecond, rateLimitDelay(100, 500*time.Millisecond, 50))
+	suite.Assert().Equal(time.Duration(0), rateLimitDelay(100, 3*time.Second, 50))
+	suite.Assert().Equal(time.Duration(0), rateLimitDelay(100, 0, 0))
+}
+
+func (suite *BackfillTestSuite) TestNewBackfillRunnerDefaults() {
+	runner := NewBackfillRunner(nil, 100, BackfillThrottle{})
+	suite.Assert().Equal(defaultBackfillBackoff, runner.Throttle.BackoffInterval)
+}
+
+func TestBackfillSuite(t *testing.T) {
+	suite.Run(t, new(BackfillTestSuite))
+}
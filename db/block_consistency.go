@@ -0,0 +1,48 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+)
+
+// BlockConflictError is returned when a block already exists in the DB with data that conflicts with the block being indexed.
+// The existing rows are left untouched, the height needs to be rolled back and reindexed instead of mixing data.
+type BlockConflictError struct {
+	Height            int64
+	ChainID           uint
+	StoredTimeStamp   time.Time
+	IncomingTimeStamp time.Time
+}
+
+func (e *BlockConflictError) Error() string {
+	return fmt.Sprintf("block %d already exists with timestamp %s, refusing to index conflicting block with timestamp %s",
+		e.Height, e.StoredTimeStamp.UTC().Format(time.RFC3339Nano), e.IncomingTimeStamp.UTC().Format(time.RFC3339Nano))
+}
+
+// checkBlockConsistency compares the stored block against the incoming block. A stored zero timestamp is the sentinel for
+// "not set yet" and is updated normally, an incoming zero timestamp keeps the stored one. Any other difference is a conflict.
+// A different block hash is a reorg, handled by replaceReorgedBlock before this check.
+func checkBlockConsistency(existing models.Block, incoming *models.Block) error {
+	if incoming.TimeStamp.IsZero() {
+		incoming.TimeStamp = existing.TimeStamp
+		return nil
+	}
+
+	if existing.TimeStamp.IsZero() {
+		return nil
+	}
+
+	// Postgres stores timestamps with microsecond precision
+	if !existing.TimeStamp.Truncate(time.Microsecond).Equal(incoming.TimeStamp.Truncate(time.Microsecond)) {
+		return &BlockConflictError{
+			Height:            incoming.Height,
+			ChainID:           incoming.ChainID,
+			StoredTimeStamp:   existing.TimeStamp,
+			IncomingTimeStamp: incoming.TimeStamp,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"gorm.io/gorm"
+)
+
+// chainLockClass is the first key of the advisory locks of the chains, the second is the ID of the chain row. It keeps
+// them apart from the advisory locks other applications may take on the same database.
+const chainLockClass = 0x63696478 // "cidx"
+
+// ChainLockedError is returned by AcquireChainLock when another session holds the lock of the chain
+type ChainLockedError struct {
+	ChainID string
+}
+
+func (e *ChainLockedError) Error() string {
+	return fmt.Sprintf("another indexer holds the lock for chain %s", e.ChainID)
+}
+
+// ChainLock is the lock of a chain taken by AcquireChainLock. It is held until Release is called or the process exits.
+type ChainLock struct {
+	chain ChainRef
+	conn  *sql.Conn // The session holding the advisory lock, nil when the dialect has no advisory locks
+}
+
+// AcquireChainLock takes a PostgreSQL session level advisory lock on the chain, so two indexers started against the same
+// database and chain do not index the same heights. The lock is held on a connection set aside from the pool for the
+// lifetime of the lock, PostgreSQL releases it when that connection closes, including when the process dies.
+// Returns a *ChainLockedError without waiting when another session holds the lock. Other dialects have no advisory
+// locks, the returned lock does nothing.
+func AcquireChainLock(ctx context.Context, db *gorm.DB, chain ChainRef) (*ChainLock, error) {
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+
+	lock := &ChainLock{chain: chain}
+	if dialect := dialectOf(db); dialect != config.DialectPostgres {
+		config.Log.Warnf("Chain lock is not supported on %s, nothing prevents another indexer from indexing chain %s", dialect, chain.ChainID)
+		return lock, nil
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1, $2)", chainLockClass, int32(chain.ID)).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !acquired {
+		conn.Close()
+		return nil, &ChainLockedError{ChainID: chain.ChainID}
+	}
+
+	lock.conn = conn
+	return lock, nil
+}
+
+// Release releases the lock and returns its connection to the pool
+func (l *ChainLock) Release() error {
+	if l == nil || l.conn == nil {
+		return nil
+	}
+	defer func() {
+		l.conn.Close()
+		l.conn = nil
+	}()
+
+	var released bool
+	if err := l.conn.QueryRowContext(context.Background(), "SELECT pg_advisory_unlock($1, $2)", chainLockClass, int32(l.chain.ID)).Scan(&released); err != nil {
+		return err
+	}
+	if !released {
+		return fmt.Errorf("lock for chain %s was not held", l.chain.ChainID)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"sync"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+const chainRegistryPluginName = "cosmos-indexer:chain-registry"
+
+// chainRegistry remembers the chain rows of the connection it is registered on by chain ID and row ID, so the chain of a
+// block or failed block is resolved with one query per process instead of one per write. Rows are added by
+// GetOrCreateChain and GetDBChainIDCached, and dropped by InvalidateChainCache and PurgeChainData.
+type chainRegistry struct {
+	mu        sync.RWMutex
+	byChainID map[string]models.Chain
+	byID      map[uint]models.Chain
+}
+
+func newChainRegistry() *chainRegistry {
+	return &chainRegistry{}
+}
+
+func (r *chainRegistry) Name() string {
+	return chainRegistryPluginName
+}
+
+func (r *chainRegistry) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// chainRegistryOf returns the chain registry registered on db, nil when there is none
+func chainRegistryOf(db *gorm.DB) *chainRegistry {
+	r, _ := db.Config.Plugins[chainRegistryPluginName].(*chainRegistry)
+	return r
+}
+
+// byChainIDOf returns the cached row of the chain with the chain ID
+func (r *chainRegistry) byChainIDOf(chainID string) (models.Chain, bool) {
+	if r == nil {
+		return models.Chain{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	chain, ok := r.byChainID[chainID]
+	return chain, ok
+}
+
+// byIDOf returns the cached row of the chain with the row ID
+func (r *chainRegistry) byIDOf(id uint) (models.Chain, bool) {
+	if r == nil {
+		return models.Chain{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	chain, ok := r.byID[id]
+	return chain, ok
+}
+
+// store caches the chain row
+func (r *chainRegistry) store(chain models.Chain) {
+	if r == nil || chain.ID == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.byChainID == nil {
+		r.byChainID = make(map[string]models.Chain)
+		r.byID = make(map[uint]models.Chain)
+	}
+	r.byChainID[chain.ChainID] = chain
+	r.byID[chain.ID] = chain
+}
+
+// reset empties the registry
+func (r *chainRegistry) reset() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.byChainID = nil
+	r.byID = nil
+}
+
+// GetDBChainIDCached returns the ID of the chain row like GetDBChainID, resolving each chain ID once per connection. The
+// name and metadata of chain are only used when the row is created, a cached row is not updated to them.
+func GetDBChainIDCached(ctx context.Context, db *gorm.DB, chain models.Chain) (uint, error) {
+	if cached, ok := chainRegistryOf(db).byChainIDOf(chain.ChainID); ok {
+		return cached.ID, nil
+	}
+	return GetDBChainID(ctx, db, chain)
+}
+
+// InvalidateChainCache drops the chain rows cached on the connection, e.g. after deleting chain rows directly in tests
+func InvalidateChainCache(db *gorm.DB) {
+	chainRegistryOf(db).reset()
+}
@@ -0,0 +1,213 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The worker types of the indexer checkpoints, one per dataset
+const (
+	CheckpointTxs         = "txs"
+	CheckpointBlockEvents = "block_events"
+)
+
+// checkpointWalkPageSize is the number of heights read at a time while advancing a checkpoint over heights that were
+// indexed before the checkpoint reached them
+const checkpointWalkPageSize = 1000
+
+// CheckpointWorkerTypes returns the worker types of the checkpoints of the enabled datasets
+func CheckpointWorkerTypes(transactions bool, blockEvents bool) []string {
+	var workerTypes []string
+	if transactions {
+		workerTypes = append(workerTypes, CheckpointTxs)
+	}
+	if blockEvents {
+		workerTypes = append(workerTypes, CheckpointBlockEvents)
+	}
+	return workerTypes
+}
+
+// checkpointRequirements are the requirements on a block for the checkpoint of the worker type to pass it
+func checkpointRequirements(workerType string) CompletenessRequirements {
+	return CompletenessRequirements{Transactions: workerType == CheckpointTxs, BlockEvents: workerType == CheckpointBlockEvents}
+}
+
+// GetIndexerCheckpoint returns the checkpoint of the worker type of the chain. found is false when the chain has none yet.
+func GetIndexerCheckpoint(ctx context.Context, db *gorm.DB, chain ChainRef, workerType string) (checkpoint models.IndexerCheckpoint, found bool, err error) {
+	if err := chain.Validate(); err != nil {
+		return checkpoint, false, err
+	}
+
+	err = db.WithContext(ctx).Where("chain_id = ? AND worker_type = ?", chain.ID, workerType).First(&checkpoint).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return checkpoint, false, nil
+	}
+	return checkpoint, err == nil, err
+}
+
+// GetIndexerCheckpoints returns the checkpoints of the chain by worker type
+func GetIndexerCheckpoints(ctx context.Context, db *gorm.DB, chain ChainRef) ([]models.IndexerCheckpoint, error) {
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+
+	var checkpoints []models.IndexerCheckpoint
+	err := db.WithContext(ctx).Where("chain_id = ?", chain.ID).Order("worker_type").Find(&checkpoints).Error
+	return checkpoints, err
+}
+
+// GetCheckpointResumeHeight returns the height to resume indexing the worker types from when starting at start, the
+// height after the lowest of their checkpoints, read without scanning the blocks table. start is returned when a worker
+// type has no checkpoint covering start.
+func GetCheckpointResumeHeight(ctx context.Context, db *gorm.DB, chain ChainRef, start int64, workerTypes ...string) (int64, error) {
+	if len(workerTypes) == 0 {
+		return start, nil
+	}
+
+	resume := int64(math.MaxInt64)
+	for _, workerType := range workerTypes {
+		checkpoint, found, err := GetIndexerCheckpoint(ctx, db, chain, workerType)
+		if err != nil {
+			return 0, err
+		}
+		if !found || checkpoint.StartHeight > start || checkpoint.LastContiguousHeight < start {
+			return start, nil
+		}
+		if checkpoint.LastContiguousHeight+1 < resume {
+			resume = checkpoint.LastContiguousHeight + 1
+		}
+	}
+	return resume, nil
+}
+
+// advanceCheckpoints advances the checkpoint of the worker type when one of the heights written in the transaction is the
+// next contiguous height, then past the heights after it that were already indexed. heights must be in increasing order.
+func advanceCheckpoints(tx *gorm.DB, chainID uint, workerType string, heights ...int64) error {
+	for _, height := range heights {
+		result := tx.Model(&models.IndexerCheckpoint{}).
+			Where("chain_id = ? AND worker_type = ? AND last_contiguous_height = ?", chainID, workerType, height-1).
+			Updates(map[string]any{"last_contiguous_height": height, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		// The walk covers the following heights of the transaction
+		if result.RowsAffected != 0 {
+			return extendCheckpoint(tx, chainID, workerType, height)
+		}
+	}
+	return nil
+}
+
+// extendCheckpoint advances the checkpoint of the worker type from height over the contiguous heights after it that are
+// already indexed, like the heights indexed while the checkpoint was held back by a failed block
+func extendCheckpoint(db *gorm.DB, chainID uint, workerType string, height int64) error {
+	condition, conditionArgs := checkpointRequirements(workerType).fullyIndexedCondition()
+
+	last := height
+	for {
+		var heights []int64
+		err := db.Table("blocks").
+			Where("chain_id = ? AND height > ? AND height <= ?", chainID, last, last+checkpointWalkPageSize).
+			Where(condition, conditionArgs...).
+			Order("height").
+			Pluck("height", &heights).Error
+		if err != nil {
+			return err
+		}
+
+		contiguous := last
+		for _, next := range heights {
+			if next != contiguous+1 {
+				break
+			}
+			contiguous = next
+		}
+
+		// A full page of contiguous heights may go on in the next page
+		full := contiguous == last+checkpointWalkPageSize
+		last = contiguous
+		if !full {
+			break
+		}
+	}
+
+	if last == height {
+		return nil
+	}
+	return db.Model(&models.IndexerCheckpoint{}).
+		Where("chain_id = ? AND worker_type = ? AND last_contiguous_height = ?", chainID, workerType, height).
+		Updates(map[string]any{"last_contiguous_height": last, "updated_at": time.Now()}).Error
+}
+
+// CheckpointVerification is the result of checking a checkpoint against the block rows
+type CheckpointVerification struct {
+	WorkerType string
+	Found      bool  // Whether the chain had a checkpoint for the worker type
+	Previous   int64 // Last contiguous height of the checkpoint before the check
+	Scanned    int64 // Last contiguous height found in the block rows
+	Checkpoint models.IndexerCheckpoint
+}
+
+// Ahead returns true when the checkpoint claimed heights that are not indexed, indexing resumed past them
+func (v CheckpointVerification) Ahead() bool {
+	return v.Found && v.Previous > v.Scanned
+}
+
+// VerifyIndexerCheckpoint finds the last contiguous height indexed for the worker type from start by scanning the block
+// rows, see GetMissingBlockRanges, and sets the checkpoint to it, so a checkpoint that diverged from the rows is corrected.
+// The chain gets a checkpoint starting at start when it has none yet, or one starting elsewhere. The checkpoint is then
+// advanced past the heights indexed during the scan.
+func VerifyIndexerCheckpoint(ctx context.Context, db *gorm.DB, chain ChainRef, workerType string, start int64) (CheckpointVerification, error) {
+	verification := CheckpointVerification{WorkerType: workerType}
+	heights, err := NewHeightRange(start, OpenEnd)
+	if err != nil {
+		return verification, err
+	}
+
+	previous, found, err := GetIndexerCheckpoint(ctx, db, chain, workerType)
+	if err != nil {
+		return verification, err
+	}
+	verification.Found, verification.Previous = found && previous.StartHeight == start, previous.LastContiguousHeight
+
+	gaps, err := GetMissingBlockRanges(ctx, db, chain, heights, checkpointRequirements(workerType))
+	if err != nil {
+		return verification, err
+	}
+	if len(gaps) != 0 {
+		verification.Scanned = gaps[0].Start - 1
+	} else {
+		highest, err := GetSnapshotHeight(ctx, db, chain)
+		if err != nil {
+			return verification, err
+		}
+		verification.Scanned = start - 1
+		if highest >= start {
+			verification.Scanned = highest
+		}
+	}
+
+	checkpoint := models.IndexerCheckpoint{ChainID: chain.ID, WorkerType: workerType, StartHeight: start, LastContiguousHeight: verification.Scanned}
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chain_id"}, {Name: "worker_type"}},
+			DoUpdates: clause.AssignmentColumns([]string{"start_height", "last_contiguous_height", "updated_at"}),
+		}).Create(&checkpoint).Error
+		if err != nil {
+			return err
+		}
+		return extendCheckpoint(tx, chain.ID, workerType, verification.Scanned)
+	})
+	if err != nil {
+		return verification, err
+	}
+
+	verification.Checkpoint, _, err = GetIndexerCheckpoint(ctx, db, chain, workerType)
+	return verification, err
+}
@@ -0,0 +1,375 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CompletenessRequirements defines what a block needs to count as fully indexed, matching the indexing enabled in the config
+type CompletenessRequirements struct {
+	Transactions bool
+	BlockEvents  bool
+	// Profiles are the requirements of blocks indexed with a range profile, by profile name. Blocks with no profile or one
+	// missing from the map use the requirements above.
+	Profiles map[string]CompletenessRequirements
+}
+
+// IndexProfileCount is the number of blocks in a range indexed with a range profile, empty for blocks indexed without one
+type IndexProfileCount struct {
+	Profile string
+	Blocks  int64
+}
+
+// GapRange is an inclusive range of heights with no block row at all, or for GetMissingBlockRanges none fully indexed
+type GapRange struct {
+	Start  int64
+	End    int64
+	Length int64
+}
+
+// CompletenessReport summarizes how much of a height range is fully indexed. Every height is counted in exactly one of
+// FullyIndexed, Partial (a block row exists but it is missing a required part or its timestamp) or Missing (no block row).
+// Blocks pruned by the retention policy count as FullyIndexed, Pruned counts them separately.
+// Failed block counts overlap with Partial and Missing, they are the remainder heights with a recorded failure.
+type CompletenessReport struct {
+	ChainID      string
+	Heights      HeightRange // Open ranges are resolved to the highest height in the database
+	Requirements CompletenessRequirements
+	GeneratedAt  time.Time
+	// SnapshotHeight is the highest height of the chain in the snapshot the report was read from
+	SnapshotHeight int64
+
+	TotalHeights int64
+	FullyIndexed int64
+	Partial      int64
+	Missing      int64
+	Pruned       int64
+
+	FullyIndexedPercent float64
+	PartialPercent      float64
+	MissingPercent      float64
+
+	GapCount           int64
+	WorstGap           *GapRange
+	FailedTxHeights    int64 // Heights in failed_blocks
+	FailedEventHeights int64 // Heights in failed_event_blocks
+
+	// OldestUnresolvedFailure is when the oldest failure still recorded in the range was first seen, nil if there are none
+	// or none have a recorded time
+	OldestUnresolvedFailure    *time.Time
+	OldestUnresolvedFailureAge time.Duration
+
+	// QuarantinedHeights are heights in the range with a stored sample of an unrecognized block event attribute. Samples
+	// are capped, so this is a lower bound.
+	QuarantinedHeights int64
+	// QuarantineCounts are the unrecognized attribute counts per event type for the whole chain, they are not tracked per height
+	QuarantineCounts []QuarantineCount
+
+	// IndexProfiles counts the blocks in the range by the range profile they were indexed with
+	IndexProfiles []IndexProfileCount
+}
+
+// GetCompletenessReport builds a CompletenessReport for the chain over the height range using set based queries,
+// so its cost scales with the number of indexed blocks in the range rather than iterating heights one by one.
+// All queries read from one snapshot, so the counts stay consistent while the indexer commits new blocks.
+func GetCompletenessReport(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange, requirements CompletenessRequirements) (CompletenessReport, error) {
+	db = readDB(ctx, db)
+	report := CompletenessReport{
+		ChainID:      chain.ChainID,
+		Heights:      heights,
+		Requirements: requirements,
+		GeneratedAt:  time.Now(),
+	}
+
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return report, err
+	}
+
+	err := WithSnapshot(ctx, db, func(tx *gorm.DB) error {
+		return getCompletenessReport(tx.Statement.Context, tx, chain, &report)
+	})
+
+	return report, err
+}
+
+func getCompletenessReport(ctx context.Context, db *gorm.DB, chain ChainRef, report *CompletenessReport) error {
+	var err error
+	if report.SnapshotHeight, err = GetSnapshotHeight(ctx, db, chain); err != nil {
+		return err
+	}
+
+	if report.Heights.IsOpen() {
+		// Nothing indexed past the start, the range is empty
+		if report.SnapshotHeight < report.Heights.Start {
+			report.Heights.End = report.Heights.Start - 1
+			return nil
+		}
+		report.Heights.End = report.SnapshotHeight
+	}
+
+	report.TotalHeights = report.Heights.End - report.Heights.Start + 1
+
+	if err := getBlockCompleteness(db, chain.ID, report); err != nil {
+		return err
+	}
+
+	if err := getGaps(db, chain.ID, report); err != nil {
+		return err
+	}
+
+	if err := getUnresolvedFailures(db, chain.ID, report); err != nil {
+		return err
+	}
+
+	if err := report.Heights.where(db.Table("quarantined_attributes").Where("chain_id = ?", chain.ID), "height").
+		Select("COUNT(DISTINCT height)").Scan(&report.QuarantinedHeights).Error; err != nil {
+		return err
+	}
+
+	if report.QuarantineCounts, err = GetQuarantineCounts(ctx, db, chain); err != nil {
+		return err
+	}
+
+	if err := report.Heights.where(db.Table("blocks").Where("chain_id = ?", chain.ID), "height").
+		Select("index_profile AS profile, COUNT(*) AS blocks").Group("index_profile").Order("index_profile").
+		Scan(&report.IndexProfiles).Error; err != nil {
+		return err
+	}
+
+	report.FullyIndexedPercent = percentOf(report.FullyIndexed, report.TotalHeights)
+	report.PartialPercent = percentOf(report.Partial, report.TotalHeights)
+	report.MissingPercent = percentOf(report.Missing, report.TotalHeights)
+
+	return nil
+}
+
+func getBlockCompleteness(db *gorm.DB, chainID uint, report *CompletenessReport) error {
+	fullyIndexedCondition, args := report.Requirements.fullyIndexedCondition()
+
+	var counts struct {
+		Present      int64
+		FullyIndexed int64
+		Pruned       int64
+	}
+
+	err := report.Heights.where(db.Table("blocks").Where("chain_id = ?", chainID), "height").
+		Select("COUNT(*) AS present, COUNT(*) FILTER (WHERE "+fullyIndexedCondition+") AS fully_indexed, COUNT(*) FILTER (WHERE pruned) AS pruned", args...).
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	report.FullyIndexed = counts.FullyIndexed
+	report.Partial = counts.Present - counts.FullyIndexed
+	report.Missing = report.TotalHeights - counts.Present
+	report.Pruned = counts.Pruned
+
+	return nil
+}
+
+// fullyIndexedCondition is the SQL condition on a blocks row being fully indexed under the requirements, and its arguments.
+// Pruned blocks meet the requirements, their data was deleted on purpose.
+func (requirements CompletenessRequirements) fullyIndexedCondition() (string, []any) {
+	requirementsCondition := requirements.condition()
+	// The zero timestamp is bound as a parameter so it matches how each dialect stores it
+	args := []any{time.Time{}}
+
+	// Blocks indexed with a range profile are only required to have what their profile indexes
+	if len(requirements.Profiles) != 0 {
+		profiles := make([]string, 0, len(requirements.Profiles))
+		for profile := range requirements.Profiles {
+			profiles = append(profiles, profile)
+		}
+		sort.Strings(profiles)
+
+		requirementsCondition = "CASE index_profile"
+		for _, profile := range profiles {
+			requirementsCondition += " WHEN ? THEN " + requirements.Profiles[profile].condition()
+			args = append(args, profile)
+		}
+		requirementsCondition += " ELSE " + requirements.condition() + " END"
+	}
+
+	return "time_stamp != ? AND (pruned OR " + requirementsCondition + ")", args
+}
+
+// failureTables returns the failure tables of the parts required by the requirements or any of their profiles
+func (requirements CompletenessRequirements) failureTables() []string {
+	transactions, blockEvents := requirements.Transactions, requirements.BlockEvents
+	for _, profile := range requirements.Profiles {
+		transactions = transactions || profile.Transactions
+		blockEvents = blockEvents || profile.BlockEvents
+	}
+
+	var tables []string
+	if transactions {
+		tables = append(tables, "failed_blocks")
+	}
+	if blockEvents {
+		tables = append(tables, "failed_event_blocks")
+	}
+	return tables
+}
+
+// condition is the SQL condition on a blocks row meeting the requirements, ignoring Profiles
+func (requirements CompletenessRequirements) condition() string {
+	condition := "TRUE"
+	if requirements.Transactions {
+		condition += " AND tx_indexed"
+	}
+	if requirements.BlockEvents {
+		condition += " AND block_events_indexed"
+	}
+	return "(" + condition + ")"
+}
+
+// gapsQuery is a CTE of the gaps between consecutive heights selected by rows in one pass with a window function. rows
+// selects a height column within the range, duplicates are allowed. The range bounds are added as sentinel rows so gaps at
+// the start and end of the range are found the same way.
+func gapsQuery(heights HeightRange, rows string, rowsArgs ...any) (string, []any) {
+	query := `WITH heights AS (
+			` + rows + `
+			UNION ALL SELECT CAST(? AS BIGINT)
+			UNION ALL SELECT CAST(? AS BIGINT)
+		), gaps AS (
+			SELECT prev_height + 1 AS start, height - 1 AS "end", height - prev_height - 1 AS length
+			FROM (SELECT height, LAG(height) OVER (ORDER BY height) AS prev_height FROM heights) ordered
+			WHERE height - prev_height > 1
+		)`
+
+	return query, append(rowsArgs, heights.Start-1, heights.End+1)
+}
+
+// blockHeightsQuery selects the heights of the block rows of the chain in the range matching the condition
+func blockHeightsQuery(chainID uint, heights HeightRange, condition string, conditionArgs ...any) (string, []any) {
+	query := "SELECT height FROM blocks WHERE chain_id = ? AND height >= ? AND height <= ? AND " + condition
+	return query, append([]any{chainID, heights.Start, heights.End}, conditionArgs...)
+}
+
+// getGaps finds the gaps in the block rows of the range
+func getGaps(db *gorm.DB, chainID uint, report *CompletenessReport) error {
+	rows, rowsArgs := blockHeightsQuery(chainID, report.Heights, "TRUE")
+	query, args := gapsQuery(report.Heights, rows, rowsArgs...)
+
+	if err := db.Raw(query+" SELECT COUNT(*) FROM gaps", args...).Scan(&report.GapCount).Error; err != nil {
+		return err
+	}
+
+	if report.GapCount == 0 {
+		return nil
+	}
+
+	var worstGap GapRange
+	if err := db.Raw(query+` SELECT start, "end", length FROM gaps ORDER BY length DESC, start LIMIT 1`, args...).Scan(&worstGap).Error; err != nil {
+		return err
+	}
+	report.WorstGap = &worstGap
+
+	return nil
+}
+
+// GetMissingBlockRanges returns the contiguous ranges of heights that are not fully indexed under the requirements, in
+// order. A height is not fully indexed when it has no block row, or a row without a timestamp or missing a required part,
+// like the Partial and Missing heights of CompletenessReport. Heights with a quarantined failure of a required part are
+// known holes and are not returned, and so are the heights below the floor of the unavailable ranges of the chain, see
+// GetUnavailableFloor, since they can never be fetched. An open range ends at the highest height of the chain in the
+// database.
+//
+// The ranges are found with a window function over the block rows of the range, so the cost scales with the number of
+// indexed blocks rather than the number of heights.
+func GetMissingBlockRanges(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange, requirements CompletenessRequirements) ([]GapRange, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	floor, err := GetUnavailableFloor(ctx, db, chain)
+	if err != nil {
+		return nil, err
+	}
+	if heights.Start < floor {
+		if !heights.IsOpen() && heights.End < floor {
+			return nil, nil
+		}
+		heights.Start = floor
+	}
+
+	if heights.IsOpen() {
+		highest, err := GetSnapshotHeight(ctx, db, chain)
+		if err != nil {
+			return nil, err
+		}
+		// Nothing indexed past the start, the range is empty
+		if highest < heights.Start {
+			return nil, nil
+		}
+		heights.End = highest
+	}
+
+	condition, conditionArgs := requirements.fullyIndexedCondition()
+	rows, rowsArgs := blockHeightsQuery(chain.ID, heights, condition, conditionArgs...)
+
+	// Quarantined failures of a required part are known holes
+	for _, table := range requirements.failureTables() {
+		rows += " UNION ALL SELECT height FROM " + table + " WHERE blockchain_id = ? AND height >= ? AND height <= ? AND quarantined"
+		rowsArgs = append(rowsArgs, chain.ID, heights.Start, heights.End)
+	}
+
+	query, args := gapsQuery(heights, rows, rowsArgs...)
+
+	var gaps []GapRange
+	err = db.Raw(query+` SELECT start, "end", length FROM gaps ORDER BY start`, args...).Scan(&gaps).Error
+	return gaps, err
+}
+
+func getUnresolvedFailures(db *gorm.DB, chainID uint, report *CompletenessReport) error {
+	var oldest *time.Time
+
+	for _, failures := range []struct {
+		table string
+		count *int64
+	}{
+		{"failed_blocks", &report.FailedTxHeights},
+		{"failed_event_blocks", &report.FailedEventHeights},
+	} {
+		failuresInRange := func() *gorm.DB {
+			return report.Heights.where(db.Table(failures.table).Where("blockchain_id = ?", chainID), "height")
+		}
+
+		if err := failuresInRange().Count(failures.count).Error; err != nil {
+			return err
+		}
+
+		if *failures.count == 0 {
+			continue
+		}
+
+		// Selected as a column rather than MIN(created_at) so SQLite still reports it as a timestamp
+		var failureOldest sql.NullTime
+		if err := failuresInRange().Select("created_at").Order("created_at").Limit(1).Scan(&failureOldest).Error; err != nil {
+			return err
+		}
+
+		if failureOldest.Valid && (oldest == nil || failureOldest.Time.Before(*oldest)) {
+			oldest = &failureOldest.Time
+		}
+	}
+
+	if oldest != nil {
+		report.OldestUnresolvedFailure = oldest
+		report.OldestUnresolvedFailureAge = report.GeneratedAt.Sub(*oldest)
+	}
+
+	return nil
+}
+
+func percentOf(count int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total) * 100
+}
@@ -0,0 +1,312 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
+)
+
+// ConnectOptions customizes the gorm session opened by PostgresDbConnectWithOptions without forking the db package.
+type ConnectOptions struct {
+	// GormConfig replaces the default gorm.Config. A missing Logger is filled in from the database log level.
+	// Naming strategy changes are allowed but are checked against the table names used in raw SQL by VerifySchema.
+	GormConfig *gorm.Config
+	// Plugins are registered with db.Use in order, after the connection is opened
+	Plugins []gorm.Plugin
+	// PostConnect runs after the plugins are registered and before any migrations
+	PostConnect func(*gorm.DB) error
+}
+
+// SchemaMismatchError is returned by VerifySchema when the gorm naming strategy maps a model to a different table than the one
+// the indexer queries in raw SQL.
+type SchemaMismatchError struct {
+	Mismatches []string
+}
+
+func (e *SchemaMismatchError) Error() string {
+	return fmt.Sprintf("gorm naming strategy is incompatible with the indexer schema: %s", strings.Join(e.Mismatches, ", "))
+}
+
+// PostgresDbConnectWithOptions connects to the database like PostgresDbConnect, applying the gorm customizations in opts
+func PostgresDbConnectWithOptions(host string, port string, database string, user string, password string, level string, opts ConnectOptions) (*gorm.DB, error) {
+	return PostgresDbConnectWithConfig(config.Database{Host: host, Port: port, Database: database, User: user, Password: password, LogLevel: level}, opts)
+}
+
+// PostgresDbConnectWithConfig connects to the database in the config, including its TLS settings and dialect, applying
+// the gorm customizations in opts
+func PostgresDbConnectWithConfig(dbConfig config.Database, opts ConnectOptions) (*gorm.DB, error) {
+	dsn, err := PostgresDSN(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+	if dbConfig.Dialect == config.DialectCockroachDB {
+		opts.Plugins = append([]gorm.Plugin{cockroachDB{}}, opts.Plugins...)
+	}
+	if dbConfig.Partitioning == config.PartitioningHeight {
+		opts.Plugins = append([]gorm.Plugin{newPartitioning(dbConfig)}, opts.Plugins...)
+	}
+	if dbConfig.CopyInserts {
+		opts.Plugins = append([]gorm.Plugin{copyInserts{}}, opts.Plugins...)
+	}
+
+	db, err := openWithOptions(postgres.Open(dsn), strings.ToLower(dbConfig.LogLevel), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Used by the bulk inserts of the indexer, see insertBatchSize, and by gorm for any other Create of a slice
+	if dbConfig.InsertBatchSize > 0 {
+		db.Config.CreateBatchSize = dbConfig.InsertBatchSize
+	}
+	return db, nil
+}
+
+// PostgresDbConnectWithRetry connects like PostgresDbConnectWithConfig and pings the database, retrying while it is not
+// accepting connections yet (e.g. still starting up next to the indexer). The wait between attempts doubles from 1 second
+// up to connect-retry-max-wait. Authentication and other errors that will not resolve on their own are returned without
+// retrying.
+func PostgresDbConnectWithRetry(ctx context.Context, dbConfig config.Database, opts ConnectOptions) (*gorm.DB, error) {
+	maxWait := time.Duration(dbConfig.ConnectRetryMaxWait) * time.Second
+
+	for attempt := int64(1); ; attempt++ {
+		config.Log.Infof("Connecting to the database at %s (attempt %d)", dbConfig.Address(), attempt)
+
+		db, err := connectAndPing(ctx, dbConfig, opts)
+		if err == nil {
+			return db, nil
+		}
+
+		if !IsTransientConnectError(err) {
+			return nil, err
+		}
+
+		if dbConfig.ConnectRetryAttempts >= 0 && attempt > dbConfig.ConnectRetryAttempts {
+			return nil, fmt.Errorf("database is not accepting connections after %d attempts: %w", attempt, err)
+		}
+
+		wait := connectRetryWait(attempt, maxWait)
+		config.Log.Warnf("Database is not accepting connections, retrying in %s. Err: %v", wait, err)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func connectAndPing(ctx context.Context, dbConfig config.Database, opts ConnectOptions) (*gorm.DB, error) {
+	db, err := PostgresDbConnectWithConfig(dbConfig, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	// gorm pings on open unless DisableAutomaticPing is set in a custom gorm.Config
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// connectRetryWait is the wait after the attempt, doubling from 1 second up to maxWait
+func connectRetryWait(attempt int64, maxWait time.Duration) time.Duration {
+	wait := time.Second
+	for i := int64(1); i < attempt && wait < maxWait; i++ {
+		wait *= 2
+	}
+
+	if wait > maxWait {
+		return maxWait
+	}
+	return wait
+}
+
+// PostgreSQL error codes of a server that cannot take the connection yet
+const (
+	pgCodeCannotConnectNow   = "57P03" // the database system is starting up or shutting down
+	pgCodeTooManyConnections = "53300"
+)
+
+// IsTransientConnectError returns true for connection errors that resolve once the database is up, like refused
+// connections, unresolvable hosts and a server that is still starting up. Authentication errors are not transient.
+func IsTransientConnectError(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == pgCodeCannotConnectNow || pgErr.Code == pgCodeTooManyConnections
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// Dial errors, DNS errors of a host that does not resolve yet and timeouts
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// PostgresDSN builds the connection string of the database in the config. An empty sslmode is disable. The URL is
+// returned as is when it is set.
+func PostgresDSN(dbConfig config.Database) (string, error) {
+	if dbConfig.URL != "" {
+		return dbConfig.URL, nil
+	}
+
+	if err := config.ValidateSSLMode(dbConfig.SSLMode); err != nil {
+		return "", err
+	}
+
+	sslMode := dbConfig.SSLMode
+	if sslMode == "" {
+		sslMode = config.SSLModeDisable
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=%s", quoteDSNValue(dbConfig.Host), quoteDSNValue(dbConfig.Port),
+		quoteDSNValue(dbConfig.Database), quoteDSNValue(dbConfig.User), quoteDSNValue(dbConfig.Password), quoteDSNValue(sslMode))
+
+	for _, param := range []struct {
+		name  string
+		value string
+	}{
+		{"sslrootcert", dbConfig.SSLRootCert},
+		{"sslcert", dbConfig.SSLCert},
+		{"sslkey", dbConfig.SSLKey},
+	} {
+		if param.value != "" {
+			dsn += fmt.Sprintf(" %s=%s", param.name, quoteDSNValue(param.value))
+		}
+	}
+
+	return dsn, nil
+}
+
+// quoteDSNValue single quotes a keyword/value connection string value when it is empty or contains whitespace, quotes
+// or backslashes, escaping the quotes and backslashes in it. Other values are returned as they are.
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\n\r\v\f'\\") {
+		return value
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
+func openWithOptions(dialector gorm.Dialector, level string, opts ConnectOptions) (*gorm.DB, error) {
+	var gormConfig gorm.Config
+	if opts.GormConfig != nil {
+		gormConfig = *opts.GormConfig
+	}
+
+	if gormConfig.Logger == nil {
+		gormLogLevel := logger.Silent
+
+		if level == "info" {
+			gormLogLevel = logger.Info
+		}
+		gormConfig.Logger = logger.Default.LogMode(gormLogLevel)
+	}
+
+	db, err := gorm.Open(dialector, &gormConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Use(newDictionaryCache()); err != nil {
+		return nil, err
+	}
+	if err := db.Use(newChainRegistry()); err != nil {
+		return nil, err
+	}
+
+	for _, plugin := range opts.Plugins {
+		if err := db.Use(plugin); err != nil {
+			return nil, fmt.Errorf("error registering gorm plugin %s: %w", plugin.Name(), err)
+		}
+	}
+
+	if opts.PostConnect != nil {
+		if err := opts.PostConnect(db); err != nil {
+			return nil, fmt.Errorf("error running post connect hook: %w", err)
+		}
+	}
+
+	return db, nil
+}
+
+// rawSQLTables are the table names the db package references directly in raw SQL and joins
+var rawSQLTables = []struct {
+	model any
+	table string
+}{
+	{&models.Chain{}, "chains"},
+	{&models.ChainCutover{}, "chain_cutovers"},
+	{&models.Block{}, "blocks"},
+	{&models.Validator{}, "validators"},
+	{&models.BlockSignature{}, "block_signatures"},
+	{&models.BlockEvent{}, "block_events"},
+	{&models.BlockEventType{}, "block_event_types"},
+	{&models.FailedBlock{}, "failed_blocks"},
+	{&models.FailedEventBlock{}, "failed_event_blocks"},
+	{&models.UnavailableBlockRange{}, "unavailable_block_ranges"},
+	{&models.IndexerCheckpoint{}, "indexer_checkpoints"},
+	{&models.Tx{}, "txes"},
+	{&models.Fee{}, "fees"},
+	{&models.Denom{}, "denoms"},
+	{&models.IBCDenom{}, "ibc_denoms"},
+	{&models.IBCTransfer{}, "ibc_transfers"},
+	{&models.Address{}, "addresses"},
+	{&models.MessageType{}, "message_types"},
+	{&models.Message{}, "messages"},
+	{&models.MessageEvent{}, "message_events"},
+	{&models.MessageEventType{}, "message_event_types"},
+	{&models.WatchedAddress{}, "watched_addresses"},
+	{&models.WatchedAddressActivity{}, "watched_address_activities"},
+	{&models.Upgrade{}, "upgrades"},
+	{&models.BackfillJob{}, "backfill_jobs"},
+	{&models.QuarantinedAttribute{}, "quarantined_attributes"},
+	{&models.AttributeQuarantineCount{}, "attribute_quarantine_counts"},
+}
+
+// VerifySchema checks that the naming strategy of the connection maps the indexer models to the table names used in raw SQL.
+// It is run by MigrateModels so an incompatible custom gorm.Config is rejected before any tables are created.
+func VerifySchema(db *gorm.DB) error {
+	cache := &sync.Map{}
+	var mismatches []string
+
+	for _, expected := range rawSQLTables {
+		modelSchema, err := schema.Parse(expected.model, cache, db.NamingStrategy)
+		if err != nil {
+			return err
+		}
+
+		if modelSchema.Table != expected.table {
+			mismatches = append(mismatches, fmt.Sprintf("%s maps to table %s, expected %s", modelSchema.Name, modelSchema.Table, expected.table))
+		}
+	}
+
+	if len(mismatches) != 0 {
+		return &SchemaMismatchError{Mismatches: mismatches}
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/tracing"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+const copyInsertsPluginName = "cosmos-indexer:copy-inserts"
+
+// copyInserts marks a connection that loads the message events and message event attributes of the blocks it indexes
+// with COPY into a temporary table, merged into the table with one INSERT ... SELECT ... ON CONFLICT per table. Batched
+// INSERTs send every row as bind parameters and are planned per batch, COPY streams the rows.
+type copyInserts struct{}
+
+func (copyInserts) Name() string {
+	return copyInsertsPluginName
+}
+
+func (copyInserts) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// copyInsertsEnabled reports whether the blocks indexed on the connection load their message events and attributes with
+// COPY. The COPY runs on the pgx connection under the transaction, which can only be pinned from the pool, so sessions
+// already in a transaction use batched INSERTs.
+func copyInsertsEnabled(db *gorm.DB) bool {
+	if _, ok := db.Config.Plugins[copyInsertsPluginName]; !ok || dialectOf(db) != config.DialectPostgres {
+		return false
+	}
+	_, isPool := db.Statement.ConnPool.(*sql.DB)
+	return isPool
+}
+
+// indexTransaction runs fc in a transaction. With COPY inserts enabled the transaction runs on a connection taken from the
+// pool for its duration, which is passed to fc for the COPY. Otherwise conn is nil.
+func indexTransaction(db *gorm.DB, fc func(dbTransaction *gorm.DB, conn *sql.Conn) error) (err error) {
+	ctx, span := startSpan(db.Statement.Context, db, "db.transaction")
+	defer func() { tracing.End(span, err) }()
+	db = db.WithContext(ctx)
+
+	if !copyInsertsEnabled(db) {
+		return db.Transaction(func(dbTransaction *gorm.DB) error {
+			return fc(dbTransaction, nil)
+		})
+	}
+
+	conn, err := db.Statement.ConnPool.(*sql.DB).Conn(db.Statement.Context)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	session := db.Session(&gorm.Session{Context: db.Statement.Context})
+	session.Statement.ConnPool = conn
+	return session.Transaction(func(dbTransaction *gorm.DB) error {
+		return fc(dbTransaction, conn)
+	})
+}
+
+// copyKey is the unique key of a merged row within its parent, the message of an event or the event of an attribute
+type copyKey struct {
+	parentID uint
+	index    uint64
+}
+
+// copyMerge loads rows into a table through a temporary table
+type copyMerge struct {
+	table   string
+	columns []string // Copied columns, the parent ID and index first
+	updates []string // Columns updated when the row already exists, like the upsert of the batched INSERT
+}
+
+// run copies the rows into the temporary table of the table on conn, which must be the connection of dbTransaction, and
+// merges them into the table. Returns the IDs of the inserted and updated rows by key.
+func (m copyMerge) run(dbTransaction *gorm.DB, conn *sql.Conn, rows [][]any) (map[copyKey]uint, error) {
+	ctx, span := startSpan(dbTransaction.Statement.Context, dbTransaction, "db.copy "+m.table, tracing.Table.String(m.table), tracing.RowCount.Int(len(rows)))
+	defer span.End()
+	tempTable := "copy_" + m.table
+	columns := quoteIdentifiers(m.columns)
+
+	// The temporary table lives as long as the pooled connection, its rows as long as the transaction
+	createTemp := fmt.Sprintf("CREATE TEMPORARY TABLE IF NOT EXISTS %s ON COMMIT DELETE ROWS AS SELECT %s FROM %s WITH NO DATA",
+		quoteIdentifier(tempTable), columns, quoteIdentifier(m.table))
+
+	err := conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return errors.New("copy inserts require the pgx driver")
+		}
+		pgxConn := stdlibConn.Conn()
+
+		if _, err := pgxConn.Exec(ctx, createTemp); err != nil {
+			return err
+		}
+		_, err := pgxConn.CopyFrom(ctx, pgx.Identifier{tempTable}, m.columns, pgx.CopyFromRows(rows))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	conflictColumns := partitionKeyColumns(dbTransaction, m.table, m.columns[0], m.columns[1])
+	conflictNames := make([]string, len(conflictColumns))
+	for i, column := range conflictColumns {
+		conflictNames[i] = column.Name
+	}
+	assignments := make([]string, len(m.updates))
+	for i, column := range m.updates {
+		assignments[i] = fmt.Sprintf("%s = EXCLUDED.%s", quoteIdentifier(column), quoteIdentifier(column))
+	}
+
+	merge := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s ON CONFLICT (%s) DO UPDATE SET %s RETURNING id, %s",
+		quoteIdentifier(m.table), columns, columns, quoteIdentifier(tempTable), quoteIdentifiers(conflictNames),
+		strings.Join(assignments, ", "), quoteIdentifiers(m.columns[:2]))
+
+	merged, err := dbTransaction.Raw(merge).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer merged.Close()
+
+	ids := make(map[copyKey]uint, len(rows))
+	for merged.Next() {
+		var id uint
+		var key copyKey
+		if err := merged.Scan(&id, &key.parentID, &key.index); err != nil {
+			return nil, err
+		}
+		ids[key] = id
+	}
+	return ids, merged.Err()
+}
+
+var messageEventsCopy = copyMerge{
+	table:   "message_events",
+	columns: []string{"message_id", "index", "message_event_type_id", "height"},
+	updates: []string{"message_event_type_id"},
+}
+
+var messageEventAttributesCopy = copyMerge{
+	table:   "message_event_attributes",
+	columns: []string{"message_event_id", "index", "value", "value_bytes", "sanitized", "message_event_attribute_key_id", "height"},
+	updates: []string{"value", "value_bytes", "sanitized", "message_event_attribute_key_id"},
+}
+
+// copyMessageEvents indexes the message events with COPY and sets their IDs, see copyInserts
+func copyMessageEvents(dbTransaction *gorm.DB, conn *sql.Conn, events []*models.MessageEvent) error {
+	rows := make([][]any, len(events))
+	for i, event := range events {
+		rows[i] = []any{int64(event.MessageID), int64(event.Index), int64(event.MessageEventTypeID), event.Height}
+	}
+
+	ids, err := messageEventsCopy.run(dbTransaction, conn, rows)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		event.ID = ids[copyKey{parentID: event.MessageID, index: event.Index}]
+	}
+	return nil
+}
+
+// copyMessageEventAttributes indexes the message event attributes with COPY and sets their IDs, see copyInserts
+func copyMessageEventAttributes(dbTransaction *gorm.DB, conn *sql.Conn, attributes []*models.MessageEventAttribute) error {
+	rows := make([][]any, len(attributes))
+	for i, attribute := range attributes {
+		rows[i] = []any{int64(attribute.MessageEventID), int64(attribute.Index), attribute.Value, attribute.ValueBytes,
+			attribute.Sanitized, int64(attribute.MessageEventAttributeKeyID), attribute.Height}
+	}
+
+	ids, err := messageEventAttributesCopy.run(dbTransaction, conn, rows)
+	if err != nil {
+		return err
+	}
+
+	for _, attribute := range attributes {
+		attribute.ID = ids[copyKey{parentID: attribute.MessageEventID, index: attribute.Index}]
+	}
+	return nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -1,31 +1,71 @@
 package db
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/DefiantLabs/cosmos-indexer/config"
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
 	"github.com/DefiantLabs/cosmos-indexer/parsers"
-	"gorm.io/driver/postgres"
+	"github.com/DefiantLabs/cosmos-indexer/util"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
-	"gorm.io/gorm/logger"
 )
 
 // PostgresDbConnect connects to the database according to the passed in parameters
 func PostgresDbConnect(host string, port string, database string, user string, password string, level string) (*gorm.DB, error) {
-	dsn := fmt.Sprintf("host=%s port=%s dbname=%s user=%s password=%s sslmode=disable", host, port, database, user, password)
-	gormLogLevel := logger.Silent
+	return PostgresDbConnectWithOptions(host, port, database, user, password, level, ConnectOptions{})
+}
 
-	if level == "info" {
-		gormLogLevel = logger.Info
+// MigrateModels applies the pending schema migrations in order, see ApplyMigrations, then creates the missing secondary
+// indexes, see CreateSecondaryIndexes. It does nothing if the database is up to date and refuses to run if the database
+// schema is newer than this binary.
+func MigrateModels(db *gorm.DB) error {
+	if err := VerifySchema(db); err != nil {
+		return err
 	}
-	return gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(gormLogLevel)})
+
+	if err := verifyPartitioning(db); err != nil {
+		return err
+	}
+
+	if err := ApplyMigrations(db); err != nil {
+		return err
+	}
+
+	return CreateSecondaryIndexes(db)
 }
 
-// MigrateModels runs the gorm automigrations with all the db models. This will migrate as needed and do nothing if nothing has changed.
-func MigrateModels(db *gorm.DB) error {
+// AutoMigrateModels runs the gorm automigrations with all the db models, the schema management used before versioned
+// migrations. It is kept for existing deployments through database.legacy-auto-migrate and does not record or check
+// schema versions.
+func AutoMigrateModels(db *gorm.DB) error {
+	if err := VerifySchema(db); err != nil {
+		return err
+	}
+
+	if err := verifyPartitioning(db); err != nil {
+		return err
+	}
+
+	if err := autoMigrateModels(db); err != nil {
+		return err
+	}
+
+	return CreateSecondaryIndexes(db)
+}
+
+func autoMigrateModels(db *gorm.DB) error {
+	if err := createPartitionedTables(db); err != nil {
+		return err
+	}
+
 	if err := migrateChainModels(db); err != nil {
 		return err
 	}
@@ -46,12 +86,33 @@ func MigrateModels(db *gorm.DB) error {
 		return err
 	}
 
+	if err := migrateWatchlistModels(db); err != nil {
+		return err
+	}
+
+	if err := migrateUpgradeModels(db); err != nil {
+		return err
+	}
+
+	if err := migrateIBCModels(db); err != nil {
+		return err
+	}
+
+	if err := migrateBackfillModels(db); err != nil {
+		return err
+	}
+
+	if err := migrateQuarantineModels(db); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 func migrateChainModels(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&models.Chain{},
+		&models.ChainCutover{},
 	)
 }
 
@@ -64,6 +125,10 @@ func migrateBlockModels(db *gorm.DB) error {
 		&models.BlockEventAttributeKey{},
 		&models.FailedBlock{},
 		&models.FailedEventBlock{},
+		&models.Validator{},
+		&models.BlockSignature{},
+		&models.UnavailableBlockRange{},
+		&models.IndexerCheckpoint{},
 	)
 }
 
@@ -89,6 +154,39 @@ func migrateTXModels(db *gorm.DB) error {
 	)
 }
 
+func migrateWatchlistModels(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.WatchedAddress{},
+		&models.WatchedAddressActivity{},
+	)
+}
+
+func migrateUpgradeModels(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.Upgrade{},
+	)
+}
+
+func migrateIBCModels(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.IBCDenom{},
+		&models.IBCTransfer{},
+	)
+}
+
+func migrateBackfillModels(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.BackfillJob{},
+	)
+}
+
+func migrateQuarantineModels(db *gorm.DB) error {
+	return db.AutoMigrate(
+		&models.QuarantinedAttribute{},
+		&models.AttributeQuarantineCount{},
+	)
+}
+
 func migrateParserModels(db *gorm.DB) error {
 	return db.AutoMigrate(
 		&models.BlockEventParser{},
@@ -102,41 +200,198 @@ func MigrateInterfaces(db *gorm.DB, interfaces []any) error {
 	return db.AutoMigrate(interfaces...)
 }
 
-func GetDBChainID(db *gorm.DB, chain models.Chain) (uint, error) {
-	if err := db.Where("chain_id = ?", chain.ChainID).FirstOrCreate(&chain).Error; err != nil {
+// GetDBChainID returns the ID of the chain row, see GetOrCreateChain
+func GetDBChainID(ctx context.Context, db *gorm.DB, chain models.Chain) (uint, error) {
+	chain, err := GetOrCreateChain(ctx, db, chain)
+	return chain.ID, err
+}
+
+// GetOrCreateChain returns the row of the chain with the chain ID of chain, creating it from chain when it does not exist.
+// The bech32 prefix, base denom and network of an existing row are updated to the ones of chain when they are set, so
+// they follow the config. The name of an existing row is kept.
+// The row is cached on the connection, see GetDBChainIDCached.
+func GetOrCreateChain(ctx context.Context, db *gorm.DB, chain models.Chain) (models.Chain, error) {
+	db = db.WithContext(ctx)
+	// Empty fields of a struct are not assigned
+	metadata := models.Chain{Bech32Prefix: chain.Bech32Prefix, BaseDenom: chain.BaseDenom, Network: chain.Network}
+	var row models.Chain
+	if err := db.Where("chain_id = ?", chain.ChainID).Attrs(models.Chain{ChainID: chain.ChainID, Name: chain.Name}).Assign(metadata).FirstOrCreate(&row).Error; err != nil {
 		config.Log.Error("Error getting/creating chain DB object.", err)
-		return chain.ID, err
+		return models.Chain{}, err
 	}
-	return chain.ID, nil
+	chainRegistryOf(db).store(row)
+	return row, nil
 }
 
-func GetHighestIndexedBlock(db *gorm.DB, chainID uint) models.Block {
-	var block models.Block
+// getChainBech32Prefix returns the bech32 prefix of the addresses of the chain, empty when the chain row has none
+func getChainBech32Prefix(db *gorm.DB, chainID uint) (string, error) {
+	if cached, ok := chainRegistryOf(db).byIDOf(chainID); ok {
+		return cached.Bech32Prefix, nil
+	}
+
+	var chain models.Chain
+	if err := db.Where("id = ?", chainID).Limit(1).Find(&chain).Error; err != nil {
+		config.Log.Error("Error getting chain DB object.", err)
+		return "", err
+	}
+	chainRegistryOf(db).store(chain)
+	return chain.Bech32Prefix, nil
+}
+
+// GetHighestIndexedBlock returns the highest block of the chain with its transactions indexed. found is false when the
+// chain has none yet. Query errors are returned, so a lost connection is not mistaken for a chain with no blocks.
+func GetHighestIndexedBlock(ctx context.Context, db *gorm.DB, chainID uint) (block models.Block, found bool, err error) {
+	db = db.WithContext(ctx)
 	// this can potentially be optimized by getting max first and selecting it (this gets translated into a select * limit 1)
-	db.Table("blocks").Where("chain_id = ?::int AND tx_indexed = true AND time_stamp != '0001-01-01T00:00:00.000Z'", chainID).Order("height desc").First(&block)
-	return block
+	err = db.Table("blocks").Where("chain_id = ? AND tx_indexed = true AND time_stamp != ?", chainID, time.Time{}).Order("height desc").First(&block).Error
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return block, false, nil
+	}
+
+	return block, err == nil, err
 }
 
-func GetBlocksFromStart(db *gorm.DB, chainID uint, startHeight int64, endHeight int64) ([]models.Block, error) {
-	var blocks []models.Block
+// DefaultBlocksPageSize is the number of blocks returned by GetBlocksInRange and GetBlocksFromStart
+const DefaultBlocksPageSize = 10000
+
+// BlocksPage is a page of blocks in height order. Next is the rest of the height range, the cursor of the next page.
+type BlocksPage struct {
+	Blocks  []models.Block
+	Next    HeightRange
+	HasMore bool
+}
+
+// GetBlocksPage returns up to limit blocks with a timestamp indexed for the chain within the height range, in height order.
+// Pages are keyed on height, pass Next as the range of the following call to iterate while HasMore is set.
+func GetBlocksPage(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange, limit int) (BlocksPage, error) {
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return BlocksPage{}, err
+	}
+	if limit <= 0 {
+		return BlocksPage{}, errors.New("page limit must be greater than 0")
+	}
+
+	return getBlocksPage(readDB(ctx, db), chain.ID, heights, limit)
+}
 
-	initialWhere := db.Where("chain_id = ?::int AND time_stamp != '0001-01-01T00:00:00.000Z' AND height >= ?", chainID, startHeight)
+// StreamBlocksInRange calls fn with the blocks with a timestamp indexed for the chain within the height range, in height
+// order and in batches of up to batchSize, without loading the whole range. An error from fn stops the iteration and is
+// returned.
+func StreamBlocksInRange(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange, batchSize int, fn func([]models.Block) error) error {
+	for {
+		page, err := GetBlocksPage(ctx, db, chain, heights, batchSize)
+		if err != nil {
+			return err
+		}
 
-	if endHeight != -1 {
-		initialWhere = initialWhere.Where("height <= ?", endHeight)
+		if len(page.Blocks) != 0 {
+			if err := fn(page.Blocks); err != nil {
+				return err
+			}
+		}
+
+		if !page.HasMore {
+			return nil
+		}
+		heights = page.Next
 	}
+}
 
-	if err := initialWhere.Find(&blocks).Error; err != nil {
+// GetBlocksByTimeRange returns the blocks of the chain with a timestamp at or after from and before to, in height order
+func GetBlocksByTimeRange(ctx context.Context, db *gorm.DB, chain ChainRef, from time.Time, to time.Time, page Pagination) ([]models.Block, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+	if !to.After(from) {
+		return nil, errors.New("time range must end after it starts")
+	}
+	if err := page.validate(); err != nil {
+		return nil, err
+	}
+
+	var blocks []models.Block
+	query := db.Where("chain_id = ? AND time_stamp != ? AND time_stamp >= ? AND time_stamp < ?", chain.ID, time.Time{}, from, to).Order("height")
+	if err := page.apply(query).Find(&blocks).Error; err != nil {
 		return nil, err
 	}
 
 	return blocks, nil
 }
 
-func GetHighestEventIndexedBlock(db *gorm.DB, chainID uint) (models.Block, error) {
+// GetHeightForTime returns the height of the first block of the chain with a timestamp at or after t. Returns
+// gorm.ErrRecordNotFound if no block is indexed at or after t.
+func GetHeightForTime(ctx context.Context, db *gorm.DB, chain ChainRef, t time.Time) (int64, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return 0, err
+	}
+
+	var block models.Block
+	err := db.Where("chain_id = ? AND time_stamp != ? AND time_stamp >= ?", chain.ID, time.Time{}, t).Order("time_stamp, height").First(&block).Error
+	return block.Height, err
+}
+
+// GetBlockByHash returns the block of the chain with the hash, with its proposer loaded. The hash is matched
+// case-insensitively. Returns gorm.ErrRecordNotFound if the chain has no block with the hash, blocks indexed before hashes
+// were stored have none.
+func GetBlockByHash(ctx context.Context, db *gorm.DB, chain ChainRef, hash string) (models.Block, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return models.Block{}, err
+	}
+
+	// Hashes are indexed as upper case hex
+	hash = strings.ToUpper(strings.TrimSpace(hash))
+	if hash == "" {
+		return models.Block{}, errors.New("block hash is required")
+	}
+
+	var block models.Block
+	err := db.Where("chain_id = ? AND block_hash = ?", chain.ID, hash).Preload("ProposerConsAddress").First(&block).Error
+	return block, err
+}
+
+// GetBlocksInRange returns the first DefaultBlocksPageSize blocks with a timestamp indexed for the chain within the height
+// range, in height order. Use GetBlocksPage or StreamBlocksInRange for larger ranges.
+func GetBlocksInRange(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]models.Block, error) {
+	page, err := GetBlocksPage(ctx, db, chain, heights, DefaultBlocksPageSize)
+	return page.Blocks, err
+}
+
+// GetBlocksFromStart returns the first DefaultBlocksPageSize blocks with a timestamp indexed for the chain between
+// startHeight and endHeight (-1 for no upper bound), in height order
+//
+// Deprecated: use GetBlocksInRange, which validates the chain and height range.
+func GetBlocksFromStart(ctx context.Context, db *gorm.DB, chainID uint, startHeight int64, endHeight int64) ([]models.Block, error) {
+	page, err := getBlocksPage(readDB(ctx, db), chainID, HeightRange{Start: startHeight, End: endHeight}, DefaultBlocksPageSize)
+	return page.Blocks, err
+}
+
+func getBlocksPage(db *gorm.DB, chainID uint, heights HeightRange, limit int) (BlocksPage, error) {
+	page := BlocksPage{}
+
+	// One more than the limit is loaded to tell whether there is a next page
+	query := heights.where(db.Where("chain_id = ? AND time_stamp != ?", chainID, time.Time{}), "height")
+	if err := query.Order("height ASC").Limit(limit + 1).Find(&page.Blocks).Error; err != nil {
+		return BlocksPage{}, err
+	}
+
+	if len(page.Blocks) > limit {
+		page.Blocks = page.Blocks[:limit]
+		page.HasMore = true
+		page.Next = HeightRange{Start: page.Blocks[limit-1].Height + 1, End: heights.End}
+	}
+
+	return page, nil
+}
+
+func GetHighestEventIndexedBlock(ctx context.Context, db *gorm.DB, chainID uint) (models.Block, error) {
+	db = db.WithContext(ctx)
 	var block models.Block
 	// this can potentially be optimized by getting max first and selecting it (this gets translated into a select * limit 1)
-	err := db.Table("blocks").Where("chain_id = ?::int AND block_events_indexed = true AND time_stamp != '0001-01-01T00:00:00.000Z'", chainID).Order("height desc").First(&block).Error
+	err := db.Table("blocks").Where("chain_id = ? AND block_events_indexed = true AND time_stamp != ?", chainID, time.Time{}).Order("height desc").First(&block).Error
 
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return block, nil
@@ -145,266 +400,839 @@ func GetHighestEventIndexedBlock(db *gorm.DB, chainID uint) (models.Block, error
 	return block, err
 }
 
-func UpsertFailedBlock(db *gorm.DB, blockHeight int64, chainID string, chainName string) error {
-	return db.Transaction(func(dbTransaction *gorm.DB) error {
-		failedBlock := models.FailedBlock{Height: blockHeight, Chain: models.Chain{ChainID: chainID, Name: chainName}}
+// GetFailedBlocks returns the blocks of the chain within the height range that failed to index, in height order, with
+// their Chain loaded
+func GetFailedBlocks(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]models.FailedBlock, error) {
+	db = db.WithContext(ctx)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
 
-		if err := dbTransaction.Where(&failedBlock.Chain).FirstOrCreate(&failedBlock.Chain).Error; err != nil {
-			config.Log.Error("Error creating chain DB object.", err)
-			return err
+	var failedBlocks []models.FailedBlock
+	query := heights.where(db.Preload("Chain").Where("blockchain_id = ?", chain.ID), "height")
+	if err := query.Order("height ASC").Find(&failedBlocks).Error; err != nil {
+		return nil, err
+	}
+
+	return failedBlocks, nil
+}
+
+// CountFailedBlocks returns the number of failures recorded for the chain and not resolved yet, the failed blocks of its
+// transactions and of its block events
+func CountFailedBlocks(ctx context.Context, db *gorm.DB, chain ChainRef) (int64, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, table := range []string{"failed_blocks", "failed_event_blocks"} {
+		var count int64
+		if err := db.Table(table).Where("blockchain_id = ?", chain.ID).Count(&count).Error; err != nil {
+			return 0, err
 		}
+		total += count
+	}
+	return total, nil
+}
 
-		if err := dbTransaction.Where(&failedBlock).FirstOrCreate(&failedBlock).Error; err != nil {
+// GetFailedHeightsSince returns the heights of the chain within the height range that failed to index, for their
+// transactions or block events, at or after since, in order
+func GetFailedHeightsSince(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange, since time.Time) ([]int64, error) {
+	db = db.WithContext(ctx)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	failed := make(map[int64]struct{})
+	for _, table := range failureTables {
+		var failedHeights []int64
+		err := heights.where(db.Table(table).Where("blockchain_id = ? AND last_failed_at >= ?", chain.ID, since), "height").
+			Pluck("height", &failedHeights).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for _, height := range failedHeights {
+			failed[height] = struct{}{}
+		}
+	}
+
+	failedHeights := make([]int64, 0, len(failed))
+	for height := range failed {
+		failedHeights = append(failedHeights, height)
+	}
+	sort.Slice(failedHeights, func(i, j int) bool { return failedHeights[i] < failedHeights[j] })
+	return failedHeights, nil
+}
+
+// UpsertFailedBlock records that the transactions of the block at blockHeight failed to index with failure at the stage.
+// A block that failed before keeps its first failure time, the latest error, stage and time are recorded and its attempts
+// are counted. ErrorStage returns the stage of the errors returned by IndexNewBlock.
+func UpsertFailedBlock(ctx context.Context, db *gorm.DB, blockHeight int64, chainID string, chainName string, stage IndexStage, failure error) error {
+	db = db.WithContext(ctx)
+	// Outside the transaction, a rolled back chain row would otherwise stay cached
+	dbChainID, err := GetDBChainIDCached(ctx, db, models.Chain{ChainID: chainID, Name: chainName})
+	if err != nil {
+		return err
+	}
+
+	err = db.Transaction(func(dbTransaction *gorm.DB) error {
+		now := time.Now()
+		failedBlock := models.FailedBlock{Height: blockHeight, BlockchainID: dbChainID, Error: failureMessage(failure), Stage: string(stage), FirstFailedAt: &now, LastFailedAt: &now, AttemptCount: 1}
+		if err := dbTransaction.Clauses(failureUpsert("failed_blocks")).Create(&failedBlock).Error; err != nil {
 			config.Log.Error("Error creating failed block DB object.", err)
 			return err
 		}
 		return nil
 	})
-}
+	if err != nil {
+		return err
+	}
 
-func UpsertFailedEventBlock(db *gorm.DB, blockHeight int64, chainID string, chainName string) error {
-	return db.Transaction(func(dbTransaction *gorm.DB) error {
-		failedEventBlock := models.FailedEventBlock{Height: blockHeight, Chain: models.Chain{ChainID: chainID, Name: chainName}}
+	observeFailedBlock(db, chainID, metrics.DatasetTxs, stage)
+	return nil
+}
 
-		if err := dbTransaction.Where(&failedEventBlock.Chain).FirstOrCreate(&failedEventBlock.Chain).Error; err != nil {
-			config.Log.Error("Error creating chain DB object.", err)
-			return err
-		}
+// UpsertFailedEventBlock records that the events of the block at blockHeight failed to index with failure at the stage,
+// like UpsertFailedBlock
+func UpsertFailedEventBlock(ctx context.Context, db *gorm.DB, blockHeight int64, chainID string, chainName string, stage IndexStage, failure error) error {
+	db = db.WithContext(ctx)
+	// Outside the transaction, a rolled back chain row would otherwise stay cached
+	dbChainID, err := GetDBChainIDCached(ctx, db, models.Chain{ChainID: chainID, Name: chainName})
+	if err != nil {
+		return err
+	}
 
-		if err := dbTransaction.Where(&failedEventBlock).FirstOrCreate(&failedEventBlock).Error; err != nil {
+	err = db.Transaction(func(dbTransaction *gorm.DB) error {
+		now := time.Now()
+		failedEventBlock := models.FailedEventBlock{Height: blockHeight, BlockchainID: dbChainID, Error: failureMessage(failure), Stage: string(stage), FirstFailedAt: &now, LastFailedAt: &now, AttemptCount: 1}
+		if err := dbTransaction.Clauses(failureUpsert("failed_event_blocks")).Create(&failedEventBlock).Error; err != nil {
 			config.Log.Error("Error creating failed event block DB object.", err)
 			return err
 		}
 		return nil
 	})
+	if err != nil {
+		return err
+	}
+
+	observeFailedBlock(db, chainID, metrics.DatasetBlockEvents, stage)
+	return nil
 }
 
-func IndexNewBlock(db *gorm.DB, block models.Block, txs []TxDBWrapper, indexerConfig config.IndexConfig) (models.Block, []TxDBWrapper, error) {
-	// consider optimizing the transaction, but how? Ordering matters due to foreign key constraints
-	// Order required: Block -> (For each Tx: Signer Address -> Tx -> (For each Message: Message -> Taxable Events))
-	// Also, foreign key relations are struct value based so create needs to be called first to get right foreign key ID
-	err := db.Transaction(func(dbTransaction *gorm.DB) error {
-		// remove from failed blocks if exists
-		if err := dbTransaction.
-			Exec("DELETE FROM failed_blocks WHERE height = ? AND blockchain_id = ?", block.Height, block.ChainID).
-			Error; err != nil {
-			config.Log.Error("Error updating failed block.", err)
-			return err
+// failureUpsert is the conflict clause of recording a failure of a block that already failed on the failure table
+func failureUpsert(table string) clause.OnConflict {
+	return clause.OnConflict{
+		Columns: []clause.Column{{Name: "height"}, {Name: "blockchain_id"}},
+		DoUpdates: append(clause.AssignmentColumns([]string{"error", "stage", "last_failed_at"}), clause.Assignment{
+			Column: clause.Column{Name: "attempt_count"},
+			Value:  gorm.Expr(table + ".attempt_count + 1"),
+		}),
+	}
+}
+
+func failureMessage(failure error) string {
+	if failure == nil {
+		return ""
+	}
+	return failure.Error()
+}
+
+// DeleteFailedEventBlock removes the block of the chain at height from failed_event_blocks, once its events are indexed
+func DeleteFailedEventBlock(ctx context.Context, db *gorm.DB, blockHeight int64, chainID uint) error {
+	db = db.WithContext(ctx)
+	return db.Exec("DELETE FROM failed_event_blocks WHERE height = ? AND blockchain_id = ?", blockHeight, chainID).Error
+}
+
+// DeleteIndexedFailedEventBlocks removes the failed_event_blocks rows whose block has since had its events indexed. They
+// were left behind by versions that did not remove a failed event block once it was indexed. Returns the number of rows
+// removed.
+func DeleteIndexedFailedEventBlocks(ctx context.Context, db *gorm.DB) (int64, error) {
+	db = db.WithContext(ctx)
+	result := db.Exec(`DELETE FROM failed_event_blocks WHERE EXISTS (
+		SELECT 1 FROM blocks
+		WHERE blocks.chain_id = failed_event_blocks.blockchain_id
+			AND blocks.height = failed_event_blocks.height
+			AND blocks.block_events_indexed = true
+	)`)
+	return result.RowsAffected, result.Error
+}
+
+// ErrNotQuarantined is returned by UnquarantineFailedBlock for a height without a quarantined failure
+var ErrNotQuarantined = errors.New("height has no quarantined failure")
+
+// failureTables are the tables recording the blocks that failed to index, for transactions and for block events
+var failureTables = []string{"failed_blocks", "failed_event_blocks"}
+
+// QuarantineFailedBlocks quarantines the failures of the chain that failed at least maxAttempts times, so they are no
+// longer reattempted. Returns the number of failures quarantined.
+func QuarantineFailedBlocks(ctx context.Context, db *gorm.DB, chain ChainRef, maxAttempts int64) (int64, error) {
+	db = db.WithContext(ctx)
+	if err := chain.Validate(); err != nil {
+		return 0, err
+	}
+	if maxAttempts <= 0 {
+		return 0, errors.New("max attempts must be greater than 0")
+	}
+
+	var quarantined int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range failureTables {
+			result := tx.Table(table).Where("blockchain_id = ? AND attempt_count >= ? AND NOT quarantined", chain.ID, maxAttempts).
+				Update("quarantined", true)
+			if result.Error != nil {
+				return result.Error
+			}
+			quarantined += result.RowsAffected
 		}
+		return nil
+	})
+	return quarantined, err
+}
 
-		consAddress, err := FindOrCreateAddressByAddress(dbTransaction, block.ProposerConsAddress.Address)
-		// create cons address if it doesn't exist
+// QuarantinedFailures are the heights with a quarantined failure, by the part of the block that failed
+type QuarantinedFailures struct {
+	Transactions map[int64]struct{}
+	BlockEvents  map[int64]struct{}
+}
+
+// GetQuarantinedFailures returns the heights of the chain within the height range with a quarantined failure
+func GetQuarantinedFailures(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) (QuarantinedFailures, error) {
+	db = db.WithContext(ctx)
+	quarantined := QuarantinedFailures{Transactions: make(map[int64]struct{}), BlockEvents: make(map[int64]struct{})}
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return quarantined, err
+	}
+
+	for i, failures := range []map[int64]struct{}{quarantined.Transactions, quarantined.BlockEvents} {
+		var failedHeights []int64
+		err := heights.where(db.Table(failureTables[i]).Where("blockchain_id = ? AND quarantined", chain.ID), "height").
+			Pluck("height", &failedHeights).Error
 		if err != nil {
-			config.Log.Error("Error getting/creating cons address DB object.", err)
-			return err
+			return quarantined, err
 		}
 
-		// create block if it doesn't exist
-		block.ProposerConsAddressID = consAddress.ID
-		block.ProposerConsAddress = consAddress
-		block.TxIndexed = true
-		if err := dbTransaction.
-			Where(models.Block{Height: block.Height, ChainID: block.ChainID}).
-			Assign(models.Block{TxIndexed: true, TimeStamp: block.TimeStamp}).
-			FirstOrCreate(&block).Error; err != nil {
-			config.Log.Error("Error getting/creating block DB object.", err)
-			return err
+		for _, height := range failedHeights {
+			failures[height] = struct{}{}
 		}
+	}
 
-		// pull txes and insert them
-		uniqueTxes := make(map[string]models.Tx)
-		uniqueAddress := make(map[string]models.Address)
+	return quarantined, nil
+}
 
-		denomMap := make(map[string]models.Denom)
+// UnquarantineFailedBlock releases the quarantined failures of the chain at height, once the cause of the failure is
+// fixed. Their attempt counts are reset, so they are reattempted and quarantined again only after as many failures.
+// Returns ErrNotQuarantined if the height has no quarantined failure.
+func UnquarantineFailedBlock(ctx context.Context, db *gorm.DB, chain ChainRef, height int64) error {
+	db = db.WithContext(ctx)
+	if err := chain.Validate(); err != nil {
+		return err
+	}
 
-		for _, tx := range txs {
-			tx.Tx.BlockID = block.ID
-			tx.Tx.Block = block
-			uniqueTxes[tx.Tx.Hash] = tx.Tx
-			if len(tx.Tx.SignerAddresses) != 0 {
-				for _, signerAddress := range tx.Tx.SignerAddresses {
-					uniqueAddress[signerAddress.Address] = signerAddress
-				}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var released int64
+		for _, table := range failureTables {
+			result := tx.Table(table).Where("blockchain_id = ? AND height = ? AND quarantined", chain.ID, height).
+				Updates(map[string]any{"quarantined": false, "attempt_count": 0})
+			if result.Error != nil {
+				return result.Error
 			}
-			for feeIndex, fee := range tx.Tx.Fees {
-				uniqueAddress[fee.PayerAddress.Address] = fee.PayerAddress
+			released += result.RowsAffected
+		}
+
+		if released == 0 {
+			return fmt.Errorf("%w: %d", ErrNotQuarantined, height)
+		}
+		return nil
+	})
+}
 
-				denom := fee.Denomination
+// RecordUnavailableBlockRange records the heights of the chain as unavailable on its RPC nodes, like the heights below the
+// earliest height of a pruned node, so they are no longer reported as missing. Recording a range again does nothing.
+func RecordUnavailableBlockRange(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange, reason string) error {
+	db = db.WithContext(ctx)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return err
+	}
+	if heights.IsOpen() {
+		return &HeightRangeError{Range: heights, Err: errors.New("unavailable range must have an end")}
+	}
 
-				if _, ok := denomMap[denom.Base]; !ok {
-					denom, err = FindOrCreateDenomByBase(dbTransaction, denom.Base)
-					if err != nil {
-						config.Log.Error("Error getting/creating denom DB object.", err)
-						return err
-					}
-					denomMap[denom.Base] = denom
-				} else {
-					denom = denomMap[denom.Base]
-				}
+	unavailable := models.UnavailableBlockRange{ChainID: chain.ID, StartHeight: heights.Start, EndHeight: heights.End, Reason: reason}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&unavailable).Error
+}
+
+// GetUnavailableFloor returns the lowest height of the chain above its recorded unavailable ranges, 1 when it has none.
+// Heights below the floor can never be fetched from the RPC nodes of the chain.
+func GetUnavailableFloor(ctx context.Context, db *gorm.DB, chain ChainRef) (int64, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return 0, err
+	}
+
+	var highest sql.NullInt64
+	err := db.Model(&models.UnavailableBlockRange{}).Where("chain_id = ?", chain.ID).Select("MAX(end_height)").Scan(&highest).Error
+	if err != nil || !highest.Valid {
+		return 1, err
+	}
+	return highest.Int64 + 1, nil
+}
 
-				tx.Tx.Fees[feeIndex].DenominationID = denom.ID
-				tx.Tx.Fees[feeIndex].Denomination = denom
+func IndexNewBlock(ctx context.Context, db *gorm.DB, block models.Block, txs []TxDBWrapper, indexerConfig config.IndexConfig) (models.Block, []TxDBWrapper, error) {
+	blocks := []BlockTxsDBWrapper{{Block: block, Txs: txs}}
+	err := indexNewBlocks(ctx, db, blocks, indexerConfig)
+
+	// Contract: ensure that block and txs have been loaded with the indexed data before returning
+	return blocks[0].Block, blocks[0].Txs, err
+}
+
+// IndexNewBlocks indexes the blocks with their txs in one transaction, like IndexNewBlock does for a single block. The
+// addresses, denominations, message types, event types and attribute keys of the whole batch are upserted once, and the
+// txs, messages, events and attributes of every block are inserted in batched statements, which saves the per block
+// transaction overhead while backfilling. An error rolls back every block of the batch.
+// The wrappers are loaded with the indexed data like IndexNewBlock does, and are not fit for indexing again after an
+// error, index copies of them when falling back to IndexNewBlock.
+func IndexNewBlocks(ctx context.Context, db *gorm.DB, blocks []BlockTxsDBWrapper, indexerConfig config.IndexConfig) ([]BlockTxsDBWrapper, error) {
+	err := indexNewBlocks(ctx, db, blocks, indexerConfig)
+	return blocks, err
+}
+
+// defaultInsertBatchSize is the number of rows per INSERT of the bulk inserts on connections opened without
+// database.insert-batch-size, see insertBatchSize
+const defaultInsertBatchSize = 1000
+
+// insertBatchSize returns the number of rows per INSERT of the bulk inserts on the connection. Splitting the rows of a
+// large block keeps every statement under the 65535 bind parameters PostgreSQL allows, and SQLite under its own limit.
+func insertBatchSize(db *gorm.DB) int {
+	if db.CreateBatchSize > 0 {
+		return db.CreateBatchSize
+	}
+	return defaultInsertBatchSize
+}
+
+func indexNewBlocks(ctx context.Context, db *gorm.DB, blocks []BlockTxsDBWrapper, indexerConfig config.IndexConfig) error {
+	start := time.Now()
+	db = db.WithContext(ctx)
+
+	// Stages indexing the whole batch at once fail for all of its blocks
+	blockError := func(i int, stage IndexStage, err error) error {
+		return blockIndexError(stage, blocks[i].Block.ChainID, blocks[i].Block.Height, blocks[i].Block.Height, err)
+	}
+	batchError := func(stage IndexStage, err error) error {
+		return blockIndexError(stage, blocks[0].Block.ChainID, blocks[0].Block.Height, blocks[len(blocks)-1].Block.Height, err)
+	}
+
+	prefix, err := getChainBech32Prefix(db, blocks[0].Block.ChainID)
+	if err != nil {
+		return batchError(StageAddresses, err)
+	}
+
+	for i := range blocks {
+		// Addresses differing only in case or padding would otherwise be stored as separate rows
+		if prefix != "" {
+			if err := normalizeTxAddresses(blocks[i].Txs, prefix); err != nil {
+				return blockError(i, StageAddresses, err)
 			}
 		}
 
-		var addressesSlice []models.Address
-		for _, address := range uniqueAddress {
-			addressesSlice = append(addressesSlice, address)
+		// Outside the transaction, creating a partition locks the partitioned table
+		if err := ensurePartitions(db, blocks[i].Block.Height); err != nil {
+			return blockError(i, StagePartitions, err)
 		}
+	}
 
-		if len(addressesSlice) != 0 {
-			if err := dbTransaction.Clauses(clause.OnConflict{
-				Columns:   []clause.Column{{Name: "address"}},
-				DoUpdates: clause.AssignmentColumns([]string{"address"}),
-			}).Create(addressesSlice).Error; err != nil {
-				config.Log.Error("Error getting/creating addresses.", err)
-				return err
+	var allTxs []TxDBWrapper
+	for _, block := range blocks {
+		allTxs = append(allTxs, block.Txs...)
+	}
+
+	// consider optimizing the transaction, but how? Ordering matters due to foreign key constraints
+	// Order required: Block -> (For each Tx: Signer Address -> Tx -> (For each Message: Message -> Taxable Events))
+	// Also, foreign key relations are struct value based so create needs to be called first to get right foreign key ID
+	txStart := time.Now()
+	// The dictionary IDs resolved in the transaction, cached once it commits
+	var (
+		fullUniqueBlockMessageTypes              map[string]models.MessageType
+		fullUniqueBlockMessageEventTypes         map[string]models.MessageEventType
+		fullUniqueBlockMessageEventAttributeKeys map[string]models.MessageEventAttributeKey
+	)
+	err = indexTransaction(db, func(dbTransaction *gorm.DB, conn *sql.Conn) error {
+		blockTxes := make([]map[string]models.Tx, len(blocks))
+		for i := range blocks {
+			uniqueTxes, err := indexBlockRow(ctx, dbTransaction, &blocks[i].Block, blocks[i].Txs, indexerConfig)
+			if err != nil {
+				return blockError(i, StageBlock, err)
 			}
+			blockTxes[i] = uniqueTxes
 		}
 
-		for _, address := range addressesSlice {
-			uniqueAddress[address.Address] = address
+		uniqueAddress, err := indexSignerAddresses(dbTransaction, allTxs)
+		if err != nil {
+			return batchError(StageAddresses, err)
 		}
 
-		var txesSlice []models.Tx
-		for _, tx := range uniqueTxes {
-
-			var signerAddressID uint
+		denomMap, err := indexFeeDenominations(dbTransaction, allTxs)
+		if err != nil {
+			return batchError(StageDenominations, err)
+		}
 
-			if len(tx.SignerAddresses) != 0 {
-				for addressIndex := range tx.SignerAddresses {
-					signerAddressID = uniqueAddress[tx.SignerAddresses[addressIndex].Address].ID
-					tx.SignerAddresses[addressIndex] = uniqueAddress[tx.SignerAddresses[addressIndex].Address]
-					tx.SignerAddresses[addressIndex].ID = signerAddressID
+		var txesSlice []models.Tx
+		var txesBlockIndexes []int
+		for i := range blocks {
+			for _, tx := range blockTxes[i] {
+				tx.BlockID = blocks[i].Block.ID
+				tx.Block = blocks[i].Block
+
+				var signerAddressID uint
+
+				if len(tx.SignerAddresses) != 0 {
+					for addressIndex := range tx.SignerAddresses {
+						signerAddressID = uniqueAddress[tx.SignerAddresses[addressIndex].Address].ID
+						tx.SignerAddresses[addressIndex] = uniqueAddress[tx.SignerAddresses[addressIndex].Address]
+						tx.SignerAddresses[addressIndex].ID = signerAddressID
+					}
 				}
-			}
 
-			for feeIndex := range tx.Fees {
-				tx.Fees[feeIndex].PayerAddressID = uniqueAddress[tx.Fees[feeIndex].PayerAddress.Address].ID
-				tx.Fees[feeIndex].PayerAddress = uniqueAddress[tx.Fees[feeIndex].PayerAddress.Address]
+				for feeIndex := range tx.Fees {
+					tx.Fees[feeIndex].PayerAddressID = uniqueAddress[tx.Fees[feeIndex].PayerAddress.Address].ID
+					tx.Fees[feeIndex].PayerAddress = uniqueAddress[tx.Fees[feeIndex].PayerAddress.Address]
+					tx.Fees[feeIndex].DenominationID = denomMap[tx.Fees[feeIndex].Denomination.Base].ID
+					tx.Fees[feeIndex].Denomination = denomMap[tx.Fees[feeIndex].Denomination.Base]
+					if granter := tx.Fees[feeIndex].GranterAddress; granter != nil {
+						granterAddress := uniqueAddress[granter.Address]
+						tx.Fees[feeIndex].GranterAddressID = &granterAddress.ID
+						tx.Fees[feeIndex].GranterAddress = &granterAddress
+					}
+				}
+				txesSlice = append(txesSlice, tx)
+				txesBlockIndexes = append(txesBlockIndexes, i)
 			}
-			txesSlice = append(txesSlice, tx)
 		}
 
 		if len(txesSlice) != 0 {
+			// Fees are inserted by indexFees once the txs have their IDs
 			if err := dbTransaction.Clauses(clause.OnConflict{
 				Columns:   []clause.Column{{Name: "hash"}},
-				DoUpdates: clause.AssignmentColumns([]string{"code", "block_id"}),
-			}).Create(txesSlice).Error; err != nil {
+				DoUpdates: clause.AssignmentColumns([]string{"code", "block_id", "gas_wanted", "gas_used", "memo", "error_message"}),
+			}).Omit("Fees").CreateInBatches(txesSlice, insertBatchSize(dbTransaction)).Error; err != nil {
 				config.Log.Error("Error getting/creating txes.", err)
-				return err
+				return batchError(StageTxs, err)
+			}
+
+			if err := indexFees(dbTransaction, txesSlice); err != nil {
+				return batchError(StageFees, err)
 			}
 		}
 
-		for _, tx := range txesSlice {
-			uniqueTxes[tx.Hash] = tx
+		for txIndex, tx := range txesSlice {
+			blockTxes[txesBlockIndexes[txIndex]][tx.Hash] = tx
+		}
+
+		if err := indexTxFailures(dbTransaction, blocks, blockTxes); err != nil {
+			return batchError(StageTxFailures, err)
 		}
 
 		// Create unique message types and post-process them into the messages
-		fullUniqueBlockMessageTypes, err := indexMessageTypes(dbTransaction, txs)
+		fullUniqueBlockMessageTypes, err = indexMessageTypes(dbTransaction, allTxs)
 		if err != nil {
-			return err
+			return batchError(StageMessageTypes, err)
 		}
 
-		fullUniqueBlockMessageEventTypes, err := indexMessageEventTypes(dbTransaction, txs)
+		fullUniqueBlockMessageEventTypes, err = indexMessageEventTypes(dbTransaction, allTxs)
 		if err != nil {
-			return err
+			return batchError(StageEventTypes, err)
 		}
 
-		fullUniqueBlockMessageEventAttributeKeys, err := indexMessageEventAttributeKeys(dbTransaction, txs)
+		fullUniqueBlockMessageEventAttributeKeys, err = indexMessageEventAttributeKeys(dbTransaction, allTxs)
 		if err != nil {
-			return err
+			return batchError(StageAttributeKeys, err)
 		}
 
 		// This complex set of loops is to ensure that foreign key relations are created and attached to downstream models before batch insertion is executed.
 		// We are trading off in-app performance for batch insertion here and should consider complexity increase vs performance increase.
-		for txIndex, tx := range txs {
-			tx.Tx = uniqueTxes[tx.Tx.Hash]
-			txs[txIndex].Tx = tx.Tx
-			var messagesSlice []*models.Message
-			for messageIndex := range tx.Messages {
-				tx.Messages[messageIndex].Message.TxID = tx.Tx.ID
-				tx.Messages[messageIndex].Message.Tx = tx.Tx
-				tx.Messages[messageIndex].Message.MessageTypeID = fullUniqueBlockMessageTypes[tx.Messages[messageIndex].Message.MessageType.MessageType].ID
-
-				tx.Messages[messageIndex].Message.MessageType = fullUniqueBlockMessageTypes[tx.Messages[messageIndex].Message.MessageType.MessageType]
-				for eventIndex := range tx.Messages[messageIndex].MessageEvents {
-					tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventTypeID = fullUniqueBlockMessageEventTypes[tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventType.Type].ID
-					tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventType = fullUniqueBlockMessageEventTypes[tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventType.Type]
-
-					for attributeIndex := range tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes {
-						tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKeyID = fullUniqueBlockMessageEventAttributeKeys[tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKey.Key].ID
-						tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKey = fullUniqueBlockMessageEventAttributeKeys[tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKey.Key]
-					}
+		var messagesSlice []*models.Message
+		for i := range blocks {
+			height := blocks[i].Block.Height
+			txs := blocks[i].Txs
+			for txIndex, tx := range txs {
+				// Returning the error rolls back the whole batch when the context is cancelled mid-block
+				if err := ctx.Err(); err != nil {
+					return err
 				}
 
-				if !indexerConfig.Flags.IndexTxMessageRaw {
-					tx.Messages[messageIndex].Message.MessageBytes = nil
-				}
+				tx.Tx = blockTxes[i][tx.Tx.Hash]
+				txs[txIndex].Tx = tx.Tx
+				for messageIndex := range tx.Messages {
+					tx.Messages[messageIndex].Message.TxID = tx.Tx.ID
+					tx.Messages[messageIndex].Message.Tx = tx.Tx
+					tx.Messages[messageIndex].Message.Height = height
+					tx.Messages[messageIndex].Message.MessageTypeID = fullUniqueBlockMessageTypes[tx.Messages[messageIndex].Message.MessageType.MessageType].ID
+
+					tx.Messages[messageIndex].Message.MessageType = fullUniqueBlockMessageTypes[tx.Messages[messageIndex].Message.MessageType.MessageType]
+					for eventIndex := range tx.Messages[messageIndex].MessageEvents {
+						tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventTypeID = fullUniqueBlockMessageEventTypes[tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventType.Type].ID
+						tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventType = fullUniqueBlockMessageEventTypes[tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageEventType.Type]
+						tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.Height = height
+
+						for attributeIndex := range tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes {
+							tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKeyID = fullUniqueBlockMessageEventAttributeKeys[tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKey.Key].ID
+							tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKey = fullUniqueBlockMessageEventAttributeKeys[tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventAttributeKey.Key]
+							tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].Height = height
+						}
+					}
 
-				messagesSlice = append(messagesSlice, &tx.Messages[messageIndex].Message)
-			}
+					// Txs involving watched addresses always keep the full message body
+					if !indexerConfig.Flags.IndexTxMessageRaw && len(tx.WatchedAddresses) == 0 {
+						tx.Messages[messageIndex].Message.MessageBytes = nil
+					}
 
-			if len(messagesSlice) != 0 {
-				if err := dbTransaction.Clauses(clause.OnConflict{
-					Columns:   []clause.Column{{Name: "tx_id"}, {Name: "message_index"}},
-					DoUpdates: clause.AssignmentColumns([]string{"message_type_id", "message_bytes"}),
-				}).Create(messagesSlice).Error; err != nil {
-					config.Log.Error("Error getting/creating messages.", err)
-					return err
+					messagesSlice = append(messagesSlice, &tx.Messages[messageIndex].Message)
 				}
 			}
+		}
+
+		if len(messagesSlice) != 0 {
+			if err := dbTransaction.Clauses(clause.OnConflict{
+				Columns:   partitionKeyColumns(dbTransaction, "messages", "tx_id", "message_index"),
+				DoUpdates: clause.AssignmentColumns([]string{"message_type_id", "message_bytes", "value"}),
+			}).CreateInBatches(messagesSlice, insertBatchSize(dbTransaction)).Error; err != nil {
+				config.Log.Error("Error getting/creating messages.", err)
+				return batchError(StageMessages, err)
+			}
+		}
 
-			var messagesEventsSlice []*models.MessageEvent
-			for messageIndex := range tx.Messages {
-				for eventIndex := range tx.Messages[messageIndex].MessageEvents {
-					tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageID = tx.Messages[messageIndex].Message.ID
-					tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.Message = tx.Messages[messageIndex].Message
+		var messagesEventsSlice []*models.MessageEvent
+		for i := range blocks {
+			for _, tx := range blocks[i].Txs {
+				for messageIndex := range tx.Messages {
+					for eventIndex := range tx.Messages[messageIndex].MessageEvents {
+						tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.MessageID = tx.Messages[messageIndex].Message.ID
+						tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.Message = tx.Messages[messageIndex].Message
 
-					messagesEventsSlice = append(messagesEventsSlice, &tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent)
+						messagesEventsSlice = append(messagesEventsSlice, &tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent)
+					}
 				}
 			}
+		}
 
-			if len(messagesEventsSlice) != 0 {
-				if err := dbTransaction.Clauses(clause.OnConflict{
-					Columns:   []clause.Column{{Name: "message_id"}, {Name: "index"}},
-					DoUpdates: clause.AssignmentColumns([]string{"message_event_type_id"}),
-				}).Create(messagesEventsSlice).Error; err != nil {
-					config.Log.Error("Error getting/creating message events.", err)
-					return err
-				}
+		if len(messagesEventsSlice) != 0 && conn != nil {
+			if err := copyMessageEvents(dbTransaction, conn, messagesEventsSlice); err != nil {
+				config.Log.Error("Error copying message events.", err)
+				return batchError(StageEvents, err)
 			}
+		} else if len(messagesEventsSlice) != 0 {
+			if err := dbTransaction.Clauses(clause.OnConflict{
+				Columns:   partitionKeyColumns(dbTransaction, "message_events", "message_id", "index"),
+				DoUpdates: clause.AssignmentColumns([]string{"message_event_type_id"}),
+			}).CreateInBatches(messagesEventsSlice, insertBatchSize(dbTransaction)).Error; err != nil {
+				config.Log.Error("Error getting/creating message events.", err)
+				return batchError(StageEvents, err)
+			}
+		}
 
-			var messagesEventsAttributesSlice []*models.MessageEventAttribute
-			for messageIndex := range tx.Messages {
-				for eventIndex := range tx.Messages[messageIndex].MessageEvents {
-					for attributeIndex := range tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes {
-						tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventID = tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.ID
-						tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEvent = tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent
+		var messagesEventsAttributesSlice []*models.MessageEventAttribute
+		for i := range blocks {
+			for _, tx := range blocks[i].Txs {
+				for messageIndex := range tx.Messages {
+					for eventIndex := range tx.Messages[messageIndex].MessageEvents {
+						for attributeIndex := range tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes {
+							tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEventID = tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent.ID
+							tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex].MessageEvent = tx.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent
 
-						messagesEventsAttributesSlice = append(messagesEventsAttributesSlice, &tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex])
+							messagesEventsAttributesSlice = append(messagesEventsAttributesSlice, &tx.Messages[messageIndex].MessageEvents[eventIndex].Attributes[attributeIndex])
+						}
 					}
 				}
 			}
+		}
 
-			if len(messagesEventsAttributesSlice) != 0 {
-				if err := dbTransaction.Clauses(clause.OnConflict{
-					Columns:   []clause.Column{{Name: "message_event_id"}, {Name: "index"}},
-					DoUpdates: clause.AssignmentColumns([]string{"value", "message_event_attribute_key_id"}),
-				}).Create(messagesEventsAttributesSlice).Error; err != nil {
-					config.Log.Error("Error getting/creating message event attributes.", err)
-					return err
-				}
+		if len(messagesEventsAttributesSlice) != 0 && conn != nil {
+			if err := copyMessageEventAttributes(dbTransaction, conn, messagesEventsAttributesSlice); err != nil {
+				config.Log.Error("Error copying message event attributes.", err)
+				return batchError(StageAttributes, err)
+			}
+		} else if len(messagesEventsAttributesSlice) != 0 {
+			if err := dbTransaction.Clauses(clause.OnConflict{
+				Columns:   partitionKeyColumns(dbTransaction, "message_event_attributes", "message_event_id", "index"),
+				DoUpdates: clause.AssignmentColumns([]string{"value", "value_bytes", "sanitized", "message_event_attribute_key_id"}),
+			}).CreateInBatches(messagesEventsAttributesSlice, insertBatchSize(dbTransaction)).Error; err != nil {
+				config.Log.Error("Error getting/creating message event attributes.", err)
+				return batchError(StageAttributes, err)
 			}
 		}
 
+		for i := range blocks {
+			if err := indexWatchedAddressActivity(dbTransaction, blocks[i].Txs); err != nil {
+				return blockError(i, StageWatchlist, err)
+			}
+		}
+
+		heights := make([]int64, len(blocks))
+		for i := range blocks {
+			heights[i] = blocks[i].Block.Height
+		}
+		sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+		if err := advanceCheckpoints(dbTransaction, blocks[0].Block.ChainID, CheckpointTxs, heights...); err != nil {
+			return batchError(StageBlock, err)
+		}
 		return nil
 	})
+	if err != nil {
+		// A cached ID may be the cause, e.g. of a dictionary row deleted since
+		dictionaryCacheOf(db).reset()
+		return err
+	}
+	dictionaryCacheOf(db).store(fullUniqueBlockMessageTypes, fullUniqueBlockMessageEventTypes, fullUniqueBlockMessageEventAttributeKeys)
 
-	// Contract: ensure that block and txs have been loaded with the indexed data before returning
-	return block, txs, err
+	observeIndexedBlocks(db, blocks, start, txStart)
+	return nil
 }
 
+// indexBlockRow creates or updates the row of the block with its proposer and, when enabled, its signatures, handling a
+// reorg or a conflict with the stored block. Returns the txs of the block by hash, ready to be inserted.
+func indexBlockRow(ctx context.Context, db *gorm.DB, block *models.Block, txs []TxDBWrapper, indexerConfig config.IndexConfig) (map[string]models.Tx, error) {
+	// remove from failed blocks if exists
+	if err := db.
+		Exec("DELETE FROM failed_blocks WHERE height = ? AND blockchain_id = ?", block.Height, block.ChainID).
+		Error; err != nil {
+		config.Log.Error("Error updating failed block.", err)
+		return nil, err
+	}
+
+	consAddress, err := FindOrCreateAddressByAddress(ctx, db, block.ProposerConsAddress.Address)
+	// create cons address if it doesn't exist
+	if err != nil {
+		config.Log.Error("Error getting/creating cons address DB object.", err)
+		return nil, err
+	}
+
+	// the block may already exist, e.g. when block events were indexed first or from a previous partial run
+	var existingBlock models.Block
+	if err := db.
+		Where("height = ? AND chain_id = ?", block.Height, block.ChainID).
+		Limit(1).
+		Find(&existingBlock).Error; err != nil {
+		config.Log.Error("Error getting existing block DB object.", err)
+		return nil, err
+	}
+
+	// a different hash at the same height means the chain reorged since the block was indexed
+	if isReorg(existingBlock, *block) {
+		if err := replaceReorgedBlock(db, existingBlock, *block); err != nil {
+			return nil, err
+		}
+	} else if existingBlock.ID != 0 {
+		if err := checkBlockConsistency(existingBlock, block); err != nil {
+			return nil, err
+		}
+
+		if indexerConfig.Base.ReindexReplace {
+			if err := replaceBlockTxData(db, existingBlock); err != nil {
+				return nil, err
+			}
+		}
+
+		if existingBlock.TxPartiallyIndexed {
+			if err := clearBlockTxFailures(db, existingBlock); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// pull txes, they are inserted once the block exists
+	uniqueTxes := make(map[string]models.Tx)
+
+	for _, tx := range txs {
+		// Memos and raw logs are arbitrary input, PostgreSQL rejects null bytes and invalid UTF-8 in text columns
+		tx.Tx.Memo, _ = util.SanitizeText(tx.Tx.Memo)
+		tx.Tx.ErrorMessage, _ = util.SanitizeText(tx.Tx.ErrorMessage)
+		uniqueTxes[tx.Tx.Hash] = tx.Tx
+	}
+
+	// the proposer and, when enabled, the validators in the last commit
+	consAddresses := []string{consAddress.Address}
+	signatures := block.Signatures
+	if indexerConfig.Flags.IndexBlockSignatures {
+		for _, signature := range signatures {
+			consAddresses = append(consAddresses, signature.Validator.ConsAddress)
+		}
+	}
+	validators, err := indexValidators(db, block.ChainID, consAddresses)
+	if err != nil {
+		return nil, err
+	}
+	proposer := validators[consAddress.Address]
+
+	// create block if it doesn't exist
+	block.ProposerConsAddressID = consAddress.ID
+	block.ProposerConsAddress = consAddress
+	block.ProposerValidatorID = &proposer.ID
+	block.TxIndexed = true
+	block.TxCount = int64(len(uniqueTxes))
+	partiallyIndexed := isTxPartiallyIndexed(block, txs)
+	block.TxPartiallyIndexed = partiallyIndexed
+	if err := db.
+		Where(models.Block{Height: block.Height, ChainID: block.ChainID}).
+		Assign(models.Block{
+			TxIndexed:           true,
+			TimeStamp:           block.TimeStamp,
+			IndexProfile:        block.IndexProfile,
+			BlockHash:           block.BlockHash,
+			BlockSizeBytes:      block.BlockSizeBytes,
+			TxCount:             block.TxCount,
+			ProposerValidatorID: block.ProposerValidatorID,
+			TxPartiallyIndexed:  partiallyIndexed,
+		}).
+		FirstOrCreate(block).Error; err != nil {
+		config.Log.Error("Error getting/creating block DB object.", err)
+		return nil, err
+	}
+
+	// Assign skips the zero value, a block fully indexed on reindex is cleared explicitly
+	if existingBlock.TxPartiallyIndexed && !partiallyIndexed {
+		block.TxPartiallyIndexed = false
+		if err := db.Model(&models.Block{}).Where("id = ?", block.ID).Update("tx_partially_indexed", false).Error; err != nil {
+			config.Log.Error("Error updating block DB object.", err)
+			return nil, err
+		}
+	}
+
+	if err := clearPruned(db, block); err != nil {
+		return nil, err
+	}
+
+	if indexerConfig.Flags.IndexBlockSignatures {
+		if err := indexBlockSignatures(db, block.ID, signatures, validators); err != nil {
+			return nil, err
+		}
+	}
+
+	return uniqueTxes, nil
+}
+
+// indexSignerAddresses inserts the signer, fee payer and fee granter addresses of the txs missing from the database in one statement
+// and resolves the IDs of all of them with one query. Returns the addresses by address.
+func indexSignerAddresses(db *gorm.DB, txs []TxDBWrapper) (map[string]models.Address, error) {
+	uniqueAddresses := make(map[string]models.Address)
+	for _, tx := range txs {
+		for _, signerAddress := range tx.Tx.SignerAddresses {
+			uniqueAddresses[signerAddress.Address] = models.Address{Address: signerAddress.Address}
+		}
+		for _, fee := range tx.Tx.Fees {
+			uniqueAddresses[fee.PayerAddress.Address] = models.Address{Address: fee.PayerAddress.Address}
+			if fee.GranterAddress != nil {
+				uniqueAddresses[fee.GranterAddress.Address] = models.Address{Address: fee.GranterAddress.Address}
+			}
+		}
+	}
+
+	if len(uniqueAddresses) == 0 {
+		return uniqueAddresses, nil
+	}
+
+	addressesSlice := make([]models.Address, 0, len(uniqueAddresses))
+	addressValues := make([]string, 0, len(uniqueAddresses))
+	for address, model := range uniqueAddresses {
+		addressesSlice = append(addressesSlice, model)
+		addressValues = append(addressValues, address)
+	}
+
+	// Existing rows return no ID on conflict, so the IDs of every address are selected afterwards
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "address"}},
+		DoNothing: true,
+	}).CreateInBatches(&addressesSlice, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error getting/creating addresses.", err)
+		return nil, err
+	}
+
+	var addresses []models.Address
+	if err := db.Where("address IN ?", addressValues).Find(&addresses).Error; err != nil {
+		config.Log.Error("Error getting addresses.", err)
+		return nil, err
+	}
+
+	for _, address := range addresses {
+		uniqueAddresses[address.Address] = address
+	}
+
+	return uniqueAddresses, nil
+}
+
+// indexFeeDenominations inserts the fee denominations of the txs missing from the database in one statement and resolves
+// the IDs of all of them with one query. Returns the denominations by base.
+func indexFeeDenominations(db *gorm.DB, txs []TxDBWrapper) (map[string]models.Denom, error) {
+	uniqueDenoms := make(map[string]models.Denom)
+	for _, tx := range txs {
+		for _, fee := range tx.Tx.Fees {
+			if fee.Denomination.Base == "" {
+				return nil, fmt.Errorf("fee of tx %s has no denomination", tx.Tx.Hash)
+			}
+			uniqueDenoms[fee.Denomination.Base] = models.Denom{Base: fee.Denomination.Base}
+		}
+	}
+
+	if len(uniqueDenoms) == 0 {
+		return uniqueDenoms, nil
+	}
+
+	denomsSlice := make([]models.Denom, 0, len(uniqueDenoms))
+	bases := make([]string, 0, len(uniqueDenoms))
+	for base, denom := range uniqueDenoms {
+		denomsSlice = append(denomsSlice, denom)
+		bases = append(bases, base)
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}},
+		DoNothing: true,
+	}).CreateInBatches(&denomsSlice, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error getting/creating denoms.", err)
+		return nil, err
+	}
+
+	var denoms []models.Denom
+	if err := db.Where("base IN ?", bases).Find(&denoms).Error; err != nil {
+		config.Log.Error("Error getting denoms.", err)
+		return nil, err
+	}
+
+	for _, denom := range denoms {
+		uniqueDenoms[denom.Base] = denom
+	}
+
+	return uniqueDenoms, nil
+}
+
+// indexFees inserts the fees of the txs, which must have their IDs and the IDs of the fee denominations, payers and granters,
+// in one statement. A tx indexed again updates the amount, payer and granter of its fee in each denomination.
+func indexFees(db *gorm.DB, txs []models.Tx) error {
+	var feesSlice []*models.Fee
+	for txIndex := range txs {
+		for feeIndex := range txs[txIndex].Fees {
+			txs[txIndex].Fees[feeIndex].TxID = txs[txIndex].ID
+			feesSlice = append(feesSlice, &txs[txIndex].Fees[feeIndex])
+		}
+	}
+
+	if len(feesSlice) == 0 {
+		return nil
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tx_id"}, {Name: "denomination_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "payer_address_id", "granter_address_id"}),
+	}).Omit(clause.Associations).CreateInBatches(feesSlice, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error getting/creating fees.", err)
+		return err
+	}
+
+	return nil
+}
+
+// indexMessageTypes finds or creates the message types of the txs, see findOrCreateDictionary, and returns them by type
+// with their IDs. Only the message types missing from the dictionary cache are looked up.
 func indexMessageTypes(db *gorm.DB, txs []TxDBWrapper) (map[string]models.MessageType, error) {
 	fullUniqueBlockMessageTypes := make(map[string]models.MessageType)
 	for _, tx := range txs {
@@ -413,28 +1241,33 @@ func indexMessageTypes(db *gorm.DB, txs []TxDBWrapper) (map[string]models.Messag
 		}
 	}
 
-	var messageTypesSlice []models.MessageType
-	for _, messageType := range fullUniqueBlockMessageTypes {
-		messageTypesSlice = append(messageTypesSlice, messageType)
+	cache := dictionaryCacheOf(db)
+	var uncached []string
+	for messageTypeKey, messageType := range fullUniqueBlockMessageTypes {
+		if id := cache.messageTypeID(messageTypeKey); id != 0 {
+			messageType.ID = id
+			fullUniqueBlockMessageTypes[messageTypeKey] = messageType
+			continue
+		}
+		uncached = append(uncached, messageTypeKey)
 	}
 
-	if len(messageTypesSlice) != 0 {
-		if err := db.Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "message_type"}},
-			DoUpdates: clause.AssignmentColumns([]string{"message_type"}),
-		}).Create(messageTypesSlice).Error; err != nil {
-			config.Log.Error("Error getting/creating message types.", err)
-			return nil, err
-		}
+	messageTypes, err := findOrCreateDictionary(db, "message_type", uncached,
+		func(value string) models.MessageType { return models.MessageType{MessageType: value} },
+		func(row models.MessageType) string { return row.MessageType })
+	if err != nil {
+		config.Log.Error("Error getting/creating message types.", err)
+		return nil, err
 	}
 
-	for _, messageType := range messageTypesSlice {
-		fullUniqueBlockMessageTypes[messageType.MessageType] = messageType
+	for messageTypeKey, messageType := range messageTypes {
+		fullUniqueBlockMessageTypes[messageTypeKey] = messageType
 	}
 
 	return fullUniqueBlockMessageTypes, nil
 }
 
+// indexMessageEventTypes finds or creates the message event types of the txs like indexMessageTypes
 func indexMessageEventTypes(db *gorm.DB, txs []TxDBWrapper) (map[string]models.MessageEventType, error) {
 	fullUniqueBlockMessageEventTypes := make(map[string]models.MessageEventType)
 
@@ -444,28 +1277,33 @@ func indexMessageEventTypes(db *gorm.DB, txs []TxDBWrapper) (map[string]models.M
 		}
 	}
 
-	var messageTypesSlice []models.MessageEventType
-	for _, messageType := range fullUniqueBlockMessageEventTypes {
-		messageTypesSlice = append(messageTypesSlice, messageType)
+	cache := dictionaryCacheOf(db)
+	var uncached []string
+	for messageEventTypeKey, messageEventType := range fullUniqueBlockMessageEventTypes {
+		if id := cache.messageEventTypeID(messageEventTypeKey); id != 0 {
+			messageEventType.ID = id
+			fullUniqueBlockMessageEventTypes[messageEventTypeKey] = messageEventType
+			continue
+		}
+		uncached = append(uncached, messageEventTypeKey)
 	}
 
-	if len(messageTypesSlice) != 0 {
-		if err := db.Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "type"}},
-			DoUpdates: clause.AssignmentColumns([]string{"type"}),
-		}).Create(messageTypesSlice).Error; err != nil {
-			config.Log.Error("Error getting/creating message event types.", err)
-			return nil, err
-		}
+	messageEventTypes, err := findOrCreateDictionary(db, "type", uncached,
+		func(value string) models.MessageEventType { return models.MessageEventType{Type: value} },
+		func(row models.MessageEventType) string { return row.Type })
+	if err != nil {
+		config.Log.Error("Error getting/creating message event types.", err)
+		return nil, err
 	}
 
-	for _, messageType := range messageTypesSlice {
-		fullUniqueBlockMessageEventTypes[messageType.Type] = messageType
+	for messageEventTypeKey, messageEventType := range messageEventTypes {
+		fullUniqueBlockMessageEventTypes[messageEventTypeKey] = messageEventType
 	}
 
 	return fullUniqueBlockMessageEventTypes, nil
 }
 
+// indexMessageEventAttributeKeys finds or creates the message event attribute keys of the txs like indexMessageTypes
 func indexMessageEventAttributeKeys(db *gorm.DB, txs []TxDBWrapper) (map[string]models.MessageEventAttributeKey, error) {
 	fullUniqueMessageEventAttributeKeys := make(map[string]models.MessageEventAttributeKey)
 
@@ -475,29 +1313,34 @@ func indexMessageEventAttributeKeys(db *gorm.DB, txs []TxDBWrapper) (map[string]
 		}
 	}
 
-	var messageEventAttributeKeysSlice []models.MessageEventAttributeKey
-	for _, messageEventAttributeKey := range fullUniqueMessageEventAttributeKeys {
-		messageEventAttributeKeysSlice = append(messageEventAttributeKeysSlice, messageEventAttributeKey)
+	cache := dictionaryCacheOf(db)
+	var uncached []string
+	for key, messageEventAttributeKey := range fullUniqueMessageEventAttributeKeys {
+		if id := cache.attributeKeyID(key); id != 0 {
+			messageEventAttributeKey.ID = id
+			fullUniqueMessageEventAttributeKeys[key] = messageEventAttributeKey
+			continue
+		}
+		uncached = append(uncached, key)
 	}
 
-	if len(messageEventAttributeKeysSlice) != 0 {
-		if err := db.Clauses(clause.OnConflict{
-			Columns:   []clause.Column{{Name: "key"}},
-			DoUpdates: clause.AssignmentColumns([]string{"key"}),
-		}).Create(messageEventAttributeKeysSlice).Error; err != nil {
-			config.Log.Error("Error getting/creating message event attribute keys.", err)
-			return nil, err
-		}
+	messageEventAttributeKeys, err := findOrCreateDictionary(db, "key", uncached,
+		func(value string) models.MessageEventAttributeKey { return models.MessageEventAttributeKey{Key: value} },
+		func(row models.MessageEventAttributeKey) string { return row.Key })
+	if err != nil {
+		config.Log.Error("Error getting/creating message event attribute keys.", err)
+		return nil, err
 	}
 
-	for _, messageEventAttributeKey := range messageEventAttributeKeysSlice {
-		fullUniqueMessageEventAttributeKeys[messageEventAttributeKey.Key] = messageEventAttributeKey
+	for key, messageEventAttributeKey := range messageEventAttributeKeys {
+		fullUniqueMessageEventAttributeKeys[key] = messageEventAttributeKey
 	}
 
 	return fullUniqueMessageEventAttributeKeys, nil
 }
 
-func IndexCustomMessages(conf config.IndexConfig, db *gorm.DB, dryRun bool, blockDBWrapper []TxDBWrapper, messageParserTrackers map[string]models.MessageParser) error {
+func IndexCustomMessages(ctx context.Context, conf config.IndexConfig, db *gorm.DB, dryRun bool, blockDBWrapper []TxDBWrapper, messageParserTrackers map[string]models.MessageParser) error {
+	db = db.WithContext(ctx)
 	return db.Transaction(func(dbTransaction *gorm.DB) error {
 		for _, tx := range blockDBWrapper {
 			for _, message := range tx.Messages {
@@ -506,7 +1349,7 @@ func IndexCustomMessages(conf config.IndexConfig, db *gorm.DB, dryRun bool, bloc
 
 						// Pre clear old errors
 						if parsedData.Parser != nil {
-							err := DeleteCustomMessageParserError(db, message.Message, messageParserTrackers[(*parsedData.Parser).Identifier()])
+							err := DeleteCustomMessageParserError(ctx, db, message.Message, messageParserTrackers[(*parsedData.Parser).Identifier()])
 							if err != nil {
 								config.Log.Error("Error clearing block event error.", err)
 								return err
@@ -527,7 +1370,7 @@ func IndexCustomMessages(conf config.IndexConfig, db *gorm.DB, dryRun bool, bloc
 								return err
 							}
 						} else if parsedData.Error != nil {
-							err := CreateMessageParserError(db, message.Message, messageParserTrackers[(*parsedData.Parser).Identifier()], parsedData.Error)
+							err := CreateMessageParserError(ctx, db, message.Message, messageParserTrackers[(*parsedData.Parser).Identifier()], parsedData.Error)
 							if err != nil {
 								config.Log.Error("Error inserting message parser error.", err)
 								return err
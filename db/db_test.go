@@ -1,14 +1,34 @@
 package db
 
 import (
-	"log"
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/DefiantLabs/cosmos-indexer/config"
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
-	"github.com/ory/dockertest/v3"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/parquet-go/parquet-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/suite"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
 )
 
 // TODO: Optimize tests to use a single database instance, clean database after each test, and teardown database after all tests are done
@@ -41,6 +61,131 @@ func (suite *DBTestSuite) TestMigrateModels() {
 	suite.Require().NoError(err)
 }
 
+func (suite *DBTestSuite) TestApplyMigrations() {
+	// Databases created by AutoMigrate are adopted by migration 1
+	suite.Require().NoError(AutoMigrateModels(suite.db))
+	suite.Require().NoError(MigrateModels(suite.db))
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	latest := migrations[len(migrations)-1].Version
+
+	var applied []models.SchemaMigration
+	suite.Require().NoError(suite.db.Order("version").Find(&applied).Error)
+	suite.Require().Len(applied, len(migrations))
+	suite.Assert().Equal(uint(1), applied[0].Version)
+	suite.Assert().Equal(latest, applied[len(applied)-1].Version)
+
+	var calls int
+	testMigrations := append(migrations, Migration{Version: latest + 1, Description: "test table", Migrate: func(tx *gorm.DB) error {
+		calls++
+		return tx.Exec("CREATE TABLE migration_tests (id integer)").Error
+	}})
+	suite.Require().NoError(applyMigrations(suite.db, testMigrations))
+	suite.Require().NoError(applyMigrations(suite.db, testMigrations))
+	suite.Assert().Equal(1, calls)
+	suite.Assert().True(suite.db.Migrator().HasTable("migration_tests"))
+
+	// A failed migration is rolled back and not recorded
+	failing := append(testMigrations, Migration{Version: latest + 2, Description: "failing", Migrate: func(tx *gorm.DB) error {
+		if err := tx.Exec("CREATE TABLE failed_migration_tests (id integer)").Error; err != nil {
+			return err
+		}
+		return errors.New("migration failed")
+	}})
+	suite.Require().ErrorContains(applyMigrations(suite.db, failing), "migration failed")
+	suite.Assert().False(suite.db.Migrator().HasTable("failed_migration_tests"))
+
+	version, err := schemaVersion(suite.db)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(latest+1, version)
+
+	// The database is ahead of this binary's migrations
+	var aheadErr *SchemaAheadError
+	suite.Require().ErrorAs(MigrateModels(suite.db), &aheadErr)
+	suite.Assert().Equal(latest+1, aheadErr.DatabaseVersion)
+	suite.Assert().Equal(latest, aheadErr.LatestVersion)
+
+	outOfOrder := []Migration{testMigrations[len(testMigrations)-1], testMigrations[0]}
+	suite.Assert().ErrorContains(applyMigrations(suite.db, outOfOrder), "out of order")
+}
+
+func (suite *DBTestSuite) TestMigrationPlan() {
+	plan, err := MigrationPlan(context.Background(), suite.db)
+	suite.Require().NoError(err)
+
+	// Planning executes nothing
+	suite.Assert().False(suite.db.Migrator().HasTable(&models.SchemaMigration{}))
+	suite.Assert().False(suite.db.Migrator().HasTable(&models.Block{}))
+
+	createdTables := make(map[string]int)
+	for _, change := range plan {
+		if change.Kind == PlannedCreateTable {
+			createdTables[change.Table]++
+		}
+	}
+	suite.Assert().Equal(1, createdTables["schema_migrations"])
+	suite.Assert().Equal(1, createdTables["blocks"])
+	suite.Assert().Equal(1, createdTables["chains"], "tables planned as dependencies of later models are only created once")
+	suite.Assert().Contains(plan, PlannedChange{
+		Migration: 1,
+		Kind:      PlannedCreateIndex,
+		Table:     "blocks",
+		Name:      "chainheight",
+		SQL:       plan[slices.IndexFunc(plan, func(change PlannedChange) bool { return change.Name == "chainheight" })].SQL,
+	})
+
+	suite.Assert().Contains(plan, PlannedChange{
+		Kind:  PlannedCreateIndex,
+		Table: "txes",
+		Name:  "idx_txes_block_id",
+		SQL:   plan[slices.IndexFunc(plan, func(change PlannedChange) bool { return change.Name == "idx_txes_block_id" })].SQL,
+	}, "secondary indexes are planned after the migrations")
+
+	suite.Require().NoError(MigrateModels(suite.db))
+	plan, err = MigrationPlan(context.Background(), suite.db)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(plan)
+
+	// Legacy AutoMigrate plans the columns missing from the live schema
+	suite.Require().NoError(suite.db.Migrator().DropColumn(&models.Upgrade{}, "Info"))
+	plan, err = AutoMigrationPlan(context.Background(), suite.db)
+	suite.Require().NoError(err)
+
+	// SQLite rebuilds tables to add constraints, so only the column changes are compared
+	var addedColumns []PlannedChange
+	for _, change := range plan {
+		if change.Kind == PlannedAddColumn {
+			addedColumns = append(addedColumns, change)
+		}
+	}
+	suite.Require().Len(addedColumns, 1)
+	suite.Assert().Equal("upgrades", addedColumns[0].Table)
+	suite.Assert().Equal("info", addedColumns[0].Name)
+	suite.Assert().False(suite.db.Migrator().HasColumn(&models.Upgrade{}, "Info"))
+}
+
+func (suite *DBTestSuite) TestCreateSecondaryIndexes() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	for _, index := range secondaryIndexes {
+		suite.Assert().True(suite.db.Migrator().HasIndex(index.Table, index.Name), index.Name)
+	}
+
+	// Creating them again does nothing
+	suite.Require().NoError(CreateSecondaryIndexes(suite.db))
+
+	suite.Require().NoError(suite.db.Migrator().DropIndex("blocks", "idx_blocks_chain_height"))
+	plan, err := MigrationPlan(context.Background(), suite.db)
+	suite.Require().NoError(err)
+	suite.Require().Len(plan, 1)
+	suite.Assert().Equal(PlannedCreateIndex, plan[0].Kind)
+	suite.Assert().Equal("blocks", plan[0].Table)
+	suite.Assert().Equal("idx_blocks_chain_height", plan[0].Name)
+
+	suite.Require().NoError(MigrateModels(suite.db))
+	suite.Assert().True(suite.db.Migrator().HasIndex("blocks", "idx_blocks_chain_height"))
+}
+
 func (suite *DBTestSuite) TestGetDBChainID() {
 	err := MigrateModels(suite.db)
 	suite.Require().NoError(err)
@@ -52,47 +197,106 @@ func (suite *DBTestSuite) TestGetDBChainID() {
 	err = suite.db.Create(&initChain).Error
 	suite.Require().NoError(err)
 
-	chainID, err := GetDBChainID(suite.db, initChain)
+	chainID, err := GetDBChainID(context.Background(), suite.db, initChain)
 	suite.Require().NoError(err)
 	suite.Assert().NotZero(chainID)
 }
 
-func SetupTestDatabase() (func(), *gorm.DB, error) {
-	// TODO: allow environment overrides to skip creating mock database
-	pool, err := dockertest.NewPool("")
-	if err != nil {
-		return nil, nil, err
-	}
+func (suite *DBTestSuite) TestGetDBChainIDCached() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
 
-	err = pool.Client.Ping()
-	if err != nil {
-		return nil, nil, err
-	}
+	chain := models.Chain{ChainID: "testchain-1", Name: "testchain"}
+	chainID, err := GetDBChainIDCached(context.Background(), suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().NotZero(chainID)
+	// The ID is returned, not written to the argument
+	suite.Assert().Zero(chain.ID)
 
-	resource, err := pool.Run("postgres", "15-alpine", []string{"POSTGRES_USER=test", "POSTGRES_PASSWORD=test", "POSTGRES_DB=test"})
-	if err != nil {
-		return nil, nil, err
-	}
+	// Resolved from the cache, the deleted row is not looked up again
+	suite.Require().NoError(suite.db.Exec("DELETE FROM chains").Error)
+	cachedID, err := GetDBChainIDCached(context.Background(), suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(chainID, cachedID)
 
-	var db *gorm.DB
-	if err := pool.Retry(func() error {
-		var err error
-		db, err = PostgresDbConnect(resource.GetBoundIP("5432/tcp"), resource.GetPort("5432/tcp"), "test", "test", "test", "debug")
-		if err != nil {
-			return err
-		}
-		return nil
-	}); err != nil {
-		return nil, nil, err
-	}
+	InvalidateChainCache(suite.db)
+	recreatedID, err := GetDBChainIDCached(context.Background(), suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().NotZero(recreatedID)
 
-	clean := func() {
-		if err := pool.Purge(resource); err != nil {
-			log.Fatalf("Could not purge resource: %s", err)
-		}
+	var count int64
+	suite.Require().NoError(suite.db.Model(&models.Chain{}).Where("chain_id = ?", "testchain-1").Count(&count).Error)
+	suite.Assert().Equal(int64(1), count)
+}
+
+func (suite *DBTestSuite) TestIBCDenoms() {
+	ctx := context.Background()
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(ctx, suite.db, models.Chain{ChainID: "testchain-1", Name: "testchain"})
+	suite.Require().NoError(err)
+	otherChainID, err := GetDBChainID(ctx, suite.db, models.Chain{ChainID: "otherchain-1", Name: "otherchain"})
+	suite.Require().NoError(err)
+
+	// Fees in an ibc/ denom on both chains, and in a native denom
+	for i, fee := range []struct {
+		chainID uint
+		denom   string
+	}{{chainID, "ibc/27394fb092d2eccd56123c74f36e4c1f926001ceada9ca97ea622b25f41e5eb2"}, {chainID, "uatom"}, {otherChainID, "ibc/0000"}} {
+		block := models.Block{Height: int64(i + 1), ChainID: fee.chainID}
+		suite.Require().NoError(suite.db.Omit(clause.Associations).Create(&block).Error)
+		tx := models.Tx{Hash: fmt.Sprintf("tx%d", i), BlockID: block.ID}
+		suite.Require().NoError(suite.db.Omit(clause.Associations).Create(&tx).Error)
+		denom := models.Denom{Base: fee.denom}
+		suite.Require().NoError(suite.db.Create(&denom).Error)
+		suite.Require().NoError(suite.db.Omit(clause.Associations).Create(&models.Fee{TxID: tx.ID, DenominationID: denom.ID}).Error)
 	}
 
-	return clean, db, nil
+	hashes, err := GetFeeIBCDenomHashes(ctx, suite.db, chainID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]string{"27394FB092D2ECCD56123C74F36E4C1F926001CEADA9CA97EA622B25F41E5EB2"}, hashes)
+	hash := hashes[0]
+
+	// Failures count the attempts and keep the retry marker of the last one
+	nextAttempt := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	suite.Require().NoError(RecordIBCDenomFailure(ctx, suite.db, chainID, hash, errors.New("not found"), nextAttempt))
+	suite.Require().NoError(RecordIBCDenomFailure(ctx, suite.db, chainID, hash, errors.New("unavailable"), nextAttempt.Add(time.Hour)))
+
+	denoms, err := GetIBCDenoms(ctx, suite.db, chainID, hashes)
+	suite.Require().NoError(err)
+	suite.Require().Contains(denoms, hash)
+	suite.Assert().False(denoms[hash].Resolved)
+	suite.Assert().Equal(uint(2), denoms[hash].Attempts)
+	suite.Assert().Equal("unavailable", denoms[hash].LastError)
+	suite.Require().NotNil(denoms[hash].NextAttemptAt)
+	suite.Assert().True(nextAttempt.Add(time.Hour).Equal(*denoms[hash].NextAttemptAt))
+
+	// Resolving clears the retry marker, a later failure does not undo it
+	suite.Require().NoError(UpsertIBCDenoms(ctx, suite.db, []models.IBCDenom{{ChainID: chainID, Hash: hash, Path: "transfer/channel-0", BaseDenom: "uatom", Resolved: true}}))
+	suite.Require().NoError(RecordIBCDenomFailure(ctx, suite.db, chainID, hash, errors.New("unavailable"), nextAttempt))
+
+	denoms, err = GetIBCDenoms(ctx, suite.db, chainID, hashes)
+	suite.Require().NoError(err)
+	suite.Assert().True(denoms[hash].Resolved)
+	suite.Assert().Equal("transfer/channel-0/uatom", denoms[hash].Denom())
+	suite.Assert().Zero(denoms[hash].Attempts)
+	suite.Assert().Nil(denoms[hash].NextAttemptAt)
+
+	// The rows are per chain
+	denoms, err = GetIBCDenoms(ctx, suite.db, otherChainID, hashes)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(denoms)
+}
+
+// SetupTestDatabase is dbtest.Setup. The tests of the db package cannot import dbtest since it imports the db package,
+// the external test package sets it in setup_test.go.
+var SetupTestDatabase func() (func(), *gorm.DB, error)
+
+// requirePostgres skips the test when it runs on a database other than PostgreSQL
+func (suite *DBTestSuite) requirePostgres() {
+	if dialect := dialectOf(suite.db); dialect != config.DialectPostgres {
+		suite.T().Skipf("requires PostgreSQL, running on %s", dialect)
+	}
 }
 
 func createMockBlock(mockDb *gorm.DB, chain models.Chain, address models.Address, height int64, txIndexed bool, eventIndexed bool) (models.Block, error) {
@@ -109,6 +313,28 @@ func createMockBlock(mockDb *gorm.DB, chain models.Chain, address models.Address
 	return block, err
 }
 
+func (suite *DBTestSuite) TestGetOrCreateChain() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chain, err := GetOrCreateChain(context.Background(), suite.db, models.Chain{ChainID: "cosmoshub-4", Name: "CosmosHub", Bech32Prefix: "cosmos", BaseDenom: "uatom", Network: config.NetworkMainnet})
+	suite.Require().NoError(err)
+	suite.Assert().NotZero(chain.ID)
+
+	// Changed config values update the row, unset ones and the name are kept
+	updated, err := GetOrCreateChain(context.Background(), suite.db, models.Chain{ChainID: "cosmoshub-4", Name: "Cosmos Hub", BaseDenom: "uatom2"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(chain.ID, updated.ID)
+
+	var stored models.Chain
+	suite.Require().NoError(suite.db.First(&stored, chain.ID).Error)
+	suite.Assert().Equal(models.Chain{ID: chain.ID, ChainID: "cosmoshub-4", Name: "CosmosHub", Bech32Prefix: "cosmos", BaseDenom: "uatom2", Network: config.NetworkMainnet}, stored)
+	suite.Assert().Equal(stored, updated)
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "cosmoshub-4"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(chain.ID, chainID)
+}
+
 func (suite *DBTestSuite) TestGetHighestBlockFunctions() {
 	err := MigrateModels(suite.db)
 	suite.Require().NoError(err)
@@ -127,11 +353,17 @@ func (suite *DBTestSuite) TestGetHighestBlockFunctions() {
 	err = suite.db.Create(&initConsAddress).Error
 	suite.Require().NoError(err)
 
+	_, found, err := GetHighestIndexedBlock(context.Background(), suite.db, initChain.ID)
+	suite.Require().NoError(err)
+	suite.Assert().False(found)
+
 	block1, err := createMockBlock(suite.db, initChain, initConsAddress, 1, true, true)
 	suite.Require().NoError(err)
 
-	txBlock := GetHighestIndexedBlock(suite.db, initChain.ID)
-	eventBlock, err := GetHighestEventIndexedBlock(suite.db, initChain.ID)
+	txBlock, found, err := GetHighestIndexedBlock(context.Background(), suite.db, initChain.ID)
+	suite.Require().NoError(err)
+	suite.Assert().True(found)
+	eventBlock, err := GetHighestEventIndexedBlock(context.Background(), suite.db, initChain.ID)
 	suite.Require().NoError(err)
 
 	suite.Assert().Equal(block1.Height, txBlock.Height)
@@ -140,8 +372,9 @@ func (suite *DBTestSuite) TestGetHighestBlockFunctions() {
 	_, err = createMockBlock(suite.db, initChain, initConsAddress, 2, false, false)
 	suite.Require().NoError(err)
 
-	txBlock = GetHighestIndexedBlock(suite.db, initChain.ID)
-	eventBlock, err = GetHighestEventIndexedBlock(suite.db, initChain.ID)
+	txBlock, _, err = GetHighestIndexedBlock(context.Background(), suite.db, initChain.ID)
+	suite.Require().NoError(err)
+	eventBlock, err = GetHighestEventIndexedBlock(context.Background(), suite.db, initChain.ID)
 	suite.Require().NoError(err)
 
 	suite.Assert().Equal(block1.Height, txBlock.Height)
@@ -150,14 +383,3494 @@ func (suite *DBTestSuite) TestGetHighestBlockFunctions() {
 	block3, err := createMockBlock(suite.db, initChain, initConsAddress, 3, true, true)
 	suite.Require().NoError(err)
 
-	txBlock = GetHighestIndexedBlock(suite.db, initChain.ID)
-	eventBlock, err = GetHighestEventIndexedBlock(suite.db, initChain.ID)
+	txBlock, _, err = GetHighestIndexedBlock(context.Background(), suite.db, initChain.ID)
+	suite.Require().NoError(err)
+	eventBlock, err = GetHighestEventIndexedBlock(context.Background(), suite.db, initChain.ID)
 	suite.Require().NoError(err)
 
 	suite.Assert().Equal(block3.Height, txBlock.Height)
 	suite.Assert().Equal(block3.Height, eventBlock.Height)
+
+	// A failed query is an error, not a chain without blocks
+	closed, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1"), &gorm.Config{DisableAutomaticPing: true})
+	suite.Require().NoError(err)
+	sqlDB, err := closed.DB()
+	suite.Require().NoError(err)
+	suite.Require().NoError(sqlDB.Close())
+
+	_, found, err = GetHighestIndexedBlock(context.Background(), closed, initChain.ID)
+	suite.Assert().Error(err)
+	suite.Assert().False(found)
 }
 
-func TestDBSuite(t *testing.T) {
-	suite.Run(t, new(DBTestSuite))
+func (suite *DBTestSuite) TestGetBlocksPage() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+
+	// Created out of order so the result order comes from the query
+	for _, height := range []int64{5, 1, 4, 2, 3} {
+		_, err := createMockBlock(suite.db, initChain, initConsAddress, height, true, true)
+		suite.Require().NoError(err)
+	}
+
+	heightsOf := func(blocks []models.Block) []int64 {
+		heights := make([]int64, len(blocks))
+		for i, block := range blocks {
+			heights[i] = block.Height
+		}
+		return heights
+	}
+
+	chain := NewChainRef(initChain)
+	page, err := GetBlocksPage(context.Background(), suite.db, chain, HeightsFrom(1), 2)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{1, 2}, heightsOf(page.Blocks))
+	suite.Assert().True(page.HasMore)
+	suite.Assert().Equal(HeightRange{Start: 3, End: OpenEnd}, page.Next)
+
+	page, err = GetBlocksPage(context.Background(), suite.db, chain, HeightRange{Start: 3, End: 5}, 3)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{3, 4, 5}, heightsOf(page.Blocks))
+	suite.Assert().False(page.HasMore)
+
+	_, err = GetBlocksPage(context.Background(), suite.db, chain, HeightsFrom(1), 0)
+	suite.Assert().Error(err)
+
+	var batches [][]int64
+	err = StreamBlocksInRange(context.Background(), suite.db, chain, HeightRange{Start: 2, End: 5}, 3, func(blocks []models.Block) error {
+		batches = append(batches, heightsOf(blocks))
+		return nil
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][]int64{{2, 3, 4}, {5}}, batches)
+
+	// An error from the callback stops the iteration
+	errStop := errors.New("stop")
+	calls := 0
+	err = StreamBlocksInRange(context.Background(), suite.db, chain, HeightsFrom(1), 1, func([]models.Block) error {
+		calls++
+		return errStop
+	})
+	suite.Assert().ErrorIs(err, errStop)
+	suite.Assert().Equal(1, calls)
+
+	blocks, err := GetBlocksInRange(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{1, 2, 3, 4, 5}, heightsOf(blocks))
+
+	// The pages are read from the read replica, which only has height 7
+	replica, err := SqliteDbConnect(":memory:", "debug")
+	suite.Require().NoError(err)
+	suite.Require().NoError(MigrateModels(replica))
+	replicaChain := models.Chain{ID: initChain.ID, ChainID: initChain.ChainID}
+	suite.Require().NoError(replica.Create(&replicaChain).Error)
+	_, err = createMockBlock(replica, replicaChain, initConsAddress, 7, true, true)
+	suite.Require().NoError(err)
+	suite.Require().NoError(UseReadReplica(suite.db, replica))
+
+	page, err = GetBlocksPage(context.Background(), suite.db, chain, HeightsFrom(1), 10)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{7}, heightsOf(page.Blocks))
+
+	blocks, err = GetBlocksInRange(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{7}, heightsOf(blocks))
+}
+
+func (suite *DBTestSuite) TestGetBlocksByTimeRange() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+	suite.Require().NoError(suite.db.Create(&initConsAddress).Error)
+
+	// Blocks spanning midnight, and a block whose events were indexed before its timestamp was known
+	midnight := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for height, timeStamp := range map[int64]time.Time{
+		1: midnight.Add(-2 * time.Minute),
+		2: midnight.Add(-time.Minute),
+		3: midnight,
+		4: midnight.Add(time.Minute),
+		5: {},
+	} {
+		block := models.Block{ChainID: initChain.ID, Height: height, TimeStamp: timeStamp, ProposerConsAddressID: initConsAddress.ID}
+		suite.Require().NoError(suite.db.Create(&block).Error)
+	}
+
+	heightsOf := func(blocks []models.Block) []int64 {
+		heights := make([]int64, len(blocks))
+		for i, block := range blocks {
+			heights[i] = block.Height
+		}
+		return heights
+	}
+
+	chain := NewChainRef(initChain)
+	blocks, err := GetBlocksByTimeRange(context.Background(), suite.db, chain, midnight.Add(-time.Minute), midnight.Add(time.Minute), Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{2, 3}, heightsOf(blocks))
+
+	blocks, err = GetBlocksByTimeRange(context.Background(), suite.db, chain, time.Time{}, midnight.Add(time.Hour), Pagination{Limit: 2, Offset: 2})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{3, 4}, heightsOf(blocks))
+
+	_, err = GetBlocksByTimeRange(context.Background(), suite.db, chain, midnight, midnight, Pagination{})
+	suite.Assert().Error(err)
+
+	height, err := GetHeightForTime(context.Background(), suite.db, chain, midnight)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(3), height)
+
+	height, err = GetHeightForTime(context.Background(), suite.db, chain, midnight.Add(-90*time.Second))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(2), height)
+
+	_, err = GetHeightForTime(context.Background(), suite.db, chain, midnight.Add(time.Hour))
+	suite.Assert().ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func (suite *DBTestSuite) TestGetFailedBlocks() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	for _, height := range []int64{7, 3, 5} {
+		suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, height, "testchain-1", "testchain", StageFetch, errors.New("rpc unavailable")))
+	}
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 4, "otherchain-1", "otherchain", StageFetch, errors.New("rpc unavailable")))
+
+	chain, err := GetChainRef(context.Background(), suite.db, "testchain-1")
+	suite.Require().NoError(err)
+
+	failedBlocks, err := GetFailedBlocks(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(failedBlocks, 3)
+	for i, height := range []int64{3, 5, 7} {
+		suite.Assert().Equal(height, failedBlocks[i].Height)
+		suite.Assert().Equal("testchain-1", failedBlocks[i].Chain.ChainID)
+	}
+
+	failedBlocks, err = GetFailedBlocks(context.Background(), suite.db, chain, HeightRange{Start: 4, End: 6})
+	suite.Require().NoError(err)
+	suite.Require().Len(failedBlocks, 1)
+	suite.Assert().Equal(int64(5), failedBlocks[0].Height)
+
+	_, err = GetFailedBlocks(context.Background(), suite.db, chain, HeightRange{Start: 6, End: 4})
+	suite.Assert().ErrorIs(err, ErrHeightRangeOrder)
+}
+
+func (suite *DBTestSuite) TestCountFailedBlocks() {
+	suite.Require().NoError(MigrateModels(suite.db))
+	ctx := context.Background()
+	failure := errors.New("rpc unavailable")
+
+	// 5 failed for both datasets and counts twice
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 3, "testchain-1", "testchain", StageFetch, failure))
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 5, "testchain-1", "testchain", StageFetch, failure))
+	suite.Require().NoError(UpsertFailedEventBlock(ctx, suite.db, 5, "testchain-1", "testchain", StageFetch, failure))
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 3, "testchain-1", "testchain", StageFetch, failure))
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 4, "otherchain-1", "otherchain", StageFetch, failure))
+
+	chain, err := GetChainRef(ctx, suite.db, "testchain-1")
+	suite.Require().NoError(err)
+
+	count, err := CountFailedBlocks(ctx, suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(3), count)
+
+	suite.Require().NoError(DeleteFailedEventBlock(ctx, suite.db, 5, chain.ID))
+	count, err = CountFailedBlocks(ctx, suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(2), count)
+
+	_, err = CountFailedBlocks(ctx, suite.db, ChainRef{ChainID: "unknown-1"})
+	suite.Assert().ErrorIs(err, ErrUnresolvedChainRef)
+}
+
+func (suite *DBTestSuite) TestGetFailedHeightsSince() {
+	suite.Require().NoError(MigrateModels(suite.db))
+	ctx := context.Background()
+	failure := errors.New("rpc unavailable")
+
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 3, "testchain-1", "testchain", StageFetch, failure))
+	since := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	// 5 failed for both datasets, 3 failed again, 9 is out of the range
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 5, "testchain-1", "testchain", StageFetch, failure))
+	suite.Require().NoError(UpsertFailedEventBlock(ctx, suite.db, 5, "testchain-1", "testchain", StageFetch, failure))
+	suite.Require().NoError(UpsertFailedEventBlock(ctx, suite.db, 4, "testchain-1", "testchain", StageProcess, failure))
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 3, "testchain-1", "testchain", StageFetch, failure))
+	suite.Require().NoError(UpsertFailedBlock(ctx, suite.db, 9, "testchain-1", "testchain", StageFetch, failure))
+
+	chain, err := GetChainRef(ctx, suite.db, "testchain-1")
+	suite.Require().NoError(err)
+
+	failed, err := GetFailedHeightsSince(ctx, suite.db, chain, HeightRange{Start: 1, End: 8}, since)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{3, 4, 5}, failed)
+
+	failed, err = GetFailedHeightsSince(ctx, suite.db, chain, HeightRange{Start: 1, End: 8}, time.Now().Add(time.Minute))
+	suite.Require().NoError(err)
+	suite.Assert().Empty(failed)
+}
+
+func (suite *DBTestSuite) TestUpsertFailedBlockDetails() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 5, "testchain-1", "testchain", StageFetch, errors.New("rpc unavailable")))
+	var first models.FailedBlock
+	suite.Require().NoError(suite.db.Where("height = ?", 5).First(&first).Error)
+	suite.Assert().Equal("rpc unavailable", first.Error)
+	suite.Assert().Equal(string(StageFetch), first.Stage)
+	suite.Assert().Equal(int64(1), first.AttemptCount)
+	suite.Require().NotNil(first.FirstFailedAt)
+	suite.Require().NotNil(first.LastFailedAt)
+
+	// A repeat failure records the latest error and counts the attempt
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 5, "testchain-1", "testchain", StageProcess, errors.New("decoding failed")))
+	var repeated models.FailedBlock
+	suite.Require().NoError(suite.db.First(&repeated, first.ID).Error)
+	suite.Assert().Equal("decoding failed", repeated.Error)
+	suite.Assert().Equal(string(StageProcess), repeated.Stage)
+	suite.Assert().Equal(int64(2), repeated.AttemptCount)
+	suite.Assert().True(repeated.FirstFailedAt.Equal(*first.FirstFailedAt))
+	suite.Assert().False(repeated.LastFailedAt.Before(*first.LastFailedAt))
+
+	// The same height on another chain is a separate failure
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 5, "otherchain-1", "otherchain", "", nil))
+	var failedBlocks int64
+	suite.Require().NoError(suite.db.Model(&models.FailedBlock{}).Count(&failedBlocks).Error)
+	suite.Assert().Equal(int64(2), failedBlocks)
+
+	suite.Require().NoError(UpsertFailedEventBlock(context.Background(), suite.db, 5, "testchain-1", "testchain", StageFetch, errors.New("rpc unavailable")))
+	suite.Require().NoError(UpsertFailedEventBlock(context.Background(), suite.db, 5, "testchain-1", "testchain", StageFetch, errors.New("rpc unavailable")))
+	var failedEventBlock models.FailedEventBlock
+	suite.Require().NoError(suite.db.Where("height = ?", 5).First(&failedEventBlock).Error)
+	suite.Assert().Equal(int64(2), failedEventBlock.AttemptCount)
+
+	// Failures recorded before the details were tracked count as one attempt at the time they were recorded
+	suite.Require().NoError(suite.db.Model(&models.FailedBlock{}).Where("id = ?", first.ID).Updates(map[string]any{"attempt_count": 0, "first_failed_at": nil, "last_failed_at": nil}).Error)
+	suite.Require().NoError(addFailureDetails(suite.db))
+	var legacy models.FailedBlock
+	suite.Require().NoError(suite.db.First(&legacy, first.ID).Error)
+	suite.Assert().Equal(int64(1), legacy.AttemptCount)
+	suite.Require().NotNil(legacy.FirstFailedAt)
+	suite.Assert().True(legacy.FirstFailedAt.Equal(*legacy.CreatedAt))
+}
+
+func (suite *DBTestSuite) TestQuarantineFailedBlocks() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+	for _, height := range []int64{1, 2, 4} {
+		_, err := createMockBlock(suite.db, initChain, initConsAddress, height, true, true)
+		suite.Require().NoError(err)
+	}
+
+	// 3 fails three times, 5 once
+	for _, height := range []int64{3, 3, 3, 5} {
+		suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, height, initChain.ChainID, "", StageProcess, errors.New("decoding failed")))
+	}
+
+	chain := NewChainRef(initChain)
+	quarantined, err := QuarantineFailedBlocks(context.Background(), suite.db, chain, 3)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), quarantined)
+
+	failures, err := GetQuarantinedFailures(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[int64]struct{}{3: {}}, failures.Transactions)
+	suite.Assert().Empty(failures.BlockEvents)
+
+	// The quarantined height is a known hole
+	requirements := CompletenessRequirements{Transactions: true}
+	gaps, err := GetMissingBlockRanges(context.Background(), suite.db, chain, HeightRange{Start: 1, End: 5}, requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]GapRange{{Start: 5, End: 5, Length: 1}}, gaps)
+
+	// Released, it is reattempted and quarantined again only after as many failures
+	suite.Require().NoError(UnquarantineFailedBlock(context.Background(), suite.db, chain, 3))
+	suite.Assert().ErrorIs(UnquarantineFailedBlock(context.Background(), suite.db, chain, 3), ErrNotQuarantined)
+
+	var released models.FailedBlock
+	suite.Require().NoError(suite.db.Where("height = ?", 3).First(&released).Error)
+	suite.Assert().False(released.Quarantined)
+	suite.Assert().Zero(released.AttemptCount)
+
+	gaps, err = GetMissingBlockRanges(context.Background(), suite.db, chain, HeightRange{Start: 1, End: 5}, requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]GapRange{{Start: 3, End: 3, Length: 1}, {Start: 5, End: 5, Length: 1}}, gaps)
+
+	quarantined, err = QuarantineFailedBlocks(context.Background(), suite.db, chain, 3)
+	suite.Require().NoError(err)
+	suite.Assert().Zero(quarantined)
+}
+
+func (suite *DBTestSuite) TestFailedEventBlockLifecycle() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	for _, height := range []int64{1, 2, 3} {
+		suite.Require().NoError(UpsertFailedEventBlock(context.Background(), suite.db, height, "testchain-1", "testchain", StageFetch, errors.New("rpc unavailable")))
+	}
+
+	failedHeights := func() []int64 {
+		var heights []int64
+		suite.Require().NoError(suite.db.Model(&models.FailedEventBlock{}).Order("height").Pluck("height", &heights).Error)
+		return heights
+	}
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+
+	// Indexing the events of a failed block removes its failure
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 1, blockTime), "block 1")
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{2, 3}, failedHeights())
+
+	// A failure left behind after its block was indexed is removed by the cleanup
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 2, blockTime), "block 2")
+	suite.Require().NoError(err)
+	suite.Require().NoError(UpsertFailedEventBlock(context.Background(), suite.db, 2, "testchain-1", "testchain", StageFetch, errors.New("rpc unavailable")))
+	suite.Assert().Equal([]int64{2, 3}, failedHeights())
+
+	removed, err := DeleteIndexedFailedEventBlocks(context.Background(), suite.db)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), removed)
+	suite.Assert().Equal([]int64{3}, failedHeights())
+
+	suite.Require().NoError(DeleteFailedEventBlock(context.Background(), suite.db, 3, chainID))
+	suite.Assert().Empty(failedHeights())
+}
+
+func (suite *DBTestSuite) TestDualWriterSecondaryUnavailable() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	initChain := models.Chain{
+		ChainID: "testchain-1",
+	}
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, initChain)
+	suite.Require().NoError(err)
+
+	// Nothing listens on this port, every query against the secondary will fail
+	secondary, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=test password=test dbname=test sslmode=disable connect_timeout=1"), &gorm.Config{DisableAutomaticPing: true})
+	suite.Require().NoError(err)
+
+	writer := NewDualWriter(suite.db, secondary, initChain)
+
+	block := models.Block{
+		Height:              1,
+		ChainID:             chainID,
+		TimeStamp:           time.Now(),
+		ProposerConsAddress: models.Address{Address: "testchainaddress"},
+	}
+
+	indexedBlock, _, err := writer.IndexNewBlock(context.Background(), block, []TxDBWrapper{}, config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Assert().NotZero(indexedBlock.ID)
+	suite.Require().NoError(writer.Close(context.Background()))
+
+	txBlock, _, err := GetHighestIndexedBlock(context.Background(), suite.db, chainID)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(block.Height, txBlock.Height)
+
+	stats := writer.Stats()
+	suite.Assert().Equal(uint64(1), stats.SecondaryWrites)
+	suite.Assert().Equal(uint64(1), stats.SecondaryFailures)
+	suite.Assert().Equal(block.Height, stats.LastFailedHeight)
+}
+
+func (suite *DBTestSuite) TestDualWriterSecondaryHangs() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	secondary, err := SqliteDbConnect(":memory:", "debug")
+	suite.Require().NoError(err)
+	suite.Require().NoError(MigrateModels(secondary))
+
+	// Every query of the secondary hangs until its context is done
+	hang := func(db *gorm.DB) {
+		<-db.Statement.Context.Done()
+		_ = db.AddError(db.Statement.Context.Err())
+	}
+	suite.Require().NoError(secondary.Callback().Query().Before("gorm:query").Register("test:hang", hang))
+	suite.Require().NoError(secondary.Callback().Create().Before("gorm:create").Register("test:hang", hang))
+
+	initChain := models.Chain{
+		ChainID: "testchain-1",
+	}
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, initChain)
+	suite.Require().NoError(err)
+
+	newBlock := func(height int64) models.Block {
+		return models.Block{
+			Height:              height,
+			ChainID:             chainID,
+			TimeStamp:           time.Now(),
+			ProposerConsAddress: models.Address{Address: "testchainaddress"},
+		}
+	}
+
+	// A hanging write fails at its deadline without holding up the primary
+	writer := NewDualWriter(suite.db, secondary, initChain)
+	writer.WriteTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	_, _, err = writer.IndexNewBlock(context.Background(), newBlock(1), []TxDBWrapper{}, config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Assert().Less(time.Since(start), time.Second)
+
+	suite.Require().NoError(writer.Close(context.Background()))
+	stats := writer.Stats()
+	suite.Assert().Equal(uint64(1), stats.SecondaryFailures)
+	suite.Assert().Contains(stats.LastSecondaryError, context.DeadlineExceeded.Error())
+
+	// Writes beyond the queue are dropped, the primary keeps indexing
+	writer = NewDualWriter(suite.db, secondary, initChain)
+	writer.WriteTimeout = time.Hour
+
+	start = time.Now()
+	writes := DefaultDualWriteQueueSize + 2
+	for height := int64(2); height < int64(2+writes); height++ {
+		_, _, err = writer.IndexNewBlock(context.Background(), newBlock(height), []TxDBWrapper{}, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+	suite.Assert().Less(time.Since(start), 30*time.Second)
+	suite.Assert().GreaterOrEqual(writer.Stats().SecondaryFailures, uint64(1))
+	suite.Assert().Equal(errDualWriteQueueFull.Error(), writer.Stats().LastSecondaryError)
+
+	// Closing cancels the queued writes once its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	suite.Require().ErrorIs(writer.Close(ctx), context.DeadlineExceeded)
+
+	stats = writer.Stats()
+	suite.Assert().Equal(uint64(writes), stats.SecondaryWrites)
+	suite.Assert().Equal(uint64(writes), stats.SecondaryFailures)
+
+	var indexed int64
+	suite.Require().NoError(suite.db.Model(&models.Block{}).Count(&indexed).Error)
+	suite.Assert().Equal(int64(1+writes), indexed)
+}
+
+func (suite *DBTestSuite) TestCutOver() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	secondary, err := SqliteDbConnect(":memory:", "debug")
+	suite.Require().NoError(err)
+	suite.Require().NoError(MigrateModels(secondary))
+
+	initChain := models.Chain{
+		ChainID: "testchain-1",
+	}
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, initChain)
+	suite.Require().NoError(err)
+
+	writer := NewDualWriter(suite.db, secondary, initChain)
+	newBlock := func(height int64) models.Block {
+		return models.Block{
+			Height:              height,
+			ChainID:             chainID,
+			TimeStamp:           time.Now(),
+			ProposerConsAddress: models.Address{Address: "testchainaddress"},
+		}
+	}
+
+	_, _, err = writer.IndexNewBlock(context.Background(), newBlock(1), []TxDBWrapper{}, config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Require().NoError(writer.Close(context.Background()))
+
+	// The secondary lags behind, only a forced cutover goes ahead
+	_, _, err = IndexNewBlock(context.Background(), suite.db, newBlock(2), []TxDBWrapper{}, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	_, err = CutOver(context.Background(), suite.db, secondary, "testchain-1", "new-cluster", 10, false)
+	suite.Require().ErrorContains(err, "has not converged")
+	suite.Require().NoError(CheckChainCutover(context.Background(), suite.db, "testchain-1"))
+
+	report, err := CutOver(context.Background(), suite.db, secondary, "testchain-1", "new-cluster", 10, true)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), report.TxWatermarkLag)
+
+	var cutOverErr *ChainCutOverError
+	suite.Require().ErrorAs(CheckChainCutover(context.Background(), suite.db, "testchain-1"), &cutOverErr)
+	suite.Assert().Equal("new-cluster", cutOverErr.Target)
+	suite.Assert().NoError(CheckChainCutover(context.Background(), secondary, "testchain-1"))
+
+	_, err = CutOver(context.Background(), suite.db, secondary, "testchain-1", "new-cluster", 10, true)
+	suite.Require().ErrorAs(err, &cutOverErr)
+}
+
+func (suite *DBTestSuite) TestDualWriterMirrorsSanitizedBlockEventAttributes() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	secondary, err := SqliteDbConnect(":memory:", "debug")
+	suite.Require().NoError(err)
+	suite.Require().NoError(MigrateModels(secondary))
+
+	initChain := models.Chain{
+		ChainID: "testchain-1",
+	}
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, initChain)
+	suite.Require().NoError(err)
+
+	writer := NewDualWriter(suite.db, secondary, initChain)
+
+	wrapper := mockBlockEventsDBWrapper(chainID, 1, time.Now().UTC().Truncate(time.Microsecond))
+	wrapper.BeginBlockEvents[0].Attributes = []models.BlockEventAttribute{
+		{
+			Value:                  "10uatom�",
+			ValueBytes:             []byte("10uatom\xff"),
+			Sanitized:              true,
+			BlockEventAttributeKey: models.BlockEventAttributeKey{Key: "amount"},
+		},
+	}
+
+	_, err = writer.IndexBlockEvents(context.Background(), false, wrapper, "block 1")
+	suite.Require().NoError(err)
+	suite.Require().NoError(writer.Close(context.Background()))
+	suite.Require().Zero(writer.Stats().SecondaryFailures)
+
+	attributeOf := func(db *gorm.DB) models.BlockEventAttribute {
+		var attributes []models.BlockEventAttribute
+		suite.Require().NoError(db.Find(&attributes).Error)
+		suite.Require().Len(attributes, 1)
+		return attributes[0]
+	}
+
+	primaryAttribute := attributeOf(suite.db)
+	secondaryAttribute := attributeOf(secondary)
+	suite.Assert().Equal([]byte("10uatom\xff"), primaryAttribute.ValueBytes)
+	suite.Assert().True(primaryAttribute.Sanitized)
+	suite.Assert().Equal(primaryAttribute.Value, secondaryAttribute.Value)
+	suite.Assert().Equal(primaryAttribute.ValueBytes, secondaryAttribute.ValueBytes)
+	suite.Assert().Equal(primaryAttribute.Sanitized, secondaryAttribute.Sanitized)
+}
+
+func (suite *DBTestSuite) TestGetConvergenceReport() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	initChain := models.Chain{
+		ChainID: "testchain-1",
+	}
+
+	err = suite.db.Create(&initChain).Error
+	suite.Require().NoError(err)
+
+	initConsAddress := models.Address{
+		Address: "testchainaddress",
+	}
+
+	err = suite.db.Create(&initConsAddress).Error
+	suite.Require().NoError(err)
+
+	for height := int64(1); height <= 5; height++ {
+		_, err = createMockBlock(suite.db, initChain, initConsAddress, height, true, true)
+		suite.Require().NoError(err)
+	}
+
+	// The same database on both sides must always be converged
+	report, err := GetConvergenceReport(context.Background(), suite.db, suite.db, initChain.ChainID, 3)
+	suite.Require().NoError(err)
+
+	suite.Assert().True(report.Converged)
+	suite.Assert().Equal(int64(5), report.PrimaryHighestTxBlock)
+	suite.Assert().Zero(report.TxWatermarkLag)
+	suite.Assert().Zero(report.EventWatermarkLag)
+	suite.Assert().Len(report.SampledHeights, 3)
+	suite.Assert().Zero(report.MismatchedSampledHeights)
+}
+
+func (suite *DBTestSuite) TestGetMessageTypeStats() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	initChain := models.Chain{
+		ChainID: "testchain-1",
+	}
+
+	err = suite.db.Create(&initChain).Error
+	suite.Require().NoError(err)
+
+	initConsAddress := models.Address{
+		Address: "testchainaddress",
+	}
+
+	err = suite.db.Create(&initConsAddress).Error
+	suite.Require().NoError(err)
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	delegateType := models.MessageType{MessageType: "/cosmos.staking.v1beta1.MsgDelegate"}
+	suite.Require().NoError(suite.db.Create(&sendType).Error)
+	suite.Require().NoError(suite.db.Create(&delegateType).Error)
+
+	for height := int64(1); height <= 3; height++ {
+		block, err := createMockBlock(suite.db, initChain, initConsAddress, height, true, true)
+		suite.Require().NoError(err)
+
+		tx := models.Tx{Hash: fmt.Sprintf("hash%d", height), BlockID: block.ID}
+		suite.Require().NoError(suite.db.Create(&tx).Error)
+
+		suite.Require().NoError(suite.db.Create(&models.Message{TxID: tx.ID, MessageTypeID: sendType.ID, MessageIndex: 0}).Error)
+		if height == 2 {
+			suite.Require().NoError(suite.db.Create(&models.Message{TxID: tx.ID, MessageTypeID: delegateType.ID, MessageIndex: 1}).Error)
+		}
+	}
+
+	stats, err := GetMessageTypeStatsInRange(context.Background(), suite.db, NewChainRef(initChain), HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(stats, 2)
+
+	suite.Assert().Equal(TypeStats{Type: sendType.MessageType, Count: 3, FirstSeenHeight: 1, LastSeenHeight: 3}, stats[0])
+	suite.Assert().Equal(TypeStats{Type: delegateType.MessageType, Count: 1, FirstSeenHeight: 2, LastSeenHeight: 2}, stats[1])
+
+	stats, err = GetMessageTypeStatsInRange(context.Background(), suite.db, NewChainRef(initChain), HeightRange{Start: 3, End: 3})
+	suite.Require().NoError(err)
+	suite.Require().Len(stats, 1)
+	suite.Assert().Equal(int64(1), stats[0].Count)
+
+	_, err = GetMessageTypeStatsInRange(context.Background(), suite.db, NewChainRef(initChain), HeightRange{Start: 3, End: 1})
+	suite.Assert().ErrorIs(err, ErrHeightRangeOrder)
+
+	_, err = GetMessageTypeStatsInRange(context.Background(), suite.db, ChainRef{ChainID: initChain.ChainID}, HeightsFrom(1))
+	suite.Assert().ErrorIs(err, ErrUnresolvedChainRef)
+}
+
+func (suite *DBTestSuite) TestCountHelpers() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "testchainaddress"}
+	suite.Require().NoError(suite.db.Create(&initConsAddress).Error)
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	delegateType := models.MessageType{MessageType: "/cosmos.staking.v1beta1.MsgDelegate"}
+	suite.Require().NoError(suite.db.Create(&sendType).Error)
+	suite.Require().NoError(suite.db.Create(&delegateType).Error)
+
+	for height := int64(1); height <= 3; height++ {
+		block, err := createMockBlock(suite.db, initChain, initConsAddress, height, true, true)
+		suite.Require().NoError(err)
+
+		tx := models.Tx{Hash: fmt.Sprintf("hash%d", height), BlockID: block.ID}
+		suite.Require().NoError(suite.db.Create(&tx).Error)
+
+		suite.Require().NoError(suite.db.Create(&models.Message{TxID: tx.ID, MessageTypeID: sendType.ID, MessageIndex: 0}).Error)
+		if height == 2 {
+			suite.Require().NoError(suite.db.Create(&models.Message{TxID: tx.ID, MessageTypeID: delegateType.ID, MessageIndex: 1}).Error)
+		}
+	}
+
+	// Block events indexed before the block was fetched leave a row without a timestamp
+	_, err := IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(initChain.ID, 4, time.Time{}), "block 4")
+	suite.Require().NoError(err)
+
+	chain := NewChainRef(initChain)
+	blocks, err := CountIndexedBlocks(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(3), blocks)
+
+	txs, err := CountTxs(context.Background(), suite.db, chain, HeightRange{Start: 2, End: 4})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(2), txs)
+
+	messages, err := CountMessagesByType(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[string]int64{sendType.MessageType: 3, delegateType.MessageType: 1}, messages)
+
+	messages, err = CountMessagesByType(context.Background(), suite.db, chain, HeightRange{Start: 3, End: 3})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[string]int64{sendType.MessageType: 1}, messages)
+
+	_, err = CountTxs(context.Background(), suite.db, chain, HeightRange{Start: 3, End: 1})
+	suite.Assert().ErrorIs(err, ErrHeightRangeOrder)
+}
+
+func (suite *DBTestSuite) TestNormalizeAddresses() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	// Addresses are normalized against the bech32 prefix of the chain row
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1", Bech32Prefix: "cosmos"})
+	suite.Require().NoError(err)
+
+	address, err := bech32.ConvertAndEncode("cosmos", []byte("01234567890123456789"))
+	suite.Require().NoError(err)
+	otherPrefix, err := bech32.ConvertAndEncode("osmo", []byte("01234567890123456789"))
+	suite.Require().NoError(err)
+
+	mixedCase := strings.ToUpper(address[:10]) + address[10:]
+
+	for _, input := range []string{address, strings.ToUpper(address), mixedCase, " " + address + "\n"} {
+		normalized, err := NormalizeAddress(input, "cosmos")
+		suite.Require().NoError(err, input)
+		suite.Assert().Equal(address, normalized)
+	}
+
+	// Any prefix is accepted without one configured
+	normalized, err := NormalizeAddress(otherPrefix, "")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(otherPrefix, normalized)
+
+	var invalid *InvalidAddressError
+	for _, input := range []string{otherPrefix, "", "garbage", address[:len(address)-1] + "x"} {
+		_, err := NormalizeAddress(input, "cosmos")
+		suite.Require().ErrorAs(err, &invalid, input)
+		suite.Assert().Equal(input, invalid.Address)
+	}
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	for height, signer := range map[int64]string{1: address, 2: mixedCase} {
+		block, txs := mockTxBlock(chainID, height, blockTime)
+		txs[0].Tx.SignerAddresses = []models.Address{{Address: signer}}
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	var addresses []models.Address
+	suite.Require().NoError(suite.db.Where("address <> ?", "testchainaddress").Find(&addresses).Error)
+	suite.Require().Len(addresses, 1)
+	suite.Assert().Equal(address, addresses[0].Address)
+
+	found, err := GetAddresses(context.Background(), suite.db, "cosmos", mixedCase)
+	suite.Require().NoError(err)
+	suite.Require().Len(found, 1)
+	suite.Assert().Equal(addresses[0].ID, found[0].ID)
+
+	_, err = GetAddresses(context.Background(), suite.db, "cosmos", otherPrefix)
+	suite.Assert().ErrorAs(err, &invalid)
+
+	// Lists longer than the bind parameter limit are looked up in chunks
+	lookup := []string{mixedCase}
+	for i := 0; len(lookup) <= 2*addressLookupChunkSize; i++ {
+		unindexed, err := bech32.ConvertAndEncode("cosmos", []byte(fmt.Sprintf("unindexed%011d", i)))
+		suite.Require().NoError(err)
+		lookup = append(lookup, unindexed)
+	}
+	lookup = append(lookup, address)
+	found, err = GetAddresses(context.Background(), suite.db, "cosmos", lookup...)
+	suite.Require().NoError(err)
+	suite.Require().Len(found, 1)
+	suite.Assert().Equal(addresses[0].ID, found[0].ID)
+
+	// Address lookups are normalized like the writes
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+	addressTxs, err := GetTxsByAddress(context.Background(), suite.db, chain, strings.ToUpper(address), TxQueryOptions{})
+	suite.Require().NoError(err)
+	suite.Require().Len(addressTxs, 2)
+	suite.Assert().Equal(address, addressTxs[0].SignerAddresses[0].Address)
+
+	_, err = GetFailedTxsByAddress(context.Background(), suite.db, chain, otherPrefix, TxQueryOptions{})
+	suite.Assert().ErrorAs(err, &invalid)
+
+	var exported strings.Builder
+	written, err := ExportCSV(context.Background(), suite.db, chain, ExportOptions{Dataset: ExportTxs, Address: mixedCase}, &exported)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(2), written)
+
+	_, err = ExportCSV(context.Background(), suite.db, chain, ExportOptions{Dataset: ExportTxs, Address: otherPrefix}, io.Discard)
+	suite.Assert().ErrorAs(err, &invalid)
+
+	block, txs := mockTxBlock(chainID, 3, blockTime)
+	txs[0].Tx.SignerAddresses = []models.Address{{Address: otherPrefix}}
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Assert().ErrorAs(err, &invalid)
+
+	var blocks int64
+	suite.Require().NoError(suite.db.Model(&models.Block{}).Where("height = ?", 3).Count(&blocks).Error)
+	suite.Assert().Zero(blocks)
+}
+
+func (suite *DBTestSuite) TestIndexSignerAddresses() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	existing := models.Address{Address: "signer0"}
+	suite.Require().NoError(suite.db.Create(&existing).Error)
+
+	var txs []TxDBWrapper
+	for i := 0; i < 5; i++ {
+		signer := models.Address{Address: fmt.Sprintf("signer%d", i)}
+		txs = append(txs, TxDBWrapper{Tx: models.Tx{
+			Hash:            fmt.Sprintf("hash%d", i),
+			SignerAddresses: []models.Address{signer},
+			// Every fee is paid by the same address
+			Fees: []models.Fee{{PayerAddress: models.Address{Address: "payer"}}},
+		}})
+	}
+
+	var addressInserts int
+	suite.Require().NoError(suite.db.Callback().Create().After("gorm:create").Register("test:count_address_inserts", func(db *gorm.DB) {
+		if db.Statement.Table == "addresses" {
+			addressInserts++
+		}
+	}))
+
+	var addresses map[string]models.Address
+	err := suite.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		addresses, err = indexSignerAddresses(tx, txs)
+		return err
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, addressInserts)
+
+	suite.Require().Len(addresses, 6)
+	suite.Assert().Equal(existing.ID, addresses["signer0"].ID)
+
+	var stored []models.Address
+	suite.Require().NoError(suite.db.Find(&stored).Error)
+	suite.Require().Len(stored, 6)
+	for _, address := range stored {
+		suite.Assert().Equal(address.ID, addresses[address.Address].ID, address.Address)
+	}
+}
+
+func (suite *DBTestSuite) TestIndexNewBlockFees() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	indexBlock := func(payer string, atomAmount int64) {
+		block, txs := mockTxBlock(chainID, 1, blockTime)
+		txs[0].Tx.Fees = []models.Fee{
+			{Amount: decimal.NewFromInt(atomAmount), Denomination: models.Denom{Base: "uatom"}, PayerAddress: models.Address{Address: payer}},
+			{Amount: decimal.NewFromInt(5), Denomination: models.Denom{Base: "uosmo"}, PayerAddress: models.Address{Address: payer}},
+		}
+		// A tx without fees
+		txs = append(txs, TxDBWrapper{Tx: models.Tx{Hash: "nofee"}})
+
+		_, indexedTxs, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+		for _, fee := range indexedTxs[0].Tx.Fees {
+			suite.Assert().NotZero(fee.ID)
+			suite.Assert().Equal(indexedTxs[0].Tx.ID, fee.TxID)
+		}
+	}
+
+	feesOf := func(hash string) []models.Fee {
+		var tx models.Tx
+		suite.Require().NoError(suite.db.Where("hash = ?", hash).Preload("Fees", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id")
+		}).Preload("Fees.Denomination").Preload("Fees.PayerAddress").First(&tx).Error)
+		return tx.Fees
+	}
+
+	indexBlock("alice", 100)
+
+	fees := feesOf("hash1")
+	suite.Require().Len(fees, 2)
+	suite.Assert().Equal("uatom", fees[0].Denomination.Base)
+	suite.Assert().True(fees[0].Amount.Equal(decimal.NewFromInt(100)))
+	suite.Assert().Equal("uosmo", fees[1].Denomination.Base)
+	suite.Assert().Equal("alice", fees[1].PayerAddress.Address)
+	suite.Assert().Empty(feesOf("nofee"))
+
+	// Indexing the block again updates the fees in place
+	indexBlock("bob", 250)
+
+	fees = feesOf("hash1")
+	suite.Require().Len(fees, 2)
+	suite.Assert().True(fees[0].Amount.Equal(decimal.NewFromInt(250)))
+	suite.Assert().Equal("bob", fees[0].PayerAddress.Address)
+	suite.Assert().Equal("bob", fees[1].PayerAddress.Address)
+
+	var count int64
+	suite.Require().NoError(suite.db.Model(&models.Fee{}).Count(&count).Error)
+	suite.Assert().Equal(int64(2), count)
+	suite.Require().NoError(suite.db.Model(&models.Denom{}).Count(&count).Error)
+	suite.Assert().Equal(int64(2), count)
+}
+
+func (suite *DBTestSuite) TestFeeGranter() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	indexTx := func(height int64, granter string) {
+		block, txs := mockTxBlock(chainID, height, blockTime)
+		fee := models.Fee{Amount: decimal.NewFromInt(height * 100), Denomination: models.Denom{Base: "uatom"}, PayerAddress: models.Address{Address: "alice"}}
+		if granter != "" {
+			fee.GranterAddress = &models.Address{Address: granter}
+		}
+		txs[0].Tx.Fees = []models.Fee{fee}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	indexTx(1, "granter")
+	indexTx(2, "")
+	indexTx(3, "granter")
+	indexTx(4, "othergranter")
+
+	fees, err := GetFeesGrantedByAddress(context.Background(), suite.db, chain, "granter", HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Require().Len(fees, 2)
+	suite.Assert().Equal(int64(1), fees[0].Height)
+	suite.Assert().Equal("hash1", fees[0].TxHash)
+	suite.Assert().Equal(int64(3), fees[1].Height)
+	suite.Assert().True(fees[1].Amount.Equal(decimal.NewFromInt(300)))
+	suite.Assert().Equal("alice", fees[1].PayerAddress.Address)
+	suite.Require().NotNil(fees[1].GranterAddress)
+	suite.Assert().Equal("granter", fees[1].GranterAddress.Address)
+	suite.Assert().Equal("uatom", fees[1].Denomination.Base)
+
+	fees, err = GetFeesGrantedByAddress(context.Background(), suite.db, chain, "granter", HeightRange{Start: 2, End: 4}, Pagination{})
+	suite.Require().NoError(err)
+	suite.Require().Len(fees, 1)
+	suite.Assert().Equal(int64(3), fees[0].Height)
+
+	fees, err = GetFeesGrantedByAddress(context.Background(), suite.db, chain, "alice", HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(fees)
+
+	// A fee without a granter is stored without one
+	var ungranted models.Fee
+	suite.Require().NoError(suite.db.Joins("JOIN txes ON txes.id = fees.tx_id").Where("txes.hash = ?", "hash2").First(&ungranted).Error)
+	suite.Assert().Nil(ungranted.GranterAddressID)
+
+	// The migration does nothing on a database created with the granter
+	suite.Require().NoError(addFeeGranter(suite.db))
+}
+
+func (suite *DBTestSuite) TestGetAverageGasUsedByMessageType() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	delegateType := models.MessageType{MessageType: "/cosmos.staking.v1beta1.MsgDelegate"}
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	indexTx := func(height int64, gasUsed int64, messageTypes ...models.MessageType) {
+		block, txs := mockTxBlock(chainID, height, blockTime)
+		txs[0].Tx.GasWanted = 200000
+		txs[0].Tx.GasUsed = gasUsed
+		txs[0].UniqueMessageTypes = make(map[string]models.MessageType)
+		for i, messageType := range messageTypes {
+			txs[0].Messages = append(txs[0].Messages, MessageDBWrapper{Message: models.Message{MessageIndex: i, MessageType: messageType}})
+			txs[0].UniqueMessageTypes[messageType.MessageType] = messageType
+		}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	// Two sends in one tx count it once
+	indexTx(1, 100000, sendType, sendType)
+	indexTx(2, 50000, sendType, delegateType)
+	indexTx(3, 0, sendType)
+	indexTx(4, 90000, delegateType)
+
+	var tx models.Tx
+	suite.Require().NoError(suite.db.Where("hash = ?", "hash1").First(&tx).Error)
+	suite.Assert().Equal(int64(200000), tx.GasWanted)
+	suite.Assert().Equal(int64(100000), tx.GasUsed)
+
+	stats, err := GetAverageGasUsedByMessageType(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]MessageTypeGas{
+		{MessageType: sendType.MessageType, TxCount: 2, AverageGasUsed: 75000},
+		{MessageType: delegateType.MessageType, TxCount: 2, AverageGasUsed: 70000},
+	}, stats)
+
+	stats, err = GetAverageGasUsedByMessageType(context.Background(), suite.db, chain, HeightRange{Start: 3, End: 4})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]MessageTypeGas{{MessageType: delegateType.MessageType, TxCount: 1, AverageGasUsed: 90000}}, stats)
+
+	// Indexing a tx again refreshes its gas
+	indexTx(4, 30000, delegateType)
+	var reindexed models.Tx
+	suite.Require().NoError(suite.db.Where("hash = ?", "hash4").First(&reindexed).Error)
+	suite.Assert().Equal(int64(30000), reindexed.GasUsed)
+}
+
+func (suite *DBTestSuite) TestIndexNewBlockMemo() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	indexMemo := func(memo string) models.Tx {
+		block, txs := mockTxBlock(chainID, 1, blockTime)
+		txs[0].Tx.Memo = memo
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+
+		var tx models.Tx
+		suite.Require().NoError(suite.db.Where("hash = ?", "hash1").First(&tx).Error)
+		return tx
+	}
+
+	emojiMemo := strings.Repeat("🚀", 256)
+	suite.Assert().Equal(emojiMemo, indexMemo(emojiMemo).Memo)
+
+	// Indexing the tx again replaces the memo, null bytes and invalid UTF-8 are sanitized
+	suite.Assert().Equal("deposit 12345�", indexMemo("deposit\x00 12345\xff").Memo)
+}
+
+func (suite *DBTestSuite) TestGetFailedTxsByAddress() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	indexTx := func(height int64, code uint32, errorMessage string) {
+		block, txs := mockTxBlock(chainID, height, blockTime)
+		txs[0].Tx.Code = code
+		txs[0].Tx.ErrorMessage = errorMessage
+		txs[0].Tx.SignerAddresses = []models.Address{{Address: "alice"}}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	indexTx(1, 0, "")
+	indexTx(2, 5, "insufficient funds")
+	indexTx(3, 11, "out of gas\x00")
+
+	txs, err := GetFailedTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{})
+	suite.Require().NoError(err)
+	suite.Require().Len(txs, 2)
+	suite.Assert().Equal("hash2", txs[0].Hash)
+	suite.Assert().Equal("insufficient funds", txs[0].ErrorMessage)
+	suite.Assert().Equal(uint32(11), txs[1].Code)
+	suite.Assert().Equal("out of gas", txs[1].ErrorMessage)
+
+	txs, err = GetFailedTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{Heights: HeightRange{Start: 3, End: 3}})
+	suite.Require().NoError(err)
+	suite.Require().Len(txs, 1)
+
+	// Indexing a tx again replaces its code and error message
+	indexTx(2, 0, "")
+	txs, err = GetFailedTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{})
+	suite.Require().NoError(err)
+	suite.Require().Len(txs, 1)
+	suite.Assert().Equal("hash3", txs[0].Hash)
+
+	txs, err = GetTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{})
+	suite.Require().NoError(err)
+	suite.Assert().Len(txs, 3)
+}
+
+func (suite *DBTestSuite) TestBlockHashAndSize() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+
+	// Block events indexed first leave a row the tx indexer fills in
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 1, time.Time{}), "block 1")
+	suite.Require().NoError(err)
+
+	block, txs := mockTxBlock(chainID, 1, blockTime)
+	block.BlockHash = "ABCDEF"
+	block.BlockSizeBytes = 1234
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	stored, err := GetBlockByHash(context.Background(), suite.db, chain, " abcdef ")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), stored.Height)
+	suite.Assert().Equal(int64(1234), stored.BlockSizeBytes)
+	suite.Assert().Equal("testchainaddress", stored.ProposerConsAddress.Address)
+
+	_, err = GetBlockByHash(context.Background(), suite.db, chain, "012345")
+	suite.Assert().ErrorIs(err, gorm.ErrRecordNotFound)
+
+	// Another block at the same height is a reorg and replaces it
+	block, txs = mockTxBlock(chainID, 1, blockTime)
+	block.BlockHash = "012345"
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	_, err = GetBlockByHash(context.Background(), suite.db, chain, "ABCDEF")
+	suite.Assert().ErrorIs(err, gorm.ErrRecordNotFound)
+	stored, err = GetBlockByHash(context.Background(), suite.db, chain, "012345")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), stored.Height)
+}
+
+func (suite *DBTestSuite) TestIndexNewBlockReorg() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	mockReorgBlock := func(hash string, txHashes ...string) (models.Block, []TxDBWrapper) {
+		block, _ := mockTxBlock(chainID, 5, blockTime)
+		block.BlockHash = hash
+
+		var txs []TxDBWrapper
+		for _, txHash := range txHashes {
+			txs = append(txs, TxDBWrapper{
+				Tx: models.Tx{
+					Hash:            txHash,
+					Memo:            hash,
+					SignerAddresses: []models.Address{{Address: "alice"}},
+					Fees:            []models.Fee{{Amount: decimal.NewFromInt(100), Denomination: models.Denom{Base: "uatom"}, PayerAddress: models.Address{Address: "alice"}}},
+				},
+				Messages: []MessageDBWrapper{{
+					Message: models.Message{MessageType: sendType},
+					MessageEvents: []MessageEventDBWrapper{{
+						MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}},
+						Attributes:   []models.MessageEventAttribute{{Value: txHash, MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "amount"}}},
+					}},
+				}},
+				UniqueMessageTypes:         map[string]models.MessageType{sendType.MessageType: sendType},
+				UniqueMessageEventTypes:    map[string]models.MessageEventType{"transfer": {Type: "transfer"}},
+				UniqueMessageAttributeKeys: map[string]models.MessageEventAttributeKey{"amount": {Key: "amount"}},
+			})
+		}
+		return block, txs
+	}
+	countRows := func(model interface{}) int64 {
+		var count int64
+		suite.Require().NoError(suite.db.Model(model).Count(&count).Error)
+		return count
+	}
+
+	blockEvents := mockBlockEventsDBWrapper(chainID, 5, blockTime)
+	blockEvents.Block.BlockHash = "AAAA"
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, blockEvents, "block 5")
+	suite.Require().NoError(err)
+
+	block, txs := mockReorgBlock("AAAA", "TXA1", "TXA2")
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Require().Equal(int64(2), countRows(&models.Tx{}))
+	suite.Require().Equal(int64(1), countRows(&models.BlockEvent{}))
+
+	// The same height with another hash replaces everything indexed for the first version
+	block, txs = mockReorgBlock("BBBB", "TXA2", "TXB1")
+	indexedBlock, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	var storedBlock models.Block
+	suite.Require().NoError(suite.db.First(&storedBlock, indexedBlock.ID).Error)
+	suite.Assert().Equal("BBBB", storedBlock.BlockHash)
+	suite.Assert().True(storedBlock.TxIndexed)
+	suite.Assert().False(storedBlock.BlockEventsIndexed)
+	suite.Assert().Equal(int64(1), countRows(&models.Block{}))
+
+	var storedTxs []models.Tx
+	suite.Require().NoError(suite.db.Order("hash").Find(&storedTxs).Error)
+	suite.Require().Len(storedTxs, 2)
+	suite.Assert().Equal("TXA2", storedTxs[0].Hash)
+	suite.Assert().Equal("TXB1", storedTxs[1].Hash)
+	for _, tx := range storedTxs {
+		suite.Assert().Equal(indexedBlock.ID, tx.BlockID)
+		suite.Assert().Equal("BBBB", tx.Memo)
+	}
+
+	var attributes []models.MessageEventAttribute
+	suite.Require().NoError(suite.db.Order("value").Find(&attributes).Error)
+	suite.Require().Len(attributes, 2)
+	suite.Assert().Equal("TXA2", attributes[0].Value)
+	suite.Assert().Equal("TXB1", attributes[1].Value)
+	suite.Assert().Equal(int64(2), countRows(&models.Message{}))
+	suite.Assert().Equal(int64(2), countRows(&models.MessageEvent{}))
+	suite.Assert().Equal(int64(2), countRows(&models.Fee{}))
+	suite.Assert().Zero(countRows(&models.BlockEvent{}))
+	suite.Assert().Zero(countRows(&models.BlockEventAttribute{}))
+
+	// Block events of yet another version replace the txs in turn
+	blockEvents = mockBlockEventsDBWrapper(chainID, 5, blockTime)
+	blockEvents.Block.BlockHash = "CCCC"
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, blockEvents, "block 5")
+	suite.Require().NoError(err)
+
+	storedBlock = models.Block{}
+	suite.Require().NoError(suite.db.First(&storedBlock, indexedBlock.ID).Error)
+	suite.Assert().Equal("CCCC", storedBlock.BlockHash)
+	suite.Assert().False(storedBlock.TxIndexed)
+	suite.Assert().True(storedBlock.BlockEventsIndexed)
+	suite.Assert().Zero(countRows(&models.Tx{}))
+	suite.Assert().Zero(countRows(&models.Message{}))
+	suite.Assert().Equal(int64(1), countRows(&models.BlockEvent{}))
+}
+
+func (suite *DBTestSuite) TestGetTxThroughput() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	dayOne := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	dayTwo := dayOne.AddDate(0, 0, 1)
+	indexTxs := func(height int64, blockTime time.Time, txCount int) {
+		block, _ := mockTxBlock(chainID, height, blockTime)
+		txs := make([]TxDBWrapper, txCount)
+		for i := range txs {
+			txs[i].Tx.Hash = fmt.Sprintf("hash%d-%d", height, i)
+		}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	indexTxs(1, dayOne.Add(time.Hour), 2)
+	indexTxs(2, dayOne.Add(23*time.Hour), 1)
+	indexTxs(3, dayTwo.Add(time.Hour), 0)
+	indexTxs(4, dayTwo.Add(2*time.Hour), 4)
+
+	// Blocks whose txs were not indexed are left out
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 5, dayTwo.Add(3*time.Hour)), "block 5")
+	suite.Require().NoError(err)
+
+	var block models.Block
+	suite.Require().NoError(suite.db.Where("height = ?", 1).First(&block).Error)
+	suite.Assert().Equal(int64(2), block.TxCount)
+
+	throughput, err := GetTxThroughput(context.Background(), suite.db, chain, dayOne, dayTwo.AddDate(0, 0, 1))
+	suite.Require().NoError(err)
+	suite.Require().Len(throughput, 2)
+	suite.Assert().True(throughput[0].Day.Equal(dayOne))
+	suite.Assert().Equal(int64(2), throughput[0].BlockCount)
+	suite.Assert().Equal(int64(3), throughput[0].TxCount)
+	suite.Assert().True(throughput[1].Day.Equal(dayTwo))
+	suite.Assert().Equal(int64(2), throughput[1].BlockCount)
+	suite.Assert().Equal(int64(4), throughput[1].TxCount)
+
+	// The range end is exclusive
+	throughput, err = GetTxThroughput(context.Background(), suite.db, chain, dayOne, dayTwo)
+	suite.Require().NoError(err)
+	suite.Require().Len(throughput, 1)
+
+	_, err = GetTxThroughput(context.Background(), suite.db, chain, dayTwo, dayOne)
+	suite.Assert().Error(err)
+
+	// Indexing a block again corrects its count
+	indexTxs(4, dayTwo.Add(2*time.Hour), 5)
+	throughput, err = GetTxThroughput(context.Background(), suite.db, chain, dayTwo, dayTwo.AddDate(0, 0, 1))
+	suite.Require().NoError(err)
+	suite.Require().Len(throughput, 1)
+	suite.Assert().Equal(int64(5), throughput[0].TxCount)
+
+	// The migration counts the txs of blocks indexed before the column existed
+	suite.Require().NoError(suite.db.Model(&models.Block{}).Where("1 = 1").Update("tx_count", 0).Error)
+	suite.Require().NoError(addBlockTxCount(suite.db))
+	block = models.Block{}
+	suite.Require().NoError(suite.db.Where("height = ?", 4).First(&block).Error)
+	suite.Assert().Equal(int64(5), block.TxCount)
+}
+
+func (suite *DBTestSuite) TestValidatorUptime() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	signaturesConfig := config.IndexConfig{}
+	signaturesConfig.Flags.IndexBlockSignatures = true
+	indexSignatures := func(height int64, indexerConfig config.IndexConfig, signed map[string]bool) {
+		block, txs := mockTxBlock(chainID, height, blockTime)
+		for _, consAddress := range []string{"valcons-a", "valcons-b", "valcons-c"} {
+			if signedBlock, ok := signed[consAddress]; ok {
+				block.Signatures = append(block.Signatures, models.BlockSignature{Validator: models.Validator{ConsAddress: consAddress}, Signed: signedBlock})
+			}
+		}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, indexerConfig)
+		suite.Require().NoError(err)
+	}
+
+	// The operator address and moniker are kept when blocks reference the validator
+	_, err = UpsertValidator(context.Background(), suite.db, models.Validator{ChainID: chainID, ConsAddress: "valcons-a", OperatorAddress: "valoper-a", Moniker: "alpha"})
+	suite.Require().NoError(err)
+
+	indexSignatures(1, signaturesConfig, map[string]bool{"valcons-a": true, "valcons-b": true})
+	indexSignatures(2, signaturesConfig, map[string]bool{"valcons-a": true, "valcons-b": false})
+	indexSignatures(3, signaturesConfig, map[string]bool{"valcons-a": true, "valcons-c": true})
+	// Without the flag no signatures are stored and the block does not count
+	indexSignatures(4, config.IndexConfig{}, map[string]bool{"valcons-a": false, "valcons-b": false})
+
+	var block models.Block
+	suite.Require().NoError(suite.db.Preload("ProposerValidator").Where("height = ?", 4).First(&block).Error)
+	suite.Require().NotNil(block.ProposerValidator)
+	suite.Assert().Equal("testchainaddress", block.ProposerValidator.ConsAddress)
+
+	uptimes, err := GetValidatorUptime(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(uptimes, 3)
+	suite.Assert().Equal("valcons-a", uptimes[0].ConsAddress)
+	suite.Assert().Equal("alpha", uptimes[0].Moniker)
+	suite.Assert().Equal("valoper-a", uptimes[0].OperatorAddress)
+	suite.Assert().Equal(int64(3), uptimes[0].SignedBlocks)
+	suite.Assert().Zero(uptimes[0].MissedBlocks)
+	suite.Assert().Equal(1.0, uptimes[0].Uptime)
+	// A nil vote and an absence are both missed
+	suite.Assert().Equal("valcons-b", uptimes[1].ConsAddress)
+	suite.Assert().Equal(int64(1), uptimes[1].SignedBlocks)
+	suite.Assert().Equal(int64(2), uptimes[1].MissedBlocks)
+	suite.Assert().InDelta(1.0/3, uptimes[1].Uptime, 1e-9)
+	suite.Assert().Equal("valcons-c", uptimes[2].ConsAddress)
+	suite.Assert().Equal(int64(1), uptimes[2].SignedBlocks)
+
+	uptimes, err = GetValidatorUptime(context.Background(), suite.db, chain, HeightRange{Start: 2, End: 2})
+	suite.Require().NoError(err)
+	suite.Require().Len(uptimes, 2)
+	suite.Assert().Zero(uptimes[1].SignedBlocks)
+	suite.Assert().Equal(int64(1), uptimes[1].MissedBlocks)
+
+	uptimes, err = GetValidatorUptime(context.Background(), suite.db, chain, HeightRange{Start: 4, End: OpenEnd})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(uptimes)
+
+	// Reindexing a block updates its signatures
+	indexSignatures(2, signaturesConfig, map[string]bool{"valcons-a": true, "valcons-b": true})
+	uptimes, err = GetValidatorUptime(context.Background(), suite.db, chain, HeightRange{Start: 2, End: 2})
+	suite.Require().NoError(err)
+	suite.Require().Len(uptimes, 2)
+	suite.Assert().Equal(int64(1), uptimes[1].SignedBlocks)
+
+	_, err = UpsertValidator(context.Background(), suite.db, models.Validator{ConsAddress: "valcons-d"})
+	suite.Assert().Error(err)
+}
+
+func (suite *DBTestSuite) TestIndexBlockEventsConcurrently() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	keys := []string{"amount", "recipient", "sender", "spender"}
+	errs := make([]error, 4)
+	var wg sync.WaitGroup
+	for i := range errs {
+		blockDBWrapper := mockBlockEventsDBWrapper(chainID, int64(i+1), time.Now())
+		blockDBWrapper.UniqueBlockEventTypes["coin_spent"] = models.BlockEventType{Type: "coin_spent"}
+		for index, key := range keys {
+			blockDBWrapper.BeginBlockEvents[0].Attributes = append(blockDBWrapper.BeginBlockEvents[0].Attributes, models.BlockEventAttribute{
+				Index:                  uint64(index),
+				Value:                  "value",
+				BlockEventAttributeKey: models.BlockEventAttributeKey{Key: key},
+			})
+			blockDBWrapper.UniqueBlockEventAttributeKeys[key] = models.BlockEventAttributeKey{Key: key}
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = IndexBlockEvents(context.Background(), suite.db, false, blockDBWrapper, fmt.Sprintf("block %d", i+1))
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		suite.Require().NoError(err)
+	}
+
+	var attributeKeys []models.BlockEventAttributeKey
+	suite.Require().NoError(suite.db.Order("key").Find(&attributeKeys).Error)
+	suite.Require().Len(attributeKeys, len(keys))
+
+	var eventTypes []models.BlockEventType
+	suite.Require().NoError(suite.db.Order("type").Find(&eventTypes).Error)
+	suite.Require().Len(eventTypes, 2)
+
+	// Every attribute references the single row of its key
+	var mismatched int64
+	suite.Require().NoError(suite.db.Model(&models.BlockEventAttribute{}).
+		Where("block_event_attribute_key_id NOT IN ?", []uint{attributeKeys[0].ID, attributeKeys[1].ID, attributeKeys[2].ID, attributeKeys[3].ID}).
+		Count(&mismatched).Error)
+	suite.Assert().Zero(mismatched)
+}
+
+func (suite *DBTestSuite) TestUniqueBlockEventLookups() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	blockDBWrapper, err := IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 1, time.Now()), "block 1")
+	suite.Require().NoError(err)
+	amountKey := blockDBWrapper.UniqueBlockEventAttributeKeys["amount"]
+
+	// A database that lost the unique index stored a key twice
+	suite.Require().NoError(suite.db.Migrator().DropIndex(&models.BlockEventAttributeKey{}, "Key"))
+	duplicateKeys := []models.BlockEventAttributeKey{{Key: "amount"}, {Key: "sender"}}
+	suite.Require().NoError(suite.db.Create(&duplicateKeys).Error)
+
+	attribute := models.BlockEventAttribute{BlockEventID: blockDBWrapper.BeginBlockEvents[0].BlockEvent.ID, Value: "1uatom", BlockEventAttributeKeyID: duplicateKeys[0].ID}
+	suite.Require().NoError(suite.db.Omit(clause.Associations).Create(&attribute).Error)
+
+	suite.Require().NoError(uniqueBlockEventLookups(suite.db))
+	suite.Assert().True(suite.db.Migrator().HasIndex(&models.BlockEventAttributeKey{}, "Key"))
+
+	var attributeKeys []models.BlockEventAttributeKey
+	suite.Require().NoError(suite.db.Order("id").Find(&attributeKeys).Error)
+	suite.Require().Len(attributeKeys, 2)
+	suite.Assert().Equal(amountKey.ID, attributeKeys[0].ID)
+	suite.Assert().Equal("sender", attributeKeys[1].Key)
+
+	suite.Require().NoError(suite.db.First(&attribute, attribute.ID).Error)
+	suite.Assert().Equal(amountKey.ID, attribute.BlockEventAttributeKeyID)
+
+	// Databases with the indexes are left alone
+	suite.Require().NoError(uniqueBlockEventLookups(suite.db))
+}
+
+func mockBlockEventsDBWrapper(chainID uint, height int64, timeStamp time.Time) *BlockDBWrapper {
+	return &BlockDBWrapper{
+		Block: &models.Block{
+			Height:              height,
+			ChainID:             chainID,
+			TimeStamp:           timeStamp,
+			ProposerConsAddress: models.Address{Address: "testchainaddress"},
+		},
+		BeginBlockEvents: []BlockEventDBWrapper{
+			{
+				BlockEvent: models.BlockEvent{
+					Index:             0,
+					LifecyclePosition: models.BeginBlockEvent,
+					BlockEventType:    models.BlockEventType{Type: "transfer"},
+				},
+			},
+		},
+		UniqueBlockEventTypes:         map[string]models.BlockEventType{"transfer": {Type: "transfer"}},
+		UniqueBlockEventAttributeKeys: map[string]models.BlockEventAttributeKey{"amount": {Key: "amount"}},
+	}
+}
+
+func mockTxBlock(chainID uint, height int64, timeStamp time.Time) (models.Block, []TxDBWrapper) {
+	block := models.Block{
+		Height:              height,
+		ChainID:             chainID,
+		TimeStamp:           timeStamp,
+		ProposerConsAddress: models.Address{Address: "testchainaddress"},
+	}
+
+	txs := []TxDBWrapper{
+		{
+			Tx: models.Tx{Hash: fmt.Sprintf("hash%d", height)},
+		},
+	}
+
+	return block, txs
+}
+
+func (suite *DBTestSuite) TestIndexManyAttributes() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	// Enough rows that a single insert would exceed the bind parameter limit of PostgreSQL and SQLite
+	const attributeCount = 10000
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+
+	block, txs := mockTxBlock(chainID, 1, blockTime)
+	messageAttributes := make([]models.MessageEventAttribute, attributeCount)
+	for i := range messageAttributes {
+		messageAttributes[i] = models.MessageEventAttribute{
+			Index:                    uint64(i),
+			Value:                    fmt.Sprintf("value%d", i),
+			MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "recipient"},
+		}
+	}
+	txs[0].Messages = []MessageDBWrapper{{
+		Message: models.Message{MessageType: models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}},
+		MessageEvents: []MessageEventDBWrapper{{
+			MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}},
+			Attributes:   messageAttributes,
+		}},
+	}}
+	txs[0].UniqueMessageTypes = map[string]models.MessageType{"/cosmos.bank.v1beta1.MsgSend": {MessageType: "/cosmos.bank.v1beta1.MsgSend"}}
+	txs[0].UniqueMessageEventTypes = map[string]models.MessageEventType{"transfer": {Type: "transfer"}}
+	txs[0].UniqueMessageAttributeKeys = map[string]models.MessageEventAttributeKey{"recipient": {Key: "recipient"}}
+
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	var storedMessageAttributes int64
+	suite.Require().NoError(suite.db.Model(&models.MessageEventAttribute{}).Count(&storedMessageAttributes).Error)
+	suite.Assert().Equal(int64(attributeCount), storedMessageAttributes)
+
+	blockEvents := mockBlockEventsDBWrapper(chainID, 1, blockTime)
+	blockEvents.BeginBlockEvents[0].Attributes = make([]models.BlockEventAttribute, attributeCount)
+	for i := range blockEvents.BeginBlockEvents[0].Attributes {
+		blockEvents.BeginBlockEvents[0].Attributes[i] = models.BlockEventAttribute{
+			Index:                  uint64(i),
+			Value:                  fmt.Sprintf("%dstake", i),
+			BlockEventAttributeKey: models.BlockEventAttributeKey{Key: "amount"},
+		}
+	}
+
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, blockEvents, "block 1")
+	suite.Require().NoError(err)
+
+	var storedBlockAttributes int64
+	suite.Require().NoError(suite.db.Model(&models.BlockEventAttribute{}).Count(&storedBlockAttributes).Error)
+	suite.Assert().Equal(int64(attributeCount), storedBlockAttributes)
+}
+
+// mockEventsBlock returns a block with txs of one send message, each with events of attributes
+func mockEventsBlock(chainID uint, height int64, timeStamp time.Time, txCount int, eventCount int, attributeCount int) BlockTxsDBWrapper {
+	block, _ := mockTxBlock(chainID, height, timeStamp)
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+
+	txs := make([]TxDBWrapper, txCount)
+	for i := range txs {
+		events := make([]MessageEventDBWrapper, eventCount)
+		for j := range events {
+			attributes := make([]models.MessageEventAttribute, attributeCount)
+			for k := range attributes {
+				attributes[k] = models.MessageEventAttribute{
+					Index:                    uint64(k),
+					Value:                    fmt.Sprintf("value%d", k),
+					MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "recipient"},
+				}
+			}
+			events[j] = MessageEventDBWrapper{
+				MessageEvent: models.MessageEvent{Index: uint64(j), MessageEventType: models.MessageEventType{Type: "transfer"}},
+				Attributes:   attributes,
+			}
+		}
+
+		txs[i] = TxDBWrapper{
+			Tx:                         models.Tx{Hash: fmt.Sprintf("hash%d-%d", height, i)},
+			Messages:                   []MessageDBWrapper{{Message: models.Message{MessageType: sendType}, MessageEvents: events}},
+			UniqueMessageTypes:         map[string]models.MessageType{sendType.MessageType: sendType},
+			UniqueMessageEventTypes:    map[string]models.MessageEventType{"transfer": {Type: "transfer"}},
+			UniqueMessageAttributeKeys: map[string]models.MessageEventAttributeKey{"recipient": {Key: "recipient"}},
+		}
+	}
+
+	return BlockTxsDBWrapper{Block: block, Txs: txs}
+}
+
+func (suite *DBTestSuite) TestCopyInserts() {
+	suite.requirePostgres()
+	suite.Require().NoError(suite.db.Use(copyInserts{}))
+	suite.Require().NoError(MigrateModels(suite.db))
+	suite.Require().True(copyInsertsEnabled(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	batch := []BlockTxsDBWrapper{mockEventsBlock(chainID, 1, blockTime, 2, 3, 4), mockEventsBlock(chainID, 2, blockTime, 2, 3, 4)}
+	reindexBatch := []BlockTxsDBWrapper{CloneBlockTxsDBWrapper(batch[0]), CloneBlockTxsDBWrapper(batch[1])}
+
+	blocks, err := IndexNewBlocks(context.Background(), suite.db, batch, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	countRows := func() (int64, int64) {
+		var events, attributes int64
+		suite.Require().NoError(suite.db.Model(&models.MessageEvent{}).Count(&events).Error)
+		suite.Require().NoError(suite.db.Model(&models.MessageEventAttribute{}).Count(&attributes).Error)
+		return events, attributes
+	}
+	events, attributes := countRows()
+	suite.Assert().Equal(int64(12), events)
+	suite.Assert().Equal(int64(48), attributes)
+
+	var stored models.MessageEventAttribute
+	attribute := blocks[1].Txs[1].Messages[0].MessageEvents[2].Attributes[3]
+	suite.Require().NotZero(attribute.ID)
+	suite.Require().NoError(suite.db.First(&stored, attribute.ID).Error)
+	suite.Assert().Equal("value3", stored.Value)
+	suite.Assert().Equal(blocks[1].Txs[1].Messages[0].MessageEvents[2].MessageEvent.ID, stored.MessageEventID)
+	suite.Assert().Equal(int64(2), stored.Height)
+
+	// Reindexing merges into the existing rows
+	reindexBatch[1].Txs[1].Messages[0].MessageEvents[2].Attributes[3].Value = "updated"
+	reindexed, err := IndexNewBlocks(context.Background(), suite.db, reindexBatch, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	events, attributes = countRows()
+	suite.Assert().Equal(int64(12), events)
+	suite.Assert().Equal(int64(48), attributes)
+
+	reindexedAttribute := reindexed[1].Txs[1].Messages[0].MessageEvents[2].Attributes[3]
+	suite.Assert().Equal(attribute.ID, reindexedAttribute.ID)
+	suite.Require().NoError(suite.db.First(&stored, attribute.ID).Error)
+	suite.Assert().Equal("updated", stored.Value)
+
+	// Sessions already in a transaction fall back to batched INSERTs
+	suite.Require().NoError(suite.db.Transaction(func(dbTransaction *gorm.DB) error {
+		suite.Assert().False(copyInsertsEnabled(dbTransaction))
+		_, err := IndexNewBlocks(context.Background(), dbTransaction, []BlockTxsDBWrapper{mockEventsBlock(chainID, 3, blockTime, 1, 1, 1)}, config.IndexConfig{})
+		return err
+	}))
+}
+
+func (suite *DBTestSuite) TestReindexReplace() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	parse := func(messageCount int) BlockTxsDBWrapper {
+		block := mockEventsBlock(chainID, 1, blockTime, 1, 2, 2)
+		messages := block.Txs[0].Messages
+		for i := 1; i < messageCount; i++ {
+			message := CloneBlockTxsDBWrapper(block).Txs[0].Messages[0]
+			message.Message.MessageIndex = i
+			messages = append(messages, message)
+		}
+		block.Txs[0].Messages = messages
+		block.Txs[0].Tx.Fees = []models.Fee{{Amount: decimal.NewFromInt(100), Denomination: models.Denom{Base: "uatom"}, PayerAddress: models.Address{Address: "alice"}}}
+		return block
+	}
+	countRows := func() []int64 {
+		counts := make([]int64, 4)
+		for i, model := range []interface{}{&models.Message{}, &models.MessageEvent{}, &models.MessageEventAttribute{}, &models.Fee{}} {
+			suite.Require().NoError(suite.db.Model(model).Count(&counts[i]).Error)
+		}
+		return counts
+	}
+	reindex := func(messageCount int, replace bool) {
+		block := parse(messageCount)
+		var indexerConfig config.IndexConfig
+		indexerConfig.Base.ReindexReplace = replace
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, indexerConfig)
+		suite.Require().NoError(err)
+	}
+
+	reindex(3, false)
+	suite.Assert().Equal([]int64{3, 6, 12, 1}, countRows())
+
+	// Upserting a parse with fewer messages leaves the stale ones behind
+	reindex(2, false)
+	suite.Assert().Equal([]int64{3, 6, 12, 1}, countRows())
+
+	// Replacing the block leaves exactly the latest parse
+	reindex(1, true)
+	suite.Assert().Equal([]int64{1, 2, 4, 1}, countRows())
+
+	var txs int64
+	suite.Require().NoError(suite.db.Model(&models.Tx{}).Count(&txs).Error)
+	suite.Assert().Equal(int64(1), txs)
+}
+
+func (suite *DBTestSuite) TestIndexTxFailures() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	index := func(failures bool) models.Block {
+		block := mockEventsBlock(chainID, 1, blockTime, 1, 1, 1)
+		if failures {
+			block.Block.FailedTxs = []models.FailedTx{{Hash: "undecodable", Error: "unable to resolve type URL", TxBytes: []byte{1, 2, 3}}}
+			block.Txs[0].FailedMessages = []models.FailedMessage{{MessageIndex: 1, Error: "no concrete type registered", TypeURL: "/unknown.v1.MsgUnknown", MessageBytes: []byte{4, 5}}}
+		}
+		indexed, _, err := IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+		return indexed
+	}
+
+	// The decoded tx is indexed alongside the failures and the block is marked as partially indexed
+	block := index(true)
+	suite.Assert().True(block.TxPartiallyIndexed)
+
+	var stored models.Block
+	suite.Require().NoError(suite.db.First(&stored, block.ID).Error)
+	suite.Assert().True(stored.TxIndexed)
+	suite.Assert().True(stored.TxPartiallyIndexed)
+
+	var txs int64
+	suite.Require().NoError(suite.db.Model(&models.Tx{}).Count(&txs).Error)
+	suite.Assert().Equal(int64(1), txs)
+
+	failedTxs, err := GetFailedTxs(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(failedTxs, 1)
+	suite.Assert().Equal("undecodable", failedTxs[0].Hash)
+	suite.Assert().Equal(block.ID, failedTxs[0].BlockID)
+	suite.Assert().Equal(int64(1), failedTxs[0].Block.Height)
+	suite.Assert().Equal([]byte{1, 2, 3}, failedTxs[0].TxBytes)
+
+	failedMessages, err := GetFailedMessages(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(failedMessages, 1)
+	suite.Assert().Equal(1, failedMessages[0].MessageIndex)
+	suite.Assert().Equal("/unknown.v1.MsgUnknown", failedMessages[0].TypeURL)
+	suite.Assert().Equal(int64(1), failedMessages[0].Tx.Block.Height)
+
+	// The upserts update the recorded failures in place
+	failedTx := failedTxs[0]
+	failedTx.Error = "still undecodable"
+	suite.Require().NoError(UpsertFailedTx(context.Background(), suite.db, &models.FailedTx{Hash: failedTx.Hash, BlockID: failedTx.BlockID, Error: failedTx.Error}))
+	failedMessage := failedMessages[0]
+	suite.Require().NoError(UpsertFailedMessage(context.Background(), suite.db, &models.FailedMessage{TxID: failedMessage.TxID, MessageIndex: 1, Error: "still unregistered", TypeURL: failedMessage.TypeURL}))
+
+	failedTxs, err = GetFailedTxs(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(failedTxs, 1)
+	suite.Assert().Equal("still undecodable", failedTxs[0].Error)
+	suite.Assert().Empty(failedTxs[0].TxBytes)
+	failedMessages, err = GetFailedMessages(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(failedMessages, 1)
+	suite.Assert().Equal("still unregistered", failedMessages[0].Error)
+
+	// Reindexing the block once everything decodes clears the failures and the flag
+	block = index(false)
+	suite.Assert().False(block.TxPartiallyIndexed)
+	suite.Require().NoError(suite.db.First(&stored, block.ID).Error)
+	suite.Assert().False(stored.TxPartiallyIndexed)
+
+	failedTxs, err = GetFailedTxs(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Empty(failedTxs)
+	failedMessages, err = GetFailedMessages(context.Background(), suite.db, chain, HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Empty(failedMessages)
+}
+
+func (suite *DBTestSuite) TestPurgeChainData() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	otherChainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "otherchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	for height := int64(1); height <= 3; height++ {
+		block := mockEventsBlock(chainID, height, blockTime, 1, 1, 1)
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+	blockEvents := mockBlockEventsDBWrapper(chainID, 1, blockTime)
+	blockEvents.BeginBlockEvents[0].Attributes = []models.BlockEventAttribute{{Value: "1stake", BlockEventAttributeKey: models.BlockEventAttributeKey{Key: "amount"}}}
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, blockEvents, "block 1")
+	suite.Require().NoError(err)
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 5, "testchain-1", "", StageFetch, errors.New("rpc unavailable")))
+
+	// The other chain shares the message dictionaries and the proposer address
+	otherBlock := mockEventsBlock(otherChainID, 10, blockTime, 1, 1, 1)
+	_, _, err = IndexNewBlock(context.Background(), suite.db, otherBlock.Block, otherBlock.Txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	countRows := func() []int64 {
+		counts := make([]int64, 5)
+		for i, model := range []interface{}{&models.Block{}, &models.Tx{}, &models.MessageEventAttribute{}, &models.BlockEvent{}, &models.FailedBlock{}} {
+			suite.Require().NoError(suite.db.Model(model).Count(&counts[i]).Error)
+		}
+		return counts
+	}
+	suite.Require().Equal([]int64{4, 4, 4, 1, 1}, countRows())
+
+	_, err = PurgeChainData(context.Background(), suite.db, chainID, PurgeOptions{ConfirmChainID: "otherchain-1"})
+	suite.Assert().ErrorIs(err, ErrPurgeNotConfirmed)
+	suite.Assert().Equal([]int64{4, 4, 4, 1, 1}, countRows())
+
+	dryRun, err := PurgeChainData(context.Background(), suite.db, chainID, PurgeOptions{ConfirmChainID: "testchain-1", DryRun: true})
+	suite.Require().NoError(err)
+	suite.Assert().True(dryRun.DryRun)
+	suite.Assert().Equal([]int64{4, 4, 4, 1, 1}, countRows())
+	suite.Assert().Equal(int64(3), dryRun.Rows("blocks"))
+	suite.Assert().Equal(int64(3), dryRun.Rows("txes"))
+	suite.Assert().Equal(int64(3), dryRun.Rows("message_event_attributes"))
+	suite.Assert().Equal(int64(1), dryRun.Rows("block_event_attributes"))
+	suite.Assert().Equal(int64(1), dryRun.Rows("failed_blocks"))
+	suite.Assert().Equal(int64(1), dryRun.Rows("chains"))
+	suite.Assert().Equal(int64(1), dryRun.Rows("block_event_types"))
+	suite.Assert().Equal(int64(0), dryRun.Rows("message_types"))
+	suite.Assert().Equal(int64(0), dryRun.Rows("addresses"))
+
+	keepDictionaries, err := PurgeChainData(context.Background(), suite.db, chainID, PurgeOptions{ConfirmChainID: "testchain-1", DryRun: true, KeepDictionaries: true})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(0), keepDictionaries.Rows("block_event_types"))
+
+	// Chunks smaller than the chain delete the same rows the dry run counted
+	purged, err := PurgeChainData(context.Background(), suite.db, chainID, PurgeOptions{ConfirmChainID: "testchain-1", ChunkSize: 2})
+	suite.Require().NoError(err)
+	suite.Assert().False(purged.DryRun)
+	suite.Assert().Equal(dryRun.Tables, purged.Tables)
+	suite.Assert().Equal([]int64{1, 1, 1, 0, 0}, countRows())
+
+	var messageTypes, blockEventTypes int64
+	suite.Require().NoError(suite.db.Model(&models.MessageType{}).Count(&messageTypes).Error)
+	suite.Require().NoError(suite.db.Model(&models.BlockEventType{}).Count(&blockEventTypes).Error)
+	suite.Assert().Equal(int64(1), messageTypes)
+	suite.Assert().Equal(int64(0), blockEventTypes)
+
+	chain, err := GetChainByChainID(context.Background(), suite.db, "testchain-1")
+	suite.Require().NoError(err)
+	suite.Assert().Zero(chain.ID)
+
+	var remaining models.Block
+	suite.Require().NoError(suite.db.First(&remaining).Error)
+	suite.Assert().Equal(otherChainID, remaining.ChainID)
+}
+
+func (suite *DBTestSuite) TestPruneBefore() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	index := func(height int64) {
+		block := mockEventsBlock(chainID, height, blockTime.Add(time.Duration(height)*time.Hour), 1, 1, 1)
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+		blockEvents := mockBlockEventsDBWrapper(chainID, height, block.Block.TimeStamp)
+		_, err = IndexBlockEvents(context.Background(), suite.db, false, blockEvents, fmt.Sprintf("block %d", height))
+		suite.Require().NoError(err)
+	}
+	for height := int64(1); height <= 4; height++ {
+		index(height)
+	}
+
+	_, err = PruneBefore(context.Background(), suite.db, chain, PruneThreshold{}, 1)
+	suite.Assert().ErrorIs(err, ErrPruneThresholdUnset)
+
+	pruned, err := PruneBefore(context.Background(), suite.db, chain, PruneThreshold{Height: 3}, 1)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(2), pruned)
+
+	countRows := func() []int64 {
+		counts := make([]int64, 4)
+		for i, model := range []interface{}{&models.Block{}, &models.Tx{}, &models.MessageEventAttribute{}, &models.BlockEvent{}} {
+			suite.Require().NoError(suite.db.Model(model).Count(&counts[i]).Error)
+		}
+		return counts
+	}
+	suite.Assert().Equal([]int64{4, 2, 2, 2}, countRows())
+
+	var blocks []models.Block
+	suite.Require().NoError(suite.db.Order("height").Find(&blocks).Error)
+	for _, block := range blocks {
+		suite.Assert().Equal(block.Height < 3, block.Pruned, "height %d", block.Height)
+		suite.Assert().Equal(block.Height >= 3, block.TxIndexed, "height %d", block.Height)
+		suite.Assert().Equal(block.Height >= 3, block.BlockEventsIndexed, "height %d", block.Height)
+	}
+
+	// Pruned heights are not gaps and are not pruned again
+	requirements := CompletenessRequirements{Transactions: true, BlockEvents: true}
+	gaps, err := GetMissingBlockRanges(context.Background(), suite.db, chain, HeightRange{Start: 1, End: 4}, requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(gaps)
+
+	report, err := GetCompletenessReport(context.Background(), suite.db, chain, HeightRange{Start: 1, End: 4}, requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(4), report.FullyIndexed)
+	suite.Assert().Equal(int64(2), report.Pruned)
+
+	pruned, err = PruneBefore(context.Background(), suite.db, chain, PruneThreshold{Height: 3}, 1)
+	suite.Require().NoError(err)
+	suite.Assert().Zero(pruned)
+
+	// Blocks are only pruned when they are below the height and older than the time
+	pruned, err = PruneBefore(context.Background(), suite.db, chain, PruneThreshold{Height: 5, Time: blockTime.Add(3*time.Hour + time.Minute)}, 10)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), pruned)
+	suite.Assert().Equal([]int64{4, 1, 1, 1}, countRows())
+
+	// Indexing a pruned block again clears the flag
+	index(1)
+	var reindexed models.Block
+	suite.Require().NoError(suite.db.Where("height = ?", 1).First(&reindexed).Error)
+	suite.Assert().False(reindexed.Pruned)
+	suite.Assert().True(reindexed.TxIndexed)
+	suite.Assert().True(reindexed.BlockEventsIndexed)
+}
+
+func (suite *DBTestSuite) TestDictionaryCache() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	dictionaryInserts := 0
+	failMessages := false
+	suite.Require().NoError(suite.db.Callback().Create().After("gorm:create").Register("test:dictionary_cache", func(db *gorm.DB) {
+		switch db.Statement.Table {
+		case "message_types", "message_event_types", "message_event_attribute_keys":
+			// Not the association saves of the messages, events and attributes, which conflict on the primary key
+			if onConflict, ok := db.Statement.Clauses["ON CONFLICT"].Expression.(clause.OnConflict); ok && len(onConflict.Columns) != 0 {
+				dictionaryInserts++
+			}
+		case "messages":
+			if failMessages {
+				_ = db.AddError(errors.New("messages unavailable"))
+			}
+		}
+	}))
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	index := func(height int64, messageType string) error {
+		block := mockEventsBlock(chainID, height, blockTime, 1, 1, 1)
+		block.Txs[0].Messages[0].Message.MessageType = models.MessageType{MessageType: messageType}
+		block.Txs[0].UniqueMessageTypes = map[string]models.MessageType{messageType: {MessageType: messageType}}
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+		return err
+	}
+
+	suite.Require().NoError(index(1, "/cosmos.bank.v1beta1.MsgSend"))
+	suite.Assert().Equal(3, dictionaryInserts)
+
+	// The values of the first block are cached
+	suite.Require().NoError(index(2, "/cosmos.bank.v1beta1.MsgSend"))
+	suite.Assert().Equal(3, dictionaryInserts)
+
+	// A new value is upserted on its own
+	suite.Require().NoError(index(3, "/cosmos.bank.v1beta1.MsgMultiSend"))
+	suite.Assert().Equal(4, dictionaryInserts)
+
+	// The message type inserted by a rolled back transaction is not cached, and the cache is emptied
+	failMessages = true
+	suite.Require().Error(index(4, "/cosmos.staking.v1beta1.MsgDelegate"))
+	failMessages = false
+	cache := dictionaryCacheOf(suite.db)
+	suite.Require().NotNil(cache)
+	suite.Assert().Zero(cache.messageTypeID("/cosmos.staking.v1beta1.MsgDelegate"))
+	suite.Assert().Zero(cache.messageTypeID("/cosmos.bank.v1beta1.MsgSend"))
+
+	// The existing event type and attribute key are looked up again, only the message type is inserted
+	dictionaryInserts = 0
+	suite.Require().NoError(index(4, "/cosmos.staking.v1beta1.MsgDelegate"))
+	suite.Assert().Equal(1, dictionaryInserts)
+
+	var delegateType models.MessageType
+	suite.Require().NoError(suite.db.Where("message_type = ?", "/cosmos.staking.v1beta1.MsgDelegate").First(&delegateType).Error)
+	suite.Assert().Equal(delegateType.ID, cache.messageTypeID(delegateType.MessageType))
+
+	// Every message references the message type of its block
+	var messages []models.Message
+	suite.Require().NoError(suite.db.Preload("MessageType").Order("height").Find(&messages).Error)
+	suite.Require().Len(messages, 4)
+	for i, messageType := range []string{"/cosmos.bank.v1beta1.MsgSend", "/cosmos.bank.v1beta1.MsgSend", "/cosmos.bank.v1beta1.MsgMultiSend", "/cosmos.staking.v1beta1.MsgDelegate"} {
+		suite.Assert().Equal(messageType, messages[i].MessageType.MessageType)
+	}
+}
+
+func (suite *DBTestSuite) TestFindOrCreateDictionary() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	block := mockEventsBlock(chainID, 1, blockTime, 2, 2, 2)
+	block.Txs[1].Messages[0].MessageEvents[0].Attributes[1].MessageEventAttributeKey = models.MessageEventAttributeKey{Key: "sender"}
+	block.Txs[1].UniqueMessageAttributeKeys["sender"] = models.MessageEventAttributeKey{Key: "sender"}
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	var keys []models.MessageEventAttributeKey
+	suite.Require().NoError(suite.db.Order("id").Find(&keys).Error)
+	suite.Require().Len(keys, 2)
+
+	// Existing and new values resolve to the IDs of their rows
+	var resolved map[string]models.MessageEventAttributeKey
+	suite.Require().NoError(suite.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		resolved, err = findOrCreateDictionary(tx, "key", []string{"recipient", "amount", "sender"},
+			func(value string) models.MessageEventAttributeKey { return models.MessageEventAttributeKey{Key: value} },
+			func(row models.MessageEventAttributeKey) string { return row.Key })
+		return err
+	}))
+	var stored []models.MessageEventAttributeKey
+	suite.Require().NoError(suite.db.Find(&stored).Error)
+	suite.Require().Len(stored, 3)
+	suite.Require().Len(resolved, 3)
+	for _, key := range stored {
+		suite.Assert().Equal(key.ID, resolved[key.Key].ID, key.Key)
+	}
+	amountID := resolved["amount"].ID
+	suite.Assert().Equal(keys[1].ID+1, amountID)
+
+	// Reindexing the block without the cache takes no values of the ID sequences, the next new key gets the next ID
+	dictionaryCacheOf(suite.db).reset()
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+	resolved, err = findOrCreateDictionary(suite.db, "key", []string{"denom"},
+		func(value string) models.MessageEventAttributeKey { return models.MessageEventAttributeKey{Key: value} },
+		func(row models.MessageEventAttributeKey) string { return row.Key })
+	suite.Require().NoError(err)
+	suite.Assert().Equal(amountID+1, resolved["denom"].ID)
+
+	var attributes []models.MessageEventAttribute
+	suite.Require().NoError(suite.db.Preload("MessageEventAttributeKey").Find(&attributes).Error)
+	suite.Require().Len(attributes, 8)
+	for _, attribute := range attributes {
+		suite.Assert().NotEmpty(attribute.MessageEventAttributeKey.Key)
+	}
+}
+
+func (suite *DBTestSuite) TestAcquireChainLock() {
+	suite.requirePostgres()
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	otherChainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "otherchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	// Each lock holds its own connection of the pool, so the second attempt runs in another session
+	lock, err := AcquireChainLock(context.Background(), suite.db, chain)
+	suite.Require().NoError(err)
+
+	_, err = AcquireChainLock(context.Background(), suite.db, chain)
+	var lockedErr *ChainLockedError
+	suite.Require().ErrorAs(err, &lockedErr)
+	suite.Assert().Equal("another indexer holds the lock for chain testchain-1", err.Error())
+
+	otherLock, err := AcquireChainLock(context.Background(), suite.db, ChainRef{ID: otherChainID, ChainID: "otherchain-1"})
+	suite.Require().NoError(err)
+	suite.Assert().NoError(otherLock.Release())
+
+	suite.Require().NoError(lock.Release())
+	lock, err = AcquireChainLock(context.Background(), suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().NoError(lock.Release())
+}
+
+func (suite *DBTestSuite) TestIndexMetrics() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	indexMetrics := metrics.New()
+	suite.Require().NoError(UseMetrics(suite.db, indexMetrics))
+
+	blockTime := time.Now().UTC()
+	for _, height := range []int64{2, 1} {
+		block := mockEventsBlock(chainID, height, blockTime, 3, 1, 1)
+		_, _, err = IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 1, blockTime), "")
+	suite.Require().NoError(err)
+
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 3, "testchain-1", "", StageFetch, errors.New("rpc error")))
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 3, "testchain-1", "", StageFetch, errors.New("rpc error")))
+
+	suite.Assert().Equal(2.0, testutil.ToFloat64(indexMetrics.BlocksIndexed.WithLabelValues("testchain-1", metrics.DatasetTxs)))
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.BlocksIndexed.WithLabelValues("testchain-1", metrics.DatasetBlockEvents)))
+	suite.Assert().Equal(6.0, testutil.ToFloat64(indexMetrics.TxsIndexed.WithLabelValues("testchain-1")))
+	suite.Assert().Equal(2.0, testutil.ToFloat64(indexMetrics.FailedBlocks.WithLabelValues("testchain-1", metrics.DatasetTxs, string(StageFetch))))
+
+	// Blocks indexed out of order leave the gauge at the highest
+	suite.Assert().Equal(2.0, testutil.ToFloat64(indexMetrics.HighestIndexedHeight.WithLabelValues("testchain-1", metrics.DatasetTxs)))
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.HighestIndexedHeight.WithLabelValues("testchain-1", metrics.DatasetBlockEvents)))
+
+	families, err := indexMetrics.Registry.Gather()
+	suite.Require().NoError(err)
+	samples := make(map[string]uint64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if histogram := metric.GetHistogram(); histogram != nil {
+				samples[family.GetName()] += histogram.GetSampleCount()
+			}
+		}
+	}
+	suite.Assert().Equal(uint64(3), samples["block_index_duration_seconds"])
+	suite.Assert().Equal(uint64(3), samples["db_tx_duration_seconds"])
+}
+
+func (suite *DBTestSuite) TestIndexTracing() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	suite.Require().NoError(UseTracing(suite.db, provider))
+
+	ctx, blockSpan := provider.Tracer("test").Start(context.Background(), "block")
+	block := mockEventsBlock(chainID, 1, time.Now().UTC(), 2, 1, 3)
+	_, _, err = IndexNewBlock(ctx, suite.db, block.Block, block.Txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+	blockSpan.End()
+
+	// The transaction is a child of the span of the context
+	var transaction sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == "db.transaction" {
+			transaction = span
+		}
+	}
+	suite.Require().NotNil(transaction)
+	suite.Assert().Equal(blockSpan.SpanContext().SpanID(), transaction.Parent().SpanID())
+
+	// The creates of the block are children of the transaction, the associations they save are their children
+	rowCounts := make(map[string]int64)
+	for _, span := range recorder.Ended() {
+		if span.Parent().SpanID() != transaction.SpanContext().SpanID() {
+			continue
+		}
+		for _, attr := range span.Attributes() {
+			if attr.Key == "db.row_count" {
+				rowCounts[span.Name()] += attr.Value.AsInt64()
+			}
+		}
+	}
+	suite.Assert().Equal(int64(2), rowCounts["db.create txes"])
+	suite.Assert().Equal(int64(2), rowCounts["db.create messages"])
+	suite.Assert().Equal(int64(2), rowCounts["db.create message_events"])
+	suite.Assert().Equal(int64(6), rowCounts["db.create message_event_attributes"])
+	suite.Assert().Equal(int64(1), rowCounts["db.create message_event_attribute_keys"])
+}
+
+func (suite *DBTestSuite) TestIndexNewBlocks() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	mockBatch := func(heights ...int64) []BlockTxsDBWrapper {
+		blocks := make([]BlockTxsDBWrapper, len(heights))
+		for i, height := range heights {
+			block, txs := mockTxBlock(chainID, height, blockTime)
+			txs[0].Tx.SignerAddresses = []models.Address{{Address: "alice"}}
+			txs[0].Messages = []MessageDBWrapper{{
+				Message: models.Message{MessageType: sendType},
+				MessageEvents: []MessageEventDBWrapper{{
+					MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}},
+					Attributes:   []models.MessageEventAttribute{{Value: "bob", MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "recipient"}}},
+				}},
+			}}
+			txs[0].UniqueMessageTypes = map[string]models.MessageType{sendType.MessageType: sendType}
+			txs[0].UniqueMessageEventTypes = map[string]models.MessageEventType{"transfer": {Type: "transfer"}}
+			txs[0].UniqueMessageAttributeKeys = map[string]models.MessageEventAttributeKey{"recipient": {Key: "recipient"}}
+			blocks[i] = BlockTxsDBWrapper{Block: block, Txs: txs}
+		}
+		return blocks
+	}
+
+	blocks, err := IndexNewBlocks(context.Background(), suite.db, mockBatch(1, 2, 3), config.IndexConfig{})
+	suite.Require().NoError(err)
+	for i, block := range blocks {
+		suite.Assert().NotZero(block.Block.ID)
+		suite.Assert().True(block.Block.TxIndexed)
+		suite.Assert().Equal(block.Block.ID, block.Txs[0].Tx.BlockID)
+		suite.Assert().Equal(int64(i+1), block.Txs[0].Messages[0].Message.Height)
+		suite.Assert().NotZero(block.Txs[0].Messages[0].MessageEvents[0].Attributes[0].ID)
+	}
+
+	var indexedBlocks []models.Block
+	suite.Require().NoError(suite.db.Where("chain_id = ? AND tx_indexed", chainID).Order("height").Find(&indexedBlocks).Error)
+	suite.Require().Len(indexedBlocks, 3)
+	for _, block := range indexedBlocks {
+		suite.Assert().Equal(int64(1), block.TxCount)
+	}
+
+	// The lookups of the batch are upserted once
+	var messageTypes, addresses, attributes int64
+	suite.Require().NoError(suite.db.Model(&models.MessageType{}).Count(&messageTypes).Error)
+	suite.Require().NoError(suite.db.Model(&models.Address{}).Where("address = ?", "alice").Count(&addresses).Error)
+	suite.Require().NoError(suite.db.Model(&models.MessageEventAttribute{}).Count(&attributes).Error)
+	suite.Assert().Equal(int64(1), messageTypes)
+	suite.Assert().Equal(int64(1), addresses)
+	suite.Assert().Equal(int64(3), attributes)
+
+	// A block conflicting with the stored one rolls back the whole batch
+	batch := mockBatch(4, 2, 5)
+	batch[1].Block.TimeStamp = blockTime.Add(time.Hour)
+	fallback := make([]BlockTxsDBWrapper, len(batch))
+	for i := range batch {
+		fallback[i] = CloneBlockTxsDBWrapper(batch[i])
+	}
+
+	_, err = IndexNewBlocks(context.Background(), suite.db, batch, config.IndexConfig{})
+	var conflictErr *BlockConflictError
+	suite.Require().ErrorAs(err, &conflictErr)
+
+	// The error names the conflicting block of the batch and the stage that failed
+	var indexErr *BlockIndexError
+	suite.Require().ErrorAs(err, &indexErr)
+	suite.Assert().Equal(BlockIndexError{Height: 2, EndHeight: 2, ChainID: chainID, Stage: StageBlock, Err: conflictErr}, *indexErr)
+	suite.Assert().Equal(StageBlock, ErrorStage(err))
+
+	var count int64
+	suite.Require().NoError(suite.db.Model(&models.Block{}).Where("height IN ?", []int64{4, 5}).Count(&count).Error)
+	suite.Assert().Zero(count)
+
+	// The copies index block by block, only the conflicting block fails
+	for i, block := range fallback {
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block.Block, block.Txs, config.IndexConfig{})
+		if i == 1 {
+			suite.Assert().ErrorAs(err, &conflictErr)
+			continue
+		}
+		suite.Require().NoError(err)
+	}
+	suite.Require().NoError(suite.db.Model(&models.Block{}).Where("height IN ? AND tx_indexed", []int64{4, 5}).Count(&count).Error)
+	suite.Assert().Equal(int64(2), count)
+}
+
+func (suite *DBTestSuite) TestIndexNewBlockAfterBlockEvents() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	// PostgreSQL stores microseconds, truncating keeps the timestamps comparable on every dialect
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+
+	// Events indexed first with the real timestamp, then txs for the same block
+	eventDataset, err := IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 1, blockTime), "block 1")
+	suite.Require().NoError(err)
+
+	block, txs := mockTxBlock(chainID, 1, blockTime)
+	indexedBlock, indexedTxs, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(eventDataset.Block.ID, indexedBlock.ID)
+	suite.Assert().Equal(indexedBlock.ID, indexedTxs[0].Tx.BlockID)
+
+	var storedBlock models.Block
+	suite.Require().NoError(suite.db.First(&storedBlock, indexedBlock.ID).Error)
+	suite.Assert().True(storedBlock.TxIndexed)
+	suite.Assert().True(storedBlock.BlockEventsIndexed)
+
+	// Events indexed first without a timestamp, the tx indexer sets it
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 2, time.Time{}), "block 2")
+	suite.Require().NoError(err)
+
+	block, txs = mockTxBlock(chainID, 2, blockTime)
+	indexedBlock, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	storedBlock = models.Block{}
+	suite.Require().NoError(suite.db.First(&storedBlock, indexedBlock.ID).Error)
+	suite.Assert().True(storedBlock.TimeStamp.Equal(blockTime.Truncate(time.Microsecond)))
+}
+
+func (suite *DBTestSuite) TestIndexNewBlockConflict() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+
+	_, err = IndexBlockEvents(context.Background(), suite.db, false, mockBlockEventsDBWrapper(chainID, 1, blockTime), "block 1")
+	suite.Require().NoError(err)
+
+	block, txs := mockTxBlock(chainID, 1, blockTime.Add(time.Hour))
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+
+	var conflictErr *BlockConflictError
+	suite.Require().ErrorAs(err, &conflictErr)
+	suite.Assert().Equal(int64(1), conflictErr.Height)
+
+	// Nothing from the conflicting block may have been written
+	var txCount int64
+	suite.Require().NoError(suite.db.Model(&models.Tx{}).Count(&txCount).Error)
+	suite.Assert().Zero(txCount)
+
+	var storedBlock models.Block
+	suite.Require().NoError(suite.db.Where("height = ?", 1).First(&storedBlock).Error)
+	suite.Assert().False(storedBlock.TxIndexed)
+	suite.Assert().True(storedBlock.TimeStamp.Equal(blockTime.Truncate(time.Microsecond)))
+}
+
+func (suite *DBTestSuite) TestIndexNewBlockCancelled() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	block, txs := mockTxBlock(chainID, 1, time.Now().UTC())
+	_, _, err = IndexNewBlock(ctx, suite.db, block, txs, config.IndexConfig{})
+	suite.Require().ErrorIs(err, context.Canceled)
+
+	// The transaction was rolled back, the block is indexed again on the next run
+	var blockCount int64
+	suite.Require().NoError(suite.db.Model(&models.Block{}).Count(&blockCount).Error)
+	suite.Assert().Zero(blockCount)
+}
+
+func (suite *DBTestSuite) TestIndexNewBlockMessageHeights() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+
+	block, txs := mockTxBlock(chainID, 7, time.Now().UTC())
+	txs[0].Messages = []MessageDBWrapper{{
+		Message: models.Message{MessageType: models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}},
+		MessageEvents: []MessageEventDBWrapper{{
+			MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}},
+			Attributes:   []models.MessageEventAttribute{{Value: "1uatom", MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "amount"}}},
+		}},
+	}}
+	txs[0].UniqueMessageTypes = map[string]models.MessageType{"/cosmos.bank.v1beta1.MsgSend": {MessageType: "/cosmos.bank.v1beta1.MsgSend"}}
+	txs[0].UniqueMessageEventTypes = map[string]models.MessageEventType{"transfer": {Type: "transfer"}}
+	txs[0].UniqueMessageAttributeKeys = map[string]models.MessageEventAttributeKey{"amount": {Key: "amount"}}
+
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	var message models.Message
+	suite.Require().NoError(suite.db.First(&message).Error)
+	suite.Assert().Equal(int64(7), message.Height)
+
+	var event models.MessageEvent
+	suite.Require().NoError(suite.db.First(&event).Error)
+	suite.Assert().Equal(int64(7), event.Height)
+
+	var attribute models.MessageEventAttribute
+	suite.Require().NoError(suite.db.First(&attribute).Error)
+	suite.Assert().Equal(int64(7), attribute.Height)
+
+	// Partitioning is PostgreSQL only
+	suite.Require().NoError(suite.db.Use(newPartitioning(config.Database{PartitionSize: 1000})))
+	if dialectOf(suite.db) != config.DialectPostgres {
+		suite.Assert().ErrorIs(MigrateModels(suite.db), ErrUnsupportedDialect)
+		return
+	}
+
+	// The tables were created unpartitioned and cannot be converted
+	suite.Assert().ErrorContains(MigrateModels(suite.db), "can only be enabled on a new database")
+}
+
+func (suite *DBTestSuite) TestGetWatchedAddressActivity() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	// The recipient never signs, it is only found in the tx events
+	_, err = AddWatchedAddress(context.Background(), suite.db, "recipient", "treasury")
+	suite.Require().NoError(err)
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	block, txs := mockTxBlock(chainID, 1, time.Now())
+	txs[0].Tx.SignerAddresses = []models.Address{{Address: "sender"}}
+	txs[0].Messages = []MessageDBWrapper{
+		{Message: models.Message{MessageIndex: 0, MessageType: sendType, MessageBytes: []byte("raw message")}},
+	}
+	txs[0].UniqueMessageTypes = map[string]models.MessageType{sendType.MessageType: sendType}
+	txs[0].WatchedAddresses = []string{"recipient"}
+
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	activity, err := GetWatchedAddressActivityInRange(context.Background(), suite.db, chain, "recipient", HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Require().Len(activity, 1)
+	suite.Assert().Equal(txs[0].Tx.Hash, activity[0].Hash)
+	suite.Assert().Equal(int64(1), activity[0].Block.Height)
+
+	// Full message bodies are kept for watched txs even though raw message indexing is disabled
+	var message models.Message
+	suite.Require().NoError(suite.db.Where("tx_id = ?", activity[0].ID).First(&message).Error)
+	suite.Assert().Equal([]byte("raw message"), message.MessageBytes)
+
+	activity, err = GetWatchedAddressActivityInRange(context.Background(), suite.db, chain, "recipient", HeightsFrom(2))
+	suite.Require().NoError(err)
+	suite.Assert().Empty(activity)
+
+	err = RemoveWatchedAddress(context.Background(), suite.db, "recipient")
+	suite.Require().NoError(err)
+
+	activity, err = GetWatchedAddressActivityInRange(context.Background(), suite.db, chain, "recipient", HeightsFrom(1))
+	suite.Require().NoError(err)
+	suite.Assert().Empty(activity)
+}
+
+func (suite *DBTestSuite) TestGetTxsByAddress() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+	otherChainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "otherchain-1"})
+	suite.Require().NoError(err)
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	indexTx := func(chainID uint, height int64, signer string, feePayer string) {
+		block, txs := mockTxBlock(chainID, height, time.Now())
+		txs[0].Tx.Hash = fmt.Sprintf("hash%d-%d", chainID, height)
+		txs[0].Tx.SignerAddresses = []models.Address{{Address: signer}}
+		txs[0].Tx.Fees = []models.Fee{{
+			Amount:       decimal.NewFromInt(100),
+			Denomination: models.Denom{Base: "uatom"},
+			PayerAddress: models.Address{Address: feePayer},
+		}}
+		txs[0].Messages = []MessageDBWrapper{
+			{Message: models.Message{MessageIndex: 0, MessageType: sendType}},
+			{Message: models.Message{MessageIndex: 1, MessageType: sendType}},
+		}
+		txs[0].UniqueMessageTypes = map[string]models.MessageType{sendType.MessageType: sendType}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	// alice signs at 1 and 3 and pays the fee of bob's tx at 2, and signs on another chain
+	indexTx(chainID, 1, "alice", "alice")
+	indexTx(chainID, 2, "bob", "alice")
+	indexTx(chainID, 3, "alice", "alice")
+	indexTx(chainID, 4, "bob", "bob")
+	indexTx(otherChainID, 1, "alice", "alice")
+
+	heightsOf := func(txs []AddressTx) []int64 {
+		heights := make([]int64, len(txs))
+		for i, tx := range txs {
+			heights[i] = tx.Block.Height
+		}
+		return heights
+	}
+
+	txs, err := GetTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{1, 2, 3}, heightsOf(txs))
+	suite.Assert().Equal("bob", txs[1].SignerAddresses[0].Address)
+	suite.Assert().Empty(txs[0].Messages)
+	suite.Assert().Empty(txs[0].Fees)
+
+	txs, err = GetTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{
+		Heights:         HeightRange{Start: 2, End: 3},
+		PreloadMessages: true,
+		PreloadFees:     true,
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{2, 3}, heightsOf(txs))
+	suite.Require().Len(txs[0].Messages, 2)
+	suite.Assert().Equal(1, txs[0].Messages[1].MessageIndex)
+	suite.Assert().Equal(sendType.MessageType, txs[0].Messages[0].MessageType.MessageType)
+	suite.Require().Len(txs[0].Fees, 1)
+	suite.Assert().Equal("alice", txs[0].Fees[0].PayerAddress.Address)
+	suite.Assert().Equal("uatom", txs[0].Fees[0].Denomination.Base)
+
+	txs, err = GetTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{Pagination: Pagination{Limit: 2, Offset: 1}})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]int64{2, 3}, heightsOf(txs))
+
+	txs, err = GetTxsByAddress(context.Background(), suite.db, chain, "carol", TxQueryOptions{})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(txs)
+
+	_, err = GetTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{Pagination: Pagination{Offset: 1}})
+	suite.Assert().Error(err)
+
+	_, err = GetTxsByAddress(context.Background(), suite.db, chain, "alice", TxQueryOptions{Heights: HeightRange{Start: 3, End: 2}})
+	suite.Assert().ErrorIs(err, ErrHeightRangeOrder)
+}
+
+func (suite *DBTestSuite) TestGetMessagesByType() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	multiSendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgMultiSend"}
+	delegateType := models.MessageType{MessageType: "/cosmos.staking.v1beta1.MsgDelegate"}
+	registerType := models.MessageType{MessageType: "/ibc.applications.interchain_accounts.v1.MsgRegisterInterchainAccount"}
+	lookalikeType := models.MessageType{MessageType: "/ibc.applications.interchainXaccounts.v1.MsgRegisterInterchainAccount"}
+
+	for height, messageTypes := range map[int64][]models.MessageType{
+		1: {delegateType, sendType},
+		2: {multiSendType},
+		3: {sendType, sendType},
+		4: {registerType},
+		5: {lookalikeType},
+	} {
+		block, txs := mockTxBlock(chainID, height, time.Now())
+		txs[0].UniqueMessageTypes = make(map[string]models.MessageType)
+		for i, messageType := range messageTypes {
+			txs[0].Messages = append(txs[0].Messages, MessageDBWrapper{Message: models.Message{MessageIndex: i, MessageType: messageType}})
+			txs[0].UniqueMessageTypes[messageType.MessageType] = messageType
+		}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	positionsOf := func(messages []models.Message) [][2]int64 {
+		positions := make([][2]int64, len(messages))
+		for i, message := range messages {
+			positions[i] = [2]int64{message.Tx.Block.Height, int64(message.MessageIndex)}
+		}
+		return positions
+	}
+
+	messages, err := GetMessagesByType(context.Background(), suite.db, chain, sendType.MessageType, HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][2]int64{{1, 1}, {3, 0}, {3, 1}}, positionsOf(messages))
+	suite.Assert().Equal(sendType.MessageType, messages[0].MessageType.MessageType)
+	suite.Assert().Equal("hash1", messages[0].Tx.Hash)
+
+	// A pattern matches every bank message
+	messages, err = GetMessagesByType(context.Background(), suite.db, chain, "/cosmos.bank.%", HeightRange{Start: 1, End: 2}, Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][2]int64{{1, 1}, {2, 0}}, positionsOf(messages))
+
+	messages, err = GetMessagesByType(context.Background(), suite.db, chain, "/cosmos.bank.%", HeightsFrom(1), Pagination{Limit: 2, Offset: 1})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][2]int64{{2, 0}, {3, 0}}, positionsOf(messages))
+
+	messages, err = GetMessagesByType(context.Background(), suite.db, chain, "/cosmos.bank.", HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(messages, "types without a pattern match exactly")
+
+	// _ and \ of a pattern match themselves
+	messages, err = GetMessagesByType(context.Background(), suite.db, chain, "/ibc.applications.interchain_accounts.%", HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][2]int64{{4, 0}}, positionsOf(messages))
+
+	messages, err = GetMessagesByType(context.Background(), suite.db, chain, `/ibc.applications.interchain\_accounts.%`, HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(messages)
+
+	_, err = GetMessagesByType(context.Background(), suite.db, ChainRef{ChainID: chain.ChainID}, sendType.MessageType, HeightsFrom(1), Pagination{})
+	suite.Assert().ErrorIs(err, ErrUnresolvedChainRef)
+}
+
+func (suite *DBTestSuite) TestMessageValue() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	timeStamp := time.Now()
+	indexSend := func(height int64, value string) {
+		block, txs := mockTxBlock(chainID, height, timeStamp)
+		txs[0].UniqueMessageTypes = map[string]models.MessageType{sendType.MessageType: sendType}
+		txs[0].Messages = []MessageDBWrapper{{Message: models.Message{MessageType: sendType, Value: json.RawMessage(value)}}}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+	storedValue := func(height int64) string {
+		var message models.Message
+		suite.Require().NoError(suite.db.Joins("JOIN txes ON txes.id = messages.tx_id JOIN blocks ON blocks.id = txes.block_id").
+			Where("blocks.height = ?", height).First(&message).Error)
+		return string(message.Value)
+	}
+
+	indexSend(1, `{"to_address":"alice","amount":[{"denom":"uatom","amount":"5"}]}`)
+	indexSend(2, `{"to_address":"bob","amount":[{"denom":"uosmo","amount":"7"}]}`)
+	suite.Assert().JSONEq(`{"to_address":"alice","amount":[{"denom":"uatom","amount":"5"}]}`, storedValue(1))
+
+	// Reindexing the block updates the value
+	indexSend(1, `{"to_address":"carol","amount":[{"denom":"uatom","amount":"5"}]}`)
+	suite.Assert().JSONEq(`{"to_address":"carol","amount":[{"denom":"uatom","amount":"5"}]}`, storedValue(1))
+
+	if dialectOf(suite.db) != config.DialectPostgres {
+		_, err = GetMessagesByJSONPath(context.Background(), suite.db, chain, "$.to_address", HeightsFrom(1), Pagination{})
+		suite.Assert().ErrorIs(err, ErrUnsupportedDialect)
+		suite.Assert().ErrorIs(CreateMessageValueIndex(suite.db), ErrUnsupportedDialect)
+		return
+	}
+
+	suite.Require().NoError(CreateMessageValueIndex(suite.db))
+
+	messages, err := GetMessagesByJSONPath(context.Background(), suite.db, chain, `$.amount[*] ? (@.denom == "uatom")`, HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Require().Len(messages, 1)
+	suite.Assert().Equal(int64(1), messages[0].Tx.Block.Height)
+	suite.Assert().Equal(sendType.MessageType, messages[0].MessageType.MessageType)
+
+	messages, err = GetMessagesByJSONPath(context.Background(), suite.db, chain, `$ ? (@.to_address == "bob")`, HeightRange{Start: 1, End: 1}, Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(messages)
+
+	_, err = GetMessagesByJSONPath(context.Background(), suite.db, chain, "", HeightsFrom(1), Pagination{})
+	suite.Assert().Error(err)
+}
+
+func (suite *DBTestSuite) TestSearchEventAttributeValues() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	executeType := models.MessageType{MessageType: "/cosmwasm.wasm.v1.MsgExecuteContract"}
+	for height, values := range map[int64][2]string{
+		1: {"osmo1contract", "swap"},
+		2: {"osmo1other", "osmo1contract"},
+		3: {"osmo1contractv2", "swap"},
+	} {
+		block, txs := mockTxBlock(chainID, height, time.Now())
+		txs[0].Messages = []MessageDBWrapper{{
+			Message: models.Message{MessageType: executeType},
+			MessageEvents: []MessageEventDBWrapper{{
+				MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "wasm"}},
+				Attributes: []models.MessageEventAttribute{
+					{Index: 0, Value: values[0], MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "_contract_address"}},
+					{Index: 1, Value: values[1], MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "action"}},
+				},
+			}},
+		}}
+		txs[0].UniqueMessageTypes = map[string]models.MessageType{executeType.MessageType: executeType}
+		txs[0].UniqueMessageEventTypes = map[string]models.MessageEventType{"wasm": {Type: "wasm"}}
+		txs[0].UniqueMessageAttributeKeys = map[string]models.MessageEventAttributeKey{"_contract_address": {Key: "_contract_address"}, "action": {Key: "action"}}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	positionsOf := func(attributes []models.MessageEventAttribute) [][2]int64 {
+		positions := make([][2]int64, len(attributes))
+		for i, attribute := range attributes {
+			positions[i] = [2]int64{attribute.MessageEvent.Message.Tx.Block.Height, int64(attribute.Index)}
+		}
+		return positions
+	}
+
+	attributes, err := SearchEventAttributeValues(context.Background(), suite.db, chain, "_contract_address", "%osmo1contract%", HeightsFrom(1), Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][2]int64{{1, 0}, {3, 0}}, positionsOf(attributes))
+	suite.Assert().Equal("_contract_address", attributes[0].MessageEventAttributeKey.Key)
+	suite.Assert().Equal("wasm", attributes[0].MessageEvent.MessageEventType.Type)
+	suite.Assert().Equal(executeType.MessageType, attributes[0].MessageEvent.Message.MessageType.MessageType)
+	suite.Assert().Equal("hash1", attributes[0].MessageEvent.Message.Tx.Hash)
+
+	// Every key, within a height range and paged
+	attributes, err = SearchEventAttributeValues(context.Background(), suite.db, chain, "", "osmo1contract%", HeightRange{Start: 1, End: 2}, Pagination{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][2]int64{{1, 0}, {2, 1}}, positionsOf(attributes))
+
+	attributes, err = SearchEventAttributeValues(context.Background(), suite.db, chain, "", "%osmo1contract%", HeightsFrom(1), Pagination{Limit: 1, Offset: 1})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([][2]int64{{2, 1}}, positionsOf(attributes))
+
+	_, err = SearchEventAttributeValues(context.Background(), suite.db, chain, "action", "", HeightsFrom(1), Pagination{})
+	suite.Assert().Error(err)
+
+	if dialectOf(suite.db) != config.DialectPostgres {
+		suite.Assert().ErrorIs(CreateAttributeValueTrigramIndex(suite.db), ErrUnsupportedDialect)
+		return
+	}
+
+	// Skipped with a warning when the extension is not available
+	suite.Require().NoError(CreateAttributeValueTrigramIndex(suite.db))
+}
+
+func (suite *DBTestSuite) TestGetTxByHash() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	transferEvent := models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}}
+	block, txs := mockTxBlock(chainID, 1, time.Now())
+	txs[0].Tx.Hash = "ABCDEF0123"
+	txs[0].Tx.SignerAddresses = []models.Address{{Address: "alice"}}
+	txs[0].Tx.Fees = []models.Fee{{Amount: decimal.NewFromInt(100), Denomination: models.Denom{Base: "uatom"}, PayerAddress: models.Address{Address: "alice"}}}
+	txs[0].Messages = []MessageDBWrapper{
+		{
+			Message: models.Message{MessageIndex: 0, MessageType: sendType},
+			MessageEvents: []MessageEventDBWrapper{{
+				MessageEvent: transferEvent,
+				Attributes: []models.MessageEventAttribute{
+					{Index: 0, Value: "bob", MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "recipient"}},
+					{Index: 1, Value: "1uatom", MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "amount"}},
+				},
+			}},
+		},
+		{Message: models.Message{MessageIndex: 1, MessageType: sendType}},
+	}
+	txs[0].UniqueMessageTypes = map[string]models.MessageType{sendType.MessageType: sendType}
+	txs[0].UniqueMessageEventTypes = map[string]models.MessageEventType{"transfer": {Type: "transfer"}}
+	txs[0].UniqueMessageAttributeKeys = map[string]models.MessageEventAttributeKey{"recipient": {Key: "recipient"}, "amount": {Key: "amount"}}
+
+	_, _, err = IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	// Hashes are matched case-insensitively
+	tx, err := GetTxByHash(context.Background(), suite.db, chain, "abcdef0123")
+	suite.Require().NoError(err)
+	suite.Assert().Equal("ABCDEF0123", tx.Tx.Hash)
+	suite.Assert().Equal(int64(1), tx.Tx.Block.Height)
+	suite.Assert().Equal("alice", tx.Tx.SignerAddresses[0].Address)
+	suite.Require().Len(tx.Tx.Fees, 1)
+	suite.Assert().Equal("uatom", tx.Tx.Fees[0].Denomination.Base)
+	suite.Assert().Equal("alice", tx.Tx.Fees[0].PayerAddress.Address)
+
+	suite.Require().Len(tx.Messages, 2)
+	suite.Assert().Equal(sendType.MessageType, tx.Messages[0].Message.MessageType.MessageType)
+	suite.Assert().Empty(tx.Messages[1].MessageEvents)
+	suite.Require().Len(tx.Messages[0].MessageEvents, 1)
+	event := tx.Messages[0].MessageEvents[0]
+	suite.Assert().Equal("transfer", event.MessageEvent.MessageEventType.Type)
+	suite.Require().Len(event.Attributes, 2)
+	suite.Assert().Equal("recipient", event.Attributes[0].MessageEventAttributeKey.Key)
+	suite.Assert().Equal("1uatom", event.Attributes[1].Value)
+
+	_, err = GetTxByHash(context.Background(), suite.db, chain, "0000")
+	suite.Assert().ErrorIs(err, gorm.ErrRecordNotFound)
+
+	otherChainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "otherchain-1"})
+	suite.Require().NoError(err)
+	_, err = GetTxByHash(context.Background(), suite.db, ChainRef{ID: otherChainID, ChainID: "otherchain-1"}, "ABCDEF0123")
+	suite.Assert().ErrorIs(err, gorm.ErrRecordNotFound)
+}
+
+func (suite *DBTestSuite) TestExportCSV() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	delegateType := models.MessageType{MessageType: "/cosmos.staking.v1beta1.MsgDelegate"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	indexTx := func(height int64, signer string, memo string, messageTypes ...models.MessageType) {
+		block, txs := mockTxBlock(chainID, height, start.Add(time.Duration(height)*time.Hour))
+		txs[0].Tx.Memo = memo
+		txs[0].Tx.GasUsed = height * 1000
+		txs[0].Tx.SignerAddresses = []models.Address{{Address: signer}}
+		txs[0].Tx.Fees = []models.Fee{{
+			Amount:         decimal.NewFromInt(height * 100),
+			Denomination:   models.Denom{Base: "uatom"},
+			PayerAddress:   models.Address{Address: signer},
+			GranterAddress: &models.Address{Address: "granter"},
+		}}
+		txs[0].UniqueMessageTypes = map[string]models.MessageType{}
+		for i, messageType := range messageTypes {
+			txs[0].Messages = append(txs[0].Messages, MessageDBWrapper{Message: models.Message{MessageIndex: i, MessageType: messageType}})
+			txs[0].UniqueMessageTypes[messageType.MessageType] = messageType
+		}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	indexTx(1, "alice", "rent, \"january\"\nthanks", sendType, delegateType)
+	indexTx(2, "bob", "", delegateType)
+	indexTx(3, "alice", "", sendType)
+
+	export := func(opts ExportOptions) ([][]string, int64) {
+		var b strings.Builder
+		written, err := ExportCSV(context.Background(), suite.db, chain, opts, &b)
+		suite.Require().NoError(err)
+		suite.Assert().True(strings.HasSuffix(b.String(), "\r\n"))
+
+		records, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+		suite.Require().NoError(err)
+		suite.Require().Equal(ExportColumns(opts.Dataset), records[0])
+		return records[1:], written
+	}
+
+	records, written := export(ExportOptions{Dataset: ExportTxs})
+	suite.Assert().Equal(int64(3), written)
+	suite.Require().Len(records, 3)
+	// The memo with a comma, quotes and a newline survives the quoting
+	suite.Assert().Equal([]string{"1", "2024-01-01T01:00:00Z", "hash1", "0", "alice", sendType.MessageType + ";" + delegateType.MessageType, "0", "1000", "rent, \"january\"\nthanks", ""}, records[0])
+
+	records, _ = export(ExportOptions{Dataset: ExportTxs, Address: "alice", Heights: HeightRange{Start: 2, End: 3}})
+	suite.Require().Len(records, 1)
+	suite.Assert().Equal("hash3", records[0][2])
+
+	records, _ = export(ExportOptions{Dataset: ExportTxs, MessageType: "/cosmos.staking.%"})
+	suite.Require().Len(records, 2)
+	suite.Assert().Equal("hash2", records[1][2])
+
+	records, written = export(ExportOptions{Dataset: ExportMessages, From: start.Add(90 * time.Minute)})
+	suite.Assert().Equal(int64(2), written)
+	suite.Assert().Equal([][]string{
+		{"2", "2024-01-01T02:00:00Z", "hash2", "0", "0", delegateType.MessageType},
+		{"3", "2024-01-01T03:00:00Z", "hash3", "0", "0", sendType.MessageType},
+	}, records)
+
+	records, _ = export(ExportOptions{Dataset: ExportMessages, MessageType: sendType.MessageType, To: start.Add(2 * time.Hour)})
+	suite.Assert().Equal([][]string{{"1", "2024-01-01T01:00:00Z", "hash1", "0", "0", sendType.MessageType}}, records)
+
+	records, _ = export(ExportOptions{Dataset: ExportFees, Address: "bob"})
+	suite.Assert().Equal([][]string{{"2", "2024-01-01T02:00:00Z", "hash2", "200", "uatom", "bob", "granter"}}, records)
+
+	// An address that was never indexed has no rows, only the header
+	records, written = export(ExportOptions{Dataset: ExportFees, Address: "carol"})
+	suite.Assert().Empty(records)
+	suite.Assert().Zero(written)
+
+	_, err = ExportCSV(context.Background(), suite.db, chain, ExportOptions{Dataset: "blocks"}, io.Discard)
+	suite.Assert().Error(err)
+	_, err = ExportCSV(context.Background(), suite.db, chain, ExportOptions{Dataset: ExportTxs, From: start, To: start}, io.Discard)
+	suite.Assert().Error(err)
+}
+
+func (suite *DBTestSuite) TestExportParquet() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	chainID, err := GetDBChainID(context.Background(), suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+
+	sendType := models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for height := int64(1); height <= 3; height++ {
+		block, txs := mockTxBlock(chainID, height, start.Add(time.Duration(height)*time.Hour))
+		txs[0].Messages = []MessageDBWrapper{{
+			Message: models.Message{MessageType: sendType},
+			MessageEvents: []MessageEventDBWrapper{{
+				MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}},
+				Attributes: []models.MessageEventAttribute{
+					{Index: 0, Value: "bob", MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "recipient"}},
+					{Index: 1, Value: fmt.Sprintf("%d000000000000000000000uatom", height), MessageEventAttributeKey: models.MessageEventAttributeKey{Key: "amount"}},
+				},
+			}},
+		}}
+		txs[0].UniqueMessageTypes = map[string]models.MessageType{sendType.MessageType: sendType}
+		txs[0].UniqueMessageEventTypes = map[string]models.MessageEventType{"transfer": {Type: "transfer"}}
+		txs[0].UniqueMessageAttributeKeys = map[string]models.MessageEventAttributeKey{"recipient": {Key: "recipient"}, "amount": {Key: "amount"}}
+
+		_, _, err := IndexNewBlock(context.Background(), suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+
+	dir := suite.T().TempDir()
+	var written []ParquetPartition
+	progress := func(partition ParquetPartition) { written = append(written, partition) }
+
+	// Pages of one row split every block across pages
+	opts := ParquetExportOptions{Dir: dir, Heights: HeightRange{Start: 1, End: 2}, PartitionBlocks: 1, PageSize: 1}
+	manifest, err := ExportParquet(context.Background(), suite.db, chain, opts, progress)
+	suite.Require().NoError(err)
+	suite.Require().Len(manifest.Partitions, 2)
+	suite.Assert().Equal(written, manifest.Partitions)
+	suite.Assert().Equal("testchain-1_message_event_attributes_000000000002-000000000002.parquet", manifest.Partitions[1].File)
+
+	rows, err := parquet.ReadFile[MessageEventAttributeRow](filepath.Join(dir, manifest.Partitions[1].File))
+	suite.Require().NoError(err)
+	suite.Require().Len(rows, 2)
+	suite.Assert().Equal(int64(2), rows[1].Height)
+	suite.Assert().True(start.Add(2 * time.Hour).Equal(rows[1].Time))
+	suite.Assert().Equal("hash2", rows[1].TxHash)
+	suite.Assert().Equal(sendType.MessageType, rows[1].MessageType)
+	suite.Assert().Equal("transfer", rows[1].EventType)
+	suite.Assert().Equal(int64(1), rows[1].AttributeIndex)
+	suite.Assert().Equal("amount", rows[1].AttributeKey)
+	suite.Assert().Equal("2000000000000000000000uatom", rows[1].AttributeValue)
+
+	stored, found, err := ReadParquetManifest(dir)
+	suite.Require().NoError(err)
+	suite.Require().True(found)
+	suite.Assert().Len(stored.Partitions, 2)
+
+	// An open range resumes after the last partition and ends at the highest height
+	written = nil
+	opts.Heights = HeightsFrom(1)
+	manifest, err = ExportParquet(context.Background(), suite.db, chain, opts, progress)
+	suite.Require().NoError(err)
+	suite.Require().Len(manifest.Partitions, 3)
+	suite.Require().Len(written, 1)
+	suite.Assert().Equal(int64(3), written[0].StartHeight)
+	suite.Assert().Equal(int64(2), written[0].Rows)
+
+	opts.PartitionBlocks = 10
+	_, err = ExportParquet(context.Background(), suite.db, chain, opts, nil)
+	suite.Assert().Error(err)
+}
+
+func (suite *DBTestSuite) TestOpenWithOptions() {
+	suite.requirePostgres()
+
+	sqlDB, err := suite.db.DB()
+	suite.Require().NoError(err)
+
+	var postConnectCalled bool
+	var queries int
+	db, err := openWithOptions(postgres.New(postgres.Config{Conn: sqlDB}), "", ConnectOptions{
+		GormConfig: &gorm.Config{},
+		PostConnect: func(db *gorm.DB) error {
+			postConnectCalled = true
+			return db.Callback().Query().After("gorm:query").Register("test:count_queries", func(*gorm.DB) {
+				queries++
+			})
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Assert().True(postConnectCalled)
+	suite.Assert().NotNil(db.Logger)
+
+	err = MigrateModels(db)
+	suite.Require().NoError(err)
+
+	_, err = GetChainByChainID(context.Background(), db, "testchain-1")
+	suite.Require().NoError(err)
+	suite.Assert().NotZero(queries)
+}
+
+func (suite *DBTestSuite) TestVerifySchemaRejectsRenamedTables() {
+	sqlDB, err := suite.db.DB()
+	suite.Require().NoError(err)
+
+	db, err := openWithOptions(postgres.New(postgres.Config{Conn: sqlDB}), "", ConnectOptions{
+		GormConfig: &gorm.Config{NamingStrategy: schema.NamingStrategy{TablePrefix: "indexer_"}},
+	})
+	suite.Require().NoError(err)
+
+	err = MigrateModels(db)
+	var mismatchErr *SchemaMismatchError
+	suite.Require().ErrorAs(err, &mismatchErr)
+	suite.Assert().Contains(mismatchErr.Error(), "indexer_blocks")
+
+	// Nothing was migrated with the incompatible naming strategy
+	suite.Assert().False(suite.db.Migrator().HasTable("indexer_blocks"))
+
+	db, err = openWithOptions(postgres.New(postgres.Config{Conn: sqlDB}), "", ConnectOptions{
+		GormConfig: &gorm.Config{NamingStrategy: schema.NamingStrategy{}},
+	})
+	suite.Require().NoError(err)
+	suite.Assert().NoError(VerifySchema(db))
+}
+
+func (suite *DBTestSuite) TestGetCompletenessReport() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+
+	// 1, 2 and 5 fully indexed, 6 missing block events, 3-4 and 7-10 missing
+	for _, block := range []struct {
+		height       int64
+		eventIndexed bool
+	}{{1, true}, {2, true}, {5, true}, {6, false}} {
+		_, err := createMockBlock(suite.db, initChain, initConsAddress, block.height, true, block.eventIndexed)
+		suite.Require().NoError(err)
+	}
+
+	suite.Require().NoError(UpsertFailedBlock(context.Background(), suite.db, 3, initChain.ChainID, "", StageFetch, errors.New("rpc unavailable")))
+
+	requirements := CompletenessRequirements{Transactions: true, BlockEvents: true}
+	report, err := GetCompletenessReport(context.Background(), suite.db, NewChainRef(initChain), HeightRange{Start: 1, End: 10}, requirements)
+	suite.Require().NoError(err)
+
+	suite.Assert().Equal(int64(10), report.TotalHeights)
+	suite.Assert().Equal(int64(3), report.FullyIndexed)
+	suite.Assert().Equal(int64(1), report.Partial)
+	suite.Assert().Equal(int64(6), report.Missing)
+	suite.Assert().InDelta(30.0, report.FullyIndexedPercent, 0.0001)
+	suite.Assert().Equal(int64(2), report.GapCount)
+	suite.Require().NotNil(report.WorstGap)
+	suite.Assert().Equal(GapRange{Start: 7, End: 10, Length: 4}, *report.WorstGap)
+	suite.Assert().Equal(int64(1), report.FailedTxHeights)
+	suite.Require().NotNil(report.OldestUnresolvedFailure)
+
+	// Block events are not required, so 6 is fully indexed. The open range ends at the highest block.
+	report, err = GetCompletenessReport(context.Background(), suite.db, NewChainRef(initChain), HeightsFrom(1), CompletenessRequirements{Transactions: true})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(6), report.Heights.End)
+	suite.Assert().Equal(int64(4), report.FullyIndexed)
+	suite.Assert().Equal(int64(2), report.Missing)
+	suite.Assert().Equal(int64(1), report.GapCount)
+	suite.Assert().Equal(GapRange{Start: 3, End: 4, Length: 2}, *report.WorstGap)
+}
+
+func (suite *DBTestSuite) TestGetMissingBlockRanges() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+
+	// 2, 3, 6 and 8 fully indexed, 7 missing block events
+	for _, block := range []struct {
+		height       int64
+		eventIndexed bool
+	}{{2, true}, {3, true}, {6, true}, {7, false}, {8, true}} {
+		_, err := createMockBlock(suite.db, initChain, initConsAddress, block.height, true, block.eventIndexed)
+		suite.Require().NoError(err)
+	}
+
+	chain := NewChainRef(initChain)
+	requirements := CompletenessRequirements{Transactions: true, BlockEvents: true}
+	gaps, err := GetMissingBlockRanges(context.Background(), suite.db, chain, HeightRange{Start: 1, End: 10}, requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]GapRange{
+		{Start: 1, End: 1, Length: 1},
+		{Start: 4, End: 5, Length: 2},
+		{Start: 7, End: 7, Length: 1},
+		{Start: 9, End: 10, Length: 2},
+	}, gaps)
+
+	// Block events are not required, so 7 is fully indexed. The open range ends at the highest block.
+	gaps, err = GetMissingBlockRanges(context.Background(), suite.db, chain, HeightsFrom(3), CompletenessRequirements{Transactions: true})
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]GapRange{{Start: 4, End: 5, Length: 2}}, gaps)
+
+	gaps, err = GetMissingBlockRanges(context.Background(), suite.db, chain, HeightsFrom(9), requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(gaps)
+
+	_, err = GetMissingBlockRanges(context.Background(), suite.db, ChainRef{ChainID: initChain.ChainID}, HeightsFrom(1), requirements)
+	suite.Assert().ErrorIs(err, ErrUnresolvedChainRef)
+}
+
+func (suite *DBTestSuite) TestUnavailableBlockRanges() {
+	suite.Require().NoError(MigrateModels(suite.db))
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+	_, err := createMockBlock(suite.db, initChain, initConsAddress, 8, true, true)
+	suite.Require().NoError(err)
+
+	ctx := context.Background()
+	chain := NewChainRef(initChain)
+	floor, err := GetUnavailableFloor(ctx, suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), floor)
+
+	// Recording the same range twice keeps one row
+	for i := 0; i < 2; i++ {
+		suite.Require().NoError(RecordUnavailableBlockRange(ctx, suite.db, chain, HeightRange{Start: 1, End: 4}, "pruned by the RPC node"))
+	}
+	var count int64
+	suite.Require().NoError(suite.db.Model(&models.UnavailableBlockRange{}).Count(&count).Error)
+	suite.Assert().Equal(int64(1), count)
+
+	floor, err = GetUnavailableFloor(ctx, suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(5), floor)
+
+	// Heights below the floor are not missing
+	requirements := CompletenessRequirements{Transactions: true, BlockEvents: true}
+	gaps, err := GetMissingBlockRanges(ctx, suite.db, chain, HeightRange{Start: 1, End: 10}, requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]GapRange{{Start: 5, End: 7, Length: 3}, {Start: 9, End: 10, Length: 2}}, gaps)
+
+	gaps, err = GetMissingBlockRanges(ctx, suite.db, chain, HeightRange{Start: 1, End: 3}, requirements)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(gaps)
+
+	err = RecordUnavailableBlockRange(ctx, suite.db, chain, HeightsFrom(1), "pruned by the RPC node")
+	suite.Assert().Error(err)
+}
+
+func (suite *DBTestSuite) TestIndexerCheckpoints() {
+	suite.Require().NoError(MigrateModels(suite.db))
+	ctx := context.Background()
+
+	chainID, err := GetDBChainID(ctx, suite.db, models.Chain{ChainID: "testchain-1"})
+	suite.Require().NoError(err)
+	chain := ChainRef{ID: chainID, ChainID: "testchain-1"}
+	blockTime := time.Now().UTC().Truncate(time.Microsecond)
+	indexBlock := func(height int64) {
+		block, txs := mockTxBlock(chainID, height, blockTime)
+		_, _, err := IndexNewBlock(ctx, suite.db, block, txs, config.IndexConfig{})
+		suite.Require().NoError(err)
+	}
+	lastContiguous := func(workerType string) int64 {
+		checkpoint, found, err := GetIndexerCheckpoint(ctx, suite.db, chain, workerType)
+		suite.Require().NoError(err)
+		suite.Require().True(found)
+		return checkpoint.LastContiguousHeight
+	}
+
+	// Blocks indexed before the chain has a checkpoint are found by the verification
+	indexBlock(1)
+	indexBlock(2)
+	_, found, err := GetIndexerCheckpoint(ctx, suite.db, chain, CheckpointTxs)
+	suite.Require().NoError(err)
+	suite.Assert().False(found)
+
+	verification, err := VerifyIndexerCheckpoint(ctx, suite.db, chain, CheckpointTxs, 1)
+	suite.Require().NoError(err)
+	suite.Assert().False(verification.Found)
+	suite.Assert().Equal(int64(2), verification.Scanned)
+	suite.Assert().Equal(int64(2), verification.Checkpoint.LastContiguousHeight)
+
+	// A height past a gap holds the checkpoint, filling the gap advances it over the heights already indexed
+	indexBlock(4)
+	suite.Assert().Equal(int64(2), lastContiguous(CheckpointTxs))
+	indexBlock(3)
+	suite.Assert().Equal(int64(4), lastContiguous(CheckpointTxs))
+
+	resume, err := GetCheckpointResumeHeight(ctx, suite.db, chain, 1, CheckpointTxs)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(5), resume)
+
+	// Without a checkpoint covering the start of every dataset, the start is kept
+	resume, err = GetCheckpointResumeHeight(ctx, suite.db, chain, 1, CheckpointTxs, CheckpointBlockEvents)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), resume)
+	resume, err = GetCheckpointResumeHeight(ctx, suite.db, chain, 10, CheckpointTxs)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(10), resume)
+
+	// Block events have their own checkpoint
+	verification, err = VerifyIndexerCheckpoint(ctx, suite.db, chain, CheckpointBlockEvents, 1)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(0), verification.Checkpoint.LastContiguousHeight)
+	_, err = IndexBlockEvents(ctx, suite.db, false, mockBlockEventsDBWrapper(chainID, 1, blockTime), "block 1")
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), lastContiguous(CheckpointBlockEvents))
+	suite.Assert().Equal(int64(4), lastContiguous(CheckpointTxs))
+
+	// A checkpoint ahead of the blocks is reset to them
+	suite.Require().NoError(suite.db.Model(&models.IndexerCheckpoint{}).Where("worker_type = ?", CheckpointTxs).Update("last_contiguous_height", 10).Error)
+	verification, err = VerifyIndexerCheckpoint(ctx, suite.db, chain, CheckpointTxs, 1)
+	suite.Require().NoError(err)
+	suite.Assert().True(verification.Ahead())
+	suite.Assert().Equal(int64(10), verification.Previous)
+	suite.Assert().Equal(int64(4), verification.Scanned)
+	suite.Assert().Equal(int64(4), lastContiguous(CheckpointTxs))
+
+	checkpoints, err := GetIndexerCheckpoints(ctx, suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Require().Len(checkpoints, 2)
+	suite.Assert().Equal(CheckpointBlockEvents, checkpoints[0].WorkerType)
+}
+
+func (suite *DBTestSuite) TestCanonicalAddressHexBackfill() {
+	suite.requirePostgres()
+
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	var expected []string
+	for i := byte(1); i <= 5; i++ {
+		bytes := []byte{i, i, i, i}
+		address, err := bech32.ConvertAndEncode("cosmos", bytes)
+		suite.Require().NoError(err)
+		_, err = FindOrCreateAddressByAddress(context.Background(), suite.db, address)
+		suite.Require().NoError(err)
+		expected = append(expected, hex.EncodeToString(bytes))
+	}
+	_, err = FindOrCreateAddressByAddress(context.Background(), suite.db, "not-bech32")
+	suite.Require().NoError(err)
+	expected = append(expected, "")
+
+	// Rows created before canonical hex was tracked
+	suite.Require().NoError(suite.db.Exec("UPDATE addresses SET canonical_hex = ''").Error)
+
+	job := CanonicalAddressHexBackfill{}
+	var progress []BackfillProgress
+	runner := NewBackfillRunner(suite.db, 2, BackfillThrottle{BackoffInterval: 10 * time.Millisecond})
+	runner.OnProgress = func(p BackfillProgress) { progress = append(progress, p) }
+
+	// A paused job holds until it is resumed
+	suite.Require().ErrorIs(PauseBackfillJob(context.Background(), suite.db, job.Name()), ErrBackfillJobNotFound)
+	_, err = startBackfillJob(suite.db, job.Name())
+	suite.Require().NoError(err)
+	suite.Require().NoError(PauseBackfillJob(context.Background(), suite.db, job.Name()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	suite.Require().ErrorIs(runner.Run(ctx, job), context.DeadlineExceeded)
+	suite.Assert().Empty(progress)
+
+	suite.Require().NoError(ResumeBackfillJob(context.Background(), suite.db, job.Name()))
+	suite.Require().NoError(runner.Run(context.Background(), job))
+	suite.Assert().Len(progress, 3)
+
+	var canonicalHexes []string
+	suite.Require().NoError(suite.db.Model(&models.Address{}).Order("id").Pluck("canonical_hex", &canonicalHexes).Error)
+	suite.Assert().Equal(expected, canonicalHexes)
+
+	jobs, err := GetBackfillJobs(context.Background(), suite.db)
+	suite.Require().NoError(err)
+	suite.Require().Len(jobs, 1)
+	suite.Assert().Equal(models.BackfillCompleted, jobs[0].Status)
+	suite.Assert().Equal(int64(6), jobs[0].RowsProcessed)
+	suite.Assert().NotNil(jobs[0].CompletedAt)
+	suite.Assert().ErrorIs(PauseBackfillJob(context.Background(), suite.db, job.Name()), ErrBackfillJobCompleted)
+
+	// Resetting starts over from the first row
+	suite.Require().NoError(ResetBackfillJob(context.Background(), suite.db, job.Name()))
+	progress = nil
+	suite.Require().NoError(runner.Run(context.Background(), job))
+	suite.Assert().Equal(int64(2), progress[0].RowsProcessed)
+}
+
+func TestDBSuite(t *testing.T) {
+	suite.Run(t, new(DBTestSuite))
+}
+
+func (suite *DBTestSuite) TestIndexQuarantinedAttributes() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	chain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&chain).Error)
+
+	quarantinedBlock := func(height int64, eventTypes ...string) *BlockDBWrapper {
+		wrapper := &BlockDBWrapper{Block: &models.Block{Height: height, ChainID: chain.ID}}
+		for index, eventType := range eventTypes {
+			wrapper.QuarantinedAttributes = append(wrapper.QuarantinedAttributes, models.QuarantinedAttribute{
+				EventType:      eventType,
+				Height:         height,
+				AttributeIndex: uint64(index),
+				RawKey:         []byte("raw\x00key"),
+				Reason:         "key is not valid base64",
+			})
+		}
+		return wrapper
+	}
+
+	suite.Require().NoError(IndexQuarantinedAttributes(context.Background(), suite.db, quarantinedBlock(10, "transfer", "transfer", "mint"), 3))
+	suite.Require().NoError(IndexQuarantinedAttributes(context.Background(), suite.db, quarantinedBlock(11, "transfer", "transfer"), 3))
+	// Reindexing a block counts its attributes again but does not duplicate the samples
+	suite.Require().NoError(IndexQuarantinedAttributes(context.Background(), suite.db, quarantinedBlock(10, "transfer", "transfer", "mint"), 3))
+
+	counts, err := GetQuarantineCounts(context.Background(), suite.db, NewChainRef(chain))
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]QuarantineCount{
+		{EventType: "transfer", Count: 6, Samples: 3, LastSeenHeight: 11},
+		{EventType: "mint", Count: 2, Samples: 1, LastSeenHeight: 10},
+	}, counts)
+
+	var sample models.QuarantinedAttribute
+	suite.Require().NoError(suite.db.Where("height = ? AND event_type = ?", 10, "mint").First(&sample).Error)
+	suite.Assert().Equal([]byte("raw\x00key"), sample.RawKey)
+
+	report, err := GetCompletenessReport(context.Background(), suite.db, NewChainRef(chain), HeightRange{Start: 1, End: 10}, CompletenessRequirements{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), report.QuarantinedHeights)
+	suite.Assert().Equal(counts, report.QuarantineCounts)
+}
+
+func (suite *DBTestSuite) TestWithSnapshot() {
+	suite.requirePostgres()
+
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+	chain := NewChainRef(initChain)
+
+	_, err = createMockBlock(suite.db, initChain, initConsAddress, 1, true, true)
+	suite.Require().NoError(err)
+
+	err = WithSnapshot(context.Background(), suite.db, func(tx *gorm.DB) error {
+		height, err := GetSnapshotHeight(context.Background(), tx, chain)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(int64(1), height)
+
+		// Committed outside the snapshot after it was taken
+		_, err = createMockBlock(suite.db, initChain, initConsAddress, 2, true, true)
+		suite.Require().NoError(err)
+
+		height, err = GetSnapshotHeight(context.Background(), tx, chain)
+		suite.Require().NoError(err)
+		suite.Assert().Equal(int64(1), height)
+		return nil
+	})
+	suite.Require().NoError(err)
+
+	// Snapshots are read only
+	err = WithSnapshot(context.Background(), suite.db, func(tx *gorm.DB) error {
+		return tx.Exec("DELETE FROM blocks").Error
+	})
+	suite.Assert().Error(err)
+
+	height, err := GetSnapshotHeight(context.Background(), suite.db, chain)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(2), height)
+
+	err = WithSnapshotTimeout(context.Background(), suite.db, 50*time.Millisecond, func(tx *gorm.DB) error {
+		return tx.Exec("SELECT pg_sleep(1)").Error
+	})
+	suite.Assert().Error(err)
+}
+
+func (suite *DBTestSuite) TestCompletenessReportWhileIndexing() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+
+	// Index heights in order, each block is committed without its block events and completed in a second commit
+	ctx, cancel := context.WithCancel(context.Background())
+	indexed := make(chan error, 1)
+	go func() {
+		for height := int64(1); ctx.Err() == nil; height++ {
+			block, err := createMockBlock(suite.db, initChain, initConsAddress, height, true, false)
+			if err == nil {
+				err = suite.db.Model(&block).Update("block_events_indexed", true).Error
+			}
+			if err != nil {
+				indexed <- err
+				return
+			}
+		}
+		indexed <- nil
+	}()
+
+	requirements := CompletenessRequirements{Transactions: true, BlockEvents: true}
+	for i := 0; i < 50; i++ {
+		report, err := GetCompletenessReport(context.Background(), suite.db, NewChainRef(initChain), HeightsFrom(1), requirements)
+		suite.Require().NoError(err)
+
+		if report.SnapshotHeight == 0 {
+			continue
+		}
+		suite.Assert().Equal(report.SnapshotHeight, report.Heights.End)
+		suite.Assert().Equal(report.TotalHeights, report.FullyIndexed+report.Partial+report.Missing)
+		suite.Assert().Zero(report.Missing)
+		suite.Assert().Zero(report.GapCount)
+		suite.Assert().LessOrEqual(report.Partial, int64(1))
+	}
+
+	cancel()
+	suite.Require().NoError(<-indexed)
+}
+
+func (suite *DBTestSuite) TestRangeProfiles() {
+	err := MigrateModels(suite.db)
+	suite.Require().NoError(err)
+
+	initChain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(suite.db.Create(&initChain).Error)
+	initConsAddress := models.Address{Address: "cosmosvalcons1"}
+
+	// 1-2 skeleton (txs only), 3 unlabeled, 4-5 full with 5 missing block events
+	for _, block := range []struct {
+		height       int64
+		eventIndexed bool
+		profile      string
+	}{{1, false, "skeleton"}, {2, false, "skeleton"}, {3, false, ""}, {4, true, "full"}, {5, false, "full"}} {
+		created, err := createMockBlock(suite.db, initChain, initConsAddress, block.height, true, block.eventIndexed)
+		suite.Require().NoError(err)
+		suite.Require().NoError(suite.db.Model(&created).Update("index_profile", block.profile).Error)
+	}
+
+	requirements := CompletenessRequirements{
+		Transactions: true,
+		BlockEvents:  true,
+		Profiles: map[string]CompletenessRequirements{
+			"skeleton": {Transactions: true},
+			"full":     {Transactions: true, BlockEvents: true},
+		},
+	}
+	report, err := GetCompletenessReport(context.Background(), suite.db, NewChainRef(initChain), HeightRange{Start: 1, End: 5}, requirements)
+	suite.Require().NoError(err)
+
+	// The skeleton blocks are intentionally missing block events
+	suite.Assert().Equal(int64(3), report.FullyIndexed)
+	suite.Assert().Equal(int64(2), report.Partial)
+	suite.Assert().Equal([]IndexProfileCount{{"", 1}, {"full", 2}, {"skeleton", 2}}, report.IndexProfiles)
+
+	// The full profile now starts at 2
+	profiles := config.RangeProfiles{
+		Ranges: []config.RangeProfile{
+			{Name: "skeleton", StartHeight: 1, EndHeight: 1, IndexTransactions: true},
+			{Name: "full", StartHeight: 2, EndHeight: -1, IndexTransactions: true, IndexBlockEvents: true},
+		},
+	}
+
+	mismatches, err := GetRangeProfileMismatches(context.Background(), suite.db, initChain.ID, profiles)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]RangeProfileMismatch{{Profile: "full", IndexedWith: "skeleton", StartHeight: 2, EndHeight: 2, Blocks: 1}}, mismatches)
+
+	reset, err := ResetRangeProfileMismatches(context.Background(), suite.db, initChain.ID, profiles)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1), reset)
+
+	var block models.Block
+	suite.Require().NoError(suite.db.Where("chain_id = ? AND height = 2", initChain.ID).First(&block).Error)
+	suite.Assert().False(block.TxIndexed)
+	suite.Assert().False(block.BlockEventsIndexed)
+
+	// A default profile covers the heights outside the ranges
+	profiles = config.RangeProfiles{
+		Ranges:  []config.RangeProfile{{Name: "full", StartHeight: 4, EndHeight: -1, IndexTransactions: true, IndexBlockEvents: true}},
+		Default: &config.RangeProfile{Name: "light", IndexTransactions: true},
+	}
+
+	mismatches, err = GetRangeProfileMismatches(context.Background(), suite.db, initChain.ID, profiles)
+	suite.Require().NoError(err)
+	suite.Assert().Equal([]RangeProfileMismatch{{Profile: "light", IndexedWith: "skeleton", StartHeight: 1, EndHeight: 2, Blocks: 2}}, mismatches)
+}
+
+// BenchmarkIndexNewBlocks compares batched INSERTs with COPY inserts on a batch of 10 blocks with 1M message event
+// attributes. Requires Docker.
+//
+//	go test ./db -run '^$' -bench BenchmarkIndexNewBlocks -benchtime 3x
+func BenchmarkIndexNewBlocks(b *testing.B) {
+	for _, copyRows := range []bool{false, true} {
+		name := "insert"
+		if copyRows {
+			name = "copy"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			clean, db, err := SetupTestDatabase()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer clean()
+			if dialectOf(db) != config.DialectPostgres {
+				b.Skipf("requires PostgreSQL, running on %s", dialectOf(db))
+			}
+			if copyRows {
+				if err := db.Use(copyInserts{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			if err := MigrateModels(db); err != nil {
+				b.Fatal(err)
+			}
+
+			chainID, err := GetDBChainID(context.Background(), db, models.Chain{ChainID: "testchain-1"})
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			blockTime := time.Now().UTC().Truncate(time.Microsecond)
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				batch := make([]BlockTxsDBWrapper, 10)
+				for j := range batch {
+					batch[j] = mockEventsBlock(chainID, int64(i*len(batch)+j+1), blockTime, 100, 10, 100)
+				}
+				b.StartTimer()
+
+				if _, err := IndexNewBlocks(context.Background(), db, batch, config.IndexConfig{}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
 }
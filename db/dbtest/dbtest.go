@@ -0,0 +1,114 @@
+// Package dbtest sets up the databases of the tests that use the db package
+package dbtest
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/ory/dockertest/v3"
+	"gorm.io/gorm"
+)
+
+// DialectEnv selects the database container of Setup, postgres (the default) or cockroachdb
+const DialectEnv = "TEST_DB_DIALECT"
+
+// URLEnv points Setup at an existing PostgreSQL database instead of a container. The public schema of the database is
+// dropped before and after every test, only use a scratch database.
+const URLEnv = "TEST_DB_URL"
+
+// Setup starts a PostgreSQL container for the test, or a CockroachDB container when TEST_DB_DIALECT is cockroachdb.
+// With TEST_DB_URL set it uses that database instead. When Docker is not available it falls back to an in-memory SQLite
+// database, tests that need PostgreSQL have to skip themselves on it. The returned func removes the database.
+func Setup() (func(), *gorm.DB, error) {
+	if url := os.Getenv(URLEnv); url != "" {
+		return setupExisting(url)
+	}
+
+	pool, err := dockertest.NewPool("")
+	if err == nil {
+		err = pool.Client.Ping()
+	}
+	if err != nil {
+		log.Printf("Docker is not available, using an in-memory SQLite database: %v", err)
+		db, err := dbTypes.SqliteDbConnect(":memory:", "debug")
+		return func() {}, db, err
+	}
+
+	dbConfig := config.Database{Database: "test", User: "test", Password: "test", LogLevel: "debug"}
+	containerPort := "5432/tcp"
+	runOptions := &dockertest.RunOptions{
+		Repository: "postgres",
+		Tag:        "15-alpine",
+		Env:        []string{"POSTGRES_USER=test", "POSTGRES_PASSWORD=test", "POSTGRES_DB=test"},
+	}
+
+	switch dialect := os.Getenv(DialectEnv); dialect {
+	case "", config.DialectPostgres:
+	case config.DialectCockroachDB:
+		// Insecure single node clusters only accept the root user without a password
+		dbConfig = config.Database{Database: "defaultdb", User: "root", LogLevel: "debug", Dialect: config.DialectCockroachDB}
+		containerPort = "26257/tcp"
+		runOptions = &dockertest.RunOptions{
+			Repository: "cockroachdb/cockroach",
+			Tag:        "latest-v23.1",
+			Cmd:        []string{"start-single-node", "--insecure"},
+		}
+	default:
+		return nil, nil, fmt.Errorf("%s %q is invalid, must be one of %s", DialectEnv, dialect, strings.Join(config.Dialects, ", "))
+	}
+
+	resource, err := pool.RunWithOptions(runOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dbConfig.Host = resource.GetBoundIP(containerPort)
+	dbConfig.Port = resource.GetPort(containerPort)
+
+	var db *gorm.DB
+	if err := pool.Retry(func() error {
+		var err error
+		db, err = dbTypes.PostgresDbConnectWithConfig(dbConfig, dbTypes.ConnectOptions{})
+		return err
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	clean := func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Fatalf("Could not purge resource: %s", err)
+		}
+	}
+
+	return clean, db, nil
+}
+
+// setupExisting connects to the database of TEST_DB_URL and empties its public schema for the test
+func setupExisting(url string) (func(), *gorm.DB, error) {
+	db, err := dbTypes.PostgresDbConnectWithConfig(config.Database{URL: url, LogLevel: "debug"}, dbTypes.ConnectOptions{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reset := func() error {
+		return db.Exec("DROP SCHEMA IF EXISTS public CASCADE; CREATE SCHEMA public").Error
+	}
+	if err := reset(); err != nil {
+		return nil, nil, err
+	}
+
+	clean := func() {
+		if err := reset(); err != nil {
+			log.Fatalf("Could not reset the test database: %s", err)
+		}
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	}
+
+	return clean, db, nil
+}
@@ -0,0 +1,29 @@
+package db
+
+import (
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"gorm.io/gorm"
+)
+
+const cockroachDBPluginName = "cosmos-indexer:cockroachdb"
+
+// cockroachDB marks a connection opened with the PostgreSQL driver as a CockroachDB connection. gorm cannot tell the two
+// apart, both report the postgres dialector.
+type cockroachDB struct{}
+
+func (cockroachDB) Name() string {
+	return cockroachDBPluginName
+}
+
+func (cockroachDB) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// dialectOf returns the dialect of the connection: config.DialectPostgres, config.DialectCockroachDB or the name of
+// another gorm dialector, like sqlite
+func dialectOf(db *gorm.DB) string {
+	if _, ok := db.Config.Plugins[cockroachDBPluginName]; ok {
+		return config.DialectCockroachDB
+	}
+	return db.Dialector.Name()
+}
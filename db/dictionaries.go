@@ -0,0 +1,67 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// findOrCreateDictionary returns the rows of the dictionary table of M, like message_types, whose column holds one of the
+// values, by value, inserting the values missing from the table.
+//
+// The existing rows are selected first and only the missing values are inserted, with ON CONFLICT DO NOTHING for the
+// values a concurrent transaction inserted since. An upsert of every value would take a value of the ID sequence for
+// each row, conflicting or not, while the values of a block are almost always known already. The inserted rows are
+// selected again afterwards for their IDs: RETURNING skips the rows that conflicted, so gorm would assign the returned
+// IDs to the wrong rows. The values are inserted in order, so concurrent transactions lock the rows in the same order
+// and do not deadlock.
+func findOrCreateDictionary[M any](db *gorm.DB, column string, values []string, newRow func(value string) M, valueOf func(row M) string) (map[string]M, error) {
+	rowsByValue := make(map[string]M, len(values))
+	if len(values) == 0 {
+		return rowsByValue, nil
+	}
+
+	sorted := append([]string(nil), values...)
+	slices.Sort(sorted)
+
+	selectRows := func(values []string) error {
+		var rows []M
+		if err := db.Where(fmt.Sprintf("%s IN ?", column), values).Find(&rows).Error; err != nil {
+			return err
+		}
+		for _, row := range rows {
+			rowsByValue[valueOf(row)] = row
+		}
+		return nil
+	}
+
+	if err := selectRows(sorted); err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	var missingRows []M
+	for _, value := range sorted {
+		if _, ok := rowsByValue[value]; !ok {
+			missing = append(missing, value)
+			missingRows = append(missingRows, newRow(value))
+		}
+	}
+	if len(missing) == 0 {
+		return rowsByValue, nil
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: column}},
+		DoNothing: true,
+	}).CreateInBatches(missingRows, insertBatchSize(db)).Error; err != nil {
+		return nil, err
+	}
+
+	if err := selectRows(missing); err != nil {
+		return nil, err
+	}
+	return rowsByValue, nil
+}
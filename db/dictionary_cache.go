@@ -0,0 +1,139 @@
+package db
+
+import (
+	"sync"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+const dictionaryCachePluginName = "cosmos-indexer:dictionary-cache"
+
+// maxDictionaryCacheSize bounds each dictionary of the cache, a full dictionary is emptied and filled again with the
+// values seen since. Chains emitting arbitrary attribute keys would otherwise grow it without limit.
+const maxDictionaryCacheSize = 10000
+
+// dictionaryCache remembers the IDs of the message types, message event types and message event attribute keys of the
+// connection it is registered on, so the dictionary upserts of IndexNewBlocks only send the values not seen before.
+//
+// IDs are only added once the transaction that resolved them has committed, a rolled back insert would otherwise leave
+// the cache pointing at rows that do not exist. The cache is emptied when a transaction fails, which also drops the IDs
+// of rows deleted behind its back, e.g. by a purge-chain from another process. The dictionaries are not chain specific,
+// the chains indexed next to each other on the connection share the cache.
+type dictionaryCache struct {
+	messageTypes      idCache
+	messageEventTypes idCache
+	attributeKeys     idCache
+}
+
+// idCache is one dictionary of the cache, IDs by value
+type idCache struct {
+	mu  sync.RWMutex
+	ids map[string]uint
+}
+
+func newDictionaryCache() *dictionaryCache {
+	return &dictionaryCache{}
+}
+
+func (c *dictionaryCache) Name() string {
+	return dictionaryCachePluginName
+}
+
+func (c *dictionaryCache) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// dictionaryCacheOf returns the dictionary cache registered on db, nil when there is none
+func dictionaryCacheOf(db *gorm.DB) *dictionaryCache {
+	c, _ := db.Config.Plugins[dictionaryCachePluginName].(*dictionaryCache)
+	return c
+}
+
+// store adds the IDs of committed message types, event types and attribute keys to the cache
+func (c *dictionaryCache) store(messageTypes map[string]models.MessageType, messageEventTypes map[string]models.MessageEventType, attributeKeys map[string]models.MessageEventAttributeKey) {
+	if c == nil {
+		return
+	}
+
+	ids := make(map[string]uint, len(messageTypes))
+	for value, messageType := range messageTypes {
+		ids[value] = messageType.ID
+	}
+	c.messageTypes.store(ids)
+
+	ids = make(map[string]uint, len(messageEventTypes))
+	for value, messageEventType := range messageEventTypes {
+		ids[value] = messageEventType.ID
+	}
+	c.messageEventTypes.store(ids)
+
+	ids = make(map[string]uint, len(attributeKeys))
+	for value, attributeKey := range attributeKeys {
+		ids[value] = attributeKey.ID
+	}
+	c.attributeKeys.store(ids)
+}
+
+// reset empties the cache
+func (c *dictionaryCache) reset() {
+	if c == nil {
+		return
+	}
+	c.messageTypes.reset()
+	c.messageEventTypes.reset()
+	c.attributeKeys.reset()
+}
+
+// get returns the ID of the value, 0 when it is not cached
+func (c *idCache) get(value string) uint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ids[value]
+}
+
+// store adds the IDs by value, IDs of 0 are skipped
+func (c *idCache) store(ids map[string]uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for value, id := range ids {
+		if id == 0 || c.ids[value] == id {
+			continue
+		}
+		if c.ids == nil || len(c.ids) >= maxDictionaryCacheSize {
+			c.ids = make(map[string]uint)
+		}
+		c.ids[value] = id
+	}
+}
+
+func (c *idCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ids = nil
+}
+
+// messageTypeID returns the cached ID of the message type, 0 when there is no cache or it is not cached
+func (c *dictionaryCache) messageTypeID(value string) uint {
+	if c == nil {
+		return 0
+	}
+	return c.messageTypes.get(value)
+}
+
+// messageEventTypeID returns the cached ID of the message event type, like messageTypeID
+func (c *dictionaryCache) messageEventTypeID(value string) uint {
+	if c == nil {
+		return 0
+	}
+	return c.messageEventTypes.get(value)
+}
+
+// attributeKeyID returns the cached ID of the message event attribute key, like messageTypeID
+func (c *dictionaryCache) attributeKeyID(value string) uint {
+	if c == nil {
+		return 0
+	}
+	return c.attributeKeys.get(value)
+}
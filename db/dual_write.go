@@ -0,0 +1,661 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultDualWriteQueueSize is the number of secondary writes queued behind the one in progress before new writes are
+	// dropped
+	DefaultDualWriteQueueSize = 64
+	// DefaultDualWriteTimeout bounds each secondary write, including connecting to the secondary
+	DefaultDualWriteTimeout = 30 * time.Second
+)
+
+var errDualWriteQueueFull = errors.New("dual write queue is full, the secondary database is not keeping up")
+
+// DualWriter mirrors block indexing writes to a secondary database while a migration to a new database cluster is in progress.
+// The primary database is the source of truth: the secondary writes run on a queue in the background, each with its own
+// deadline, so an unavailable or hanging secondary can never fail or stall indexing on the primary. Failed writes, and
+// writes dropped while the queue is full, are logged and counted but never returned to the caller.
+type DualWriter struct {
+	Primary      *gorm.DB
+	Secondary    *gorm.DB
+	WriteTimeout time.Duration // Deadline of each secondary write, set before the first write
+	chain        models.Chain
+
+	queue              chan dualWrite
+	done               chan struct{}
+	ctx                context.Context // Cancelled by Close to stop the writes still queued
+	cancel             context.CancelFunc
+	secondaryChainDBID uint // Only used by the background writer
+
+	mu     sync.Mutex
+	closed bool
+	stats  DualWriteStats
+}
+
+// DualWriteStats tracks the health of the secondary database writes
+type DualWriteStats struct {
+	SecondaryWrites    uint64
+	SecondaryFailures  uint64
+	LastFailedHeight   int64
+	LastSecondaryError string
+}
+
+type dualWrite struct {
+	ctx    context.Context
+	height int64
+	write  func(ctx context.Context, secondaryChainID uint) error
+}
+
+// NewDualWriter starts the background writer of the secondary database, stop it with Close
+func NewDualWriter(primary *gorm.DB, secondary *gorm.DB, chain models.Chain) *DualWriter {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &DualWriter{
+		Primary:      primary,
+		Secondary:    secondary,
+		WriteTimeout: DefaultDualWriteTimeout,
+		chain:        chain,
+		queue:        make(chan dualWrite, DefaultDualWriteQueueSize),
+		done:         make(chan struct{}),
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+	go w.run()
+	return w
+}
+
+// Stats returns a snapshot of the secondary write counters
+func (w *DualWriter) Stats() DualWriteStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.stats
+}
+
+// Close stops accepting writes and waits for the queued secondary writes. When ctx is done first, the remaining writes
+// are cancelled and counted as failures.
+func (w *DualWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		w.cancel()
+		<-w.done
+		return ctx.Err()
+	}
+}
+
+// IndexNewBlock indexes the block on the primary database, and on success mirrors the same block to the secondary database.
+// Only primary errors are returned.
+func (w *DualWriter) IndexNewBlock(ctx context.Context, block models.Block, txs []TxDBWrapper, indexerConfig config.IndexConfig) (models.Block, []TxDBWrapper, error) {
+	// IndexNewBlock loads IDs into the passed in wrappers, the secondary needs its own untouched copy so primary IDs do not leak across databases
+	secondaryBlock := cloneBlock(block)
+	secondaryTxs := cloneTxDBWrappers(txs)
+
+	indexedBlock, indexedTxs, err := IndexNewBlock(ctx, w.Primary, block, txs, indexerConfig)
+	if err != nil {
+		return indexedBlock, indexedTxs, err
+	}
+
+	w.mirror(ctx, block.Height, func(ctx context.Context, secondaryChainID uint) error {
+		secondaryBlock.ChainID = secondaryChainID
+		_, _, err := IndexNewBlock(ctx, w.Secondary, secondaryBlock, secondaryTxs, indexerConfig)
+		return err
+	})
+
+	return indexedBlock, indexedTxs, nil
+}
+
+// IndexNewBlocks indexes the batch of blocks on the primary database, and on success mirrors the same batch to the
+// secondary database. Only primary errors are returned.
+func (w *DualWriter) IndexNewBlocks(ctx context.Context, blocks []BlockTxsDBWrapper, indexerConfig config.IndexConfig) ([]BlockTxsDBWrapper, error) {
+	secondaryBlocks := make([]BlockTxsDBWrapper, len(blocks))
+	for i, block := range blocks {
+		secondaryBlocks[i] = CloneBlockTxsDBWrapper(block)
+	}
+
+	indexedBlocks, err := IndexNewBlocks(ctx, w.Primary, blocks, indexerConfig)
+	if err != nil || len(blocks) == 0 {
+		return indexedBlocks, err
+	}
+
+	w.mirror(ctx, blocks[len(blocks)-1].Block.Height, func(ctx context.Context, secondaryChainID uint) error {
+		for i := range secondaryBlocks {
+			secondaryBlocks[i].Block.ChainID = secondaryChainID
+		}
+		_, err := IndexNewBlocks(ctx, w.Secondary, secondaryBlocks, indexerConfig)
+		return err
+	})
+
+	return indexedBlocks, nil
+}
+
+// IndexBlockEvents indexes the block events on the primary database, and on success mirrors the same block events to the secondary database.
+// Only primary errors are returned.
+func (w *DualWriter) IndexBlockEvents(ctx context.Context, dryRun bool, blockDBWrapper *BlockDBWrapper, identifierLoggingString string) (*BlockDBWrapper, error) {
+	secondaryBlockDBWrapper := cloneBlockDBWrapper(blockDBWrapper)
+
+	indexedDataset, err := IndexBlockEvents(ctx, w.Primary, dryRun, blockDBWrapper, identifierLoggingString)
+	if err != nil {
+		return indexedDataset, err
+	}
+
+	w.mirror(ctx, blockDBWrapper.Block.Height, func(ctx context.Context, secondaryChainID uint) error {
+		secondaryBlockDBWrapper.Block.ChainID = secondaryChainID
+		_, err := IndexBlockEvents(ctx, w.Secondary, dryRun, secondaryBlockDBWrapper, identifierLoggingString)
+		return err
+	})
+
+	return indexedDataset, nil
+}
+
+// mirror queues the secondary write without waiting for it, the write is dropped when the queue is full
+func (w *DualWriter) mirror(ctx context.Context, height int64, write func(ctx context.Context, secondaryChainID uint) error) {
+	if w.Secondary == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.stats.SecondaryWrites++
+	if w.closed {
+		w.recordFailure(height, errors.New("dual writer is closed"))
+		return
+	}
+
+	// The write outlives the caller, it keeps the values of its context (like the trace) but not its cancellation
+	select {
+	case w.queue <- dualWrite{ctx: context.WithoutCancel(ctx), height: height, write: write}:
+	default:
+		w.recordFailure(height, errDualWriteQueueFull)
+	}
+}
+
+func (w *DualWriter) run() {
+	defer close(w.done)
+
+	for job := range w.queue {
+		err := w.ctx.Err()
+		if err == nil {
+			err = w.write(job)
+		}
+
+		if err != nil {
+			w.mu.Lock()
+			w.recordFailure(job.height, err)
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *DualWriter) write(job dualWrite) error {
+	ctx, cancel := context.WithTimeout(job.ctx, w.WriteTimeout)
+	defer cancel()
+
+	// Close cancels the writes still running when its context is done
+	stop := context.AfterFunc(w.ctx, cancel)
+	defer stop()
+
+	if err := w.resolveSecondaryChainID(ctx); err != nil {
+		return err
+	}
+	return job.write(ctx, w.secondaryChainDBID)
+}
+
+// recordFailure counts a failed secondary write, w.mu must be held
+func (w *DualWriter) recordFailure(height int64, err error) {
+	w.stats.SecondaryFailures++
+	w.stats.LastFailedHeight = height
+	w.stats.LastSecondaryError = err.Error()
+	config.Log.Warnf("Dual write to secondary database failed for block %d (%d failures out of %d writes). Err: %v", height, w.stats.SecondaryFailures, w.stats.SecondaryWrites, err)
+}
+
+// The chain primary key is not guaranteed to match across databases, resolve (and retry resolving) it on the secondary
+func (w *DualWriter) resolveSecondaryChainID(ctx context.Context) error {
+	if w.secondaryChainDBID != 0 {
+		return nil
+	}
+
+	chainID, err := GetDBChainID(ctx, w.Secondary, w.chain)
+	if err != nil {
+		return err
+	}
+
+	w.secondaryChainDBID = chainID
+	return nil
+}
+
+func cloneBlock(block models.Block) models.Block {
+	block.ID = 0
+	block.ProposerConsAddressID = 0
+	block.ProposerConsAddress.ID = 0
+	block.ProposerValidatorID = nil
+	block.ProposerValidator = nil
+
+	failedTxs := block.FailedTxs
+	block.FailedTxs = nil
+	for _, failedTx := range failedTxs {
+		block.FailedTxs = append(block.FailedTxs, models.FailedTx{Hash: failedTx.Hash, Error: failedTx.Error, TxBytes: failedTx.TxBytes})
+	}
+	return block
+}
+
+func cloneBlockDBWrapper(blockDBWrapper *BlockDBWrapper) *BlockDBWrapper {
+	block := cloneBlock(*blockDBWrapper.Block)
+
+	clone := &BlockDBWrapper{
+		Block:                         &block,
+		BeginBlockEvents:              cloneBlockEventDBWrappers(blockDBWrapper.BeginBlockEvents),
+		EndBlockEvents:                cloneBlockEventDBWrappers(blockDBWrapper.EndBlockEvents),
+		UniqueBlockEventTypes:         make(map[string]models.BlockEventType, len(blockDBWrapper.UniqueBlockEventTypes)),
+		UniqueBlockEventAttributeKeys: make(map[string]models.BlockEventAttributeKey, len(blockDBWrapper.UniqueBlockEventAttributeKeys)),
+	}
+
+	for key := range blockDBWrapper.UniqueBlockEventTypes {
+		clone.UniqueBlockEventTypes[key] = models.BlockEventType{Type: key}
+	}
+
+	for key := range blockDBWrapper.UniqueBlockEventAttributeKeys {
+		clone.UniqueBlockEventAttributeKeys[key] = models.BlockEventAttributeKey{Key: key}
+	}
+
+	return clone
+}
+
+func cloneBlockEventDBWrappers(events []BlockEventDBWrapper) []BlockEventDBWrapper {
+	clones := make([]BlockEventDBWrapper, len(events))
+	for index, event := range events {
+		clones[index].BlockEvent = models.BlockEvent{
+			Index:             event.BlockEvent.Index,
+			LifecyclePosition: event.BlockEvent.LifecyclePosition,
+			BlockEventType:    models.BlockEventType{Type: event.BlockEvent.BlockEventType.Type},
+		}
+
+		clones[index].Attributes = make([]models.BlockEventAttribute, len(event.Attributes))
+		for attrIndex, attribute := range event.Attributes {
+			clones[index].Attributes[attrIndex] = models.BlockEventAttribute{
+				Value:                  attribute.Value,
+				ValueBytes:             attribute.ValueBytes,
+				Sanitized:              attribute.Sanitized,
+				Index:                  attribute.Index,
+				BlockEventAttributeKey: models.BlockEventAttributeKey{Key: attribute.BlockEventAttributeKey.Key},
+			}
+		}
+	}
+	return clones
+}
+
+// CloneBlockTxsDBWrapper returns a copy of the block and its txs without the IDs loaded by indexing them, to index them
+// again after a failed IndexNewBlocks. Parsed message datasets are shared with the original.
+func CloneBlockTxsDBWrapper(block BlockTxsDBWrapper) BlockTxsDBWrapper {
+	return BlockTxsDBWrapper{Block: cloneBlock(block.Block), Txs: cloneTxDBWrappers(block.Txs)}
+}
+
+func cloneTxDBWrappers(txs []TxDBWrapper) []TxDBWrapper {
+	clones := make([]TxDBWrapper, len(txs))
+	for txIndex, tx := range txs {
+		clone := TxDBWrapper{
+			Tx: models.Tx{
+				Hash:         tx.Tx.Hash,
+				Code:         tx.Tx.Code,
+				GasWanted:    tx.Tx.GasWanted,
+				GasUsed:      tx.Tx.GasUsed,
+				Memo:         tx.Tx.Memo,
+				ErrorMessage: tx.Tx.ErrorMessage,
+			},
+			UniqueMessageTypes:         make(map[string]models.MessageType, len(tx.UniqueMessageTypes)),
+			UniqueMessageEventTypes:    make(map[string]models.MessageEventType, len(tx.UniqueMessageEventTypes)),
+			UniqueMessageAttributeKeys: make(map[string]models.MessageEventAttributeKey, len(tx.UniqueMessageAttributeKeys)),
+			WatchedAddresses:           tx.WatchedAddresses,
+		}
+
+		for _, signerAddress := range tx.Tx.SignerAddresses {
+			clone.Tx.SignerAddresses = append(clone.Tx.SignerAddresses, models.Address{Address: signerAddress.Address})
+		}
+
+		for _, fee := range tx.Tx.Fees {
+			feeClone := models.Fee{
+				Amount:       fee.Amount,
+				Denomination: models.Denom{Base: fee.Denomination.Base},
+				PayerAddress: models.Address{Address: fee.PayerAddress.Address},
+			}
+			if fee.GranterAddress != nil {
+				feeClone.GranterAddress = &models.Address{Address: fee.GranterAddress.Address}
+			}
+			clone.Tx.Fees = append(clone.Tx.Fees, feeClone)
+		}
+
+		for key := range tx.UniqueMessageTypes {
+			clone.UniqueMessageTypes[key] = models.MessageType{MessageType: key}
+		}
+
+		for key := range tx.UniqueMessageEventTypes {
+			clone.UniqueMessageEventTypes[key] = models.MessageEventType{Type: key}
+		}
+
+		for key := range tx.UniqueMessageAttributeKeys {
+			clone.UniqueMessageAttributeKeys[key] = models.MessageEventAttributeKey{Key: key}
+		}
+
+		for _, failedMessage := range tx.FailedMessages {
+			clone.FailedMessages = append(clone.FailedMessages, models.FailedMessage{
+				MessageIndex: failedMessage.MessageIndex,
+				Error:        failedMessage.Error,
+				TypeURL:      failedMessage.TypeURL,
+				MessageBytes: failedMessage.MessageBytes,
+			})
+		}
+
+		clone.Messages = make([]MessageDBWrapper, len(tx.Messages))
+		for messageIndex, message := range tx.Messages {
+			clone.Messages[messageIndex].Message = models.Message{
+				MessageIndex: message.Message.MessageIndex,
+				MessageType:  models.MessageType{MessageType: message.Message.MessageType.MessageType},
+				MessageBytes: message.Message.MessageBytes,
+				Value:        message.Message.Value,
+			}
+			clone.Messages[messageIndex].MessageParsedDatasets = message.MessageParsedDatasets
+
+			clone.Messages[messageIndex].MessageEvents = make([]MessageEventDBWrapper, len(message.MessageEvents))
+			for eventIndex, event := range message.MessageEvents {
+				clone.Messages[messageIndex].MessageEvents[eventIndex].MessageEvent = models.MessageEvent{
+					Index:            event.MessageEvent.Index,
+					MessageEventType: models.MessageEventType{Type: event.MessageEvent.MessageEventType.Type},
+				}
+
+				attributes := make([]models.MessageEventAttribute, len(event.Attributes))
+				for attrIndex, attribute := range event.Attributes {
+					attributes[attrIndex] = models.MessageEventAttribute{
+						Value:                    attribute.Value,
+						ValueBytes:               attribute.ValueBytes,
+						Sanitized:                attribute.Sanitized,
+						Index:                    attribute.Index,
+						MessageEventAttributeKey: models.MessageEventAttributeKey{Key: attribute.MessageEventAttributeKey.Key},
+					}
+				}
+				clone.Messages[messageIndex].MessageEvents[eventIndex].Attributes = attributes
+			}
+		}
+
+		clones[txIndex] = clone
+	}
+	return clones
+}
+
+// ConvergenceReport compares the indexing watermarks and sampled row counts between a primary and secondary database.
+// The secondary has converged when its watermarks have caught up to the primary and all sampled heights match.
+type ConvergenceReport struct {
+	ChainID                    string
+	PrimaryHighestTxBlock      int64
+	SecondaryHighestTxBlock    int64
+	PrimaryHighestEventBlock   int64
+	SecondaryHighestEventBlock int64
+	TxWatermarkLag             int64
+	EventWatermarkLag          int64
+	SampledHeights             []HeightRowCounts
+	MismatchedSampledHeights   int
+	Converged                  bool
+}
+
+// HeightRowCounts holds the rows indexed for a single height in each database
+type HeightRowCounts struct {
+	Height               int64
+	PrimaryTxs           int64
+	SecondaryTxs         int64
+	PrimaryMessages      int64
+	SecondaryMessages    int64
+	PrimaryBlockEvents   int64
+	SecondaryBlockEvents int64
+}
+
+func (c HeightRowCounts) Matches() bool {
+	return c.PrimaryTxs == c.SecondaryTxs && c.PrimaryMessages == c.SecondaryMessages && c.PrimaryBlockEvents == c.SecondaryBlockEvents
+}
+
+// GetConvergenceReport builds a ConvergenceReport for the chain, sampling sampleSize evenly spaced heights between the lowest and highest
+// heights indexed on the primary.
+func GetConvergenceReport(ctx context.Context, primary *gorm.DB, secondary *gorm.DB, chainID string, sampleSize int) (ConvergenceReport, error) {
+	primary = primary.WithContext(ctx)
+	secondary = secondary.WithContext(ctx)
+	report := ConvergenceReport{ChainID: chainID}
+
+	primaryChain, err := GetChainByChainID(ctx, primary, chainID)
+	if err != nil {
+		return report, fmt.Errorf("error finding chain on primary: %w", err)
+	}
+
+	if primaryChain.ID == 0 {
+		return report, fmt.Errorf("chain %s has not been indexed on the primary", chainID)
+	}
+
+	secondaryChain, err := GetChainByChainID(ctx, secondary, chainID)
+	if err != nil {
+		return report, fmt.Errorf("error finding chain on secondary: %w", err)
+	}
+
+	report.PrimaryHighestTxBlock, report.PrimaryHighestEventBlock, err = getIndexedWatermarks(ctx, primary, primaryChain.ID)
+	if err != nil {
+		return report, fmt.Errorf("error getting primary watermarks: %w", err)
+	}
+
+	if secondaryChain.ID != 0 {
+		report.SecondaryHighestTxBlock, report.SecondaryHighestEventBlock, err = getIndexedWatermarks(ctx, secondary, secondaryChain.ID)
+		if err != nil {
+			return report, fmt.Errorf("error getting secondary watermarks: %w", err)
+		}
+	}
+
+	report.TxWatermarkLag = report.PrimaryHighestTxBlock - report.SecondaryHighestTxBlock
+	report.EventWatermarkLag = report.PrimaryHighestEventBlock - report.SecondaryHighestEventBlock
+
+	var lowestHeight int64
+	if err := primary.Table("blocks").Select("COALESCE(MIN(height), 0)").Where("chain_id = ?", primaryChain.ID).Scan(&lowestHeight).Error; err != nil {
+		return report, fmt.Errorf("error getting lowest primary height: %w", err)
+	}
+
+	highestHeight := report.PrimaryHighestTxBlock
+	if report.PrimaryHighestEventBlock > highestHeight {
+		highestHeight = report.PrimaryHighestEventBlock
+	}
+
+	for _, height := range sampleHeights(lowestHeight, highestHeight, sampleSize) {
+		counts := HeightRowCounts{Height: height}
+
+		counts.PrimaryTxs, counts.PrimaryMessages, counts.PrimaryBlockEvents, err = getHeightRowCounts(primary, primaryChain.ID, height)
+		if err != nil {
+			return report, fmt.Errorf("error getting primary row counts for height %d: %w", height, err)
+		}
+
+		if secondaryChain.ID != 0 {
+			counts.SecondaryTxs, counts.SecondaryMessages, counts.SecondaryBlockEvents, err = getHeightRowCounts(secondary, secondaryChain.ID, height)
+			if err != nil {
+				return report, fmt.Errorf("error getting secondary row counts for height %d: %w", height, err)
+			}
+		}
+
+		if !counts.Matches() {
+			report.MismatchedSampledHeights++
+		}
+
+		report.SampledHeights = append(report.SampledHeights, counts)
+	}
+
+	report.Converged = report.TxWatermarkLag <= 0 && report.EventWatermarkLag <= 0 && report.MismatchedSampledHeights == 0
+
+	return report, nil
+}
+
+func getIndexedWatermarks(ctx context.Context, db *gorm.DB, chainID uint) (int64, int64, error) {
+	txBlock, _, err := GetHighestIndexedBlock(ctx, db, chainID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	eventBlock, err := GetHighestEventIndexedBlock(ctx, db, chainID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return txBlock.Height, eventBlock.Height, nil
+}
+
+func getHeightRowCounts(db *gorm.DB, chainID uint, height int64) (txs int64, messages int64, blockEvents int64, err error) {
+	err = db.Table("txes").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND blocks.height = ?", chainID, height).
+		Count(&txs).Error
+	if err != nil {
+		return
+	}
+
+	err = db.Table("messages").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND blocks.height = ?", chainID, height).
+		Count(&messages).Error
+	if err != nil {
+		return
+	}
+
+	err = db.Table("block_events").
+		Joins("JOIN blocks ON blocks.id = block_events.block_id").
+		Where("blocks.chain_id = ? AND blocks.height = ?", chainID, height).
+		Count(&blockEvents).Error
+	return
+}
+
+func sampleHeights(lowest int64, highest int64, sampleSize int) []int64 {
+	if sampleSize <= 0 || highest <= 0 || lowest > highest {
+		return nil
+	}
+
+	span := highest - lowest + 1
+	if int64(sampleSize) >= span {
+		heights := make([]int64, 0, span)
+		for height := lowest; height <= highest; height++ {
+			heights = append(heights, height)
+		}
+		return heights
+	}
+
+	heights := make([]int64, 0, sampleSize)
+	step := 0.0
+	if sampleSize > 1 {
+		step = float64(span-1) / float64(sampleSize-1)
+	}
+	for i := 0; i < sampleSize; i++ {
+		heights = append(heights, lowest+int64(float64(i)*step))
+	}
+	return heights
+}
+
+// ChainCutOverError is returned by CheckChainCutover when the chain was cut over from the database to a new primary
+type ChainCutOverError struct {
+	ChainID   string
+	Target    string
+	CutOverAt time.Time
+}
+
+func (e *ChainCutOverError) Error() string {
+	return fmt.Sprintf("chain %s was cut over to %s at %s, this database is no longer its primary", e.ChainID, e.Target, e.CutOverAt.UTC().Format(time.RFC3339))
+}
+
+// CheckChainCutover returns a *ChainCutOverError when the chain was cut over from the database by CutOver
+func CheckChainCutover(ctx context.Context, db *gorm.DB, chainID string) error {
+	chain, err := GetChainByChainID(ctx, db, chainID)
+	if err != nil || chain.ID == 0 {
+		return err
+	}
+
+	var cutovers []models.ChainCutover
+	if err := db.WithContext(ctx).Where("chain_id = ?", chain.ID).Limit(1).Find(&cutovers).Error; err != nil {
+		return err
+	}
+	if len(cutovers) == 0 {
+		return nil
+	}
+	return &ChainCutOverError{ChainID: chainID, Target: cutovers[0].Target, CutOverAt: cutovers[0].CutOverAt}
+}
+
+// CutOver hands the chain over from the primary database of dual write mode to the secondary database. It takes the
+// chain lock on both databases, so it fails while an indexer runs on either, and compares them with GetConvergenceReport
+// while the locks are held. Unless force is set, a secondary that has not converged is refused. The cutover is then
+// recorded on the primary, target describes the secondary in the record.
+// Once recorded, CheckChainCutover fails for the chain on the old primary and the index command promotes the secondary.
+func CutOver(ctx context.Context, primary *gorm.DB, secondary *gorm.DB, chainID string, target string, sampleSize int, force bool) (ConvergenceReport, error) {
+	report := ConvergenceReport{ChainID: chainID}
+
+	primaryChain, err := GetChainRef(ctx, primary, chainID)
+	if err != nil {
+		return report, fmt.Errorf("error finding chain on primary: %w", err)
+	}
+	if primaryChain.ID == 0 {
+		return report, fmt.Errorf("chain %s has not been indexed on the primary", chainID)
+	}
+	secondaryChain, err := GetChainRef(ctx, secondary, chainID)
+	if err != nil {
+		return report, fmt.Errorf("error finding chain on secondary: %w", err)
+	}
+	if secondaryChain.ID == 0 {
+		return report, fmt.Errorf("chain %s has not been indexed on the secondary", chainID)
+	}
+
+	if err := CheckChainCutover(ctx, secondary, chainID); err != nil {
+		return report, fmt.Errorf("secondary: %w", err)
+	}
+
+	primaryLock, err := AcquireChainLock(ctx, primary, primaryChain)
+	if err != nil {
+		return report, fmt.Errorf("error locking chain on primary, stop its indexers first: %w", err)
+	}
+	defer func() {
+		if err := primaryLock.Release(); err != nil {
+			config.Log.Error("Failed to release the chain lock on the primary", err)
+		}
+	}()
+
+	secondaryLock, err := AcquireChainLock(ctx, secondary, secondaryChain)
+	if err != nil {
+		return report, fmt.Errorf("error locking chain on secondary, stop its indexers first: %w", err)
+	}
+	defer func() {
+		if err := secondaryLock.Release(); err != nil {
+			config.Log.Error("Failed to release the chain lock on the secondary", err)
+		}
+	}()
+
+	report, err = GetConvergenceReport(ctx, primary, secondary, chainID, sampleSize)
+	if err != nil {
+		return report, err
+	}
+	if !report.Converged && !force {
+		return report, fmt.Errorf("secondary has not converged with the primary for chain %s", chainID)
+	}
+
+	err = primary.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := CheckChainCutover(ctx, tx, chainID); err != nil {
+			return fmt.Errorf("primary: %w", err)
+		}
+
+		return tx.Create(&models.ChainCutover{ChainID: primaryChain.ID, Target: target, CutOverAt: time.Now()}).Error
+	})
+
+	return report, err
+}
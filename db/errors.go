@@ -0,0 +1,112 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// ErrUnsupportedDialect is returned by helpers that rely on features of a database dialect the connection is not using
+var ErrUnsupportedDialect = errors.New("unsupported database dialect")
+
+// requireDialect returns ErrUnsupportedDialect if db is not using one of the dialects
+func requireDialect(db *gorm.DB, dialects ...string) error {
+	dialect := dialectOf(db)
+	if slices.Contains(dialects, dialect) {
+		return nil
+	}
+	return fmt.Errorf("%w %s, this requires %s", ErrUnsupportedDialect, dialect, strings.Join(dialects, " or "))
+}
+
+// requirePostgres returns ErrUnsupportedDialect if db is not a PostgreSQL connection
+func requirePostgres(db *gorm.DB) error {
+	return requireDialect(db, config.DialectPostgres)
+}
+
+// PostgreSQL error codes raised when a text value contains null bytes or invalid UTF-8
+const (
+	pgCodeCharacterNotInRepertoire = "22021" // invalid byte sequence for encoding "UTF8"
+	pgCodeUntranslatableCharacter  = "22P05" // unsupported Unicode escape sequence, \u0000 cannot be converted to text
+)
+
+// IsInvalidTextError returns true if the error is PostgreSQL rejecting a text value that contains null bytes or invalid UTF-8.
+// Blocks processed with flags.invalid-text-policy set to sanitize or bytea never produce this error.
+func IsInvalidTextError(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	return pgErr.Code == pgCodeCharacterNotInRepertoire || pgErr.Code == pgCodeUntranslatableCharacter
+}
+
+// IndexStage is the stage of indexing a block that failed, recorded with the failed block
+type IndexStage string
+
+// Stages of fetching, processing and indexing a block
+const (
+	StageFetch                IndexStage = "fetch"   // RPC requests for the block, its results and txs
+	StageProcess              IndexStage = "process" // decoding and parsing the RPC responses
+	StageFilter               IndexStage = "filter"  // applying the block event filters
+	StagePartitions           IndexStage = "partitions"
+	StageBlock                IndexStage = "block" // the block row, its proposer and signatures, reorg and conflict handling
+	StageAddresses            IndexStage = "addresses"
+	StageDenominations        IndexStage = "denominations"
+	StageTxs                  IndexStage = "txs"
+	StageFees                 IndexStage = "fees"
+	StageTxFailures           IndexStage = "tx_failures" // the txs and messages of the block that could not be decoded
+	StageMessageTypes         IndexStage = "message_types"
+	StageEventTypes           IndexStage = "event_types"
+	StageAttributeKeys        IndexStage = "attribute_keys"
+	StageMessages             IndexStage = "messages"
+	StageEvents               IndexStage = "events"
+	StageAttributes           IndexStage = "attributes"
+	StageWatchlist            IndexStage = "watchlist"
+	StageBlockEvents          IndexStage = "block_events"
+	StageBlockEventAttributes IndexStage = "block_event_attributes"
+)
+
+// BlockIndexError is returned by IndexNewBlock, IndexNewBlocks and IndexBlockEvents when a stage of indexing fails. Errors
+// of a stage indexing a whole batch at once cover the heights of the batch, Height to EndHeight, otherwise both are the
+// height of the failing block. The error of the database is wrapped.
+type BlockIndexError struct {
+	Height    int64
+	EndHeight int64
+	ChainID   uint
+	Stage     IndexStage
+	Err       error
+}
+
+func (e *BlockIndexError) Error() string {
+	if e.EndHeight != e.Height {
+		return fmt.Sprintf("indexing %s of blocks %d to %d of chain %d: %v", e.Stage, e.Height, e.EndHeight, e.ChainID, e.Err)
+	}
+	return fmt.Sprintf("indexing %s of block %d of chain %d: %v", e.Stage, e.Height, e.ChainID, e.Err)
+}
+
+func (e *BlockIndexError) Unwrap() error {
+	return e.Err
+}
+
+// blockIndexError wraps the error of the stage of indexing the blocks of the chain from height to endHeight, nil for no
+// error
+func blockIndexError(stage IndexStage, chainID uint, height int64, endHeight int64, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &BlockIndexError{Height: height, EndHeight: endHeight, ChainID: chainID, Stage: stage, Err: err}
+}
+
+// ErrorStage returns the stage of the BlockIndexError in the error chain, empty if there is none
+func ErrorStage(err error) IndexStage {
+	var indexErr *BlockIndexError
+	if errors.As(err, &indexErr) {
+		return indexErr.Stage
+	}
+	return ""
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"gorm.io/gorm"
+)
+
+// estimateConfidenceZ is the z score of the 95% confidence bounds of a disk usage estimate
+const estimateConfidenceZ = 1.96
+
+// estimatedTables are the tables that grow with every indexed block and the columns holding their variable length data.
+// Lookup tables (types, attribute keys, addresses, denoms) grow with the variety of the chain rather than its length and
+// are left out of estimates.
+var estimatedTables = []struct {
+	name           string
+	payloadColumns []string
+}{
+	{"blocks", nil},
+	{"block_events", nil},
+	{"block_event_attributes", []string{"value", "value_bytes"}},
+	{"txes", []string{"hash"}},
+	{"tx_signer_addresses", nil},
+	{"fees", nil},
+	{"messages", []string{"message_bytes"}},
+	{"message_events", nil},
+	{"message_event_attributes", []string{"value", "value_bytes"}},
+}
+
+// TableCalibration is the storage cost of one row of a table on top of its variable length data
+type TableCalibration struct {
+	RowBytes   float64 `json:"row_bytes"`   // Tuple header, fixed width columns and alignment
+	IndexBytes float64 `json:"index_bytes"` // All indexes of the table
+}
+
+// DefaultDiskCalibration are rough per row costs of the indexer tables in PostgreSQL. They can be replaced by calibration
+// derived from a populated database with GetDiskCalibration.
+var DefaultDiskCalibration = map[string]TableCalibration{
+	"blocks":                   {RowBytes: 90, IndexBytes: 70},
+	"block_events":             {RowBytes: 60, IndexBytes: 80},
+	"block_event_attributes":   {RowBytes: 60, IndexBytes: 70},
+	"txes":                     {RowBytes: 50, IndexBytes: 110},
+	"tx_signer_addresses":      {RowBytes: 40, IndexBytes: 40},
+	"fees":                     {RowBytes: 70, IndexBytes: 90},
+	"messages":                 {RowBytes: 60, IndexBytes: 90},
+	"message_events":           {RowBytes: 50, IndexBytes: 70},
+	"message_event_attributes": {RowBytes: 60, IndexBytes: 70},
+}
+
+// TableSample is what one block adds to a table
+type TableSample struct {
+	Rows         int64
+	PayloadBytes int64
+}
+
+// BlockSample is what one block adds to each estimated table, keyed by table name
+type BlockSample map[string]TableSample
+
+func (s BlockSample) add(table string, rows int64, payloadBytes int64) {
+	sample := s[table]
+	sample.Rows += rows
+	sample.PayloadBytes += payloadBytes
+	s[table] = sample
+}
+
+// SampleBlockRows counts the rows and variable length data the parsed block data would write. Either argument may be nil
+// or empty when that part of the block is not indexed.
+func SampleBlockRows(blockDBWrapper *BlockDBWrapper, txs []TxDBWrapper) BlockSample {
+	sample := make(BlockSample)
+	sample.add("blocks", 1, 0)
+
+	if blockDBWrapper != nil {
+		for _, events := range [][]BlockEventDBWrapper{blockDBWrapper.BeginBlockEvents, blockDBWrapper.EndBlockEvents} {
+			for _, event := range events {
+				sample.add("block_events", 1, 0)
+				for _, attribute := range event.Attributes {
+					sample.add("block_event_attributes", 1, int64(len(attribute.Value)+len(attribute.ValueBytes)))
+				}
+			}
+		}
+	}
+
+	for _, tx := range txs {
+		sample.add("txes", 1, int64(len(tx.Tx.Hash)))
+		sample.add("tx_signer_addresses", int64(len(tx.Tx.SignerAddresses)), 0)
+		sample.add("fees", int64(len(tx.Tx.Fees)), 0)
+
+		for _, message := range tx.Messages {
+			sample.add("messages", 1, int64(len(message.Message.MessageBytes)+len(message.Message.Value)))
+			for _, event := range message.MessageEvents {
+				sample.add("message_events", 1, 0)
+				for _, attribute := range event.Attributes {
+					sample.add("message_event_attributes", 1, int64(len(attribute.Value)+len(attribute.ValueBytes)))
+				}
+			}
+		}
+	}
+
+	return sample
+}
+
+// Bounds is an estimate with its 95% confidence bounds
+type Bounds struct {
+	Estimate float64 `json:"estimate"`
+	Low      float64 `json:"low"`
+	High     float64 `json:"high"`
+}
+
+// TableEstimate is the estimated growth of one table over the estimated height range
+type TableEstimate struct {
+	Table        string  `json:"table"`
+	RowsPerBlock float64 `json:"rows_per_block"`
+	Rows         Bounds  `json:"rows"`
+	DataBytes    Bounds  `json:"data_bytes"`
+	IndexBytes   Bounds  `json:"index_bytes"`
+	TotalBytes   Bounds  `json:"total_bytes"`
+}
+
+// DiskUsageEstimate extrapolates sampled blocks to a height range
+type DiskUsageEstimate struct {
+	StartHeight  int64           `json:"start_height"`
+	EndHeight    int64           `json:"end_height"`
+	TotalHeights int64           `json:"total_heights"`
+	Samples      int             `json:"samples"`
+	Tables       []TableEstimate `json:"tables"`
+	// Total bounds are the sums of the table bounds, so they are wider than a joint confidence interval
+	TotalBytes Bounds `json:"total_bytes"`
+}
+
+// SampleHeights returns count heights spread evenly over the range, including both ends. Ranges with fewer heights
+// than count return every height.
+func SampleHeights(heights HeightRange, count int) []int64 {
+	total := heights.End - heights.Start + 1
+	if count <= 0 || total <= 0 {
+		return nil
+	}
+
+	if int64(count) >= total {
+		sampled := make([]int64, 0, total)
+		for height := heights.Start; height <= heights.End; height++ {
+			sampled = append(sampled, height)
+		}
+		return sampled
+	}
+
+	if count == 1 {
+		return []int64{heights.Start + total/2}
+	}
+
+	sampled := make([]int64, count)
+	for i := range sampled {
+		sampled[i] = heights.Start + int64(math.Round(float64(i)*float64(total-1)/float64(count-1)))
+	}
+	return sampled
+}
+
+// EstimateDiskUsage extrapolates the sampled blocks to every height in the range. Tables missing from the calibration
+// use DefaultDiskCalibration.
+func EstimateDiskUsage(samples []BlockSample, heights HeightRange, calibration map[string]TableCalibration) (DiskUsageEstimate, error) {
+	if heights.IsOpen() {
+		return DiskUsageEstimate{}, fmt.Errorf("cannot estimate an open height range %s", heights)
+	}
+
+	estimate := DiskUsageEstimate{
+		StartHeight:  heights.Start,
+		EndHeight:    heights.End,
+		TotalHeights: heights.End - heights.Start + 1,
+		Samples:      len(samples),
+	}
+
+	if len(samples) == 0 {
+		return estimate, fmt.Errorf("no blocks were sampled")
+	}
+
+	for _, table := range estimatedTables {
+		tableCalibration, ok := calibration[table.name]
+		if !ok {
+			tableCalibration = DefaultDiskCalibration[table.name]
+		}
+
+		rows := make([]float64, len(samples))
+		dataBytes := make([]float64, len(samples))
+		indexBytes := make([]float64, len(samples))
+		for i, sample := range samples {
+			tableSample := sample[table.name]
+			rows[i] = float64(tableSample.Rows)
+			dataBytes[i] = float64(tableSample.Rows)*tableCalibration.RowBytes + float64(tableSample.PayloadBytes)
+			indexBytes[i] = float64(tableSample.Rows) * tableCalibration.IndexBytes
+		}
+
+		tableEstimate := TableEstimate{
+			Table:      table.name,
+			Rows:       extrapolate(rows, estimate.TotalHeights),
+			DataBytes:  extrapolate(dataBytes, estimate.TotalHeights),
+			IndexBytes: extrapolate(indexBytes, estimate.TotalHeights),
+		}
+		tableEstimate.RowsPerBlock = tableEstimate.Rows.Estimate / float64(estimate.TotalHeights)
+		tableEstimate.TotalBytes = Bounds{
+			Estimate: tableEstimate.DataBytes.Estimate + tableEstimate.IndexBytes.Estimate,
+			Low:      tableEstimate.DataBytes.Low + tableEstimate.IndexBytes.Low,
+			High:     tableEstimate.DataBytes.High + tableEstimate.IndexBytes.High,
+		}
+
+		estimate.TotalBytes.Estimate += tableEstimate.TotalBytes.Estimate
+		estimate.TotalBytes.Low += tableEstimate.TotalBytes.Low
+		estimate.TotalBytes.High += tableEstimate.TotalBytes.High
+		estimate.Tables = append(estimate.Tables, tableEstimate)
+	}
+
+	return estimate, nil
+}
+
+// extrapolate scales the per block mean of the values to total blocks, with bounds from the standard error of the mean
+func extrapolate(values []float64, total int64) Bounds {
+	var sum float64
+	for _, value := range values {
+		sum += value
+	}
+	mean := sum / float64(len(values))
+
+	var margin float64
+	if len(values) > 1 {
+		var squares float64
+		for _, value := range values {
+			squares += (value - mean) * (value - mean)
+		}
+		stdDev := math.Sqrt(squares / float64(len(values)-1))
+		margin = estimateConfidenceZ * stdDev / math.Sqrt(float64(len(values)))
+	}
+
+	return Bounds{
+		Estimate: mean * float64(total),
+		Low:      math.Max(0, mean-margin) * float64(total),
+		High:     (mean + margin) * float64(total),
+	}
+}
+
+// GetDiskCalibration derives the per row costs of the estimated tables from the database. Tables with fewer than
+// minRows rows are left out so their costs are not skewed by fixed overhead. It requires PostgreSQL.
+func GetDiskCalibration(ctx context.Context, db *gorm.DB, minRows int64) (map[string]TableCalibration, error) {
+	db = db.WithContext(ctx)
+	if err := requirePostgres(db); err != nil {
+		return nil, err
+	}
+
+	calibration := make(map[string]TableCalibration)
+
+	for _, table := range estimatedTables {
+		var size struct {
+			Rows       int64
+			TableBytes int64
+			IndexBytes int64
+		}
+
+		// reltuples is the planner estimate, it avoids counting large tables
+		err := db.Raw(`SELECT GREATEST(reltuples, 0)::bigint AS rows, pg_table_size(oid) AS table_bytes, pg_indexes_size(oid) AS index_bytes
+			FROM pg_class WHERE oid = to_regclass(?)`, table.name).Scan(&size).Error
+		if err != nil {
+			return nil, err
+		}
+
+		if size.Rows < minRows || size.Rows == 0 {
+			continue
+		}
+
+		var payloadPerRow float64
+		if len(table.payloadColumns) != 0 {
+			payloadExpression := ""
+			for i, column := range table.payloadColumns {
+				if i > 0 {
+					payloadExpression += " + "
+				}
+				payloadExpression += fmt.Sprintf("COALESCE(octet_length(%s), 0)", column)
+			}
+
+			// A 1% block sample keeps this cheap on large tables, small tables are read in full
+			sampling := ""
+			if size.Rows > 1000000 {
+				sampling = " TABLESAMPLE SYSTEM (1)"
+			}
+
+			err = db.Raw(fmt.Sprintf("SELECT COALESCE(AVG(%s), 0) FROM %s%s", payloadExpression, table.name, sampling)).Scan(&payloadPerRow).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		calibration[table.name] = TableCalibration{
+			RowBytes:   math.Max(0, float64(size.TableBytes)/float64(size.Rows)-payloadPerRow),
+			IndexBytes: float64(size.IndexBytes) / float64(size.Rows),
+		}
+	}
+
+	return calibration, nil
+}
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/stretchr/testify/suite"
+)
+
+type EstimateTestSuite struct {
+	suite.Suite
+}
+
+func (suite *EstimateTestSuite) TestSampleHeights() {
+	suite.Assert().Equal([]int64{1, 26, 51, 75, 100}, SampleHeights(HeightRange{Start: 1, End: 100}, 5))
+	suite.Assert().Equal([]int64{10, 11, 12}, SampleHeights(HeightRange{Start: 10, End: 12}, 5))
+	suite.Assert().Equal([]int64{51}, SampleHeights(HeightRange{Start: 1, End: 100}, 1))
+	suite.Assert().Empty(SampleHeights(HeightRange{Start: 1, End: 100}, 0))
+}
+
+func (suite *EstimateTestSuite) TestSampleBlockRows() {
+	blockDBWrapper := &BlockDBWrapper{
+		BeginBlockEvents: []BlockEventDBWrapper{{Attributes: []models.BlockEventAttribute{{Value: "10uatom"}, {Value: "x", ValueBytes: []byte("x\x00")}}}},
+		EndBlockEvents:   []BlockEventDBWrapper{{}},
+	}
+	txs := []TxDBWrapper{{
+		Tx: models.Tx{Hash: "ABCD", SignerAddresses: []models.Address{{}, {}}, Fees: []models.Fee{{}}},
+		Messages: []MessageDBWrapper{{
+			Message:       models.Message{MessageBytes: []byte("message")},
+			MessageEvents: []MessageEventDBWrapper{{Attributes: []models.MessageEventAttribute{{Value: "value"}}}},
+		}},
+	}}
+
+	suite.Assert().Equal(BlockSample{
+		"blocks":                   {Rows: 1},
+		"block_events":             {Rows: 2},
+		"block_event_attributes":   {Rows: 2, PayloadBytes: 10},
+		"txes":                     {Rows: 1, PayloadBytes: 4},
+		"tx_signer_addresses":      {Rows: 2},
+		"fees":                     {Rows: 1},
+		"messages":                 {Rows: 1, PayloadBytes: 7},
+		"message_events":           {Rows: 1},
+		"message_event_attributes": {Rows: 1, PayloadBytes: 5},
+	}, SampleBlockRows(blockDBWrapper, txs))
+
+	// Only the block row when nothing else is indexed
+	suite.Assert().Equal(BlockSample{"blocks": {Rows: 1}}, SampleBlockRows(nil, nil))
+}
+
+func (suite *EstimateTestSuite) TestEstimateDiskUsage() {
+	samples := []BlockSample{
+		{"blocks": {Rows: 1}, "txes": {Rows: 2, PayloadBytes: 128}},
+		{"blocks": {Rows: 1}, "txes": {Rows: 4, PayloadBytes: 256}},
+	}
+	calibration := map[string]TableCalibration{"txes": {RowBytes: 100, IndexBytes: 50}}
+
+	estimate, err := EstimateDiskUsage(samples, HeightRange{Start: 1, End: 1000}, calibration)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(int64(1000), estimate.TotalHeights)
+	suite.Assert().Equal(2, estimate.Samples)
+
+	tables := make(map[string]TableEstimate)
+	for _, table := range estimate.Tables {
+		tables[table.Table] = table
+	}
+
+	// Every block has exactly one block row, there is no uncertainty
+	blocks := tables["blocks"]
+	suite.Assert().Equal(Bounds{Estimate: 1000, Low: 1000, High: 1000}, blocks.Rows)
+	suite.Assert().Equal(DefaultDiskCalibration["blocks"].IndexBytes*1000, blocks.IndexBytes.Estimate)
+
+	txes := tables["txes"]
+	suite.Assert().InDelta(3.0, txes.RowsPerBlock, 0.0001)
+	suite.Assert().InDelta(3000.0, txes.Rows.Estimate, 0.0001)
+	suite.Assert().Less(txes.Rows.Low, txes.Rows.Estimate)
+	suite.Assert().Greater(txes.Rows.High, txes.Rows.Estimate)
+	suite.Assert().InDelta(3000*100+192*1000, txes.DataBytes.Estimate, 0.0001)
+	suite.Assert().InDelta(3000*50, txes.IndexBytes.Estimate, 0.0001)
+
+	// Tables with no rows in any sample are estimated as empty
+	suite.Assert().Zero(tables["messages"].TotalBytes.High)
+
+	var total float64
+	for _, table := range estimate.Tables {
+		total += table.TotalBytes.Estimate
+	}
+	suite.Assert().InDelta(total, estimate.TotalBytes.Estimate, 0.0001)
+
+	_, err = EstimateDiskUsage(nil, HeightRange{Start: 1, End: 1000}, nil)
+	suite.Assert().Error(err)
+	_, err = EstimateDiskUsage(samples, HeightsFrom(1), nil)
+	suite.Assert().Error(err)
+}
+
+func TestEstimateSuite(t *testing.T) {
+	suite.Run(t, new(EstimateTestSuite))
+}
@@ -1,26 +1,50 @@
 package db
 
 import (
+	"context"
+	"time"
+
 	"github.com/DefiantLabs/cosmos-indexer/config"
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-func IndexBlockEvents(db *gorm.DB, dryRun bool, blockDBWrapper *BlockDBWrapper, identifierLoggingString string) (*BlockDBWrapper, error) {
+func IndexBlockEvents(ctx context.Context, db *gorm.DB, dryRun bool, blockDBWrapper *BlockDBWrapper, identifierLoggingString string) (*BlockDBWrapper, error) {
+	start := time.Now()
+	db = db.WithContext(ctx)
+	stageError := func(stage IndexStage, err error) error {
+		return blockIndexError(stage, blockDBWrapper.Block.ChainID, blockDBWrapper.Block.Height, blockDBWrapper.Block.Height, err)
+	}
+
+	txStart := time.Now()
 	err := db.Transaction(func(dbTransaction *gorm.DB) error {
-		if err := dbTransaction.
-			Exec("DELETE FROM failed_event_blocks WHERE height = ? AND blockchain_id = ?", blockDBWrapper.Block.Height, blockDBWrapper.Block.ChainID).
-			Error; err != nil {
+		if err := DeleteFailedEventBlock(ctx, dbTransaction, blockDBWrapper.Block.Height, blockDBWrapper.Block.ChainID); err != nil {
 			config.Log.Error("Error updating failed block.", err)
-			return err
+			return stageError(StageBlock, err)
 		}
 
-		consAddress, err := FindOrCreateAddressByAddress(dbTransaction, blockDBWrapper.Block.ProposerConsAddress.Address)
+		consAddress, err := FindOrCreateAddressByAddress(ctx, dbTransaction, blockDBWrapper.Block.ProposerConsAddress.Address)
 		// create cons address if it doesn't exist
 		if err != nil {
 			config.Log.Error("Error getting/creating cons address DB object.", err)
-			return err
+			return stageError(StageBlock, err)
+		}
+
+		var existingBlock models.Block
+		if err := dbTransaction.
+			Where("height = ? AND chain_id = ?", blockDBWrapper.Block.Height, blockDBWrapper.Block.ChainID).
+			Limit(1).
+			Find(&existingBlock).Error; err != nil {
+			config.Log.Error("Error getting existing block DB object.", err)
+			return stageError(StageBlock, err)
+		}
+
+		// the stored hash would be overwritten below, hiding the reorg from the tx indexing of the block
+		if isReorg(existingBlock, *blockDBWrapper.Block) {
+			if err := replaceReorgedBlock(dbTransaction, existingBlock, *blockDBWrapper.Block); err != nil {
+				return stageError(StageBlock, err)
+			}
 		}
 
 		// create block if it doesn't exist
@@ -32,62 +56,34 @@ func IndexBlockEvents(db *gorm.DB, dryRun bool, blockDBWrapper *BlockDBWrapper,
 
 		if err := dbTransaction.
 			Where(models.Block{Height: blockDBWrapper.Block.Height, ChainID: blockDBWrapper.Block.ChainID}).
-			Assign(models.Block{BlockEventsIndexed: true, TimeStamp: blockDBWrapper.Block.TimeStamp, ProposerConsAddress: blockDBWrapper.Block.ProposerConsAddress}).
+			Assign(models.Block{
+				BlockEventsIndexed:  true,
+				TimeStamp:           blockDBWrapper.Block.TimeStamp,
+				ProposerConsAddress: blockDBWrapper.Block.ProposerConsAddress,
+				IndexProfile:        blockDBWrapper.Block.IndexProfile,
+				BlockHash:           blockDBWrapper.Block.BlockHash,
+				BlockSizeBytes:      blockDBWrapper.Block.BlockSizeBytes,
+			}).
 			FirstOrCreate(&blockDBWrapper.Block).Error; err != nil {
 			config.Log.Error("Error getting/creating block DB object.", err)
-			return err
-		}
-
-		var uniqueBlockEventTypes []models.BlockEventType
-
-		for _, value := range blockDBWrapper.UniqueBlockEventTypes {
-			uniqueBlockEventTypes = append(uniqueBlockEventTypes, value)
+			return stageError(StageBlock, err)
 		}
 
-		// Bulk find or create on unique event types
-		if err := dbTransaction.Clauses(
-			clause.Returning{
-				Columns: []clause.Column{
-					{Name: "id"}, {Name: "type"},
-				},
-			},
-			clause.OnConflict{
-				Columns:   []clause.Column{{Name: "type"}},
-				DoUpdates: clause.AssignmentColumns([]string{"type"}),
-			},
-		).Create(&uniqueBlockEventTypes).Error; err != nil {
-			config.Log.Error("Error creating begin block event types.", err)
-			return err
+		if err := clearPruned(dbTransaction, blockDBWrapper.Block); err != nil {
+			return stageError(StageBlock, err)
 		}
 
-		for _, value := range uniqueBlockEventTypes {
-			blockDBWrapper.UniqueBlockEventTypes[value.Type] = value
-		}
-
-		var uniqueBlockEventAttributeKeys []models.BlockEventAttributeKey
-
-		for _, value := range blockDBWrapper.UniqueBlockEventAttributeKeys {
-			uniqueBlockEventAttributeKeys = append(uniqueBlockEventAttributeKeys, value)
-		}
-
-		if err := dbTransaction.Clauses(
-			clause.Returning{
-				Columns: []clause.Column{
-					{Name: "id"}, {Name: "key"},
-				},
-			},
-			clause.OnConflict{
-				Columns:   []clause.Column{{Name: "key"}},
-				DoUpdates: clause.AssignmentColumns([]string{"key"}),
-			},
-		).Create(&uniqueBlockEventAttributeKeys).Error; err != nil {
-			config.Log.Error("Error creating begin block event attribute keys.", err)
-			return err
+		uniqueBlockEventTypes, err := indexBlockEventTypes(dbTransaction, blockDBWrapper.UniqueBlockEventTypes)
+		if err != nil {
+			return stageError(StageEventTypes, err)
 		}
+		blockDBWrapper.UniqueBlockEventTypes = uniqueBlockEventTypes
 
-		for _, value := range uniqueBlockEventAttributeKeys {
-			blockDBWrapper.UniqueBlockEventAttributeKeys[value.Key] = value
+		uniqueBlockEventAttributeKeys, err := indexBlockEventAttributeKeys(dbTransaction, blockDBWrapper.UniqueBlockEventAttributeKeys)
+		if err != nil {
+			return stageError(StageAttributeKeys, err)
 		}
+		blockDBWrapper.UniqueBlockEventAttributeKeys = uniqueBlockEventAttributeKeys
 
 		// Loop through begin and end block arrays and apply the block ID and event type ID
 		beginBlockEvents := make([]*models.BlockEvent, len(blockDBWrapper.BeginBlockEvents))
@@ -122,9 +118,9 @@ func IndexBlockEvents(db *gorm.DB, dryRun bool, blockDBWrapper *BlockDBWrapper,
 					// Force update of block event type ID
 					DoUpdates: clause.AssignmentColumns([]string{"block_event_type_id"}),
 				},
-			).Create(&allBlockEvents).Error; err != nil {
+			).CreateInBatches(&allBlockEvents, insertBatchSize(dbTransaction)).Error; err != nil {
 				config.Log.Error("Error creating begin block events.", err)
-				return err
+				return stageError(StageBlockEvents, err)
 			}
 
 			var allAttributes []*models.BlockEventAttribute
@@ -156,32 +152,77 @@ func IndexBlockEvents(db *gorm.DB, dryRun bool, blockDBWrapper *BlockDBWrapper,
 				if err := dbTransaction.Clauses(clause.OnConflict{
 					Columns: []clause.Column{{Name: "block_event_id"}, {Name: "index"}},
 					// Force update of value
-					DoUpdates: clause.AssignmentColumns([]string{"value"}),
-				}).Create(&allAttributes).Error; err != nil {
+					DoUpdates: clause.AssignmentColumns([]string{"value", "value_bytes", "sanitized"}),
+				}).CreateInBatches(&allAttributes, insertBatchSize(dbTransaction)).Error; err != nil {
 					config.Log.Error("Error creating begin block event attributes.", err)
-					return err
+					return stageError(StageBlockEventAttributes, err)
 				}
 			}
 		}
 
+		if err := advanceCheckpoints(dbTransaction, blockDBWrapper.Block.ChainID, CheckpointBlockEvents, blockDBWrapper.Block.Height); err != nil {
+			return stageError(StageBlock, err)
+		}
 		return nil
 	})
+	if err == nil {
+		observeIndexedBlockEvents(db, blockDBWrapper, start, txStart)
+	}
 
 	// Contract: ensure that wrapper has been loaded with all data before returning
 	return blockDBWrapper, err
 }
 
-func IndexCustomBlockEvents(conf config.IndexConfig, db *gorm.DB, dryRun bool, blockDBWrapper *BlockDBWrapper, identifierLoggingString string, beginBlockParserTrackers map[string]models.BlockEventParser, endBlockParserTrackers map[string]models.BlockEventParser) error {
+// indexBlockEventTypes finds or creates the block event types, see findOrCreateDictionary, and returns them by type with
+// their IDs.
+func indexBlockEventTypes(db *gorm.DB, uniqueBlockEventTypes map[string]models.BlockEventType) (map[string]models.BlockEventType, error) {
+	types := make([]string, 0, len(uniqueBlockEventTypes))
+	for blockEventType := range uniqueBlockEventTypes {
+		types = append(types, blockEventType)
+	}
+
+	fullUniqueBlockEventTypes, err := findOrCreateDictionary(db, "type", types,
+		func(value string) models.BlockEventType { return models.BlockEventType{Type: value} },
+		func(row models.BlockEventType) string { return row.Type })
+	if err != nil {
+		config.Log.Error("Error getting/creating block event types.", err)
+		return nil, err
+	}
+
+	return fullUniqueBlockEventTypes, nil
+}
+
+// indexBlockEventAttributeKeys finds or creates the block event attribute keys like indexBlockEventTypes, and returns them
+// by key with their IDs.
+func indexBlockEventAttributeKeys(db *gorm.DB, uniqueBlockEventAttributeKeys map[string]models.BlockEventAttributeKey) (map[string]models.BlockEventAttributeKey, error) {
+	keys := make([]string, 0, len(uniqueBlockEventAttributeKeys))
+	for key := range uniqueBlockEventAttributeKeys {
+		keys = append(keys, key)
+	}
+
+	fullUniqueBlockEventAttributeKeys, err := findOrCreateDictionary(db, "key", keys,
+		func(value string) models.BlockEventAttributeKey { return models.BlockEventAttributeKey{Key: value} },
+		func(row models.BlockEventAttributeKey) string { return row.Key })
+	if err != nil {
+		config.Log.Error("Error getting/creating block event attribute keys.", err)
+		return nil, err
+	}
+
+	return fullUniqueBlockEventAttributeKeys, nil
+}
+
+func IndexCustomBlockEvents(ctx context.Context, conf config.IndexConfig, db *gorm.DB, dryRun bool, blockDBWrapper *BlockDBWrapper, identifierLoggingString string, beginBlockParserTrackers map[string]models.BlockEventParser, endBlockParserTrackers map[string]models.BlockEventParser) error {
+	db = db.WithContext(ctx)
 	return db.Transaction(func(dbTransaction *gorm.DB) error {
 		// call generic function below
-		err := indexLifecycleCustomBlockEvents(dbTransaction, conf, blockDBWrapper, blockDBWrapper.BeginBlockEvents, beginBlockParserTrackers)
+		err := indexLifecycleCustomBlockEvents(ctx, dbTransaction, conf, blockDBWrapper, blockDBWrapper.BeginBlockEvents, beginBlockParserTrackers)
 		if err != nil {
 			config.Log.Error("Error indexing begin block events.", err)
 			return err
 		}
 
 		// do the same here
-		err = indexLifecycleCustomBlockEvents(dbTransaction, conf, blockDBWrapper, blockDBWrapper.EndBlockEvents, endBlockParserTrackers)
+		err = indexLifecycleCustomBlockEvents(ctx, dbTransaction, conf, blockDBWrapper, blockDBWrapper.EndBlockEvents, endBlockParserTrackers)
 		if err != nil {
 			config.Log.Error("Error indexing end block events.", err)
 			return err
@@ -191,14 +232,14 @@ func IndexCustomBlockEvents(conf config.IndexConfig, db *gorm.DB, dryRun bool, b
 	})
 }
 
-func indexLifecycleCustomBlockEvents(db *gorm.DB, conf config.IndexConfig, blockDBWrapper *BlockDBWrapper, events []BlockEventDBWrapper, parserTrackers map[string]models.BlockEventParser) error {
+func indexLifecycleCustomBlockEvents(ctx context.Context, db *gorm.DB, conf config.IndexConfig, blockDBWrapper *BlockDBWrapper, events []BlockEventDBWrapper, parserTrackers map[string]models.BlockEventParser) error {
 	for _, blockEvent := range events {
 		if len(blockEvent.BlockEventParsedDatasets) != 0 {
 			for _, parsedData := range blockEvent.BlockEventParsedDatasets {
 
 				// Pre clear old errors
 				if parsedData.Parser != nil {
-					err := DeleteCustomBlockEventParserError(db, blockEvent.BlockEvent, parserTrackers[(*parsedData.Parser).Identifier()])
+					err := DeleteCustomBlockEventParserError(ctx, db, blockEvent.BlockEvent, parserTrackers[(*parsedData.Parser).Identifier()])
 					if err != nil {
 						config.Log.Error("Error clearing block event error.", err)
 						return err
@@ -212,7 +253,7 @@ func indexLifecycleCustomBlockEvents(db *gorm.DB, conf config.IndexConfig, block
 						return err
 					}
 				} else if parsedData.Error != nil {
-					err := CreateBlockEventParserError(db, blockEvent.BlockEvent, parserTrackers[(*parsedData.Parser).Identifier()], parsedData.Error)
+					err := CreateBlockEventParserError(ctx, db, blockEvent.BlockEvent, parserTrackers[(*parsedData.Parser).Identifier()], parsedData.Error)
 					if err != nil {
 						config.Log.Error("Error indexing block event error.", err)
 						return err
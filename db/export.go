@@ -0,0 +1,244 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+// The datasets exported by ExportCSV
+const (
+	ExportTxs      = "txs"
+	ExportMessages = "messages"
+	ExportFees     = "fees"
+)
+
+// ExportDatasets are the datasets ExportCSV can export
+var ExportDatasets = []string{ExportTxs, ExportMessages, ExportFees}
+
+// ExportOptions selects the dataset and the rows exported by ExportCSV
+type ExportOptions struct {
+	Dataset string
+	// Heights limits the rows to a height range, the zero value exports every height
+	Heights HeightRange
+	// From and To limit the rows to the blocks with a time in [From, To), a zero time leaves that side open
+	From time.Time
+	To   time.Time
+	// Address limits the rows to the txs signed by the address or with a fee paid by it
+	Address string
+	// MessageType limits the rows to the messages of the type, or the txs and fees of txs with a message of the type. A
+	// type containing % is a LIKE pattern, like for GetMessagesByType.
+	MessageType string
+}
+
+func (opts ExportOptions) validate() error {
+	if _, ok := exportDatasets[opts.Dataset]; !ok {
+		return fmt.Errorf("unknown export dataset %q, must be one of %s", opts.Dataset, strings.Join(ExportDatasets, ", "))
+	}
+	if !opts.From.IsZero() && !opts.To.IsZero() && !opts.To.After(opts.From) {
+		return errors.New("export time range must end after it starts")
+	}
+	return nil
+}
+
+// exportDataset is the query and the columns of an exported dataset
+type exportDataset struct {
+	columns []string
+	// query selects the columns from the txs of the export, joined with their blocks
+	query func(query *gorm.DB) *gorm.DB
+	// record converts the columns of a row to the CSV record
+	record func(rows *sql.Rows) ([]string, error)
+}
+
+var exportDatasets = map[string]exportDataset{
+	ExportTxs: {
+		columns: []string{"height", "time", "hash", "code", "signers", "message_types", "gas_wanted", "gas_used", "memo", "error_message"},
+		query: func(query *gorm.DB) *gorm.DB {
+			signers := stringAggregate(query, "addresses.address", "FROM tx_signer_addresses JOIN addresses ON addresses.id = tx_signer_addresses.address_id WHERE tx_signer_addresses.tx_id = txes.id", "addresses.address", " ")
+			messageTypes := stringAggregate(query, "message_types.message_type", "FROM messages JOIN message_types ON message_types.id = messages.message_type_id WHERE messages.tx_id = txes.id", "messages.message_index", ";")
+			return query.
+				Select("blocks.height, blocks.time_stamp, txes.hash, txes.code, " + signers + ", " + messageTypes + ", txes.gas_wanted, txes.gas_used, txes.memo, txes.error_message").
+				Order("blocks.height, txes.id")
+		},
+		record: func(rows *sql.Rows) ([]string, error) {
+			var height, gasWanted, gasUsed int64
+			var timestamp time.Time
+			var code uint32
+			var hash, memo, errorMessage string
+			var signers, messageTypes sql.NullString
+			if err := rows.Scan(&height, &timestamp, &hash, &code, &signers, &messageTypes, &gasWanted, &gasUsed, &memo, &errorMessage); err != nil {
+				return nil, err
+			}
+			return []string{formatInt(height), formatExportTime(timestamp), hash, strconv.FormatUint(uint64(code), 10), signers.String, messageTypes.String,
+				formatInt(gasWanted), formatInt(gasUsed), memo, errorMessage}, nil
+		},
+	},
+	ExportMessages: {
+		columns: []string{"height", "time", "tx_hash", "tx_code", "message_index", "message_type"},
+		query: func(query *gorm.DB) *gorm.DB {
+			return query.
+				Joins("JOIN messages ON messages.tx_id = txes.id").
+				Joins("JOIN message_types ON message_types.id = messages.message_type_id").
+				Select("blocks.height, blocks.time_stamp, txes.hash, txes.code, messages.message_index, message_types.message_type").
+				Order("blocks.height, txes.id, messages.message_index")
+		},
+		record: func(rows *sql.Rows) ([]string, error) {
+			var height int64
+			var timestamp time.Time
+			var code uint32
+			var messageIndex int
+			var hash, messageType string
+			if err := rows.Scan(&height, &timestamp, &hash, &code, &messageIndex, &messageType); err != nil {
+				return nil, err
+			}
+			return []string{formatInt(height), formatExportTime(timestamp), hash, strconv.FormatUint(uint64(code), 10), strconv.Itoa(messageIndex), messageType}, nil
+		},
+	},
+	ExportFees: {
+		columns: []string{"height", "time", "tx_hash", "amount", "denom", "payer", "granter"},
+		query: func(query *gorm.DB) *gorm.DB {
+			return query.
+				Joins("JOIN fees ON fees.tx_id = txes.id").
+				Joins("JOIN denoms ON denoms.id = fees.denomination_id").
+				Joins("LEFT JOIN addresses payers ON payers.id = fees.payer_address_id").
+				Joins("LEFT JOIN addresses granters ON granters.id = fees.granter_address_id").
+				Select("blocks.height, blocks.time_stamp, txes.hash, fees.amount, denoms.base, payers.address, granters.address").
+				Order("blocks.height, txes.id, fees.id")
+		},
+		record: func(rows *sql.Rows) ([]string, error) {
+			var height int64
+			var timestamp time.Time
+			var amount decimal.Decimal
+			var hash, denom string
+			var payer, granter sql.NullString
+			if err := rows.Scan(&height, &timestamp, &hash, &amount, &denom, &payer, &granter); err != nil {
+				return nil, err
+			}
+			return []string{formatInt(height), formatExportTime(timestamp), hash, amount.String(), denom, payer.String, granter.String}, nil
+		},
+	},
+}
+
+// ExportColumns returns the CSV columns of the dataset, in order
+func ExportColumns(dataset string) []string {
+	return exportDatasets[dataset].columns
+}
+
+// ExportCSV writes the rows of the dataset of the chain selected by opts to w as CSV, with a header of the columns of
+// ExportColumns, and returns the number of rows written without the header. Rows are in height order and read from the
+// database one at a time, so the export does not hold the dataset in memory. Fields are quoted as in RFC 4180 and records
+// end with CRLF. Times are RFC 3339 in UTC. The address is normalized like the lookups of GetTxsByAddress, an address
+// that was never indexed has no rows.
+func ExportCSV(ctx context.Context, db *gorm.DB, chain ChainRef, opts ExportOptions, w io.Writer) (int64, error) {
+	db = readDB(ctx, db)
+
+	heights := opts.Heights
+	if heights == (HeightRange{}) {
+		heights = HeightsFrom(1)
+	}
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return 0, err
+	}
+	if err := opts.validate(); err != nil {
+		return 0, err
+	}
+	dataset := exportDatasets[opts.Dataset]
+
+	if opts.Address != "" {
+		address, err := normalizeChainAddress(db, chain, opts.Address)
+		if err != nil {
+			return 0, err
+		}
+		opts.Address = address
+	}
+
+	writer := csv.NewWriter(w)
+	writer.UseCRLF = true
+	if err := writer.Write(dataset.columns); err != nil {
+		return 0, err
+	}
+
+	query := db.Table("txes").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ?", chain.ID)
+	query = heights.where(query, "blocks.height")
+	if !opts.From.IsZero() {
+		query = query.Where("blocks.time_stamp >= ?", opts.From)
+	}
+	if !opts.To.IsZero() {
+		query = query.Where("blocks.time_stamp < ?", opts.To)
+	}
+
+	if opts.Address != "" {
+		var addressIDs []uint
+		if err := db.Model(&models.Address{}).Where("address = ?", opts.Address).Limit(1).Pluck("id", &addressIDs).Error; err != nil {
+			return 0, err
+		}
+		if len(addressIDs) == 0 {
+			writer.Flush()
+			return 0, writer.Error()
+		}
+		query = query.Where("(txes.id IN (SELECT tx_id FROM tx_signer_addresses WHERE address_id = ?) OR txes.id IN (SELECT tx_id FROM fees WHERE payer_address_id = ?))", addressIDs[0], addressIDs[0])
+	}
+
+	if opts.MessageType != "" {
+		typeCondition, typeArg := messageTypeCondition("message_types.message_type", opts.MessageType)
+		if opts.Dataset == ExportMessages {
+			query = query.Where(typeCondition, typeArg)
+		} else {
+			query = query.Where("txes.id IN (SELECT messages.tx_id FROM messages JOIN message_types ON message_types.id = messages.message_type_id WHERE "+typeCondition+")", typeArg)
+		}
+	}
+
+	rows, err := dataset.query(query).Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var written int64
+	for rows.Next() {
+		record, err := dataset.record(rows)
+		if err != nil {
+			return written, err
+		}
+		if err := writer.Write(record); err != nil {
+			return written, err
+		}
+		written++
+	}
+	if err := rows.Err(); err != nil {
+		return written, err
+	}
+
+	writer.Flush()
+	return written, writer.Error()
+}
+
+// stringAggregate returns a subquery concatenating the column of the rows of from, a FROM and WHERE clause that may
+// reference the outer query, separated by separator in the order of orderBy
+func stringAggregate(db *gorm.DB, column string, from string, orderBy string, separator string) string {
+	// The group_concat of SQLite has no ORDER BY, the rows are ordered by a subquery instead
+	if dialectOf(db) == "sqlite" {
+		return fmt.Sprintf("(SELECT group_concat(value, '%s') FROM (SELECT %s AS value %s ORDER BY %s))", separator, column, from, orderBy)
+	}
+	return fmt.Sprintf("(SELECT string_agg(%s, '%s' ORDER BY %s) %s)", column, separator, orderBy, from)
+}
+
+func formatInt(i int64) string {
+	return strconv.FormatInt(i, 10)
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+)
+
+// ExportMessageEventAttributes is the dataset exported by ExportParquet, one row per message event attribute
+const ExportMessageEventAttributes = "message_event_attributes"
+
+// ParquetManifestFile is the name of the manifest ExportParquet writes to its output directory
+const ParquetManifestFile = "manifest.json"
+
+const (
+	// DefaultParquetPartitionBlocks is the number of blocks in each file written by ExportParquet
+	DefaultParquetPartitionBlocks = 100000
+	// DefaultParquetPageSize is the number of rows ExportParquet reads from the database at a time
+	DefaultParquetPageSize = 10000
+)
+
+// MessageEventAttributeRow is a message event attribute joined with its event, message, tx and block, the rows of the
+// files written by ExportParquet. Attribute values are strings, amounts with their denom included, so no precision is lost.
+type MessageEventAttributeRow struct {
+	ID             uint      `parquet:"-"` // The cursor of the pages the rows are read in
+	Height         int64     `parquet:"height"`
+	Time           time.Time `parquet:"time,timestamp(millisecond)"`
+	TxHash         string    `parquet:"tx_hash"`
+	TxCode         int64     `parquet:"tx_code"`
+	MessageIndex   int64     `parquet:"message_index"`
+	MessageType    string    `parquet:"message_type,dict"`
+	EventIndex     int64     `parquet:"event_index"`
+	EventType      string    `parquet:"event_type,dict"`
+	AttributeIndex int64     `parquet:"attribute_index"`
+	AttributeKey   string    `parquet:"attribute_key,dict"`
+	AttributeValue string    `parquet:"attribute_value"`
+}
+
+// ParquetExportOptions configures ExportParquet
+type ParquetExportOptions struct {
+	// Dir is the directory the partitions and the manifest are written to
+	Dir string
+	// Heights is the range to export. An open range ends at the highest height of the chain when the export starts.
+	Heights HeightRange
+	// PartitionBlocks is the number of blocks in each file, DefaultParquetPartitionBlocks when 0
+	PartitionBlocks int64
+	// PageSize is the number of rows read from the database at a time, DefaultParquetPageSize when 0
+	PageSize int
+}
+
+// ParquetPartition is a file written by ExportParquet with the rows of a height range
+type ParquetPartition struct {
+	File        string    `json:"file"` // Name of the file in the output directory
+	StartHeight int64     `json:"start_height"`
+	EndHeight   int64     `json:"end_height"`
+	Rows        int64     `json:"rows"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// ParquetManifest lists the partitions of an export in height order. A partition is only listed once its file is
+// complete, an export resumes after the last one.
+type ParquetManifest struct {
+	ChainID         string             `json:"chain_id"`
+	Dataset         string             `json:"dataset"`
+	StartHeight     int64              `json:"start_height"`
+	PartitionBlocks int64              `json:"partition_blocks"`
+	Partitions      []ParquetPartition `json:"partitions"`
+}
+
+// ReadParquetManifest reads the manifest of the export in dir. found is false when dir has no manifest.
+func ReadParquetManifest(dir string) (manifest ParquetManifest, found bool, err error) {
+	b, err := os.ReadFile(filepath.Join(dir, ParquetManifestFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return ParquetManifest{}, false, nil
+	}
+	if err != nil {
+		return ParquetManifest{}, false, err
+	}
+
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return ParquetManifest{}, false, fmt.Errorf("invalid manifest %s: %w", filepath.Join(dir, ParquetManifestFile), err)
+	}
+	return manifest, true, nil
+}
+
+// ExportParquet writes the message event attributes of the chain within the height range to Parquet files of
+// PartitionBlocks blocks each in Dir, and lists each partition in the manifest of Dir once its file is complete. When Dir
+// already has a manifest of the chain the export resumes after its last partition, so an interrupted export is continued
+// and an export with an open range picks up the blocks indexed since. Rows are read in pages keyed on height and
+// attribute ID, so no partition is held in memory. progress, when set, is called after each partition is written.
+func ExportParquet(ctx context.Context, db *gorm.DB, chain ChainRef, opts ParquetExportOptions, progress func(ParquetPartition)) (ParquetManifest, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, opts.Heights); err != nil {
+		return ParquetManifest{}, err
+	}
+	if opts.PartitionBlocks == 0 {
+		opts.PartitionBlocks = DefaultParquetPartitionBlocks
+	}
+	if opts.PageSize == 0 {
+		opts.PageSize = DefaultParquetPageSize
+	}
+	if opts.PartitionBlocks < 0 || opts.PageSize < 0 {
+		return ParquetManifest{}, errors.New("partition blocks and page size must be greater than 0")
+	}
+
+	manifest, found, err := ReadParquetManifest(opts.Dir)
+	if err != nil {
+		return ParquetManifest{}, err
+	}
+	if found {
+		if manifest.ChainID != chain.ChainID || manifest.Dataset != ExportMessageEventAttributes || manifest.StartHeight != opts.Heights.Start || manifest.PartitionBlocks != opts.PartitionBlocks {
+			return ParquetManifest{}, fmt.Errorf("%s holds an export of %s from height %d in partitions of %d blocks, export to another directory",
+				opts.Dir, manifest.ChainID, manifest.StartHeight, manifest.PartitionBlocks)
+		}
+	} else {
+		if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+			return ParquetManifest{}, err
+		}
+		manifest = ParquetManifest{
+			ChainID:         chain.ChainID,
+			Dataset:         ExportMessageEventAttributes,
+			StartHeight:     opts.Heights.Start,
+			PartitionBlocks: opts.PartitionBlocks,
+			Partitions:      []ParquetPartition{},
+		}
+	}
+
+	end := opts.Heights.End
+	if opts.Heights.IsOpen() {
+		if end, err = GetSnapshotHeight(ctx, db, chain); err != nil {
+			return ParquetManifest{}, err
+		}
+	}
+
+	start := opts.Heights.Start
+	if len(manifest.Partitions) != 0 {
+		start = manifest.Partitions[len(manifest.Partitions)-1].EndHeight + 1
+	}
+
+	for ; start <= end; start += opts.PartitionBlocks {
+		if err := ctx.Err(); err != nil {
+			return manifest, err
+		}
+
+		partition := ParquetPartition{StartHeight: start, EndHeight: start + opts.PartitionBlocks - 1}
+		if partition.EndHeight > end {
+			partition.EndHeight = end
+		}
+		partition.File = fmt.Sprintf("%s_%s_%012d-%012d.parquet", chain.ChainID, ExportMessageEventAttributes, partition.StartHeight, partition.EndHeight)
+
+		partition.Rows, err = writeParquetPartition(db, chain, HeightRange{Start: partition.StartHeight, End: partition.EndHeight}, opts.PageSize, filepath.Join(opts.Dir, partition.File))
+		if err != nil {
+			return manifest, fmt.Errorf("exporting heights %d to %d: %w", partition.StartHeight, partition.EndHeight, err)
+		}
+		partition.CompletedAt = time.Now().UTC()
+
+		manifest.Partitions = append(manifest.Partitions, partition)
+		if err := writeParquetManifest(opts.Dir, manifest); err != nil {
+			return manifest, err
+		}
+		if progress != nil {
+			progress(partition)
+		}
+	}
+
+	return manifest, nil
+}
+
+// writeParquetPartition writes the rows of the height range to the file at path. The rows are written to a temporary file
+// renamed once it is complete, so path never holds a partial partition.
+func writeParquetPartition(db *gorm.DB, chain ChainRef, heights HeightRange, pageSize int, path string) (int64, error) {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := writeMessageEventAttributeRows(db, chain, heights, pageSize, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return written, os.Rename(tmpPath, path)
+}
+
+func writeMessageEventAttributeRows(db *gorm.DB, chain ChainRef, heights HeightRange, pageSize int, w io.Writer) (int64, error) {
+	writer := parquet.NewGenericWriter[MessageEventAttributeRow](w, parquet.Compression(&parquet.Zstd))
+
+	var written int64
+	var afterHeight int64
+	var afterID uint
+	for {
+		rows, err := getMessageEventAttributeRows(db, chain, heights, afterHeight, afterID, pageSize)
+		if err != nil {
+			return written, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+
+		if _, err := writer.Write(rows); err != nil {
+			return written, err
+		}
+		written += int64(len(rows))
+
+		last := rows[len(rows)-1]
+		afterHeight, afterID = last.Height, last.ID
+		if len(rows) < pageSize {
+			break
+		}
+	}
+
+	return written, writer.Close()
+}
+
+// getMessageEventAttributeRows returns up to limit rows of the height range after the row with the height and attribute
+// ID, in height and attribute ID order
+func getMessageEventAttributeRows(db *gorm.DB, chain ChainRef, heights HeightRange, afterHeight int64, afterID uint, limit int) ([]MessageEventAttributeRow, error) {
+	query := db.Table("message_event_attributes").
+		Joins("JOIN message_event_attribute_keys ON message_event_attribute_keys.id = message_event_attributes.message_event_attribute_key_id").
+		Joins("JOIN message_events ON message_events.id = message_event_attributes.message_event_id").
+		Joins("JOIN message_event_types ON message_event_types.id = message_events.message_event_type_id").
+		Joins("JOIN messages ON messages.id = message_events.message_id").
+		Joins("JOIN message_types ON message_types.id = messages.message_type_id").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ?", chain.ID).
+		Where("(blocks.height > ? OR (blocks.height = ? AND message_event_attributes.id > ?))", afterHeight, afterHeight, afterID)
+	query = heights.where(query, "blocks.height")
+
+	var rows []MessageEventAttributeRow
+	err := query.
+		Select(`message_event_attributes.id, blocks.height, blocks.time_stamp AS time, txes.hash AS tx_hash, txes.code AS tx_code,
+			messages.message_index, message_types.message_type, message_events."index" AS event_index, message_event_types.type AS event_type,
+			message_event_attributes."index" AS attribute_index, message_event_attribute_keys."key" AS attribute_key, message_event_attributes.value AS attribute_value`).
+		Order("blocks.height, message_event_attributes.id").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// writeParquetManifest replaces the manifest of dir. It is written to a temporary file and renamed, so an interrupted
+// write leaves the previous manifest.
+func writeParquetManifest(dir string, manifest ParquetManifest) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(dir, ParquetManifestFile)
+	if err := os.WriteFile(path+".tmp", append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
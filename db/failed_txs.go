@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertFailedTx records a tx of an indexed block that could not be decoded, by hash. A tx that failed before is moved to
+// the block and its latest error and bytes are recorded.
+func UpsertFailedTx(ctx context.Context, db *gorm.DB, failedTx *models.FailedTx) error {
+	return upsertFailedTxs(db.WithContext(ctx), []*models.FailedTx{failedTx})
+}
+
+// UpsertFailedMessage records a message of an indexed tx that could not be decoded, by tx and message index. A message that
+// failed before has its latest error, type and bytes recorded.
+func UpsertFailedMessage(ctx context.Context, db *gorm.DB, failedMessage *models.FailedMessage) error {
+	return upsertFailedMessages(db.WithContext(ctx), []*models.FailedMessage{failedMessage})
+}
+
+func upsertFailedTxs(db *gorm.DB, failedTxs []*models.FailedTx) error {
+	if len(failedTxs) == 0 {
+		return nil
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"block_id", "error", "tx_bytes"}),
+	}).Omit(clause.Associations).CreateInBatches(failedTxs, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error creating failed txs.", err)
+		return err
+	}
+	return nil
+}
+
+func upsertFailedMessages(db *gorm.DB, failedMessages []*models.FailedMessage) error {
+	if len(failedMessages) == 0 {
+		return nil
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tx_id"}, {Name: "message_index"}},
+		DoUpdates: clause.AssignmentColumns([]string{"error", "type_url", "message_bytes"}),
+	}).Omit(clause.Associations).CreateInBatches(failedMessages, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error creating failed messages.", err)
+		return err
+	}
+	return nil
+}
+
+// indexTxFailures records the txs of the blocks and the messages of their txs that could not be decoded. The blocks and txs
+// must have their IDs, blockTxes are the indexed txs of every block by hash.
+func indexTxFailures(db *gorm.DB, blocks []BlockTxsDBWrapper, blockTxes []map[string]models.Tx) error {
+	var failedTxs []*models.FailedTx
+	var failedMessages []*models.FailedMessage
+	for i := range blocks {
+		for j := range blocks[i].Block.FailedTxs {
+			failedTx := &blocks[i].Block.FailedTxs[j]
+			failedTx.BlockID = blocks[i].Block.ID
+			failedTxs = append(failedTxs, failedTx)
+		}
+
+		for _, tx := range blocks[i].Txs {
+			for j := range tx.FailedMessages {
+				failedMessage := &tx.FailedMessages[j]
+				failedMessage.TxID = blockTxes[i][tx.Tx.Hash].ID
+				failedMessages = append(failedMessages, failedMessage)
+			}
+		}
+	}
+
+	if err := upsertFailedTxs(db, failedTxs); err != nil {
+		return err
+	}
+	return upsertFailedMessages(db, failedMessages)
+}
+
+// isTxPartiallyIndexed reports whether txs or messages of the block could not be decoded
+func isTxPartiallyIndexed(block *models.Block, txs []TxDBWrapper) bool {
+	if len(block.FailedTxs) != 0 {
+		return true
+	}
+	for _, tx := range txs {
+		if len(tx.FailedMessages) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// GetFailedTxs returns the txs of the indexed blocks of the chain within the height range that could not be decoded, in
+// height order, with their Block loaded
+func GetFailedTxs(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]models.FailedTx, error) {
+	db = db.WithContext(ctx)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	var failedTxs []models.FailedTx
+	query := db.Preload("Block").
+		Joins("JOIN blocks ON blocks.id = failed_txes.block_id").
+		Where("blocks.chain_id = ?", chain.ID)
+	if err := heights.where(query, "blocks.height").Order("blocks.height ASC, failed_txes.id ASC").Find(&failedTxs).Error; err != nil {
+		return nil, err
+	}
+
+	return failedTxs, nil
+}
+
+// GetFailedMessages returns the messages of the indexed txs of the chain within the height range that could not be decoded,
+// in height order, with their Tx and its Block loaded
+func GetFailedMessages(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]models.FailedMessage, error) {
+	db = db.WithContext(ctx)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	var failedMessages []models.FailedMessage
+	query := db.Preload("Tx.Block").
+		Joins("JOIN txes ON txes.id = failed_messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ?", chain.ID)
+	if err := heights.where(query, "blocks.height").Order("blocks.height ASC, failed_messages.tx_id ASC, failed_messages.message_index ASC").Find(&failedMessages).Error; err != nil {
+		return nil, err
+	}
+
+	return failedMessages, nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+// GrantedFee is a fee returned by GetFeesGrantedByAddress with the tx that paid it
+type GrantedFee struct {
+	models.Fee
+	TxHash string
+	Height int64
+}
+
+// GetFeesGrantedByAddress returns the fees of the chain within the height range paid by the address as an x/feegrant granter,
+// with their denomination, payer and granter loaded, ordered by height. An address that was never indexed has no fees.
+func GetFeesGrantedByAddress(ctx context.Context, db *gorm.DB, chain ChainRef, granter string, heights HeightRange, page Pagination) ([]GrantedFee, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+	if err := page.validate(); err != nil {
+		return nil, err
+	}
+
+	var addressIDs []uint
+	if err := db.Model(&models.Address{}).Where("address = ?", granter).Limit(1).Pluck("id", &addressIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(addressIDs) == 0 {
+		return nil, nil
+	}
+
+	query := db.
+		Joins("JOIN txes ON txes.id = fees.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND fees.granter_address_id = ?", chain.ID, addressIDs[0])
+
+	query = heights.where(query, "blocks.height").
+		Preload("Denomination").
+		Preload("PayerAddress").
+		Preload("GranterAddress").
+		Order("blocks.height, fees.tx_id, fees.id")
+
+	var fees []models.Fee
+	if err := page.apply(query).Find(&fees).Error; err != nil {
+		return nil, err
+	}
+	if len(fees) == 0 {
+		return nil, nil
+	}
+
+	txIDs := make([]uint, len(fees))
+	for i, fee := range fees {
+		txIDs[i] = fee.TxID
+	}
+
+	var txs []struct {
+		ID     uint
+		Hash   string
+		Height int64
+	}
+	err := db.Table("txes").
+		Select("txes.id, txes.hash, blocks.height").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("txes.id IN ?", txIDs).
+		Scan(&txs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	txIndexes := make(map[uint]int, len(txs))
+	for i, tx := range txs {
+		txIndexes[tx.ID] = i
+	}
+
+	grantedFees := make([]GrantedFee, len(fees))
+	for i, fee := range fees {
+		tx := txs[txIndexes[fee.TxID]]
+		grantedFees[i] = GrantedFee{Fee: fee, TxHash: tx.Hash, Height: tx.Height}
+	}
+
+	return grantedFees, nil
+}
@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IBCDenomHash returns the hash of an ibc/ denom in upper case, false when the denom is not an ibc/ denom
+func IBCDenomHash(denom string) (string, bool) {
+	hash := strings.TrimPrefix(denom, "ibc/")
+	if hash == denom || hash == "" {
+		return "", false
+	}
+	return strings.ToUpper(hash), true
+}
+
+// UpsertIBCDenoms inserts the denom traces of the chain, updating the rows of the hashes already stored. Rows are stored as
+// given, resolved rows should clear the retry marker of a failed resolution.
+func UpsertIBCDenoms(ctx context.Context, db *gorm.DB, denoms []models.IBCDenom) error {
+	if len(denoms) == 0 {
+		return nil
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "hash"}},
+		DoUpdates: clause.AssignmentColumns([]string{"path", "base_denom", "resolved", "attempts", "last_error", "next_attempt_at", "updated_at"}),
+	}).Omit(clause.Associations).CreateInBatches(&denoms, insertBatchSize(db)).Error
+}
+
+// RecordIBCDenomFailure stores a failed resolution of the hash on the chain, counting the attempt and marking the hash
+// for a retry at nextAttempt. A hash that was resolved in the meantime is left as is.
+func RecordIBCDenomFailure(ctx context.Context, db *gorm.DB, chainID uint, hash string, cause error, nextAttempt time.Time) error {
+	denom := models.IBCDenom{
+		ChainID:       chainID,
+		Hash:          hash,
+		Attempts:      1,
+		LastError:     cause.Error(),
+		NextAttemptAt: &nextAttempt,
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "chain_id"}, {Name: "hash"}},
+		Where:   clause.Where{Exprs: []clause.Expression{clause.Eq{Column: clause.Column{Table: "ibc_denoms", Name: "resolved"}, Value: false}}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"attempts":        gorm.Expr("ibc_denoms.attempts + 1"),
+			"last_error":      denom.LastError,
+			"next_attempt_at": nextAttempt,
+			"updated_at":      time.Now(),
+		}),
+	}).Omit(clause.Associations).Create(&denom).Error
+}
+
+// GetIBCDenoms returns the stored rows of the hashes on the chain by hash, resolved or not
+func GetIBCDenoms(ctx context.Context, db *gorm.DB, chainID uint, hashes []string) (map[string]models.IBCDenom, error) {
+	denoms := make(map[string]models.IBCDenom, len(hashes))
+	if len(hashes) == 0 {
+		return denoms, nil
+	}
+
+	var rows []models.IBCDenom
+	err := db.WithContext(ctx).Where("chain_id = ? AND hash IN ?", chainID, hashes).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		denoms[row.Hash] = row
+	}
+	return denoms, nil
+}
+
+// GetFeeIBCDenomHashes returns the distinct hashes of the ibc/ denoms the indexed fees of the chain were paid in
+func GetFeeIBCDenomHashes(ctx context.Context, db *gorm.DB, chainID uint) ([]string, error) {
+	var bases []string
+	err := db.WithContext(ctx).Table("fees").
+		Distinct("denoms.base").
+		Joins("JOIN denoms ON denoms.id = fees.denomination_id").
+		Joins("JOIN txes ON txes.id = fees.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND denoms.base LIKE ?", chainID, "ibc/%").
+		Pluck("denoms.base", &bases).Error
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(bases))
+	hashes := make([]string, 0, len(bases))
+	for _, base := range bases {
+		hash, ok := IBCDenomHash(base)
+		if !ok {
+			continue
+		}
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"context"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ibcTransferPacketColumns = []clause.Column{
+	{Name: "chain_id"}, {Name: "source_port"}, {Name: "source_channel"}, {Name: "destination_port"}, {Name: "destination_channel"}, {Name: "sequence"},
+}
+
+// ibcTransferDataColumns are the columns taken from the packet, the same for every message of the transfer
+var ibcTransferDataColumns = []string{"direction", "sender", "receiver", "amount", "denom", "memo", "timeout_height", "timeout_timestamp"}
+
+// UpsertIBCTransferSend stores an outgoing transfer sent by a MsgTransfer. A transfer stored by its acknowledgement or
+// timeout keeps its status.
+func UpsertIBCTransferSend(ctx context.Context, db *gorm.DB, transfer models.IBCTransfer) error {
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   ibcTransferPacketColumns,
+		DoUpdates: clause.AssignmentColumns(append([]string{"height"}, ibcTransferDataColumns...)),
+	}).Omit(clause.Associations).Create(&transfer).Error
+}
+
+// UpsertIBCTransferResult stores the result of a transfer: the acknowledgement or timeout of an outgoing transfer, or the
+// receipt of an incoming transfer. The status replaces the pending status of a transfer stored when it was sent.
+func UpsertIBCTransferResult(ctx context.Context, db *gorm.DB, transfer models.IBCTransfer) error {
+	columns := append([]string{"status", "result_height", "error"}, ibcTransferDataColumns...)
+	if transfer.Direction == models.IBCTransferIncoming {
+		columns = append(columns, "height")
+	}
+
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   ibcTransferPacketColumns,
+		DoUpdates: clause.AssignmentColumns(columns),
+	}).Omit(clause.Associations).Create(&transfer).Error
+}
+
+// GetIBCTransfersByAddress returns the transfers of the chain sent or received by the address, which can be an address of
+// the chain or of the counterparty chain, ordered by height
+func GetIBCTransfersByAddress(ctx context.Context, db *gorm.DB, chain ChainRef, address string) ([]models.IBCTransfer, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+
+	var transfers []models.IBCTransfer
+	err := db.Where("chain_id = ? AND (sender = ? OR receiver = ?)", chain.ID, address, address).
+		Order("height, source_channel, sequence").
+		Find(&transfers).Error
+
+	return transfers, err
+}
+
+// GetPendingIBCTransfers returns the outgoing transfers of the chain that were not acknowledged or timed out yet, oldest first
+func GetPendingIBCTransfers(ctx context.Context, db *gorm.DB, chain ChainRef) ([]models.IBCTransfer, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+
+	var transfers []models.IBCTransfer
+	err := db.Where("chain_id = ? AND status = ?", chain.ID, models.IBCTransferPending).
+		Order("height, source_channel, sequence").
+		Find(&transfers).Error
+
+	return transfers, err
+}
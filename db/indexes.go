@@ -0,0 +1,163 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"gorm.io/gorm"
+)
+
+// secondaryIndex is an index created by CreateSecondaryIndexes after the migrations
+type secondaryIndex struct {
+	Name    string
+	Table   string
+	Columns string // Column list of the index, may contain expressions
+	// SQLiteColumns replaces Columns on SQLite, which lacks some of the PostgreSQL functions. Empty to use Columns.
+	SQLiteColumns string
+	// Method is the index access method, e.g. GIN. Empty for the default btree.
+	Method string
+}
+
+// secondaryIndexes are the indexes of the hot query paths that the model tags do not create. Lookups on txes.hash,
+// messages.tx_id, message_events.message_id, message_event_attributes.message_event_id and their block event counterparts
+// are served by the leading column of the unique indexes declared on the models and are not repeated here.
+//
+// Attribute values have no length limit and may exceed the PostgreSQL btree entry size, so they are indexed by their md5
+// and lookups must compare md5(value) = md5(?) to use the index.
+var secondaryIndexes = []secondaryIndex{
+	// Height ranges of a chain: the highest indexed block, completeness reports and reindexing a height range. The unique
+	// chainheight index leads with height and cannot seek to a chain.
+	{Name: "idx_blocks_chain_height", Table: "blocks", Columns: "chain_id, height"},
+	// Time ranges of a chain, and the time_stamp != zero filter of the indexed height lookups
+	{Name: "idx_blocks_chain_time_stamp", Table: "blocks", Columns: "chain_id, time_stamp"},
+	// Joins from blocks to their transactions: reindexing by message type, the stats and watchlist queries and the dual
+	// write report
+	{Name: "idx_txes_block_id", Table: "txes", Columns: "block_id"},
+	// Blocks containing a message type when reindexing by message type, and the per type stats
+	{Name: "idx_messages_message_type_id", Table: "messages", Columns: "message_type_id"},
+	// Message event attributes by key and value
+	{
+		Name:          "idx_message_event_attributes_key_value",
+		Table:         "message_event_attributes",
+		Columns:       "message_event_attribute_key_id, md5(value)",
+		SQLiteColumns: "message_event_attribute_key_id, value",
+	},
+	// Block event attributes by key and value
+	{
+		Name:          "idx_block_event_attributes_key_value",
+		Table:         "block_event_attributes",
+		Columns:       "block_event_attribute_key_id, md5(value)",
+		SQLiteColumns: "block_event_attribute_key_id, value",
+	},
+}
+
+// CreateSecondaryIndexes creates the secondary indexes missing from the database. On PostgreSQL they are built with
+// CREATE INDEX CONCURRENTLY when db is not in a transaction and the table is not partitioned, so indexing existing
+// tables does not block writes.
+// An index left invalid by an interrupted concurrent build is dropped and built again.
+func CreateSecondaryIndexes(db *gorm.DB) error {
+	for _, index := range secondaryIndexes {
+		if err := createSecondaryIndex(db, index); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// messageValueIndex serves the JSON path queries of GetMessagesByJSONPath. It is optional since it is as large as the
+// message bodies it indexes, see CreateMessageValueIndex.
+var messageValueIndex = secondaryIndex{Name: "idx_messages_value", Table: "messages", Columns: "value jsonb_path_ops", Method: "GIN"}
+
+// CreateMessageValueIndex creates the GIN index on the message values used by GetMessagesByJSONPath, if it is missing.
+// It is built like the secondary indexes, see CreateSecondaryIndexes. Requires PostgreSQL.
+func CreateMessageValueIndex(db *gorm.DB) error {
+	if err := requirePostgres(db); err != nil {
+		return err
+	}
+	return createSecondaryIndex(db, messageValueIndex)
+}
+
+// attributeValueTrigramIndex serves the substring searches of SearchEventAttributeValues. It is optional since it needs the
+// pg_trgm extension and is larger than the attribute values it indexes, see CreateAttributeValueTrigramIndex.
+var attributeValueTrigramIndex = secondaryIndex{
+	Name:    "idx_message_event_attributes_value_trgm",
+	Table:   "message_event_attributes",
+	Columns: "value gin_trgm_ops",
+	Method:  "GIN",
+}
+
+// CreateAttributeValueTrigramIndex creates the trigram index on the message event attribute values used by
+// SearchEventAttributeValues, if it is missing, creating the pg_trgm extension first when it is not installed. When the
+// extension is not available on the server or cannot be created by the user, a warning is logged and the index is skipped
+// without an error, searches still work with a full scan. It is built like the secondary indexes, see
+// CreateSecondaryIndexes. Requires PostgreSQL.
+func CreateAttributeValueTrigramIndex(db *gorm.DB) error {
+	if err := requirePostgres(db); err != nil {
+		return err
+	}
+
+	var installed bool
+	if err := db.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm')").Scan(&installed).Error; err != nil {
+		return err
+	}
+	if !installed {
+		if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+			config.Log.Warnf("The pg_trgm extension is not available, skipping the trigram index %s on message event attribute values. "+
+				"Install the extension or have a superuser run CREATE EXTENSION pg_trgm to create it. Err: %v", attributeValueTrigramIndex.Name, err)
+			return nil
+		}
+	}
+
+	return createSecondaryIndex(db, attributeValueTrigramIndex)
+}
+
+func createSecondaryIndex(db *gorm.DB, index secondaryIndex) error {
+	dialect := dialectOf(db)
+	_, inTx := db.Statement.ConnPool.(gorm.TxCommitter)
+
+	// Partitioned tables cannot be indexed concurrently, they are only partitioned when created and are empty then
+	concurrently := dialect == config.DialectPostgres && !inTx && !isPartitionedTable(db, index.Table)
+
+	if db.Migrator().HasIndex(index.Table, index.Name) {
+		if !concurrently {
+			return nil
+		}
+
+		var invalid bool
+		err := db.Raw("SELECT NOT indisvalid FROM pg_index JOIN pg_class ON pg_class.oid = pg_index.indexrelid WHERE pg_class.relname = ?", index.Name).Scan(&invalid).Error
+		if err != nil {
+			return err
+		}
+		if !invalid {
+			return nil
+		}
+
+		config.Log.Warnf("Index %s was left invalid by an interrupted build, rebuilding it", index.Name)
+		if err := db.Exec(fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %q", index.Name)).Error; err != nil {
+			return err
+		}
+	}
+
+	columns := index.Columns
+	if dialect != config.DialectPostgres && dialect != config.DialectCockroachDB && index.SQLiteColumns != "" {
+		columns = index.SQLiteColumns
+	}
+
+	create := "CREATE INDEX"
+	if concurrently {
+		create += " CONCURRENTLY"
+	}
+
+	using := ""
+	if index.Method != "" {
+		using = " USING " + index.Method
+	}
+
+	config.Log.Infof("Creating index %s on %s(%s)", index.Name, index.Table, columns)
+	if err := db.Exec(fmt.Sprintf("%s IF NOT EXISTS %q ON %q%s (%s)", create, index.Name, index.Table, using, columns)).Error; err != nil {
+		return fmt.Errorf("creating index %s failed: %w", index.Name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// likeLiteralEscaper escapes the characters of a LIKE pattern other than % matching themselves, with ESCAPE '\'
+var likeLiteralEscaper = strings.NewReplacer(`\`, `\\`, `_`, `\_`)
+
+// messageTypeCondition returns the condition matching the column to the message type and its argument. A message type
+// containing % is a LIKE pattern in which % is the only wildcard, _ and \ match themselves like in type URLs such as
+// /ibc.applications.interchain_accounts.v1.MsgRegisterInterchainAccount.
+func messageTypeCondition(column string, messageType string) (string, string) {
+	if !strings.Contains(messageType, "%") {
+		return column + " = ?", messageType
+	}
+	return column + ` LIKE ? ESCAPE '\'`, likeLiteralEscaper.Replace(messageType)
+}
+
+// GetMessagesByType returns the messages of the chain within the height range with the message type, with their type, tx
+// and block loaded, ordered by height and message index. A messageType containing % is a LIKE pattern, for example
+// /cosmos.bank.% for every bank message, otherwise the type must match exactly. % is the only wildcard of a pattern.
+func GetMessagesByType(ctx context.Context, db *gorm.DB, chain ChainRef, messageType string, heights HeightRange, page Pagination) ([]models.Message, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+	if err := page.validate(); err != nil {
+		return nil, err
+	}
+
+	typeCondition, typeArg := messageTypeCondition("message_types.message_type", messageType)
+
+	query := db.
+		Joins("JOIN message_types ON message_types.id = messages.message_type_id").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND "+typeCondition, chain.ID, typeArg)
+
+	query = heights.where(query, "blocks.height").
+		Preload("MessageType").
+		Preload("Tx.Block").
+		Order("blocks.height, txes.id, messages.message_index")
+
+	var messages []models.Message
+	if err := page.apply(query).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// SearchEventAttributeValues returns the message event attributes of the chain within the height range with the key and a
+// value matching the LIKE pattern, for example %osmo1contract% for every value containing the address, ordered by
+// height, message, event and attribute index. The key, event type, and the message with its type, tx and block are
+// loaded. An empty key matches every key. The pattern is case-sensitive on PostgreSQL, where substring patterns use the
+// index created with database.attribute-value-trigram-index.
+func SearchEventAttributeValues(ctx context.Context, db *gorm.DB, chain ChainRef, key string, valuePattern string, heights HeightRange, page Pagination) ([]models.MessageEventAttribute, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+	if err := page.validate(); err != nil {
+		return nil, err
+	}
+	if valuePattern == "" {
+		return nil, errors.New("value pattern is required")
+	}
+
+	query := db.
+		Joins("JOIN message_events ON message_events.id = message_event_attributes.message_event_id").
+		Joins("JOIN messages ON messages.id = message_events.message_id").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND message_event_attributes.value LIKE ?", chain.ID, valuePattern)
+	if key != "" {
+		query = query.
+			Joins("JOIN message_event_attribute_keys ON message_event_attribute_keys.id = message_event_attributes.message_event_attribute_key_id").
+			Where("message_event_attribute_keys.key = ?", key)
+	}
+
+	query = heights.where(query, "blocks.height").
+		Preload("MessageEventAttributeKey").
+		Preload("MessageEvent.MessageEventType").
+		Preload("MessageEvent.Message.MessageType").
+		Preload("MessageEvent.Message.Tx.Block").
+		Order(`blocks.height, txes.id, messages.message_index, message_events."index", message_event_attributes."index"`)
+
+	var attributes []models.MessageEventAttribute
+	if err := page.apply(query).Find(&attributes).Error; err != nil {
+		return nil, err
+	}
+
+	return attributes, nil
+}
+
+// GetMessagesByJSONPath returns the messages of the chain within the height range whose value matches the SQL/JSON path
+// expression, with their type, tx and block loaded, ordered by height and message index. The path is matched with the @?
+// operator, for example $.amount[*] ? (@.denom == "uatom") for the messages sending uatom. Only messages indexed with
+// flags.store-message-bodies have a value. The query uses the index created with database.message-value-index.
+// Requires PostgreSQL.
+func GetMessagesByJSONPath(ctx context.Context, db *gorm.DB, chain ChainRef, path string, heights HeightRange, page Pagination) ([]models.Message, error) {
+	db = readDB(ctx, db)
+	if err := requirePostgres(db); err != nil {
+		return nil, err
+	}
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+	if err := page.validate(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(path) == "" {
+		return nil, errors.New("JSON path is required")
+	}
+
+	query := db.
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ?", chain.ID).
+		// gorm binds every ?, the one of the @? operator is written back as is
+		Where("messages.value @? CAST(? AS jsonpath)", clause.Expr{SQL: "?"}, path)
+
+	query = heights.where(query, "blocks.height").
+		Preload("MessageType").
+		Preload("Tx.Block").
+		Order("blocks.height, txes.id, messages.message_index")
+
+	var messages []models.Message
+	if err := page.apply(query).Find(&messages).Error; err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
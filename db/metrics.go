@@ -0,0 +1,95 @@
+package db
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"gorm.io/gorm"
+)
+
+const metricsPluginName = "cosmos-indexer:metrics"
+
+// indexMetrics records the blocks indexed and the failures recorded on the connection it is registered on
+type indexMetrics struct {
+	metrics *metrics.Metrics
+
+	mu     sync.Mutex
+	chains map[uint]string // Chain IDs by the ID of their row, the chain_id label of the metrics
+}
+
+// UseMetrics records the blocks indexed by IndexNewBlock, IndexNewBlocks and IndexBlockEvents on db and the failures recorded
+// by UpsertFailedBlock and UpsertFailedEventBlock in m
+func UseMetrics(db *gorm.DB, m *metrics.Metrics) error {
+	return db.Use(&indexMetrics{metrics: m, chains: make(map[uint]string)})
+}
+
+func (p *indexMetrics) Name() string {
+	return metricsPluginName
+}
+
+func (p *indexMetrics) Initialize(*gorm.DB) error {
+	return nil
+}
+
+// metricsOf returns the metrics registered on db, nil when there are none
+func metricsOf(db *gorm.DB) *indexMetrics {
+	p, _ := db.Config.Plugins[metricsPluginName].(*indexMetrics)
+	return p
+}
+
+// chainLabel returns the chain ID of the chain row, looked up once per chain. The row ID is used if the lookup fails.
+func (p *indexMetrics) chainLabel(db *gorm.DB, id uint) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if label, ok := p.chains[id]; ok {
+		return label
+	}
+
+	var chain models.Chain
+	if err := db.Select("chain_id").Where("id = ?", id).Limit(1).Find(&chain).Error; err != nil || chain.ChainID == "" {
+		return strconv.FormatUint(uint64(id), 10)
+	}
+	p.chains[id] = chain.ChainID
+	return chain.ChainID
+}
+
+// observeBlocks records the blocks of the chain indexed in one database transaction that started at txStart, after
+// indexing started at start
+func (p *indexMetrics) observeBlocks(db *gorm.DB, chainID uint, dataset string, heights []int64, txs int, start time.Time, txStart time.Time) {
+	end := time.Now()
+	p.metrics.ObserveBlocks(p.chainLabel(db, chainID), dataset, heights, txs, end.Sub(start), end.Sub(txStart))
+}
+
+// observeIndexedBlocks records the blocks indexed by IndexNewBlocks
+func observeIndexedBlocks(db *gorm.DB, blocks []BlockTxsDBWrapper, start time.Time, txStart time.Time) {
+	p := metricsOf(db)
+	if p == nil || len(blocks) == 0 {
+		return
+	}
+
+	heights := make([]int64, len(blocks))
+	txs := 0
+	for i, block := range blocks {
+		heights[i] = block.Block.Height
+		txs += len(block.Txs)
+	}
+	p.observeBlocks(db, blocks[0].Block.ChainID, metrics.DatasetTxs, heights, txs, start, txStart)
+}
+
+// observeIndexedBlockEvents records the block indexed by IndexBlockEvents
+func observeIndexedBlockEvents(db *gorm.DB, block *BlockDBWrapper, start time.Time, txStart time.Time) {
+	if p := metricsOf(db); p != nil {
+		p.observeBlocks(db, block.Block.ChainID, metrics.DatasetBlockEvents, []int64{block.Block.Height}, 0, start, txStart)
+	}
+}
+
+// observeFailedBlock records a failure recorded by UpsertFailedBlock or UpsertFailedEventBlock
+func observeFailedBlock(db *gorm.DB, chainID string, dataset string, stage IndexStage) {
+	if p := metricsOf(db); p != nil {
+		p.metrics.ObserveFailedBlock(chainID, dataset, string(stage))
+	}
+}
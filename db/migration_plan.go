@@ -0,0 +1,193 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+// PlannedChangeKind is what a planned statement does to the schema
+type PlannedChangeKind string
+
+const (
+	PlannedCreateTable      PlannedChangeKind = "create table"
+	PlannedAddColumn        PlannedChangeKind = "add column"
+	PlannedAlterColumn      PlannedChangeKind = "alter column"
+	PlannedCreateIndex      PlannedChangeKind = "create index"
+	PlannedCreateConstraint PlannedChangeKind = "create constraint"
+	PlannedOther            PlannedChangeKind = "other"
+)
+
+// PlannedChange is a statement a migration would execute
+type PlannedChange struct {
+	Migration uint // Version of the migration, 0 for the schema_migrations table, the secondary indexes and legacy AutoMigrate
+	Kind      PlannedChangeKind
+	Table     string
+	Name      string // The column, index or constraint, empty for tables and other statements
+	SQL       string
+}
+
+// MigrationPlan returns the statements MigrateModels would execute against the database, in order, without executing
+// them. Schema inspection queries still run, every other statement is recorded instead.
+func MigrationPlan(ctx context.Context, db *gorm.DB) ([]PlannedChange, error) {
+	db = db.WithContext(ctx)
+	if err := VerifySchema(db); err != nil {
+		return nil, err
+	}
+
+	if err := verifyPartitioning(db); err != nil {
+		return nil, err
+	}
+
+	recorder := newPlanRecorder(db)
+	if err := recorder.record(0, func(planDB *gorm.DB) error {
+		return planDB.AutoMigrate(&models.SchemaMigration{})
+	}); err != nil {
+		return nil, err
+	}
+
+	var current uint
+	if db.Migrator().HasTable(&models.SchemaMigration{}) {
+		var err error
+		if current, err = schemaVersion(db); err != nil {
+			return nil, err
+		}
+	}
+
+	if latest := migrations[len(migrations)-1].Version; current > latest {
+		return nil, &SchemaAheadError{DatabaseVersion: current, LatestVersion: latest}
+	}
+
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := recorder.record(migration.Version, migration.Migrate); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := recorder.record(0, CreateSecondaryIndexes); err != nil {
+		return nil, err
+	}
+
+	return recorder.changes, nil
+}
+
+// AutoMigrationPlan returns the statements AutoMigrateModels would execute against the database, without executing them
+func AutoMigrationPlan(ctx context.Context, db *gorm.DB) ([]PlannedChange, error) {
+	db = db.WithContext(ctx)
+	if err := VerifySchema(db); err != nil {
+		return nil, err
+	}
+
+	if err := verifyPartitioning(db); err != nil {
+		return nil, err
+	}
+
+	recorder := newPlanRecorder(db)
+	if err := recorder.record(0, autoMigrateModels); err != nil {
+		return nil, err
+	}
+
+	if err := recorder.record(0, CreateSecondaryIndexes); err != nil {
+		return nil, err
+	}
+
+	return recorder.changes, nil
+}
+
+// planRecorder is a connection pool that passes queries through to the database and records the statements executed on it
+type planRecorder struct {
+	gorm.ConnPool
+	db        *gorm.DB
+	migration uint
+	changes   []PlannedChange
+	seen      map[string]struct{}
+}
+
+func newPlanRecorder(db *gorm.DB) *planRecorder {
+	return &planRecorder{ConnPool: db.Statement.ConnPool, db: db, seen: make(map[string]struct{})}
+}
+
+// record runs fn on a session of the database that records the statements it executes under the migration version
+func (r *planRecorder) record(migration uint, fn func(planDB *gorm.DB) error) error {
+	r.migration = migration
+	planDB := r.db.Session(&gorm.Session{NewDB: true})
+	planDB.Statement.ConnPool = r
+	return fn(planDB)
+}
+
+func (r *planRecorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	change := classifyPlannedChange(r.migration, r.db.Dialector.Explain(query, args...))
+
+	// The tables are not created, so AutoMigrate plans a table again when a later model depends on it. Executed in order
+	// the table would exist by then and nothing would be done.
+	key := change.SQL
+	if change.Kind == PlannedCreateTable {
+		key = string(change.Kind) + " " + change.Table
+	}
+
+	if _, ok := r.seen[key]; !ok {
+		r.seen[key] = struct{}{}
+		r.changes = append(r.changes, change)
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+// BeginTx keeps statements run in a transaction, like the SQLite column changes, in the plan
+func (r *planRecorder) BeginTx(context.Context, *sql.TxOptions) (gorm.ConnPool, error) {
+	return &planRecorderTx{r}, nil
+}
+
+type planRecorderTx struct {
+	*planRecorder
+}
+
+func (*planRecorderTx) Commit() error   { return nil }
+func (*planRecorderTx) Rollback() error { return nil }
+
+// Identifiers are quoted with double quotes by PostgreSQL and backticks by SQLite
+const plannedIdentifier = "[\"`]?([^\"`\\s(]+)[\"`]?"
+
+var plannedChangePatterns = []struct {
+	kind    PlannedChangeKind
+	pattern *regexp.Regexp // Captures the table, then the name when there is one
+}{
+	{PlannedCreateTable, regexp.MustCompile(`(?i)^CREATE TABLE (?:IF NOT EXISTS )?` + plannedIdentifier)},
+	{PlannedCreateConstraint, regexp.MustCompile(`(?i)^ALTER TABLE ` + plannedIdentifier + ` ADD CONSTRAINT ` + plannedIdentifier)},
+	{PlannedAlterColumn, regexp.MustCompile(`(?i)^ALTER TABLE ` + plannedIdentifier + ` ALTER COLUMN ` + plannedIdentifier)},
+	{PlannedAddColumn, regexp.MustCompile(`(?i)^ALTER TABLE ` + plannedIdentifier + ` ADD (?:COLUMN )?` + plannedIdentifier)},
+	{PlannedCreateIndex, regexp.MustCompile(`(?i)^CREATE (?:UNIQUE )?INDEX (?:CONCURRENTLY )?(?:IF NOT EXISTS )?` + plannedIdentifier + ` ON ` + plannedIdentifier)},
+}
+
+func classifyPlannedChange(migration uint, statement string) PlannedChange {
+	change := PlannedChange{Migration: migration, Kind: PlannedOther, SQL: strings.TrimSpace(statement)}
+
+	for _, planned := range plannedChangePatterns {
+		match := planned.pattern.FindStringSubmatch(change.SQL)
+		if match == nil {
+			continue
+		}
+
+		change.Kind = planned.kind
+		change.Table = match[1]
+		if len(match) > 2 {
+			change.Name = match[2]
+		}
+
+		// Index statements name the index before the table
+		if planned.kind == PlannedCreateIndex {
+			change.Table, change.Name = match[2], match[1]
+		}
+		break
+	}
+
+	return change
+}
@@ -0,0 +1,454 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+// Migration is a versioned change to the indexer schema. Migrations are applied in order of version, each in its own
+// transaction, and recorded in schema_migrations so they run once.
+type Migration struct {
+	Version     uint
+	Description string
+	Migrate     func(db *gorm.DB) error
+}
+
+// migrations are the schema migrations of this binary in order of version. A released migration must not change, schema
+// changes are added as a new migration at the end.
+//
+// Migration 1 is the schema that AutoMigrate maintained before versioned migrations and adopts databases created by it.
+// It runs AutoMigrate with the current models, so a model change needs a migration that makes the same change to
+// databases already past version 1 and that does nothing when version 1 already created the new schema.
+var migrations = []Migration{
+	{Version: 1, Description: "initial schema", Migrate: autoMigrateModels},
+	{Version: 2, Description: "block height on the message tables", Migrate: addMessageHeights},
+	{Version: 3, Description: "failure details on the failed block tables", Migrate: addFailureDetails},
+	{Version: 4, Description: "quarantine of repeatedly failing blocks", Migrate: addFailureQuarantine},
+	{Version: 5, Description: "fee granter on the fees table", Migrate: addFeeGranter},
+	{Version: 6, Description: "gas wanted and used on the txes table", Migrate: addTxGas},
+	{Version: 7, Description: "memo on the txes table", Migrate: addTxMemo},
+	{Version: 8, Description: "error message on the txes table", Migrate: addTxErrorMessage},
+	{Version: 9, Description: "hash and size on the blocks table", Migrate: addBlockHashAndSize},
+	{Version: 10, Description: "tx count on the blocks table", Migrate: addBlockTxCount},
+	{Version: 11, Description: "validators, block proposer validator and block signatures", Migrate: addValidators},
+	{Version: 12, Description: "decoded value on the messages table", Migrate: addMessageValue},
+	{Version: 13, Description: "unique block event types and attribute keys", Migrate: uniqueBlockEventLookups},
+	{Version: 14, Description: "failure stage on the failed block tables", Migrate: addFailureStage},
+	{Version: 15, Description: "failure details on the failed tx and message tables", Migrate: addTxFailureDetails},
+	{Version: 16, Description: "pruned flag on the blocks table", Migrate: addBlockPruned},
+	{Version: 17, Description: "bech32 prefix, base denom and network on the chains table", Migrate: addChainMetadata},
+	{Version: 18, Description: "ibc denom traces", Migrate: addIBCDenoms},
+	{Version: 19, Description: "ibc transfers", Migrate: addIBCTransfers},
+	{Version: 20, Description: "unavailable block ranges", Migrate: addUnavailableBlockRanges},
+	{Version: 21, Description: "indexer checkpoints", Migrate: addIndexerCheckpoints},
+	{Version: 22, Description: "dual write chain cutovers", Migrate: addChainCutovers},
+}
+
+// migrationLockID is the PostgreSQL advisory lock held while a migration is applied, so indexers started together do
+// not apply the same migration twice
+const migrationLockID = 7345062893115208113
+
+// SchemaAheadError is returned by ApplyMigrations when the database has migrations applied that this binary does not know,
+// i.e. it was migrated by a newer version of the indexer
+type SchemaAheadError struct {
+	DatabaseVersion uint
+	LatestVersion   uint
+}
+
+func (e *SchemaAheadError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the latest version %d known to this binary, upgrade the indexer", e.DatabaseVersion, e.LatestVersion)
+}
+
+// ApplyMigrations applies the migrations not yet recorded in schema_migrations in order of version
+func ApplyMigrations(db *gorm.DB) error {
+	return applyMigrations(db, migrations)
+}
+
+func applyMigrations(db *gorm.DB, migrations []Migration) error {
+	if err := db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return err
+	}
+
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			return fmt.Errorf("migration %d is out of order", migrations[i].Version)
+		}
+	}
+
+	var latest uint
+	if len(migrations) != 0 {
+		latest = migrations[len(migrations)-1].Version
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		return &SchemaAheadError{DatabaseVersion: current, LatestVersion: latest}
+	}
+
+	for _, migration := range migrations {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if dialectOf(tx) == config.DialectPostgres {
+				if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error; err != nil {
+					return err
+				}
+			}
+
+			// Checked under the lock, another indexer may have applied it while this one waited
+			var applied int64
+			if err := tx.Model(&models.SchemaMigration{}).Where("version = ?", migration.Version).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied != 0 {
+				return nil
+			}
+
+			config.Log.Infof("Applying schema migration %d: %s", migration.Version, migration.Description)
+			if err := migration.Migrate(tx); err != nil {
+				return err
+			}
+
+			return tx.Create(&models.SchemaMigration{Version: migration.Version, Description: migration.Description, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("schema migration %d (%s) failed: %w", migration.Version, migration.Description, err)
+		}
+	}
+
+	return nil
+}
+
+// addMessageHeights adds the height column, the partition key of partitioned databases, to the message tables. Rows
+// indexed before it keep height 0.
+func addMessageHeights(db *gorm.DB) error {
+	for _, model := range []any{&models.Message{}, &models.MessageEvent{}, &models.MessageEventAttribute{}} {
+		if db.Migrator().HasColumn(model, "Height") {
+			continue
+		}
+		if err := db.Migrator().AddColumn(model, "Height"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFailureDetails adds the failure details to the failed block tables. The failures recorded before them are counted
+// as a single attempt at the time they were recorded.
+func addFailureDetails(db *gorm.DB) error {
+	for _, model := range []any{&models.FailedBlock{}, &models.FailedEventBlock{}} {
+		for _, column := range []string{"Error", "FirstFailedAt", "LastFailedAt", "AttemptCount"} {
+			if db.Migrator().HasColumn(model, column) {
+				continue
+			}
+			if err := db.Migrator().AddColumn(model, column); err != nil {
+				return err
+			}
+		}
+
+		err := db.Model(model).Where("attempt_count = 0").Updates(map[string]any{
+			"first_failed_at": gorm.Expr("created_at"),
+			"last_failed_at":  gorm.Expr("created_at"),
+			"attempt_count":   1,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFailureQuarantine adds the quarantined flag to the failed block tables
+func addFailureQuarantine(db *gorm.DB) error {
+	for _, model := range []any{&models.FailedBlock{}, &models.FailedEventBlock{}} {
+		if db.Migrator().HasColumn(model, "Quarantined") {
+			continue
+		}
+		if err := db.Migrator().AddColumn(model, "Quarantined"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFeeGranter adds the fee granter to the fees table. Fees indexed before it have no granter.
+func addFeeGranter(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Fee{}, "GranterAddressID") {
+		if err := db.Migrator().AddColumn(&models.Fee{}, "GranterAddressID"); err != nil {
+			return err
+		}
+	}
+	if !db.Migrator().HasIndex(&models.Fee{}, "idx_granter_addr") {
+		if err := db.Migrator().CreateIndex(&models.Fee{}, "idx_granter_addr"); err != nil {
+			return err
+		}
+	}
+
+	// SQLite, used by the tests, can only add a foreign key by rebuilding the table
+	dialect := dialectOf(db)
+	if dialect != config.DialectPostgres && dialect != config.DialectCockroachDB || db.Config.DisableForeignKeyConstraintWhenMigrating {
+		return nil
+	}
+	if !db.Migrator().HasConstraint(&models.Fee{}, "GranterAddress") {
+		return db.Migrator().CreateConstraint(&models.Fee{}, "GranterAddress")
+	}
+	return nil
+}
+
+// addTxGas adds the gas wanted and used to the txes table. Txs indexed before them keep 0.
+func addTxGas(db *gorm.DB) error {
+	for _, column := range []string{"GasWanted", "GasUsed"} {
+		if db.Migrator().HasColumn(&models.Tx{}, column) {
+			continue
+		}
+		if err := db.Migrator().AddColumn(&models.Tx{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTxMemo adds the memo to the txes table. Txs indexed before it have an empty memo.
+func addTxMemo(db *gorm.DB) error {
+	if db.Migrator().HasColumn(&models.Tx{}, "Memo") {
+		return nil
+	}
+	return db.Migrator().AddColumn(&models.Tx{}, "Memo")
+}
+
+// addTxErrorMessage adds the error message of failed txs to the txes table. Txs indexed before it have no error message.
+func addTxErrorMessage(db *gorm.DB) error {
+	if db.Migrator().HasColumn(&models.Tx{}, "ErrorMessage") {
+		return nil
+	}
+	return db.Migrator().AddColumn(&models.Tx{}, "ErrorMessage")
+}
+
+// addBlockHashAndSize adds the hash and size to the blocks table. Blocks indexed before them have no hash and size 0.
+func addBlockHashAndSize(db *gorm.DB) error {
+	for _, column := range []string{"BlockHash", "BlockSizeBytes"} {
+		if db.Migrator().HasColumn(&models.Block{}, column) {
+			continue
+		}
+		if err := db.Migrator().AddColumn(&models.Block{}, column); err != nil {
+			return err
+		}
+	}
+	if db.Migrator().HasIndex(&models.Block{}, "BlockHash") {
+		return nil
+	}
+	return db.Migrator().CreateIndex(&models.Block{}, "BlockHash")
+}
+
+// addBlockTxCount adds the tx count to the blocks table and counts the txs of the blocks indexed before it
+func addBlockTxCount(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Block{}, "TxCount") {
+		if err := db.Migrator().AddColumn(&models.Block{}, "TxCount"); err != nil {
+			return err
+		}
+	}
+
+	return db.Model(&models.Block{}).
+		Where("tx_indexed = ?", true).
+		Update("tx_count", gorm.Expr("(SELECT COUNT(*) FROM txes WHERE txes.block_id = blocks.id)")).Error
+}
+
+// addValidators adds the validators and block signatures tables and the proposer validator to the blocks table. Blocks
+// indexed before it have no proposer validator.
+func addValidators(db *gorm.DB) error {
+	for _, model := range []any{&models.Validator{}, &models.BlockSignature{}} {
+		if db.Migrator().HasTable(model) {
+			continue
+		}
+		if err := db.Migrator().CreateTable(model); err != nil {
+			return err
+		}
+	}
+
+	if !db.Migrator().HasColumn(&models.Block{}, "ProposerValidatorID") {
+		if err := db.Migrator().AddColumn(&models.Block{}, "ProposerValidatorID"); err != nil {
+			return err
+		}
+	}
+	if !db.Migrator().HasIndex(&models.Block{}, "ProposerValidatorID") {
+		if err := db.Migrator().CreateIndex(&models.Block{}, "ProposerValidatorID"); err != nil {
+			return err
+		}
+	}
+
+	// SQLite, used by the tests, can only add a foreign key by rebuilding the table
+	dialect := dialectOf(db)
+	if dialect != config.DialectPostgres && dialect != config.DialectCockroachDB || db.Config.DisableForeignKeyConstraintWhenMigrating {
+		return nil
+	}
+	if !db.Migrator().HasConstraint(&models.Block{}, "ProposerValidator") {
+		return db.Migrator().CreateConstraint(&models.Block{}, "ProposerValidator")
+	}
+	return nil
+}
+
+// addMessageValue adds the decoded message value to the messages table. Messages indexed before it have no value.
+func addMessageValue(db *gorm.DB) error {
+	if db.Migrator().HasColumn(&models.Message{}, "Value") {
+		return nil
+	}
+	return db.Migrator().AddColumn(&models.Message{}, "Value")
+}
+
+// blockEventLookups are the lookup tables of the block events, with their unique column and the table and column
+// referencing them
+var blockEventLookups = []struct {
+	Model           any
+	Table           string
+	Column          string
+	Field           string
+	ReferenceTable  string
+	ReferenceColumn string
+}{
+	{&models.BlockEventType{}, "block_event_types", "type", "Type", "block_events", "block_event_type_id"},
+	{&models.BlockEventAttributeKey{}, "block_event_attribute_keys", "key", "Key", "block_event_attributes", "block_event_attribute_key_id"},
+}
+
+// uniqueBlockEventLookups enforces the unique indexes of the block event types and attribute keys on databases missing
+// them, whose concurrent block event workers may have stored the same type or key more than once. Duplicates are merged
+// into the row with the lowest ID first.
+func uniqueBlockEventLookups(db *gorm.DB) error {
+	for _, lookup := range blockEventLookups {
+		if db.Migrator().HasIndex(lookup.Model, lookup.Field) {
+			continue
+		}
+
+		lowestID := fmt.Sprintf("SELECT MIN(lowest.id) FROM %s lowest WHERE lowest.%q = %s.%q", lookup.Table, lookup.Column, lookup.Table, lookup.Column)
+		duplicateIDs := fmt.Sprintf("SELECT id FROM %s WHERE id > (%s)", lookup.Table, lowestID)
+
+		repoint := fmt.Sprintf("UPDATE %s SET %s = (SELECT (%s) FROM %s WHERE %s.id = %s.%s) WHERE %s IN (%s)",
+			lookup.ReferenceTable, lookup.ReferenceColumn,
+			lowestID, lookup.Table, lookup.Table, lookup.ReferenceTable, lookup.ReferenceColumn,
+			lookup.ReferenceColumn, duplicateIDs)
+		if err := db.Exec(repoint).Error; err != nil {
+			return err
+		}
+		if err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE id IN (%s)", lookup.Table, duplicateIDs)).Error; err != nil {
+			return err
+		}
+
+		if err := db.Migrator().CreateIndex(lookup.Model, lookup.Field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schemaVersion returns the highest migration version applied to the database, 0 if none are
+func schemaVersion(db *gorm.DB) (uint, error) {
+	var version *uint
+	err := db.Model(&models.SchemaMigration{}).Select("MAX(version)").Scan(&version).Error
+	if err != nil || version == nil {
+		return 0, err
+	}
+	return *version, nil
+}
+
+// addFailureStage adds the stage of the latest failure to the failed block tables
+func addFailureStage(db *gorm.DB) error {
+	for _, model := range []any{&models.FailedBlock{}, &models.FailedEventBlock{}} {
+		if db.Migrator().HasColumn(model, "Stage") {
+			continue
+		}
+		if err := db.Migrator().AddColumn(model, "Stage"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTxFailureDetails adds the decode error and raw bytes to the failed tx and message tables, a unique index on the
+// messages of a tx to the failed message tables and the partially indexed flag to the blocks table. Nothing was written to
+// the failed tx and message tables before.
+func addTxFailureDetails(db *gorm.DB) error {
+	columns := []struct {
+		model  any
+		fields []string
+	}{
+		{&models.FailedTx{}, []string{"Error", "TxBytes"}},
+		{&models.FailedMessage{}, []string{"Error", "TypeURL", "MessageBytes"}},
+		{&models.Block{}, []string{"TxPartiallyIndexed"}},
+	}
+	for _, table := range columns {
+		for _, column := range table.fields {
+			if db.Migrator().HasColumn(table.model, column) {
+				continue
+			}
+			if err := db.Migrator().AddColumn(table.model, column); err != nil {
+				return err
+			}
+		}
+	}
+
+	if db.Migrator().HasIndex(&models.FailedMessage{}, "failedMessageIndex") {
+		return nil
+	}
+	return db.Migrator().CreateIndex(&models.FailedMessage{}, "failedMessageIndex")
+}
+
+func addBlockPruned(db *gorm.DB) error {
+	if db.Migrator().HasColumn(&models.Block{}, "Pruned") {
+		return nil
+	}
+	return db.Migrator().AddColumn(&models.Block{}, "Pruned")
+}
+
+// addChainMetadata adds the bech32 prefix, base denom and network columns to the chains table, filled in from the config
+// by GetOrCreateChain the next time the indexer starts
+func addChainMetadata(db *gorm.DB) error {
+	for _, column := range []string{"Bech32Prefix", "BaseDenom", "Network"} {
+		if db.Migrator().HasColumn(&models.Chain{}, column) {
+			continue
+		}
+		if err := db.Migrator().AddColumn(&models.Chain{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addIBCDenoms(db *gorm.DB) error {
+	if db.Migrator().HasTable(&models.IBCDenom{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&models.IBCDenom{})
+}
+
+func addIBCTransfers(db *gorm.DB) error {
+	if db.Migrator().HasTable(&models.IBCTransfer{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&models.IBCTransfer{})
+}
+
+func addUnavailableBlockRanges(db *gorm.DB) error {
+	if db.Migrator().HasTable(&models.UnavailableBlockRange{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&models.UnavailableBlockRange{})
+}
+
+func addIndexerCheckpoints(db *gorm.DB) error {
+	if db.Migrator().HasTable(&models.IndexerCheckpoint{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&models.IndexerCheckpoint{})
+}
+
+func addChainCutovers(db *gorm.DB) error {
+	if db.Migrator().HasTable(&models.ChainCutover{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&models.ChainCutover{})
+}
@@ -24,6 +24,7 @@ type BlockDBWrapper struct {
 	EndBlockEvents                []BlockEventDBWrapper
 	UniqueBlockEventTypes         map[string]models.BlockEventType
 	UniqueBlockEventAttributeKeys map[string]models.BlockEventAttributeKey
+	QuarantinedAttributes         []models.QuarantinedAttribute // Attributes left out of the events because they could not be decoded
 }
 
 type BlockEventDBWrapper struct {
@@ -32,6 +33,12 @@ type BlockEventDBWrapper struct {
 	BlockEventParsedDatasets []parsers.BlockEventParsedData
 }
 
+// BlockTxsDBWrapper is a block with its transactions, indexed in batches by IndexNewBlocks
+type BlockTxsDBWrapper struct {
+	Block models.Block
+	Txs   []TxDBWrapper
+}
+
 // Store transactions with their messages for easy database creation
 type TxDBWrapper struct {
 	Tx                         models.Tx
@@ -39,6 +46,8 @@ type TxDBWrapper struct {
 	UniqueMessageTypes         map[string]models.MessageType
 	UniqueMessageEventTypes    map[string]models.MessageEventType
 	UniqueMessageAttributeKeys map[string]models.MessageEventAttributeKey
+	WatchedAddresses           []string               // Watched addresses involved in the tx, these txs are indexed in full regardless of filters
+	FailedMessages             []models.FailedMessage // Messages of the tx that could not be decoded, stored with the tx
 }
 
 type MessageDBWrapper struct {
@@ -1,6 +1,22 @@
 package models
 
+import (
+	"github.com/DefiantLabs/cosmos-indexer/util"
+	"gorm.io/gorm"
+)
+
 type Address struct {
 	ID      uint
 	Address string `gorm:"uniqueIndex"`
+	// CanonicalHex is the hex encoded bytes of a bech32 address, empty for other values. Rows created before it was tracked
+	// are filled in by the canonical-address-hex backfill.
+	CanonicalHex string `gorm:"not null;default:'';index"`
+}
+
+// This lifecycle function fills in the canonical hex of new addresses, existing rows are filled in by the backfill
+func (a *Address) BeforeCreate(tx *gorm.DB) (err error) {
+	if a.CanonicalHex == "" {
+		a.CanonicalHex = util.CanonicalAddressHex(a.Address)
+	}
+	return nil
 }
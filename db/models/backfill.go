@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type BackfillStatus string
+
+const (
+	BackfillRunning   BackfillStatus = "running"
+	BackfillPaused    BackfillStatus = "paused"
+	BackfillCompleted BackfillStatus = "completed"
+)
+
+// BackfillJob tracks the progress of a backfill so it can be resumed from its cursor, the ID of the last row processed
+type BackfillJob struct {
+	ID            uint
+	Name          string `gorm:"uniqueIndex"`
+	Status        BackfillStatus
+	Cursor        uint
+	RowsProcessed int64
+	LastError     string
+	StartedAt     time.Time
+	UpdatedAt     time.Time
+	CompletedAt   *time.Time
+}
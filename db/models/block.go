@@ -15,6 +15,27 @@ type Block struct {
 	TxIndexed             bool
 	// TODO: Should block event indexing be split out or rolled up?
 	BlockEventsIndexed bool
+	// IndexProfile is the range profile the block was last indexed with, empty when range profiles were not configured
+	IndexProfile string
+	// BlockHash is the upper case hex hash of the block header, empty for blocks indexed before it was stored
+	BlockHash string `gorm:"index;not null;default:''"`
+	// BlockSizeBytes is the size of the encoded block, 0 for blocks indexed before it was stored
+	BlockSizeBytes int64 `gorm:"not null;default:0"`
+	// TxCount is the number of txs indexed for the block, 0 until its txs are indexed
+	TxCount int64 `gorm:"not null;default:0"`
+	// ProposerValidatorID is the validator with the proposer consensus address, nil for blocks indexed before validators
+	ProposerValidatorID *uint `gorm:"index"`
+	ProposerValidator   *Validator
+	// TxPartiallyIndexed is set when txs or messages of the block could not be decoded, they are recorded in failed_txes and
+	// failed_messages and the rest of the block is indexed
+	TxPartiallyIndexed bool `gorm:"not null;default:false"`
+	// Pruned is set when the txs, messages and block events of the block were deleted by the retention policy, which also
+	// clears the indexed flags. The row is kept so the height is not indexed again, until it is explicitly reindexed.
+	Pruned bool `gorm:"not null;default:false"`
+	// Signatures of the last commit of the block, set by block processing and stored when flags.index-block-signatures is set
+	Signatures []BlockSignature `gorm:"-"`
+	// FailedTxs are the txs of the block that could not be decoded, set by tx processing and stored with the block
+	FailedTxs []FailedTx `gorm:"-"`
 }
 
 // Used to keep track of BeginBlock and EndBlock events
@@ -48,6 +69,8 @@ type BlockEventAttribute struct {
 	BlockEvent   BlockEvent
 	BlockEventID uint `gorm:"uniqueIndex:eventAttributeIndex,priority:1"`
 	Value        string
+	ValueBytes   []byte // The original value when it was not valid text and flags.invalid-text-policy is bytea
+	Sanitized    bool   // Set when null bytes or invalid UTF-8 were removed from Value
 	Index        uint64 `gorm:"uniqueIndex:eventAttributeIndex,priority:2"`
 	// Keys are limited to a smallish subset of string values set by the Cosmos SDK and external modules
 	// Save DB space by storing the key as a foreign key
@@ -61,15 +84,31 @@ type BlockEventAttributeKey struct {
 }
 
 type FailedBlock struct {
-	ID           uint
-	Height       int64 `gorm:"uniqueIndex:failedchainheight"`
-	BlockchainID uint  `gorm:"uniqueIndex:failedchainheight"`
-	Chain        Chain `gorm:"foreignKey:BlockchainID"`
+	ID            uint
+	Height        int64      `gorm:"uniqueIndex:failedchainheight"`
+	BlockchainID  uint       `gorm:"uniqueIndex:failedchainheight"`
+	Chain         Chain      `gorm:"foreignKey:BlockchainID"`
+	CreatedAt     *time.Time // When the failure was first recorded, nil for failures recorded before this was tracked
+	Error         string     // Error of the latest failure, empty for failures recorded before this was tracked
+	Stage         string     // Stage of the latest failure, see db.IndexStage. Empty for failures recorded before this was tracked
+	FirstFailedAt *time.Time
+	LastFailedAt  *time.Time
+	AttemptCount  int64 `gorm:"not null;default:0"` // Number of times the block failed to index
+	// Quarantined failures have failed too many times to be reattempted and are skipped by the indexer until released
+	Quarantined bool `gorm:"not null;default:false"`
 }
 
 type FailedEventBlock struct {
-	ID           uint
-	Height       int64 `gorm:"uniqueIndex:failedchaineventheight"`
-	BlockchainID uint  `gorm:"uniqueIndex:failedchaineventheight"`
-	Chain        Chain `gorm:"foreignKey:BlockchainID"`
+	ID            uint
+	Height        int64      `gorm:"uniqueIndex:failedchaineventheight"`
+	BlockchainID  uint       `gorm:"uniqueIndex:failedchaineventheight"`
+	Chain         Chain      `gorm:"foreignKey:BlockchainID"`
+	CreatedAt     *time.Time // When the failure was first recorded, nil for failures recorded before this was tracked
+	Error         string     // Error of the latest failure, empty for failures recorded before this was tracked
+	Stage         string     // Stage of the latest failure, see db.IndexStage. Empty for failures recorded before this was tracked
+	FirstFailedAt *time.Time
+	LastFailedAt  *time.Time
+	AttemptCount  int64 `gorm:"not null;default:0"` // Number of times the block failed to index
+	// Quarantined failures have failed too many times to be reattempted and are skipped by the indexer until released
+	Quarantined bool `gorm:"not null;default:false"`
 }
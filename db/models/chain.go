@@ -1,7 +1,22 @@
 package models
 
+import "time"
+
 type Chain struct {
-	ID      uint   `gorm:"primaryKey"`
-	ChainID string `gorm:"uniqueIndex"` // e.g. osmosis-1
-	Name    string // e.g. Osmosis
+	ID           uint   `gorm:"primaryKey"`
+	ChainID      string `gorm:"uniqueIndex"` // e.g. osmosis-1
+	Name         string // e.g. Osmosis
+	Bech32Prefix string // Account address prefix, e.g. osmo
+	BaseDenom    string // Staking denomination, e.g. uosmo
+	Network      string // mainnet or testnet
+}
+
+// ChainCutover marks a chain of the database as handed over to a new primary database by the dual write cutover. The
+// indexer no longer writes the chain to a database holding one.
+type ChainCutover struct {
+	ID        uint
+	ChainID   uint `gorm:"uniqueIndex"`
+	Chain     Chain
+	Target    string // Description of the new primary database, e.g. host:port/database
+	CutOverAt time.Time
 }
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// IBCDenom is the denom trace of an ibc/ denom of a chain, resolved from the transfer module of the chain. The hash of an
+// ibc/ denom only means something on the chain it was seen on, so the rows are per chain. A row that could not be resolved
+// yet is kept with Resolved unset and is retried from NextAttemptAt.
+type IBCDenom struct {
+	ID      uint
+	ChainID uint `gorm:"uniqueIndex:idx_ibc_denom_chain_hash,priority:1"`
+	Chain   Chain
+	// Hash is the upper case hex hash of the denom, without the ibc/ prefix
+	Hash      string `gorm:"uniqueIndex:idx_ibc_denom_chain_hash,priority:2"`
+	Path      string // e.g. transfer/channel-0, empty until resolved
+	BaseDenom string // Denom on the chain the token came from, e.g. uatom, empty until resolved
+	Resolved  bool
+	// Attempts is the number of failed resolutions, LastError the error of the last one
+	Attempts      uint
+	LastError     string
+	NextAttemptAt *time.Time
+	UpdatedAt     time.Time
+}
+
+// Denom returns the full denom of the trace, e.g. transfer/channel-0/uatom
+func (d IBCDenom) Denom() string {
+	if d.Path == "" {
+		return d.BaseDenom
+	}
+	return d.Path + "/" + d.BaseDenom
+}
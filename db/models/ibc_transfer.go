@@ -0,0 +1,45 @@
+package models
+
+import "github.com/shopspring/decimal"
+
+const (
+	IBCTransferOutgoing = "outgoing" // Sent from the chain by a MsgTransfer
+	IBCTransferIncoming = "incoming" // Received by the chain in a MsgRecvPacket
+
+	IBCTransferPending   = "pending"   // Sent and not acknowledged or timed out yet
+	IBCTransferCompleted = "completed" // Acknowledged with a result, or received without an error
+	IBCTransferFailed    = "failed"    // Acknowledged with an error, the tokens of an outgoing transfer were refunded
+	IBCTransferTimedOut  = "timed_out" // Timed out before it was received, the tokens were refunded
+)
+
+// IBCTransfer is an ICS-20 packet sent or received by a chain. The packet is identified by its channel ends and sequence.
+// An outgoing transfer is stored as pending when it is sent and its status is updated when its acknowledgement or timeout
+// is relayed back to the chain, usually some blocks later. Blocks are indexed out of order, so the acknowledgement can be
+// stored first, Height stays 0 until the send is indexed. An incoming transfer is stored with its result when it is received.
+type IBCTransfer struct {
+	ID                 uint
+	ChainID            uint `gorm:"uniqueIndex:idx_ibc_transfer_packet,priority:1;index:idx_ibc_transfer_chain_status,priority:1"`
+	Chain              Chain
+	SourcePort         string `gorm:"uniqueIndex:idx_ibc_transfer_packet,priority:2"`
+	SourceChannel      string `gorm:"uniqueIndex:idx_ibc_transfer_packet,priority:3"`
+	DestinationPort    string `gorm:"uniqueIndex:idx_ibc_transfer_packet,priority:4"`
+	DestinationChannel string `gorm:"uniqueIndex:idx_ibc_transfer_packet,priority:5"`
+	Sequence           uint64 `gorm:"uniqueIndex:idx_ibc_transfer_packet,priority:6"`
+	Direction          string
+	Status             string `gorm:"index:idx_ibc_transfer_chain_status,priority:2"`
+	// Sender and Receiver are the addresses of the packet on their own chains, so only one of them is an address of the chain
+	Sender   string          `gorm:"index:idx_ibc_transfer_sender"`
+	Receiver string          `gorm:"index:idx_ibc_transfer_receiver"`
+	Amount   decimal.Decimal `gorm:"type:decimal(78,0);"`
+	// Denom is the denom of the packet: the denom trace on the source chain, e.g. uatom or transfer/channel-0/uatom
+	Denom            string
+	Memo             string
+	TimeoutHeight    string // revision-height, 0-0 when the packet has no timeout height
+	TimeoutTimestamp uint64 // Unix nanoseconds, 0 when the packet has no timeout timestamp
+	// Height is the height the packet was sent at for outgoing transfers, received at for incoming transfers
+	Height int64
+	// ResultHeight is the height of the acknowledgement or timeout of outgoing transfers, the receive height of incoming transfers
+	ResultHeight *int64
+	// Error is the error of a failed transfer, as written in its acknowledgement
+	Error string
+}
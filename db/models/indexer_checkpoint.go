@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// IndexerCheckpoint is the progress of a dataset of a chain: every height from StartHeight to LastContiguousHeight is
+// indexed for it. The indexer resumes from the checkpoint instead of scanning the blocks table. WorkerType is the dataset,
+// txs or block_events.
+type IndexerCheckpoint struct {
+	ID                   uint
+	ChainID              uint `gorm:"uniqueIndex:idx_indexer_checkpoint,priority:1"`
+	Chain                Chain
+	WorkerType           string `gorm:"uniqueIndex:idx_indexer_checkpoint,priority:2"`
+	StartHeight          int64
+	LastContiguousHeight int64
+	UpdatedAt            time.Time
+}
@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// QuarantinedAttribute is a sample of a block event attribute that could not be decoded. The raw key and value are kept
+// as returned by the RPC so support for the encoding can be added later.
+type QuarantinedAttribute struct {
+	ID                uint
+	ChainID           uint                   `gorm:"uniqueIndex:quarantinedAttributePosition,priority:1;index:quarantinedAttributeType,priority:1"`
+	Chain             Chain                  `gorm:"foreignKey:ChainID"`
+	EventType         string                 `gorm:"index:quarantinedAttributeType,priority:2"`
+	Height            int64                  `gorm:"uniqueIndex:quarantinedAttributePosition,priority:2"`
+	LifecyclePosition BlockLifecyclePosition `gorm:"uniqueIndex:quarantinedAttributePosition,priority:3"`
+	EventIndex        uint64                 `gorm:"uniqueIndex:quarantinedAttributePosition,priority:4"`
+	AttributeIndex    uint64                 `gorm:"uniqueIndex:quarantinedAttributePosition,priority:5"`
+	RawKey            []byte
+	RawValue          []byte
+	Reason            string
+	CreatedAt         time.Time
+}
+
+// AttributeQuarantineCount counts every unrecognized attribute seen per chain and event type, including the ones past
+// the sample cap and the ones seen again when a block is reindexed
+type AttributeQuarantineCount struct {
+	ID             uint
+	ChainID        uint   `gorm:"uniqueIndex:quarantineCountChainType,priority:1"`
+	Chain          Chain  `gorm:"foreignKey:ChainID"`
+	EventType      string `gorm:"uniqueIndex:quarantineCountChainType,priority:2"`
+	Count          int64
+	LastSeenHeight int64
+	UpdatedAt      time.Time
+}
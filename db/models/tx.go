@@ -1,6 +1,8 @@
 package models
 
 import (
+	"encoding/json"
+
 	"github.com/shopspring/decimal"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
@@ -14,13 +16,24 @@ type Tx struct {
 	Block           Block
 	SignerAddresses []Address `gorm:"many2many:tx_signer_addresses;"`
 	Fees            []Fee
+	// Gas wanted and used by the tx, 0 for txs indexed before they were stored
+	GasWanted int64 `gorm:"not null;default:0"`
+	GasUsed   int64 `gorm:"not null;default:0"`
+	// Memo of the tx body, with null bytes and invalid UTF-8 replaced so it can be stored as text
+	Memo string `gorm:"type:text;not null;default:''"`
+	// ErrorMessage is the raw log of a failed tx, truncated to flags.tx-error-max-length. Empty for successful txs.
+	ErrorMessage string `gorm:"type:text;not null;default:''"`
 }
 
+// FailedTx is a tx of an indexed block that could not be decoded, the rest of the block is indexed without it
 type FailedTx struct {
 	ID      uint
 	Hash    string `gorm:"uniqueIndex"`
 	BlockID uint
 	Block   Block
+	// Error is the decode error, TxBytes the raw tx to decode again after a codec fix
+	Error   string `gorm:"type:text;not null;default:''"`
+	TxBytes []byte
 }
 
 type Fee struct {
@@ -31,13 +44,16 @@ type Fee struct {
 	Denomination   Denom           `gorm:"foreignKey:DenominationID"`
 	PayerAddressID uint            `gorm:"index:idx_payer_addr"`
 	PayerAddress   Address         `gorm:"foreignKey:PayerAddressID"`
+	// GranterAddressID is the x/feegrant granter that paid the fee on behalf of the payer, nil when the fee was not granted
+	GranterAddressID *uint    `gorm:"index:idx_granter_addr"`
+	GranterAddress   *Address `gorm:"foreignKey:GranterAddressID"`
 }
 
 // This lifecycle function ensures the on conflict statement is added for Fees which are associated to Txes by the Gorm slice association method for has_many
 func (b *Fee) BeforeCreate(tx *gorm.DB) (err error) {
 	tx.Statement.AddClause(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "tx_id"}, {Name: "denomination_id"}},
-		DoUpdates: clause.AssignmentColumns([]string{"amount"}),
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "payer_address_id", "granter_address_id"}),
 	})
 	return nil
 }
@@ -55,13 +71,23 @@ type Message struct {
 	MessageType   MessageType
 	MessageIndex  int `gorm:"uniqueIndex:messageIndex,priority:2"`
 	MessageBytes  []byte
+	// Value is the proto JSON of the decoded message when flags.store-message-bodies is set, or an {"error": "..."} object
+	// if it could not be marshaled. NULL otherwise.
+	Value json.RawMessage `gorm:"type:jsonb"`
+	// Height of the block, the partition key of partitioned databases. 0 for rows indexed before it was stored.
+	Height int64 `gorm:"not null;default:0"`
 }
 
+// FailedMessage is a message of an indexed tx that could not be decoded, the tx is indexed without it
 type FailedMessage struct {
 	ID           uint
-	MessageIndex int
-	TxID         uint
+	MessageIndex int  `gorm:"uniqueIndex:failedMessageIndex,priority:2"`
+	TxID         uint `gorm:"uniqueIndex:failedMessageIndex,priority:1"`
 	Tx           Tx
+	// Error is the decode error, TypeURL and MessageBytes the raw message to decode again after a codec fix
+	Error        string `gorm:"type:text;not null;default:''"`
+	TypeURL      string `gorm:"not null;default:''"`
+	MessageBytes []byte
 }
 
 type MessageEvent struct {
@@ -73,6 +99,7 @@ type MessageEvent struct {
 	Message            Message
 	MessageEventTypeID uint
 	MessageEventType   MessageEventType
+	Height             int64 `gorm:"not null;default:0"` // Height of the block, see Message.Height
 }
 
 type MessageEventType struct {
@@ -85,11 +112,14 @@ type MessageEventAttribute struct {
 	MessageEvent   MessageEvent
 	MessageEventID uint `gorm:"uniqueIndex:messageAttributeIndex,priority:1"`
 	Value          string
+	ValueBytes     []byte // The original value when it was not valid text and flags.invalid-text-policy is bytea
+	Sanitized      bool   // Set when null bytes or invalid UTF-8 were removed from Value
 	Index          uint64 `gorm:"uniqueIndex:messageAttributeIndex,priority:2"`
 	// Keys are limited to a smallish subset of string values set by the Cosmos SDK and external modules
 	// Save DB space by storing the key as a foreign key
 	MessageEventAttributeKeyID uint
 	MessageEventAttributeKey   MessageEventAttributeKey
+	Height                     int64 `gorm:"not null;default:0"` // Height of the block, see Message.Height
 }
 
 type MessageEventAttributeKey struct {
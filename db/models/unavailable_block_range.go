@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UnavailableBlockRange is an inclusive range of heights of a chain the indexer skipped because its RPC node no longer has
+// them, like the heights below the earliest height of a pruned node. The heights are not reported as missing blocks.
+type UnavailableBlockRange struct {
+	ID          uint
+	ChainID     uint `gorm:"uniqueIndex:idx_unavailable_block_range,priority:1"`
+	Chain       Chain
+	StartHeight int64 `gorm:"uniqueIndex:idx_unavailable_block_range,priority:2"`
+	EndHeight   int64 `gorm:"uniqueIndex:idx_unavailable_block_range,priority:3"`
+	Reason      string
+	CreatedAt   time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+// Upgrade is a software upgrade plan that was scheduled on a chain, either directly by the upgrade authority or by a passed
+// governance proposal. Rows are rebuilt from the indexed plan and cancellation history whenever it changes.
+type Upgrade struct {
+	ID              uint
+	ChainID         uint `gorm:"index:idx_upgrade_chain_plan_height,priority:1"`
+	Chain           Chain
+	Name            string
+	PlanHeight      int64 `gorm:"index:idx_upgrade_chain_plan_height,priority:2"`
+	Info            string
+	ProposalID      *uint64
+	ScheduledHeight int64 // The height of the tx, or of the proposal end block for governance plans
+	// Cancelled is set for plans cancelled, or replaced by a later plan, before reaching their plan height
+	Cancelled       bool
+	CancelledHeight *int64
+	// AppliedHeight is only loaded by GetUpgradesByChain
+	AppliedHeight *int64 `gorm:"->;-:migration"`
+}
@@ -0,0 +1,25 @@
+package models
+
+// Validator is a validator of a chain, identified by its consensus address. Blocks are attributed to their proposer and
+// their commit signatures to validators through it.
+type Validator struct {
+	ID          uint
+	ChainID     uint   `gorm:"uniqueIndex:idx_validator_chain_cons_address,priority:1"`
+	Chain       Chain  `gorm:"foreignKey:ChainID"`
+	ConsAddress string `gorm:"uniqueIndex:idx_validator_chain_cons_address,priority:2"`
+	// OperatorAddress and Moniker are empty until set with UpsertValidator, blocks only carry the consensus address
+	OperatorAddress string `gorm:"index"`
+	Moniker         string
+}
+
+// BlockSignature records whether a validator signed the commit in the last commit of a block, i.e. the commit of the
+// previous height. Validators absent from the commit have no row, their signature carries no address.
+type BlockSignature struct {
+	ID          uint
+	BlockID     uint `gorm:"uniqueIndex:idx_block_signature_block_validator,priority:1"`
+	Block       Block
+	ValidatorID uint `gorm:"uniqueIndex:idx_block_signature_block_validator,priority:2;index"`
+	Validator   Validator
+	// Signed is false for a nil vote
+	Signed bool
+}
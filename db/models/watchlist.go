@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// WatchedAddress is an address on the watchlist. Watchlist membership is chain agnostic, any chain indexed into
+// this database will index activity for the address in full.
+type WatchedAddress struct {
+	ID        uint
+	AddressID uint `gorm:"uniqueIndex"`
+	Address   Address
+	Label     string
+	CreatedAt time.Time
+}
+
+// WatchedAddressActivity links a watched address to every tx it was involved in, as a signer or in any of the tx events
+type WatchedAddressActivity struct {
+	ID               uint
+	WatchedAddressID uint `gorm:"uniqueIndex:watchedAddressActivityIndex,priority:1"`
+	WatchedAddress   WatchedAddress
+	TxID             uint `gorm:"uniqueIndex:watchedAddressActivityIndex,priority:2"`
+	Tx               Tx
+}
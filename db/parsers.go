@@ -1,11 +1,13 @@
 package db
 
 import (
+	"context"
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
 	"gorm.io/gorm"
 )
 
-func FindOrCreateCustomBlockEventParsers(db *gorm.DB, parsers map[string]models.BlockEventParser) error {
+func FindOrCreateCustomBlockEventParsers(ctx context.Context, db *gorm.DB, parsers map[string]models.BlockEventParser) error {
+	db = db.WithContext(ctx)
 	err := db.Transaction(func(dbTransaction *gorm.DB) error {
 		for key := range parsers {
 			currParser := parsers[key]
@@ -21,7 +23,8 @@ func FindOrCreateCustomBlockEventParsers(db *gorm.DB, parsers map[string]models.
 	return err
 }
 
-func FindOrCreateCustomMessageParsers(db *gorm.DB, parsers map[string]models.MessageParser) error {
+func FindOrCreateCustomMessageParsers(ctx context.Context, db *gorm.DB, parsers map[string]models.MessageParser) error {
+	db = db.WithContext(ctx)
 	err := db.Transaction(func(dbTransaction *gorm.DB) error {
 		for key := range parsers {
 			currParser := parsers[key]
@@ -37,7 +40,8 @@ func FindOrCreateCustomMessageParsers(db *gorm.DB, parsers map[string]models.Mes
 	return err
 }
 
-func CreateBlockEventParserError(db *gorm.DB, blockEvent models.BlockEvent, parser models.BlockEventParser, parserError error) error {
+func CreateBlockEventParserError(ctx context.Context, db *gorm.DB, blockEvent models.BlockEvent, parser models.BlockEventParser, parserError error) error {
+	db = db.WithContext(ctx)
 	err := db.Transaction(func(dbTransaction *gorm.DB) error {
 		res := db.Create(&models.BlockEventParserError{
 			BlockEventParserID: parser.ID,
@@ -49,7 +53,8 @@ func CreateBlockEventParserError(db *gorm.DB, blockEvent models.BlockEvent, pars
 	return err
 }
 
-func DeleteCustomBlockEventParserError(db *gorm.DB, blockEvent models.BlockEvent, parser models.BlockEventParser) error {
+func DeleteCustomBlockEventParserError(ctx context.Context, db *gorm.DB, blockEvent models.BlockEvent, parser models.BlockEventParser) error {
+	db = db.WithContext(ctx)
 	err := db.Transaction(func(dbTransaction *gorm.DB) error {
 		parserError := models.BlockEventParserError{
 			BlockEventParserID: parser.ID,
@@ -61,7 +66,8 @@ func DeleteCustomBlockEventParserError(db *gorm.DB, blockEvent models.BlockEvent
 	return err
 }
 
-func CreateMessageParserError(db *gorm.DB, message models.Message, parser models.MessageParser, parserError error) error {
+func CreateMessageParserError(ctx context.Context, db *gorm.DB, message models.Message, parser models.MessageParser, parserError error) error {
+	db = db.WithContext(ctx)
 	err := db.Transaction(func(dbTransaction *gorm.DB) error {
 		res := db.Create(&models.MessageParserError{
 			Error:           parserError.Error(),
@@ -73,7 +79,8 @@ func CreateMessageParserError(db *gorm.DB, message models.Message, parser models
 	return err
 }
 
-func DeleteCustomMessageParserError(db *gorm.DB, message models.Message, parser models.MessageParser) error {
+func DeleteCustomMessageParserError(ctx context.Context, db *gorm.DB, message models.Message, parser models.MessageParser) error {
+	db = db.WithContext(ctx)
 	err := db.Transaction(func(dbTransaction *gorm.DB) error {
 		parserError := models.MessageParserError{
 			MessageParserID: parser.ID,
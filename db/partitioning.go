@@ -0,0 +1,151 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const partitioningPluginName = "cosmos-indexer:partitioning"
+
+// partitionedTables are range partitioned by height when database.partitioning is set, in order of creation
+var partitionedTables = []string{"messages", "message_events", "message_event_attributes"}
+
+// partitionedTableDDL creates the partitioned tables with the columns AutoMigrate creates for their models. The primary
+// and unique keys of a partitioned table must contain the partition key, so height is added to them.
+var partitionedTableDDL = []string{
+	`CREATE TABLE "messages" ("id" bigserial,"tx_id" bigint,"message_type_id" bigint,"message_index" bigint,"message_bytes" bytea,"value" jsonb,"height" bigint NOT NULL DEFAULT 0,PRIMARY KEY ("id","height")) PARTITION BY RANGE ("height")`,
+	`CREATE UNIQUE INDEX "messageIndex" ON "messages" ("tx_id","message_index","height")`,
+	`CREATE TABLE "message_events" ("id" bigserial,"index" bigint,"message_id" bigint,"message_event_type_id" bigint,"height" bigint NOT NULL DEFAULT 0,PRIMARY KEY ("id","height")) PARTITION BY RANGE ("height")`,
+	`CREATE UNIQUE INDEX "messageEventIndex" ON "message_events" ("message_id","index","height")`,
+	`CREATE TABLE "message_event_attributes" ("id" bigserial,"message_event_id" bigint,"value" text,"value_bytes" bytea,"sanitized" boolean,"index" bigint,"message_event_attribute_key_id" bigint,"height" bigint NOT NULL DEFAULT 0,PRIMARY KEY ("id","height")) PARTITION BY RANGE ("height")`,
+	`CREATE UNIQUE INDEX "messageAttributeIndex" ON "message_event_attributes" ("message_event_id","index","height")`,
+}
+
+// partitioning marks a connection to a database with the message tables range partitioned by height and tracks the
+// partitions known to exist.
+//
+// Foreign keys to a partitioned table must reference a unique key containing the partition key, so no table can reference
+// messages(id) alone. The plugin disables foreign key constraints when migrating for the whole connection, including the
+// parser and custom models that reference messages.
+type partitioning struct {
+	size  int64
+	ahead int64
+
+	mu      sync.Mutex
+	created map[int64]struct{} // Start heights of the partitions created or found on this connection
+}
+
+func newPartitioning(dbConfig config.Database) *partitioning {
+	return &partitioning{size: dbConfig.PartitionSize, ahead: dbConfig.PartitionsAhead, created: make(map[int64]struct{})}
+}
+
+func (*partitioning) Name() string {
+	return partitioningPluginName
+}
+
+func (*partitioning) Initialize(db *gorm.DB) error {
+	db.Config.DisableForeignKeyConstraintWhenMigrating = true
+	return nil
+}
+
+// partitioningOf returns the partitioning of the connection, nil when the message tables are not partitioned
+func partitioningOf(db *gorm.DB) *partitioning {
+	p, _ := db.Config.Plugins[partitioningPluginName].(*partitioning)
+	return p
+}
+
+// isPartitionedTable returns true if table is range partitioned on this connection
+func isPartitionedTable(db *gorm.DB, table string) bool {
+	return partitioningOf(db) != nil && slices.Contains(partitionedTables, table)
+}
+
+// partitionKeyColumns returns the conflict target of an upsert into a partitioned table, columns plus height when the
+// table is partitioned on this connection
+func partitionKeyColumns(db *gorm.DB, table string, columns ...string) []clause.Column {
+	if isPartitionedTable(db, table) {
+		columns = append(columns, "height")
+	}
+
+	conflictColumns := make([]clause.Column, len(columns))
+	for i, column := range columns {
+		conflictColumns[i] = clause.Column{Name: column}
+	}
+	return conflictColumns
+}
+
+// verifyPartitioning returns an error if the partitioning of the connection does not match the schema. Existing tables
+// cannot be converted to partitioned tables, partitioning only applies to new databases.
+func verifyPartitioning(db *gorm.DB) error {
+	p := partitioningOf(db)
+	if p == nil && dialectOf(db) != config.DialectPostgres {
+		return nil
+	}
+	if err := requirePostgres(db); err != nil {
+		return err
+	}
+
+	var partitioned *bool
+	err := db.Raw("SELECT relkind = 'p' FROM pg_class WHERE relname = ? AND pg_table_is_visible(oid)", partitionedTables[0]).Scan(&partitioned).Error
+	if err != nil || partitioned == nil {
+		return err
+	}
+
+	if p != nil && !*partitioned {
+		return fmt.Errorf("database.partitioning is set but %s is not partitioned, partitioning can only be enabled on a new database", partitionedTables[0])
+	}
+	if p == nil && *partitioned {
+		return fmt.Errorf("%s is partitioned, set database.partitioning to %s", partitionedTables[0], config.PartitioningHeight)
+	}
+	return nil
+}
+
+// createPartitionedTables creates the message tables as partitioned tables when the connection is partitioned and they
+// do not exist yet. AutoMigrate then finds them and adds nothing but the secondary indexes.
+func createPartitionedTables(db *gorm.DB) error {
+	if partitioningOf(db) == nil || db.Migrator().HasTable(partitionedTables[0]) {
+		return nil
+	}
+
+	config.Log.Infof("Creating %v partitioned by height", partitionedTables)
+	for _, statement := range partitionedTableDDL {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensurePartitions creates the partitions of the message tables for height and the configured number of partitions after
+// it, so they exist before the indexer reaches them. Partitions already created on this connection are skipped without
+// a query.
+func ensurePartitions(db *gorm.DB, height int64) error {
+	p := partitioningOf(db)
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := int64(0); i <= p.ahead; i++ {
+		start := (height/p.size + i) * p.size
+		if _, ok := p.created[start]; ok {
+			continue
+		}
+
+		for _, table := range partitionedTables {
+			err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s_p%d" PARTITION OF %q FOR VALUES FROM (%d) TO (%d)`, table, start, table, start, start+p.size)).Error
+			if err != nil {
+				return fmt.Errorf("creating partition of %s for heights %d to %d failed: %w", table, start, start+p.size, err)
+			}
+		}
+		p.created[start] = struct{}{}
+	}
+
+	return nil
+}
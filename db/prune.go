@@ -0,0 +1,113 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+const defaultPruneChunkSize = 100
+
+// ErrPruneThresholdUnset is returned by PruneBefore when the threshold has neither a height nor a time
+var ErrPruneThresholdUnset = errors.New("prune threshold needs a height or a time")
+
+// PruneThreshold selects the blocks pruned by PruneBefore: the blocks below Height that are older than Time. The zero
+// value of either is no bound, at least one must be set.
+type PruneThreshold struct {
+	Height int64
+	Time   time.Time
+}
+
+// where restricts the query on blocks to the blocks below the threshold. Blocks without a timestamp are never older than Time.
+func (t PruneThreshold) where(query *gorm.DB) *gorm.DB {
+	if t.Height > 0 {
+		query = query.Where("height < ?", t.Height)
+	}
+	if !t.Time.IsZero() {
+		query = query.Where("time_stamp > ? AND time_stamp < ?", time.Time{}, t.Time)
+	}
+	return query
+}
+
+// The tx data and block events of a pruned block, children first as the foreign keys require. The block row and its
+// signatures are kept.
+var pruneBlockSteps = func() []purgeStep {
+	var steps []purgeStep
+	for _, step := range purgeBlockSteps {
+		if step.table != "blocks" && step.table != "block_signatures" {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}()
+
+// PruneBefore deletes the txs, messages, events, attributes, fees and block events of the blocks of the chain below the
+// threshold, chunkSize blocks per database transaction, and marks the blocks as pruned and no longer indexed. The block
+// rows are kept, so gap detection and the default block enqueue do not pick the pruned heights up again. Blocks already
+// pruned are skipped, indexing a pruned block again clears the flag.
+// Returns the number of blocks pruned. Rows of custom parsers referencing the pruned rows make the prune fail on their
+// foreign keys.
+func PruneBefore(ctx context.Context, db *gorm.DB, chain ChainRef, threshold PruneThreshold, chunkSize int) (int64, error) {
+	db = db.WithContext(ctx)
+	if err := chain.Validate(); err != nil {
+		return 0, err
+	}
+	if threshold.Height <= 0 && threshold.Time.IsZero() {
+		return 0, ErrPruneThresholdUnset
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultPruneChunkSize
+	}
+
+	var pruned int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return pruned, err
+		}
+
+		var blockIDs []uint
+		query := threshold.where(db.Model(&models.Block{}).Where("chain_id = ? AND NOT pruned", chain.ID))
+		if err := query.Order("height").Limit(chunkSize).Pluck("id", &blockIDs).Error; err != nil {
+			return pruned, err
+		}
+		if len(blockIDs) == 0 {
+			return pruned, nil
+		}
+
+		err := db.Transaction(func(dbTransaction *gorm.DB) error {
+			for _, step := range pruneBlockSteps {
+				if err := dbTransaction.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", step.table, step.condition), sql.Named("blocks", blockIDs)).Error; err != nil {
+					config.Log.Errorf("Error pruning %s. Err: %v", step.table, err)
+					return err
+				}
+			}
+			return dbTransaction.Model(&models.Block{}).Where("id IN ?", blockIDs).
+				Updates(map[string]any{"pruned": true, "tx_indexed": false, "block_events_indexed": false, "tx_partially_indexed": false}).Error
+		})
+		if err != nil {
+			return pruned, err
+		}
+
+		pruned += int64(len(blockIDs))
+		config.Log.Debugf("Pruned %d blocks of chain %s", len(blockIDs), chain.ChainID)
+	}
+}
+
+// clearPruned clears the pruned flag of a block indexed again, its indexed flags tell what was indexed since
+func clearPruned(db *gorm.DB, block *models.Block) error {
+	if !block.Pruned {
+		return nil
+	}
+	block.Pruned = false
+	if err := db.Model(&models.Block{}).Where("id = ?", block.ID).Update("pruned", false).Error; err != nil {
+		config.Log.Error("Error updating block DB object.", err)
+		return err
+	}
+	return nil
+}
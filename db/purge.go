@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+const defaultPurgeChunkSize = 100
+
+// ErrPurgeNotConfirmed is returned by PurgeChainData when the confirmation does not match the chain ID of the purged chain
+var ErrPurgeNotConfirmed = errors.New("purge confirmation does not match the chain ID")
+
+// PurgeOptions configures PurgeChainData
+type PurgeOptions struct {
+	// ConfirmChainID must be the chain ID string of the purged chain, e.g. osmosis-1, or nothing is deleted
+	ConfirmChainID string
+	// DryRun only counts the rows that would be deleted
+	DryRun bool
+	// KeepDictionaries keeps the message types, event types, attribute keys, addresses and denominations no longer
+	// referenced by any other chain
+	KeepDictionaries bool
+	// ChunkSize is the number of blocks, or rows of the tables not linked to a block, deleted per database transaction.
+	// Defaults to 100.
+	ChunkSize int
+}
+
+// PurgeTableCount is the number of rows of a table deleted, or counted on a dry run, by PurgeChainData
+type PurgeTableCount struct {
+	Table string
+	Rows  int64
+}
+
+// PurgeReport reports the rows of every table purged for a chain, in the order they are deleted
+type PurgeReport struct {
+	ChainID string
+	DryRun  bool
+	Tables  []PurgeTableCount
+}
+
+// Rows returns the rows deleted from the table
+func (r PurgeReport) Rows(table string) int64 {
+	for _, count := range r.Tables {
+		if count.Table == table {
+			return count.Rows
+		}
+	}
+	return 0
+}
+
+func (r *PurgeReport) add(table string, rows int64) {
+	for i := range r.Tables {
+		if r.Tables[i].Table == table {
+			r.Tables[i].Rows += rows
+			return
+		}
+	}
+	r.Tables = append(r.Tables, PurgeTableCount{Table: table, Rows: rows})
+}
+
+// purgeStep deletes the rows of a table matching condition. The conditions of the block steps select the blocks purged
+// with @blocks, the conditions of the chain and dictionary steps the chain with @chain.
+type purgeStep struct {
+	table     string
+	condition string
+}
+
+// The rows hanging off the blocks of a chain, children first as the foreign keys require
+var purgeBlockSteps = []purgeStep{
+	{"message_parser_errors", "message_id IN (SELECT messages.id FROM messages JOIN txes ON txes.id = messages.tx_id WHERE txes.block_id IN @blocks)"},
+	{"message_event_attributes", "message_event_id IN (SELECT message_events.id FROM message_events JOIN messages ON messages.id = message_events.message_id JOIN txes ON txes.id = messages.tx_id WHERE txes.block_id IN @blocks)"},
+	{"message_events", "message_id IN (SELECT messages.id FROM messages JOIN txes ON txes.id = messages.tx_id WHERE txes.block_id IN @blocks)"},
+	{"messages", "tx_id IN (SELECT id FROM txes WHERE block_id IN @blocks)"},
+	{"failed_messages", "tx_id IN (SELECT id FROM txes WHERE block_id IN @blocks)"},
+	{"fees", "tx_id IN (SELECT id FROM txes WHERE block_id IN @blocks)"},
+	{"tx_signer_addresses", "tx_id IN (SELECT id FROM txes WHERE block_id IN @blocks)"},
+	{"watched_address_activities", "tx_id IN (SELECT id FROM txes WHERE block_id IN @blocks)"},
+	{"txes", "block_id IN @blocks"},
+	{"failed_txes", "block_id IN @blocks"},
+	{"block_event_parser_errors", "block_event_id IN (SELECT id FROM block_events WHERE block_id IN @blocks)"},
+	{"block_event_attributes", "block_event_id IN (SELECT id FROM block_events WHERE block_id IN @blocks)"},
+	{"block_events", "block_id IN @blocks"},
+	{"block_signatures", "block_id IN @blocks"},
+	{"blocks", "id IN @blocks"},
+}
+
+// The rows of a chain not linked to a block, deleted once its blocks are gone. The chain row goes last.
+var purgeChainSteps = []purgeStep{
+	{"failed_blocks", "blockchain_id = @chain"},
+	{"failed_event_blocks", "blockchain_id = @chain"},
+	{"quarantined_attributes", "chain_id = @chain"},
+	{"attribute_quarantine_counts", "chain_id = @chain"},
+	{"upgrades", "chain_id = @chain"},
+	{"ibc_denoms", "chain_id = @chain"},
+	{"ibc_transfers", "chain_id = @chain"},
+	{"unavailable_block_ranges", "chain_id = @chain"},
+	{"indexer_checkpoints", "chain_id = @chain"},
+	{"chain_cutovers", "chain_id = @chain"},
+	{"validators", "chain_id = @chain"},
+	{"chains", "id = @chain"},
+}
+
+// The dictionary rows not referenced by the blocks of any other chain. They match the same rows before and after the
+// blocks of the chain are deleted, so a dry run counts what a purge deletes.
+var purgeDictionarySteps = []purgeStep{
+	{"message_types", "NOT EXISTS (SELECT 1 FROM messages JOIN txes ON txes.id = messages.tx_id JOIN blocks ON blocks.id = txes.block_id WHERE messages.message_type_id = message_types.id AND blocks.chain_id <> @chain)"},
+	{"message_event_types", "NOT EXISTS (SELECT 1 FROM message_events JOIN messages ON messages.id = message_events.message_id JOIN txes ON txes.id = messages.tx_id JOIN blocks ON blocks.id = txes.block_id WHERE message_events.message_event_type_id = message_event_types.id AND blocks.chain_id <> @chain)"},
+	{"message_event_attribute_keys", "NOT EXISTS (SELECT 1 FROM message_event_attributes JOIN message_events ON message_events.id = message_event_attributes.message_event_id JOIN messages ON messages.id = message_events.message_id JOIN txes ON txes.id = messages.tx_id JOIN blocks ON blocks.id = txes.block_id WHERE message_event_attributes.message_event_attribute_key_id = message_event_attribute_keys.id AND blocks.chain_id <> @chain)"},
+	{"block_event_types", "NOT EXISTS (SELECT 1 FROM block_events JOIN blocks ON blocks.id = block_events.block_id WHERE block_events.block_event_type_id = block_event_types.id AND blocks.chain_id <> @chain)"},
+	{"block_event_attribute_keys", "NOT EXISTS (SELECT 1 FROM block_event_attributes JOIN block_events ON block_events.id = block_event_attributes.block_event_id JOIN blocks ON blocks.id = block_events.block_id WHERE block_event_attributes.block_event_attribute_key_id = block_event_attribute_keys.id AND blocks.chain_id <> @chain)"},
+	{"denoms", "NOT EXISTS (SELECT 1 FROM fees JOIN txes ON txes.id = fees.tx_id JOIN blocks ON blocks.id = txes.block_id WHERE fees.denomination_id = denoms.id AND blocks.chain_id <> @chain)"},
+	{"addresses", "NOT EXISTS (SELECT 1 FROM blocks WHERE blocks.proposer_cons_address_id = addresses.id AND blocks.chain_id <> @chain)" +
+		" AND NOT EXISTS (SELECT 1 FROM fees JOIN txes ON txes.id = fees.tx_id JOIN blocks ON blocks.id = txes.block_id WHERE (fees.payer_address_id = addresses.id OR fees.granter_address_id = addresses.id) AND blocks.chain_id <> @chain)" +
+		" AND NOT EXISTS (SELECT 1 FROM tx_signer_addresses JOIN txes ON txes.id = tx_signer_addresses.tx_id JOIN blocks ON blocks.id = txes.block_id WHERE tx_signer_addresses.address_id = addresses.id AND blocks.chain_id <> @chain)" +
+		" AND NOT EXISTS (SELECT 1 FROM watched_addresses WHERE watched_addresses.address_id = addresses.id)"},
+}
+
+// PurgeChainData deletes everything indexed for the chain: its blocks with their txs, messages, events and attributes,
+// its failed and quarantined blocks, validators and upgrades, and the chain row. Unless opts.KeepDictionaries is set,
+// the dictionary rows no other chain references are deleted too. The blocks are deleted in chunks of opts.ChunkSize,
+// one database transaction each, so no table is locked for the whole purge. A purge interrupted part way can be run
+// again to finish it.
+//
+// Nothing is deleted unless opts.ConfirmChainID matches the chain ID of the chain, ErrPurgeNotConfirmed is returned
+// instead. With opts.DryRun the rows are only counted. Rows of custom parsers referencing the purged rows make the
+// purge fail on their foreign keys, delete them first.
+func PurgeChainData(ctx context.Context, db *gorm.DB, chainID uint, opts PurgeOptions) (PurgeReport, error) {
+	db = db.WithContext(ctx)
+
+	var chain models.Chain
+	if err := db.Where("id = ?", chainID).First(&chain).Error; err != nil {
+		return PurgeReport{}, err
+	}
+
+	report := PurgeReport{ChainID: chain.ChainID, DryRun: opts.DryRun}
+	if opts.ConfirmChainID != chain.ChainID {
+		return report, fmt.Errorf("%w: purging %s, confirmed %q", ErrPurgeNotConfirmed, chain.ChainID, opts.ConfirmChainID)
+	}
+
+	chunkSize := opts.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultPurgeChunkSize
+	}
+
+	dictionarySteps := purgeDictionarySteps
+	if opts.KeepDictionaries {
+		dictionarySteps = nil
+	}
+
+	if opts.DryRun {
+		blocks := db.Model(&models.Block{}).Select("id").Where("chain_id = ?", chainID)
+		for _, step := range purgeBlockSteps {
+			if err := countPurgeStep(db, &report, step, sql.Named("blocks", gorm.Expr("(?)", blocks))); err != nil {
+				return report, err
+			}
+		}
+		for _, steps := range [][]purgeStep{dictionarySteps, purgeChainSteps} {
+			for _, step := range steps {
+				if err := countPurgeStep(db, &report, step, sql.Named("chain", chainID)); err != nil {
+					return report, err
+				}
+			}
+		}
+		return report, nil
+	}
+
+	if err := purgeBlocks(ctx, db, &report, chainID, chunkSize); err != nil {
+		return report, err
+	}
+
+	// The dictionaries go before the chain row, their conditions only exclude the rows of other chains
+	for _, step := range dictionarySteps {
+		if err := purgeChunked(ctx, db, &report, step, chainID, chunkSize); err != nil {
+			return report, err
+		}
+	}
+	if len(dictionarySteps) != 0 {
+		dictionaryCacheOf(db).reset()
+	}
+
+	for _, step := range purgeChainSteps {
+		if err := purgeChunked(ctx, db, &report, step, chainID, chunkSize); err != nil {
+			return report, err
+		}
+	}
+
+	if len(purgeChainSteps) != 0 {
+		InvalidateChainCache(db)
+	}
+
+	config.Log.Infof("Purged chain %s", chain.ChainID)
+	return report, nil
+}
+
+// purgeBlocks deletes the blocks of the chain and the rows hanging off them, chunkSize blocks per transaction
+func purgeBlocks(ctx context.Context, db *gorm.DB, report *PurgeReport, chainID uint, chunkSize int) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var blockIDs []uint
+		if err := db.Model(&models.Block{}).Where("chain_id = ?", chainID).Order("id").Limit(chunkSize).Pluck("id", &blockIDs).Error; err != nil {
+			return err
+		}
+		if len(blockIDs) == 0 {
+			return nil
+		}
+
+		chunk := PurgeReport{}
+		err := db.Transaction(func(dbTransaction *gorm.DB) error {
+			for _, step := range purgeBlockSteps {
+				result := dbTransaction.Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", step.table, step.condition), sql.Named("blocks", blockIDs))
+				if result.Error != nil {
+					config.Log.Errorf("Error purging %s. Err: %v", step.table, result.Error)
+					return result.Error
+				}
+				chunk.add(step.table, result.RowsAffected)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, count := range chunk.Tables {
+			report.add(count.Table, count.Rows)
+		}
+		config.Log.Debugf("Purged %d blocks of chain %d", len(blockIDs), chainID)
+	}
+}
+
+// purgeChunked deletes the rows of the step, chunkSize rows per statement
+func purgeChunked(ctx context.Context, db *gorm.DB, report *PurgeReport, step purgeStep, chainID uint, chunkSize int) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		statement := fmt.Sprintf("DELETE FROM %[1]s WHERE id IN (SELECT id FROM %[1]s WHERE %[2]s LIMIT %[3]d)", step.table, step.condition, chunkSize)
+		result := db.Exec(statement, sql.Named("chain", chainID))
+		if result.Error != nil {
+			config.Log.Errorf("Error purging %s. Err: %v", step.table, result.Error)
+			return result.Error
+		}
+
+		report.add(step.table, result.RowsAffected)
+		if result.RowsAffected < int64(chunkSize) {
+			return nil
+		}
+	}
+}
+
+func countPurgeStep(db *gorm.DB, report *PurgeReport, step purgeStep, arg sql.NamedArg) error {
+	var rows int64
+	if err := db.Table(step.table).Where(step.condition, arg).Count(&rows).Error; err != nil {
+		return err
+	}
+	report.add(step.table, rows)
+	return nil
+}
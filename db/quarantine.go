@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"sort"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// IndexQuarantinedAttributes counts the quarantined attributes of the block per event type and stores samples of them,
+// keeping at most sampleCap samples per chain and event type. A sample cap of 0 only counts.
+func IndexQuarantinedAttributes(ctx context.Context, db *gorm.DB, blockDBWrapper *BlockDBWrapper, sampleCap int64) error {
+	db = db.WithContext(ctx)
+	if len(blockDBWrapper.QuarantinedAttributes) == 0 {
+		return nil
+	}
+
+	byEventType := make(map[string][]models.QuarantinedAttribute)
+	for _, attribute := range blockDBWrapper.QuarantinedAttributes {
+		attribute.ChainID = blockDBWrapper.Block.ChainID
+		byEventType[attribute.EventType] = append(byEventType[attribute.EventType], attribute)
+	}
+
+	// Sorted so concurrent blocks lock the count rows in the same order
+	eventTypes := make([]string, 0, len(byEventType))
+	for eventType := range byEventType {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	return db.Transaction(func(dbTransaction *gorm.DB) error {
+		for _, eventType := range eventTypes {
+			attributes := byEventType[eventType]
+
+			count := models.AttributeQuarantineCount{
+				ChainID:        blockDBWrapper.Block.ChainID,
+				EventType:      eventType,
+				Count:          int64(len(attributes)),
+				LastSeenHeight: blockDBWrapper.Block.Height,
+			}
+
+			err := dbTransaction.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "chain_id"}, {Name: "event_type"}},
+				DoUpdates: clause.Assignments(map[string]any{
+					"count":            gorm.Expr("attribute_quarantine_counts.count + ?", count.Count),
+					"last_seen_height": gorm.Expr("CASE WHEN attribute_quarantine_counts.last_seen_height > ? THEN attribute_quarantine_counts.last_seen_height ELSE ? END", count.LastSeenHeight, count.LastSeenHeight),
+					"updated_at":       gorm.Expr("CURRENT_TIMESTAMP"),
+				}),
+			}).Create(&count).Error
+			if err != nil {
+				return err
+			}
+
+			// The count row is locked by the upsert, so the sample count cannot change until the transaction ends
+			var samples int64
+			err = dbTransaction.Model(&models.QuarantinedAttribute{}).
+				Where("chain_id = ? AND event_type = ?", blockDBWrapper.Block.ChainID, eventType).
+				Count(&samples).Error
+			if err != nil {
+				return err
+			}
+
+			remaining := sampleCap - samples
+			if remaining <= 0 {
+				continue
+			}
+
+			if int64(len(attributes)) > remaining {
+				attributes = attributes[:remaining]
+			}
+
+			// Samples already stored for the same position, from a reindex of the block, are kept as they are
+			err = dbTransaction.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&attributes, insertBatchSize(dbTransaction)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// QuarantineCount is the number of unrecognized attributes seen for an event type
+type QuarantineCount struct {
+	EventType      string
+	Count          int64
+	Samples        int64
+	LastSeenHeight int64
+}
+
+// GetQuarantineCounts returns the unrecognized attribute counts of the chain per event type, highest count first
+func GetQuarantineCounts(ctx context.Context, db *gorm.DB, chain ChainRef) ([]QuarantineCount, error) {
+	db = readDB(ctx, db)
+	var counts []QuarantineCount
+	err := db.Raw(`SELECT counts.event_type, counts.count, counts.last_seen_height,
+			(SELECT COUNT(*) FROM quarantined_attributes samples WHERE samples.chain_id = counts.chain_id AND samples.event_type = counts.event_type) AS samples
+		FROM attribute_quarantine_counts counts
+		WHERE counts.chain_id = ?
+		ORDER BY counts.count DESC, counts.event_type`, chain.ID).Scan(&counts).Error
+	return counts, err
+}
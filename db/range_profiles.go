@@ -0,0 +1,105 @@
+package db
+
+import (
+	"context"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"gorm.io/gorm"
+)
+
+// RangeProfileMismatch is a run of blocks that were indexed with a different range profile than the one now configured
+// for their heights
+type RangeProfileMismatch struct {
+	Profile     string // The configured profile
+	IndexedWith string
+	StartHeight int64
+	EndHeight   int64
+	Blocks      int64
+}
+
+// rangeProfileScope is the condition on blocks.height selecting the heights of a configured profile
+type rangeProfileScope struct {
+	profile   string
+	condition string
+	args      []any
+}
+
+func rangeProfileScopes(profiles config.RangeProfiles) []rangeProfileScope {
+	var scopes []rangeProfileScope
+	var conditions []string
+	var args []any
+
+	for _, profile := range profiles.Ranges {
+		scope := rangeProfileScope{profile: profile.Name, condition: "height >= ?", args: []any{profile.StartHeight}}
+		if profile.EndHeight != -1 {
+			scope.condition += " AND height <= ?"
+			scope.args = append(scope.args, profile.EndHeight)
+		}
+		scopes = append(scopes, scope)
+		conditions = append(conditions, "("+scope.condition+")")
+		args = append(args, scope.args...)
+	}
+
+	if profiles.Default != nil {
+		scope := rangeProfileScope{profile: profiles.Default.Name, condition: "TRUE"}
+		if len(conditions) != 0 {
+			scope.condition = "NOT (" + strings.Join(conditions, " OR ") + ")"
+			scope.args = args
+		}
+		scopes = append(scopes, scope)
+	}
+
+	return scopes
+}
+
+// GetRangeProfileMismatches finds blocks labeled with a different range profile than the one configured for their height.
+// Blocks indexed before range profiles were configured have no label and are left out, as are heights outside every
+// range when there is no default profile.
+func GetRangeProfileMismatches(ctx context.Context, db *gorm.DB, chainID uint, profiles config.RangeProfiles) ([]RangeProfileMismatch, error) {
+	db = db.WithContext(ctx)
+	var mismatches []RangeProfileMismatch
+
+	for _, scope := range rangeProfileScopes(profiles) {
+		var scopeMismatches []RangeProfileMismatch
+		err := db.Table("blocks").
+			Select("index_profile AS indexed_with, MIN(height) AS start_height, MAX(height) AS end_height, COUNT(*) AS blocks").
+			Where("chain_id = ? AND index_profile != '' AND index_profile != ?", chainID, scope.profile).
+			Where(scope.condition, scope.args...).
+			Group("index_profile").
+			Order("start_height").
+			Scan(&scopeMismatches).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, mismatch := range scopeMismatches {
+			mismatch.Profile = scope.profile
+			mismatches = append(mismatches, mismatch)
+		}
+	}
+
+	return mismatches, nil
+}
+
+// ResetRangeProfileMismatches marks the blocks found by GetRangeProfileMismatches as not indexed, so the default enqueue
+// reindexes them with their configured profile. Rows stored by the old profile are kept.
+func ResetRangeProfileMismatches(ctx context.Context, db *gorm.DB, chainID uint, profiles config.RangeProfiles) (int64, error) {
+	db = db.WithContext(ctx)
+	var reset int64
+
+	err := db.Transaction(func(dbTransaction *gorm.DB) error {
+		for _, scope := range rangeProfileScopes(profiles) {
+			result := dbTransaction.Table("blocks").
+				Where("chain_id = ? AND index_profile != '' AND index_profile != ?", chainID, scope.profile).
+				Where(scope.condition, scope.args...).
+				Updates(map[string]any{"tx_indexed": false, "block_events_indexed": false})
+			if result.Error != nil {
+				return result.Error
+			}
+			reset += result.RowsAffected
+		}
+		return nil
+	})
+
+	return reset, err
+}
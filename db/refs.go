@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+// OpenEnd is the HeightRange End value for a range with no upper bound
+const OpenEnd int64 = -1
+
+var (
+	// ErrHeightRangeStart is wrapped by HeightRangeError when the range starts below height 1
+	ErrHeightRangeStart = errors.New("height range must start at height 1 or above")
+	// ErrHeightRangeOrder is wrapped by HeightRangeError when the range ends before it starts
+	ErrHeightRangeOrder = errors.New("height range end is lower than start")
+	// ErrUnresolvedChainRef is returned when a ChainRef has no database ID
+	ErrUnresolvedChainRef = errors.New("chain reference has not been resolved to a database chain")
+)
+
+// HeightRangeError is returned for an invalid HeightRange, it wraps ErrHeightRangeStart or ErrHeightRangeOrder
+type HeightRangeError struct {
+	Range HeightRange
+	Err   error
+}
+
+func (e *HeightRangeError) Error() string {
+	return fmt.Sprintf("invalid height range %s: %v", e.Range, e.Err)
+}
+
+func (e *HeightRangeError) Unwrap() error {
+	return e.Err
+}
+
+// HeightRange is an inclusive range of block heights. An End of OpenEnd means the range has no upper bound.
+type HeightRange struct {
+	Start int64
+	End   int64
+}
+
+// NewHeightRange builds a validated HeightRange
+func NewHeightRange(start int64, end int64) (HeightRange, error) {
+	heights := HeightRange{Start: start, End: end}
+	return heights, heights.Validate()
+}
+
+// HeightsFrom returns the range of all heights from start onwards
+func HeightsFrom(start int64) HeightRange {
+	return HeightRange{Start: start, End: OpenEnd}
+}
+
+// Validate returns a HeightRangeError if the range starts below 1 or ends before it starts
+func (r HeightRange) Validate() error {
+	if r.Start < 1 {
+		return &HeightRangeError{Range: r, Err: ErrHeightRangeStart}
+	}
+
+	if !r.IsOpen() && r.End < r.Start {
+		return &HeightRangeError{Range: r, Err: ErrHeightRangeOrder}
+	}
+
+	return nil
+}
+
+// IsOpen returns true if the range has no upper bound
+func (r HeightRange) IsOpen() bool {
+	return r.End == OpenEnd
+}
+
+// Contains returns true if the height is within the range
+func (r HeightRange) Contains(height int64) bool {
+	return height >= r.Start && (r.IsOpen() || height <= r.End)
+}
+
+// Intersect returns the heights in both ranges, ok is false if they do not overlap
+func (r HeightRange) Intersect(other HeightRange) (intersection HeightRange, ok bool) {
+	intersection = HeightRange{Start: r.Start, End: r.End}
+	if other.Start > intersection.Start {
+		intersection.Start = other.Start
+	}
+
+	if intersection.IsOpen() || (!other.IsOpen() && other.End < intersection.End) {
+		intersection.End = other.End
+	}
+
+	return intersection, intersection.IsOpen() || intersection.End >= intersection.Start
+}
+
+func (r HeightRange) String() string {
+	if r.IsOpen() {
+		return fmt.Sprintf("[%d, open)", r.Start)
+	}
+	return fmt.Sprintf("[%d, %d]", r.Start, r.End)
+}
+
+// where restricts the query to heights in the range on the given column
+func (r HeightRange) where(query *gorm.DB, column string) *gorm.DB {
+	query = query.Where(column+" >= ?", r.Start)
+
+	if !r.IsOpen() {
+		query = query.Where(column+" <= ?", r.End)
+	}
+
+	return query
+}
+
+// ChainRef identifies an indexed chain by both its database ID and its chain ID string
+type ChainRef struct {
+	ID      uint
+	ChainID string
+}
+
+// NewChainRef builds a ChainRef from a chain loaded from the database
+func NewChainRef(chain models.Chain) ChainRef {
+	return ChainRef{ID: chain.ID, ChainID: chain.ChainID}
+}
+
+// GetChainRef looks up the chain by its chain ID string. The returned ChainRef fails validation if the chain has not been indexed.
+func GetChainRef(ctx context.Context, db *gorm.DB, chainID string) (ChainRef, error) {
+	db = db.WithContext(ctx)
+	chain, err := GetChainByChainID(ctx, db, chainID)
+	if err != nil {
+		return ChainRef{ChainID: chainID}, err
+	}
+
+	return ChainRef{ID: chain.ID, ChainID: chainID}, nil
+}
+
+// Validate returns ErrUnresolvedChainRef if the reference has no database ID
+func (c ChainRef) Validate() error {
+	if c.ID == 0 {
+		return fmt.Errorf("%w: %q", ErrUnresolvedChainRef, c.ChainID)
+	}
+	return nil
+}
+
+func validateChainAndHeights(chain ChainRef, heights HeightRange) error {
+	if err := chain.Validate(); err != nil {
+		return err
+	}
+	return heights.Validate()
+}
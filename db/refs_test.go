@@ -0,0 +1,69 @@
+package db
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RefsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *RefsTestSuite) TestNewHeightRange() {
+	heights, err := NewHeightRange(1, 10)
+	suite.Require().NoError(err)
+	suite.Assert().False(heights.IsOpen())
+	suite.Assert().True(heights.Contains(10))
+	suite.Assert().False(heights.Contains(11))
+
+	heights, err = NewHeightRange(5, OpenEnd)
+	suite.Require().NoError(err)
+	suite.Assert().True(heights.IsOpen())
+	suite.Assert().False(heights.Contains(4))
+	suite.Assert().True(heights.Contains(1_000_000))
+	suite.Assert().Equal(HeightsFrom(5), heights)
+}
+
+func (suite *RefsTestSuite) TestHeightRangeValidation() {
+	_, err := NewHeightRange(10, 1)
+	suite.Assert().ErrorIs(err, ErrHeightRangeOrder)
+
+	var rangeErr *HeightRangeError
+	suite.Require().True(errors.As(err, &rangeErr))
+	suite.Assert().Equal(HeightRange{Start: 10, End: 1}, rangeErr.Range)
+
+	_, err = NewHeightRange(0, 10)
+	suite.Assert().ErrorIs(err, ErrHeightRangeStart)
+
+	// Only -1 marks an open range, other negative ends are rejected
+	_, err = NewHeightRange(1, -2)
+	suite.Assert().ErrorIs(err, ErrHeightRangeOrder)
+}
+
+func (suite *RefsTestSuite) TestHeightRangeIntersect() {
+	intersection, ok := HeightRange{Start: 1, End: 10}.Intersect(HeightRange{Start: 5, End: 20})
+	suite.Assert().True(ok)
+	suite.Assert().Equal(HeightRange{Start: 5, End: 10}, intersection)
+
+	intersection, ok = HeightsFrom(5).Intersect(HeightRange{Start: 1, End: 8})
+	suite.Assert().True(ok)
+	suite.Assert().Equal(HeightRange{Start: 5, End: 8}, intersection)
+
+	intersection, ok = HeightsFrom(5).Intersect(HeightsFrom(3))
+	suite.Assert().True(ok)
+	suite.Assert().Equal(HeightsFrom(5), intersection)
+
+	_, ok = HeightRange{Start: 1, End: 4}.Intersect(HeightsFrom(5))
+	suite.Assert().False(ok)
+}
+
+func (suite *RefsTestSuite) TestChainRefValidation() {
+	suite.Assert().ErrorIs(ChainRef{ChainID: "testchain-1"}.Validate(), ErrUnresolvedChainRef)
+	suite.Assert().NoError(ChainRef{ID: 1, ChainID: "testchain-1"}.Validate())
+}
+
+func TestRefsSuite(t *testing.T) {
+	suite.Run(t, new(RefsTestSuite))
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"slices"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+// The messages, events, attributes and fees of the txs of a block, children first as the foreign keys require. The tx rows
+// are kept.
+var blockTxDataDeletes = []string{
+	"DELETE FROM message_parser_errors WHERE message_id IN (SELECT messages.id FROM messages JOIN txes ON txes.id = messages.tx_id WHERE txes.block_id = ?)",
+	"DELETE FROM message_event_attributes WHERE message_event_id IN (SELECT message_events.id FROM message_events JOIN messages ON messages.id = message_events.message_id JOIN txes ON txes.id = messages.tx_id WHERE txes.block_id = ?)",
+	"DELETE FROM message_events WHERE message_id IN (SELECT messages.id FROM messages JOIN txes ON txes.id = messages.tx_id WHERE txes.block_id = ?)",
+	"DELETE FROM messages WHERE tx_id IN (SELECT id FROM txes WHERE block_id = ?)",
+	"DELETE FROM failed_messages WHERE tx_id IN (SELECT id FROM txes WHERE block_id = ?)",
+	"DELETE FROM fees WHERE tx_id IN (SELECT id FROM txes WHERE block_id = ?)",
+}
+
+// The txs and messages of a block that could not be decoded
+var blockTxFailureDeletes = []string{
+	"DELETE FROM failed_messages WHERE tx_id IN (SELECT id FROM txes WHERE block_id = ?)",
+	"DELETE FROM failed_txes WHERE block_id = ?",
+}
+
+// Every row indexed for a block, children first as the foreign keys require
+var blockDataDeletes = append(slices.Clone(blockTxDataDeletes),
+	"DELETE FROM tx_signer_addresses WHERE tx_id IN (SELECT id FROM txes WHERE block_id = ?)",
+	"DELETE FROM watched_address_activities WHERE tx_id IN (SELECT id FROM txes WHERE block_id = ?)",
+	"DELETE FROM txes WHERE block_id = ?",
+	"DELETE FROM failed_txes WHERE block_id = ?",
+	"DELETE FROM block_event_parser_errors WHERE block_event_id IN (SELECT id FROM block_events WHERE block_id = ?)",
+	"DELETE FROM block_event_attributes WHERE block_event_id IN (SELECT id FROM block_events WHERE block_id = ?)",
+	"DELETE FROM block_events WHERE block_id = ?",
+	"DELETE FROM block_signatures WHERE block_id = ?",
+)
+
+// isReorg reports whether the incoming block replaces the stored block at the same height, i.e. both have a hash and
+// they differ. Blocks indexed before hashes were stored never count as reorged.
+func isReorg(existing models.Block, incoming models.Block) bool {
+	return existing.ID != 0 && existing.BlockHash != "" && incoming.BlockHash != "" && existing.BlockHash != incoming.BlockHash
+}
+
+// replaceReorgedBlock deletes the txs, messages, block events and everything hanging off them indexed for the stored block,
+// so the incoming block can be indexed cleanly in the same transaction. The block row itself is kept and updated by the
+// caller, with both indexed flags cleared as neither dataset matches the new block yet.
+// Rows of custom parsers referencing the deleted messages or block events fail the delete on their foreign keys.
+func replaceReorgedBlock(db *gorm.DB, existing models.Block, incoming models.Block) error {
+	config.Log.Warnf("Reorg detected at height %d: stored block hash %s, incoming block hash %s. Replacing the indexed block data.",
+		incoming.Height, existing.BlockHash, incoming.BlockHash)
+
+	for _, statement := range blockDataDeletes {
+		if err := db.Exec(statement, existing.ID).Error; err != nil {
+			config.Log.Error("Error deleting reorged block data.", err)
+			return err
+		}
+	}
+
+	return db.Model(&models.Block{}).
+		Where("id = ?", existing.ID).
+		Updates(map[string]interface{}{"tx_indexed": false, "block_events_indexed": false, "tx_count": 0}).Error
+}
+
+// replaceBlockTxData deletes the messages, events, attributes and fees indexed for the txs of the stored block, so they
+// are inserted fresh in the same transaction instead of upserted over the previous parse, which leaves behind the rows
+// the new parse no longer has. See base.reindex-replace.
+// Rows of custom parsers referencing the deleted messages fail the delete on their foreign keys.
+func replaceBlockTxData(db *gorm.DB, existing models.Block) error {
+	for _, statement := range blockTxDataDeletes {
+		if err := db.Exec(statement, existing.ID).Error; err != nil {
+			config.Log.Error("Error deleting reindexed block data.", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// clearBlockTxFailures deletes the failed txs and messages recorded for the stored block, so a block reindexed after a
+// partial index only keeps the failures of the new parse
+func clearBlockTxFailures(db *gorm.DB, existing models.Block) error {
+	for _, statement := range blockTxFailureDeletes {
+		if err := db.Exec(statement, existing.ID).Error; err != nil {
+			config.Log.Error("Error deleting block tx failures.", err)
+			return err
+		}
+	}
+	return nil
+}
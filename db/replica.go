@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+const readReplicaPluginName = "cosmos-indexer:read-replica"
+
+// ReadReplica is a gorm plugin that routes the read only query helpers of the db package (stats, reports, block pages,
+// upgrade and watched address activity lookups) to a replica of the database. Writes, transactions and the reads the
+// indexer relies on to decide what to index, like the missing block scans of the block enqueue, stay on the database it
+// is registered on, see ReadFromPrimary.
+type ReadReplica struct {
+	DB *gorm.DB
+}
+
+// UseReadReplica registers replica as the read replica of db
+func UseReadReplica(db *gorm.DB, replica *gorm.DB) error {
+	return db.Use(&ReadReplica{DB: replica})
+}
+
+func (r *ReadReplica) Name() string {
+	return readReplicaPluginName
+}
+
+func (r *ReadReplica) Initialize(*gorm.DB) error {
+	return nil
+}
+
+type readFromPrimaryKey struct{}
+
+// ReadFromPrimary returns a context whose reads stay on the primary database when a read replica is registered. It is
+// used for the reads that decide what to index, like the block pages of the block enqueue.
+func ReadFromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readFromPrimaryKey{}, true)
+}
+
+// readDB returns the read replica registered on db with the context applied, or db itself when there is no replica.
+// Reads in a transaction or with a ReadFromPrimary context stay on db.
+func readDB(ctx context.Context, db *gorm.DB) *gorm.DB {
+	db = db.WithContext(ctx)
+
+	plugin, ok := db.Config.Plugins[readReplicaPluginName]
+	if !ok {
+		return db
+	}
+
+	if primary, _ := ctx.Value(readFromPrimaryKey{}).(bool); primary {
+		return db
+	}
+
+	if _, inTransaction := db.Statement.ConnPool.(gorm.TxCommitter); inTransaction {
+		return db
+	}
+
+	return plugin.(*ReadReplica).DB.WithContext(ctx)
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type ReplicaTestSuite struct {
+	suite.Suite
+}
+
+// fakeTx makes a session look like it is in a transaction
+type fakeTx struct {
+	gorm.ConnPool
+}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// openLazy opens a handle without connecting, nothing is queried
+func (suite *ReplicaTestSuite) openLazy(host string) *gorm.DB {
+	db, err := gorm.Open(postgres.Open("host="+host+" port=1 user=test password=test dbname=test sslmode=disable"), &gorm.Config{DisableAutomaticPing: true})
+	suite.Require().NoError(err)
+	return db
+}
+
+func (suite *ReplicaTestSuite) TestReadDB() {
+	primary := suite.openLazy("primary")
+	replica := suite.openLazy("replica")
+	ctx := context.WithValue(context.Background(), struct{}{}, "request")
+
+	// Without a replica reads stay on the primary
+	read := readDB(ctx, primary)
+	suite.Assert().Same(primary.ConnPool, read.Statement.ConnPool)
+	suite.Assert().Equal(ctx, read.Statement.Context)
+
+	suite.Require().NoError(UseReadReplica(primary, replica))
+
+	read = readDB(ctx, primary)
+	suite.Assert().Same(replica.ConnPool, read.Statement.ConnPool)
+	suite.Assert().Equal(ctx, read.Statement.Context)
+
+	// Sessions of the primary share its replica
+	read = readDB(ctx, primary.Session(&gorm.Session{}))
+	suite.Assert().Same(replica.ConnPool, read.Statement.ConnPool)
+
+	// Reads that decide what to index stay on the primary
+	read = readDB(ReadFromPrimary(ctx), primary)
+	suite.Assert().Same(primary.ConnPool, read.Statement.ConnPool)
+
+	// Reads in a transaction see its writes, they stay in it
+	tx := primary.Session(&gorm.Session{})
+	tx.Statement.ConnPool = fakeTx{tx.Statement.ConnPool}
+	read = readDB(ctx, tx)
+	suite.Assert().Equal(tx.Statement.ConnPool, read.Statement.ConnPool)
+
+	// A second replica is rejected
+	suite.Assert().Error(UseReadReplica(primary, suite.openLazy("other-replica")))
+}
+
+func TestReplicaSuite(t *testing.T) {
+	suite.Run(t, new(ReplicaTestSuite))
+}
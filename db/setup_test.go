@@ -0,0 +1,10 @@
+package db_test
+
+import (
+	"github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/dbtest"
+)
+
+func init() {
+	db.SetupTestDatabase = dbtest.Setup
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"gorm.io/gorm"
+)
+
+// DefaultSnapshotTimeout bounds how long WithSnapshot holds its snapshot open. An open snapshot keeps vacuum from removing
+// rows deleted or updated after it was taken.
+const DefaultSnapshotTimeout = 5 * time.Minute
+
+// WithSnapshot runs fn in a read only REPEATABLE READ transaction, so every query fn makes sees the database as of the
+// same point in time. Blocks committed by the indexer while fn runs are not visible to it. The transaction is cancelled
+// after DefaultSnapshotTimeout. When db is already in a transaction fn runs in a savepoint of it and reads its snapshot,
+// otherwise the snapshot is taken on the read replica of db when one is registered.
+func WithSnapshot(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return WithSnapshotTimeout(ctx, db, DefaultSnapshotTimeout, fn)
+}
+
+// WithSnapshotTimeout is WithSnapshot with a custom timeout
+func WithSnapshotTimeout(ctx context.Context, db *gorm.DB, timeout time.Duration, fn func(tx *gorm.DB) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	db = readDB(ctx, db)
+
+	// SQLite serializes transactions, a plain transaction already reads a single snapshot
+	if db.Dialector.Name() != "postgres" {
+		return db.Transaction(fn)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// The server side limit also ends the snapshot if this client stops responding mid transaction. It is a PostgreSQL
+		// setting, on CockroachDB only the context timeout ends the snapshot.
+		if dialectOf(tx) != config.DialectPostgres {
+			return fn(tx)
+		}
+
+		if err := tx.Exec(fmt.Sprintf("SET LOCAL idle_in_transaction_session_timeout = %d", timeout.Milliseconds())).Error; err != nil {
+			return err
+		}
+
+		return fn(tx)
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// GetSnapshotHeight returns the highest block height of the chain visible to db, 0 if the chain has no blocks. Read inside
+// WithSnapshot it is the high watermark of the snapshot.
+func GetSnapshotHeight(ctx context.Context, db *gorm.DB, chain ChainRef) (int64, error) {
+	db = readDB(ctx, db)
+	var height sql.NullInt64
+	err := db.Table("blocks").Select("MAX(height)").Where("chain_id = ?", chain.ID).Scan(&height).Error
+	return height.Int64, err
+}
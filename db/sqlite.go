@@ -0,0 +1,29 @@
+//go:build cgo
+
+package db
+
+import (
+	"strings"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// SqliteDbConnect opens the SQLite database file at path, or an in-memory database when path is ":memory:". SQLite is
+// meant for local development and tests, helpers that rely on PostgreSQL features return ErrUnsupportedDialect on it.
+// The connection pool is limited to one connection, SQLite serializes writes and every connection to ":memory:" would
+// open a separate database.
+func SqliteDbConnect(path string, level string) (*gorm.DB, error) {
+	db, err := openWithOptions(sqlite.Open(path), strings.ToLower(level), ConnectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+
+	return db, nil
+}
@@ -0,0 +1,14 @@
+//go:build !cgo
+
+package db
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// SqliteDbConnect is not available without cgo, the SQLite driver is a cgo package
+func SqliteDbConnect(path string, level string) (*gorm.DB, error) {
+	return nil, errors.New("SQLite support requires building with cgo")
+}
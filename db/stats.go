@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"gorm.io/gorm"
+)
+
+// TypeStats holds how often a lookup table type occurs on a chain and the range of heights it was seen in
+type TypeStats struct {
+	Type            string
+	Count           int64
+	FirstSeenHeight int64
+	LastSeenHeight  int64
+}
+
+// GetMessageTypeStatsInRange returns each message type indexed for the chain within the height range
+// with its message count and first/last seen heights, ordered by count descending.
+func GetMessageTypeStatsInRange(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]TypeStats, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	return getMessageTypeStats(db, chain.ID, heights)
+}
+
+// GetMessageTypeStats returns the message type stats for the chain between startHeight and endHeight (-1 for no upper bound)
+//
+// Deprecated: use GetMessageTypeStatsInRange, which validates the chain and height range.
+func GetMessageTypeStats(ctx context.Context, db *gorm.DB, chainID uint, startHeight int64, endHeight int64) ([]TypeStats, error) {
+	db = readDB(ctx, db)
+	return getMessageTypeStats(db, chainID, HeightRange{Start: startHeight, End: endHeight})
+}
+
+func getMessageTypeStats(db *gorm.DB, chainID uint, heights HeightRange) ([]TypeStats, error) {
+	query := db.Table("messages").
+		Select("message_types.message_type AS type, COUNT(*) AS count, MIN(blocks.height) AS first_seen_height, MAX(blocks.height) AS last_seen_height").
+		Joins("JOIN message_types ON message_types.id = messages.message_type_id").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Group("message_types.message_type")
+
+	return getTypeStats(query, chainID, heights)
+}
+
+// GetMessageEventTypeStatsInRange returns each message event type indexed for the chain within the height range
+// with its event count and first/last seen heights, ordered by count descending.
+func GetMessageEventTypeStatsInRange(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]TypeStats, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	return getMessageEventTypeStats(db, chain.ID, heights)
+}
+
+// GetMessageEventTypeStats returns the message event type stats for the chain between startHeight and endHeight (-1 for no upper bound)
+//
+// Deprecated: use GetMessageEventTypeStatsInRange, which validates the chain and height range.
+func GetMessageEventTypeStats(ctx context.Context, db *gorm.DB, chainID uint, startHeight int64, endHeight int64) ([]TypeStats, error) {
+	db = readDB(ctx, db)
+	return getMessageEventTypeStats(db, chainID, HeightRange{Start: startHeight, End: endHeight})
+}
+
+func getMessageEventTypeStats(db *gorm.DB, chainID uint, heights HeightRange) ([]TypeStats, error) {
+	query := db.Table("message_events").
+		Select("message_event_types.type AS type, COUNT(*) AS count, MIN(blocks.height) AS first_seen_height, MAX(blocks.height) AS last_seen_height").
+		Joins("JOIN message_event_types ON message_event_types.id = message_events.message_event_type_id").
+		Joins("JOIN messages ON messages.id = message_events.message_id").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Group("message_event_types.type")
+
+	return getTypeStats(query, chainID, heights)
+}
+
+// GetBlockEventTypeStatsInRange returns each block event type indexed for the chain within the height range
+// with its event count and first/last seen heights, ordered by count descending.
+func GetBlockEventTypeStatsInRange(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]TypeStats, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	return getBlockEventTypeStats(db, chain.ID, heights)
+}
+
+// GetBlockEventTypeStats returns the block event type stats for the chain between startHeight and endHeight (-1 for no upper bound)
+//
+// Deprecated: use GetBlockEventTypeStatsInRange, which validates the chain and height range.
+func GetBlockEventTypeStats(ctx context.Context, db *gorm.DB, chainID uint, startHeight int64, endHeight int64) ([]TypeStats, error) {
+	db = readDB(ctx, db)
+	return getBlockEventTypeStats(db, chainID, HeightRange{Start: startHeight, End: endHeight})
+}
+
+func getBlockEventTypeStats(db *gorm.DB, chainID uint, heights HeightRange) ([]TypeStats, error) {
+	query := db.Table("block_events").
+		Select("block_event_types.type AS type, COUNT(*) AS count, MIN(blocks.height) AS first_seen_height, MAX(blocks.height) AS last_seen_height").
+		Joins("JOIN block_event_types ON block_event_types.id = block_events.block_event_type_id").
+		Joins("JOIN blocks ON blocks.id = block_events.block_id").
+		Group("block_event_types.type")
+
+	return getTypeStats(query, chainID, heights)
+}
+
+func getTypeStats(query *gorm.DB, chainID uint, heights HeightRange) ([]TypeStats, error) {
+	var stats []TypeStats
+
+	query = heights.where(query.Where("blocks.chain_id = ?", chainID), "blocks.height")
+
+	if err := query.Order("count DESC, type").Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// CountIndexedBlocks returns the number of blocks indexed for the chain within the height range. Block rows without a
+// timestamp, written by block event indexing before the block was fetched, are not counted.
+func CountIndexedBlocks(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) (int64, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	query := db.Table("blocks").Where("chain_id = ? AND time_stamp != ?", chain.ID, time.Time{})
+	err := heights.where(query, "height").Count(&count).Error
+	return count, err
+}
+
+// CountTxs returns the number of txs indexed for the chain within the height range
+func CountTxs(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) (int64, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return 0, err
+	}
+
+	var count int64
+	query := db.Table("txes").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND blocks.time_stamp != ?", chain.ID, time.Time{})
+	err := heights.where(query, "blocks.height").Count(&count).Error
+	return count, err
+}
+
+// CountMessagesByType returns the number of messages indexed for the chain within the height range by message type.
+// Types without messages in the range are not included.
+func CountMessagesByType(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) (map[string]int64, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	var counts []struct {
+		Type  string
+		Count int64
+	}
+	query := db.Table("messages").
+		Select("message_types.message_type AS type, COUNT(*) AS count").
+		Joins("JOIN message_types ON message_types.id = messages.message_type_id").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND blocks.time_stamp != ?", chain.ID, time.Time{}).
+		Group("message_types.message_type")
+	if err := heights.where(query, "blocks.height").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+
+	countsByType := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		countsByType[count.Type] = count.Count
+	}
+	return countsByType, nil
+}
+
+// MessageTypeGas is the gas used by the txs containing a message type
+type MessageTypeGas struct {
+	MessageType    string
+	TxCount        int64
+	AverageGasUsed float64
+}
+
+// GetAverageGasUsedByMessageType returns the average gas used by the txs of the chain within the height range containing
+// each message type, ordered by message type. A tx containing several message types counts towards each of them once.
+// Txs indexed before gas was stored have no gas used and are left out.
+func GetAverageGasUsedByMessageType(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]MessageTypeGas, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	txTypes := db.Table("messages").
+		Distinct("messages.tx_id, messages.message_type_id, txes.gas_used").
+		Joins("JOIN txes ON txes.id = messages.tx_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ? AND txes.gas_used > 0", chain.ID)
+	txTypes = heights.where(txTypes, "blocks.height")
+
+	var stats []MessageTypeGas
+	err := db.Table("(?) AS tx_types", txTypes).
+		Select("message_types.message_type AS message_type, COUNT(*) AS tx_count, AVG(tx_types.gas_used) AS average_gas_used").
+		Joins("JOIN message_types ON message_types.id = tx_types.message_type_id").
+		Group("message_types.message_type").
+		Order("message_types.message_type").
+		Scan(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// DailyTxThroughput is the number of blocks and txs indexed for a UTC day
+type DailyTxThroughput struct {
+	Day        time.Time
+	BlockCount int64
+	TxCount    int64
+}
+
+// GetTxThroughput returns the blocks and txs indexed for the chain per UTC day for the blocks with a timestamp in
+// [from, to), ordered by day. Days without indexed blocks are not included. Built on the tx count stored on every block,
+// blocks whose txs were not indexed yet are left out.
+func GetTxThroughput(ctx context.Context, db *gorm.DB, chain ChainRef, from time.Time, to time.Time) ([]DailyTxThroughput, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+	if !from.Before(to) {
+		return nil, errors.New("throughput range end must be after its start")
+	}
+
+	// The day as YYYY-MM-DD text, SQLite stores timestamps as text
+	day := "DATE(time_stamp)"
+	if dialect := dialectOf(db); dialect == config.DialectPostgres || dialect == config.DialectCockroachDB {
+		day = "CAST(CAST(time_stamp AT TIME ZONE 'UTC' AS DATE) AS TEXT)"
+	}
+
+	var rows []struct {
+		Day        string
+		BlockCount int64
+		TxCount    int64
+	}
+	err := db.Table("blocks").
+		Select(day+" AS day, COUNT(*) AS block_count, SUM(tx_count) AS tx_count").
+		Where("chain_id = ? AND tx_indexed = ? AND time_stamp >= ? AND time_stamp < ?", chain.ID, true, from, to).
+		Group(day).
+		Order("day").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	throughput := make([]DailyTxThroughput, len(rows))
+	for i, row := range rows {
+		parsed, err := time.Parse(time.DateOnly, row.Day)
+		if err != nil {
+			return nil, fmt.Errorf("parsing throughput day %q: %w", row.Day, err)
+		}
+		throughput[i] = DailyTxThroughput{Day: parsed, BlockCount: row.BlockCount, TxCount: row.TxCount}
+	}
+	return throughput, nil
+}
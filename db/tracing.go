@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+
+	"github.com/DefiantLabs/cosmos-indexer/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const (
+	tracingPluginName = "cosmos-indexer:tracing"
+	createSpanKey     = "cosmos-indexer:create-span"
+)
+
+// indexTracing starts a span for every create, like the bulk inserts and dictionary upserts of a block, and for the
+// transactions indexing blocks on the connection it is registered on. The spans are children of the span of the context of
+// the session.
+type indexTracing struct {
+	tracer trace.Tracer
+}
+
+// UseTracing records spans of the writes of the blocks indexed on db with the tracer provider
+func UseTracing(db *gorm.DB, provider trace.TracerProvider) error {
+	return db.Use(&indexTracing{tracer: provider.Tracer(tracing.InstrumentationName)})
+}
+
+func (p *indexTracing) Name() string {
+	return tracingPluginName
+}
+
+// Initialize registers the span around all the create callbacks, the associations saved by a create are children of its span
+func (p *indexTracing) Initialize(db *gorm.DB) error {
+	err := db.Callback().Create().Before("*").Register(tracingPluginName+":before_create", p.beforeCreate)
+	if err != nil {
+		return err
+	}
+	return db.Callback().Create().After("*").Register(tracingPluginName+":after_create", p.afterCreate)
+}
+
+func (p *indexTracing) beforeCreate(db *gorm.DB) {
+	var span trace.Span
+	db.Statement.Context, span = p.tracer.Start(db.Statement.Context, "db.create "+db.Statement.Table, trace.WithAttributes(tracing.Table.String(db.Statement.Table)))
+	db.InstanceSet(createSpanKey, span)
+}
+
+func (p *indexTracing) afterCreate(db *gorm.DB) {
+	value, ok := db.InstanceGet(createSpanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	span.SetAttributes(tracing.RowCount.Int64(db.Statement.RowsAffected))
+	tracing.End(span, db.Error)
+}
+
+// startSpan starts a span of the tracer registered on db, a span that is not recorded when there is none
+func startSpan(ctx context.Context, db *gorm.DB, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	p, ok := db.Config.Plugins[tracingPluginName].(*indexTracing)
+	if !ok {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return p.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
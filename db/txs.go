@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+// Pagination pages through the results of a query helper. A Limit of 0 returns every result, an Offset requires a Limit.
+type Pagination struct {
+	Limit  int
+	Offset int
+}
+
+func (p Pagination) validate() error {
+	if p.Limit < 0 || p.Offset < 0 {
+		return errors.New("limit and offset must not be negative")
+	}
+	if p.Offset > 0 && p.Limit == 0 {
+		return errors.New("offset requires a limit")
+	}
+	return nil
+}
+
+// apply adds the page to the query, which must be ordered
+func (p Pagination) apply(query *gorm.DB) *gorm.DB {
+	if p.Limit > 0 {
+		query = query.Limit(p.Limit).Offset(p.Offset)
+	}
+	return query
+}
+
+// TxQueryOptions narrows and shapes the txs returned by GetTxsByAddress
+type TxQueryOptions struct {
+	// Heights limits the txs to a height range, the zero value returns txs at every height
+	Heights HeightRange
+	// Pages through the txs in height order
+	Pagination
+	// PreloadMessages loads the messages of every tx with their message type
+	PreloadMessages bool
+	// PreloadFees loads the fees of every tx with their denomination, payer and granter
+	PreloadFees bool
+}
+
+// AddressTx is a tx returned by GetTxsByAddress
+type AddressTx struct {
+	models.Tx
+	Messages []models.Message // In message index order, loaded when TxQueryOptions.PreloadMessages is set
+}
+
+// GetTxsByAddress returns the txs of the chain signed by the address or with a fee paid by it, ordered by height, with
+// their block and signers loaded. An address that was never indexed has no txs. When the chain row has a bech32 prefix,
+// the address is normalized with NormalizeAddress first and an *InvalidAddressError is returned for an invalid one.
+func GetTxsByAddress(ctx context.Context, db *gorm.DB, chain ChainRef, address string, opts TxQueryOptions) ([]AddressTx, error) {
+	return getTxsByAddress(readDB(ctx, db), chain, address, opts, false)
+}
+
+// GetFailedTxsByAddress returns the failed txs of the chain signed by the address or with a fee paid by it, like
+// GetTxsByAddress. The reason each tx failed is in its ErrorMessage, empty for txs indexed before it was stored.
+func GetFailedTxsByAddress(ctx context.Context, db *gorm.DB, chain ChainRef, address string, opts TxQueryOptions) ([]AddressTx, error) {
+	return getTxsByAddress(readDB(ctx, db), chain, address, opts, true)
+}
+
+func getTxsByAddress(db *gorm.DB, chain ChainRef, address string, opts TxQueryOptions, failedOnly bool) ([]AddressTx, error) {
+	heights := opts.Heights
+	if heights == (HeightRange{}) {
+		heights = HeightsFrom(1)
+	}
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+	if err := opts.Pagination.validate(); err != nil {
+		return nil, err
+	}
+
+	address, err := normalizeChainAddress(db, chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var addressIDs []uint
+	if err := db.Model(&models.Address{}).Where("address = ?", address).Limit(1).Pluck("id", &addressIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(addressIDs) == 0 {
+		return nil, nil
+	}
+
+	query := db.
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("blocks.chain_id = ?", chain.ID).
+		Where("(txes.id IN (SELECT tx_id FROM tx_signer_addresses WHERE address_id = ?) OR txes.id IN (SELECT tx_id FROM fees WHERE payer_address_id = ?))", addressIDs[0], addressIDs[0])
+	if failedOnly {
+		query = query.Where("txes.code != 0")
+	}
+
+	query = heights.where(query, "blocks.height").
+		Preload("Block").
+		Preload("SignerAddresses").
+		Order("blocks.height, txes.id")
+
+	if opts.PreloadFees {
+		query = query.Preload("Fees.Denomination").Preload("Fees.PayerAddress").Preload("Fees.GranterAddress")
+	}
+	query = opts.Pagination.apply(query)
+
+	var txs []models.Tx
+	if err := query.Find(&txs).Error; err != nil {
+		return nil, err
+	}
+
+	addressTxs := make([]AddressTx, len(txs))
+	for i, tx := range txs {
+		addressTxs[i].Tx = tx
+	}
+
+	if opts.PreloadMessages && len(txs) != 0 {
+		if err := loadTxMessages(db, addressTxs); err != nil {
+			return nil, err
+		}
+	}
+
+	return addressTxs, nil
+}
+
+// loadTxMessages loads the messages of the txs with their message type in one query
+func loadTxMessages(db *gorm.DB, txs []AddressTx) error {
+	txIndexes := make(map[uint]int, len(txs))
+	txIDs := make([]uint, len(txs))
+	for i, tx := range txs {
+		txIndexes[tx.ID] = i
+		txIDs[i] = tx.ID
+	}
+
+	var messages []models.Message
+	if err := db.Preload("MessageType").Where("tx_id IN ?", txIDs).Order("tx_id, message_index").Find(&messages).Error; err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		i := txIndexes[message.TxID]
+		txs[i].Messages = append(txs[i].Messages, message)
+	}
+	return nil
+}
+
+// GetTxByHash returns the tx of the chain with the hash and everything indexed for it: its block, signers, fees with their
+// denomination, payer and granter, and its messages with their type, events and event attributes, in index order. The hash is
+// matched case-insensitively. Returns gorm.ErrRecordNotFound if the chain has no tx with the hash.
+func GetTxByHash(ctx context.Context, db *gorm.DB, chain ChainRef, hash string) (TxDBWrapper, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return TxDBWrapper{}, err
+	}
+
+	// Hashes are indexed as upper case hex
+	hash = strings.ToUpper(strings.TrimSpace(hash))
+
+	var tx models.Tx
+	err := db.
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("txes.hash = ? AND blocks.chain_id = ?", hash, chain.ID).
+		Preload("Block").
+		Preload("SignerAddresses").
+		Preload("Fees.Denomination").
+		Preload("Fees.PayerAddress").
+		Preload("Fees.GranterAddress").
+		First(&tx).Error
+	if err != nil {
+		return TxDBWrapper{}, err
+	}
+
+	txGraph := TxDBWrapper{Tx: tx}
+
+	var messages []models.Message
+	if err := db.Preload("MessageType").Where("tx_id = ?", tx.ID).Order("message_index").Find(&messages).Error; err != nil {
+		return TxDBWrapper{}, err
+	}
+	if len(messages) == 0 {
+		return txGraph, nil
+	}
+
+	messageIDs := make([]uint, len(messages))
+	messageIndexes := make(map[uint]int, len(messages))
+	txGraph.Messages = make([]MessageDBWrapper, len(messages))
+	for i, message := range messages {
+		messageIDs[i] = message.ID
+		messageIndexes[message.ID] = i
+		txGraph.Messages[i].Message = message
+	}
+
+	var events []models.MessageEvent
+	if err := db.Preload("MessageEventType").Where("message_id IN ?", messageIDs).Order(`message_id, "index"`).Find(&events).Error; err != nil {
+		return TxDBWrapper{}, err
+	}
+	if len(events) == 0 {
+		return txGraph, nil
+	}
+
+	eventIDs := make([]uint, len(events))
+	for i, event := range events {
+		eventIDs[i] = event.ID
+	}
+
+	var attributes []models.MessageEventAttribute
+	if err := db.Preload("MessageEventAttributeKey").Where("message_event_id IN ?", eventIDs).Order(`message_event_id, "index"`).Find(&attributes).Error; err != nil {
+		return TxDBWrapper{}, err
+	}
+
+	eventAttributes := make(map[uint][]models.MessageEventAttribute, len(events))
+	for _, attribute := range attributes {
+		eventAttributes[attribute.MessageEventID] = append(eventAttributes[attribute.MessageEventID], attribute)
+	}
+
+	for _, event := range events {
+		message := &txGraph.Messages[messageIndexes[event.MessageID]]
+		message.MessageEvents = append(message.MessageEvents, MessageEventDBWrapper{MessageEvent: event, Attributes: eventAttributes[event.ID]})
+	}
+
+	return txGraph, nil
+}
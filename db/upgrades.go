@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+)
+
+// UpgradeEra is the range of heights a chain ran between two upgrades. The era before the first upgrade has an empty Name.
+type UpgradeEra struct {
+	Name    string
+	Heights HeightRange
+}
+
+// GetUpgradesByChain returns the upgrades scheduled on the chain ordered by plan height. AppliedHeight is set for upgrades
+// that were not cancelled once a block at or above the plan height is indexed, as the plan height is the first block
+// run by the upgraded software.
+func GetUpgradesByChain(ctx context.Context, db *gorm.DB, chain ChainRef) ([]models.Upgrade, error) {
+	db = readDB(ctx, db)
+	if err := chain.Validate(); err != nil {
+		return nil, err
+	}
+
+	var upgrades []models.Upgrade
+
+	err := db.Model(&models.Upgrade{}).
+		Select("upgrades.*, CASE WHEN NOT upgrades.cancelled AND EXISTS (SELECT 1 FROM blocks WHERE blocks.chain_id = upgrades.chain_id AND blocks.height >= upgrades.plan_height) THEN upgrades.plan_height END AS applied_height").
+		Where("upgrades.chain_id = ?", chain.ID).
+		Order("upgrades.plan_height, upgrades.scheduled_height").
+		Find(&upgrades).Error
+
+	return upgrades, err
+}
+
+// GetUpgradeEras splits the chain's heights into eras at the plan height of every upgrade that was not cancelled.
+// The last era has an open end.
+func GetUpgradeEras(ctx context.Context, db *gorm.DB, chain ChainRef) ([]UpgradeEra, error) {
+	db = db.WithContext(ctx)
+	upgrades, err := GetUpgradesByChain(ctx, db, chain)
+	if err != nil {
+		return nil, err
+	}
+
+	return UpgradeEras(upgrades), nil
+}
+
+// UpgradeEras splits heights into eras at the plan height of every upgrade that was not cancelled, upgrades must be ordered by plan height
+func UpgradeEras(upgrades []models.Upgrade) []UpgradeEra {
+	eras := []UpgradeEra{{Heights: HeightsFrom(1)}}
+
+	for _, upgrade := range upgrades {
+		if upgrade.Cancelled || upgrade.PlanHeight < 1 {
+			continue
+		}
+
+		current := &eras[len(eras)-1]
+		if upgrade.PlanHeight == current.Heights.Start {
+			current.Name = upgrade.Name
+			continue
+		}
+
+		current.Heights.End = upgrade.PlanHeight - 1
+		eras = append(eras, UpgradeEra{Name: upgrade.Name, Heights: HeightsFrom(upgrade.PlanHeight)})
+	}
+
+	return eras
+}
+
+// UpgradeEraAt returns the era the height belongs to
+func UpgradeEraAt(eras []UpgradeEra, height int64) (UpgradeEra, bool) {
+	for _, era := range eras {
+		if era.Heights.Contains(height) {
+			return era, true
+		}
+	}
+
+	return UpgradeEra{}, false
+}
+
+// UpgradeEraColumn returns a SQL expression for the name of the upgrade era a height belongs to, for labelling rows in block
+// and stats queries:
+//
+//	db.Table("blocks").Select("blocks.*, " + UpgradeEraColumn("blocks.chain_id", "blocks.height") + " AS upgrade_era")
+func UpgradeEraColumn(chainColumn string, heightColumn string) string {
+	return fmt.Sprintf("COALESCE((SELECT upgrades.name FROM upgrades WHERE upgrades.chain_id = %s AND NOT upgrades.cancelled AND upgrades.plan_height <= %s ORDER BY upgrades.plan_height DESC LIMIT 1), '')", chainColumn, heightColumn)
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/stretchr/testify/suite"
+)
+
+type UpgradesTestSuite struct {
+	suite.Suite
+}
+
+func (suite *UpgradesTestSuite) TestUpgradeEras() {
+	eras := UpgradeEras([]models.Upgrade{
+		{Name: "v2", PlanHeight: 100},
+		{Name: "v3-abandoned", PlanHeight: 150, Cancelled: true},
+		{Name: "v3", PlanHeight: 200},
+	})
+
+	suite.Assert().Equal([]UpgradeEra{
+		{Name: "", Heights: HeightRange{Start: 1, End: 99}},
+		{Name: "v2", Heights: HeightRange{Start: 100, End: 199}},
+		{Name: "v3", Heights: HeightsFrom(200)},
+	}, eras)
+
+	era, ok := UpgradeEraAt(eras, 150)
+	suite.Require().True(ok)
+	suite.Assert().Equal("v2", era.Name)
+
+	era, ok = UpgradeEraAt(eras, 1_000_000)
+	suite.Require().True(ok)
+	suite.Assert().Equal("v3", era.Name)
+}
+
+func (suite *UpgradesTestSuite) TestUpgradeErasWithoutUpgrades() {
+	suite.Assert().Equal([]UpgradeEra{{Heights: HeightsFrom(1)}}, UpgradeEras(nil))
+}
+
+func TestUpgradesSuite(t *testing.T) {
+	suite.Run(t, new(UpgradesTestSuite))
+}
@@ -1,13 +1,15 @@
 package db
 
 import (
+	"context"
 	"errors"
 
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
 	"gorm.io/gorm"
 )
 
-func FindOrCreateDenomByBase(db *gorm.DB, base string) (models.Denom, error) {
+func FindOrCreateDenomByBase(ctx context.Context, db *gorm.DB, base string) (models.Denom, error) {
+	db = db.WithContext(ctx)
 	if base == "" {
 		return models.Denom{}, errors.New("base is required")
 	}
@@ -19,7 +21,8 @@ func FindOrCreateDenomByBase(db *gorm.DB, base string) (models.Denom, error) {
 	return denom, err
 }
 
-func FindOrCreateAddressByAddress(db *gorm.DB, address string) (models.Address, error) {
+func FindOrCreateAddressByAddress(ctx context.Context, db *gorm.DB, address string) (models.Address, error) {
+	db = db.WithContext(ctx)
 	if address == "" {
 		return models.Address{}, errors.New("address is required")
 	}
@@ -31,10 +34,22 @@ func FindOrCreateAddressByAddress(db *gorm.DB, address string) (models.Address,
 	return addr, err
 }
 
-func GetChains(db *gorm.DB) ([]models.Chain, error) {
+func GetChains(ctx context.Context, db *gorm.DB) ([]models.Chain, error) {
+	db = db.WithContext(ctx)
 	var chains []models.Chain
 	if err := db.Find(&chains).Error; err != nil {
 		return nil, err
 	}
 	return chains, nil
 }
+
+// GetChainByChainID returns the chain with the given chain ID, or an empty chain (ID 0) if it has not been indexed
+func GetChainByChainID(ctx context.Context, db *gorm.DB, chainID string) (models.Chain, error) {
+	db = db.WithContext(ctx)
+	var chain models.Chain
+	err := db.Where("chain_id = ?", chainID).First(&chain).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return chain, nil
+	}
+	return chain, err
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// UpsertValidator creates the validator of the chain with the consensus address, or updates the operator address and
+// moniker of the existing one. Returns the stored validator.
+func UpsertValidator(ctx context.Context, db *gorm.DB, validator models.Validator) (models.Validator, error) {
+	db = db.WithContext(ctx)
+	if validator.ChainID == 0 || validator.ConsAddress == "" {
+		return models.Validator{}, errors.New("validator chain and consensus address are required")
+	}
+
+	validator.ID = 0
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "cons_address"}},
+		DoUpdates: clause.AssignmentColumns([]string{"operator_address", "moniker"}),
+	}).Create(&validator).Error; err != nil {
+		return models.Validator{}, err
+	}
+
+	var stored models.Validator
+	err := db.Where("chain_id = ? AND cons_address = ?", validator.ChainID, validator.ConsAddress).First(&stored).Error
+	return stored, err
+}
+
+// indexValidators inserts the validators of the chain with the consensus addresses missing from the database in one
+// statement, without touching the existing ones, and resolves the IDs of all of them with one query. Returns the
+// validators by consensus address.
+func indexValidators(db *gorm.DB, chainID uint, consAddresses []string) (map[string]models.Validator, error) {
+	uniqueValidators := make(map[string]models.Validator, len(consAddresses))
+	for _, consAddress := range consAddresses {
+		uniqueValidators[consAddress] = models.Validator{ChainID: chainID, ConsAddress: consAddress}
+	}
+
+	if len(uniqueValidators) == 0 {
+		return uniqueValidators, nil
+	}
+
+	validatorsSlice := make([]models.Validator, 0, len(uniqueValidators))
+	consAddressValues := make([]string, 0, len(uniqueValidators))
+	for consAddress, validator := range uniqueValidators {
+		validatorsSlice = append(validatorsSlice, validator)
+		consAddressValues = append(consAddressValues, consAddress)
+	}
+
+	// Existing rows return no ID on conflict, so the IDs of every validator are selected afterwards
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "cons_address"}},
+		DoNothing: true,
+	}).Omit(clause.Associations).CreateInBatches(&validatorsSlice, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error getting/creating validators.", err)
+		return nil, err
+	}
+
+	var validators []models.Validator
+	if err := db.Where("chain_id = ? AND cons_address IN ?", chainID, consAddressValues).Find(&validators).Error; err != nil {
+		config.Log.Error("Error getting validators.", err)
+		return nil, err
+	}
+
+	for _, validator := range validators {
+		uniqueValidators[validator.ConsAddress] = validator
+	}
+
+	return uniqueValidators, nil
+}
+
+// indexBlockSignatures stores the last commit signatures of the block against the validators, which must already be
+// indexed. Reindexing the block updates whether each validator signed.
+func indexBlockSignatures(db *gorm.DB, blockID uint, signatures []models.BlockSignature, validators map[string]models.Validator) error {
+	if len(signatures) == 0 {
+		return nil
+	}
+
+	blockSignatures := make([]models.BlockSignature, len(signatures))
+	for i, signature := range signatures {
+		blockSignatures[i] = models.BlockSignature{
+			BlockID:     blockID,
+			ValidatorID: validators[signature.Validator.ConsAddress].ID,
+			Signed:      signature.Signed,
+		}
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "block_id"}, {Name: "validator_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"signed"}),
+	}).Omit(clause.Associations).CreateInBatches(&blockSignatures, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error creating block signatures.", err)
+		return err
+	}
+	return nil
+}
+
+// ValidatorUptime is the signing record of a validator returned by GetValidatorUptime
+type ValidatorUptime struct {
+	models.Validator
+	SignedBlocks int64   // Blocks whose last commit the validator signed
+	MissedBlocks int64   // Blocks whose last commit the validator voted nil on or was absent from
+	Uptime       float64 // SignedBlocks over the blocks with signatures indexed in the range, between 0 and 1
+}
+
+// GetValidatorUptime returns the signing record of every validator in the last commit of at least one block of the chain
+// within the height range, ordered by consensus address. Only blocks indexed with flags.index-block-signatures count, the
+// signatures of a block are the votes for the previous height.
+func GetValidatorUptime(ctx context.Context, db *gorm.DB, chain ChainRef, heights HeightRange) ([]ValidatorUptime, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	signatures := db.Table("block_signatures").
+		Joins("JOIN blocks ON blocks.id = block_signatures.block_id").
+		Where("blocks.chain_id = ?", chain.ID)
+	signatures = heights.where(signatures, "blocks.height")
+
+	var blockCount int64
+	if err := signatures.Session(&gorm.Session{}).Distinct("block_signatures.block_id").Count(&blockCount).Error; err != nil {
+		return nil, err
+	}
+	if blockCount == 0 {
+		return nil, nil
+	}
+
+	var signedCounts []struct {
+		ValidatorID  uint
+		SignedBlocks int64
+	}
+	err := signatures.
+		Select("block_signatures.validator_id, SUM(CASE WHEN block_signatures.signed THEN 1 ELSE 0 END) AS signed_blocks").
+		Group("block_signatures.validator_id").
+		Scan(&signedCounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	validatorIDs := make([]uint, len(signedCounts))
+	signedBlocks := make(map[uint]int64, len(signedCounts))
+	for i, count := range signedCounts {
+		validatorIDs[i] = count.ValidatorID
+		signedBlocks[count.ValidatorID] = count.SignedBlocks
+	}
+
+	var validators []models.Validator
+	if err := db.Where("id IN ?", validatorIDs).Order("cons_address").Find(&validators).Error; err != nil {
+		return nil, err
+	}
+
+	uptimes := make([]ValidatorUptime, len(validators))
+	for i, validator := range validators {
+		signed := signedBlocks[validator.ID]
+		uptimes[i] = ValidatorUptime{
+			Validator:    validator,
+			SignedBlocks: signed,
+			MissedBlocks: blockCount - signed,
+			Uptime:       float64(signed) / float64(blockCount),
+		}
+	}
+	return uptimes, nil
+}
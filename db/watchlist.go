@@ -0,0 +1,147 @@
+package db
+
+import (
+	"context"
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AddWatchedAddress adds the address to the watchlist, updating the label if it is already watched
+func AddWatchedAddress(ctx context.Context, db *gorm.DB, address string, label string) (models.WatchedAddress, error) {
+	db = db.WithContext(ctx)
+	var watchedAddress models.WatchedAddress
+
+	err := db.Transaction(func(dbTransaction *gorm.DB) error {
+		addr, err := FindOrCreateAddressByAddress(ctx, dbTransaction, address)
+		if err != nil {
+			return err
+		}
+
+		watchedAddress = models.WatchedAddress{AddressID: addr.ID, Address: addr, Label: label}
+
+		return dbTransaction.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"label"}),
+		}).Omit("Address").Create(&watchedAddress).Error
+	})
+
+	return watchedAddress, err
+}
+
+// RemoveWatchedAddress removes the address from the watchlist. Previously recorded activity is removed with it.
+func RemoveWatchedAddress(ctx context.Context, db *gorm.DB, address string) error {
+	db = db.WithContext(ctx)
+	return db.Transaction(func(dbTransaction *gorm.DB) error {
+		var watchedAddress models.WatchedAddress
+		err := dbTransaction.
+			Joins("JOIN addresses ON addresses.id = watched_addresses.address_id").
+			Where("addresses.address = ?", address).
+			Limit(1).
+			Find(&watchedAddress).Error
+		if err != nil || watchedAddress.ID == 0 {
+			return err
+		}
+
+		if err := dbTransaction.Where("watched_address_id = ?", watchedAddress.ID).Delete(&models.WatchedAddressActivity{}).Error; err != nil {
+			return err
+		}
+
+		return dbTransaction.Delete(&watchedAddress).Error
+	})
+}
+
+// GetWatchedAddresses returns the full watchlist
+func GetWatchedAddresses(ctx context.Context, db *gorm.DB) ([]models.WatchedAddress, error) {
+	db = db.WithContext(ctx)
+	var watchedAddresses []models.WatchedAddress
+	if err := db.Preload("Address").Order("id").Find(&watchedAddresses).Error; err != nil {
+		return nil, err
+	}
+	return watchedAddresses, nil
+}
+
+// GetWatchedAddressActivityInRange returns the txs involving the watched address on the chain within the height range,
+// with their block and signers loaded, ordered by height.
+func GetWatchedAddressActivityInRange(ctx context.Context, db *gorm.DB, chain ChainRef, address string, heights HeightRange) ([]models.Tx, error) {
+	db = readDB(ctx, db)
+	if err := validateChainAndHeights(chain, heights); err != nil {
+		return nil, err
+	}
+
+	return getWatchedAddressActivity(db, chain.ID, address, heights)
+}
+
+// GetWatchedAddressActivity returns the txs involving the watched address on the chain between startHeight and endHeight (-1 for no upper bound)
+//
+// Deprecated: use GetWatchedAddressActivityInRange, which validates the chain and height range.
+func GetWatchedAddressActivity(ctx context.Context, db *gorm.DB, chainID uint, address string, startHeight int64, endHeight int64) ([]models.Tx, error) {
+	db = readDB(ctx, db)
+	return getWatchedAddressActivity(db, chainID, address, HeightRange{Start: startHeight, End: endHeight})
+}
+
+func getWatchedAddressActivity(db *gorm.DB, chainID uint, address string, heights HeightRange) ([]models.Tx, error) {
+	var txs []models.Tx
+
+	query := db.
+		Joins("JOIN watched_address_activities ON watched_address_activities.tx_id = txes.id").
+		Joins("JOIN watched_addresses ON watched_addresses.id = watched_address_activities.watched_address_id").
+		Joins("JOIN addresses ON addresses.id = watched_addresses.address_id").
+		Joins("JOIN blocks ON blocks.id = txes.block_id").
+		Where("addresses.address = ? AND blocks.chain_id = ?", address, chainID)
+
+	err := heights.where(query, "blocks.height").
+		Preload("Block").
+		Preload("SignerAddresses").
+		Order("blocks.height, txes.id").
+		Find(&txs).Error
+
+	return txs, err
+}
+
+func indexWatchedAddressActivity(db *gorm.DB, txs []TxDBWrapper) error {
+	watchedTxIDs := make(map[string][]uint)
+	for _, tx := range txs {
+		for _, address := range tx.WatchedAddresses {
+			watchedTxIDs[address] = append(watchedTxIDs[address], tx.Tx.ID)
+		}
+	}
+
+	if len(watchedTxIDs) == 0 {
+		return nil
+	}
+
+	addresses := make([]string, 0, len(watchedTxIDs))
+	for address := range watchedTxIDs {
+		addresses = append(addresses, address)
+	}
+
+	var watchedAddresses []models.WatchedAddress
+	if err := db.
+		Preload("Address").
+		Joins("JOIN addresses ON addresses.id = watched_addresses.address_id").
+		Where("addresses.address IN ?", addresses).
+		Find(&watchedAddresses).Error; err != nil {
+		config.Log.Error("Error getting watched addresses.", err)
+		return err
+	}
+
+	var activities []models.WatchedAddressActivity
+	for _, watchedAddress := range watchedAddresses {
+		for _, txID := range watchedTxIDs[watchedAddress.Address.Address] {
+			activities = append(activities, models.WatchedAddressActivity{WatchedAddressID: watchedAddress.ID, TxID: txID})
+		}
+	}
+
+	if len(activities) == 0 {
+		return nil
+	}
+
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).CreateInBatches(&activities, insertBatchSize(db)).Error; err != nil {
+		config.Log.Error("Error creating watched address activity.", err)
+		return err
+	}
+
+	return nil
+}
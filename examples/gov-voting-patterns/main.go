@@ -115,7 +115,7 @@ func (c *MsgVoteParser) IndexMessage(dataset *any, db *gorm.DB, message models.M
 	// Find the address in the database
 	var err error
 	var voter models.Address
-	voter, err = dbTypes.FindOrCreateAddressByAddress(db, vote.Address.Address)
+	voter, err = dbTypes.FindOrCreateAddressByAddress(db.Statement.Context, db, vote.Address.Address)
 
 	if err != nil {
 		return err
@@ -208,7 +208,7 @@ func (c *MsgSubmitProposalParser) IndexMessage(dataset *any, db *gorm.DB, messag
 	var err error
 	var proposer models.Address
 
-	proposer, err = dbTypes.FindOrCreateAddressByAddress(db, proposal.ProposerAddress.Address)
+	proposer, err = dbTypes.FindOrCreateAddressByAddress(db.Statement.Context, db, proposal.ProposerAddress.Address)
 
 	if err != nil {
 		return err
@@ -99,18 +99,18 @@ func (c *MsgDelegateUndelegateParser) IndexMessage(dataset *any, db *gorm.DB, me
 	}
 
 	// Save the delegator and validator addresses
-	validatorAddress, err := dbTypes.FindOrCreateAddressByAddress(db, delegationEvent.Validator.ValidatorAddress.Address)
+	validatorAddress, err := dbTypes.FindOrCreateAddressByAddress(db.Statement.Context, db, delegationEvent.Validator.ValidatorAddress.Address)
 	if err != nil {
 		return err
 	}
 
-	delegatorAddress, err := dbTypes.FindOrCreateAddressByAddress(db, delegationEvent.Delegator.Address)
+	delegatorAddress, err := dbTypes.FindOrCreateAddressByAddress(db.Statement.Context, db, delegationEvent.Delegator.Address)
 	if err != nil {
 		return err
 	}
 
 	// Save the denom of the delegation
-	denom, err := dbTypes.FindOrCreateDenomByBase(db, delegationEvent.Denom.Base)
+	denom, err := dbTypes.FindOrCreateDenomByBase(db.Statement.Context, db, delegationEvent.Denom.Base)
 	if err != nil {
 		return err
 	}
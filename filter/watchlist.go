@@ -0,0 +1,81 @@
+package filter
+
+import (
+	"sync"
+
+	abci "github.com/cometbft/cometbft/abci/types"
+)
+
+// Watchlist is a set of addresses that are always indexed in full, regardless of the configured message type filters.
+// It is safe for concurrent use and can be replaced at runtime with Set to hot reload membership.
+type Watchlist struct {
+	mu        sync.RWMutex
+	addresses map[string]struct{}
+}
+
+func NewWatchlist(addresses []string) *Watchlist {
+	w := &Watchlist{}
+	w.Set(addresses)
+	return w
+}
+
+// Set replaces the watched addresses
+func (w *Watchlist) Set(addresses []string) {
+	newAddresses := make(map[string]struct{}, len(addresses))
+	for _, address := range addresses {
+		newAddresses[address] = struct{}{}
+	}
+
+	w.mu.Lock()
+	w.addresses = newAddresses
+	w.mu.Unlock()
+}
+
+func (w *Watchlist) Len() int {
+	if w == nil {
+		return 0
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return len(w.addresses)
+}
+
+func (w *Watchlist) Contains(address string) bool {
+	if w == nil {
+		return false
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	_, ok := w.addresses[address]
+	return ok
+}
+
+// MatchEvents returns the unique watched addresses found in the attribute values of the events.
+// Signers, senders and recipients all show up in the tx events, so this catches any activity involving a watched address.
+func (w *Watchlist) MatchEvents(events []abci.Event) []string {
+	if w.Len() == 0 {
+		return nil
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	var matches []string
+	seen := make(map[string]struct{})
+	for _, event := range events {
+		for _, attribute := range event.Attributes {
+			if _, ok := w.addresses[attribute.Value]; !ok {
+				continue
+			}
+			if _, ok := seen[attribute.Value]; ok {
+				continue
+			}
+			seen[attribute.Value] = struct{}{}
+			matches = append(matches, attribute.Value)
+		}
+	}
+
+	return matches
+}
@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/core"
+)
+
+// ForChain returns the indexer of one of the chains of the config, see config.IndexConfig.Chains. It shares the database
+// connections, filters, watchlist, parsers and registered models of the indexer, with the config of the chain and no
+// chain client or block enqueue function yet. Blocks it indexes are published to the subscribers of the indexer.
+func (indexer *Indexer) ForChain(chain config.ChainConfig) *Indexer {
+	return &Indexer{
+		Config:                              indexer.Config.ForChain(chain),
+		DryRun:                              indexer.DryRun,
+		DB:                                  indexer.DB,
+		DBConnectOptions:                    indexer.DBConnectOptions,
+		SecondaryDB:                         indexer.SecondaryDB,
+		ReadReplicaDB:                       indexer.ReadReplicaDB,
+		CustomModuleBasics:                  indexer.CustomModuleBasics,
+		BlockEventFilterRegistries:          indexer.BlockEventFilterRegistries,
+		MessageTypeFilters:                  indexer.MessageTypeFilters,
+		Watchlist:                           indexer.Watchlist,
+		RangeProfiles:                       indexer.RangeProfiles,
+		RangeProfileFilters:                 indexer.RangeProfileFilters,
+		CustomBeginBlockEventParserRegistry: indexer.CustomBeginBlockEventParserRegistry,
+		CustomEndBlockEventParserRegistry:   indexer.CustomEndBlockEventParserRegistry,
+		CustomBeginBlockParserTrackers:      indexer.CustomBeginBlockParserTrackers,
+		CustomEndBlockParserTrackers:        indexer.CustomEndBlockParserTrackers,
+		CustomMessageParserRegistry:         indexer.CustomMessageParserRegistry,
+		CustomMessageParserTrackers:         indexer.CustomMessageParserTrackers,
+		CustomModels:                        indexer.CustomModels,
+		BackfillJobs:                        indexer.BackfillJobs,
+		parent:                              indexer.root(),
+	}
+}
+
+// root returns the indexer ForChain was called on, the indexer itself when it indexes the only chain
+func (indexer *Indexer) root() *Indexer {
+	if indexer.parent != nil {
+		return indexer.parent
+	}
+	return indexer
+}
+
+// log returns the logger of the chain of the indexer
+func (indexer *Indexer) log() *config.Logger {
+	return indexer.Config.ChainLog()
+}
+
+// ChainProgress is the progress of the indexing of a chain since startup
+type ChainProgress struct {
+	Height    int64     // Highest height indexed, 0 when no block was indexed yet
+	Blocks    int64     // Blocks indexed, a block with both datasets counts twice
+	IndexedAt time.Time // When the last block was indexed
+}
+
+// chainProgress tracks the ChainProgress of an indexer
+type chainProgress struct {
+	mu       sync.Mutex
+	progress ChainProgress
+}
+
+// record records the indexing of the block at the height. Blocks are indexed out of order by concurrent workers, so the
+// height only moves up.
+func (p *chainProgress) record(height int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.progress.Blocks++
+	p.progress.IndexedAt = time.Now()
+	if height > p.progress.Height {
+		p.progress.Height = height
+	}
+}
+
+// Progress returns the progress of the indexing of the chain of the indexer since startup
+func (indexer *Indexer) Progress() ChainProgress {
+	indexer.progress.mu.Lock()
+	defer indexer.progress.mu.Unlock()
+	return indexer.progress.progress
+}
+
+// PendingHeights returns the heights in the block pipeline of the indexer, to report the heights left unindexed when it
+// stops. The fetch pools of the indexer must track their dispatched heights with it, see core.BlockFetchPool.Pending.
+func (indexer *Indexer) PendingHeights() *core.PendingHeights {
+	return &indexer.pending
+}
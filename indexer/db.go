@@ -1,19 +1,26 @@
 package indexer
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/DefiantLabs/cosmos-indexer/config"
 	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/tracing"
 )
 
 // doDBUpdates will read the data out of the db data chan that had been processed by the workers
 // if this is a dry run, we will simply empty the channel and track progress
 // otherwise we will index the data in the DB.
 // it will also read rewars data and index that.
-func (indexer *Indexer) DoDBUpdates(wg *sync.WaitGroup, txDataChan chan *DBData, blockEventsDataChan chan *BlockEventsDBData, dbChainID uint) {
+// When ctx is cancelled the block being written is rolled back and the updates stop, unwritten blocks are indexed on the next run
+// and stay in PendingHeights. Pass a ctx that outlives the shutdown signal to write the blocks already fetched first.
+// With base.block-batch-size, the txs of the blocks waiting in the channel are written in one transaction, see indexTxBatch.
+func (indexer *Indexer) DoDBUpdates(ctx context.Context, wg *sync.WaitGroup, txDataChan chan *DBData, blockEventsDataChan chan *BlockEventsDBData, dbChainID uint) {
 	blocksProcessed := 0
 	dbWrites := 0
 	dbReattempts := 0
@@ -23,53 +30,53 @@ func (indexer *Indexer) DoDBUpdates(wg *sync.WaitGroup, txDataChan chan *DBData,
 	for {
 		// break out of loop once all channels are fully consumed
 		if txDataChan == nil && blockEventsDataChan == nil {
-			config.Log.Info("DB updates complete")
+			indexer.log().Info("DB updates complete")
 			break
 		}
 
 		select {
+		case <-ctx.Done():
+			indexer.log().Info("Indexer is shutting down, stopping DB updates")
+			return
 		// read tx data from the data chan
 		case data, ok := <-txDataChan:
 			if !ok {
 				txDataChan = nil
 				continue
 			}
-			dbWrites++
+
+			batch, open := indexer.collectTxBatch(data, txDataChan)
+			if !open {
+				txDataChan = nil
+			}
+			dbWrites += len(batch)
 			// While debugging we'll sometimes want to turn off INSERTS to the DB
 			// Note that this does not turn off certain reads or DB connections.
 			if !indexer.DryRun {
-				config.Log.Info(fmt.Sprintf("Indexing %v TXs from block %d", len(data.txDBWrappers), data.block.Height))
-				_, indexedDataset, err := dbTypes.IndexNewBlock(indexer.DB, data.block, data.txDBWrappers, *indexer.Config)
-				if err != nil {
-					// Do a single reattempt on failure
-					dbReattempts++
-					_, _, err = dbTypes.IndexNewBlock(indexer.DB, data.block, data.txDBWrappers, *indexer.Config)
-					if err != nil {
-						config.Log.Fatal(fmt.Sprintf("Error indexing block %v.", data.block.Height), err)
-					}
+				reattempts, indexed := indexer.indexTxBatch(ctx, batch)
+				dbReattempts += reattempts
+				if !indexed {
+					return
 				}
-
-				err = dbTypes.IndexCustomMessages(*indexer.Config, indexer.DB, indexer.DryRun, indexedDataset, indexer.CustomMessageParserTrackers)
-
-				if err != nil {
-					config.Log.Fatal(fmt.Sprintf("Error indexing custom messages for block %d", data.block.Height), err)
-				}
-
-				config.Log.Info(fmt.Sprintf("Finished indexing %v TXs from block %d", len(data.txDBWrappers), data.block.Height))
 			} else {
-				config.Log.Info(fmt.Sprintf("Processing block %d (dry run, block data will not be stored in DB).", data.block.Height))
+				for _, data := range batch {
+					indexer.log().Info(fmt.Sprintf("Processing block %d (dry run, block data will not be stored in DB).", data.block.Height))
+					indexer.pending.Done(data.block.Height)
+				}
 			}
 
 			// Just measuring how many blocks/second we can process
 			if indexer.Config.Base.BlockTimer > 0 {
-				blocksProcessed++
-				if blocksProcessed%int(indexer.Config.Base.BlockTimer) == 0 {
-					totalTime := time.Since(timeStart)
-					config.Log.Info(fmt.Sprintf("Processing %d blocks took %f seconds. %d total blocks have been processed.\n", indexer.Config.Base.BlockTimer, totalTime.Seconds(), blocksProcessed))
-					timeStart = time.Now()
+				for range batch {
+					blocksProcessed++
+					if blocksProcessed%int(indexer.Config.Base.BlockTimer) == 0 {
+						totalTime := time.Since(timeStart)
+						indexer.log().Info(fmt.Sprintf("Processing %d blocks took %f seconds. %d total blocks have been processed.\n", indexer.Config.Base.BlockTimer, totalTime.Seconds(), blocksProcessed))
+						timeStart = time.Now()
+					}
 				}
 				if float64(dbReattempts)/float64(dbWrites) > .1 {
-					config.Log.Fatalf("More than 10%% of the last %v DB writes have failed.", dbWrites)
+					indexer.log().Fatalf("More than 10%% of the last %v DB writes have failed.", dbWrites)
 				}
 			}
 		case eventData, ok := <-blockEventsDataChan:
@@ -79,21 +86,240 @@ func (indexer *Indexer) DoDBUpdates(wg *sync.WaitGroup, txDataChan chan *DBData,
 			}
 			dbWrites++
 			numEvents := len(eventData.blockDBWrapper.BeginBlockEvents) + len(eventData.blockDBWrapper.EndBlockEvents)
-			config.Log.Info(fmt.Sprintf("Indexing %v Block Events from block %d", numEvents, eventData.blockDBWrapper.Block.Height))
+			indexer.log().Info(fmt.Sprintf("Indexing %v Block Events from block %d", numEvents, eventData.blockDBWrapper.Block.Height))
 			identifierLoggingString := fmt.Sprintf("block %d", eventData.blockDBWrapper.Block.Height)
 
-			indexedDataset, err := dbTypes.IndexBlockEvents(indexer.DB, indexer.DryRun, eventData.blockDBWrapper, identifierLoggingString)
+			blockCtx := tracing.ContextWithBlock(ctx, eventData.trace)
+			indexedDataset, err := indexer.indexBlockEvents(blockCtx, eventData.blockDBWrapper, identifierLoggingString)
+			if ctx.Err() != nil {
+				indexer.log().Infof("Indexer is shutting down, block events for %s were rolled back", identifierLoggingString)
+				return
+			}
+
 			if err != nil {
-				config.Log.Fatal(fmt.Sprintf("Error indexing block events for %s.", identifierLoggingString), err)
+				logInvalidTextHint(eventData.blockDBWrapper.Block.Height, err)
+				indexer.log().Fatal(fmt.Sprintf("Error indexing block events for %s.", identifierLoggingString), err)
 			}
 
-			err = dbTypes.IndexCustomBlockEvents(*indexer.Config, indexer.DB, indexer.DryRun, indexedDataset, identifierLoggingString, indexer.CustomBeginBlockParserTrackers, indexer.CustomEndBlockParserTrackers)
+			err = dbTypes.IndexCustomBlockEvents(blockCtx, *indexer.Config, indexer.DB, indexer.DryRun, indexedDataset, identifierLoggingString, indexer.CustomBeginBlockParserTrackers, indexer.CustomEndBlockParserTrackers)
 
 			if err != nil {
-				config.Log.Fatal(fmt.Sprintf("Error indexing custom block events for %s.", identifierLoggingString), err)
+				indexer.log().Fatal(fmt.Sprintf("Error indexing custom block events for %s.", identifierLoggingString), err)
+			}
+
+			if !indexer.DryRun {
+				err = dbTypes.IndexQuarantinedAttributes(blockCtx, indexer.DB, indexedDataset, indexer.Config.Flags.AttributeQuarantineSampleCap)
+				if err != nil {
+					indexer.log().Fatal(fmt.Sprintf("Error indexing quarantined attributes for %s.", identifierLoggingString), err)
+				}
+
+				indexer.root().subscriptions.publishBlock(indexer.Config.Probe.ChainID, BlockDatasetBlockEvents, *indexedDataset.Block, nil)
+				indexer.progress.record(indexedDataset.Block.Height)
+			}
+
+			indexer.log().Info(fmt.Sprintf("Finished indexing %v Block Events from block %d", numEvents, eventData.blockDBWrapper.Block.Height))
+			indexer.pending.Done(eventData.blockDBWrapper.Block.Height)
+		}
+	}
+}
+
+// collectTxBatch returns the block with the blocks already waiting in the channel, up to base.block-batch-size blocks of
+// the same range profile. It never waits for a block, so blocks are written one by one once the indexer is caught up.
+// Returns false when the channel was found closed.
+func (indexer *Indexer) collectTxBatch(data *DBData, txDataChan chan *DBData) ([]*DBData, bool) {
+	batch := []*DBData{data}
+	profile := indexer.blockSettingsAt(data.block.Height, indexer.BlockEventFilterRegistries).profile
+
+	for int64(len(batch)) < indexer.Config.Base.BlockBatchSize {
+		select {
+		case next, ok := <-txDataChan:
+			if !ok {
+				return batch, false
+			}
+			batch = append(batch, next)
+			// A block of another profile is indexed with another config, it ends the batch
+			if indexer.blockSettingsAt(next.block.Height, indexer.BlockEventFilterRegistries).profile != profile {
+				return batch, true
+			}
+		default:
+			return batch, true
+		}
+	}
+
+	return batch, true
+}
+
+// indexTxBatch indexes the txs of the blocks, in one DB transaction when there are several of the same range profile. When
+// the batch fails, its blocks are indexed again one by one so a bad block does not fail its neighbors. Returns the number
+// of reattempted writes, and false when the indexer is shutting down.
+func (indexer *Indexer) indexTxBatch(ctx context.Context, batch []*DBData) (int, bool) {
+	last := batch[len(batch)-1]
+	profile := indexer.blockSettingsAt(batch[0].block.Height, indexer.BlockEventFilterRegistries).profile
+	// collectTxBatch ends a batch with the first block of another range profile, which is indexed on its own
+	if len(batch) > 1 && indexer.blockSettingsAt(last.block.Height, indexer.BlockEventFilterRegistries).profile != profile {
+		reattempts, indexed := indexer.indexTxBatch(ctx, batch[:len(batch)-1])
+		if !indexed {
+			return reattempts, false
+		}
+		lastReattempts, indexed := indexer.indexTxBatch(ctx, []*DBData{last})
+		return reattempts + lastReattempts, indexed
+	}
+
+	if len(batch) == 1 {
+		return indexer.indexTxData(ctx, batch[0])
+	}
+
+	blocks := make([]dbTypes.BlockTxsDBWrapper, len(batch))
+	// A failed batch leaves the IDs of its rolled back rows in the wrappers, the fallback indexes untouched copies
+	fallback := make([]*DBData, len(batch))
+	for i, data := range batch {
+		blocks[i] = dbTypes.BlockTxsDBWrapper{Block: data.block, Txs: data.txDBWrappers}
+		clone := dbTypes.CloneBlockTxsDBWrapper(blocks[i])
+		fallback[i] = &DBData{block: clone.Block, txDBWrappers: clone.Txs, trace: data.trace}
+	}
+
+	indexer.log().Info(fmt.Sprintf("Indexing TXs from blocks %d to %d in one transaction", batch[0].block.Height, last.block.Height))
+	// The batch is traced with its first block
+	indexedBlocks, err := indexer.indexNewBlocks(tracing.ContextWithBlock(ctx, batch[0].trace), blocks)
+
+	if ctx.Err() != nil {
+		indexer.log().Infof("Indexer is shutting down, blocks %d to %d were rolled back", batch[0].block.Height, last.block.Height)
+		return 0, false
+	}
+
+	if err != nil {
+		indexer.log().Warnf("Error indexing blocks %d to %d in one transaction, indexing them one by one. Err: %v", batch[0].block.Height, last.block.Height, err)
+		reattempts := 0
+		for _, data := range fallback {
+			dataReattempts, indexed := indexer.indexTxData(ctx, data)
+			reattempts += dataReattempts
+			if !indexed {
+				return reattempts, false
 			}
+		}
+		return reattempts, true
+	}
+
+	for i, data := range batch {
+		indexer.finishTxData(ctx, data, indexedBlocks[i].Block, indexedBlocks[i].Txs)
+	}
+	return 0, true
+}
+
+// indexTxData indexes the txs of the block, with a single reattempt on failure. Returns the number of reattempted writes,
+// and false when the indexer is shutting down.
+func (indexer *Indexer) indexTxData(ctx context.Context, data *DBData) (int, bool) {
+	ctx = tracing.ContextWithBlock(ctx, data.trace)
+	indexer.log().Info(fmt.Sprintf("Indexing %v TXs from block %d", len(data.txDBWrappers), data.block.Height))
+	indexedBlock, indexedDataset, err := indexer.indexNewBlock(ctx, data.block, data.txDBWrappers)
 
-			config.Log.Info(fmt.Sprintf("Finished indexing %v Block Events from block %d", numEvents, eventData.blockDBWrapper.Block.Height))
+	// Conflicting block data will not resolve itself on a reattempt, leave the existing rows untouched and
+	// track the height as failed so it can be rolled back and reindexed
+	var conflictErr *dbTypes.BlockConflictError
+	if errors.As(err, &conflictErr) {
+		indexer.log().Error(fmt.Sprintf("Block %d conflicts with the block stored in the DB, marking it as failed.", data.block.Height), err)
+		err = dbTypes.UpsertFailedBlock(ctx, indexer.DB, data.block.Height, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName, dbTypes.StageBlock, conflictErr)
+		if err != nil {
+			indexer.log().Fatal(fmt.Sprintf("Error marking block %d as failed.", data.block.Height), err)
 		}
+		indexer.pending.Done(data.block.Height)
+		return 0, true
+	}
+
+	if ctx.Err() != nil {
+		indexer.log().Infof("Indexer is shutting down, block %d was rolled back", data.block.Height)
+		return 0, false
+	}
+
+	reattempts := 0
+	if err != nil {
+		// Do a single reattempt on failure
+		reattempts++
+		indexedBlock, indexedDataset, err = indexer.indexNewBlock(ctx, data.block, data.txDBWrappers)
+		if err != nil {
+			logInvalidTextHint(data.block.Height, err)
+			indexer.log().Fatal(fmt.Sprintf("Error indexing block %v.", data.block.Height), err)
+		}
+	}
+
+	indexer.finishTxData(ctx, data, indexedBlock, indexedDataset)
+	return reattempts, true
+}
+
+// finishTxData runs the custom message parsers on the indexed txs of the block and notifies the subscribers
+func (indexer *Indexer) finishTxData(ctx context.Context, data *DBData, indexedBlock models.Block, indexedDataset []dbTypes.TxDBWrapper) {
+	err := dbTypes.IndexCustomMessages(ctx, *indexer.Config, indexer.DB, indexer.DryRun, indexedDataset, indexer.CustomMessageParserTrackers)
+
+	if err != nil {
+		indexer.log().Fatal(fmt.Sprintf("Error indexing custom messages for block %d", data.block.Height), err)
+	}
+
+	indexer.root().subscriptions.publishBlock(indexer.Config.Probe.ChainID, BlockDatasetTxs, indexedBlock, indexedDataset)
+	indexer.progress.record(indexedBlock.Height)
+	indexer.notifyWatchedAddressActivity(indexedBlock, indexedDataset)
+	indexer.enqueueIBCDenoms(indexedDataset)
+
+	indexer.log().Info(fmt.Sprintf("Finished indexing %v TXs from block %d", len(data.txDBWrappers), data.block.Height))
+	indexer.pending.Done(data.block.Height)
+}
+
+// indexNewBlocks indexes the blocks in the DB in one transaction with the config of their range profile, mirroring the
+// write to the secondary database when dual write mode is enabled
+func (indexer *Indexer) indexNewBlocks(ctx context.Context, blocks []dbTypes.BlockTxsDBWrapper) (indexedBlocks []dbTypes.BlockTxsDBWrapper, err error) {
+	txCount, messageCount := 0, 0
+	for _, block := range blocks {
+		txCount += len(block.Txs)
+		messageCount += countMessages(block.Txs)
+	}
+	ctx, span := tracing.Start(ctx, "IndexNewBlocks", tracing.ChainID.String(indexer.Config.Probe.ChainID), tracing.Height.Int64(blocks[0].Block.Height),
+		tracing.EndHeight.Int64(blocks[len(blocks)-1].Block.Height), tracing.TxCount.Int(txCount), tracing.MessageCount.Int(messageCount))
+	defer func() { tracing.End(span, err) }()
+
+	blockConfig := indexer.blockSettingsAt(blocks[0].Block.Height, indexer.BlockEventFilterRegistries).config
+	if indexer.DualWriter != nil {
+		return indexer.DualWriter.IndexNewBlocks(ctx, blocks, *blockConfig)
+	}
+	return dbTypes.IndexNewBlocks(ctx, indexer.DB, blocks, *blockConfig)
+}
+
+// indexNewBlock indexes the block in the DB with the config of its range profile, mirroring the write to the secondary
+// database when dual write mode is enabled
+func (indexer *Indexer) indexNewBlock(ctx context.Context, block models.Block, txs []dbTypes.TxDBWrapper) (_ models.Block, _ []dbTypes.TxDBWrapper, err error) {
+	ctx, span := tracing.Start(ctx, "IndexNewBlock", tracing.ChainID.String(indexer.Config.Probe.ChainID), tracing.Height.Int64(block.Height),
+		tracing.TxCount.Int(len(txs)), tracing.MessageCount.Int(countMessages(txs)))
+	defer func() { tracing.End(span, err) }()
+
+	blockConfig := indexer.blockSettingsAt(block.Height, indexer.BlockEventFilterRegistries).config
+	if indexer.DualWriter != nil {
+		return indexer.DualWriter.IndexNewBlock(ctx, block, txs, *blockConfig)
+	}
+	return dbTypes.IndexNewBlock(ctx, indexer.DB, block, txs, *blockConfig)
+}
+
+// indexBlockEvents indexes the block events in the DB, mirroring the write to the secondary database when dual write mode is enabled
+func (indexer *Indexer) indexBlockEvents(ctx context.Context, blockDBWrapper *dbTypes.BlockDBWrapper, identifierLoggingString string) (_ *dbTypes.BlockDBWrapper, err error) {
+	ctx, span := tracing.Start(ctx, "IndexBlockEvents", tracing.ChainID.String(indexer.Config.Probe.ChainID), tracing.Height.Int64(blockDBWrapper.Block.Height),
+		tracing.EventCount.Int(len(blockDBWrapper.BeginBlockEvents)+len(blockDBWrapper.EndBlockEvents)))
+	defer func() { tracing.End(span, err) }()
+
+	if indexer.DualWriter != nil {
+		return indexer.DualWriter.IndexBlockEvents(ctx, indexer.DryRun, blockDBWrapper, identifierLoggingString)
+	}
+	return dbTypes.IndexBlockEvents(ctx, indexer.DB, indexer.DryRun, blockDBWrapper, identifierLoggingString)
+}
+
+func countMessages(txs []dbTypes.TxDBWrapper) int {
+	count := 0
+	for _, tx := range txs {
+		count += len(tx.Messages)
+	}
+	return count
+}
+
+// logInvalidTextHint explains text values rejected by PostgreSQL, which happens for data processed without attribute sanitization
+func logInvalidTextHint(height int64, err error) {
+	if dbTypes.IsInvalidTextError(err) {
+		config.Log.Errorf("Block %d contains text values PostgreSQL cannot store (null bytes or invalid UTF-8). Reindex it with flags.invalid-text-policy set to %s or %s.",
+			height, config.InvalidTextPolicySanitize, config.InvalidTextPolicyBytea)
 	}
 }
@@ -0,0 +1,160 @@
+package indexer
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/DefiantLabs/cosmos-indexer/core"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+)
+
+// DryRunSummary is what indexing a block would write, reported by dry runs instead of writing it. Errors are the parts of
+// the block that could not be fetched or decoded and would be recorded as failed, Warnings the txs, messages and
+// attributes that could not be decoded and would be stored aside while the rest of the block is indexed.
+type DryRunSummary struct {
+	Height            int64          `json:"height"`
+	Txs               int            `json:"txs"`
+	MessageTypes      map[string]int `json:"message_types"`
+	MessageEventTypes map[string]int `json:"message_event_types"`
+	BlockEventTypes   map[string]int `json:"block_event_types"`
+	FeeDenoms         []string       `json:"fee_denoms"`
+	Warnings          []string       `json:"warnings"`
+	Errors            []string       `json:"errors"`
+}
+
+// Failed returns true when part of the block could not be fetched or decoded
+func (s DryRunSummary) Failed() bool {
+	return len(s.Errors) != 0
+}
+
+// NewDryRunSummary returns the summary of a height with nothing to write yet
+func NewDryRunSummary(height int64) DryRunSummary {
+	return DryRunSummary{
+		Height:            height,
+		MessageTypes:      make(map[string]int),
+		MessageEventTypes: make(map[string]int),
+		BlockEventTypes:   make(map[string]int),
+		FeeDenoms:         []string{},
+		Warnings:          []string{},
+		Errors:            []string{},
+	}
+}
+
+// DryRunBlock decodes the fetched block like ProcessBlocks does, with the filters and parsers of its range profile, and
+// summarizes what indexing it would write. Nothing is read from or written to the database.
+func (indexer *Indexer) DryRunBlock(blockData core.IndexerBlockEventData) DryRunSummary {
+	height := blockData.BlockData.Block.Height
+	summary := NewDryRunSummary(height)
+
+	// The DB chain ID does not affect what the block writes, the chain may not have been indexed yet
+	block, err := core.ProcessChainBlock(blockData.BlockData, blockData.BlockResultsData, 0, indexer.Config.Probe.AccountPrefix)
+	if err != nil {
+		summary.Errors = append(summary.Errors, fmt.Sprintf("processing the block failed: %v", err))
+		return summary
+	}
+
+	settings := indexer.blockSettingsAt(height, indexer.BlockEventFilterRegistries)
+
+	if blockData.IndexBlockEvents {
+		if blockData.BlockEventRequestsFailed {
+			summary.Errors = append(summary.Errors, "the block results could not be fetched, the block events would not be indexed")
+		} else {
+			blockDBWrapper, err := indexer.dryRunBlockEvents(settings, block, blockData)
+			if err != nil {
+				summary.Errors = append(summary.Errors, err.Error())
+			} else {
+				summary.addBlockEvents(blockDBWrapper)
+			}
+		}
+	}
+
+	if blockData.IndexTransactions && blockData.TxRequestsFailed {
+		summary.Errors = append(summary.Errors, "the txs could not be fetched, the txs would not be indexed")
+	} else if blockData.IndexTransactions {
+		var txDBWrappers []dbTypes.TxDBWrapper
+		switch {
+		case blockData.GetTxsResponse != nil:
+			txDBWrappers, _, err = core.ProcessRPCTXs(settings.config, nil, indexer.ChainClient, settings.messageTypeFilters, indexer.Watchlist, blockData.GetTxsResponse, indexer.CustomMessageParserRegistry)
+		case blockData.BlockResultsData != nil:
+			txDBWrappers, block.FailedTxs, _, err = core.ProcessRPCBlockByHeightTXs(settings.config, nil, indexer.ChainClient, settings.messageTypeFilters, indexer.Watchlist, blockData.BlockData, blockData.BlockResultsData, indexer.CustomMessageParserRegistry)
+		}
+
+		if err != nil {
+			summary.Errors = append(summary.Errors, fmt.Sprintf("decoding the txs failed, the txs would not be indexed: %v", err))
+		} else {
+			summary.addTxs(txDBWrappers)
+			for _, failedTx := range block.FailedTxs {
+				summary.Warnings = append(summary.Warnings, fmt.Sprintf("tx %s could not be decoded: %s", failedTx.Hash, failedTx.Error))
+			}
+		}
+	}
+
+	return summary
+}
+
+// dryRunBlockEvents decodes and filters the block events of the block like ProcessBlocks does
+func (indexer *Indexer) dryRunBlockEvents(settings blockSettings, block models.Block, blockData core.IndexerBlockEventData) (*dbTypes.BlockDBWrapper, error) {
+	blockDBWrapper, err := core.ProcessRPCBlockResults(*settings.config, block, blockData.BlockResultsData, indexer.CustomBeginBlockEventParserRegistry, indexer.CustomEndBlockEventParserRegistry)
+	if err != nil {
+		return nil, fmt.Errorf("decoding the block events failed, the block events would not be indexed: %w", err)
+	}
+
+	filterRegistries := settings.blockEventFilterRegistries
+	if filterRegistries.BeginBlockEventFilterRegistry != nil && filterRegistries.BeginBlockEventFilterRegistry.NumFilters() > 0 {
+		blockDBWrapper.BeginBlockEvents, err = core.FilterRPCBlockEvents(blockDBWrapper.BeginBlockEvents, *filterRegistries.BeginBlockEventFilterRegistry)
+		if err != nil {
+			return nil, fmt.Errorf("filtering the begin block events failed, the block events would not be indexed: %w", err)
+		}
+	}
+	if filterRegistries.EndBlockEventFilterRegistry != nil && filterRegistries.EndBlockEventFilterRegistry.NumFilters() > 0 {
+		blockDBWrapper.EndBlockEvents, err = core.FilterRPCBlockEvents(blockDBWrapper.EndBlockEvents, *filterRegistries.EndBlockEventFilterRegistry)
+		if err != nil {
+			return nil, fmt.Errorf("filtering the end block events failed, the block events would not be indexed: %w", err)
+		}
+	}
+	return blockDBWrapper, nil
+}
+
+// addBlockEvents counts the block events by type and warns about the attributes that would be quarantined
+func (s *DryRunSummary) addBlockEvents(blockDBWrapper *dbTypes.BlockDBWrapper) {
+	for _, events := range [][]dbTypes.BlockEventDBWrapper{blockDBWrapper.BeginBlockEvents, blockDBWrapper.EndBlockEvents} {
+		for _, event := range events {
+			s.BlockEventTypes[event.BlockEvent.BlockEventType.Type]++
+		}
+	}
+
+	if quarantined := len(blockDBWrapper.QuarantinedAttributes); quarantined != 0 {
+		s.Warnings = append(s.Warnings, fmt.Sprintf("%d block event attributes could not be decoded and would be quarantined", quarantined))
+	}
+}
+
+// addTxs counts the txs, their messages and message events by type and collects the denoms of their fees
+func (s *DryRunSummary) addTxs(txDBWrappers []dbTypes.TxDBWrapper) {
+	feeDenoms := make(map[string]bool)
+	for _, denom := range s.FeeDenoms {
+		feeDenoms[denom] = true
+	}
+
+	for _, tx := range txDBWrappers {
+		s.Txs++
+		for _, message := range tx.Messages {
+			s.MessageTypes[message.Message.MessageType.MessageType]++
+			for _, event := range message.MessageEvents {
+				s.MessageEventTypes[event.MessageEvent.MessageEventType.Type]++
+			}
+		}
+		for _, fee := range tx.Tx.Fees {
+			feeDenoms[fee.Denomination.Base] = true
+		}
+		for _, failedMessage := range tx.FailedMessages {
+			s.Warnings = append(s.Warnings, fmt.Sprintf("message %d (%s) of tx %s could not be decoded: %s", failedMessage.MessageIndex, failedMessage.TypeURL, tx.Tx.Hash, failedMessage.Error))
+		}
+	}
+
+	s.FeeDenoms = s.FeeDenoms[:0]
+	for denom := range feeDenoms {
+		s.FeeDenoms = append(s.FeeDenoms, denom)
+	}
+	sort.Strings(s.FeeDenoms)
+}
@@ -0,0 +1,48 @@
+package indexer
+
+import (
+	"testing"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/stretchr/testify/suite"
+)
+
+type DryRunTestSuite struct {
+	suite.Suite
+}
+
+func (suite *DryRunTestSuite) TestSummary() {
+	_, txs := mockIndexedBlock(1)
+	txs[0].Tx.Fees = []models.Fee{{Denomination: models.Denom{Base: "uosmo"}}, {Denomination: models.Denom{Base: "uatom"}}}
+	txs[1].Tx.Fees = []models.Fee{{Denomination: models.Denom{Base: "uatom"}}}
+	txs[0].Messages[0].MessageEvents = []dbTypes.MessageEventDBWrapper{
+		{MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}}},
+		{MessageEvent: models.MessageEvent{MessageEventType: models.MessageEventType{Type: "transfer"}}},
+	}
+	txs[1].FailedMessages = []models.FailedMessage{{MessageIndex: 1, TypeURL: "/unknown.MsgFoo", Error: "unknown type"}}
+
+	summary := NewDryRunSummary(1)
+	summary.addTxs(txs)
+	summary.addBlockEvents(&dbTypes.BlockDBWrapper{
+		BeginBlockEvents:      []dbTypes.BlockEventDBWrapper{{BlockEvent: models.BlockEvent{BlockEventType: models.BlockEventType{Type: "mint"}}}},
+		EndBlockEvents:        []dbTypes.BlockEventDBWrapper{{BlockEvent: models.BlockEvent{BlockEventType: models.BlockEventType{Type: "mint"}}}},
+		QuarantinedAttributes: []models.QuarantinedAttribute{{}},
+	})
+
+	suite.Assert().Equal(2, summary.Txs)
+	suite.Assert().Equal(map[string]int{"/cosmos.bank.v1beta1.MsgSend": 1, "/cosmos.staking.v1beta1.MsgDelegate": 1}, summary.MessageTypes)
+	suite.Assert().Equal(map[string]int{"transfer": 2}, summary.MessageEventTypes)
+	suite.Assert().Equal(map[string]int{"mint": 2}, summary.BlockEventTypes)
+	suite.Assert().Equal([]string{"uatom", "uosmo"}, summary.FeeDenoms)
+	suite.Assert().Len(summary.Warnings, 2)
+	// Parts that could not be decoded but are stored aside do not fail the block
+	suite.Assert().False(summary.Failed())
+
+	summary.Errors = append(summary.Errors, "the txs could not be fetched, the txs would not be indexed")
+	suite.Assert().True(summary.Failed())
+}
+
+func TestDryRunSuite(t *testing.T) {
+	suite.Run(t, new(DryRunTestSuite))
+}
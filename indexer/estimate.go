@@ -0,0 +1,112 @@
+package indexer
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/core"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
+)
+
+// SampleBlocks fetches and parses each height the way the indexer would with the current config, range profiles, filters and custom parsers,
+// and measures what it would write. Nothing is written to the DB, not even failed blocks. Heights that fail to fetch or
+// parse are logged and returned as failed. The base.throttling delay is applied between heights.
+func (indexer *Indexer) SampleBlocks(heights []int64) ([]dbTypes.BlockSample, []int64, error) {
+	rpcClient := rpc.NewURIClient(indexer.ChainClient)
+
+	var samples []dbTypes.BlockSample
+	var failed []int64
+
+	for i, height := range heights {
+		if i > 0 && indexer.Config.Base.Throttling > 0 {
+			time.Sleep(time.Duration(indexer.Config.Base.Throttling * float64(time.Second)))
+		}
+
+		sample, err := indexer.sampleBlock(rpcClient, height)
+		if err != nil {
+			config.Log.Errorf("Failed to sample block %d, leaving it out of the estimate. Err: %v", height, err)
+			failed = append(failed, height)
+			continue
+		}
+
+		config.Log.Infof("Sampled block %d (%d of %d)", height, i+1, len(heights))
+		samples = append(samples, sample)
+	}
+
+	if len(samples) == 0 {
+		return nil, failed, fmt.Errorf("all %d sampled heights failed", len(heights))
+	}
+
+	return samples, failed, nil
+}
+
+func (indexer *Indexer) sampleBlock(rpcClient rpc.URIClient, height int64) (dbTypes.BlockSample, error) {
+	blockData, err := rpc.GetBlock(indexer.ChainClient, height)
+	if err != nil {
+		return nil, err
+	}
+
+	// The DB chain ID does not affect what the block writes, the chain may not have been indexed yet
+	block, err := core.ProcessBlock(blockData, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := indexer.blockSettingsAt(height, indexer.BlockEventFilterRegistries)
+
+	var blockDBWrapper *dbTypes.BlockDBWrapper
+	var txDBWrappers []dbTypes.TxDBWrapper
+	txsFromBlockResults := false
+
+	if settings.config.Base.TransactionIndexingEnabled {
+		txsEventResp, err := rpc.GetTxsByBlockHeight(indexer.ChainClient, height)
+		if err == nil {
+			txDBWrappers, _, err = core.ProcessRPCTXs(settings.config, indexer.DB, indexer.ChainClient, settings.messageTypeFilters, indexer.Watchlist, txsEventResp, indexer.CustomMessageParserRegistry)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			// Fall back to decoding the txs from the block results like the RPC workers do
+			txsFromBlockResults = true
+		}
+	}
+
+	if !settings.config.Base.BlockEventIndexingEnabled && !txsFromBlockResults {
+		return dbTypes.SampleBlockRows(nil, txDBWrappers), nil
+	}
+
+	blockResults, err := rpc.GetBlockResultWithRetry(rpcClient, height, indexer.Config.Base.RequestRetryAttempts, indexer.Config.Base.RequestRetryMaxWait)
+	if err != nil {
+		return nil, err
+	}
+
+	if txsFromBlockResults {
+		txDBWrappers, _, _, err = core.ProcessRPCBlockByHeightTXs(settings.config, indexer.DB, indexer.ChainClient, settings.messageTypeFilters, indexer.Watchlist, blockData, blockResults, indexer.CustomMessageParserRegistry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if settings.config.Base.BlockEventIndexingEnabled {
+		blockDBWrapper, err = core.ProcessRPCBlockResults(*settings.config, block, blockResults, indexer.CustomBeginBlockEventParserRegistry, indexer.CustomEndBlockEventParserRegistry)
+		if err != nil {
+			return nil, err
+		}
+
+		if registry := settings.blockEventFilterRegistries.BeginBlockEventFilterRegistry; registry != nil && registry.NumFilters() > 0 {
+			if blockDBWrapper.BeginBlockEvents, err = core.FilterRPCBlockEvents(blockDBWrapper.BeginBlockEvents, *registry); err != nil {
+				return nil, err
+			}
+		}
+
+		if registry := settings.blockEventFilterRegistries.EndBlockEventFilterRegistry; registry != nil && registry.NumFilters() > 0 {
+			if blockDBWrapper.EndBlockEvents, err = core.FilterRPCBlockEvents(blockDBWrapper.EndBlockEvents, *registry); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return dbTypes.SampleBlockRows(blockDBWrapper, txDBWrappers), nil
+}
@@ -0,0 +1,265 @@
+package indexer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
+	transfertypes "github.com/cosmos/ibc-go/v7/modules/apps/transfer/types"
+	"gorm.io/gorm"
+)
+
+// ibcDenomRetryInterval is how long a hash that could not be resolved waits before it is queried again
+const ibcDenomRetryInterval = time.Hour
+
+// ibcDenomResolveBatchSize is the number of hashes loaded from the database at once by a backfill
+const ibcDenomResolveBatchSize = 500
+
+// DenomTraceQuery returns the denom trace of the hash of an ibc/ denom of a chain, see rpc.GetDenomTrace
+type DenomTraceQuery func(ctx context.Context, hash string) (transfertypes.DenomTrace, error)
+
+// IBCDenomResolver resolves the ibc/ denoms of a chain to their denom traces and stores them in the IBCDenom table. The
+// rows of the hashes it has seen are cached, so the chain is queried once per hash. A hash that cannot be resolved, e.g.
+// when the node does not serve the transfer module, is stored with a retry marker and queried again once it is due.
+type IBCDenomResolver struct {
+	db            *gorm.DB
+	chainID       uint
+	query         DenomTraceQuery
+	retryInterval time.Duration
+	log           *config.Logger
+
+	mu     sync.Mutex
+	known  map[string]models.IBCDenom
+	queued map[string]struct{}
+	queue  chan []string
+}
+
+// NewIBCDenomResolver returns a resolver of the ibc/ denoms of the chain with the database ID chainID
+func NewIBCDenomResolver(db *gorm.DB, chainID uint, query DenomTraceQuery, retryInterval time.Duration, log *config.Logger) *IBCDenomResolver {
+	return &IBCDenomResolver{
+		db:            db,
+		chainID:       chainID,
+		query:         query,
+		retryInterval: retryInterval,
+		log:           log,
+		known:         make(map[string]models.IBCDenom),
+		queued:        make(map[string]struct{}),
+		queue:         make(chan []string, 100),
+	}
+}
+
+// due returns true if the hash is not resolved and is not waiting for a retry, must be called with the lock held
+func (r *IBCDenomResolver) due(hash string, now time.Time, ignoreRetryMarker bool) bool {
+	denom, ok := r.known[hash]
+	if !ok {
+		return true
+	}
+	if denom.Resolved {
+		return false
+	}
+	return ignoreRetryMarker || denom.NextAttemptAt == nil || !now.Before(*denom.NextAttemptAt)
+}
+
+// Resolve queries the denom traces of the hashes that are not resolved yet and stores them. Hashes that cannot be resolved
+// are recorded for a retry and do not fail the call, errors are returned for the database only. Returns the number of
+// hashes resolved and failed.
+func (r *IBCDenomResolver) Resolve(ctx context.Context, hashes []string) (int, int, error) {
+	return r.resolve(ctx, hashes, false)
+}
+
+func (r *IBCDenomResolver) resolve(ctx context.Context, hashes []string, ignoreRetryMarker bool) (int, int, error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	var unknown []string
+	for _, hash := range hashes {
+		if _, ok := r.known[hash]; !ok {
+			unknown = append(unknown, hash)
+		}
+	}
+	r.mu.Unlock()
+
+	stored, err := dbTypes.GetIBCDenoms(ctx, r.db, r.chainID, unknown)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	r.mu.Lock()
+	for hash, denom := range stored {
+		r.known[hash] = denom
+	}
+	var pending []string
+	seen := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		if _, ok := seen[hash]; ok || !r.due(hash, now, ignoreRetryMarker) {
+			continue
+		}
+		seen[hash] = struct{}{}
+		pending = append(pending, hash)
+	}
+	r.mu.Unlock()
+
+	var denoms []models.IBCDenom
+	failed := 0
+	for _, hash := range pending {
+		trace, queryErr := r.query(ctx, hash)
+		if queryErr != nil {
+			if ctx.Err() != nil {
+				return 0, failed, ctx.Err()
+			}
+
+			r.log.Warnf("Failed to resolve the denom trace of ibc/%s, retrying in %s. Err: %v", hash, r.retryInterval, queryErr)
+			nextAttempt := now.Add(r.retryInterval)
+			if err := dbTypes.RecordIBCDenomFailure(ctx, r.db, r.chainID, hash, queryErr, nextAttempt); err != nil {
+				return 0, failed, err
+			}
+
+			r.mu.Lock()
+			denom := r.known[hash]
+			denom.ChainID, denom.Hash = r.chainID, hash
+			denom.Attempts++
+			denom.LastError = queryErr.Error()
+			denom.NextAttemptAt = &nextAttempt
+			r.known[hash] = denom
+			r.mu.Unlock()
+
+			failed++
+			continue
+		}
+
+		denoms = append(denoms, models.IBCDenom{
+			ChainID:   r.chainID,
+			Hash:      hash,
+			Path:      trace.Path,
+			BaseDenom: trace.BaseDenom,
+			Resolved:  true,
+		})
+	}
+
+	if err := dbTypes.UpsertIBCDenoms(ctx, r.db, denoms); err != nil {
+		return 0, failed, err
+	}
+
+	r.mu.Lock()
+	for _, denom := range denoms {
+		r.known[denom.Hash] = denom
+	}
+	r.mu.Unlock()
+
+	return len(denoms), failed, nil
+}
+
+// Enqueue queues the hashes that are not resolved yet for Run without waiting for them. Hashes are dropped when the queue
+// is full, they are queued again the next time they are seen.
+func (r *IBCDenomResolver) Enqueue(hashes []string) {
+	now := time.Now()
+
+	r.mu.Lock()
+	var pending []string
+	for _, hash := range hashes {
+		if _, ok := r.queued[hash]; ok || !r.due(hash, now, false) {
+			continue
+		}
+		r.queued[hash] = struct{}{}
+		pending = append(pending, hash)
+	}
+	r.mu.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	select {
+	case r.queue <- pending:
+	default:
+		r.log.Debugf("IBC denom resolution queue is full, dropping %d hashes", len(pending))
+		r.dequeued(pending)
+	}
+}
+
+func (r *IBCDenomResolver) dequeued(hashes []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, hash := range hashes {
+		delete(r.queued, hash)
+	}
+}
+
+// Run resolves the queued hashes until the context is done. Database errors are logged, the hashes are retried the next
+// time they are seen.
+func (r *IBCDenomResolver) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case hashes := <-r.queue:
+			if _, _, err := r.Resolve(ctx, hashes); err != nil && ctx.Err() == nil {
+				r.log.Error("Failed to store IBC denom traces", err)
+			}
+			r.dequeued(hashes)
+		}
+	}
+}
+
+// Backfill resolves the ibc/ denoms the indexed fees of the chain were paid in, including the hashes waiting for a retry.
+// Returns the number of hashes resolved and failed.
+func (r *IBCDenomResolver) Backfill(ctx context.Context) (resolved int, failed int, err error) {
+	hashes, err := dbTypes.GetFeeIBCDenomHashes(ctx, r.db, r.chainID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for start := 0; start < len(hashes); start += ibcDenomResolveBatchSize {
+		end := start + ibcDenomResolveBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+
+		batchResolved, batchFailed, err := r.resolve(ctx, hashes[start:end], true)
+		resolved += batchResolved
+		failed += batchFailed
+		if err != nil {
+			return resolved, failed, err
+		}
+	}
+	return resolved, failed, nil
+}
+
+// NewIBCDenomResolver returns a resolver of the ibc/ denoms of the chain of the indexer, with the database ID chainID,
+// querying the chain client of the indexer
+func (indexer *Indexer) NewIBCDenomResolver(chainID uint) *IBCDenomResolver {
+	query := func(ctx context.Context, hash string) (transfertypes.DenomTrace, error) {
+		return rpc.GetDenomTrace(ctx, indexer.ChainClient, hash)
+	}
+	return NewIBCDenomResolver(indexer.DB, chainID, query, ibcDenomRetryInterval, indexer.log())
+}
+
+// ResolveIBCDenoms resolves the ibc/ denoms of the fees indexed from now on in the background until the context is done
+func (indexer *Indexer) ResolveIBCDenoms(ctx context.Context, chainID uint) {
+	indexer.ibcDenoms = indexer.NewIBCDenomResolver(chainID)
+	go indexer.ibcDenoms.Run(ctx)
+}
+
+// enqueueIBCDenoms queues the ibc/ denoms of the fees of the txs for resolution when ResolveIBCDenoms was called
+func (indexer *Indexer) enqueueIBCDenoms(txs []dbTypes.TxDBWrapper) {
+	if indexer.ibcDenoms == nil {
+		return
+	}
+
+	var hashes []string
+	for _, tx := range txs {
+		for _, fee := range tx.Tx.Fees {
+			if hash, ok := dbTypes.IBCDenomHash(fee.Denomination.Base); ok {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+
+	if len(hashes) != 0 {
+		indexer.ibcDenoms.Enqueue(hashes)
+	}
+}
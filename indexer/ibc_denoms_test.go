@@ -0,0 +1,97 @@
+//go:build cgo
+
+package indexer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	transfertypes "github.com/cosmos/ibc-go/v7/modules/apps/transfer/types"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type IBCDenomsTestSuite struct {
+	suite.Suite
+	db *gorm.DB
+}
+
+func (suite *IBCDenomsTestSuite) SetupTest() {
+	db, err := dbTypes.SqliteDbConnect(":memory:", "silent")
+	suite.Require().NoError(err)
+	suite.db = db
+	suite.Require().NoError(dbTypes.MigrateModels(suite.db))
+}
+
+func (suite *IBCDenomsTestSuite) TestResolve() {
+	ctx := context.Background()
+	chainID, err := dbTypes.GetDBChainID(ctx, suite.db, models.Chain{ChainID: "testchain-1", Name: "testchain"})
+	suite.Require().NoError(err)
+
+	queries := map[string]int{}
+	query := func(ctx context.Context, hash string) (transfertypes.DenomTrace, error) {
+		queries[hash]++
+		if hash == "PRUNED" {
+			return transfertypes.DenomTrace{}, errors.New("denomination trace not found")
+		}
+		return transfertypes.DenomTrace{Path: "transfer/channel-0", BaseDenom: "uatom"}, nil
+	}
+	resolver := NewIBCDenomResolver(suite.db, chainID, query, time.Hour, nil)
+
+	// A hash that cannot be resolved does not fail the others
+	resolved, failed, err := resolver.Resolve(ctx, []string{"ATOM", "PRUNED", "ATOM"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, resolved)
+	suite.Assert().Equal(1, failed)
+
+	denoms, err := dbTypes.GetIBCDenoms(ctx, suite.db, chainID, []string{"ATOM", "PRUNED"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal("transfer/channel-0/uatom", denoms["ATOM"].Denom())
+	suite.Assert().False(denoms["PRUNED"].Resolved)
+	suite.Assert().Equal(uint(1), denoms["PRUNED"].Attempts)
+
+	// Resolved hashes are cached and the failed hash waits for its retry
+	_, _, err = resolver.Resolve(ctx, []string{"ATOM", "PRUNED"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[string]int{"ATOM": 1, "PRUNED": 1}, queries)
+
+	// A new resolver loads the stored rows instead of querying them again
+	resolver = NewIBCDenomResolver(suite.db, chainID, query, time.Hour, nil)
+	_, _, err = resolver.Resolve(ctx, []string{"ATOM", "PRUNED"})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(map[string]int{"ATOM": 1, "PRUNED": 1}, queries)
+
+	// The backfill retries the failed hashes of the indexed fees right away
+	block := models.Block{Height: 1, ChainID: chainID}
+	suite.Require().NoError(suite.db.Omit("Chain", "ProposerConsAddress").Create(&block).Error)
+	tx := models.Tx{Hash: "tx", BlockID: block.ID}
+	suite.Require().NoError(suite.db.Omit("Block", "SignerAddresses", "Fees").Create(&tx).Error)
+	denom := models.Denom{Base: "ibc/pruned"}
+	suite.Require().NoError(suite.db.Create(&denom).Error)
+	suite.Require().NoError(suite.db.Omit("Denomination", "PayerAddress", "GranterAddress").Create(&models.Fee{TxID: tx.ID, DenominationID: denom.ID}).Error)
+
+	resolved, failed, err = resolver.Backfill(ctx)
+	suite.Require().NoError(err)
+	suite.Assert().Zero(resolved)
+	suite.Assert().Equal(1, failed)
+	suite.Assert().Equal(2, queries["PRUNED"])
+}
+
+func (suite *IBCDenomsTestSuite) TestEnqueue() {
+	resolver := NewIBCDenomResolver(suite.db, 1, nil, time.Hour, nil)
+
+	// Queued hashes are not queued again until they were resolved
+	resolver.Enqueue([]string{"ATOM", "ATOM"})
+	resolver.Enqueue([]string{"ATOM", "OSMO"})
+	suite.Require().Len(resolver.queue, 2)
+	suite.Assert().Equal([]string{"ATOM"}, <-resolver.queue)
+	suite.Assert().Equal([]string{"OSMO"}, <-resolver.queue)
+}
+
+func TestIBCDenomsSuite(t *testing.T) {
+	suite.Run(t, new(IBCDenomsTestSuite))
+}
@@ -1,100 +1,129 @@
 package indexer
 
 import (
+	"context"
+	"fmt"
 	"sync"
 
-	"github.com/DefiantLabs/cosmos-indexer/config"
 	"github.com/DefiantLabs/cosmos-indexer/core"
 	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // This function is responsible for processing raw RPC data into app-usable types. It handles both block events and transactions.
 // It parses each dataset according to the application configuration requirements and passes the data to the channels that handle the parsed data.
-func (indexer *Indexer) ProcessBlocks(wg *sync.WaitGroup, failedBlockHandler core.FailedBlockHandler, blockRPCWorkerChan chan core.IndexerBlockEventData, blockEventsDataChan chan *BlockEventsDBData, txDataChan chan *DBData, chainID uint, blockEventFilterRegistry BlockEventFilterRegistries) {
+func (indexer *Indexer) ProcessBlocks(ctx context.Context, wg *sync.WaitGroup, failedBlockHandler core.FailedBlockHandler, blockRPCWorkerChan chan core.IndexerBlockEventData, blockEventsDataChan chan *BlockEventsDBData, txDataChan chan *DBData, chainID uint, blockEventFilterRegistry BlockEventFilterRegistries) {
 	defer close(blockEventsDataChan)
 	defer close(txDataChan)
 	defer wg.Done()
 
 	for blockData := range blockRPCWorkerChan {
 		currentHeight := blockData.BlockData.Block.Height
-		config.Log.Infof("Parsing data for block %d", currentHeight)
+		indexer.log().Infof("Parsing data for block %d", currentHeight)
+		blockCtx := tracing.ContextWithBlock(ctx, blockData.Trace)
+		blockAttrs := []attribute.KeyValue{tracing.ChainID.String(indexer.Config.Probe.ChainID), tracing.Height.Int64(currentHeight)}
 
-		block, err := core.ProcessBlock(blockData.BlockData, blockData.BlockResultsData, chainID)
+		_, span := tracing.Start(blockCtx, "process_block", blockAttrs...)
+		block, err := core.ProcessChainBlock(blockData.BlockData, blockData.BlockResultsData, chainID, indexer.Config.Probe.AccountPrefix)
+		tracing.End(span, err)
 		if err != nil {
-			config.Log.Error("ProcessBlock: unhandled error", err)
+			indexer.log().Error("ProcessBlock: unhandled error", err)
 			failedBlockHandler(currentHeight, core.UnprocessableTxError, err)
-			err := dbTypes.UpsertFailedBlock(indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName)
-			if err != nil {
-				config.Log.Fatal("Failed to insert failed block", err)
+			dbErr := dbTypes.UpsertFailedBlock(ctx, indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName, dbTypes.StageProcess, err)
+			if dbErr != nil {
+				indexer.log().Fatal("Failed to insert failed block", dbErr)
 			}
+			indexer.pending.Done(currentHeight)
 			continue
 		}
 
+		settings := indexer.blockSettingsAt(currentHeight, blockEventFilterRegistry)
+		block.IndexProfile = settings.profile
+
 		if blockData.IndexBlockEvents && !blockData.BlockEventRequestsFailed {
-			config.Log.Info("Parsing block events")
-			blockDBWrapper, err := core.ProcessRPCBlockResults(*indexer.Config, block, blockData.BlockResultsData, indexer.CustomBeginBlockEventParserRegistry, indexer.CustomEndBlockEventParserRegistry)
+			indexer.log().Info("Parsing block events")
+			_, span := tracing.Start(blockCtx, "decode_block_events", blockAttrs...)
+			blockDBWrapper, err := core.ProcessRPCBlockResults(*settings.config, block, blockData.BlockResultsData, indexer.CustomBeginBlockEventParserRegistry, indexer.CustomEndBlockEventParserRegistry)
+			if err == nil {
+				span.SetAttributes(tracing.EventCount.Int(len(blockDBWrapper.BeginBlockEvents) + len(blockDBWrapper.EndBlockEvents)))
+			}
+			tracing.End(span, err)
 			if err != nil {
-				config.Log.Errorf("Failed to process block events during block %d event processing, adding to failed block events table", currentHeight)
+				indexer.log().Errorf("Failed to process block events during block %d event processing, adding to failed block events table", currentHeight)
 				failedBlockHandler(currentHeight, core.FailedBlockEventHandling, err)
-				err := dbTypes.UpsertFailedEventBlock(indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName)
-				if err != nil {
-					config.Log.Fatal("Failed to insert failed block event", err)
+				dbErr := dbTypes.UpsertFailedEventBlock(ctx, indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName, dbTypes.StageProcess, err)
+				if dbErr != nil {
+					indexer.log().Fatal("Failed to insert failed block event", dbErr)
 				}
 			} else {
-				config.Log.Infof("Finished parsing block event data for block %d", currentHeight)
+				indexer.log().Infof("Finished parsing block event data for block %d", currentHeight)
 
 				var beginBlockFilterError error
 				var endBlockFilterError error
-				if blockEventFilterRegistry.BeginBlockEventFilterRegistry != nil && blockEventFilterRegistry.BeginBlockEventFilterRegistry.NumFilters() > 0 {
-					blockDBWrapper.BeginBlockEvents, beginBlockFilterError = core.FilterRPCBlockEvents(blockDBWrapper.BeginBlockEvents, *blockEventFilterRegistry.BeginBlockEventFilterRegistry)
+				filterRegistries := settings.blockEventFilterRegistries
+				if filterRegistries.BeginBlockEventFilterRegistry != nil && filterRegistries.BeginBlockEventFilterRegistry.NumFilters() > 0 {
+					blockDBWrapper.BeginBlockEvents, beginBlockFilterError = core.FilterRPCBlockEvents(blockDBWrapper.BeginBlockEvents, *filterRegistries.BeginBlockEventFilterRegistry)
 				}
 
-				if blockEventFilterRegistry.EndBlockEventFilterRegistry != nil && blockEventFilterRegistry.EndBlockEventFilterRegistry.NumFilters() > 0 {
-					blockDBWrapper.EndBlockEvents, endBlockFilterError = core.FilterRPCBlockEvents(blockDBWrapper.EndBlockEvents, *blockEventFilterRegistry.EndBlockEventFilterRegistry)
+				if filterRegistries.EndBlockEventFilterRegistry != nil && filterRegistries.EndBlockEventFilterRegistry.NumFilters() > 0 {
+					blockDBWrapper.EndBlockEvents, endBlockFilterError = core.FilterRPCBlockEvents(blockDBWrapper.EndBlockEvents, *filterRegistries.EndBlockEventFilterRegistry)
 				}
 
 				if beginBlockFilterError == nil && endBlockFilterError == nil {
+					indexer.pending.Add(currentHeight)
 					blockEventsDataChan <- &BlockEventsDBData{
 						blockDBWrapper: blockDBWrapper,
+						trace:          blockData.Trace,
 					}
 				} else {
-					config.Log.Errorf("Failed to filter block events during block %d event processing, adding to failed block events table. Begin blocker filter error %s. End blocker filter error %s", currentHeight, beginBlockFilterError, endBlockFilterError)
-					failedBlockHandler(currentHeight, core.FailedBlockEventHandling, err)
-					err := dbTypes.UpsertFailedEventBlock(indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName)
+					indexer.log().Errorf("Failed to filter block events during block %d event processing, adding to failed block events table. Begin blocker filter error %s. End blocker filter error %s", currentHeight, beginBlockFilterError, endBlockFilterError)
+					filterErr := fmt.Errorf("filtering block events failed, begin blocker filter error: %v, end blocker filter error: %v", beginBlockFilterError, endBlockFilterError)
+					failedBlockHandler(currentHeight, core.FailedBlockEventHandling, filterErr)
+					err := dbTypes.UpsertFailedEventBlock(ctx, indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName, dbTypes.StageFilter, filterErr)
 					if err != nil {
-						config.Log.Fatal("Failed to insert failed block event", err)
+						indexer.log().Fatal("Failed to insert failed block event", err)
 					}
 				}
 			}
 		}
 
 		if blockData.IndexTransactions && !blockData.TxRequestsFailed {
-			config.Log.Info("Parsing transactions")
+			indexer.log().Info("Parsing transactions")
 			var txDBWrappers []dbTypes.TxDBWrapper
 			var err error
+			_, span := tracing.Start(blockCtx, "decode_txs", blockAttrs...)
 
 			if blockData.GetTxsResponse != nil {
-				config.Log.Debug("Processing TXs from RPC TX Search response")
-				txDBWrappers, _, err = core.ProcessRPCTXs(indexer.Config, indexer.DB, indexer.ChainClient, indexer.MessageTypeFilters, blockData.GetTxsResponse, indexer.CustomMessageParserRegistry)
+				indexer.log().Debug("Processing TXs from RPC TX Search response")
+				txDBWrappers, _, err = core.ProcessRPCTXs(settings.config, indexer.DB, indexer.ChainClient, settings.messageTypeFilters, indexer.Watchlist, blockData.GetTxsResponse, indexer.CustomMessageParserRegistry)
 			} else if blockData.BlockResultsData != nil {
-				config.Log.Debug("Processing TXs from BlockResults search response")
-				txDBWrappers, _, err = core.ProcessRPCBlockByHeightTXs(indexer.Config, indexer.DB, indexer.ChainClient, indexer.MessageTypeFilters, blockData.BlockData, blockData.BlockResultsData, indexer.CustomMessageParserRegistry)
+				indexer.log().Debug("Processing TXs from BlockResults search response")
+				// Txs that cannot be decoded are stored with the block, which is indexed without them
+				txDBWrappers, block.FailedTxs, _, err = core.ProcessRPCBlockByHeightTXs(settings.config, indexer.DB, indexer.ChainClient, settings.messageTypeFilters, indexer.Watchlist, blockData.BlockData, blockData.BlockResultsData, indexer.CustomMessageParserRegistry)
 			}
+			span.SetAttributes(tracing.TxCount.Int(len(txDBWrappers)))
+			tracing.End(span, err)
 
 			if err != nil {
-				config.Log.Error("ProcessRpcTxs: unhandled error", err)
+				indexer.log().Error("ProcessRpcTxs: unhandled error", err)
 				failedBlockHandler(currentHeight, core.UnprocessableTxError, err)
-				err := dbTypes.UpsertFailedBlock(indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName)
-				if err != nil {
-					config.Log.Fatal("Failed to insert failed block", err)
+				dbErr := dbTypes.UpsertFailedBlock(ctx, indexer.DB, currentHeight, indexer.Config.Probe.ChainID, indexer.Config.Probe.ChainName, dbTypes.StageProcess, err)
+				if dbErr != nil {
+					indexer.log().Fatal("Failed to insert failed block", dbErr)
 				}
 			} else {
+				indexer.pending.Add(currentHeight)
 				txDataChan <- &DBData{
 					txDBWrappers: txDBWrappers,
 					block:        block,
+					trace:        blockData.Trace,
 				}
 			}
 
 		}
+
+		// The datasets passed on hold the height until they are written
+		indexer.pending.Done(currentHeight)
 	}
 }
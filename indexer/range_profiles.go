@@ -0,0 +1,46 @@
+package indexer
+
+import (
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/filter"
+)
+
+// RangeProfileFilters are the filters loaded from the filter file of a range profile
+type RangeProfileFilters struct {
+	MessageTypeFilters         []filter.MessageTypeFilter
+	BlockEventFilterRegistries BlockEventFilterRegistries
+}
+
+// blockSettings are the config and filters a block is indexed with
+type blockSettings struct {
+	profile                    string // Empty when the height has no range profile
+	config                     *config.IndexConfig
+	messageTypeFilters         []filter.MessageTypeFilter
+	blockEventFilterRegistries BlockEventFilterRegistries
+}
+
+// blockSettingsAt returns the settings of the range profile configured for the height. Heights without a profile, and
+// profiles without a filter file, use the indexer config and the passed in block event filters.
+func (indexer *Indexer) blockSettingsAt(height int64, blockEventFilterRegistries BlockEventFilterRegistries) blockSettings {
+	settings := blockSettings{
+		config:                     indexer.Config,
+		messageTypeFilters:         indexer.MessageTypeFilters,
+		blockEventFilterRegistries: blockEventFilterRegistries,
+	}
+
+	profile, ok := indexer.RangeProfiles.ProfileAt(height)
+	if !ok {
+		return settings
+	}
+
+	profileConfig := profile.Apply(*indexer.Config)
+	settings.profile = profile.Name
+	settings.config = &profileConfig
+
+	if filters, ok := indexer.RangeProfileFilters[profile.Name]; ok {
+		settings.messageTypeFilters = filters.MessageTypeFilters
+		settings.blockEventFilterRegistries = filters.BlockEventFilterRegistries
+	}
+
+	return settings
+}
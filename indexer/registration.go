@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
 	"github.com/DefiantLabs/cosmos-indexer/db/models"
 	"github.com/DefiantLabs/cosmos-indexer/filter"
 	"github.com/DefiantLabs/cosmos-indexer/parsers"
@@ -22,6 +23,16 @@ func (indexer *Indexer) RegisterCustomModels(models []any) {
 	indexer.CustomModels = append(indexer.CustomModels, models...)
 }
 
+func (indexer *Indexer) RegisterBackfillJob(job dbTypes.BackfillJob) {
+	for _, existing := range append(dbTypes.BuiltinBackfillJobs(), indexer.BackfillJobs...) {
+		if existing.Name() == job.Name() {
+			config.Log.Fatalf("Found duplicate backfill job with name \"%s\", backfill jobs must be uniquely named", job.Name())
+		}
+	}
+
+	indexer.BackfillJobs = append(indexer.BackfillJobs, job)
+}
+
 func (indexer *Indexer) RegisterCustomBeginBlockEventParser(eventKey string, parser parsers.BlockEventParser) {
 	var err error
 	indexer.CustomBeginBlockEventParserRegistry, indexer.CustomBeginBlockParserTrackers, err = customBlockEventRegistration(
@@ -0,0 +1,63 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+)
+
+// retentionThreshold returns the blocks outside the retention policy at now, given the highest block height of the chain:
+// the blocks more than retainBlocks below it, or older than retainDays. ok is false when the policy keeps every block.
+func retentionThreshold(highest int64, retainBlocks int64, retainDays int64, now time.Time) (threshold dbTypes.PruneThreshold, ok bool) {
+	switch {
+	case retainBlocks > 0:
+		threshold.Height = highest - retainBlocks + 1
+		return threshold, threshold.Height > 1
+	case retainDays > 0:
+		threshold.Time = now.AddDate(0, 0, -int(retainDays))
+		return threshold, true
+	}
+	return threshold, false
+}
+
+// PruneRetention prunes the blocks of the chain outside the retention policy of the config, see retention.blocks and
+// retention.days. Returns the number of blocks pruned.
+func (indexer *Indexer) PruneRetention(ctx context.Context, chain dbTypes.ChainRef) (int64, error) {
+	highest, err := dbTypes.GetSnapshotHeight(ctx, indexer.DB, chain)
+	if err != nil {
+		return 0, err
+	}
+
+	retention := indexer.Config.Retention
+	threshold, ok := retentionThreshold(highest, retention.Blocks, retention.Days, time.Now())
+	if !ok {
+		return 0, nil
+	}
+
+	return dbTypes.PruneBefore(ctx, indexer.DB, chain, threshold, int(retention.ChunkSize))
+}
+
+// PruneRetentionPeriodically prunes the blocks outside the retention policy right away and then on an interval, so the
+// database only keeps recent history. Prune failures are logged and retried on the next interval. Pruning stops when ctx
+// is cancelled.
+func (indexer *Indexer) PruneRetentionPeriodically(ctx context.Context, chain dbTypes.ChainRef, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := indexer.PruneRetention(ctx, chain)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			indexer.log().Error("Error pruning blocks outside the retention policy", err)
+		case pruned != 0:
+			indexer.log().Infof("Pruned %d blocks outside the retention policy", pruned)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
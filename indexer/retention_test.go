@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RetentionTestSuite struct {
+	suite.Suite
+}
+
+func (suite *RetentionTestSuite) TestRetentionThreshold() {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	// The most recent 100 blocks are kept
+	threshold, ok := retentionThreshold(1000, 100, 0, now)
+	suite.Require().True(ok)
+	suite.Assert().Equal(int64(901), threshold.Height)
+	suite.Assert().True(threshold.Time.IsZero())
+
+	// Fewer blocks than retained
+	_, ok = retentionThreshold(100, 100, 0, now)
+	suite.Assert().False(ok)
+
+	threshold, ok = retentionThreshold(1000, 0, 7, now)
+	suite.Require().True(ok)
+	suite.Assert().Zero(threshold.Height)
+	suite.Assert().Equal(time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC), threshold.Time)
+
+	_, ok = retentionThreshold(1000, 0, 0, now)
+	suite.Assert().False(ok)
+}
+
+func TestRetentionSuite(t *testing.T) {
+	suite.Run(t, new(RetentionTestSuite))
+}
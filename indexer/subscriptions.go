@@ -0,0 +1,374 @@
+package indexer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+)
+
+// DefaultSubscriptionBufferSize is the channel buffer size used for subscriptions that do not set one
+const DefaultSubscriptionBufferSize = 100
+
+// DeliveryPolicy controls what happens when a subscriber's channel buffer is full.
+type DeliveryPolicy int
+
+const (
+	// DeliveryPolicyDrop drops the notification for that subscriber when its buffer is full. Indexing is never slowed down by a slow consumer.
+	// Dropped notifications are counted and can be read with Subscriptions.Dropped.
+	DeliveryPolicyDrop DeliveryPolicy = iota
+	// DeliveryPolicyBlock waits for the subscriber to make room in its buffer. A slow consumer will slow down DB writes for the whole indexer.
+	DeliveryPolicyBlock
+)
+
+// BlockDataset identifies which part of a block was committed to the DB
+type BlockDataset int
+
+const (
+	BlockDatasetTxs BlockDataset = iota
+	BlockDatasetBlockEvents
+)
+
+// String returns the name of the dataset, txs or block_events like the dataset label of the metrics
+func (d BlockDataset) String() string {
+	if d == BlockDatasetBlockEvents {
+		return "block_events"
+	}
+	return "txs"
+}
+
+// IndexedBlockNotification is sent to block subscribers after block data has been committed to the DB.
+// The IDs are DB primary keys and can be used with the DB read helpers to fetch details.
+type IndexedBlockNotification struct {
+	ChainID   string
+	BlockID   uint
+	Height    int64
+	BlockHash string
+	TimeStamp time.Time
+	Dataset   BlockDataset
+	TxIDs     []uint // Only set for BlockDatasetTxs notifications
+	// Txs are the notifications of the txs of the block, only set for BlockDatasetTxs notifications. The slice is shared by
+	// the subscribers and must not be modified.
+	Txs []IndexedTxNotification
+}
+
+// IndexedTxNotification is sent to tx subscribers after a tx matching their filter has been committed to the DB.
+type IndexedTxNotification struct {
+	ChainID          string
+	BlockID          uint
+	Height           int64
+	TxID             uint
+	Hash             string
+	Code             uint32
+	MessageIDs       []uint
+	MessageTypes     []string
+	SignerAddresses  []string
+	WatchedAddresses []string // Watched addresses involved in the tx, with watchlist.enabled
+}
+
+// TxSubscriptionFilter restricts which txs are delivered to a tx subscription. Empty fields match everything.
+type TxSubscriptionFilter struct {
+	MessageTypes []string // The tx must contain at least one message of one of these types
+	Address      string   // The tx must be signed by this address
+}
+
+// SubscriptionOption configures a single subscription
+type SubscriptionOption func(*subscriptionOptions)
+
+type subscriptionOptions struct {
+	bufferSize int
+	policy     DeliveryPolicy
+	onDrop     func(chainID string)
+}
+
+// WithBufferSize sets the channel buffer size of the subscription
+func WithBufferSize(size int) SubscriptionOption {
+	return func(opts *subscriptionOptions) {
+		opts.bufferSize = size
+	}
+}
+
+// WithDeliveryPolicy sets the policy used when the subscription buffer is full
+func WithDeliveryPolicy(policy DeliveryPolicy) SubscriptionOption {
+	return func(opts *subscriptionOptions) {
+		opts.policy = policy
+	}
+}
+
+// WithOnDrop sets a func called with the chain ID of every notification dropped for the subscription. It is called while
+// the block is published and must not block.
+func WithOnDrop(onDrop func(chainID string)) SubscriptionOption {
+	return func(opts *subscriptionOptions) {
+		opts.onDrop = onDrop
+	}
+}
+
+type subscription struct {
+	chainID    string
+	policy     DeliveryPolicy
+	onDrop     func(chainID string)
+	blocks     chan IndexedBlockNotification
+	txs        chan IndexedTxNotification
+	txFilter   TxSubscriptionFilter
+	msgTypes   map[string]struct{}
+	done       chan struct{}
+	cancelOnce sync.Once
+}
+
+// Subscriptions delivers notifications of indexed data to in-process subscribers.
+// The zero value is ready to use.
+type Subscriptions struct {
+	mu      sync.RWMutex
+	nextID  uint64
+	subs    map[uint64]*subscription
+	dropped uint64
+}
+
+// Dropped returns the number of notifications dropped across all DeliveryPolicyDrop subscriptions
+func (s *Subscriptions) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// SubscribeBlocks returns a channel receiving a notification for every block committed for the chain, and a cancel func that closes it.
+// An empty chainID subscribes to all chains. Every block committed after SubscribeBlocks returns is delivered (subject to the delivery policy).
+func (s *Subscriptions) SubscribeBlocks(chainID string, opts ...SubscriptionOption) (<-chan IndexedBlockNotification, func()) {
+	options := buildSubscriptionOptions(opts)
+	sub := &subscription{
+		chainID: chainID,
+		policy:  options.policy,
+		onDrop:  options.onDrop,
+		blocks:  make(chan IndexedBlockNotification, options.bufferSize),
+	}
+
+	return sub.blocks, s.add(sub)
+}
+
+// SubscribeTxs returns a channel receiving a notification for every committed tx matching the filter, and a cancel func that closes it.
+// An empty chainID subscribes to all chains. Every tx committed after SubscribeTxs returns is delivered (subject to the delivery policy).
+func (s *Subscriptions) SubscribeTxs(chainID string, txFilter TxSubscriptionFilter, opts ...SubscriptionOption) (<-chan IndexedTxNotification, func()) {
+	options := buildSubscriptionOptions(opts)
+	sub := &subscription{
+		chainID:  chainID,
+		policy:   options.policy,
+		onDrop:   options.onDrop,
+		txs:      make(chan IndexedTxNotification, options.bufferSize),
+		txFilter: txFilter,
+	}
+
+	if len(txFilter.MessageTypes) != 0 {
+		sub.msgTypes = make(map[string]struct{}, len(txFilter.MessageTypes))
+		for _, msgType := range txFilter.MessageTypes {
+			sub.msgTypes[msgType] = struct{}{}
+		}
+	}
+
+	return sub.txs, s.add(sub)
+}
+
+// SubscribeBlocks subscribes to blocks committed to the DB by this indexer. See Subscriptions.SubscribeBlocks.
+func (indexer *Indexer) SubscribeBlocks(chainID string, opts ...SubscriptionOption) (<-chan IndexedBlockNotification, func()) {
+	return indexer.root().subscriptions.SubscribeBlocks(chainID, opts...)
+}
+
+// SubscribeTxs subscribes to txs committed to the DB by this indexer. See Subscriptions.SubscribeTxs.
+func (indexer *Indexer) SubscribeTxs(chainID string, txFilter TxSubscriptionFilter, opts ...SubscriptionOption) (<-chan IndexedTxNotification, func()) {
+	return indexer.root().subscriptions.SubscribeTxs(chainID, txFilter, opts...)
+}
+
+// DroppedNotifications returns the number of notifications dropped for slow subscribers
+func (indexer *Indexer) DroppedNotifications() uint64 {
+	return indexer.root().subscriptions.Dropped()
+}
+
+func buildSubscriptionOptions(opts []SubscriptionOption) subscriptionOptions {
+	options := subscriptionOptions{
+		bufferSize: DefaultSubscriptionBufferSize,
+		policy:     DeliveryPolicyDrop,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if options.bufferSize < 0 {
+		options.bufferSize = 0
+	}
+
+	return options
+}
+
+// add registers the subscription under the write lock. Since publishing happens under the read lock after the DB commit,
+// any block committed after add returns is guaranteed to see the subscription.
+func (s *Subscriptions) add(sub *subscription) func() {
+	sub.done = make(chan struct{})
+
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[uint64]*subscription)
+	}
+	id := s.nextID
+	s.nextID++
+	s.subs[id] = sub
+	s.mu.Unlock()
+
+	return func() {
+		sub.cancelOnce.Do(func() {
+			// Unblock any publisher waiting on this subscriber before taking the write lock
+			close(sub.done)
+
+			s.mu.Lock()
+			delete(s.subs, id)
+			s.mu.Unlock()
+
+			// No publisher can hold a reference to the subscription anymore, closing is safe
+			if sub.blocks != nil {
+				close(sub.blocks)
+			}
+			if sub.txs != nil {
+				close(sub.txs)
+			}
+		})
+	}
+}
+
+// publishBlock delivers notifications for a block (and its txs) that has been committed to the DB
+func (s *Subscriptions) publishBlock(chainID string, dataset BlockDataset, block models.Block, txs []dbTypes.TxDBWrapper) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.subs) == 0 {
+		return
+	}
+
+	blockNotification := IndexedBlockNotification{
+		ChainID:   chainID,
+		BlockID:   block.ID,
+		Height:    block.Height,
+		BlockHash: block.BlockHash,
+		TimeStamp: block.TimeStamp,
+		Dataset:   dataset,
+	}
+
+	var txNotifications []IndexedTxNotification
+	if dataset == BlockDatasetTxs {
+		blockNotification.TxIDs = make([]uint, len(txs))
+		txNotifications = make([]IndexedTxNotification, len(txs))
+		for i, tx := range txs {
+			blockNotification.TxIDs[i] = tx.Tx.ID
+			txNotifications[i] = buildTxNotification(chainID, block, tx)
+		}
+		blockNotification.Txs = txNotifications
+	}
+
+	for _, sub := range s.subs {
+		if sub.chainID != "" && sub.chainID != chainID {
+			continue
+		}
+
+		if sub.blocks != nil {
+			s.deliverBlock(sub, blockNotification)
+			continue
+		}
+
+		for _, txNotification := range txNotifications {
+			if sub.matchesTx(txNotification) {
+				s.deliverTx(sub, txNotification)
+			}
+		}
+	}
+}
+
+func buildTxNotification(chainID string, block models.Block, tx dbTypes.TxDBWrapper) IndexedTxNotification {
+	notification := IndexedTxNotification{
+		ChainID:          chainID,
+		BlockID:          block.ID,
+		Height:           block.Height,
+		TxID:             tx.Tx.ID,
+		Hash:             tx.Tx.Hash,
+		Code:             tx.Tx.Code,
+		MessageIDs:       make([]uint, len(tx.Messages)),
+		MessageTypes:     make([]string, len(tx.Messages)),
+		SignerAddresses:  make([]string, len(tx.Tx.SignerAddresses)),
+		WatchedAddresses: tx.WatchedAddresses,
+	}
+
+	for i, message := range tx.Messages {
+		notification.MessageIDs[i] = message.Message.ID
+		notification.MessageTypes[i] = message.Message.MessageType.MessageType
+	}
+
+	for i, address := range tx.Tx.SignerAddresses {
+		notification.SignerAddresses[i] = address.Address
+	}
+
+	return notification
+}
+
+func (sub *subscription) matchesTx(notification IndexedTxNotification) bool {
+	if sub.txFilter.Address != "" {
+		found := false
+		for _, address := range notification.SignerAddresses {
+			if address == sub.txFilter.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(sub.msgTypes) != 0 {
+		for _, msgType := range notification.MessageTypes {
+			if _, ok := sub.msgTypes[msgType]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+func (s *Subscriptions) deliverBlock(sub *subscription, notification IndexedBlockNotification) {
+	if sub.policy == DeliveryPolicyBlock {
+		select {
+		case sub.blocks <- notification:
+		case <-sub.done:
+		}
+		return
+	}
+
+	select {
+	case sub.blocks <- notification:
+	case <-sub.done:
+	default:
+		s.drop(sub, notification.ChainID)
+	}
+}
+
+func (s *Subscriptions) deliverTx(sub *subscription, notification IndexedTxNotification) {
+	if sub.policy == DeliveryPolicyBlock {
+		select {
+		case sub.txs <- notification:
+		case <-sub.done:
+		}
+		return
+	}
+
+	select {
+	case sub.txs <- notification:
+	case <-sub.done:
+	default:
+		s.drop(sub, notification.ChainID)
+	}
+}
+
+func (s *Subscriptions) drop(sub *subscription, chainID string) {
+	atomic.AddUint64(&s.dropped, 1)
+	if sub.onDrop != nil {
+		sub.onDrop(chainID)
+	}
+}
@@ -0,0 +1,135 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/stretchr/testify/suite"
+)
+
+type SubscriptionsTestSuite struct {
+	suite.Suite
+}
+
+func mockIndexedBlock(height int64) (models.Block, []dbTypes.TxDBWrapper) {
+	block := models.Block{ID: uint(height), Height: height, TimeStamp: time.Now(), BlockHash: "BLOCKHASH"}
+	txs := []dbTypes.TxDBWrapper{
+		{
+			Tx:               models.Tx{ID: 1, Hash: "hash1", SignerAddresses: []models.Address{{Address: "addr1"}}},
+			WatchedAddresses: []string{"addr1"},
+			Messages: []dbTypes.MessageDBWrapper{
+				{Message: models.Message{ID: 10, MessageType: models.MessageType{MessageType: "/cosmos.bank.v1beta1.MsgSend"}}},
+			},
+		},
+		{
+			Tx: models.Tx{ID: 2, Hash: "hash2", SignerAddresses: []models.Address{{Address: "addr2"}}},
+			Messages: []dbTypes.MessageDBWrapper{
+				{Message: models.Message{ID: 11, MessageType: models.MessageType{MessageType: "/cosmos.staking.v1beta1.MsgDelegate"}}},
+			},
+		},
+	}
+	return block, txs
+}
+
+func (suite *SubscriptionsTestSuite) TestSubscribeBlocks() {
+	var subs Subscriptions
+
+	blocks, cancel := subs.SubscribeBlocks("testchain-1")
+	otherChainBlocks, cancelOther := subs.SubscribeBlocks("otherchain-1")
+	defer cancelOther()
+
+	block, txs := mockIndexedBlock(1)
+	subs.publishBlock("testchain-1", BlockDatasetTxs, block, txs)
+
+	notification := <-blocks
+	suite.Assert().Equal(block.ID, notification.BlockID)
+	suite.Assert().Equal(block.Height, notification.Height)
+	suite.Assert().Equal([]uint{1, 2}, notification.TxIDs)
+	suite.Assert().Equal("BLOCKHASH", notification.BlockHash)
+	suite.Assert().Equal("txs", notification.Dataset.String())
+	suite.Require().Len(notification.Txs, 2)
+	suite.Assert().Equal("hash2", notification.Txs[1].Hash)
+	suite.Assert().Equal([]string{"/cosmos.staking.v1beta1.MsgDelegate"}, notification.Txs[1].MessageTypes)
+	suite.Assert().Len(otherChainBlocks, 0)
+
+	cancel()
+	_, ok := <-blocks
+	suite.Assert().False(ok)
+
+	// Cancel is idempotent and publishing after cancel must not panic
+	cancel()
+	subs.publishBlock("testchain-1", BlockDatasetTxs, block, txs)
+}
+
+func (suite *SubscriptionsTestSuite) TestSubscribeTxsFilter() {
+	var subs Subscriptions
+
+	byType, cancelByType := subs.SubscribeTxs("", TxSubscriptionFilter{MessageTypes: []string{"/cosmos.staking.v1beta1.MsgDelegate"}})
+	defer cancelByType()
+	byAddress, cancelByAddress := subs.SubscribeTxs("", TxSubscriptionFilter{Address: "addr1"})
+	defer cancelByAddress()
+
+	block, txs := mockIndexedBlock(1)
+	subs.publishBlock("testchain-1", BlockDatasetTxs, block, txs)
+
+	suite.Require().Len(byType, 1)
+	suite.Assert().Equal(uint(2), (<-byType).TxID)
+
+	suite.Require().Len(byAddress, 1)
+	notification := <-byAddress
+	suite.Assert().Equal("hash1", notification.Hash)
+	suite.Assert().Equal([]uint{10}, notification.MessageIDs)
+	suite.Assert().Equal([]string{"addr1"}, notification.WatchedAddresses)
+
+	// Block events datasets carry no txs
+	subs.publishBlock("testchain-1", BlockDatasetBlockEvents, block, nil)
+	suite.Assert().Len(byType, 0)
+}
+
+func (suite *SubscriptionsTestSuite) TestDropPolicy() {
+	var subs Subscriptions
+
+	var droppedChains []string
+	blocks, cancel := subs.SubscribeBlocks("", WithBufferSize(1), WithOnDrop(func(chainID string) { droppedChains = append(droppedChains, chainID) }))
+	defer cancel()
+
+	block, txs := mockIndexedBlock(1)
+	subs.publishBlock("testchain-1", BlockDatasetTxs, block, txs)
+	subs.publishBlock("testchain-1", BlockDatasetTxs, block, txs)
+
+	suite.Assert().Len(blocks, 1)
+	suite.Assert().Equal(uint64(1), subs.Dropped())
+	suite.Assert().Equal([]string{"testchain-1"}, droppedChains)
+}
+
+func (suite *SubscriptionsTestSuite) TestBlockPolicyCancelUnblocksPublisher() {
+	var subs Subscriptions
+
+	blocks, cancel := subs.SubscribeBlocks("", WithBufferSize(0), WithDeliveryPolicy(DeliveryPolicyBlock))
+
+	published := make(chan struct{})
+	go func() {
+		block, txs := mockIndexedBlock(1)
+		subs.publishBlock("testchain-1", BlockDatasetTxs, block, txs)
+		subs.publishBlock("testchain-1", BlockDatasetTxs, block, txs)
+		close(published)
+	}()
+
+	// The first notification is delivered, the second blocks until the subscription is cancelled
+	<-blocks
+	cancel()
+
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		suite.FailNow("publisher was not unblocked by cancel")
+	}
+
+	suite.Assert().Zero(subs.Dropped())
+}
+
+func TestSubscriptionsSuite(t *testing.T) {
+	suite.Run(t, new(SubscriptionsTestSuite))
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/DefiantLabs/cosmos-indexer/parsers"
 	"github.com/DefiantLabs/probe/client"
 	"github.com/cosmos/cosmos-sdk/types/module"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -16,11 +17,18 @@ type Indexer struct {
 	Config                              *config.IndexConfig
 	DryRun                              bool
 	DB                                  *gorm.DB
+	DBConnectOptions                    dbTypes.ConnectOptions // gorm plugins and hooks applied when the index command opens DB, SecondaryDB and ReadReplicaDB
+	SecondaryDB                         *gorm.DB               // Optional secondary database for dual write mode, writes to it never fail indexing
+	ReadReplicaDB                       *gorm.DB               // Optional replica of DB that the read only query helpers of the db package use
+	DualWriter                          *dbTypes.DualWriter    // Mirrors block writes to SecondaryDB when set
 	ChainClient                         *client.ChainClient
 	BlockEnqueueFunction                func(chan *core.EnqueueData) error
 	CustomModuleBasics                  []module.AppModuleBasic // Used for extending the AppModuleBasics registered in the probe ChainClientient
 	BlockEventFilterRegistries          BlockEventFilterRegistries
 	MessageTypeFilters                  []filter.MessageTypeFilter
+	Watchlist                           *filter.Watchlist                     // Addresses indexed in full regardless of MessageTypeFilters, reloaded from the DB while indexing
+	RangeProfiles                       config.RangeProfiles                  // Height ranges indexed with their own datasets, raw storage and filters
+	RangeProfileFilters                 map[string]RangeProfileFilters        // Filters of the range profiles with a filter file, by profile name
 	CustomBeginBlockEventParserRegistry map[string][]parsers.BlockEventParser // Used for associating parsers to block event types in BeginBlock events
 	CustomEndBlockEventParserRegistry   map[string][]parsers.BlockEventParser // Used for associating parsers to block event types in EndBlock events
 	CustomBeginBlockParserTrackers      map[string]models.BlockEventParser    // Used for tracking block event parsers in the database
@@ -28,6 +36,12 @@ type Indexer struct {
 	CustomMessageParserRegistry         map[string][]parsers.MessageParser    // Used for associating parsers to message types
 	CustomMessageParserTrackers         map[string]models.MessageParser       // Used for tracking message parsers in the database
 	CustomModels                        []any
+	BackfillJobs                        []dbTypes.BackfillJob // Run by the index backfill command alongside the built in jobs
+	subscriptions                       Subscriptions         // In-process subscribers notified after DB commits, see SubscribeBlocks and SubscribeTxs
+	parent                              *Indexer              // The indexer ForChain was called on, its subscribers are notified of the blocks of every chain
+	progress                            chainProgress         // See Progress
+	pending                             core.PendingHeights   // See PendingHeights
+	ibcDenoms                           *IBCDenomResolver     // Resolves the ibc/ denoms of indexed fees, see ResolveIBCDenoms
 }
 
 type BlockEventFilterRegistries struct {
@@ -38,8 +52,10 @@ type BlockEventFilterRegistries struct {
 type DBData struct {
 	txDBWrappers []dbTypes.TxDBWrapper
 	block        models.Block
+	trace        trace.SpanContext // Trace of the block, see core.IndexerBlockEventData
 }
 
 type BlockEventsDBData struct {
 	blockDBWrapper *dbTypes.BlockDBWrapper
+	trace          trace.SpanContext
 }
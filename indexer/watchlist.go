@@ -0,0 +1,131 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/filter"
+)
+
+const watchlistWebhookTimeout = 10 * time.Second
+
+// WatchedAddressNotification is the JSON body POSTed to the watchlist webhook for every indexed tx involving watched addresses
+type WatchedAddressNotification struct {
+	ChainID   string    `json:"chain_id"`
+	Height    int64     `json:"height"`
+	TimeStamp time.Time `json:"timestamp"`
+	TxHash    string    `json:"tx_hash"`
+	TxID      uint      `json:"tx_id"`
+	Code      uint32    `json:"code"`
+	Addresses []string  `json:"addresses"`
+}
+
+// LoadWatchlist loads the watched addresses from the DB into the indexer watchlist
+func (indexer *Indexer) LoadWatchlist(ctx context.Context) error {
+	watchedAddresses, err := dbTypes.GetWatchedAddresses(ctx, indexer.DB)
+	if err != nil {
+		return err
+	}
+
+	addresses := make([]string, len(watchedAddresses))
+	for i, watchedAddress := range watchedAddresses {
+		addresses[i] = watchedAddress.Address.Address
+	}
+
+	if indexer.Watchlist == nil {
+		indexer.Watchlist = filter.NewWatchlist(addresses)
+	} else {
+		indexer.Watchlist.Set(addresses)
+	}
+
+	return nil
+}
+
+// ReloadWatchlistPeriodically reloads the watchlist from the DB on an interval, so membership changes take effect without a restart.
+// Reload failures keep the previous watchlist. Reloading stops when ctx is cancelled.
+func (indexer *Indexer) ReloadWatchlistPeriodically(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		previousLen := indexer.Watchlist.Len()
+		if err := indexer.LoadWatchlist(ctx); err != nil {
+			indexer.log().Error("Error reloading watchlist, keeping the previous watchlist", err)
+			continue
+		}
+
+		if currentLen := indexer.Watchlist.Len(); currentLen != previousLen {
+			indexer.log().Infof("Watchlist reloaded, %d addresses are now watched", currentLen)
+		}
+	}
+}
+
+// notifyWatchedAddressActivity sends a webhook notification for each committed tx involving watched addresses.
+// Notifications are sent in the background and failures are only logged, they never block or fail indexing.
+func (indexer *Indexer) notifyWatchedAddressActivity(block models.Block, txs []dbTypes.TxDBWrapper) {
+	if indexer.Config.Watchlist.WebhookURL == "" {
+		return
+	}
+
+	for _, tx := range txs {
+		if len(tx.WatchedAddresses) == 0 {
+			continue
+		}
+
+		notification := WatchedAddressNotification{
+			ChainID:   indexer.Config.Probe.ChainID,
+			Height:    block.Height,
+			TimeStamp: block.TimeStamp,
+			TxHash:    tx.Tx.Hash,
+			TxID:      tx.Tx.ID,
+			Code:      tx.Tx.Code,
+			Addresses: tx.WatchedAddresses,
+		}
+
+		go func() {
+			if err := postWatchlistWebhook(indexer.Config.Watchlist.WebhookURL, notification); err != nil {
+				indexer.log().Error(fmt.Sprintf("Error sending watchlist webhook for tx %s", notification.TxHash), err)
+			}
+		}()
+	}
+}
+
+func postWatchlistWebhook(url string, notification WatchedAddressNotification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), watchlistWebhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
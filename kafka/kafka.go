@@ -0,0 +1,300 @@
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+const (
+	// maxBatchSize is the maximum number of block messages written to Kafka at once
+	maxBatchSize = 100
+	// Backoff between the attempts to write a block message, doubled after every failed attempt
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// BlockMessage is the JSON value of the message published for a block committed to the database. The dataset is txs or
+// block_events, a block indexed with both datasets is published once for each.
+type BlockMessage struct {
+	ChainID      string      `json:"chain_id"`
+	Height       int64       `json:"height"`
+	Hash         string      `json:"hash"`
+	Timestamp    time.Time   `json:"timestamp"`
+	Dataset      string      `json:"dataset"`
+	TxCount      int         `json:"tx_count"`
+	MessageCount int         `json:"message_count"`
+	Txs          []TxSummary `json:"txs"` // Empty for the block_events dataset
+}
+
+// TxSummary summarizes a tx of a BlockMessage
+type TxSummary struct {
+	Hash         string   `json:"hash"`
+	Code         uint32   `json:"code"`
+	Signers      []string `json:"signers"`
+	MessageTypes []string `json:"message_types"` // Types of the messages of the tx, in message order
+}
+
+// NewBlockMessage builds the message published for the block notification
+func NewBlockMessage(notification indexer.IndexedBlockNotification) BlockMessage {
+	message := BlockMessage{
+		ChainID:   notification.ChainID,
+		Height:    notification.Height,
+		Hash:      notification.BlockHash,
+		Timestamp: notification.TimeStamp.UTC(),
+		Dataset:   notification.Dataset.String(),
+		TxCount:   len(notification.Txs),
+		Txs:       make([]TxSummary, len(notification.Txs)),
+	}
+
+	for i, tx := range notification.Txs {
+		message.Txs[i] = TxSummary{
+			Hash:         tx.Hash,
+			Code:         tx.Code,
+			Signers:      tx.SignerAddresses,
+			MessageTypes: tx.MessageTypes,
+		}
+		message.MessageCount += len(tx.MessageTypes)
+	}
+
+	return message
+}
+
+// messageWriter writes messages to Kafka, a *kafkago.Writer outside of tests
+type messageWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafkago.Message) error
+	Close() error
+}
+
+// Publisher publishes a BlockMessage to a Kafka topic for every block notification it receives. Messages are keyed by
+// chain ID, so the messages of a chain go to one partition in the order the blocks were committed. Blocks are committed out
+// of height order while the indexer catches up with concurrent RPC workers.
+type Publisher struct {
+	writer      messageWriter
+	maxAttempts int
+	backoff     time.Duration
+	metrics     *metrics.Metrics
+}
+
+// NewPublisher returns a publisher writing to the topic of the config. Failed writes are retried up to the max attempts of
+// the config and recorded in the metrics, indexMetrics may be nil.
+func NewPublisher(conf config.Kafka, indexMetrics *metrics.Metrics) (*Publisher, error) {
+	transport := &kafkago.Transport{ClientID: "cosmos-indexer"}
+
+	if conf.TLS {
+		tlsConfig, err := newTLSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLS = tlsConfig
+	}
+
+	if conf.SASLMechanism != "" {
+		mechanism, err := newSASLMechanism(conf)
+		if err != nil {
+			return nil, err
+		}
+		transport.SASL = mechanism
+	}
+
+	writer := &kafkago.Writer{
+		Addr:         kafkago.TCP(conf.Brokers...),
+		Topic:        conf.Topic,
+		Balancer:     &kafkago.Hash{},
+		RequiredAcks: kafkago.RequireAll,
+		// The publisher retries the failed writes itself, so the retries show in the metrics
+		MaxAttempts:  1,
+		BatchSize:    maxBatchSize,
+		BatchTimeout: 10 * time.Millisecond,
+		Transport:    transport,
+	}
+
+	return newPublisher(writer, int(conf.MaxAttempts), indexMetrics), nil
+}
+
+func newPublisher(writer messageWriter, maxAttempts int, indexMetrics *metrics.Metrics) *Publisher {
+	return &Publisher{
+		writer:      writer,
+		maxAttempts: maxAttempts,
+		backoff:     initialBackoff,
+		metrics:     indexMetrics,
+	}
+}
+
+// Run publishes the notifications until the channel is closed. The notifications waiting in the channel are written in
+// batches. Writes stop being retried once ctx is cancelled, the notifications left are then dropped.
+func (p *Publisher) Run(ctx context.Context, notifications <-chan indexer.IndexedBlockNotification) {
+	for notification := range notifications {
+		batch := []indexer.IndexedBlockNotification{notification}
+
+	drain:
+		for len(batch) < maxBatchSize {
+			select {
+			case notification, ok := <-notifications:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, notification)
+			default:
+				break drain
+			}
+		}
+
+		p.publish(ctx, batch)
+	}
+}
+
+// Close flushes the writer and closes its connections to the brokers
+func (p *Publisher) Close() error {
+	return p.writer.Close()
+}
+
+// ObserveBufferFull records a block notification of the chain dropped because the buffer of the publisher was full, see
+// indexer.WithOnDrop
+func (p *Publisher) ObserveBufferFull(chainID string) {
+	p.observeDropped(chainID, metrics.KafkaDroppedBufferFull)
+}
+
+// pendingMessage is a message not written yet and the block it was built from
+type pendingMessage struct {
+	chainID string
+	height  int64
+	message kafkago.Message
+}
+
+// publish writes the messages of the notifications, retrying the messages that failed with exponential backoff until
+// they are written or the attempts run out
+func (p *Publisher) publish(ctx context.Context, notifications []indexer.IndexedBlockNotification) {
+	pending := make([]pendingMessage, 0, len(notifications))
+	for _, notification := range notifications {
+		value, err := json.Marshal(NewBlockMessage(notification))
+		if err != nil {
+			config.Log.Error(fmt.Sprintf("Error encoding the Kafka message of block %d of %s", notification.Height, notification.ChainID), err)
+			p.observeDropped(notification.ChainID, metrics.KafkaDroppedPublishFailed)
+			continue
+		}
+
+		pending = append(pending, pendingMessage{
+			chainID: notification.ChainID,
+			height:  notification.Height,
+			message: kafkago.Message{Key: []byte(notification.ChainID), Value: value},
+		})
+	}
+
+	backoff := p.backoff
+	for attempt := 1; len(pending) != 0; attempt++ {
+		messages := make([]kafkago.Message, len(pending))
+		for i, message := range pending {
+			messages[i] = message.message
+		}
+
+		err := p.writer.WriteMessages(ctx, messages...)
+		pending = p.failedMessages(pending, err)
+		if len(pending) == 0 {
+			return
+		}
+
+		if attempt >= p.maxAttempts || ctx.Err() != nil {
+			config.Log.Error(fmt.Sprintf("Dropping %d block messages after %d failed writes to Kafka, the first of block %d of %s",
+				len(pending), attempt, pending[0].height, pending[0].chainID), err)
+			for _, message := range pending {
+				p.observeDropped(message.chainID, metrics.KafkaDroppedPublishFailed)
+			}
+			return
+		}
+
+		config.Log.Warn(fmt.Sprintf("Error writing %d block messages to Kafka, retrying in %s", len(pending), backoff), err)
+		for _, message := range pending {
+			if p.metrics != nil {
+				p.metrics.ObserveKafkaRetry(message.chainID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// failedMessages records the messages written by a write that returned err and returns the ones that failed. Writes of
+// several partitions fail message by message, the messages written are not written again.
+func (p *Publisher) failedMessages(pending []pendingMessage, err error) []pendingMessage {
+	var writeErrors kafkago.WriteErrors
+	if err != nil && (!errors.As(err, &writeErrors) || len(writeErrors) != len(pending)) {
+		return pending
+	}
+
+	var failed []pendingMessage
+	for i, message := range pending {
+		if err != nil && writeErrors[i] != nil {
+			failed = append(failed, message)
+			continue
+		}
+		if p.metrics != nil {
+			p.metrics.ObserveKafkaPublished(message.chainID)
+		}
+	}
+	return failed
+}
+
+func (p *Publisher) observeDropped(chainID string, reason string) {
+	if p.metrics != nil {
+		p.metrics.ObserveKafkaDropped(chainID, reason)
+	}
+}
+
+func newTLSConfig(conf config.Kafka) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: conf.TLSInsecureSkipVerify} //nolint:gosec // Only skipped with kafka.tls-insecure-skip-verify
+
+	if conf.TLSCAFile != "" {
+		pem, err := os.ReadFile(conf.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading kafka.tls-ca-file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka.tls-ca-file %s has no PEM certificate", conf.TLSCAFile)
+		}
+	}
+
+	if conf.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading kafka.tls-cert-file: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func newSASLMechanism(conf config.Kafka) (sasl.Mechanism, error) {
+	switch conf.SASLMechanism {
+	case config.KafkaSASLPlain:
+		return plain.Mechanism{Username: conf.SASLUsername, Password: conf.SASLPassword}, nil
+	case config.KafkaSASLSCRAMSHA256:
+		return scram.Mechanism(scram.SHA256, conf.SASLUsername, conf.SASLPassword)
+	case config.KafkaSASLSCRAMSHA512:
+		return scram.Mechanism(scram.SHA512, conf.SASLUsername, conf.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unknown kafka.sasl-mechanism %s", conf.SASLMechanism)
+	}
+}
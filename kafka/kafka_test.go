@@ -0,0 +1,163 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kafkago "github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/suite"
+)
+
+type PublisherTestSuite struct {
+	suite.Suite
+}
+
+// fakeWriter records the messages written, each write returns the next of errs until they run out
+type fakeWriter struct {
+	errs    []error
+	writes  int
+	written []kafkago.Message
+}
+
+func (w *fakeWriter) WriteMessages(ctx context.Context, messages ...kafkago.Message) error {
+	w.writes++
+	if len(w.errs) != 0 {
+		err := w.errs[0]
+		w.errs = w.errs[1:]
+
+		var writeErrors kafkago.WriteErrors
+		if errors.As(err, &writeErrors) {
+			for i, message := range messages {
+				if writeErrors[i] == nil {
+					w.written = append(w.written, message)
+				}
+			}
+		}
+		return err
+	}
+
+	w.written = append(w.written, messages...)
+	return nil
+}
+
+func (w *fakeWriter) Close() error {
+	return nil
+}
+
+func mockBlockNotification(chainID string, height int64) indexer.IndexedBlockNotification {
+	return indexer.IndexedBlockNotification{
+		ChainID:   chainID,
+		Height:    height,
+		BlockHash: "BLOCKHASH",
+		TimeStamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.FixedZone("CET", 3600)),
+		Dataset:   indexer.BlockDatasetTxs,
+		Txs: []indexer.IndexedTxNotification{
+			{Hash: "hash1", SignerAddresses: []string{"addr1"}, MessageTypes: []string{"/cosmos.bank.v1beta1.MsgSend", "/cosmos.bank.v1beta1.MsgSend"}},
+			{Hash: "hash2", Code: 5, SignerAddresses: []string{"addr2"}, MessageTypes: []string{"/cosmos.staking.v1beta1.MsgDelegate"}},
+		},
+	}
+}
+
+// run publishes the notifications with the publisher and waits for it to finish
+func run(publisher *Publisher, notifications ...indexer.IndexedBlockNotification) {
+	notificationChan := make(chan indexer.IndexedBlockNotification, len(notifications))
+	for _, notification := range notifications {
+		notificationChan <- notification
+	}
+	close(notificationChan)
+
+	publisher.Run(context.Background(), notificationChan)
+}
+
+func (suite *PublisherTestSuite) TestNewBlockMessage() {
+	message := NewBlockMessage(mockBlockNotification("testchain-1", 10))
+
+	suite.Assert().Equal("BLOCKHASH", message.Hash)
+	suite.Assert().Equal(time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC), message.Timestamp)
+	suite.Assert().Equal("txs", message.Dataset)
+	suite.Assert().Equal(2, message.TxCount)
+	suite.Assert().Equal(3, message.MessageCount)
+	suite.Assert().Equal(uint32(5), message.Txs[1].Code)
+
+	// Block events have no txs, they are an empty list in the JSON
+	notification := mockBlockNotification("testchain-1", 10)
+	notification.Dataset = indexer.BlockDatasetBlockEvents
+	notification.Txs = nil
+	value, err := json.Marshal(NewBlockMessage(notification))
+	suite.Require().NoError(err)
+	suite.Assert().Contains(string(value), `"dataset":"block_events","tx_count":0,"message_count":0,"txs":[]`)
+}
+
+func (suite *PublisherTestSuite) TestRetriesFailedWrites() {
+	indexMetrics := metrics.New()
+	writer := &fakeWriter{errs: []error{errors.New("leader not available"), errors.New("leader not available")}}
+	publisher := newPublisher(writer, 3, indexMetrics)
+	publisher.backoff = time.Millisecond
+
+	run(publisher, mockBlockNotification("testchain-1", 10), mockBlockNotification("otherchain-1", 20))
+
+	suite.Assert().Equal(3, writer.writes)
+	suite.Require().Len(writer.written, 2)
+	suite.Assert().Equal("testchain-1", string(writer.written[0].Key))
+	suite.Assert().Equal("otherchain-1", string(writer.written[1].Key))
+
+	var message BlockMessage
+	suite.Require().NoError(json.Unmarshal(writer.written[1].Value, &message))
+	suite.Assert().Equal(int64(20), message.Height)
+	suite.Assert().Equal([]string{"/cosmos.staking.v1beta1.MsgDelegate"}, message.Txs[1].MessageTypes)
+
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.KafkaPublished.WithLabelValues("testchain-1")))
+	suite.Assert().Equal(2.0, testutil.ToFloat64(indexMetrics.KafkaPublishRetries.WithLabelValues("testchain-1")))
+}
+
+func (suite *PublisherTestSuite) TestRetriesOnlyFailedMessages() {
+	indexMetrics := metrics.New()
+	writer := &fakeWriter{errs: []error{kafkago.WriteErrors{nil, errors.New("not leader for partition")}}}
+	publisher := newPublisher(writer, 3, indexMetrics)
+	publisher.backoff = time.Millisecond
+
+	run(publisher, mockBlockNotification("testchain-1", 10), mockBlockNotification("otherchain-1", 20))
+
+	// The message of the partition that succeeded is not written twice
+	suite.Assert().Equal(2, writer.writes)
+	suite.Require().Len(writer.written, 2)
+	suite.Assert().Equal("otherchain-1", string(writer.written[1].Key))
+	suite.Assert().Equal(0.0, testutil.ToFloat64(indexMetrics.KafkaPublishRetries.WithLabelValues("testchain-1")))
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.KafkaPublishRetries.WithLabelValues("otherchain-1")))
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.KafkaPublished.WithLabelValues("otherchain-1")))
+}
+
+func (suite *PublisherTestSuite) TestDropsAfterMaxAttempts() {
+	indexMetrics := metrics.New()
+	writer := &fakeWriter{errs: []error{errors.New("broker down"), errors.New("broker down")}}
+	publisher := newPublisher(writer, 2, indexMetrics)
+	publisher.backoff = time.Millisecond
+
+	run(publisher, mockBlockNotification("testchain-1", 10))
+	// The next block is published once the brokers are back
+	run(publisher, mockBlockNotification("testchain-1", 11))
+
+	suite.Assert().Equal(3, writer.writes)
+	suite.Require().Len(writer.written, 1)
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.KafkaDropped.WithLabelValues("testchain-1", metrics.KafkaDroppedPublishFailed)))
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.KafkaPublished.WithLabelValues("testchain-1")))
+
+	publisher.ObserveBufferFull("testchain-1")
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.KafkaDropped.WithLabelValues("testchain-1", metrics.KafkaDroppedBufferFull)))
+
+	// Without metrics failures are only logged
+	writer.errs = []error{errors.New("broker down")}
+	publisher = newPublisher(writer, 1, nil)
+	run(publisher, mockBlockNotification("testchain-1", 12))
+	publisher.ObserveBufferFull("testchain-1")
+}
+
+func TestPublisherSuite(t *testing.T) {
+	suite.Run(t, new(PublisherTestSuite))
+}
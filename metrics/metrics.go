@@ -0,0 +1,356 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Datasets of a block, the dataset label of the metrics
+const (
+	DatasetTxs         = "txs"
+	DatasetBlockEvents = "block_events"
+)
+
+// Metrics are the Prometheus metrics of the indexer, registered on their own registry. The chain_id label is the chain ID
+// of the chain, like cosmoshub-4.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	BlocksIndexed        *prometheus.CounterVec   // Blocks indexed by chain and dataset
+	TxsIndexed           *prometheus.CounterVec   // Txs indexed by chain
+	BlockIndexDuration   *prometheus.HistogramVec // Seconds to index a block by chain and dataset, including the database transaction
+	DBTxDuration         *prometheus.HistogramVec // Seconds of the database transaction indexing a block by chain and dataset
+	FailedBlocks         *prometheus.CounterVec   // Failures recorded in the failed block tables by chain, dataset and stage
+	HighestIndexedHeight *prometheus.GaugeVec     // Highest height indexed since startup by chain and dataset
+	ChainIndexing        *prometheus.GaugeVec     // 1 while the chain is indexed, 0 once its indexing stopped on an error, by chain
+	RPCFailovers         *prometheus.CounterVec   // Requests failed over to the next RPC endpoint by chain and failed endpoint
+	RPCEndpointHealthy   *prometheus.GaugeVec     // 1 while the RPC endpoint is healthy, 0 while it is skipped, by chain and endpoint
+	RPCRateLimitWait     *prometheus.GaugeVec     // Seconds the last request waited for the rate limiter by chain and endpoint
+	RPCRateLimited       *prometheus.CounterVec   // Requests rate limited by the RPC endpoint by chain and endpoint
+	PaginatedQueries     *prometheus.CounterVec   // Paginated queries by chain, query type and result
+	PaginatedQueryTime   *prometheus.HistogramVec // Seconds to page through a query by chain and query type
+	PaginatedPages       *prometheus.CounterVec   // Pages fetched by chain and query type
+	PaginatedRetries     *prometheus.CounterVec   // Retried page requests by chain and query type
+	GapBackfillHeights   *prometheus.CounterVec   // Heights of gaps enqueued by the gap backfill by chain
+	GapBackfillRemaining *prometheus.GaugeVec     // Heights of gaps left to enqueue by the gap backfill by chain
+	KafkaPublished       *prometheus.CounterVec   // Block messages published to Kafka by chain
+	KafkaPublishRetries  *prometheus.CounterVec   // Retried writes of block messages to Kafka by chain
+	KafkaDropped         *prometheus.CounterVec   // Block messages not published to Kafka by chain and reason
+	WebhookDelivered     *prometheus.CounterVec   // Events delivered to webhooks by webhook and trigger
+	WebhookRetries       *prometheus.CounterVec   // Retried deliveries of events to webhooks by webhook
+	WebhookDropped       *prometheus.CounterVec   // Events not delivered to webhooks by webhook and reason
+
+	mu      sync.Mutex
+	highest map[[2]string]int64 // Highest height set on the gauge by chain and dataset
+}
+
+// New creates the metrics on a new registry, along with the Go runtime and process metrics
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		highest:  make(map[[2]string]int64),
+		BlocksIndexed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "blocks_indexed_total",
+			Help: "Number of blocks indexed.",
+		}, []string{"chain_id", "dataset"}),
+		TxsIndexed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "txs_indexed_total",
+			Help: "Number of txs indexed.",
+		}, []string{"chain_id"}),
+		BlockIndexDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "block_index_duration_seconds",
+			Help:    "Time to write a block to the database. Blocks written in a batch each take their share of the batch.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"chain_id", "dataset"}),
+		DBTxDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_tx_duration_seconds",
+			Help:    "Time of the database transactions writing blocks, one per block or batch of blocks.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		}, []string{"chain_id", "dataset"}),
+		FailedBlocks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "failed_blocks_total",
+			Help: "Number of block failures recorded, reattempts of the same block included.",
+		}, []string{"chain_id", "dataset", "stage"}),
+		HighestIndexedHeight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "highest_indexed_height",
+			Help: "Highest block height indexed since startup.",
+		}, []string{"chain_id", "dataset"}),
+		ChainIndexing: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "chain_indexing",
+			Help: "1 while the chain is indexed, 0 once indexing the chain stopped on an error.",
+		}, []string{"chain_id"}),
+		RPCFailovers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_failovers_total",
+			Help: "Number of requests retried against the next RPC endpoint after the endpoint failed.",
+		}, []string{"chain_id", "endpoint"}),
+		RPCEndpointHealthy: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rpc_endpoint_healthy",
+			Help: "1 while the RPC endpoint is healthy, 0 while it is unhealthy and only used when the healthy endpoints fail.",
+		}, []string{"chain_id", "endpoint"}),
+		RPCRateLimitWait: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "rpc_rate_limit_wait_seconds",
+			Help: "Time the last request to the RPC endpoint waited for the rate limiter, including the backoff after rate limited requests.",
+		}, []string{"chain_id", "endpoint"}),
+		RPCRateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_rate_limited_total",
+			Help: "Number of requests the RPC endpoint rejected with a rate limit error.",
+		}, []string{"chain_id", "endpoint"}),
+		PaginatedQueries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_paginated_queries_total",
+			Help: "Number of paginated queries paged through, by result: success, or error when a page failed or a limit was reached.",
+		}, []string{"chain_id", "query_type", "result"}),
+		PaginatedQueryTime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rpc_paginated_query_duration_seconds",
+			Help:    "Time to page through a paginated query, retries included.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 16),
+		}, []string{"chain_id", "query_type"}),
+		PaginatedPages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_paginated_query_pages_total",
+			Help: "Number of pages fetched by paginated queries.",
+		}, []string{"chain_id", "query_type"}),
+		PaginatedRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_paginated_query_retries_total",
+			Help: "Number of page requests of paginated queries retried after a transient error.",
+		}, []string{"chain_id", "query_type"}),
+		GapBackfillHeights: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "gap_backfill_heights_total",
+			Help: "Number of missing heights below the head enqueued by the gap backfill.",
+		}, []string{"chain_id"}),
+		GapBackfillRemaining: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "gap_backfill_remaining_heights",
+			Help: "Number of missing heights below the head the gap backfill has yet to enqueue.",
+		}, []string{"chain_id"}),
+		KafkaPublished: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_messages_published_total",
+			Help: "Number of block messages published to Kafka.",
+		}, []string{"chain_id"}),
+		KafkaPublishRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_publish_retries_total",
+			Help: "Number of block messages written to Kafka again after a failed write.",
+		}, []string{"chain_id"}),
+		KafkaDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "kafka_messages_dropped_total",
+			Help: "Number of block messages not published to Kafka, because the publisher fell behind (buffer_full) or every write failed (publish_failed).",
+		}, []string{"chain_id", "reason"}),
+		WebhookDelivered: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "webhook_events_delivered_total",
+			Help: "Number of events delivered to webhooks.",
+		}, []string{"webhook", "trigger"}),
+		WebhookRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "webhook_delivery_retries_total",
+			Help: "Number of events POSTed to a webhook again after a failed delivery.",
+		}, []string{"webhook"}),
+		WebhookDropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "webhook_events_dropped_total",
+			Help: "Number of events not delivered to webhooks, because the queue of the webhook was full (queue_full) or every delivery failed (delivery_failed).",
+		}, []string{"webhook", "reason"}),
+	}
+
+	m.Registry.MustRegister(
+		m.BlocksIndexed,
+		m.TxsIndexed,
+		m.BlockIndexDuration,
+		m.DBTxDuration,
+		m.FailedBlocks,
+		m.HighestIndexedHeight,
+		m.ChainIndexing,
+		m.RPCFailovers,
+		m.RPCEndpointHealthy,
+		m.RPCRateLimitWait,
+		m.RPCRateLimited,
+		m.PaginatedQueries,
+		m.PaginatedQueryTime,
+		m.PaginatedPages,
+		m.PaginatedRetries,
+		m.GapBackfillHeights,
+		m.GapBackfillRemaining,
+		m.KafkaPublished,
+		m.KafkaPublishRetries,
+		m.KafkaDropped,
+		m.WebhookDelivered,
+		m.WebhookRetries,
+		m.WebhookDropped,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// ObserveBlocks records blocks of the chain indexed in one database transaction, with the heights of the blocks and the
+// number of txs indexed. duration is the time to index all of them, txDuration the time of the transaction.
+func (m *Metrics) ObserveBlocks(chainID string, dataset string, heights []int64, txs int, duration time.Duration, txDuration time.Duration) {
+	if len(heights) == 0 {
+		return
+	}
+
+	m.DBTxDuration.WithLabelValues(chainID, dataset).Observe(txDuration.Seconds())
+	blockDuration := duration.Seconds() / float64(len(heights))
+	highest := heights[0]
+	for _, height := range heights {
+		m.BlockIndexDuration.WithLabelValues(chainID, dataset).Observe(blockDuration)
+		if height > highest {
+			highest = height
+		}
+	}
+
+	m.BlocksIndexed.WithLabelValues(chainID, dataset).Add(float64(len(heights)))
+	if dataset == DatasetTxs {
+		m.TxsIndexed.WithLabelValues(chainID).Add(float64(txs))
+	}
+
+	m.setHighest(chainID, dataset, highest)
+}
+
+// setHighest raises the highest indexed height gauge. Blocks are indexed out of order by concurrent workers, so the gauge
+// only moves up.
+func (m *Metrics) setHighest(chainID string, dataset string, height int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := [2]string{chainID, dataset}
+	if highest, ok := m.highest[key]; ok && highest >= height {
+		return
+	}
+	m.highest[key] = height
+	m.HighestIndexedHeight.WithLabelValues(chainID, dataset).Set(float64(height))
+}
+
+// ObserveFailedBlock records a failure of a block of the chain at the stage
+func (m *Metrics) ObserveFailedBlock(chainID string, dataset string, stage string) {
+	m.FailedBlocks.WithLabelValues(chainID, dataset, stage).Inc()
+}
+
+// SetChainIndexing records whether the chain is indexed or its indexing stopped on an error
+func (m *Metrics) SetChainIndexing(chainID string, indexing bool) {
+	value := 0.0
+	if indexing {
+		value = 1
+	}
+	m.ChainIndexing.WithLabelValues(chainID).Set(value)
+}
+
+// ObserveRPCFailover records a request of the chain failed over from the endpoint to the next one
+func (m *Metrics) ObserveRPCFailover(chainID string, endpoint string) {
+	m.RPCFailovers.WithLabelValues(chainID, endpoint).Inc()
+}
+
+// SetRPCEndpointHealthy records whether the RPC endpoint of the chain is healthy
+func (m *Metrics) SetRPCEndpointHealthy(chainID string, endpoint string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	m.RPCEndpointHealthy.WithLabelValues(chainID, endpoint).Set(value)
+}
+
+// SetRPCRateLimitWait records the time the last request to the RPC endpoint of the chain waited for the rate limiter
+func (m *Metrics) SetRPCRateLimitWait(chainID string, endpoint string, wait time.Duration) {
+	m.RPCRateLimitWait.WithLabelValues(chainID, endpoint).Set(wait.Seconds())
+}
+
+// ObserveRPCRateLimited records a request rate limited by the RPC endpoint of the chain
+func (m *Metrics) ObserveRPCRateLimited(chainID string, endpoint string) {
+	m.RPCRateLimited.WithLabelValues(chainID, endpoint).Inc()
+}
+
+// ObservePaginatedQuery records a paginated query of the chain paged through in duration, with the pages fetched and the
+// page requests retried. err is the error the query stopped on, nil when every page was fetched.
+func (m *Metrics) ObservePaginatedQuery(chainID string, queryType string, pages int, retries int64, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	m.PaginatedQueries.WithLabelValues(chainID, queryType, result).Inc()
+	m.PaginatedQueryTime.WithLabelValues(chainID, queryType).Observe(duration.Seconds())
+	m.PaginatedPages.WithLabelValues(chainID, queryType).Add(float64(pages))
+	m.PaginatedRetries.WithLabelValues(chainID, queryType).Add(float64(retries))
+}
+
+// ObserveGapBackfillHeight records a missing height of the chain enqueued by the gap backfill, with the heights left
+func (m *Metrics) ObserveGapBackfillHeight(chainID string, remaining int64) {
+	m.GapBackfillHeights.WithLabelValues(chainID).Inc()
+	m.GapBackfillRemaining.WithLabelValues(chainID).Set(float64(remaining))
+}
+
+// SetGapBackfillRemaining records the missing heights of the chain the gap backfill has yet to enqueue
+func (m *Metrics) SetGapBackfillRemaining(chainID string, remaining int64) {
+	m.GapBackfillRemaining.WithLabelValues(chainID).Set(float64(remaining))
+}
+
+// Reasons a block message is not published to Kafka, the reason label of KafkaDropped
+const (
+	KafkaDroppedBufferFull    = "buffer_full"
+	KafkaDroppedPublishFailed = "publish_failed"
+)
+
+// ObserveKafkaPublished records a block message of the chain published to Kafka
+func (m *Metrics) ObserveKafkaPublished(chainID string) {
+	m.KafkaPublished.WithLabelValues(chainID).Inc()
+}
+
+// ObserveKafkaRetry records a block message of the chain written to Kafka again after a failed write
+func (m *Metrics) ObserveKafkaRetry(chainID string) {
+	m.KafkaPublishRetries.WithLabelValues(chainID).Inc()
+}
+
+// ObserveKafkaDropped records a block message of the chain not published to Kafka for the reason
+func (m *Metrics) ObserveKafkaDropped(chainID string, reason string) {
+	m.KafkaDropped.WithLabelValues(chainID, reason).Inc()
+}
+
+// Reasons an event is not delivered to a webhook, the reason label of WebhookDropped
+const (
+	WebhookDroppedQueueFull      = "queue_full"
+	WebhookDroppedDeliveryFailed = "delivery_failed"
+)
+
+// ObserveWebhookDelivered records an event of the trigger delivered to the webhook
+func (m *Metrics) ObserveWebhookDelivered(webhook string, trigger string) {
+	m.WebhookDelivered.WithLabelValues(webhook, trigger).Inc()
+}
+
+// ObserveWebhookRetry records an event POSTed to the webhook again after a failed delivery
+func (m *Metrics) ObserveWebhookRetry(webhook string) {
+	m.WebhookRetries.WithLabelValues(webhook).Inc()
+}
+
+// ObserveWebhookDropped records an event not delivered to the webhook for the reason
+func (m *Metrics) ObserveWebhookDropped(webhook string, reason string) {
+	m.WebhookDropped.WithLabelValues(webhook, reason).Inc()
+}
+
+// Handler serves the metrics of the registry in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Serve serves the metrics on /metrics on the port until the context is cancelled
+func Serve(ctx context.Context, port string, m *Metrics) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{
+		Addr:              net.JoinHostPort("", port),
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type MetricsTestSuite struct {
+	suite.Suite
+}
+
+func (suite *MetricsTestSuite) scrape(m *Metrics) string {
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	suite.Require().NoError(err)
+	defer resp.Body.Close()
+	suite.Require().Equal(http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	suite.Require().NoError(err)
+	return string(body)
+}
+
+func (suite *MetricsTestSuite) TestObserveBlocks() {
+	m := New()
+	m.ObserveBlocks("testchain-1", DatasetTxs, []int64{10, 12, 11}, 7, 300*time.Millisecond, 100*time.Millisecond)
+	m.ObserveBlocks("testchain-1", DatasetTxs, []int64{9}, 1, 10*time.Millisecond, 5*time.Millisecond)
+	m.ObserveBlocks("testchain-1", DatasetBlockEvents, []int64{12}, 0, 10*time.Millisecond, 5*time.Millisecond)
+	m.ObserveFailedBlock("testchain-1", DatasetTxs, "fetch")
+
+	body := suite.scrape(m)
+	suite.Assert().Contains(body, `blocks_indexed_total{chain_id="testchain-1",dataset="txs"} 4`)
+	suite.Assert().Contains(body, `blocks_indexed_total{chain_id="testchain-1",dataset="block_events"} 1`)
+	suite.Assert().Contains(body, `txs_indexed_total{chain_id="testchain-1"} 8`)
+	suite.Assert().Contains(body, `block_index_duration_seconds_count{chain_id="testchain-1",dataset="txs"} 4`)
+	suite.Assert().Contains(body, `db_tx_duration_seconds_count{chain_id="testchain-1",dataset="txs"} 2`)
+	suite.Assert().Contains(body, `failed_blocks_total{chain_id="testchain-1",dataset="txs",stage="fetch"} 1`)
+	suite.Assert().Contains(body, "go_goroutines")
+
+	// The lower height indexed last does not lower the gauge
+	suite.Assert().Contains(body, `highest_indexed_height{chain_id="testchain-1",dataset="txs"} 12`)
+	suite.Assert().Contains(body, `highest_indexed_height{chain_id="testchain-1",dataset="block_events"} 12`)
+}
+
+func (suite *MetricsTestSuite) TestObserveNoBlocks() {
+	m := New()
+	m.ObserveBlocks("testchain-1", DatasetTxs, nil, 0, time.Second, time.Second)
+
+	suite.Assert().NotContains(suite.scrape(m), "blocks_indexed_total{")
+}
+
+func TestMetrics(t *testing.T) {
+	suite.Run(t, new(MetricsTestSuite))
+}
@@ -0,0 +1,262 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	txtypes "github.com/DefiantLabs/cosmos-indexer/cosmos/modules/tx"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/parsers"
+	"github.com/DefiantLabs/cosmos-indexer/util"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	bankTypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MsgSendType      = "/cosmos.bank.v1beta1.MsgSend"
+	MsgMultiSendType = "/cosmos.bank.v1beta1.MsgMultiSend"
+)
+
+// Transfer is a single movement of one denom from a sender to a recipient.
+// A MsgSend produces one Transfer per coin. A MsgMultiSend produces one Transfer per (input, output) pairing per denom,
+// InputIndex and OutputIndex refer to the position of the input and output in the originating message.
+type Transfer struct {
+	ID          uint
+	Message     models.Message
+	MessageID   uint `gorm:"uniqueIndex:idx_transfer_message_pairing,priority:1"`
+	InputIndex  int  `gorm:"uniqueIndex:idx_transfer_message_pairing,priority:2"`
+	OutputIndex int  `gorm:"uniqueIndex:idx_transfer_message_pairing,priority:3"`
+	Sender      models.Address
+	SenderID    uint `gorm:"index:idx_transfer_sender"`
+	Recipient   models.Address
+	RecipientID uint            `gorm:"index:idx_transfer_recipient"`
+	Amount      decimal.Decimal `gorm:"type:decimal(78,0);"`
+	Denom       models.Denom
+	DenomID     uint `gorm:"uniqueIndex:idx_transfer_message_pairing,priority:4"`
+}
+
+// TransfersParser is the reference MessageParser for bank transfers. It handles both MsgSend and MsgMultiSend, register it for both types:
+//
+//	indexer.RegisterCustomModels([]any{&bank.Transfer{}})
+//	indexer.RegisterCustomMessageParser(bank.MsgSendType, &bank.TransfersParser{Id: "bank-send"})
+//	indexer.RegisterCustomMessageParser(bank.MsgMultiSendType, &bank.TransfersParser{Id: "bank-multisend"})
+type TransfersParser struct {
+	Id string
+}
+
+func (c *TransfersParser) Identifier() string {
+	return c.Id
+}
+
+func (c *TransfersParser) ParseMessage(cosmosMsg sdkTypes.Msg, log *txtypes.LogMessage, cfg config.IndexConfig) (*any, error) {
+	var transfers []Transfer
+	var err error
+
+	switch msg := cosmosMsg.(type) {
+	case *bankTypes.MsgSend:
+		transfers = make([]Transfer, 0, len(msg.Amount))
+		for _, coin := range msg.Amount {
+			transfers = append(transfers, Transfer{
+				Sender:    models.Address{Address: msg.FromAddress},
+				Recipient: models.Address{Address: msg.ToAddress},
+				Amount:    util.ToNumeric(coin.Amount.BigInt()),
+				Denom:     models.Denom{Base: coin.Denom},
+			})
+		}
+	case *bankTypes.MsgMultiSend:
+		transfers, err = SplitMultiSend(msg.Inputs, msg.Outputs)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("not a bank transfer message")
+	}
+
+	storageVal := any(transfers)
+	return &storageVal, nil
+}
+
+// SplitMultiSend expands the inputs and outputs of a MsgMultiSend into one Transfer per (input, output) pairing per denom.
+// For each denom, inputs are drained in order into outputs in order, so every pairing carries the exact amount moved between
+// the two and the amounts sum back to each input and output. Only pairings that move a non-zero amount are returned.
+func SplitMultiSend(inputs []bankTypes.Input, outputs []bankTypes.Output) ([]Transfer, error) {
+	type remainingInput struct {
+		index     int
+		address   string
+		remaining sdkTypes.Int
+	}
+
+	// Keep denoms in order of first appearance in the outputs for deterministic output
+	var denoms []string
+	inputsByDenom := make(map[string][]*remainingInput)
+	for inputIndex, input := range inputs {
+		for _, coin := range input.Coins {
+			inputsByDenom[coin.Denom] = append(inputsByDenom[coin.Denom], &remainingInput{index: inputIndex, address: input.Address, remaining: coin.Amount})
+		}
+	}
+
+	seenDenoms := make(map[string]bool)
+	for _, output := range outputs {
+		for _, coin := range output.Coins {
+			if !seenDenoms[coin.Denom] {
+				seenDenoms[coin.Denom] = true
+				denoms = append(denoms, coin.Denom)
+			}
+		}
+	}
+
+	var transfers []Transfer
+	for _, denom := range denoms {
+		denomInputs := inputsByDenom[denom]
+		current := 0
+
+		for outputIndex, output := range outputs {
+			owed := output.Coins.AmountOf(denom)
+			for owed.IsPositive() {
+				if current >= len(denomInputs) {
+					return nil, fmt.Errorf("multisend outputs exceed inputs for denom %s", denom)
+				}
+
+				input := denomInputs[current]
+				amount := sdkTypes.MinInt(owed, input.remaining)
+				if amount.IsPositive() {
+					transfers = append(transfers, Transfer{
+						InputIndex:  input.index,
+						OutputIndex: outputIndex,
+						Sender:      models.Address{Address: input.address},
+						Recipient:   models.Address{Address: output.Address},
+						Amount:      util.ToNumeric(amount.BigInt()),
+						Denom:       models.Denom{Base: denom},
+					})
+				}
+
+				owed = owed.Sub(amount)
+				input.remaining = input.remaining.Sub(amount)
+				if !input.remaining.IsPositive() {
+					current++
+				}
+			}
+		}
+
+		for ; current < len(denomInputs); current++ {
+			if denomInputs[current].remaining.IsPositive() {
+				return nil, fmt.Errorf("multisend inputs exceed outputs for denom %s", denom)
+			}
+		}
+	}
+
+	for denom := range inputsByDenom {
+		if !seenDenoms[denom] {
+			return nil, fmt.Errorf("multisend inputs exceed outputs for denom %s", denom)
+		}
+	}
+
+	return transfers, nil
+}
+
+// IndexMessage stores the parsed transfers for the message.
+// The gorm db is wrapped in a transaction, so any errors will cause a rollback.
+func (c *TransfersParser) IndexMessage(dataset *any, db *gorm.DB, message models.Message, messageEvents []parsers.MessageEventWithAttributes, cfg config.IndexConfig) error {
+	transfers, ok := (*dataset).([]Transfer)
+	if !ok {
+		return errors.New("not a transfers dataset")
+	}
+
+	if len(transfers) == 0 {
+		return nil
+	}
+
+	addresses := make(map[string]models.Address)
+	denoms := make(map[string]models.Denom)
+
+	for i := range transfers {
+		sender, err := findOrCreateAddress(db, addresses, cfg.Probe.AccountPrefix, transfers[i].Sender.Address)
+		if err != nil {
+			return err
+		}
+
+		recipient, err := findOrCreateAddress(db, addresses, cfg.Probe.AccountPrefix, transfers[i].Recipient.Address)
+		if err != nil {
+			return err
+		}
+
+		denom, ok := denoms[transfers[i].Denom.Base]
+		if !ok {
+			denom, err = dbTypes.FindOrCreateDenomByBase(db.Statement.Context, db, transfers[i].Denom.Base)
+			if err != nil {
+				return err
+			}
+			denoms[denom.Base] = denom
+		}
+
+		transfers[i].Sender = sender
+		transfers[i].SenderID = sender.ID
+		transfers[i].Recipient = recipient
+		transfers[i].RecipientID = recipient.ID
+		transfers[i].Denom = denom
+		transfers[i].DenomID = denom.ID
+		transfers[i].Message = message
+		transfers[i].MessageID = message.ID
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "input_index"}, {Name: "output_index"}, {Name: "denom_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "sender_id", "recipient_id"}),
+	}).Omit(clause.Associations).Create(&transfers).Error
+}
+
+// normalizeAddress normalizes the address like the indexer normalizes the addresses of the txs, with
+// db.NormalizeAddress against the account prefix of the chain. It is left as is when the chain has no prefix.
+func normalizeAddress(prefix string, address string) (string, error) {
+	if prefix == "" {
+		return address, nil
+	}
+	return dbTypes.NormalizeAddress(address, prefix)
+}
+
+func findOrCreateAddress(db *gorm.DB, cache map[string]models.Address, prefix string, address string) (models.Address, error) {
+	address, err := normalizeAddress(prefix, address)
+	if err != nil {
+		return models.Address{}, err
+	}
+
+	if cached, ok := cache[address]; ok {
+		return cached, nil
+	}
+
+	dbAddress, err := dbTypes.FindOrCreateAddressByAddress(db.Statement.Context, db, address)
+	if err != nil {
+		return dbAddress, err
+	}
+
+	cache[address] = dbAddress
+	return dbAddress, nil
+}
+
+// GetTransfersByAddress returns all transfers sent or received by the address, including MultiSend outputs to recipients
+// that never signed a tx. The address is normalized against the account prefix of the chain like the stored addresses,
+// pass an empty prefix to look it up as is.
+func GetTransfersByAddress(db *gorm.DB, prefix string, address string) ([]Transfer, error) {
+	address, err := normalizeAddress(prefix, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var transfers []Transfer
+
+	err = db.
+		Joins("JOIN addresses ON addresses.id = transfers.sender_id OR addresses.id = transfers.recipient_id").
+		Where("addresses.address = ?", address).
+		Preload("Sender").
+		Preload("Recipient").
+		Preload("Denom").
+		Order("transfers.message_id, transfers.input_index, transfers.output_index, transfers.denom_id").
+		Find(&transfers).Error
+
+	return transfers, err
+}
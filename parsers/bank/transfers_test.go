@@ -0,0 +1,204 @@
+package bank
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/dbtest"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	bankTypes "github.com/cosmos/cosmos-sdk/x/bank/types"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type TransfersTestSuite struct {
+	suite.Suite
+}
+
+func coins(amount int64, denom string) sdkTypes.Coins {
+	return sdkTypes.NewCoins(sdkTypes.NewInt64Coin(denom, amount))
+}
+
+func (suite *TransfersTestSuite) TestSplitMultiSendSingleInput() {
+	inputs := []bankTypes.Input{{Address: "sender", Coins: coins(300, "uatom")}}
+	outputs := []bankTypes.Output{
+		{Address: "recipient1", Coins: coins(100, "uatom")},
+		{Address: "recipient2", Coins: coins(200, "uatom")},
+	}
+
+	transfers, err := SplitMultiSend(inputs, outputs)
+	suite.Require().NoError(err)
+	suite.Require().Len(transfers, 2)
+
+	suite.Assert().Equal("recipient1", transfers[0].Recipient.Address)
+	suite.Assert().Equal("100", transfers[0].Amount.String())
+	suite.Assert().Equal(0, transfers[0].OutputIndex)
+	suite.Assert().Equal("recipient2", transfers[1].Recipient.Address)
+	suite.Assert().Equal("200", transfers[1].Amount.String())
+	suite.Assert().Equal(1, transfers[1].OutputIndex)
+}
+
+func (suite *TransfersTestSuite) TestSplitMultiSendMultipleInputs() {
+	inputs := []bankTypes.Input{
+		{Address: "sender1", Coins: coins(150, "uatom")},
+		{Address: "sender2", Coins: coins(150, "uatom").Add(sdkTypes.NewInt64Coin("uosmo", 10))},
+	}
+	outputs := []bankTypes.Output{
+		{Address: "recipient1", Coins: coins(100, "uatom")},
+		{Address: "recipient2", Coins: coins(200, "uatom").Add(sdkTypes.NewInt64Coin("uosmo", 10))},
+	}
+
+	transfers, err := SplitMultiSend(inputs, outputs)
+	suite.Require().NoError(err)
+	suite.Require().Len(transfers, 4)
+
+	// sender1 covers recipient1 fully and part of recipient2, sender2 covers the rest
+	suite.Assert().Equal([]string{"sender1", "recipient1", "100"}, []string{transfers[0].Sender.Address, transfers[0].Recipient.Address, transfers[0].Amount.String()})
+	suite.Assert().Equal([]string{"sender1", "recipient2", "50"}, []string{transfers[1].Sender.Address, transfers[1].Recipient.Address, transfers[1].Amount.String()})
+	suite.Assert().Equal([]string{"sender2", "recipient2", "150"}, []string{transfers[2].Sender.Address, transfers[2].Recipient.Address, transfers[2].Amount.String()})
+	suite.Assert().Equal([]string{"sender2", "recipient2", "10", "uosmo"}, []string{transfers[3].Sender.Address, transfers[3].Recipient.Address, transfers[3].Amount.String(), transfers[3].Denom.Base})
+}
+
+func (suite *TransfersTestSuite) TestSplitMultiSendUnbalanced() {
+	inputs := []bankTypes.Input{{Address: "sender", Coins: coins(100, "uatom")}}
+	outputs := []bankTypes.Output{{Address: "recipient", Coins: coins(200, "uatom")}}
+
+	_, err := SplitMultiSend(inputs, outputs)
+	suite.Assert().Error(err)
+
+	_, err = SplitMultiSend(outputsAsInputs(outputs), []bankTypes.Output{{Address: "recipient", Coins: coins(100, "uatom")}})
+	suite.Assert().Error(err)
+}
+
+func outputsAsInputs(outputs []bankTypes.Output) []bankTypes.Input {
+	inputs := make([]bankTypes.Input, len(outputs))
+	for i, output := range outputs {
+		inputs[i] = bankTypes.Input{Address: output.Address, Coins: output.Coins}
+	}
+	return inputs
+}
+
+func (suite *TransfersTestSuite) TestGetTransfersByAddressMultiSendRecipient() {
+	clean, db, err := dbtest.Setup()
+	suite.Require().NoError(err)
+	defer clean()
+
+	err = dbTypes.MigrateModels(db)
+	suite.Require().NoError(err)
+	err = db.AutoMigrate(&Transfer{})
+	suite.Require().NoError(err)
+
+	signer := models.Address{Address: "signer"}
+	block := models.Block{
+		Chain:               models.Chain{ChainID: "testchain-1"},
+		Height:              1,
+		TimeStamp:           time.Now(),
+		ProposerConsAddress: models.Address{Address: "proposer"},
+	}
+	suite.Require().NoError(db.Create(&block).Error)
+
+	tx := models.Tx{Hash: "multisendhash", BlockID: block.ID, SignerAddresses: []models.Address{signer}}
+	suite.Require().NoError(db.Create(&tx).Error)
+
+	message := models.Message{TxID: tx.ID, MessageType: models.MessageType{MessageType: MsgMultiSendType}}
+	suite.Require().NoError(db.Create(&message).Error)
+
+	msg := &bankTypes.MsgMultiSend{
+		Inputs: []bankTypes.Input{{Address: signer.Address, Coins: coins(300, "uatom")}},
+		Outputs: []bankTypes.Output{
+			{Address: "recipient1", Coins: coins(100, "uatom")},
+			{Address: "recipient2", Coins: coins(200, "uatom")},
+		},
+	}
+
+	parser := &TransfersParser{Id: "bank-multisend"}
+	dataset, err := parser.ParseMessage(msg, nil, config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	err = db.Transaction(func(dbTransaction *gorm.DB) error {
+		return parser.IndexMessage(dataset, dbTransaction, message, nil, config.IndexConfig{})
+	})
+	suite.Require().NoError(err)
+
+	// recipient2 never signed a tx but must still see its output
+	transfers, err := GetTransfersByAddress(db, "", "recipient2")
+	suite.Require().NoError(err)
+	suite.Require().Len(transfers, 1)
+	suite.Assert().Equal(message.ID, transfers[0].MessageID)
+	suite.Assert().Equal(1, transfers[0].OutputIndex)
+	suite.Assert().Equal("200", transfers[0].Amount.String())
+	suite.Assert().Equal(signer.Address, transfers[0].Sender.Address)
+	suite.Assert().Equal("uatom", transfers[0].Denom.Base)
+
+	transfers, err = GetTransfersByAddress(db, "", signer.Address)
+	suite.Require().NoError(err)
+	suite.Assert().Len(transfers, 2)
+}
+
+func (suite *TransfersTestSuite) TestIndexMessageNormalizesAddresses() {
+	clean, db, err := dbtest.Setup()
+	suite.Require().NoError(err)
+	defer clean()
+
+	suite.Require().NoError(dbTypes.MigrateModels(db))
+	suite.Require().NoError(db.AutoMigrate(&Transfer{}))
+
+	cfg := config.IndexConfig{}
+	cfg.Probe.AccountPrefix = "cosmos"
+	sender, err := bech32.ConvertAndEncode("cosmos", bytes.Repeat([]byte{1}, 20))
+	suite.Require().NoError(err)
+	recipient, err := bech32.ConvertAndEncode("cosmos", bytes.Repeat([]byte{2}, 20))
+	suite.Require().NoError(err)
+
+	block := models.Block{
+		Chain:               models.Chain{ChainID: "testchain-1", Bech32Prefix: "cosmos"},
+		Height:              1,
+		TimeStamp:           time.Now(),
+		ProposerConsAddress: models.Address{Address: "proposer"},
+	}
+	suite.Require().NoError(db.Create(&block).Error)
+
+	tx := models.Tx{Hash: "sendhash", BlockID: block.ID, SignerAddresses: []models.Address{{Address: sender}}}
+	suite.Require().NoError(db.Create(&tx).Error)
+
+	parser := &TransfersParser{Id: "bank-send"}
+	// The same accounts in upper case and padded, as some clients send them
+	for index, addresses := range [][2]string{{sender, recipient}, {strings.ToUpper(sender), " " + strings.ToUpper(recipient) + " "}} {
+		message := models.Message{TxID: tx.ID, MessageIndex: index, MessageType: models.MessageType{MessageType: MsgSendType}}
+		suite.Require().NoError(db.Create(&message).Error)
+
+		dataset, err := parser.ParseMessage(&bankTypes.MsgSend{FromAddress: addresses[0], ToAddress: addresses[1], Amount: coins(100, "uatom")}, nil, cfg)
+		suite.Require().NoError(err)
+		suite.Require().NoError(db.Transaction(func(dbTransaction *gorm.DB) error {
+			return parser.IndexMessage(dataset, dbTransaction, message, nil, cfg)
+		}))
+	}
+
+	// No duplicate address rows were created
+	var count int64
+	suite.Require().NoError(db.Model(&models.Address{}).Where("address IN ?", []string{sender, recipient}).Count(&count).Error)
+	suite.Assert().Equal(int64(2), count)
+	suite.Require().NoError(db.Model(&models.Address{}).Where("LOWER(address) <> address OR address LIKE ?", " %").Count(&count).Error)
+	suite.Assert().Zero(count)
+
+	transfers, err := GetTransfersByAddress(db, "cosmos", strings.ToUpper(recipient))
+	suite.Require().NoError(err)
+	suite.Require().Len(transfers, 2)
+	suite.Assert().Equal(sender, transfers[1].Sender.Address)
+	suite.Assert().Equal(recipient, transfers[1].Recipient.Address)
+
+	// Addresses of another chain are rejected
+	_, err = GetTransfersByAddress(db, "osmo", recipient)
+	var invalid *dbTypes.InvalidAddressError
+	suite.Assert().ErrorAs(err, &invalid)
+}
+
+func TestTransfersSuite(t *testing.T) {
+	suite.Run(t, new(TransfersTestSuite))
+}
@@ -0,0 +1,282 @@
+package ibc
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	txtypes "github.com/DefiantLabs/cosmos-indexer/cosmos/modules/tx"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/parsers"
+	"github.com/DefiantLabs/cosmos-indexer/util"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	transferTypes "github.com/cosmos/ibc-go/v7/modules/apps/transfer/types"
+	clientTypes "github.com/cosmos/ibc-go/v7/modules/core/02-client/types"
+	channelTypes "github.com/cosmos/ibc-go/v7/modules/core/04-channel/types"
+	"gorm.io/gorm"
+)
+
+const (
+	MsgTransferType        = "/ibc.applications.transfer.v1.MsgTransfer"
+	MsgRecvPacketType      = "/ibc.core.channel.v1.MsgRecvPacket"
+	MsgAcknowledgementType = "/ibc.core.channel.v1.MsgAcknowledgement"
+	MsgTimeoutType         = "/ibc.core.channel.v1.MsgTimeout"
+	MsgTimeoutOnCloseType  = "/ibc.core.channel.v1.MsgTimeoutOnClose"
+)
+
+// PacketAction is an ICS-20 packet found in a message: sent by a MsgTransfer, or the result of a packet relayed to the
+// chain. Transfer is missing the chain ID and heights until the message is indexed.
+type PacketAction struct {
+	Send     bool
+	Transfer models.IBCTransfer
+}
+
+// TransfersParser is the reference MessageParser for ICS-20 transfers. It tracks the packets sent and received by the chain
+// in the core ibc_transfers table, register it for the transfer message and the packet messages relayed to the chain:
+//
+//	indexer.RegisterCustomMessageParser(ibc.MsgTransferType, &ibc.TransfersParser{Id: "ibc-transfer"})
+//	indexer.RegisterCustomMessageParser(ibc.MsgRecvPacketType, &ibc.TransfersParser{Id: "ibc-recv-packet"})
+//	indexer.RegisterCustomMessageParser(ibc.MsgAcknowledgementType, &ibc.TransfersParser{Id: "ibc-acknowledgement"})
+//	indexer.RegisterCustomMessageParser(ibc.MsgTimeoutType, &ibc.TransfersParser{Id: "ibc-timeout"})
+//	indexer.RegisterCustomMessageParser(ibc.MsgTimeoutOnCloseType, &ibc.TransfersParser{Id: "ibc-timeout-on-close"})
+//
+// Packets of other applications, such as interchain accounts, are skipped. So are packets relayed more than once, only
+// the relay that was processed by the chain emits the packet events.
+type TransfersParser struct {
+	Id string
+}
+
+func (c *TransfersParser) Identifier() string {
+	return c.Id
+}
+
+func (c *TransfersParser) ParseMessage(cosmosMsg sdkTypes.Msg, log *txtypes.LogMessage, cfg config.IndexConfig) (*any, error) {
+	var action PacketAction
+
+	switch msg := cosmosMsg.(type) {
+	case *transferTypes.MsgTransfer:
+		evts := txtypes.GetEventsWithType(channelTypes.EventTypeSendPacket, log)
+		if len(evts) == 0 {
+			return nil, errors.New("send_packet event not found")
+		}
+
+		packet, err := packetFromEvent(&evts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		transfer, ok := transferFromPacket(packet)
+		if !ok {
+			return nil, nil
+		}
+		transfer.Direction = models.IBCTransferOutgoing
+		transfer.Status = models.IBCTransferPending
+		action = PacketAction{Send: true, Transfer: transfer}
+	case *channelTypes.MsgRecvPacket:
+		evts := txtypes.GetEventsWithType(channelTypes.EventTypeWriteAck, log)
+		if len(evts) == 0 {
+			return nil, nil
+		}
+
+		transfer, ok := transferFromPacket(msg.Packet)
+		if !ok {
+			return nil, nil
+		}
+
+		ack, err := getAttributeBytes(&evts[0], channelTypes.AttributeKeyAckHex, channelTypes.AttributeKeyAck)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Status, transfer.Error, err = ackResult(ack)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Direction = models.IBCTransferIncoming
+		action = PacketAction{Transfer: transfer}
+	case *channelTypes.MsgAcknowledgement:
+		if len(txtypes.GetEventsWithType(channelTypes.EventTypeAcknowledgePacket, log)) == 0 {
+			return nil, nil
+		}
+
+		transfer, ok := transferFromPacket(msg.Packet)
+		if !ok {
+			return nil, nil
+		}
+
+		var err error
+		transfer.Status, transfer.Error, err = ackResult(msg.Acknowledgement)
+		if err != nil {
+			return nil, err
+		}
+		transfer.Direction = models.IBCTransferOutgoing
+		action = PacketAction{Transfer: transfer}
+	case *channelTypes.MsgTimeout, *channelTypes.MsgTimeoutOnClose:
+		packet, eventType := timeoutPacket(msg)
+		if len(txtypes.GetEventsWithType(eventType, log)) == 0 {
+			return nil, nil
+		}
+
+		transfer, ok := transferFromPacket(packet)
+		if !ok {
+			return nil, nil
+		}
+		transfer.Direction = models.IBCTransferOutgoing
+		transfer.Status = models.IBCTransferTimedOut
+		action = PacketAction{Transfer: transfer}
+	default:
+		return nil, errors.New("not an ibc transfer or packet message")
+	}
+
+	storageVal := any(action)
+	return &storageVal, nil
+}
+
+func timeoutPacket(msg sdkTypes.Msg) (channelTypes.Packet, string) {
+	if timeout, ok := msg.(*channelTypes.MsgTimeoutOnClose); ok {
+		return timeout.Packet, channelTypes.EventTypeTimeoutPacketOnClose
+	}
+	return msg.(*channelTypes.MsgTimeout).Packet, channelTypes.EventTypeTimeoutPacket
+}
+
+// transferFromPacket returns the transfer of the packet, false when the packet is not an ICS-20 packet
+func transferFromPacket(packet channelTypes.Packet) (models.IBCTransfer, bool) {
+	var data transferTypes.FungibleTokenPacketData
+	if err := transferTypes.ModuleCdc.UnmarshalJSON(packet.Data, &data); err != nil {
+		return models.IBCTransfer{}, false
+	}
+
+	amount, ok := sdkTypes.NewIntFromString(data.Amount)
+	if !ok || data.Denom == "" {
+		return models.IBCTransfer{}, false
+	}
+
+	return models.IBCTransfer{
+		SourcePort:         packet.SourcePort,
+		SourceChannel:      packet.SourceChannel,
+		DestinationPort:    packet.DestinationPort,
+		DestinationChannel: packet.DestinationChannel,
+		Sequence:           packet.Sequence,
+		Sender:             data.Sender,
+		Receiver:           data.Receiver,
+		Amount:             util.ToNumeric(amount.BigInt()),
+		Denom:              data.Denom,
+		Memo:               data.Memo,
+		TimeoutHeight:      packet.TimeoutHeight.String(),
+		TimeoutTimestamp:   packet.TimeoutTimestamp,
+	}, true
+}
+
+// ackResult returns the status and error of the transfer from its acknowledgement
+func ackResult(bz []byte) (string, string, error) {
+	var ack channelTypes.Acknowledgement
+	if err := transferTypes.ModuleCdc.UnmarshalJSON(bz, &ack); err != nil {
+		return "", "", fmt.Errorf("error decoding acknowledgement: %w", err)
+	}
+
+	if !ack.Success() {
+		return models.IBCTransferFailed, ack.GetError(), nil
+	}
+	return models.IBCTransferCompleted, "", nil
+}
+
+// packetFromEvent reads the packet from the attributes of a send_packet event
+func packetFromEvent(evt *txtypes.LogMessageEvent) (channelTypes.Packet, error) {
+	var packet channelTypes.Packet
+
+	sequence, err := txtypes.GetValueForAttribute(channelTypes.AttributeKeySequence, evt)
+	if err != nil {
+		return packet, err
+	}
+	packet.Sequence, err = strconv.ParseUint(sequence, 10, 64)
+	if err != nil {
+		return packet, fmt.Errorf("error parsing packet sequence: %w", err)
+	}
+
+	for key, value := range map[string]*string{
+		channelTypes.AttributeKeySrcPort:    &packet.SourcePort,
+		channelTypes.AttributeKeySrcChannel: &packet.SourceChannel,
+		channelTypes.AttributeKeyDstPort:    &packet.DestinationPort,
+		channelTypes.AttributeKeyDstChannel: &packet.DestinationChannel,
+	} {
+		*value, err = txtypes.GetValueForAttribute(key, evt)
+		if err != nil {
+			return packet, err
+		}
+	}
+
+	packet.Data, err = getAttributeBytes(evt, channelTypes.AttributeKeyDataHex, channelTypes.AttributeKeyData)
+	if err != nil {
+		return packet, err
+	}
+
+	timeoutHeight, err := txtypes.GetValueForAttribute(channelTypes.AttributeKeyTimeoutHeight, evt)
+	if err != nil {
+		return packet, err
+	}
+	if timeoutHeight != "" {
+		packet.TimeoutHeight, err = clientTypes.ParseHeight(timeoutHeight)
+		if err != nil {
+			return packet, fmt.Errorf("error parsing packet timeout height: %w", err)
+		}
+	}
+
+	timeoutTimestamp, err := txtypes.GetValueForAttribute(channelTypes.AttributeKeyTimeoutTimestamp, evt)
+	if err != nil {
+		return packet, err
+	}
+	if timeoutTimestamp != "" {
+		packet.TimeoutTimestamp, err = strconv.ParseUint(timeoutTimestamp, 10, 64)
+		if err != nil {
+			return packet, fmt.Errorf("error parsing packet timeout timestamp: %w", err)
+		}
+	}
+
+	return packet, nil
+}
+
+// getAttributeBytes returns the value of the hex encoded attribute, or of the deprecated attribute with the raw value
+// emitted by older versions of ibc-go
+func getAttributeBytes(evt *txtypes.LogMessageEvent, hexKey string, rawKey string) ([]byte, error) {
+	value, err := txtypes.GetValueForAttribute(hexKey, evt)
+	if err != nil {
+		return nil, err
+	}
+	if value != "" {
+		return hex.DecodeString(value)
+	}
+
+	value, err = txtypes.GetValueForAttribute(rawKey, evt)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, fmt.Errorf("%s event is missing the %s attribute", evt.Type, hexKey)
+	}
+	return []byte(value), nil
+}
+
+// IndexMessage stores the transfer of the packet. The gorm db is wrapped in a transaction, so any errors will cause a rollback.
+func (c *TransfersParser) IndexMessage(dataset *any, db *gorm.DB, message models.Message, messageEvents []parsers.MessageEventWithAttributes, cfg config.IndexConfig) error {
+	action, ok := (*dataset).(PacketAction)
+	if !ok {
+		return errors.New("not a packet action dataset")
+	}
+
+	transfer := action.Transfer
+	transfer.ChainID = message.Tx.Block.ChainID
+	height := message.Tx.Block.Height
+
+	if action.Send {
+		transfer.Height = height
+		return dbTypes.UpsertIBCTransferSend(db.Statement.Context, db, transfer)
+	}
+
+	transfer.ResultHeight = &height
+	if transfer.Direction == models.IBCTransferIncoming {
+		transfer.Height = height
+	}
+	return dbTypes.UpsertIBCTransferResult(db.Statement.Context, db, transfer)
+}
@@ -0,0 +1,221 @@
+//go:build cgo
+
+package ibc
+
+import (
+	"context"
+	"encoding/hex"
+	"strconv"
+	"testing"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	txtypes "github.com/DefiantLabs/cosmos-indexer/cosmos/modules/tx"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	transferTypes "github.com/cosmos/ibc-go/v7/modules/apps/transfer/types"
+	clientTypes "github.com/cosmos/ibc-go/v7/modules/core/02-client/types"
+	channelTypes "github.com/cosmos/ibc-go/v7/modules/core/04-channel/types"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+// Packets in the format relayed between Osmosis (channel-0) and the Cosmos Hub (channel-141), the packet data and
+// acknowledgements are the bytes committed by ibc-go
+const (
+	osmosisToHubPacketData = `{"amount":"2500000","denom":"uosmo","receiver":"cosmos1vzxkv3lxccnttr9rs0002s93sgw72h7ghukuhs","sender":"osmo1vzxkv3lxccnttr9rs0002s93sgw72h7gl89vpz"}`
+	hubToOsmosisPacketData = `{"amount":"1000000","denom":"uatom","memo":"","receiver":"osmo1vzxkv3lxccnttr9rs0002s93sgw72h7gl89vpz","sender":"cosmos1vzxkv3lxccnttr9rs0002s93sgw72h7ghukuhs"}`
+	icaPacketData          = `{"type":"TYPE_EXECUTE_TX","data":"CgQKAgoA","memo":""}`
+	resultAck              = `{"result":"AQ=="}`
+	errorAck               = `{"error":"ABCI code: 5: error handling packet: see events for details"}`
+)
+
+type TransfersTestSuite struct {
+	suite.Suite
+	db      *gorm.DB
+	parser  *TransfersParser
+	chainID uint
+}
+
+func (suite *TransfersTestSuite) SetupTest() {
+	db, err := dbTypes.SqliteDbConnect(":memory:", "silent")
+	suite.Require().NoError(err)
+	suite.Require().NoError(dbTypes.MigrateModels(db))
+	suite.db = db
+	suite.parser = &TransfersParser{Id: "ibc-transfers"}
+
+	suite.chainID, err = dbTypes.GetDBChainID(context.Background(), db, models.Chain{ChainID: "osmosis-1", Name: "osmosis"})
+	suite.Require().NoError(err)
+}
+
+func osmosisToHubPacket(sequence uint64) channelTypes.Packet {
+	return channelTypes.Packet{
+		Sequence:           sequence,
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-0",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-141",
+		Data:               []byte(osmosisToHubPacketData),
+		TimeoutHeight:      clientTypes.NewHeight(4, 18954321),
+		TimeoutTimestamp:   1700000000000000000,
+	}
+}
+
+func sendPacketLog(packet channelTypes.Packet) *txtypes.LogMessage {
+	return &txtypes.LogMessage{Events: []txtypes.LogMessageEvent{{
+		Type: channelTypes.EventTypeSendPacket,
+		Attributes: []txtypes.Attribute{
+			{Key: channelTypes.AttributeKeyData, Value: string(packet.Data)},
+			{Key: channelTypes.AttributeKeyDataHex, Value: hex.EncodeToString(packet.Data)},
+			{Key: channelTypes.AttributeKeyTimeoutHeight, Value: packet.TimeoutHeight.String()},
+			{Key: channelTypes.AttributeKeyTimeoutTimestamp, Value: "1700000000000000000"},
+			{Key: channelTypes.AttributeKeySequence, Value: strconv.FormatUint(packet.Sequence, 10)},
+			{Key: channelTypes.AttributeKeySrcPort, Value: packet.SourcePort},
+			{Key: channelTypes.AttributeKeySrcChannel, Value: packet.SourceChannel},
+			{Key: channelTypes.AttributeKeyDstPort, Value: packet.DestinationPort},
+			{Key: channelTypes.AttributeKeyDstChannel, Value: packet.DestinationChannel},
+			{Key: channelTypes.AttributeKeyChannelOrdering, Value: "ORDER_UNORDERED"},
+			{Key: channelTypes.AttributeKeyConnection, Value: "connection-1"},
+		},
+	}}}
+}
+
+func eventLog(eventType string, attributes ...txtypes.Attribute) *txtypes.LogMessage {
+	return &txtypes.LogMessage{Events: []txtypes.LogMessageEvent{{Type: eventType, Attributes: attributes}}}
+}
+
+// index parses and indexes the message as if it was in a block at the height
+func (suite *TransfersTestSuite) index(msg sdkTypes.Msg, log *txtypes.LogMessage, height int64) {
+	dataset, err := suite.parser.ParseMessage(msg, log, config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Require().NotNil(dataset)
+
+	message := models.Message{Tx: models.Tx{Block: models.Block{ChainID: suite.chainID, Height: height}}}
+	suite.Require().NoError(suite.parser.IndexMessage(dataset, suite.db, message, nil, config.IndexConfig{}))
+}
+
+func (suite *TransfersTestSuite) transfers(address string) []models.IBCTransfer {
+	transfers, err := dbTypes.GetIBCTransfersByAddress(context.Background(), suite.db, dbTypes.ChainRef{ID: suite.chainID}, address)
+	suite.Require().NoError(err)
+	return transfers
+}
+
+func (suite *TransfersTestSuite) TestOutgoingTransfer() {
+	packet := osmosisToHubPacket(1942037)
+	transfer := &transferTypes.MsgTransfer{
+		SourcePort:       "transfer",
+		SourceChannel:    "channel-0",
+		Token:            sdkTypes.NewInt64Coin("uosmo", 2500000),
+		Sender:           "osmo1vzxkv3lxccnttr9rs0002s93sgw72h7gl89vpz",
+		Receiver:         "cosmos1vzxkv3lxccnttr9rs0002s93sgw72h7ghukuhs",
+		TimeoutHeight:    packet.TimeoutHeight,
+		TimeoutTimestamp: packet.TimeoutTimestamp,
+	}
+	suite.index(transfer, sendPacketLog(packet), 12000000)
+
+	pending, err := dbTypes.GetPendingIBCTransfers(context.Background(), suite.db, dbTypes.ChainRef{ID: suite.chainID})
+	suite.Require().NoError(err)
+	suite.Require().Len(pending, 1)
+	suite.Assert().Equal(models.IBCTransferOutgoing, pending[0].Direction)
+	suite.Assert().Equal(uint64(1942037), pending[0].Sequence)
+	suite.Assert().Equal("channel-0", pending[0].SourceChannel)
+	suite.Assert().Equal("channel-141", pending[0].DestinationChannel)
+	suite.Assert().Equal("2500000", pending[0].Amount.String())
+	suite.Assert().Equal("uosmo", pending[0].Denom)
+	suite.Assert().Equal("4-18954321", pending[0].TimeoutHeight)
+	suite.Assert().Equal(uint64(1700000000000000000), pending[0].TimeoutTimestamp)
+	suite.Assert().Equal(int64(12000000), pending[0].Height)
+
+	// The acknowledgement is relayed back some blocks later
+	ack := &channelTypes.MsgAcknowledgement{Packet: packet, Acknowledgement: []byte(resultAck)}
+	suite.index(ack, eventLog(channelTypes.EventTypeAcknowledgePacket), 12000042)
+
+	pending, err = dbTypes.GetPendingIBCTransfers(context.Background(), suite.db, dbTypes.ChainRef{ID: suite.chainID})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(pending)
+
+	transfers := suite.transfers("cosmos1vzxkv3lxccnttr9rs0002s93sgw72h7ghukuhs")
+	suite.Require().Len(transfers, 1)
+	suite.Assert().Equal(models.IBCTransferCompleted, transfers[0].Status)
+	suite.Require().NotNil(transfers[0].ResultHeight)
+	suite.Assert().Equal(int64(12000042), *transfers[0].ResultHeight)
+	suite.Assert().Equal(int64(12000000), transfers[0].Height)
+}
+
+func (suite *TransfersTestSuite) TestResultIndexedBeforeSend() {
+	packet := osmosisToHubPacket(1942038)
+
+	// Blocks are indexed out of order, the timeout keeps its status when the send is indexed after it
+	timeout := &channelTypes.MsgTimeout{Packet: packet, NextSequenceRecv: 1942038}
+	suite.index(timeout, eventLog(channelTypes.EventTypeTimeoutPacket), 12000500)
+
+	transfer := &transferTypes.MsgTransfer{SourcePort: "transfer", SourceChannel: "channel-0", Token: sdkTypes.NewInt64Coin("uosmo", 2500000)}
+	suite.index(transfer, sendPacketLog(packet), 12000100)
+
+	transfers := suite.transfers("osmo1vzxkv3lxccnttr9rs0002s93sgw72h7gl89vpz")
+	suite.Require().Len(transfers, 1)
+	suite.Assert().Equal(models.IBCTransferTimedOut, transfers[0].Status)
+	suite.Assert().Equal(int64(12000100), transfers[0].Height)
+	suite.Assert().Equal(int64(12000500), *transfers[0].ResultHeight)
+}
+
+func (suite *TransfersTestSuite) TestFailedAcknowledgement() {
+	ack := &channelTypes.MsgAcknowledgement{Packet: osmosisToHubPacket(1942039), Acknowledgement: []byte(errorAck)}
+	suite.index(ack, eventLog(channelTypes.EventTypeAcknowledgePacket), 12000600)
+
+	transfers := suite.transfers("osmo1vzxkv3lxccnttr9rs0002s93sgw72h7gl89vpz")
+	suite.Require().Len(transfers, 1)
+	suite.Assert().Equal(models.IBCTransferFailed, transfers[0].Status)
+	suite.Assert().Equal("ABCI code: 5: error handling packet: see events for details", transfers[0].Error)
+}
+
+func (suite *TransfersTestSuite) TestIncomingTransfer() {
+	packet := channelTypes.Packet{
+		Sequence:           2318849,
+		SourcePort:         "transfer",
+		SourceChannel:      "channel-141",
+		DestinationPort:    "transfer",
+		DestinationChannel: "channel-0",
+		Data:               []byte(hubToOsmosisPacketData),
+		TimeoutTimestamp:   1700000600000000000,
+	}
+	recv := &channelTypes.MsgRecvPacket{Packet: packet}
+	log := eventLog(channelTypes.EventTypeWriteAck,
+		txtypes.Attribute{Key: channelTypes.AttributeKeyAck, Value: resultAck},
+		txtypes.Attribute{Key: channelTypes.AttributeKeyAckHex, Value: hex.EncodeToString([]byte(resultAck))},
+	)
+	suite.index(recv, log, 12000700)
+
+	transfers := suite.transfers("osmo1vzxkv3lxccnttr9rs0002s93sgw72h7gl89vpz")
+	suite.Require().Len(transfers, 1)
+	suite.Assert().Equal(models.IBCTransferIncoming, transfers[0].Direction)
+	suite.Assert().Equal(models.IBCTransferCompleted, transfers[0].Status)
+	suite.Assert().Equal("uatom", transfers[0].Denom)
+	suite.Assert().Equal("0-0", transfers[0].TimeoutHeight)
+	suite.Assert().Equal(int64(12000700), transfers[0].Height)
+
+	// Incoming transfers are never pending
+	pending, err := dbTypes.GetPendingIBCTransfers(context.Background(), suite.db, dbTypes.ChainRef{ID: suite.chainID})
+	suite.Require().NoError(err)
+	suite.Assert().Empty(pending)
+}
+
+func (suite *TransfersTestSuite) TestSkippedPackets() {
+	// A packet relayed again after it was received emits no events
+	recv := &channelTypes.MsgRecvPacket{Packet: osmosisToHubPacket(1)}
+	dataset, err := suite.parser.ParseMessage(recv, &txtypes.LogMessage{}, config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Assert().Nil(dataset)
+
+	// Interchain account packets are not transfers
+	packet := osmosisToHubPacket(1)
+	packet.SourcePort, packet.Data = "icacontroller-osmo1vzxkv3lxccnttr9rs0002s93sgw72h7gl89vpz", []byte(icaPacketData)
+	ack := &channelTypes.MsgAcknowledgement{Packet: packet, Acknowledgement: []byte(resultAck)}
+	dataset, err = suite.parser.ParseMessage(ack, eventLog(channelTypes.EventTypeAcknowledgePacket), config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Assert().Nil(dataset)
+}
+
+func TestTransfersSuite(t *testing.T) {
+	suite.Run(t, new(TransfersTestSuite))
+}
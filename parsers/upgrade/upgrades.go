@@ -0,0 +1,354 @@
+package upgrade
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	txtypes "github.com/DefiantLabs/cosmos-indexer/cosmos/modules/tx"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	"github.com/DefiantLabs/cosmos-indexer/parsers"
+	abci "github.com/cometbft/cometbft/abci/types"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	govTypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	govV1 "github.com/cosmos/cosmos-sdk/x/gov/types/v1"
+	govV1Beta1 "github.com/cosmos/cosmos-sdk/x/gov/types/v1beta1"
+	upgradeTypes "github.com/cosmos/cosmos-sdk/x/upgrade/types"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MsgSoftwareUpgradeType       = "/cosmos.upgrade.v1beta1.MsgSoftwareUpgrade"
+	MsgCancelUpgradeType         = "/cosmos.upgrade.v1beta1.MsgCancelUpgrade"
+	MsgSubmitProposalV1Type      = "/cosmos.gov.v1.MsgSubmitProposal"
+	MsgSubmitProposalV1Beta1Type = "/cosmos.gov.v1beta1.MsgSubmitProposal"
+)
+
+// PlanAction is an upgrade plan or cancellation found in a message. Actions submitted in a governance proposal only take effect
+// if the proposal passes, ProposalID links them to the ProposalResult.
+type PlanAction struct {
+	ID              uint
+	Message         models.Message
+	MessageID       uint `gorm:"uniqueIndex:idx_plan_action_message_index,priority:1"`
+	Index           int  `gorm:"uniqueIndex:idx_plan_action_message_index,priority:2"`
+	ChainID         uint `gorm:"index:idx_plan_action_chain"`
+	Cancel          bool
+	Name            string
+	PlanHeight      int64
+	Info            string
+	ProposalID      *uint64
+	SubmittedHeight int64
+}
+
+// ProposalResult is the outcome of a governance proposal, taken from the active_proposal EndBlock event
+type ProposalResult struct {
+	ID         uint
+	ChainID    uint   `gorm:"uniqueIndex:idx_proposal_result_chain_proposal,priority:1"`
+	ProposalID uint64 `gorm:"uniqueIndex:idx_proposal_result_chain_proposal,priority:2"`
+	Result     string
+	Height     int64
+}
+
+// PlansParser is the MessageParser for upgrade plans and cancellations, sent directly by the upgrade authority or in a governance
+// proposal. It is paired with the ProposalResultsParser, register both along with the models:
+//
+//	indexer.RegisterCustomModels([]any{&upgrade.PlanAction{}, &upgrade.ProposalResult{}})
+//	indexer.RegisterCustomMessageParser(upgrade.MsgSoftwareUpgradeType, &upgrade.PlansParser{Id: "upgrade-software-upgrade"})
+//	indexer.RegisterCustomMessageParser(upgrade.MsgCancelUpgradeType, &upgrade.PlansParser{Id: "upgrade-cancel-upgrade"})
+//	indexer.RegisterCustomMessageParser(upgrade.MsgSubmitProposalV1Type, &upgrade.PlansParser{Id: "upgrade-gov-v1-proposal"})
+//	indexer.RegisterCustomMessageParser(upgrade.MsgSubmitProposalV1Beta1Type, &upgrade.PlansParser{Id: "upgrade-gov-v1beta1-proposal"})
+//	indexer.RegisterCustomEndBlockEventParser(govTypes.EventTypeActiveProposal, &upgrade.ProposalResultsParser{Id: "upgrade-proposal-results"})
+//
+// Every change rebuilds the chain's rows in the core upgrades table.
+type PlansParser struct {
+	Id string
+}
+
+func (c *PlansParser) Identifier() string {
+	return c.Id
+}
+
+func (c *PlansParser) ParseMessage(cosmosMsg sdkTypes.Msg, log *txtypes.LogMessage, cfg config.IndexConfig) (*any, error) {
+	var actions []PlanAction
+	fromProposal := false
+
+	switch msg := cosmosMsg.(type) {
+	case *upgradeTypes.MsgSoftwareUpgrade, *upgradeTypes.MsgCancelUpgrade:
+		actions = appendPlanAction(actions, msg)
+	case *govV1.MsgSubmitProposal:
+		fromProposal = true
+		proposalMsgs, err := msg.GetMsgs()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, proposalMsg := range proposalMsgs {
+			if legacyMsg, ok := proposalMsg.(*govV1.MsgExecLegacyContent); ok {
+				content, err := govV1.LegacyContentFromMessage(legacyMsg)
+				if err != nil {
+					return nil, err
+				}
+				actions = appendPlanAction(actions, content)
+				continue
+			}
+			actions = appendPlanAction(actions, proposalMsg)
+		}
+	case *govV1Beta1.MsgSubmitProposal:
+		fromProposal = true
+		actions = appendPlanAction(actions, msg.GetContent())
+	default:
+		return nil, errors.New("not an upgrade plan or governance proposal message")
+	}
+
+	// Proposals without an upgrade are not stored
+	if len(actions) == 0 {
+		return nil, nil
+	}
+
+	if fromProposal {
+		proposalID, err := getProposalID(log)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range actions {
+			actions[i].ProposalID = &proposalID
+		}
+	}
+
+	storageVal := any(actions)
+	return &storageVal, nil
+}
+
+func appendPlanAction(actions []PlanAction, value any) []PlanAction {
+	var action PlanAction
+
+	switch upgradeValue := value.(type) {
+	case *upgradeTypes.MsgSoftwareUpgrade:
+		action = PlanAction{Name: upgradeValue.Plan.Name, PlanHeight: upgradeValue.Plan.Height, Info: upgradeValue.Plan.Info}
+	case *upgradeTypes.SoftwareUpgradeProposal: //nolint:staticcheck // Legacy proposals are still found in older blocks
+		action = PlanAction{Name: upgradeValue.Plan.Name, PlanHeight: upgradeValue.Plan.Height, Info: upgradeValue.Plan.Info}
+	case *upgradeTypes.MsgCancelUpgrade, *upgradeTypes.CancelSoftwareUpgradeProposal: //nolint:staticcheck // Legacy proposals are still found in older blocks
+		action = PlanAction{Cancel: true}
+	default:
+		return actions
+	}
+
+	action.Index = len(actions)
+	return append(actions, action)
+}
+
+func getProposalID(log *txtypes.LogMessage) (uint64, error) {
+	// get event log for submit_proposal event, this contains the created proposal's id
+	evts := txtypes.GetEventsWithType(govTypes.EventTypeSubmitProposal, log)
+	if len(evts) == 0 {
+		return 0, errors.New("submit_proposal event not found")
+	}
+
+	proposalIDStr, err := txtypes.GetValueForAttribute(govTypes.AttributeKeyProposalID, &evts[0])
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(proposalIDStr, 10, 64)
+}
+
+// IndexMessage stores the plan actions for the message and rebuilds the chain's upgrades.
+// The gorm db is wrapped in a transaction, so any errors will cause a rollback.
+func (c *PlansParser) IndexMessage(dataset *any, db *gorm.DB, message models.Message, messageEvents []parsers.MessageEventWithAttributes, cfg config.IndexConfig) error {
+	actions, ok := (*dataset).([]PlanAction)
+	if !ok {
+		return errors.New("not a plan actions dataset")
+	}
+
+	if len(actions) == 0 {
+		return nil
+	}
+
+	for i := range actions {
+		actions[i].MessageID = message.ID
+		actions[i].ChainID = message.Tx.Block.ChainID
+		actions[i].SubmittedHeight = message.Tx.Block.Height
+	}
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "index"}},
+		DoUpdates: clause.AssignmentColumns([]string{"chain_id", "cancel", "name", "plan_height", "info", "proposal_id", "submitted_height"}),
+	}).Omit(clause.Associations).Create(&actions).Error
+	if err != nil {
+		return err
+	}
+
+	return RebuildUpgrades(db, message.Tx.Block.ChainID)
+}
+
+// ProposalResultsParser is the EndBlock event parser for governance proposal results, see PlansParser for registration
+type ProposalResultsParser struct {
+	Id string
+}
+
+func (c *ProposalResultsParser) Identifier() string {
+	return c.Id
+}
+
+func (c *ProposalResultsParser) ParseBlockEvent(event abci.Event, cfg config.IndexConfig) (*any, error) {
+	if event.Type != govTypes.EventTypeActiveProposal {
+		return nil, errors.New("not an active proposal event")
+	}
+
+	var result ProposalResult
+	var foundID bool
+
+	for _, attribute := range event.Attributes {
+		switch attribute.Key {
+		case govTypes.AttributeKeyProposalID:
+			proposalID, err := strconv.ParseUint(attribute.Value, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			result.ProposalID = proposalID
+			foundID = true
+		case govTypes.AttributeKeyProposalResult:
+			result.Result = attribute.Value
+		}
+	}
+
+	if !foundID || result.Result == "" {
+		return nil, errors.New("active proposal event is missing the proposal id or result")
+	}
+
+	storageVal := any(result)
+	return &storageVal, nil
+}
+
+// IndexBlockEvent stores the proposal result and rebuilds the chain's upgrades if the proposal contained any plan actions
+func (c *ProposalResultsParser) IndexBlockEvent(dataset *any, db *gorm.DB, block models.Block, blockEvent models.BlockEvent, attributes []models.BlockEventAttribute, cfg config.IndexConfig) error {
+	result, ok := (*dataset).(ProposalResult)
+	if !ok {
+		return errors.New("not a proposal result dataset")
+	}
+
+	result.ChainID = block.ChainID
+	result.Height = block.Height
+
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "chain_id"}, {Name: "proposal_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"result", "height"}),
+	}).Create(&result).Error
+	if err != nil {
+		return err
+	}
+
+	var actionCount int64
+	if err := db.Model(&PlanAction{}).Where("chain_id = ? AND proposal_id = ?", block.ChainID, result.ProposalID).Count(&actionCount).Error; err != nil {
+		return err
+	}
+
+	if actionCount == 0 {
+		return nil
+	}
+
+	return RebuildUpgrades(db, block.ChainID)
+}
+
+// RebuildUpgrades replaces the chain's rows in the upgrades table with the upgrades resolved from its plan actions and proposal results.
+// Both are stored as they are indexed and resolved together, so the result does not depend on the order blocks are indexed in.
+func RebuildUpgrades(db *gorm.DB, chainID uint) error {
+	var actions []PlanAction
+	if err := db.Where("chain_id = ?", chainID).Find(&actions).Error; err != nil {
+		return err
+	}
+
+	var results []ProposalResult
+	if err := db.Where("chain_id = ?", chainID).Find(&results).Error; err != nil {
+		return err
+	}
+
+	upgrades := ResolveUpgrades(actions, results)
+	for i := range upgrades {
+		upgrades[i].ChainID = chainID
+	}
+
+	if err := db.Where("chain_id = ?", chainID).Delete(&models.Upgrade{}).Error; err != nil {
+		return err
+	}
+
+	if len(upgrades) == 0 {
+		return nil
+	}
+
+	return db.Omit(clause.Associations).Create(&upgrades).Error
+}
+
+// ResolveUpgrades replays the plan actions in the order they took effect, following the x/upgrade rules: scheduling a plan
+// replaces any pending plan and a cancellation removes it. Plans that already reached their plan height are unaffected.
+// Proposal actions take effect at the end block of a passed proposal, and never for other results.
+func ResolveUpgrades(actions []PlanAction, results []ProposalResult) []models.Upgrade {
+	passedHeights := make(map[uint64]int64)
+	for _, result := range results {
+		if result.Result == govTypes.AttributeValueProposalPassed {
+			passedHeights[result.ProposalID] = result.Height
+		}
+	}
+
+	type effectiveAction struct {
+		PlanAction
+		height int64
+	}
+
+	var effective []effectiveAction
+	for _, action := range actions {
+		height := action.SubmittedHeight
+		if action.ProposalID != nil {
+			passedHeight, passed := passedHeights[*action.ProposalID]
+			if !passed {
+				continue
+			}
+			height = passedHeight
+		}
+		effective = append(effective, effectiveAction{PlanAction: action, height: height})
+	}
+
+	sort.SliceStable(effective, func(i, j int) bool {
+		if effective[i].height != effective[j].height {
+			return effective[i].height < effective[j].height
+		}
+		if effective[i].MessageID != effective[j].MessageID {
+			return effective[i].MessageID < effective[j].MessageID
+		}
+		return effective[i].Index < effective[j].Index
+	})
+
+	var upgrades []models.Upgrade
+	pending := -1
+
+	for _, action := range effective {
+		if pending != -1 && upgrades[pending].PlanHeight > action.height {
+			cancelledHeight := action.height
+			upgrades[pending].Cancelled = true
+			upgrades[pending].CancelledHeight = &cancelledHeight
+		}
+		pending = -1
+
+		if action.Cancel {
+			continue
+		}
+
+		upgrades = append(upgrades, models.Upgrade{
+			Name:            action.Name,
+			PlanHeight:      action.PlanHeight,
+			Info:            action.Info,
+			ProposalID:      action.ProposalID,
+			ScheduledHeight: action.height,
+		})
+		pending = len(upgrades) - 1
+	}
+
+	sort.SliceStable(upgrades, func(i, j int) bool {
+		return upgrades[i].PlanHeight < upgrades[j].PlanHeight
+	})
+
+	return upgrades
+}
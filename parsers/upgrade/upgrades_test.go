@@ -0,0 +1,180 @@
+package upgrade
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	txtypes "github.com/DefiantLabs/cosmos-indexer/cosmos/modules/tx"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/db/dbtest"
+	"github.com/DefiantLabs/cosmos-indexer/db/models"
+	abci "github.com/cometbft/cometbft/abci/types"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	govTypes "github.com/cosmos/cosmos-sdk/x/gov/types"
+	govV1 "github.com/cosmos/cosmos-sdk/x/gov/types/v1"
+	upgradeTypes "github.com/cosmos/cosmos-sdk/x/upgrade/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type UpgradesTestSuite struct {
+	suite.Suite
+}
+
+func proposalID(id uint64) *uint64 {
+	return &id
+}
+
+func submitProposalLog(id string) *txtypes.LogMessage {
+	return &txtypes.LogMessage{Events: []txtypes.LogMessageEvent{{
+		Type:       govTypes.EventTypeSubmitProposal,
+		Attributes: []txtypes.Attribute{{Key: govTypes.AttributeKeyProposalID, Value: id}},
+	}}}
+}
+
+func (suite *UpgradesTestSuite) TestParseV1Proposal() {
+	msg, err := govV1.NewMsgSubmitProposal([]sdkTypes.Msg{
+		&upgradeTypes.MsgSoftwareUpgrade{Authority: "gov", Plan: upgradeTypes.Plan{Name: "v2", Height: 100, Info: "binaries"}},
+	}, nil, "proposer", "", "v2", "upgrade to v2")
+	suite.Require().NoError(err)
+
+	parser := &PlansParser{Id: "upgrade-gov-v1-proposal"}
+	dataset, err := parser.ParseMessage(msg, submitProposalLog("7"), config.IndexConfig{})
+	suite.Require().NoError(err)
+
+	actions, ok := (*dataset).([]PlanAction)
+	suite.Require().True(ok)
+	suite.Assert().Equal([]PlanAction{{Name: "v2", PlanHeight: 100, Info: "binaries", ProposalID: proposalID(7)}}, actions)
+}
+
+func (suite *UpgradesTestSuite) TestParseProposalWithoutUpgrade() {
+	msg, err := govV1.NewMsgSubmitProposal(nil, nil, "proposer", "", "text", "text proposal")
+	suite.Require().NoError(err)
+
+	parser := &PlansParser{Id: "upgrade-gov-v1-proposal"}
+	dataset, err := parser.ParseMessage(msg, submitProposalLog("8"), config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Assert().Nil(dataset)
+}
+
+func (suite *UpgradesTestSuite) TestParseProposalResult() {
+	parser := &ProposalResultsParser{Id: "upgrade-proposal-results"}
+	dataset, err := parser.ParseBlockEvent(abci.Event{
+		Type: govTypes.EventTypeActiveProposal,
+		Attributes: []abci.EventAttribute{
+			{Key: govTypes.AttributeKeyProposalID, Value: "7"},
+			{Key: govTypes.AttributeKeyProposalResult, Value: govTypes.AttributeValueProposalPassed},
+		},
+	}, config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(ProposalResult{ProposalID: 7, Result: govTypes.AttributeValueProposalPassed}, *dataset)
+}
+
+func (suite *UpgradesTestSuite) TestResolveUpgrades() {
+	actions := []PlanAction{
+		// Applied before the replacement plan was scheduled
+		{MessageID: 1, Name: "v2", PlanHeight: 100, SubmittedHeight: 50},
+		// Scheduled by proposal 1, then replaced by the v3 plan from proposal 3 before reaching its plan height
+		{MessageID: 2, Name: "v3-rc", PlanHeight: 300, ProposalID: proposalID(1), SubmittedHeight: 150},
+		// Proposal 2 was rejected and never takes effect
+		{MessageID: 3, Name: "v3-rejected", PlanHeight: 280, ProposalID: proposalID(2), SubmittedHeight: 160},
+		{MessageID: 4, Name: "v3", PlanHeight: 320, ProposalID: proposalID(3), SubmittedHeight: 170},
+		// Cancelled directly by the authority
+		{MessageID: 5, Name: "v4", PlanHeight: 500, SubmittedHeight: 400},
+		{MessageID: 6, Cancel: true, SubmittedHeight: 450},
+	}
+
+	results := []ProposalResult{
+		{ProposalID: 1, Result: govTypes.AttributeValueProposalPassed, Height: 200},
+		{ProposalID: 2, Result: govTypes.AttributeValueProposalRejected, Height: 210},
+		{ProposalID: 3, Result: govTypes.AttributeValueProposalPassed, Height: 250},
+	}
+
+	upgrades := ResolveUpgrades(actions, results)
+
+	cancelledAt := func(height int64) *int64 { return &height }
+	suite.Assert().Equal([]models.Upgrade{
+		{Name: "v2", PlanHeight: 100, ScheduledHeight: 50},
+		{Name: "v3-rc", PlanHeight: 300, ProposalID: proposalID(1), ScheduledHeight: 200, Cancelled: true, CancelledHeight: cancelledAt(250)},
+		{Name: "v3", PlanHeight: 320, ProposalID: proposalID(3), ScheduledHeight: 250},
+		{Name: "v4", PlanHeight: 500, ScheduledHeight: 400, Cancelled: true, CancelledHeight: cancelledAt(450)},
+	}, upgrades)
+
+	// The result is independent of the order the rows were indexed in
+	reversed := make([]PlanAction, len(actions))
+	for i, action := range actions {
+		reversed[len(actions)-1-i] = action
+	}
+	suite.Assert().Equal(upgrades, ResolveUpgrades(reversed, results))
+}
+
+func (suite *UpgradesTestSuite) TestGetUpgradesByChain() {
+	clean, db, err := dbtest.Setup()
+	suite.Require().NoError(err)
+	defer clean()
+
+	suite.Require().NoError(dbTypes.MigrateModels(db))
+	suite.Require().NoError(db.AutoMigrate(&PlanAction{}, &ProposalResult{}))
+
+	chain := models.Chain{ChainID: "testchain-1"}
+	suite.Require().NoError(db.Create(&chain).Error)
+
+	createBlock := func(height int64) models.Block {
+		block := models.Block{ChainID: chain.ID, Height: height, TimeStamp: time.Now(), ProposerConsAddress: models.Address{Address: "proposer"}}
+		suite.Require().NoError(db.Create(&block).Error)
+		return block
+	}
+
+	submitBlock := createBlock(10)
+	tx := models.Tx{Hash: "proposalhash", BlockID: submitBlock.ID}
+	suite.Require().NoError(db.Create(&tx).Error)
+	tx.Block = submitBlock
+
+	message := models.Message{TxID: tx.ID, Tx: tx, MessageType: models.MessageType{MessageType: MsgSubmitProposalV1Type}}
+	suite.Require().NoError(db.Create(&message).Error)
+
+	msg, err := govV1.NewMsgSubmitProposal([]sdkTypes.Msg{
+		&upgradeTypes.MsgSoftwareUpgrade{Authority: "gov", Plan: upgradeTypes.Plan{Name: "v2", Height: 30}},
+	}, nil, "proposer", "", "v2", "upgrade to v2")
+	suite.Require().NoError(err)
+
+	plansParser := &PlansParser{Id: "upgrade-gov-v1-proposal"}
+	dataset, err := plansParser.ParseMessage(msg, submitProposalLog("1"), config.IndexConfig{})
+	suite.Require().NoError(err)
+	suite.Require().NoError(plansParser.IndexMessage(dataset, db, message, nil, config.IndexConfig{}))
+
+	chainRef := dbTypes.NewChainRef(chain)
+
+	// Not scheduled until the proposal passes
+	upgrades, err := dbTypes.GetUpgradesByChain(context.Background(), db, chainRef)
+	suite.Require().NoError(err)
+	suite.Assert().Empty(upgrades)
+
+	resultsParser := &ProposalResultsParser{Id: "upgrade-proposal-results"}
+	resultDataset := any(ProposalResult{ProposalID: 1, Result: govTypes.AttributeValueProposalPassed})
+	suite.Require().NoError(resultsParser.IndexBlockEvent(&resultDataset, db, createBlock(20), models.BlockEvent{}, nil, config.IndexConfig{}))
+
+	upgrades, err = dbTypes.GetUpgradesByChain(context.Background(), db, chainRef)
+	suite.Require().NoError(err)
+	suite.Require().Len(upgrades, 1)
+	suite.Assert().Equal("v2", upgrades[0].Name)
+	suite.Assert().Equal(int64(20), upgrades[0].ScheduledHeight)
+	suite.Assert().Nil(upgrades[0].AppliedHeight)
+
+	createBlock(31)
+
+	upgrades, err = dbTypes.GetUpgradesByChain(context.Background(), db, chainRef)
+	suite.Require().NoError(err)
+	suite.Require().Len(upgrades, 1)
+	suite.Require().NotNil(upgrades[0].AppliedHeight)
+	suite.Assert().Equal(int64(30), *upgrades[0].AppliedHeight)
+
+	var era string
+	suite.Require().NoError(db.Table("blocks").Select(dbTypes.UpgradeEraColumn("blocks.chain_id", "blocks.height")).Where("height = ?", 31).Scan(&era).Error)
+	suite.Assert().Equal("v2", era)
+}
+
+func TestUpgradesSuite(t *testing.T) {
+	suite.Run(t, new(UpgradesTestSuite))
+}
@@ -1,19 +1,78 @@
 package probe
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/rpc"
 	probeClient "github.com/DefiantLabs/probe/client"
+	rpchttp "github.com/cometbft/cometbft/rpc/client/http"
+	libclient "github.com/cometbft/cometbft/rpc/jsonrpc/client"
 	"github.com/cosmos/cosmos-sdk/types/module"
 )
 
 func GetProbeClient(conf config.Probe, appModuleBasicsExtensions []module.AppModuleBasic) *probeClient.ChainClient {
-	cl, err := probeClient.NewChainClient(GetProbeConfig(conf, true, appModuleBasicsExtensions), "", nil, nil)
+	cl, err := NewProbeClient(conf, appModuleBasicsExtensions)
 	if err != nil {
 		config.Log.Fatalf("Error connecting to chain. Err: %v", err)
 	}
 	return cl
 }
 
+// NewProbeClient creates the client of the chain like GetProbeClient, returning the error instead of exiting. With
+// fallback RPC endpoints or rate limiting, the RPC client of the chain client is an rpc.FailoverClient.
+func NewProbeClient(conf config.Probe, appModuleBasicsExtensions []module.AppModuleBasic) (*probeClient.ChainClient, error) {
+	probeConfig := GetProbeConfig(conf, true, appModuleBasicsExtensions)
+	cl, err := probeClient.NewChainClient(probeConfig, "", nil, nil)
+	if err != nil || (len(conf.RPCFallbacks) == 0 && conf.RPCRequestsPerSecond == 0) {
+		return cl, err
+	}
+
+	timeout, err := time.ParseDuration(probeConfig.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []*rpc.Endpoint
+	for _, rpcEndpoint := range append([]config.RPCEndpoint{{Address: conf.RPC}}, conf.RPCFallbacks...) {
+		endpoint, err := newEndpoint(rpcEndpoint, timeout, conf)
+		if err != nil {
+			return nil, fmt.Errorf("error creating the client of rpc %s: %w", rpcEndpoint.Address, err)
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	cl.RPCClient, err = rpc.NewFailoverClient(conf.ChainID, endpoints, conf.RPCMaxFailures, conf.RPCMaxLag)
+	if err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// newEndpoint creates the RPC client of the endpoint like probe does, with every request of the endpoint going through its
+// own rate limiter when rate limiting is enabled for it
+func newEndpoint(rpcEndpoint config.RPCEndpoint, timeout time.Duration, conf config.Probe) (*rpc.Endpoint, error) {
+	address := rpcEndpoint.Address
+	httpClient, err := libclient.DefaultHTTPClient(address)
+	if err != nil {
+		return nil, err
+	}
+	httpClient.Timeout = timeout
+
+	endpoint := &rpc.Endpoint{Address: address, HTTPClient: httpClient}
+	if rate, burst := rpcEndpoint.RateLimit(conf); rate > 0 {
+		endpoint.Limiter = rpc.NewRateLimiter(rate, burst)
+		httpClient.Transport = &rpc.RateLimitedTransport{Base: httpClient.Transport, Limiter: endpoint.Limiter}
+	}
+
+	endpoint.Client, err = rpchttp.NewWithClient(address, "/websocket", httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
 // Will include the protos provided by the Probe package for Osmosis module interfaces
 func IncludeOsmosisInterfaces(client *probeClient.ChainClient) {
 	probeClient.RegisterOsmosisInterfaces(client.Codec.InterfaceRegistry)
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/DefiantLabs/cosmos-indexer/config"
+	probeClient "github.com/DefiantLabs/probe/client"
 	tmjson "github.com/cometbft/cometbft/libs/json"
 	ctypes "github.com/cometbft/cometbft/rpc/core/types"
 	jsonrpc "github.com/cometbft/cometbft/rpc/jsonrpc/client"
@@ -57,12 +58,35 @@ func argsToJSON(args map[string]interface{}) error {
 }
 
 func (c *URIClient) DoHTTPGet(ctx context.Context, method string, params map[string]interface{}, result interface{}) (interface{}, error) {
+	if c.Failover == nil {
+		return c.doHTTPGet(ctx, c.Address, method, params, result)
+	}
+
+	var height int64
+	if h, ok := params["height"].(*int64); ok && h != nil {
+		height = *h
+	}
+
+	var response interface{}
+	err := c.Failover.Do(ctx, height, func(endpoint *Endpoint) error {
+		var err error
+		client := c
+		if endpoint.HTTPClient != nil {
+			client = &URIClient{Client: endpoint.HTTPClient, AuthHeader: c.AuthHeader}
+		}
+		response, err = client.doHTTPGet(ctx, endpoint.Address, method, params, result)
+		return err
+	})
+	return response, err
+}
+
+func (c *URIClient) doHTTPGet(ctx context.Context, address string, method string, params map[string]interface{}, result interface{}) (interface{}, error) {
 	values, err := argsToURLValues(params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode params: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Address+"/"+method, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"/"+method, nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating new request: %w", err)
 	}
@@ -86,13 +110,31 @@ func (c *URIClient) DoHTTPGet(ctx context.Context, method string, params map[str
 		return nil, fmt.Errorf("read response body: %w", err)
 	}
 
-	return unmarshalResponseBytes(responseBytes, jsonrpc.URIClientRequestID, result)
+	response, err := unmarshalResponseBytes(responseBytes, jsonrpc.URIClientRequestID, result)
+	// Error pages of a proxy are not JSON-RPC responses, their status tells whether the request can be retried
+	var rpcErr *types.RPCError
+	if err != nil && resp.StatusCode >= http.StatusBadRequest && !errors.As(err, &rpcErr) {
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Err: err}
+	}
+	return response, err
 }
 
 type URIClient struct {
 	Address    string
 	Client     *http.Client
 	AuthHeader string
+	Failover   *FailoverClient // Sends the requests to the endpoints of the failover client instead of Address when set
+}
+
+// NewURIClient returns a URIClient for the RPC of the chain client, failing over like its RPC client when it is a
+// FailoverClient
+func NewURIClient(cl *probeClient.ChainClient) URIClient {
+	failover, _ := cl.RPCClient.(*FailoverClient)
+	return URIClient{
+		Address:  cl.Config.RPCAddr,
+		Client:   &http.Client{},
+		Failover: failover,
+	}
 }
 
 func unmarshalResponseBytes(responseBytes []byte, expectedID types.JSONRPCIntID, result interface{}) (interface{}, error) {
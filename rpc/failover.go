@@ -0,0 +1,354 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"github.com/cometbft/cometbft/libs/bytes"
+	rpcclient "github.com/cometbft/cometbft/rpc/client"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+)
+
+// Endpoint is an RPC node of the chain used by a FailoverClient
+type Endpoint struct {
+	Address    string
+	Client     rpcclient.Client
+	HTTPClient *http.Client // Client of the raw requests of URIClient, http.DefaultClient when nil
+	Limiter    *RateLimiter // Rate limiter of the requests of Client and HTTPClient, nil without rate limiting
+
+	// Guarded by the mutex of the FailoverClient
+	healthy  bool
+	failures int64
+	earliest int64 // Earliest height available on the node, 0 until its status was checked
+	latest   int64
+}
+
+// FailoverClient is an rpcclient.Client that sends the requests of the indexer to the healthy endpoints of the chain, the
+// primary endpoint first. A failed request is retried against the next endpoint. An endpoint is marked unhealthy after
+// MaxFailures consecutive failed requests, or when its status check fails or reports a latest height more than MaxLag
+// blocks behind the most recent endpoint. Unhealthy endpoints are only used once the healthy endpoints failed, and are
+// marked healthy again by the status checks of Run. Requests for a height skip the endpoints that pruned it.
+//
+// The requests made by the indexer fail over: Status, ABCIQuery, ABCIQueryWithOptions, Block, BlockResults, BlockSearch,
+// Commit, Validators, Tx and TxSearch. The other methods, like the websocket subscriptions, use the primary endpoint.
+type FailoverClient struct {
+	rpcclient.Client // The primary endpoint
+
+	ChainID     string
+	MaxFailures int64
+	MaxLag      int64
+
+	endpoints []*Endpoint
+	log       *config.Logger
+	metrics   *metrics.Metrics
+
+	mu sync.Mutex
+}
+
+// NewFailoverClient returns a client failing over from the first endpoint to the others, in order
+func NewFailoverClient(chainID string, endpoints []*Endpoint, maxFailures int64, maxLag int64) (*FailoverClient, error) {
+	if len(endpoints) == 0 {
+		return nil, errors.New("failover client needs at least one endpoint")
+	}
+
+	log := config.Log.WithChain(chainID)
+	for _, endpoint := range endpoints {
+		endpoint.healthy = true
+		if endpoint.Limiter != nil {
+			endpoint.Limiter.chainID = chainID
+			endpoint.Limiter.endpoint = endpointLabel(endpoint.Address)
+			endpoint.Limiter.log = log
+		}
+	}
+
+	return &FailoverClient{
+		Client:      endpoints[0].Client,
+		ChainID:     chainID,
+		MaxFailures: maxFailures,
+		MaxLag:      maxLag,
+		endpoints:   endpoints,
+		log:         log,
+	}, nil
+}
+
+// Endpoints returns the endpoints of the client, the primary endpoint first
+func (f *FailoverClient) Endpoints() []*Endpoint {
+	return f.endpoints
+}
+
+// UseMetrics records the failovers, the health and the rate limiting of the endpoints in m
+func (f *FailoverClient) UseMetrics(m *metrics.Metrics) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.metrics = m
+	for _, endpoint := range f.endpoints {
+		m.SetRPCEndpointHealthy(f.ChainID, endpointLabel(endpoint.Address), endpoint.healthy)
+		if endpoint.Limiter != nil {
+			endpoint.Limiter.metrics = m
+		}
+	}
+}
+
+// Run checks the status of the endpoints on the interval until ctx is cancelled
+func (f *FailoverClient) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		f.CheckHealth(ctx)
+	}
+}
+
+// CheckHealth queries the status of every endpoint. Endpoints that fail or fall behind are marked unhealthy, endpoints
+// that respond and are caught up are marked healthy again.
+func (f *FailoverClient) CheckHealth(ctx context.Context) {
+	statuses := make([]*ctypes.ResultStatus, len(f.endpoints))
+	errs := make([]error, len(f.endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range f.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *Endpoint) {
+			defer wg.Done()
+			statusCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			statuses[i], errs[i] = endpoint.Client.Status(statusCtx)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	var best int64
+	for i, status := range statuses {
+		if errs[i] == nil && status.SyncInfo.LatestBlockHeight > best {
+			best = status.SyncInfo.LatestBlockHeight
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, endpoint := range f.endpoints {
+		if errs[i] != nil {
+			f.setHealthy(endpoint, false, "status check failed: "+errs[i].Error())
+			continue
+		}
+
+		info := statuses[i].SyncInfo
+		endpoint.earliest = info.EarliestBlockHeight
+		endpoint.latest = info.LatestBlockHeight
+		if best-info.LatestBlockHeight > f.MaxLag {
+			f.setHealthy(endpoint, false, "latest height is stale")
+			continue
+		}
+		endpoint.failures = 0
+		f.setHealthy(endpoint, true, "")
+	}
+}
+
+// EarliestHeight returns the lowest earliest height of the healthy endpoints, or of all the endpoints when none is healthy,
+// since requests for lower heights skip the endpoints that pruned them. Returns 0 until the status of an endpoint was
+// checked.
+func (f *FailoverClient) EarliestHeight() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var earliest, earliestUnhealthy int64
+	for _, endpoint := range f.endpoints {
+		if endpoint.earliest == 0 {
+			continue
+		}
+		if endpoint.healthy && (earliest == 0 || endpoint.earliest < earliest) {
+			earliest = endpoint.earliest
+		}
+		if earliestUnhealthy == 0 || endpoint.earliest < earliestUnhealthy {
+			earliestUnhealthy = endpoint.earliest
+		}
+	}
+
+	if earliest == 0 {
+		return earliestUnhealthy
+	}
+	return earliest
+}
+
+// setHealthy changes the health of the endpoint, logging the change. The mutex must be held.
+func (f *FailoverClient) setHealthy(endpoint *Endpoint, healthy bool, reason string) {
+	if endpoint.healthy == healthy {
+		return
+	}
+	endpoint.healthy = healthy
+
+	if healthy {
+		f.log.Infof("RPC endpoint %s is healthy again", endpointLabel(endpoint.Address))
+	} else {
+		f.log.Warnf("RPC endpoint %s marked unhealthy, latest height %d: %s", endpointLabel(endpoint.Address), endpoint.latest, reason)
+	}
+	if f.metrics != nil {
+		f.metrics.SetRPCEndpointHealthy(f.ChainID, endpointLabel(endpoint.Address), healthy)
+	}
+}
+
+// candidates returns the endpoints to try for a request at the height, 0 for any height: the healthy endpoints that did not
+// prune the height, then the unhealthy ones, then the ones that pruned it in case their earliest height is out of date
+func (f *FailoverClient) candidates(height int64) []*Endpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var healthy, unhealthy, pruned []*Endpoint
+	for _, endpoint := range f.endpoints {
+		switch {
+		case height > 0 && endpoint.earliest > height:
+			pruned = append(pruned, endpoint)
+		case endpoint.healthy:
+			healthy = append(healthy, endpoint)
+		default:
+			unhealthy = append(unhealthy, endpoint)
+		}
+	}
+
+	return append(append(healthy, unhealthy...), pruned...)
+}
+
+// record counts the result of a request to the endpoint
+func (f *FailoverClient) record(endpoint *Endpoint, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		endpoint.failures = 0
+		return
+	}
+
+	endpoint.failures++
+	if endpoint.failures >= f.MaxFailures {
+		f.setHealthy(endpoint, false, "consecutive requests failed: "+err.Error())
+	}
+}
+
+// Do runs the request against the endpoints until it succeeds, and returns the error of the last endpoint when all of them
+// fail. height is the height of the request, 0 when it is not for a height.
+func (f *FailoverClient) Do(ctx context.Context, height int64, request func(endpoint *Endpoint) error) error {
+	var err error
+	candidates := f.candidates(height)
+	for i, endpoint := range candidates {
+		if i > 0 {
+			previous := endpointLabel(candidates[i-1].Address)
+			f.log.Warnf("RPC request to %s failed, failing over to %s: %v", previous, endpointLabel(endpoint.Address), err)
+			if f.metrics != nil {
+				f.metrics.ObserveRPCFailover(f.ChainID, previous)
+			}
+		}
+
+		err = request(endpoint)
+		// A cancelled request is not a failure of the endpoint
+		if ctx.Err() != nil {
+			return err
+		}
+		f.record(endpoint, err)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func failover[T any](ctx context.Context, f *FailoverClient, height *int64, request func(client rpcclient.Client) (T, error)) (T, error) {
+	var result T
+	var requestHeight int64
+	if height != nil {
+		requestHeight = *height
+	}
+
+	err := f.Do(ctx, requestHeight, func(endpoint *Endpoint) error {
+		var err error
+		result, err = request(endpoint.Client)
+		return err
+	})
+	return result, err
+}
+
+// endpointLabel returns the host of the endpoint, leaving out the credentials and paths of the address in logs and metrics
+func endpointLabel(address string) string {
+	parsed, err := url.Parse(address)
+	if err != nil || parsed.Host == "" {
+		return address
+	}
+	return parsed.Host
+}
+
+func (f *FailoverClient) Status(ctx context.Context) (*ctypes.ResultStatus, error) {
+	return failover(ctx, f, nil, func(client rpcclient.Client) (*ctypes.ResultStatus, error) {
+		return client.Status(ctx)
+	})
+}
+
+func (f *FailoverClient) ABCIQuery(ctx context.Context, path string, data bytes.HexBytes) (*ctypes.ResultABCIQuery, error) {
+	return failover(ctx, f, nil, func(client rpcclient.Client) (*ctypes.ResultABCIQuery, error) {
+		return client.ABCIQuery(ctx, path, data)
+	})
+}
+
+func (f *FailoverClient) ABCIQueryWithOptions(ctx context.Context, path string, data bytes.HexBytes, opts rpcclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	return failover(ctx, f, &opts.Height, func(client rpcclient.Client) (*ctypes.ResultABCIQuery, error) {
+		return client.ABCIQueryWithOptions(ctx, path, data, opts)
+	})
+}
+
+func (f *FailoverClient) Block(ctx context.Context, height *int64) (*ctypes.ResultBlock, error) {
+	return failover(ctx, f, height, func(client rpcclient.Client) (*ctypes.ResultBlock, error) {
+		return client.Block(ctx, height)
+	})
+}
+
+func (f *FailoverClient) BlockResults(ctx context.Context, height *int64) (*ctypes.ResultBlockResults, error) {
+	return failover(ctx, f, height, func(client rpcclient.Client) (*ctypes.ResultBlockResults, error) {
+		return client.BlockResults(ctx, height)
+	})
+}
+
+func (f *FailoverClient) BlockSearch(ctx context.Context, query string, page, perPage *int, orderBy string) (*ctypes.ResultBlockSearch, error) {
+	return failover(ctx, f, nil, func(client rpcclient.Client) (*ctypes.ResultBlockSearch, error) {
+		return client.BlockSearch(ctx, query, page, perPage, orderBy)
+	})
+}
+
+func (f *FailoverClient) Commit(ctx context.Context, height *int64) (*ctypes.ResultCommit, error) {
+	return failover(ctx, f, height, func(client rpcclient.Client) (*ctypes.ResultCommit, error) {
+		return client.Commit(ctx, height)
+	})
+}
+
+func (f *FailoverClient) Validators(ctx context.Context, height *int64, page, perPage *int) (*ctypes.ResultValidators, error) {
+	return failover(ctx, f, height, func(client rpcclient.Client) (*ctypes.ResultValidators, error) {
+		return client.Validators(ctx, height, page, perPage)
+	})
+}
+
+func (f *FailoverClient) Tx(ctx context.Context, hash []byte, prove bool) (*ctypes.ResultTx, error) {
+	return failover(ctx, f, nil, func(client rpcclient.Client) (*ctypes.ResultTx, error) {
+		return client.Tx(ctx, hash, prove)
+	})
+}
+
+func (f *FailoverClient) TxSearch(ctx context.Context, query string, prove bool, page, perPage *int, orderBy string) (*ctypes.ResultTxSearch, error) {
+	return failover(ctx, f, nil, func(client rpcclient.Client) (*ctypes.ResultTxSearch, error) {
+		return client.TxSearch(ctx, query, prove, page, perPage, orderBy)
+	})
+}
@@ -0,0 +1,157 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	rpcclient "github.com/cometbft/cometbft/rpc/client"
+	ctypes "github.com/cometbft/cometbft/rpc/core/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+)
+
+type FailoverTestSuite struct {
+	suite.Suite
+}
+
+// fakeNode serves blocks between its earliest and latest heights, or fails every request when down
+type fakeNode struct {
+	rpcclient.Client
+	earliest int64
+	latest   int64
+	down     bool
+	blocks   int
+}
+
+func (n *fakeNode) Status(ctx context.Context) (*ctypes.ResultStatus, error) {
+	if n.down {
+		return nil, errors.New("connection refused")
+	}
+	return &ctypes.ResultStatus{SyncInfo: ctypes.SyncInfo{EarliestBlockHeight: n.earliest, LatestBlockHeight: n.latest}}, nil
+}
+
+func (n *fakeNode) Block(ctx context.Context, height *int64) (*ctypes.ResultBlock, error) {
+	if n.down {
+		return nil, errors.New("connection refused")
+	}
+	if *height < n.earliest || *height > n.latest {
+		return nil, errors.New("height is not available")
+	}
+	n.blocks++
+	return &ctypes.ResultBlock{}, nil
+}
+
+func newFailover(nodes ...*fakeNode) *FailoverClient {
+	endpoints := make([]*Endpoint, len(nodes))
+	for i, node := range nodes {
+		endpoints[i] = &Endpoint{Address: "http://node" + string(rune('a'+i)) + ":26657", Client: node}
+	}
+	f, _ := NewFailoverClient("testchain-1", endpoints, 2, 10)
+	return f
+}
+
+func (suite *FailoverTestSuite) TestFailover() {
+	ctx := context.Background()
+	primary := &fakeNode{earliest: 1, latest: 100}
+	fallback := &fakeNode{earliest: 1, latest: 100}
+	f := newFailover(primary, fallback)
+	m := metrics.New()
+	f.UseMetrics(m)
+
+	height := int64(50)
+	_, err := f.Block(ctx, &height)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, primary.blocks)
+
+	// Failed requests are retried against the fallback, the primary is skipped once it failed twice in a row
+	primary.down = true
+	for i := 0; i < 3; i++ {
+		_, err = f.Block(ctx, &height)
+		suite.Require().NoError(err)
+	}
+	suite.Assert().Equal(3, fallback.blocks)
+	suite.Assert().Equal(2.0, testutil.ToFloat64(m.RPCFailovers.WithLabelValues("testchain-1", "nodea:26657")))
+	suite.Assert().Equal(0.0, testutil.ToFloat64(m.RPCEndpointHealthy.WithLabelValues("testchain-1", "nodea:26657")))
+
+	// The health check brings the primary back
+	primary.down = false
+	f.CheckHealth(ctx)
+	_, err = f.Block(ctx, &height)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(2, primary.blocks)
+	suite.Assert().Equal(1.0, testutil.ToFloat64(m.RPCEndpointHealthy.WithLabelValues("testchain-1", "nodea:26657")))
+
+	// All endpoints failing returns the error of the last one
+	primary.down = true
+	fallback.down = true
+	_, err = f.Block(ctx, &height)
+	suite.Assert().EqualError(err, "connection refused")
+}
+
+func (suite *FailoverTestSuite) TestStaleEndpoint() {
+	ctx := context.Background()
+	primary := &fakeNode{earliest: 1, latest: 80}
+	fallback := &fakeNode{earliest: 1, latest: 100}
+	f := newFailover(primary, fallback)
+
+	f.CheckHealth(ctx)
+	height := int64(50)
+	_, err := f.Block(ctx, &height)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(0, primary.blocks)
+	suite.Assert().Equal(1, fallback.blocks)
+
+	// Within the lag again
+	primary.latest = 95
+	f.CheckHealth(ctx)
+	_, err = f.Block(ctx, &height)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, primary.blocks)
+}
+
+func (suite *FailoverTestSuite) TestPrunedEndpoint() {
+	ctx := context.Background()
+	primary := &fakeNode{earliest: 60, latest: 100}
+	archive := &fakeNode{earliest: 1, latest: 100}
+	f := newFailover(primary, archive)
+	f.CheckHealth(ctx)
+
+	// Heights pruned by the primary go to the archive node without failing on the primary first
+	height := int64(10)
+	_, err := f.Block(ctx, &height)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, archive.blocks)
+
+	height = 70
+	_, err = f.Block(ctx, &height)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(1, primary.blocks)
+	suite.Assert().Equal(1, archive.blocks)
+}
+
+func (suite *FailoverTestSuite) TestEarliestHeight() {
+	ctx := context.Background()
+	primary := &fakeNode{earliest: 60, latest: 100}
+	archive := &fakeNode{earliest: 1, latest: 100}
+	f := newFailover(primary, archive)
+	suite.Assert().Zero(f.EarliestHeight())
+
+	f.CheckHealth(ctx)
+	suite.Assert().Equal(int64(1), f.EarliestHeight())
+
+	// Once the archive node is down, only the pruned primary is healthy
+	archive.down = true
+	f.CheckHealth(ctx)
+	suite.Assert().Equal(int64(60), f.EarliestHeight())
+
+	// Without a healthy endpoint, the unhealthy ones are still tried
+	primary.down = true
+	f.CheckHealth(ctx)
+	suite.Assert().Equal(int64(1), f.EarliestHeight())
+}
+
+func TestFailoverSuite(t *testing.T) {
+	suite.Run(t, new(FailoverTestSuite))
+}
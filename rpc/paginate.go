@@ -0,0 +1,232 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrPaginationItemLimit is returned when the query returned more items than the configured limit
+	ErrPaginationItemLimit = errors.New("pagination item limit reached")
+	// ErrPaginationKeyLoop is returned when the server returns a next key that was already requested, which would page forever
+	ErrPaginationKeyLoop = errors.New("pagination next key was already requested")
+)
+
+// PageFetcher fetches a single page starting at pageKey (nil for the first page) and returns its items and the next key.
+// An empty next key means there are no more pages.
+type PageFetcher[T any] func(ctx context.Context, pageKey []byte, pageSize uint64) (items []T, nextKey []byte, err error)
+
+// PaginateProgress reports how far a PaginateAll call got. On error, NextKey is the key of the page that could not be fetched,
+// or the key after the last page collected when the item limit was reached, and can be used to resume.
+type PaginateProgress struct {
+	QueryType string
+	Pages     int
+	Items     int
+	Retries   int64
+	NextKey   []byte
+	Duration  time.Duration
+}
+
+type paginateOptions struct {
+	queryType       string
+	startKey        []byte
+	maxItems        int
+	maxPageAttempts int64
+	maxRetryWait    time.Duration
+	pageTimeout     time.Duration
+	overallTimeout  time.Duration
+	metrics         *metrics.Metrics
+	chainID         string
+}
+
+// PaginateOption configures a PaginateAll call
+type PaginateOption func(*paginateOptions)
+
+// WithQueryType names the query in logs and progress reports
+func WithQueryType(queryType string) PaginateOption {
+	return func(opts *paginateOptions) {
+		opts.queryType = queryType
+	}
+}
+
+// WithStartKey starts the query at the page of key instead of the first page, like the NextKey of a PaginateProgress
+func WithStartKey(key []byte) PaginateOption {
+	return func(opts *paginateOptions) {
+		opts.startKey = key
+	}
+}
+
+// WithMaxItems stops the query once more than maxItems were collected, 0 for no limit. The items of the page that exceeded
+// the limit are all returned, so at most maxItems plus a page size items are collected.
+func WithMaxItems(maxItems int) PaginateOption {
+	return func(opts *paginateOptions) {
+		opts.maxItems = maxItems
+	}
+}
+
+// WithPageRetries sets the maximum number of attempts for a single page and the maximum wait between attempts
+func WithPageRetries(maxPageAttempts int64, maxRetryWait time.Duration) PaginateOption {
+	return func(opts *paginateOptions) {
+		opts.maxPageAttempts = maxPageAttempts
+		opts.maxRetryWait = maxRetryWait
+	}
+}
+
+// WithPageTimeout sets the deadline for each individual page request
+func WithPageTimeout(timeout time.Duration) PaginateOption {
+	return func(opts *paginateOptions) {
+		opts.pageTimeout = timeout
+	}
+}
+
+// WithOverallTimeout sets the deadline for the whole paginated query
+func WithOverallTimeout(timeout time.Duration) PaginateOption {
+	return func(opts *paginateOptions) {
+		opts.overallTimeout = timeout
+	}
+}
+
+// WithMetrics records the query in the metrics under the chain and the query type of WithQueryType
+func WithMetrics(m *metrics.Metrics, chainID string) PaginateOption {
+	return func(opts *paginateOptions) {
+		opts.metrics = m
+		opts.chainID = chainID
+	}
+}
+
+// PaginateAll fetches every page of a paginated query. Each page is retried with backoff on transient gRPC errors,
+// and pagination stops with an error (returning the items collected so far) when the item limit or a deadline is reached,
+// or when the server returns a next key that was already requested.
+func PaginateAll[T any](ctx context.Context, pageSize uint64, fetch PageFetcher[T], opts ...PaginateOption) ([]T, PaginateProgress, error) {
+	options := paginateOptions{
+		queryType:       "query",
+		maxPageAttempts: 5,
+		maxRetryWait:    30 * time.Second,
+		pageTimeout:     30 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	items, progress, err := paginateAll(ctx, pageSize, fetch, options)
+	if options.metrics != nil {
+		options.metrics.ObservePaginatedQuery(options.chainID, options.queryType, progress.Pages, progress.Retries, progress.Duration, err)
+	}
+	return items, progress, err
+}
+
+func paginateAll[T any](ctx context.Context, pageSize uint64, fetch PageFetcher[T], options paginateOptions) ([]T, PaginateProgress, error) {
+	if pageSize == 0 {
+		return nil, PaginateProgress{QueryType: options.queryType}, errors.New("page size must be greater than 0")
+	}
+
+	if options.overallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.overallTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	progress := PaginateProgress{QueryType: options.queryType}
+	requestedKeys := make(map[string]struct{})
+
+	var all []T
+	pageKey := options.startKey
+
+	for {
+		if _, ok := requestedKeys[string(pageKey)]; ok {
+			progress.Duration = time.Since(start)
+			return all, progress, fmt.Errorf("%s: %w: %x", options.queryType, ErrPaginationKeyLoop, pageKey)
+		}
+		requestedKeys[string(pageKey)] = struct{}{}
+
+		items, nextKey, retries, err := fetchPageWithRetry(ctx, pageKey, pageSize, fetch, options)
+		progress.Retries += retries
+		if err != nil {
+			progress.NextKey = pageKey
+			progress.Duration = time.Since(start)
+			return all, progress, fmt.Errorf("%s: error fetching page %d: %w", options.queryType, progress.Pages+1, err)
+		}
+
+		progress.Pages++
+		all = append(all, items...)
+		progress.Items = len(all)
+
+		// The last page is kept whole so NextKey resumes right after it
+		if options.maxItems > 0 && len(all) > options.maxItems && len(nextKey) != 0 {
+			progress.NextKey = nextKey
+			progress.Duration = time.Since(start)
+			return all, progress, fmt.Errorf("%s: %w (%d)", options.queryType, ErrPaginationItemLimit, options.maxItems)
+		}
+
+		if len(nextKey) == 0 {
+			progress.Duration = time.Since(start)
+			config.Log.Debugf("Paginated %s complete: %d items in %d pages (%d retries) in %s", options.queryType, progress.Items, progress.Pages, progress.Retries, progress.Duration)
+			return all, progress, nil
+		}
+
+		pageKey = nextKey
+	}
+}
+
+func fetchPageWithRetry[T any](ctx context.Context, pageKey []byte, pageSize uint64, fetch PageFetcher[T], options paginateOptions) ([]T, []byte, int64, error) {
+	var attempts int64
+	var retries int64
+
+	for {
+		pageCtx, cancel := context.WithTimeout(ctx, options.pageTimeout)
+		items, nextKey, err := fetch(pageCtx, pageKey, pageSize)
+		cancel()
+		attempts++
+
+		if err == nil {
+			return items, nextKey, retries, nil
+		}
+
+		// The overall deadline or cancellation of the parent context is never retried
+		if ctx.Err() != nil {
+			return nil, nil, retries, ctx.Err()
+		}
+
+		if !IsTransientGRPCError(err) || attempts >= options.maxPageAttempts {
+			return nil, nil, retries, err
+		}
+
+		backoff, _ := GetBackoffDurationForAttempts(attempts-1, options.maxRetryWait)
+		config.Log.Debugf("Transient error paging %s (attempt %d), backing off %s. Err: %v", options.queryType, attempts, backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, nil, retries, ctx.Err()
+		}
+		retries++
+	}
+}
+
+// IsTransientGRPCError returns true for gRPC errors that are worth retrying, including per request deadlines
+func IsTransientGRPCError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	grpcStatus, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+
+	switch grpcStatus.Code() {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,262 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	sdkTypes "github.com/cosmos/cosmos-sdk/types"
+	"github.com/cosmos/cosmos-sdk/types/query"
+	txTypes "github.com/cosmos/cosmos-sdk/types/tx"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type PaginateTestSuite struct {
+	suite.Suite
+}
+
+// fakePagedServer serves totalItems ints in pages keyed by the string offset of the page.
+// failures maps a page offset to the errors returned (in order) before the page succeeds.
+type fakePagedServer struct {
+	totalItems int
+	failures   map[int][]error
+	nextKeys   map[int][]byte // overrides the next key returned for a page offset
+	calls      int
+}
+
+func (s *fakePagedServer) fetch(ctx context.Context, pageKey []byte, pageSize uint64) ([]int, []byte, error) {
+	s.calls++
+
+	offset := 0
+	if len(pageKey) != 0 {
+		_, err := fmt.Sscanf(string(pageKey), "%d", &offset)
+		if err != nil {
+			return nil, nil, status.Error(codes.InvalidArgument, "malformed key")
+		}
+	}
+
+	if errs := s.failures[offset]; len(errs) != 0 {
+		s.failures[offset] = errs[1:]
+		return nil, nil, errs[0]
+	}
+
+	var items []int
+	for i := offset; i < s.totalItems && uint64(len(items)) < pageSize; i++ {
+		items = append(items, i)
+	}
+
+	if nextKey, ok := s.nextKeys[offset]; ok {
+		return items, nextKey, nil
+	}
+
+	next := offset + len(items)
+	if next >= s.totalItems {
+		return items, nil, nil
+	}
+
+	return items, []byte(fmt.Sprintf("%d", next)), nil
+}
+
+func fastRetries() PaginateOption {
+	return WithPageRetries(5, time.Millisecond)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAll() {
+	server := &fakePagedServer{totalItems: 25}
+
+	items, progress, err := PaginateAll(context.Background(), 10, server.fetch, WithQueryType("test"), fastRetries())
+	suite.Require().NoError(err)
+	suite.Assert().Len(items, 25)
+	suite.Assert().Equal(3, progress.Pages)
+	suite.Assert().Equal(25, progress.Items)
+	suite.Assert().Zero(progress.Retries)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllRetriesFlakyPages() {
+	server := &fakePagedServer{
+		totalItems: 25,
+		failures: map[int][]error{
+			10: {status.Error(codes.Unavailable, "flaky"), status.Error(codes.ResourceExhausted, "rate limited")},
+			20: {context.DeadlineExceeded},
+		},
+	}
+
+	items, progress, err := PaginateAll(context.Background(), 10, server.fetch, fastRetries())
+	suite.Require().NoError(err)
+	suite.Assert().Len(items, 25)
+	suite.Assert().Equal(int64(3), progress.Retries)
+	suite.Assert().Equal(6, server.calls)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllReportsPartialProgress() {
+	server := &fakePagedServer{
+		totalItems: 25,
+		failures: map[int][]error{
+			20: {status.Error(codes.NotFound, "not transient")},
+		},
+	}
+
+	items, progress, err := PaginateAll(context.Background(), 10, server.fetch, fastRetries())
+	suite.Require().Error(err)
+	suite.Assert().Equal(codes.NotFound, status.Code(errors.Unwrap(err)))
+	suite.Assert().Len(items, 20)
+	suite.Assert().Equal(2, progress.Pages)
+	suite.Assert().Equal([]byte("20"), progress.NextKey)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllGivesUpAfterMaxAttempts() {
+	server := &fakePagedServer{
+		totalItems: 25,
+		failures: map[int][]error{
+			0: {status.Error(codes.Unavailable, "down"), status.Error(codes.Unavailable, "down"), status.Error(codes.Unavailable, "down")},
+		},
+	}
+
+	items, progress, err := PaginateAll(context.Background(), 10, server.fetch, WithPageRetries(2, time.Millisecond))
+	suite.Require().Error(err)
+	suite.Assert().Empty(items)
+	suite.Assert().Equal(int64(1), progress.Retries)
+	suite.Assert().Equal(2, server.calls)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllTerminatesOnKeyLoop() {
+	server := &fakePagedServer{
+		totalItems: 100,
+		nextKeys: map[int][]byte{
+			// The second page points back to itself
+			10: []byte("10"),
+		},
+	}
+
+	items, progress, err := PaginateAll(context.Background(), 10, server.fetch, fastRetries())
+	suite.Require().ErrorIs(err, ErrPaginationKeyLoop)
+	suite.Assert().Len(items, 20)
+	suite.Assert().Equal(2, progress.Pages)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllMalformedNextKey() {
+	server := &fakePagedServer{
+		totalItems: 100,
+		nextKeys: map[int][]byte{
+			0: []byte("not-a-key"),
+		},
+	}
+
+	items, progress, err := PaginateAll(context.Background(), 10, server.fetch, fastRetries())
+	suite.Require().Error(err)
+	suite.Assert().Equal(codes.InvalidArgument, status.Code(errors.Unwrap(err)))
+	suite.Assert().Len(items, 10)
+	suite.Assert().Equal([]byte("not-a-key"), progress.NextKey)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllItemLimit() {
+	server := &fakePagedServer{totalItems: 100}
+
+	items, progress, err := PaginateAll(context.Background(), 10, server.fetch, WithMaxItems(25), fastRetries())
+	suite.Require().ErrorIs(err, ErrPaginationItemLimit)
+	suite.Assert().Len(items, 30)
+	suite.Assert().Equal(3, progress.Pages)
+	suite.Assert().Equal([]byte("30"), progress.NextKey)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllResumesAfterItemLimit() {
+	server := &fakePagedServer{totalItems: 100}
+
+	var all []int
+	var startKey []byte
+	for {
+		items, progress, err := PaginateAll(context.Background(), 10, server.fetch, WithStartKey(startKey), WithMaxItems(25), fastRetries())
+		all = append(all, items...)
+		if err == nil {
+			break
+		}
+		suite.Require().ErrorIs(err, ErrPaginationItemLimit)
+		startKey = progress.NextKey
+	}
+
+	// No item is skipped or collected twice across the resumed calls
+	suite.Require().Len(all, 100)
+	for i, item := range all {
+		suite.Require().Equal(i, item)
+	}
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllOverallDeadline() {
+	fetch := func(ctx context.Context, pageKey []byte, pageSize uint64) ([]int, []byte, error) {
+		<-ctx.Done()
+		return nil, nil, status.Error(codes.DeadlineExceeded, "slow")
+	}
+
+	start := time.Now()
+	_, _, err := PaginateAll(context.Background(), 10, fetch, WithOverallTimeout(50*time.Millisecond), fastRetries())
+	suite.Require().ErrorIs(err, context.DeadlineExceeded)
+	suite.Assert().Less(time.Since(start), 5*time.Second)
+}
+
+func (suite *PaginateTestSuite) TestPaginateAllMetrics() {
+	m := metrics.New()
+	server := &fakePagedServer{
+		totalItems: 25,
+		failures:   map[int][]error{10: {status.Error(codes.Unavailable, "flaky")}},
+	}
+
+	_, _, err := PaginateAll(context.Background(), 10, server.fetch, WithQueryType("validators"), WithMetrics(m, "testchain-1"), fastRetries())
+	suite.Require().NoError(err)
+
+	server = &fakePagedServer{totalItems: 100}
+	_, _, err = PaginateAll(context.Background(), 10, server.fetch, WithQueryType("validators"), WithMetrics(m, "testchain-1"), WithMaxItems(5), fastRetries())
+	suite.Require().ErrorIs(err, ErrPaginationItemLimit)
+
+	suite.Assert().Equal(1.0, testutil.ToFloat64(m.PaginatedQueries.WithLabelValues("testchain-1", "validators", "success")))
+	suite.Assert().Equal(1.0, testutil.ToFloat64(m.PaginatedQueries.WithLabelValues("testchain-1", "validators", "error")))
+	suite.Assert().Equal(4.0, testutil.ToFloat64(m.PaginatedPages.WithLabelValues("testchain-1", "validators")))
+	suite.Assert().Equal(1.0, testutil.ToFloat64(m.PaginatedRetries.WithLabelValues("testchain-1", "validators")))
+	suite.Assert().Equal(1, testutil.CollectAndCount(m.PaginatedQueryTime))
+}
+
+func (suite *PaginateTestSuite) TestPaginateTxs() {
+	txs := make([]*txTypes.Tx, 250)
+	for i := range txs {
+		txs[i] = &txTypes.Tx{Body: &txTypes.TxBody{Memo: fmt.Sprintf("%d", i)}}
+	}
+	fetch := func(offset uint64, limit uint64) (*txTypes.GetTxsEventResponse, error) {
+		end := min(offset+limit, uint64(len(txs)))
+		page := txs[offset:end]
+		return &txTypes.GetTxsEventResponse{
+			Txs:         page,
+			TxResponses: make([]*sdkTypes.TxResponse, len(page)),
+			Pagination:  &query.PageResponse{Total: uint64(len(txs))},
+		}, nil
+	}
+
+	resp, err := paginateTxs(context.Background(), fetch)
+	suite.Require().NoError(err)
+	suite.Require().Len(resp.Txs, 250)
+	suite.Assert().Len(resp.TxResponses, 250)
+	for i, tx := range resp.Txs {
+		suite.Require().Equal(fmt.Sprintf("%d", i), tx.Body.Memo)
+	}
+
+	// A node that stops returning txs before the total does not page forever
+	calls := 0
+	_, err = paginateTxs(context.Background(), func(offset uint64, limit uint64) (*txTypes.GetTxsEventResponse, error) {
+		calls++
+		resp, err := fetch(offset, limit)
+		if offset >= 100 {
+			resp.Txs, resp.TxResponses = nil, nil
+		}
+		return resp, err
+	})
+	suite.Require().ErrorIs(err, ErrPaginationKeyLoop)
+	suite.Assert().Equal(2, calls)
+}
+
+func TestPaginateSuite(t *testing.T) {
+	suite.Run(t, new(PaginateTestSuite))
+}
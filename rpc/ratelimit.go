@@ -0,0 +1,182 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+)
+
+const (
+	rateLimitBackoffMin = time.Second
+	rateLimitBackoffMax = time.Minute
+)
+
+// RateLimiter is a token bucket shared by all the requests to an RPC endpoint, refilled with Rate tokens per second up to
+// Burst tokens. An endpoint that rate limits a request anyway is backed off exponentially, from 1 second up to 1 minute,
+// until a request succeeds.
+type RateLimiter struct {
+	Rate  float64 // Requests per second, 0 for no limit
+	Burst float64
+
+	mu           sync.Mutex
+	tokens       float64
+	last         time.Time
+	backoff      time.Duration
+	backoffUntil time.Time
+
+	chainID  string
+	endpoint string
+	log      *config.Logger
+	metrics  *metrics.Metrics
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second in bursts of burst requests. A burst below 1 allows
+// one request at a time.
+func NewRateLimiter(rate float64, burst int64) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{Rate: rate, Burst: float64(burst), tokens: float64(burst)}
+}
+
+// Wait blocks until the next request can be sent and returns the time waited
+func (l *RateLimiter) Wait(ctx context.Context) (time.Duration, error) {
+	wait := l.reserve(time.Now())
+
+	if l.metrics != nil {
+		l.metrics.SetRPCRateLimitWait(l.chainID, l.endpoint, wait)
+	}
+	if wait <= 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		return wait, ctx.Err()
+	}
+}
+
+// reserve takes a token and returns the time to wait for it, including the backoff of the endpoint
+func (l *RateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var wait time.Duration
+	if l.Rate > 0 {
+		if !l.last.IsZero() {
+			l.tokens += now.Sub(l.last).Seconds() * l.Rate
+			if l.tokens > l.Burst {
+				l.tokens = l.Burst
+			}
+		}
+		l.last = now
+
+		// The token is taken now, the requests waiting for a token are sent in order
+		l.tokens--
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / l.Rate * float64(time.Second))
+		}
+	}
+
+	if backoff := l.backoffUntil.Sub(now); backoff > wait {
+		wait = backoff
+	}
+	return wait
+}
+
+// RateLimited backs off the endpoint after it rate limited a request, doubling the backoff of the previous rate limited
+// request, and returns the backoff
+func (l *RateLimiter) RateLimited() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case l.backoff == 0:
+		l.backoff = rateLimitBackoffMin
+	case l.backoff < rateLimitBackoffMax:
+		l.backoff *= 2
+		if l.backoff > rateLimitBackoffMax {
+			l.backoff = rateLimitBackoffMax
+		}
+	}
+	l.backoffUntil = time.Now().Add(l.backoff)
+
+	l.log.Warnf("RPC endpoint %s rate limited a request, backing off for %s", l.endpoint, l.backoff)
+	if l.metrics != nil {
+		l.metrics.ObserveRPCRateLimited(l.chainID, l.endpoint)
+	}
+	return l.backoff
+}
+
+// Succeeded resets the backoff of the endpoint once it accepted a request
+func (l *RateLimiter) Succeeded() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.backoff = 0
+}
+
+// RateLimitedTransport is an http.RoundTripper sending the requests through the rate limiter of the endpoint. Responses
+// with status 429, or another error status with a rate limit message, back off the endpoint.
+type RateLimitedTransport struct {
+	Base    http.RoundTripper
+	Limiter *RateLimiter
+}
+
+func (t *RateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if _, err := t.Limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	limited, err := isRateLimited(resp)
+	if err != nil {
+		return nil, err
+	}
+	if limited {
+		t.Limiter.RateLimited()
+	} else {
+		t.Limiter.Succeeded()
+	}
+	return resp, nil
+}
+
+// isRateLimited checks the response for a rate limit error. The body of an error response is read to find the message
+// and replaced so the caller can still read it.
+func isRateLimited(resp *http.Response) (bool, error) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true, nil
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	resp.Body.Close()
+	if err != nil {
+		return false, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	message := strings.ToLower(string(body))
+	return strings.Contains(message, "rate limit") || strings.Contains(message, "too many requests"), nil
+}
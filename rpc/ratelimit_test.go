@@ -0,0 +1,87 @@
+package rpc
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type RateLimitTestSuite struct {
+	suite.Suite
+}
+
+func (suite *RateLimitTestSuite) TestTokenBucket() {
+	limiter := NewRateLimiter(10, 2)
+	now := time.Now()
+
+	// The burst goes right away, the next requests are spaced by the rate
+	suite.Assert().Zero(limiter.reserve(now))
+	suite.Assert().Zero(limiter.reserve(now))
+	suite.Assert().Equal(100*time.Millisecond, limiter.reserve(now))
+	suite.Assert().Equal(200*time.Millisecond, limiter.reserve(now))
+
+	// Tokens refill up to the burst
+	now = now.Add(10 * time.Second)
+	suite.Assert().Zero(limiter.reserve(now))
+	suite.Assert().Zero(limiter.reserve(now))
+	suite.Assert().Equal(100*time.Millisecond, limiter.reserve(now))
+}
+
+func (suite *RateLimitTestSuite) TestBackoff() {
+	limiter := NewRateLimiter(0, 0)
+	suite.Assert().Zero(limiter.reserve(time.Now()))
+
+	suite.Assert().Equal(time.Second, limiter.RateLimited())
+	suite.Assert().Equal(2*time.Second, limiter.RateLimited())
+	suite.Assert().InDelta(2*time.Second, limiter.reserve(time.Now()), float64(100*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		limiter.RateLimited()
+	}
+	suite.Assert().Equal(time.Minute, limiter.RateLimited())
+
+	// A request accepted by the endpoint starts the backoff over
+	limiter.Succeeded()
+	suite.Assert().Equal(time.Second, limiter.RateLimited())
+}
+
+func (suite *RateLimitTestSuite) TestTransport() {
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"Rate limit exceeded"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	limiter := NewRateLimiter(1000, 1)
+	client := &http.Client{Transport: &RateLimitedTransport{Limiter: limiter}}
+
+	// The body of the rate limited response is still readable
+	resp, err := client.Get(server.URL)
+	suite.Require().NoError(err)
+	body, err := io.ReadAll(resp.Body)
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	suite.Assert().Contains(string(body), "Rate limit exceeded")
+
+	// The endpoint is backed off before the next request
+	start := time.Now()
+	resp, err = client.Get(server.URL)
+	suite.Require().NoError(err)
+	resp.Body.Close()
+	suite.Assert().GreaterOrEqual(time.Since(start), 900*time.Millisecond)
+	suite.Assert().Equal(int64(2), requests.Load())
+}
+
+func TestRateLimitSuite(t *testing.T) {
+	suite.Run(t, new(RateLimitTestSuite))
+}
@@ -1,6 +1,9 @@
 package rpc
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"time"
 
 	coretypes "github.com/cometbft/cometbft/rpc/core/types"
@@ -10,6 +13,7 @@ import (
 	probeQuery "github.com/DefiantLabs/probe/query"
 	"github.com/cosmos/cosmos-sdk/types/query"
 	txTypes "github.com/cosmos/cosmos-sdk/types/tx"
+	transfertypes "github.com/cosmos/ibc-go/v7/modules/apps/transfer/types"
 )
 
 // GetBlockTimestamp
@@ -24,30 +28,52 @@ func GetBlock(cl *probeClient.ChainClient, height int64) (*coretypes.ResultBlock
 	return resp, nil
 }
 
+// txsPageSize is the number of txs requested per page of GetTxsByBlockHeight
+const txsPageSize = 100
+
 // GetTxsByBlockHeight makes a request to the Cosmos RPC API and returns all the transactions for a specific block
 func GetTxsByBlockHeight(cl *probeClient.ChainClient, height int64) (*txTypes.GetTxsEventResponse, error) {
-	pg := query.PageRequest{Limit: 100}
-	options := probeQuery.QueryOptions{Height: height, Pagination: &pg}
-	query := probeQuery.Query{Client: cl, Options: &options}
-	resp, err := query.TxByHeight(cl.Codec)
+	return paginateTxs(context.Background(), func(offset uint64, limit uint64) (*txTypes.GetTxsEventResponse, error) {
+		pg := query.PageRequest{Offset: offset, Limit: limit}
+		options := probeQuery.QueryOptions{Height: height, Pagination: &pg}
+		query := probeQuery.Query{Client: cl, Options: &options}
+		return query.TxByHeight(cl.Codec)
+	})
+}
+
+// paginateTxs fetches every page of a GetTxsEvent query with PaginateAll and merges them into one response. The query
+// is paged by offset up to the total of the response, the page keys of PaginateAll are the big endian offsets, so a
+// node that returns an empty page before the total fails with ErrPaginationKeyLoop instead of paging forever. Pages are
+// not retried, the callers retry the whole query.
+func paginateTxs(ctx context.Context, fetch func(offset uint64, limit uint64) (*txTypes.GetTxsEventResponse, error)) (*txTypes.GetTxsEventResponse, error) {
+	fetchPage := func(ctx context.Context, pageKey []byte, pageSize uint64) ([]*txTypes.GetTxsEventResponse, []byte, error) {
+		var offset uint64
+		if len(pageKey) != 0 {
+			offset = binary.BigEndian.Uint64(pageKey)
+		}
+
+		resp, err := fetch(offset, pageSize)
+		if err != nil || resp == nil || resp.Pagination == nil {
+			return []*txTypes.GetTxsEventResponse{resp}, nil, err
+		}
+
+		next := offset + uint64(len(resp.Txs))
+		if next >= resp.Pagination.Total {
+			return []*txTypes.GetTxsEventResponse{resp}, nil, nil
+		}
+		return []*txTypes.GetTxsEventResponse{resp}, binary.BigEndian.AppendUint64(nil, next), nil
+	}
+
+	pages, _, err := PaginateAll(ctx, txsPageSize, fetchPage, WithQueryType("txs_by_height"), WithPageRetries(1, 0))
 	if err != nil {
 		return nil, err
 	}
 
-	// handle pagination if needed
-	if resp != nil && resp.Pagination != nil {
-		// if there are more total objects than we have so far, keep going
-		for resp.Pagination.Total > uint64(len(resp.Txs)) {
-			query.Options.Pagination.Offset = uint64(len(resp.Txs))
-			chunkResp, err := query.TxByHeight(cl.Codec)
-			if err != nil {
-				return nil, err
-			}
-			resp.Txs = append(resp.Txs, chunkResp.Txs...)
-			resp.TxResponses = append(resp.TxResponses, chunkResp.TxResponses...)
-		}
+	resp := pages[0]
+	for _, page := range pages[1:] {
+		resp.Txs = append(resp.Txs, page.Txs...)
+		resp.TxResponses = append(resp.TxResponses, page.TxResponses...)
 	}
-
 	return resp, nil
 }
 
@@ -127,3 +153,28 @@ func GetEarliestAndLatestBlockHeights(cl *probeClient.ChainClient) (int64, int64
 	}
 	return resStatus.SyncInfo.EarliestBlockHeight, resStatus.SyncInfo.LatestBlockHeight, nil
 }
+
+// GetEarliestAvailableHeight returns the earliest height the RPC of the chain can serve. With failover it is the lowest
+// earliest height of the healthy endpoints, see FailoverClient.EarliestHeight.
+func GetEarliestAvailableHeight(cl *probeClient.ChainClient) (int64, error) {
+	if failover, ok := cl.RPCClient.(*FailoverClient); ok {
+		if earliest := failover.EarliestHeight(); earliest > 0 {
+			return earliest, nil
+		}
+	}
+
+	earliest, _, err := GetEarliestAndLatestBlockHeights(cl)
+	return earliest, err
+}
+
+// GetDenomTrace returns the denom trace of the hash of an ibc/ denom from the transfer module of the chain
+func GetDenomTrace(ctx context.Context, cl *probeClient.ChainClient, hash string) (transfertypes.DenomTrace, error) {
+	resp, err := transfertypes.NewQueryClient(cl).DenomTrace(ctx, &transfertypes.QueryDenomTraceRequest{Hash: hash})
+	if err != nil {
+		return transfertypes.DenomTrace{}, err
+	}
+	if resp.DenomTrace == nil {
+		return transfertypes.DenomTrace{}, errors.New("denom trace not found")
+	}
+	return *resp.DenomTrace, nil
+}
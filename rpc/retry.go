@@ -0,0 +1,174 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	jsonrpctypes "github.com/cometbft/cometbft/rpc/jsonrpc/types"
+)
+
+const (
+	defaultRetryInitialInterval = 500 * time.Millisecond
+	defaultRetryMaxInterval     = 10 * time.Second
+	defaultRetryMultiplier      = 2
+	defaultRetryJitter          = 0.5
+)
+
+// Clock is the time source of a RetryPolicy, replaced by a fake clock in tests
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// RetryPolicy retries the transient errors of an RPC request with exponential backoff and jitter, see IsTransientRPCError.
+// The backoff starts at InitialInterval and is multiplied by Multiplier after every attempt, up to MaxInterval. Each
+// backoff is randomized by up to Jitter of its interval, so workers failing together do not retry together. The request
+// is not retried once the next attempt would start more than MaxElapsedTime after the first one.
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	Jitter          float64
+	MaxElapsedTime  time.Duration // 0 disables the retries
+	Clock           Clock
+	Random          func() float64 // Returns a number in [0, 1), rand.Float64 when nil
+}
+
+// NewRetryPolicy returns the default policy retrying for up to maxElapsed
+func NewRetryPolicy(maxElapsed time.Duration) RetryPolicy {
+	return RetryPolicy{
+		InitialInterval: defaultRetryInitialInterval,
+		MaxInterval:     defaultRetryMaxInterval,
+		Multiplier:      defaultRetryMultiplier,
+		Jitter:          defaultRetryJitter,
+		MaxElapsedTime:  maxElapsed,
+		Clock:           realClock{},
+	}
+}
+
+// Backoff returns the randomized wait after the failed attempt, counted from 0
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	interval := float64(p.InitialInterval)
+	for i := 0; i < attempt && interval < float64(p.MaxInterval); i++ {
+		interval *= p.Multiplier
+	}
+	if interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+
+	random := p.Random
+	if random == nil {
+		random = rand.Float64
+	}
+	return time.Duration(interval * (1 + p.Jitter*(2*random()-1)))
+}
+
+// Retry runs the request until it succeeds, fails with an error that is not transient, or the policy gives up. The error
+// of the last attempt is returned. A cancelled ctx stops the retries.
+func Retry[T any](ctx context.Context, policy RetryPolicy, request func(ctx context.Context) (T, error)) (T, error) {
+	clock := policy.Clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	start := clock.Now()
+
+	for attempt := 0; ; attempt++ {
+		result, err := request(ctx)
+		if err == nil || ctx.Err() != nil || !IsTransientRPCError(err) {
+			return result, err
+		}
+
+		backoff := policy.Backoff(attempt)
+		if clock.Now().Add(backoff).Sub(start) > policy.MaxElapsedTime {
+			return result, err
+		}
+		config.Log.Debugf("Transient RPC error (attempt %d), backing off %s. Err: %v", attempt+1, backoff, err)
+
+		select {
+		case <-clock.After(backoff):
+		case <-ctx.Done():
+			return result, err
+		}
+	}
+}
+
+// HTTPStatusError is the error of an RPC request answered with an error status and a body that is not a JSON-RPC
+// response, like the error pages of a proxy in front of the node
+type HTTPStatusError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("http status %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *HTTPStatusError) Unwrap() error {
+	return e.Err
+}
+
+// transientMessages are found in the errors of the RPC clients that wrap the underlying network error as text
+var transientMessages = []string{
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"unexpected eof",
+	"timeout exceeded",
+	"(status: 5", // Error status of the CometBFT HTTP client, see getHTTPRespErrPrefix
+}
+
+// IsTransientRPCError returns true for RPC errors that are worth retrying: timeouts, dropped connections and 5xx or 429
+// responses. Errors returned by the node, like a height that is not available, and errors decoding the response are
+// permanent, and so is any other error.
+func IsTransientRPCError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var rpcErr *jsonrpctypes.RPCError
+	if errors.As(err, &rpcErr) {
+		return false
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode >= 500 || statusErr.StatusCode == 429
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return true
+	}
+
+	for _, transient := range []error{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.EPIPE, io.ErrUnexpectedEOF, io.EOF} {
+		if errors.Is(err, transient) {
+			return true
+		}
+	}
+
+	if IsTransientGRPCError(err) {
+		return true
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, transient := range transientMessages {
+		if strings.Contains(message, transient) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,164 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+	"time"
+
+	jsonrpctypes "github.com/cometbft/cometbft/rpc/jsonrpc/types"
+	"github.com/stretchr/testify/suite"
+)
+
+type RetryTestSuite struct {
+	suite.Suite
+}
+
+// fakeClock moves forward by the waited duration right away and records the waits
+type fakeClock struct {
+	now   time.Time
+	waits []time.Duration
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits = append(c.waits, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func newTestPolicy(clock *fakeClock, maxElapsed time.Duration) RetryPolicy {
+	policy := NewRetryPolicy(maxElapsed)
+	policy.Clock = clock
+	policy.Random = func() float64 { return 0.5 } // No jitter
+	return policy
+}
+
+func (suite *RetryTestSuite) TestBackoff() {
+	policy := newTestPolicy(&fakeClock{}, time.Minute)
+	suite.Assert().Equal(500*time.Millisecond, policy.Backoff(0))
+	suite.Assert().Equal(time.Second, policy.Backoff(1))
+	suite.Assert().Equal(8*time.Second, policy.Backoff(4))
+	suite.Assert().Equal(10*time.Second, policy.Backoff(5))
+	suite.Assert().Equal(10*time.Second, policy.Backoff(100))
+
+	// The jitter randomizes the backoff by up to half of the interval
+	policy.Random = func() float64 { return 0 }
+	suite.Assert().Equal(500*time.Millisecond, policy.Backoff(1))
+	policy.Random = func() float64 { return 0.999 }
+	suite.Assert().InDelta(1500*time.Millisecond, policy.Backoff(1), float64(time.Millisecond))
+}
+
+func (suite *RetryTestSuite) TestRetryTransient() {
+	clock := &fakeClock{now: time.Now()}
+	var attempts int
+	result, err := Retry(context.Background(), newTestPolicy(clock, time.Minute), func(ctx context.Context) (int, error) {
+		attempts++
+		if attempts < 4 {
+			return 0, fmt.Errorf("post failed: %w", syscall.ECONNRESET)
+		}
+		return 42, nil
+	})
+	suite.Require().NoError(err)
+	suite.Assert().Equal(42, result)
+	suite.Assert().Equal([]time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}, clock.waits)
+}
+
+func (suite *RetryTestSuite) TestRetryGivesUp() {
+	clock := &fakeClock{now: time.Now()}
+	var attempts int
+	_, err := Retry(context.Background(), newTestPolicy(clock, 5*time.Second), func(ctx context.Context) (int, error) {
+		attempts++
+		return 0, context.DeadlineExceeded
+	})
+	suite.Assert().ErrorIs(err, context.DeadlineExceeded)
+
+	// 0.5s, 1s and 2s of backoff, the next 4s would end past the max elapsed time
+	suite.Assert().Equal(4, attempts)
+	suite.Assert().Equal([]time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second}, clock.waits)
+
+	// Without a max elapsed time the request is only tried once
+	clock = &fakeClock{now: time.Now()}
+	attempts = 0
+	_, err = Retry(context.Background(), newTestPolicy(clock, 0), func(ctx context.Context) (int, error) {
+		attempts++
+		return 0, context.DeadlineExceeded
+	})
+	suite.Assert().Error(err)
+	suite.Assert().Equal(1, attempts)
+}
+
+func (suite *RetryTestSuite) TestRetryPermanent() {
+	clock := &fakeClock{now: time.Now()}
+	var attempts int
+	notAvailable := &jsonrpctypes.RPCError{Code: -32603, Message: "Internal error", Data: "height 10 is not available, lowest height is 20"}
+	_, err := Retry(context.Background(), newTestPolicy(clock, time.Minute), func(ctx context.Context) (int, error) {
+		attempts++
+		return 0, notAvailable
+	})
+	suite.Assert().Equal(notAvailable, err)
+	suite.Assert().Equal(1, attempts)
+	suite.Assert().Empty(clock.waits)
+}
+
+func (suite *RetryTestSuite) TestRetryCancelled() {
+	ctx, cancel := context.WithCancel(context.Background())
+	var attempts int
+	_, err := Retry(ctx, newTestPolicy(&fakeClock{now: time.Now()}, time.Minute), func(ctx context.Context) (int, error) {
+		attempts++
+		cancel()
+		return 0, syscall.ECONNREFUSED
+	})
+	suite.Assert().Error(err)
+	suite.Assert().Equal(1, attempts)
+}
+
+func (suite *RetryTestSuite) TestIsTransientRPCError() {
+	for _, test := range []struct {
+		err       error
+		transient bool
+	}{
+		{context.DeadlineExceeded, true},
+		{fmt.Errorf("get: %w", syscall.ECONNRESET), true},
+		{errors.New(`post failed: Post "http://node:26657": read tcp: connection reset by peer`), true},
+		{errors.New("error in json rpc client, with http response metadata: (Status: 502 Bad Gateway, Protocol HTTP/1.1). invalid character '<'"), true},
+		{&HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("error unmarshalling")}, true},
+		{&HTTPStatusError{StatusCode: http.StatusTooManyRequests, Err: errors.New("error unmarshalling")}, true},
+		{&HTTPStatusError{StatusCode: http.StatusNotFound, Err: errors.New("error unmarshalling")}, false},
+		{&jsonrpctypes.RPCError{Code: -32603, Message: "Internal error", Data: "height 10 is not available, lowest height is 20"}, false},
+		{errors.New("error unmarshalling result: unexpected end of JSON input"), false},
+		{nil, false},
+	} {
+		suite.Assert().Equal(test.transient, IsTransientRPCError(test.err), "%v", test.err)
+	}
+}
+
+func (suite *RetryTestSuite) TestHTTPStatusError() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte("<html>502 Bad Gateway</html>"))
+	}))
+	defer server.Close()
+
+	client := URIClient{Address: server.URL, Client: server.Client()}
+	height := int64(10)
+	_, err := client.DoBlockResults(context.Background(), &height)
+
+	var statusErr *HTTPStatusError
+	suite.Require().ErrorAs(err, &statusErr)
+	suite.Assert().Equal(http.StatusBadGateway, statusErr.StatusCode)
+	suite.Assert().True(IsTransientRPCError(err))
+}
+
+func TestRetrySuite(t *testing.T) {
+	suite.Run(t, new(RetryTestSuite))
+}
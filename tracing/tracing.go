@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer of the indexer spans
+const InstrumentationName = "github.com/DefiantLabs/cosmos-indexer"
+
+// Attributes of the indexer spans
+const (
+	ChainID      = attribute.Key("chain_id")
+	Height       = attribute.Key("height")
+	EndHeight    = attribute.Key("end_height")
+	TxCount      = attribute.Key("tx_count")
+	MessageCount = attribute.Key("message_count")
+	EventCount   = attribute.Key("event_count")
+	Table        = attribute.Key("db.table")
+	RowCount     = attribute.Key("db.row_count")
+)
+
+// Setup exports the spans of the indexer to the OTLP gRPC endpoint, like localhost:4317. Returns the tracer provider, set as
+// the global tracer provider, and a function flushing the spans not yet exported on shutdown. Without an endpoint the global
+// tracer provider is left as is and spans are not recorded.
+func Setup(ctx context.Context, endpoint string, insecure bool) (trace.TracerProvider, func(context.Context) error, error) {
+	if endpoint == "" {
+		return otel.GetTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("cosmos-indexer"))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider, provider.Shutdown, nil
+}
+
+// Start starts a span of the global tracer provider
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(InstrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends the span, marking it as failed with err when err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ContextWithBlock returns ctx with the span context of the trace of a block as the parent of the spans started from it.
+// The spans of a block are started in the different stages of the indexer, which pass the span context on with the block.
+func ContextWithBlock(ctx context.Context, block trace.SpanContext) context.Context {
+	if !block.IsValid() {
+		return ctx
+	}
+	return trace.ContextWithSpanContext(ctx, block)
+}
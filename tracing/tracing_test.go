@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type TracingTestSuite struct {
+	suite.Suite
+	recorder *tracetest.SpanRecorder
+	previous trace.TracerProvider
+}
+
+func (suite *TracingTestSuite) SetupTest() {
+	suite.previous = otel.GetTracerProvider()
+	suite.recorder = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(suite.recorder)))
+}
+
+func (suite *TracingTestSuite) TearDownTest() {
+	otel.SetTracerProvider(suite.previous)
+}
+
+func (suite *TracingTestSuite) TestSetupWithoutEndpoint() {
+	provider, shutdown, err := Setup(context.Background(), "", false)
+	suite.Require().NoError(err)
+	suite.Assert().Equal(otel.GetTracerProvider(), provider)
+	suite.Assert().NoError(shutdown(context.Background()))
+}
+
+func (suite *TracingTestSuite) TestBlockTrace() {
+	_, fetch := Start(context.Background(), "fetch_block", Height.Int64(10))
+	End(fetch, nil)
+
+	// A later stage continues the trace of the block from its span context
+	_, index := Start(ContextWithBlock(context.Background(), fetch.SpanContext()), "IndexNewBlock")
+	End(index, errors.New("insert failed"))
+
+	// Without a block, spans start a new trace
+	_, other := Start(ContextWithBlock(context.Background(), trace.SpanContext{}), "IndexNewBlock")
+	End(other, nil)
+
+	spans := suite.recorder.Ended()
+	suite.Require().Len(spans, 3)
+	suite.Assert().Equal(codes.Unset, spans[0].Status().Code)
+	suite.Assert().Equal(fetch.SpanContext().TraceID(), spans[1].SpanContext().TraceID())
+	suite.Assert().Equal(fetch.SpanContext().SpanID(), spans[1].Parent().SpanID())
+	suite.Assert().Equal(codes.Error, spans[1].Status().Code)
+	suite.Assert().Equal("insert failed", spans[1].Status().Description)
+	suite.Assert().Len(spans[1].Events(), 1)
+	suite.Assert().NotEqual(fetch.SpanContext().TraceID(), spans[2].SpanContext().TraceID())
+	suite.Assert().False(spans[2].Parent().IsValid())
+}
+
+func TestTracing(t *testing.T) {
+	suite.Run(t, new(TracingTestSuite))
+}
@@ -1,8 +1,12 @@
 package util
 
 import (
+	"encoding/hex"
 	"math/big"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/cosmos/cosmos-sdk/types/bech32"
 	"github.com/shopspring/decimal"
 )
 
@@ -27,3 +31,24 @@ func RemoveDuplicatesFromUint64Slice(sliceList []uint64) []uint64 {
 	}
 	return list
 }
+
+// SanitizeText returns the value with null bytes removed and invalid UTF-8 sequences replaced with the Unicode replacement character,
+// so it can be stored in a PostgreSQL text column. The bool is true if the value was changed.
+func SanitizeText(value string) (string, bool) {
+	if utf8.ValidString(value) && !strings.ContainsRune(value, 0) {
+		return value, false
+	}
+
+	return strings.ReplaceAll(strings.ToValidUTF8(value, string(utf8.RuneError)), "\x00", ""), true
+}
+
+// CanonicalAddressHex returns the lowercase hex encoding of the bytes behind a bech32 address, so the same account can be matched
+// across chains with different prefixes. It returns an empty string for values that are not bech32 addresses.
+func CanonicalAddressHex(address string) string {
+	_, data, err := bech32.DecodeAndConvert(address)
+	if err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(data)
+}
@@ -0,0 +1,421 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	dbTypes "github.com/DefiantLabs/cosmos-indexer/db"
+	"github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"gorm.io/gorm"
+)
+
+// Backoff between the attempts to deliver an event, doubled after every failed attempt
+const (
+	initialBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// Headers of the POSTs to a webhook
+const (
+	TriggerHeader   = "X-Cosmos-Indexer-Trigger"
+	TimestampHeader = "X-Cosmos-Indexer-Timestamp" // Unix time in seconds the POST was sent at
+	SignatureHeader = "X-Cosmos-Indexer-Signature" // sha256=<Sign of the body>, set when the webhook has a secret
+)
+
+// Event is the JSON body POSTed to a webhook when one of its triggers fires. Only the section of the trigger is set.
+type Event struct {
+	Trigger      string             `json:"trigger"`
+	Webhook      string             `json:"webhook"`
+	ChainID      string             `json:"chain_id"`
+	FiredAt      time.Time          `json:"fired_at"`
+	Block        *BlockEvent        `json:"block,omitempty"`         // block trigger
+	Tx           *TxEvent           `json:"tx,omitempty"`            // watched-address and message-type triggers
+	FailedBlocks *FailedBlocksEvent `json:"failed_blocks,omitempty"` // failed-blocks trigger
+}
+
+// BlockEvent is the block committed to the database. The dataset is txs or block_events, a block indexed with both
+// datasets fires the trigger once for each.
+type BlockEvent struct {
+	Height    int64     `json:"height"`
+	Hash      string    `json:"hash"`
+	Timestamp time.Time `json:"timestamp"`
+	Dataset   string    `json:"dataset"`
+	TxCount   int       `json:"tx_count"`
+}
+
+// TxEvent is the tx committed to the database
+type TxEvent struct {
+	Height              int64     `json:"height"`
+	Timestamp           time.Time `json:"timestamp"`
+	Hash                string    `json:"hash"`
+	Code                uint32    `json:"code"`
+	Signers             []string  `json:"signers"`
+	MessageTypes        []string  `json:"message_types"`
+	WatchedAddresses    []string  `json:"watched_addresses,omitempty"`     // watched-address trigger
+	MatchedMessageTypes []string  `json:"matched_message_types,omitempty"` // message-type trigger, in message order
+}
+
+// FailedBlocksEvent is the number of failed blocks of the chain when it exceeded the threshold of the webhook
+type FailedBlocksEvent struct {
+	Count     int64 `json:"count"`
+	Threshold int64 `json:"threshold"`
+}
+
+// Sign returns the hex HMAC-SHA256 keyed with the secret of "<timestamp>.<body>", the signature of the body POSTed at the
+// timestamp of the TimestampHeader. Receivers recompute it to check the event comes from the indexer, and reject old
+// timestamps to prevent replays.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier delivers the events fired by the triggers of the webhooks. Each webhook has its own queue and delivers its
+// events one at a time in the order they fired, so a slow receiver only delays its own events and never indexing.
+type Notifier struct {
+	endpoints []*endpoint
+	wg        sync.WaitGroup
+}
+
+// NewNotifier returns a notifier of the webhooks of the config. Deliveries are recorded in the metrics, indexMetrics may
+// be nil.
+func NewNotifier(webhooks []config.Webhook, indexMetrics *metrics.Metrics) *Notifier {
+	n := &Notifier{endpoints: make([]*endpoint, len(webhooks))}
+	for i, webhook := range webhooks {
+		n.endpoints[i] = &endpoint{
+			conf:                 webhook,
+			client:               http.DefaultClient,
+			queue:                make(chan Event, webhook.QueueSize),
+			messageTypes:         make(map[string]struct{}, len(webhook.MessageTypes)),
+			backoff:              initialBackoff,
+			failedBlocksInterval: time.Duration(webhook.FailedBlocksInterval) * time.Second,
+			metrics:              indexMetrics,
+		}
+		for _, messageType := range webhook.MessageTypes {
+			n.endpoints[i].messageTypes[messageType] = struct{}{}
+		}
+	}
+	return n
+}
+
+// Start delivers the events queued for each webhook in the background until Close. Failed deliveries stop being retried
+// once ctx is cancelled.
+func (n *Notifier) Start(ctx context.Context) {
+	for _, e := range n.endpoints {
+		n.wg.Add(1)
+		go func(e *endpoint) {
+			defer n.wg.Done()
+			for event := range e.queue {
+				e.deliver(ctx, event)
+			}
+		}(e)
+	}
+}
+
+// Close stops queueing events and waits for the events already queued to be delivered
+func (n *Notifier) Close() {
+	for _, e := range n.endpoints {
+		e.close()
+	}
+	n.wg.Wait()
+}
+
+// Run queues the events fired by the block notifications until the channel is closed
+func (n *Notifier) Run(notifications <-chan indexer.IndexedBlockNotification) {
+	for notification := range notifications {
+		n.Notify(notification)
+	}
+}
+
+// Notify queues the events the committed block fires for each webhook: the block and, for the txs dataset, the txs
+// involving watched addresses or with messages of the types of the webhook. It never blocks, the events of a webhook
+// with a full queue are dropped.
+func (n *Notifier) Notify(notification indexer.IndexedBlockNotification) {
+	firedAt := time.Now().UTC()
+
+	for _, e := range n.endpoints {
+		if e.conf.ChainID != "" && e.conf.ChainID != notification.ChainID {
+			continue
+		}
+
+		if e.conf.HasTrigger(config.WebhookTriggerBlock) {
+			e.enqueue(Event{
+				Trigger: config.WebhookTriggerBlock,
+				Webhook: e.conf.Name,
+				ChainID: notification.ChainID,
+				FiredAt: firedAt,
+				Block: &BlockEvent{
+					Height:    notification.Height,
+					Hash:      notification.BlockHash,
+					Timestamp: notification.TimeStamp.UTC(),
+					Dataset:   notification.Dataset.String(),
+					TxCount:   len(notification.Txs),
+				},
+			})
+		}
+
+		for _, tx := range notification.Txs {
+			if e.conf.HasTrigger(config.WebhookTriggerWatchedAddress) && len(tx.WatchedAddresses) != 0 {
+				event := newTxEvent(config.WebhookTriggerWatchedAddress, e.conf.Name, firedAt, notification, tx)
+				event.Tx.WatchedAddresses = tx.WatchedAddresses
+				e.enqueue(event)
+			}
+
+			if matched := e.matchMessageTypes(tx.MessageTypes); len(matched) != 0 {
+				event := newTxEvent(config.WebhookTriggerMessageType, e.conf.Name, firedAt, notification, tx)
+				event.Tx.MatchedMessageTypes = matched
+				e.enqueue(event)
+			}
+		}
+	}
+}
+
+func newTxEvent(trigger string, webhook string, firedAt time.Time, block indexer.IndexedBlockNotification, tx indexer.IndexedTxNotification) Event {
+	return Event{
+		Trigger: trigger,
+		Webhook: webhook,
+		ChainID: block.ChainID,
+		FiredAt: firedAt,
+		Tx: &TxEvent{
+			Height:       block.Height,
+			Timestamp:    block.TimeStamp.UTC(),
+			Hash:         tx.Hash,
+			Code:         tx.Code,
+			Signers:      tx.SignerAddresses,
+			MessageTypes: tx.MessageTypes,
+		},
+	}
+}
+
+// WatchFailedBlocks checks the failed blocks recorded for the chains on the interval of each webhook with the
+// failed-blocks trigger until ctx is cancelled. The trigger fires when the failed blocks of a chain exceed the threshold
+// of the webhook, and fires again once they went back to the threshold and exceed it again.
+func (n *Notifier) WatchFailedBlocks(ctx context.Context, db *gorm.DB, chainIDs []string) {
+	n.watchFailedBlocks(ctx, chainIDs, func(ctx context.Context, chainID string) (int64, error) {
+		chain, err := dbTypes.GetChainRef(ctx, db, chainID)
+		if err != nil {
+			return 0, err
+		}
+		// Nothing was recorded for a chain that was never indexed
+		if chain.Validate() != nil {
+			return 0, nil
+		}
+		return dbTypes.CountFailedBlocks(ctx, db, chain)
+	})
+}
+
+func (n *Notifier) watchFailedBlocks(ctx context.Context, chainIDs []string, countFailedBlocks func(ctx context.Context, chainID string) (int64, error)) {
+	var wg sync.WaitGroup
+	for _, e := range n.endpoints {
+		if !e.conf.HasTrigger(config.WebhookTriggerFailedBlocks) {
+			continue
+		}
+
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			e.watchFailedBlocks(ctx, chainIDs, countFailedBlocks)
+		}(e)
+	}
+	wg.Wait()
+}
+
+// endpoint is a webhook with its queue of events
+type endpoint struct {
+	conf                 config.Webhook
+	client               *http.Client
+	messageTypes         map[string]struct{}
+	backoff              time.Duration
+	failedBlocksInterval time.Duration
+	metrics              *metrics.Metrics
+
+	// Events are queued until the queue is closed
+	mu       sync.RWMutex
+	closed   bool
+	queue    chan Event
+	dropping atomic.Bool // Logged once when the queue fills up
+}
+
+// matchMessageTypes returns the message types of the webhook among the types, in message order and without duplicates
+func (e *endpoint) matchMessageTypes(messageTypes []string) []string {
+	var matched []string
+	for _, messageType := range messageTypes {
+		if _, ok := e.messageTypes[messageType]; !ok {
+			continue
+		}
+		if !slices.Contains(matched, messageType) {
+			matched = append(matched, messageType)
+		}
+	}
+	return matched
+}
+
+func (e *endpoint) enqueue(event Event) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return
+	}
+
+	select {
+	case e.queue <- event:
+		e.dropping.Store(false)
+	default:
+		if !e.dropping.Swap(true) {
+			config.Log.Warnf("Queue of webhook %s is full, dropping its events until it has room", e.conf.Name)
+		}
+		if e.metrics != nil {
+			e.metrics.ObserveWebhookDropped(e.conf.Name, metrics.WebhookDroppedQueueFull)
+		}
+	}
+}
+
+func (e *endpoint) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+}
+
+// deliver POSTs the event to the webhook, retrying with exponential backoff the deliveries that may succeed later until
+// the attempts run out or ctx is cancelled
+func (e *endpoint) deliver(ctx context.Context, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		config.Log.Error(fmt.Sprintf("Error encoding the %s event of webhook %s", event.Trigger, e.conf.Name), err)
+		e.observeDropped()
+		return
+	}
+
+	backoff := e.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := e.post(ctx, event.Trigger, body)
+		if err == nil {
+			if e.metrics != nil {
+				e.metrics.ObserveWebhookDelivered(e.conf.Name, event.Trigger)
+			}
+			return
+		}
+
+		if !retry || attempt >= int(e.conf.MaxAttempts) || ctx.Err() != nil {
+			config.Log.Error(fmt.Sprintf("Dropping the %s event of %s after %d failed deliveries to webhook %s", event.Trigger, event.ChainID, attempt, e.conf.Name), err)
+			e.observeDropped()
+			return
+		}
+
+		config.Log.Warn(fmt.Sprintf("Error delivering the %s event of %s to webhook %s, retrying in %s", event.Trigger, event.ChainID, e.conf.Name, backoff), err)
+		if e.metrics != nil {
+			e.metrics.ObserveWebhookRetry(e.conf.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post POSTs the body to the webhook. retry is true when the delivery failed and may succeed later: the request failed,
+// or the receiver returned a server error or rate limited it.
+func (e *endpoint) post(ctx context.Context, trigger string, body []byte) (retry bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(e.conf.Timeout)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TriggerHeader, trigger)
+	req.Header.Set(TimestampHeader, timestamp)
+	if e.conf.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(e.conf.Secret, timestamp, body))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	// Read so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
+
+func (e *endpoint) observeDropped() {
+	if e.metrics != nil {
+		e.metrics.ObserveWebhookDropped(e.conf.Name, metrics.WebhookDroppedDeliveryFailed)
+	}
+}
+
+func (e *endpoint) watchFailedBlocks(ctx context.Context, chainIDs []string, countFailedBlocks func(ctx context.Context, chainID string) (int64, error)) {
+	ticker := time.NewTicker(e.failedBlocksInterval)
+	defer ticker.Stop()
+
+	exceeded := make(map[string]bool)
+	for {
+		for _, chainID := range chainIDs {
+			if e.conf.ChainID != "" && e.conf.ChainID != chainID {
+				continue
+			}
+
+			count, err := countFailedBlocks(ctx, chainID)
+			if err != nil {
+				if ctx.Err() == nil {
+					config.Log.Error(fmt.Sprintf("Error counting the failed blocks of %s for webhook %s", chainID, e.conf.Name), err)
+				}
+				continue
+			}
+
+			if count <= e.conf.FailedBlocksThreshold {
+				exceeded[chainID] = false
+				continue
+			}
+			if exceeded[chainID] {
+				continue
+			}
+			exceeded[chainID] = true
+
+			e.enqueue(Event{
+				Trigger:      config.WebhookTriggerFailedBlocks,
+				Webhook:      e.conf.Name,
+				ChainID:      chainID,
+				FiredAt:      time.Now().UTC(),
+				FailedBlocks: &FailedBlocksEvent{Count: count, Threshold: e.conf.FailedBlocksThreshold},
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DefiantLabs/cosmos-indexer/config"
+	"github.com/DefiantLabs/cosmos-indexer/indexer"
+	"github.com/DefiantLabs/cosmos-indexer/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/suite"
+)
+
+type WebhookTestSuite struct {
+	suite.Suite
+	server *httptest.Server
+
+	mu       sync.Mutex
+	statuses []int // Statuses returned to the next requests, 200 once they run out
+	requests []*http.Request
+	events   []Event
+	bodies   [][]byte
+}
+
+func (suite *WebhookTestSuite) SetupTest() {
+	suite.statuses = nil
+	suite.requests = nil
+	suite.events = nil
+	suite.bodies = nil
+
+	suite.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		suite.Require().NoError(err)
+
+		suite.mu.Lock()
+		defer suite.mu.Unlock()
+
+		var event Event
+		suite.Require().NoError(json.Unmarshal(body, &event))
+		suite.requests = append(suite.requests, r)
+		suite.events = append(suite.events, event)
+		suite.bodies = append(suite.bodies, body)
+
+		status := http.StatusOK
+		if len(suite.statuses) != 0 {
+			status, suite.statuses = suite.statuses[0], suite.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+}
+
+func (suite *WebhookTestSuite) TearDownTest() {
+	suite.server.Close()
+}
+
+func (suite *WebhookTestSuite) webhook(name string, triggers ...string) config.Webhook {
+	return config.Webhook{
+		Name:        name,
+		URL:         suite.server.URL + "/" + name,
+		Triggers:    triggers,
+		QueueSize:   10,
+		MaxAttempts: 3,
+		Timeout:     5,
+	}
+}
+
+func newNotifier(webhooks []config.Webhook, indexMetrics *metrics.Metrics) *Notifier {
+	n := NewNotifier(webhooks, indexMetrics)
+	for _, e := range n.endpoints {
+		e.backoff = time.Millisecond
+		e.failedBlocksInterval = time.Millisecond
+	}
+	return n
+}
+
+func mockBlockNotification(chainID string, height int64) indexer.IndexedBlockNotification {
+	return indexer.IndexedBlockNotification{
+		ChainID:   chainID,
+		Height:    height,
+		BlockHash: "BLOCKHASH",
+		TimeStamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Dataset:   indexer.BlockDatasetTxs,
+		Txs: []indexer.IndexedTxNotification{
+			{Hash: "hash1", SignerAddresses: []string{"addr1"}, WatchedAddresses: []string{"addr1"}, MessageTypes: []string{"/cosmos.bank.v1beta1.MsgSend"}},
+			{Hash: "hash2", SignerAddresses: []string{"addr2"}, MessageTypes: []string{"/cosmos.staking.v1beta1.MsgDelegate", "/cosmos.staking.v1beta1.MsgDelegate"}},
+		},
+	}
+}
+
+func (suite *WebhookTestSuite) TestNotify() {
+	all := suite.webhook("all", config.WebhookTriggerBlock, config.WebhookTriggerWatchedAddress, config.WebhookTriggerMessageType)
+	all.MessageTypes = []string{"/cosmos.staking.v1beta1.MsgDelegate"}
+	all.Secret = "secret"
+	otherChain := suite.webhook("other", config.WebhookTriggerBlock)
+	otherChain.ChainID = "otherchain-1"
+
+	indexMetrics := metrics.New()
+	n := newNotifier([]config.Webhook{all, otherChain}, indexMetrics)
+	n.Start(context.Background())
+	n.Notify(mockBlockNotification("testchain-1", 10))
+	n.Close()
+
+	// Delivered in the order they fired, the webhook of the other chain gets nothing
+	suite.Require().Len(suite.events, 3)
+	suite.Assert().Equal(config.WebhookTriggerBlock, suite.events[0].Trigger)
+	suite.Assert().Equal(&BlockEvent{Height: 10, Hash: "BLOCKHASH", Timestamp: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Dataset: "txs", TxCount: 2}, suite.events[0].Block)
+	suite.Assert().Nil(suite.events[0].Tx)
+
+	suite.Assert().Equal(config.WebhookTriggerWatchedAddress, suite.events[1].Trigger)
+	suite.Assert().Equal("hash1", suite.events[1].Tx.Hash)
+	suite.Assert().Equal([]string{"addr1"}, suite.events[1].Tx.WatchedAddresses)
+
+	suite.Assert().Equal(config.WebhookTriggerMessageType, suite.events[2].Trigger)
+	suite.Assert().Equal("hash2", suite.events[2].Tx.Hash)
+	suite.Assert().Equal([]string{"/cosmos.staking.v1beta1.MsgDelegate"}, suite.events[2].Tx.MatchedMessageTypes)
+	suite.Assert().Equal("testchain-1", suite.events[2].ChainID)
+	suite.Assert().Equal("all", suite.events[2].Webhook)
+
+	for i, request := range suite.requests {
+		suite.Assert().Equal("/all", request.URL.Path)
+		suite.Assert().Equal("application/json", request.Header.Get("Content-Type"))
+		suite.Assert().Equal(suite.events[i].Trigger, request.Header.Get(TriggerHeader))
+		suite.Assert().Equal("sha256="+Sign("secret", request.Header.Get(TimestampHeader), suite.bodies[i]), request.Header.Get(SignatureHeader))
+	}
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.WebhookDelivered.WithLabelValues("all", config.WebhookTriggerBlock)))
+
+	// Unsigned without a secret, block events have no txs
+	n = newNotifier([]config.Webhook{otherChain}, nil)
+	n.Start(context.Background())
+	notification := mockBlockNotification("otherchain-1", 20)
+	notification.Dataset = indexer.BlockDatasetBlockEvents
+	notification.Txs = nil
+	n.Notify(notification)
+	n.Close()
+
+	suite.Require().Len(suite.events, 4)
+	suite.Assert().Equal("block_events", suite.events[3].Block.Dataset)
+	suite.Assert().Empty(suite.requests[3].Header.Get(SignatureHeader))
+}
+
+func (suite *WebhookTestSuite) TestRetries() {
+	suite.statuses = []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}
+	indexMetrics := metrics.New()
+	n := newNotifier([]config.Webhook{suite.webhook("blocks", config.WebhookTriggerBlock)}, indexMetrics)
+	n.Start(context.Background())
+	n.Notify(mockBlockNotification("testchain-1", 10))
+	n.Close()
+
+	suite.Assert().Len(suite.events, 3)
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.WebhookDelivered.WithLabelValues("blocks", config.WebhookTriggerBlock)))
+	suite.Assert().Equal(2.0, testutil.ToFloat64(indexMetrics.WebhookRetries.WithLabelValues("blocks")))
+
+	// Dropped once the attempts run out, client errors are not retried
+	suite.statuses = []int{http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusBadRequest}
+	n = newNotifier([]config.Webhook{suite.webhook("blocks", config.WebhookTriggerBlock)}, indexMetrics)
+	n.Start(context.Background())
+	n.Notify(mockBlockNotification("testchain-1", 11))
+	n.Notify(mockBlockNotification("testchain-1", 12))
+	n.Close()
+
+	suite.Assert().Len(suite.events, 7)
+	suite.Assert().Equal(2.0, testutil.ToFloat64(indexMetrics.WebhookDropped.WithLabelValues("blocks", metrics.WebhookDroppedDeliveryFailed)))
+	suite.Assert().Equal(4.0, testutil.ToFloat64(indexMetrics.WebhookRetries.WithLabelValues("blocks")))
+}
+
+func (suite *WebhookTestSuite) TestQueueFull() {
+	small := suite.webhook("small", config.WebhookTriggerBlock)
+	small.QueueSize = 1
+	indexMetrics := metrics.New()
+	n := newNotifier([]config.Webhook{small, suite.webhook("large", config.WebhookTriggerBlock)}, indexMetrics)
+
+	// Nothing is delivered before Start, the queue of the small webhook fills up without affecting the other
+	n.Notify(mockBlockNotification("testchain-1", 10))
+	n.Notify(mockBlockNotification("testchain-1", 11))
+	n.Start(context.Background())
+	n.Close()
+
+	// Events are no longer queued once closed
+	n.Notify(mockBlockNotification("testchain-1", 12))
+
+	suite.Assert().Len(suite.events, 3)
+	suite.Assert().Equal(1.0, testutil.ToFloat64(indexMetrics.WebhookDropped.WithLabelValues("small", metrics.WebhookDroppedQueueFull)))
+	suite.Assert().Equal(2.0, testutil.ToFloat64(indexMetrics.WebhookDelivered.WithLabelValues("large", config.WebhookTriggerBlock)))
+}
+
+func (suite *WebhookTestSuite) TestFailedBlocks() {
+	alerts := suite.webhook("alerts", config.WebhookTriggerFailedBlocks)
+	alerts.FailedBlocksThreshold = 4
+	otherChain := suite.webhook("other", config.WebhookTriggerFailedBlocks)
+	otherChain.ChainID = "otherchain-1"
+	n := newNotifier([]config.Webhook{alerts, otherChain, suite.webhook("blocks", config.WebhookTriggerBlock)}, nil)
+
+	// Fires when the count exceeds the threshold, and again after it went back to the threshold
+	counts := []int64{2, 5, 6, 4, 7, 8}
+	ctx, cancel := context.WithCancel(context.Background())
+	n.watchFailedBlocks(ctx, []string{"testchain-1"}, func(ctx context.Context, chainID string) (int64, error) {
+		suite.Assert().Equal("testchain-1", chainID)
+		if len(counts) == 1 {
+			cancel()
+		}
+		count := counts[0]
+		counts = counts[1:]
+		return count, nil
+	})
+
+	n.Start(context.Background())
+	n.Close()
+
+	suite.Require().Len(suite.events, 2)
+	suite.Assert().Equal(&FailedBlocksEvent{Count: 5, Threshold: 4}, suite.events[0].FailedBlocks)
+	suite.Assert().Equal(&FailedBlocksEvent{Count: 7, Threshold: 4}, suite.events[1].FailedBlocks)
+	suite.Assert().Equal("testchain-1", suite.events[1].ChainID)
+	suite.Assert().Equal(config.WebhookTriggerFailedBlocks, suite.requests[1].Header.Get(TriggerHeader))
+}
+
+func TestWebhookSuite(t *testing.T) {
+	suite.Run(t, new(WebhookTestSuite))
+}